@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime/pprof"
+
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/bench"
+	"sniffox/internal/engine"
+)
+
+// runBench implements `sniffox bench [flags] [file.pcap]`: it replays the
+// file, or the built-in workload, through the packet pipeline and reports
+// throughput and allocations. It returns the process exit code.
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	rounds := fs.Int("rounds", 5, "Times to replay the packets")
+	asJSON := fs.Bool("json", false, "Print the result as JSON")
+	cpuProfile := fs.String("cpuprofile", "", "Write a CPU profile of the run to this file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: sniffox bench [flags] [file.pcap]\n\n"+
+			"Replays a capture file, or without one the built-in workload, through the\n"+
+			"parse, flow and stream pipeline with no network or clients. A run of the\n"+
+			"built-in workload is also checked for the expected results.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var frames []engine.BenchFrame
+	var linkType layers.LinkType
+	source := "built-in workload"
+	if fs.NArg() > 0 {
+		var err error
+		source = fs.Arg(0)
+		if frames, linkType, err = bench.ReadFile(source); err != nil {
+			log.Printf("Bench: %v", err)
+			return 1
+		}
+	} else {
+		frames, linkType = bench.Synthetic()
+	}
+
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			log.Printf("Bench: %v", err)
+			return 1
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			log.Printf("Bench: %v", err)
+			return 1
+		}
+	}
+	res, err := engine.New().Bench(frames, linkType, *rounds)
+	if *cpuProfile != "" {
+		pprof.StopCPUProfile()
+	}
+	if err != nil {
+		log.Printf("Bench: %v", err)
+		return 1
+	}
+
+	var failed []string
+	if fs.NArg() == 0 {
+		failed = bench.SelfTest(res, len(frames))
+	}
+
+	if *asJSON {
+		out := struct {
+			Source   string              `json:"source"`
+			Result   *engine.BenchResult `json:"result"`
+			Failures []string            `json:"selfTestFailures,omitempty"`
+		}{source, res, failed}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(out)
+	} else {
+		fmt.Printf("%d packets x %d rounds from %s\n", len(frames), res.Rounds, source)
+		fmt.Printf("  elapsed      %v\n", res.Elapsed.Round(1000))
+		fmt.Printf("  throughput   %.0f packets/s, %.1f Mbit/s\n", res.PacketsPerSec, res.MbitPerSec)
+		fmt.Printf("  allocations  %.1f allocs/packet, %.0f bytes/packet, %d GC cycles\n",
+			res.AllocsPerPacket, res.BytesPerPacket, res.GCCycles)
+		fmt.Printf("  last round   %d packets, %d flows, %d streams, %d protocols\n",
+			res.Processed, res.Flows, res.Streams, len(res.Protocols))
+		if fs.NArg() == 0 {
+			if len(failed) == 0 {
+				fmt.Println("  self-test    ok")
+			}
+			for _, f := range failed {
+				fmt.Printf("  self-test    FAIL: %s\n", f)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return 1
+	}
+	return 0
+}
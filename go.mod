@@ -3,11 +3,10 @@ module sniffox
 go 1.23.0
 
 require (
+	github.com/andybalholm/brotli v1.1.1
 	github.com/google/gopacket v1.1.19
 	github.com/gorilla/websocket v1.5.3
+	golang.org/x/net v0.0.0-20190620200207-3b0461eec859
 )
 
-require (
-	golang.org/x/net v0.0.0-20190620200207-3b0461eec859 // indirect
-	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
-)
+require golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
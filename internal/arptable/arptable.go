@@ -0,0 +1,273 @@
+// Package arptable keeps the IPv4-to-MAC bindings learned from ARP and a
+// per-address history of which MAC answered for it and when. Default
+// gateways are identified so that, after an ARP-spoofing alert, the
+// window during which another MAC held the gateway address can be
+// reconstructed.
+package arptable
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/geoip"
+)
+
+const (
+	maxEntries  = 4096
+	maxBindings = 64  // per address; the oldest are dropped
+	maxEvents   = 256 // per address; the oldest are dropped
+)
+
+// Event types recorded on an address's timeline.
+const (
+	EventNew        = "new"        // first MAC seen for the address
+	EventChange     = "change"     // a different MAC claimed the address
+	EventGratuitous = "gratuitous" // unsolicited announcement (sender IP == target IP)
+)
+
+// Binding is a contiguous period during which one MAC answered for an
+// address.
+type Binding struct {
+	MAC     string    `json:"mac"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Packets int       `json:"packets"` // ARP packets claiming the address in this period
+}
+
+// Event is one entry on an address's timeline.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	MAC     string    `json:"mac"`
+	PrevMAC string    `json:"prevMac,omitempty"`
+}
+
+// Entry is the ARP state of one IPv4 address.
+type Entry struct {
+	IP            string    `json:"ip"`
+	MAC           string    `json:"mac"` // most recent claimant
+	FirstSeen     time.Time `json:"firstSeen"`
+	LastSeen      time.Time `json:"lastSeen"`
+	Changes       int       `json:"changes"`
+	Gateway       bool      `json:"gateway"`
+	GatewaySource string    `json:"gatewaySource,omitempty"` // "dhcp" or "next-hop"
+	Bindings      []Binding `json:"bindings,omitempty"`
+	Events        []Event   `json:"events,omitempty"`
+}
+
+// Tracker builds the ARP table.
+type Tracker struct {
+	mu       sync.Mutex
+	entries  map[string]*Entry
+	nextHops map[string]int // MAC -> packets it forwarded to or from public addresses
+}
+
+// NewTracker creates an empty ARP table.
+func NewTracker() *Tracker {
+	t := &Tracker{}
+	t.Reset()
+	return t
+}
+
+// Observe records ARP claims, DHCP-advertised routers and the next-hop MAC
+// of traffic to or from public addresses.
+func (t *Tracker) Observe(pkt gopacket.Packet) {
+	ts := pkt.Metadata().Timestamp
+	if l := pkt.Layer(layers.LayerTypeARP); l != nil {
+		t.observeARP(l.(*layers.ARP), ts)
+		return
+	}
+	if l := pkt.Layer(layers.LayerTypeDHCPv4); l != nil {
+		t.observeDHCP(l.(*layers.DHCPv4))
+	}
+	ethLayer, ipLayer := pkt.Layer(layers.LayerTypeEthernet), pkt.Layer(layers.LayerTypeIPv4)
+	if ethLayer == nil || ipLayer == nil {
+		return
+	}
+	eth, ip := ethLayer.(*layers.Ethernet), ipLayer.(*layers.IPv4)
+	switch {
+	case ip.SrcIP.IsPrivate() && geoip.IsPublic(ip.DstIP):
+		t.nextHop(eth.DstMAC.String())
+	case geoip.IsPublic(ip.SrcIP) && ip.DstIP.IsPrivate():
+		t.nextHop(eth.SrcMAC.String())
+	}
+}
+
+func (t *Tracker) observeARP(arp *layers.ARP, ts time.Time) {
+	if len(arp.SourceProtAddress) != 4 || len(arp.DstProtAddress) != 4 {
+		return
+	}
+	sender := net.IP(arp.SourceProtAddress).String()
+	if sender == "0.0.0.0" {
+		return // RFC 5227 probe, claims nothing
+	}
+	mac := net.HardwareAddr(arp.SourceHwAddress).String()
+	gratuitous := sender == net.IP(arp.DstProtAddress).String()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.entries[sender]
+	if !ok {
+		if len(t.entries) >= maxEntries {
+			return
+		}
+		e = &Entry{IP: sender}
+		t.entries[sender] = e
+	}
+	if len(e.Bindings) == 0 {
+		e.FirstSeen = ts
+		e.addEvent(Event{Time: ts, Type: EventNew, MAC: mac})
+	}
+
+	if n := len(e.Bindings); n > 0 && e.Bindings[n-1].MAC == mac {
+		e.Bindings[n-1].To = ts
+		e.Bindings[n-1].Packets++
+	} else {
+		if n > 0 {
+			e.Changes++
+			e.addEvent(Event{Time: ts, Type: EventChange, MAC: mac, PrevMAC: e.MAC})
+		}
+		e.Bindings = append(e.Bindings, Binding{MAC: mac, From: ts, To: ts, Packets: 1})
+		if len(e.Bindings) > maxBindings {
+			e.Bindings = e.Bindings[len(e.Bindings)-maxBindings:]
+		}
+	}
+	if gratuitous {
+		e.addEvent(Event{Time: ts, Type: EventGratuitous, MAC: mac})
+	}
+	e.MAC = mac
+	e.LastSeen = ts
+
+	// A MAC that routes public traffic and owns exactly one address is the
+	// gateway's. Spoofers also end up forwarding, but claim their own
+	// address as well and so own two.
+	if !e.Gateway && t.nextHops[mac] > 0 && t.owned(mac) == 1 {
+		e.Gateway, e.GatewaySource = true, "next-hop"
+	}
+}
+
+func (t *Tracker) observeDHCP(dhcp *layers.DHCPv4) {
+	for _, opt := range dhcp.Options {
+		if opt.Type != layers.DHCPOptRouter {
+			continue
+		}
+		t.mu.Lock()
+		for i := 0; i+4 <= len(opt.Data); i += 4 {
+			ip := net.IP(opt.Data[i : i+4]).String()
+			e, ok := t.entries[ip]
+			if !ok {
+				if len(t.entries) >= maxEntries {
+					continue
+				}
+				e = &Entry{IP: ip}
+				t.entries[ip] = e
+			}
+			e.Gateway, e.GatewaySource = true, "dhcp"
+		}
+		t.mu.Unlock()
+	}
+}
+
+func (t *Tracker) nextHop(mac string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, seen := t.nextHops[mac]; !seen && len(t.nextHops) >= maxEntries {
+		return
+	}
+	t.nextHops[mac]++
+	if t.nextHops[mac] > 1 {
+		return
+	}
+	// First sighting: mark the address it currently answers for, if unique
+	var owner *Entry
+	for _, e := range t.entries {
+		if e.MAC == mac {
+			if owner != nil {
+				return
+			}
+			owner = e
+		}
+	}
+	if owner != nil && !owner.Gateway {
+		owner.Gateway, owner.GatewaySource = true, "next-hop"
+	}
+}
+
+// owned counts the addresses mac currently answers for. Callers hold t.mu.
+func (t *Tracker) owned(mac string) int {
+	n := 0
+	for _, e := range t.entries {
+		if e.MAC == mac {
+			n++
+		}
+	}
+	return n
+}
+
+func (e *Entry) addEvent(ev Event) {
+	e.Events = append(e.Events, ev)
+	if len(e.Events) > maxEvents {
+		e.Events = e.Events[len(e.Events)-maxEvents:]
+	}
+}
+
+// Table returns the current bindings, without history, sorted by address.
+func (t *Tracker) Table() []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Entry, 0, len(t.entries))
+	for _, e := range t.entries {
+		if e.MAC == "" {
+			continue // router learned from DHCP but not yet seen in ARP
+		}
+		cp := *e
+		cp.Bindings, cp.Events = nil, nil
+		out = append(out, cp)
+	}
+	sortEntries(out)
+	return out
+}
+
+// Timeline returns the full binding and event history of ip, or of every
+// gateway when ip is empty.
+func (t *Tracker) Timeline(ip string) []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := []Entry{}
+	for _, e := range t.entries {
+		if (ip == "" && e.Gateway) || e.IP == ip {
+			cp := *e
+			cp.Bindings = append([]Binding(nil), e.Bindings...)
+			cp.Events = append([]Event(nil), e.Events...)
+			out = append(out, cp)
+		}
+	}
+	sortEntries(out)
+	return out
+}
+
+// Reset clears the table.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = make(map[string]*Entry)
+	t.nextHops = make(map[string]int)
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := net.ParseIP(entries[i].IP).To4(), net.ParseIP(entries[j].IP).To4()
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,130 @@
+// Package audit keeps an append-only trail of what users did: starting
+// and stopping captures, loading, saving and deleting sessions, exporting
+// packets and viewing streams.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxRecent is how many entries are kept in memory for queries; the file
+// keeps them all.
+const maxRecent = 10000
+
+// Actions
+const (
+	CaptureStart  = "capture.start"
+	CaptureStop   = "capture.stop"
+	PcapUpload    = "pcap.upload"
+	PcapExport    = "pcap.export"
+	SessionSave   = "session.save"
+	SessionLoad   = "session.load"
+	SessionDelete = "session.delete"
+	StreamView    = "stream.view"
+	StreamExport  = "stream.export"
+	ReplayStart   = "replay.start"
+	TLSKeysLoad   = "tls.keys.load"
+	TLSKeysClear  = "tls.keys.clear"
+)
+
+// Entry is one audited action.
+type Entry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user,omitempty"` // from the client certificate
+	Remote string    `json:"remote"`         // client address
+	Action string    `json:"action"`
+	Target string    `json:"target,omitempty"` // interface, session or stream ID, ...
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Query selects entries; zero fields match everything.
+type Query struct {
+	User   string
+	Action string
+	Since  time.Time
+	Limit  int
+}
+
+// Log records entries to a file, one JSON object per line, and keeps the
+// most recent in memory. It is safe for concurrent use.
+type Log struct {
+	mu     sync.Mutex
+	f      *os.File // nil: memory only
+	recent []Entry
+}
+
+// New creates a log kept only in memory.
+func New() *Log {
+	return &Log{}
+}
+
+// Open creates a log appending to path. The entries already in the file
+// are read back so queries cover them too.
+func Open(path string) (*Log, error) {
+	l := &Log{}
+	if f, err := os.Open(path); err == nil {
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 64<<10), 1<<20)
+		for sc.Scan() {
+			var e Entry
+			if json.Unmarshal(sc.Bytes(), &e) == nil {
+				l.keep(e)
+			}
+		}
+		f.Close()
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l.f = f
+	return l, nil
+}
+
+// Record appends e, timestamped now unless it has a time.
+func (l *Log) Record(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.keep(e)
+	if l.f == nil {
+		return
+	}
+	line, _ := json.Marshal(e)
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		log.Printf("Audit log: %v", err)
+	}
+}
+
+func (l *Log) keep(e Entry) {
+	if len(l.recent) >= maxRecent {
+		l.recent = append(l.recent[:0], l.recent[len(l.recent)-maxRecent/2:]...)
+	}
+	l.recent = append(l.recent, e)
+}
+
+// Entries returns the entries q selects, newest first.
+func (l *Log) Entries(q Query) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := []Entry{}
+	for i := len(l.recent) - 1; i >= 0; i-- {
+		e := l.recent[i]
+		if (q.User != "" && e.User != q.User) || (q.Action != "" && e.Action != q.Action) ||
+			(!q.Since.IsZero() && e.Time.Before(q.Since)) {
+			continue
+		}
+		out = append(out, e)
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+// Package bench measures the packet pipeline offline: it replays the
+// built-in synthetic workload or a capture file through the engine and
+// checks that the workload came out as expected.
+package bench
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/capture"
+	"sniffox/internal/engine"
+)
+
+// ReadFile loads every packet of a pcap or pcapng file into memory, so
+// that reading the file is not part of what is measured.
+func ReadFile(path string) ([]engine.BenchFrame, layers.LinkType, error) {
+	reader, err := capture.NewPcapReader(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer reader.Close()
+
+	var frames []engine.BenchFrame
+	for pkt := range reader.Packets().Packets() {
+		frames = append(frames, engine.BenchFrame{Data: pkt.Data(), Info: pkt.Metadata().CaptureInfo})
+	}
+	if len(frames) == 0 {
+		return nil, 0, fmt.Errorf("%s: no packets", path)
+	}
+	return frames, reader.LinkType(), nil
+}
+
+// SelfTest checks a run of the Synthetic workload: every packet was
+// processed and the parser, flow tracker and stream reassembly found what
+// the workload contains. It returns one line per failed check.
+func SelfTest(res *engine.BenchResult, frames int) []string {
+	var failed []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			failed = append(failed, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(res.Processed == frames, "processed %d of %d packets", res.Processed, frames)
+	for _, proto := range []string{"HTTP", "DNS", "TCP", "UDP", "ICMP", "ARP"} {
+		_, ok := res.Protocols[proto]
+		check(ok, "no %s packets recognized", proto)
+	}
+	// At least a flow each for the HTTP and TLS connections, the DNS
+	// exchange, the echo and the datagram of every conversation
+	check(res.Flows >= 5*conversations, "%d flows, want at least %d", res.Flows, 5*conversations)
+	// Both TCP connections and the DNS and unknown UDP conversations
+	check(res.Streams == 4*conversations, "%d streams, want %d", res.Streams, 4*conversations)
+	check(len(res.SNIs) == conversations && !slices.ContainsFunc(res.SNIs, func(s string) bool { return s != workloadSNI }),
+		"%d flows with SNI %s, want %d", len(res.SNIs), workloadSNI, conversations)
+	return failed
+}
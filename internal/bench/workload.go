@@ -0,0 +1,204 @@
+package bench
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/engine"
+)
+
+// Built-in workload shape: every conversation is one of each kind below.
+const (
+	conversations = 200
+	workloadSNI   = "bench.sniffox.test"
+	workloadHost  = "bench.sniffox.test"
+)
+
+var workloadStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// workload builds the synthetic traffic Synthetic returns.
+type workload struct {
+	frames []engine.BenchFrame
+	ts     time.Time
+}
+
+// Synthetic returns the built-in workload: per conversation an HTTP/1.1
+// exchange and a TLS ClientHello over full TCP handshakes, a DNS query and
+// response, an ICMP echo, an ARP request and reply, and an unknown UDP
+// datagram. It is the same on every call.
+func Synthetic() ([]engine.BenchFrame, layers.LinkType) {
+	w := &workload{ts: workloadStart}
+	for i := 0; i < conversations; i++ {
+		client := net.IPv4(10, 1, byte(i/250), byte(1+i%250)).To4()
+		server := net.IPv4(192, 0, 2, byte(1+i%20)).To4()
+		port := layers.TCPPort(40000 + i)
+
+		body := fmt.Sprintf("<html><body>conversation %d</body></html>", i)
+		w.tcpSession(client, server, port, 80,
+			[]byte(fmt.Sprintf("GET /item/%d HTTP/1.1\r\nHost: %s\r\nUser-Agent: sniffox-bench\r\n\r\n", i, workloadHost)),
+			[]byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: %d\r\n\r\n%s", len(body), body)))
+		w.tcpSession(client, server, port+10000, 443, clientHello(workloadSNI), nil)
+		w.dns(client, net.IPv4(192, 0, 2, 53).To4(), uint16(i), fmt.Sprintf("host%d.%s", i, workloadHost))
+		w.icmpEcho(client, server, uint16(i))
+		w.arp(client, server)
+		w.udp(client, server, layers.UDPPort(50000+i), 9999, []byte("bench datagram"))
+	}
+	return w.frames, layers.LinkTypeEthernet
+}
+
+func (w *workload) add(ls ...gopacket.SerializableLayer) {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ls...); err != nil {
+		panic(err) // the workload is fixed; this is a bug
+	}
+	data := append([]byte(nil), buf.Bytes()...)
+	w.ts = w.ts.Add(100 * time.Microsecond)
+	w.frames = append(w.frames, engine.BenchFrame{
+		Data: data,
+		Info: gopacket.CaptureInfo{Timestamp: w.ts, CaptureLength: len(data), Length: len(data)},
+	})
+}
+
+func eth(src, dst net.IP, t layers.EthernetType) *layers.Ethernet {
+	return &layers.Ethernet{SrcMAC: mac(src), DstMAC: mac(dst), EthernetType: t}
+}
+
+// mac derives a locally administered MAC address from an IPv4 address.
+func mac(ip net.IP) net.HardwareAddr {
+	return net.HardwareAddr{0x02, 0x00, ip[0], ip[1], ip[2], ip[3]}
+}
+
+func ip4(src, dst net.IP, proto layers.IPProtocol) *layers.IPv4 {
+	return &layers.IPv4{Version: 4, TTL: 64, Protocol: proto, SrcIP: src, DstIP: dst, Flags: layers.IPv4DontFragment}
+}
+
+// tcpSession writes a handshake, the request and optional response, and
+// a FIN exchange.
+func (w *workload) tcpSession(client, server net.IP, cport, sport layers.TCPPort, req, resp []byte) {
+	cseq, sseq := uint32(1000), uint32(5000)
+	seg := func(fromClient bool, flags string, payload []byte) {
+		src, dst, sp, dp, seq, ack := client, server, cport, sport, cseq, sseq
+		if !fromClient {
+			src, dst, sp, dp, seq, ack = server, client, sport, cport, sseq, cseq
+		}
+		ip := ip4(src, dst, layers.IPProtocolTCP)
+		tcp := &layers.TCP{SrcPort: sp, DstPort: dp, Seq: seq, Window: 64240}
+		for _, f := range flags {
+			switch f {
+			case 'S':
+				tcp.SYN = true
+			case 'A':
+				tcp.ACK, tcp.Ack = true, ack
+			case 'P':
+				tcp.PSH = true
+			case 'F':
+				tcp.FIN = true
+			}
+		}
+		tcp.SetNetworkLayerForChecksum(ip)
+		w.add(eth(src, dst, layers.EthernetTypeIPv4), ip, tcp, gopacket.Payload(payload))
+
+		n := uint32(len(payload))
+		if tcp.SYN || tcp.FIN {
+			n++
+		}
+		if fromClient {
+			cseq += n
+		} else {
+			sseq += n
+		}
+	}
+
+	seg(true, "S", nil)
+	seg(false, "SA", nil)
+	seg(true, "A", nil)
+	seg(true, "PA", req)
+	if resp != nil {
+		seg(false, "PA", resp)
+	}
+	seg(true, "A", nil)
+	seg(true, "FA", nil)
+	seg(false, "FA", nil)
+	seg(true, "A", nil)
+}
+
+func (w *workload) dns(client, server net.IP, id uint16, name string) {
+	q := layers.DNSQuestion{Name: []byte(name), Type: layers.DNSTypeA, Class: layers.DNSClassIN}
+	query := &layers.DNS{ID: id, RD: true, Questions: []layers.DNSQuestion{q}}
+	answer := &layers.DNS{
+		ID: id, QR: true, RD: true, RA: true,
+		Questions: []layers.DNSQuestion{q},
+		Answers: []layers.DNSResourceRecord{{
+			Name: []byte(name), Type: layers.DNSTypeA, Class: layers.DNSClassIN,
+			TTL: 300, IP: net.IPv4(198, 51, 100, byte(id)).To4(),
+		}},
+	}
+	sport := layers.UDPPort(30000 + id%30000)
+	w.udpLayers(client, server, sport, 53, query)
+	w.udpLayers(server, client, 53, sport, answer)
+}
+
+func (w *workload) udp(src, dst net.IP, sport, dport layers.UDPPort, payload []byte) {
+	w.udpLayers(src, dst, sport, dport, gopacket.Payload(payload))
+}
+
+func (w *workload) udpLayers(src, dst net.IP, sport, dport layers.UDPPort, payload gopacket.SerializableLayer) {
+	ip := ip4(src, dst, layers.IPProtocolUDP)
+	udp := &layers.UDP{SrcPort: sport, DstPort: dport}
+	udp.SetNetworkLayerForChecksum(ip)
+	w.add(eth(src, dst, layers.EthernetTypeIPv4), ip, udp, payload)
+}
+
+func (w *workload) icmpEcho(client, server net.IP, seq uint16) {
+	payload := gopacket.Payload("sniffox-bench-ping")
+	w.add(eth(client, server, layers.EthernetTypeIPv4), ip4(client, server, layers.IPProtocolICMPv4),
+		&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0), Id: 1, Seq: seq}, payload)
+	w.add(eth(server, client, layers.EthernetTypeIPv4), ip4(server, client, layers.IPProtocolICMPv4),
+		&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoReply, 0), Id: 1, Seq: seq}, payload)
+}
+
+func (w *workload) arp(asker, target net.IP) {
+	broadcast := &layers.Ethernet{SrcMAC: mac(asker), DstMAC: layers.EthernetBroadcast, EthernetType: layers.EthernetTypeARP}
+	w.add(broadcast, &layers.ARP{
+		AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4,
+		HwAddressSize: 6, ProtAddressSize: 4, Operation: layers.ARPRequest,
+		SourceHwAddress: mac(asker), SourceProtAddress: asker,
+		DstHwAddress: make([]byte, 6), DstProtAddress: target,
+	})
+	w.add(eth(target, asker, layers.EthernetTypeARP), &layers.ARP{
+		AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4,
+		HwAddressSize: 6, ProtAddressSize: 4, Operation: layers.ARPReply,
+		SourceHwAddress: mac(target), SourceProtAddress: target,
+		DstHwAddress: mac(asker), DstProtAddress: asker,
+	})
+}
+
+// clientHello builds a TLS 1.2 record holding a ClientHello with an SNI.
+func clientHello(sni string) []byte {
+	ext := []byte{0, 0} // server_name
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(sni)+5))
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(sni)+3))
+	ext = append(ext, 0) // host_name
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(sni)))
+	ext = append(ext, sni...)
+
+	body := []byte{3, 3}
+	body = append(body, make([]byte, 32)...) // random
+	body = append(body, 0)                   // no session ID
+	body = append(body, 0, 4, 0xc0, 0x2f, 0x13, 0x01)
+	body = append(body, 1, 0) // null compression
+	body = binary.BigEndian.AppendUint16(body, uint16(len(ext)))
+	body = append(body, ext...)
+
+	hs := []byte{1, 0, byte(len(body) >> 8), byte(len(body))}
+	hs = append(hs, body...)
+	rec := []byte{0x16, 3, 1}
+	rec = binary.BigEndian.AppendUint16(rec, uint16(len(hs)))
+	return append(rec, hs...)
+}
@@ -0,0 +1,214 @@
+//go:build linux
+
+package capture
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/afpacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/net/bpf"
+)
+
+const afpacketSupported = true
+
+const (
+	// afpacketBlockSize is the TPACKETv3 block size; a block must hold
+	// the largest frame, and the kernel hands blocks over whole.
+	afpacketBlockSize = 1 << 20
+	// afpacketBlocks sizes each socket's ring at 32 MiB, which absorbs
+	// bursts while the reader is busy.
+	afpacketBlocks = 32
+	// maxFanout caps the sockets opened per interface.
+	maxFanout = 16
+)
+
+// afpacketHandle reads an interface through one or more AF_PACKET sockets
+// with memory-mapped TPACKETv3 rings. Several sockets join a fanout group
+// that hashes packets by flow, so each flow stays in order on one socket
+// while the sockets are drained in parallel.
+type afpacketHandle struct {
+	socks   []*afpacket.TPacket
+	snapLen int
+
+	// mu is held for reading while a ring is read; Close takes it for
+	// writing so no read is in progress when the rings are unmapped.
+	mu     sync.RWMutex
+	closed bool
+
+	// With several sockets, readers copy packets into pkts
+	pkts chan afpacketPacket
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type afpacketPacket struct {
+	data []byte
+	ci   gopacket.CaptureInfo
+	err  error
+}
+
+func openAFPacket(iface string, opts Options) (handle, error) {
+	ifc, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, fmt.Errorf("open live capture on %s: %w", iface, err)
+	}
+	// Raw sockets deliver the device's own link header; only Ethernet and
+	// loopback devices use Ethernet framing
+	if len(ifc.HardwareAddr) != 6 && ifc.Flags&net.FlagLoopback == 0 {
+		return nil, fmt.Errorf("the afpacket backend needs an Ethernet interface; capture %s with pcap", iface)
+	}
+	var filter []bpf.RawInstruction
+	if opts.BPFFilter != "" {
+		insns, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, opts.SnapLen, opts.BPFFilter)
+		if err != nil {
+			return nil, fmt.Errorf("set BPF filter %q: %w", opts.BPFFilter, err)
+		}
+		for _, in := range insns {
+			filter = append(filter, bpf.RawInstruction{Op: in.Code, Jt: in.Jt, Jf: in.Jf, K: in.K})
+		}
+	}
+
+	n := min(max(opts.Fanout, 1), maxFanout)
+	h := &afpacketHandle{snapLen: opts.SnapLen, done: make(chan struct{})}
+	// The fanout group is per process and interface
+	group := uint16(os.Getpid()*31 + ifc.Index)
+	for i := 0; i < n; i++ {
+		s, err := afpacket.NewTPacket(
+			afpacket.OptInterface(iface),
+			afpacket.OptBlockSize(afpacketBlockSize),
+			afpacket.OptNumBlocks(afpacketBlocks),
+			afpacket.OptPollTimeout(DefaultTimeout),
+			afpacket.TPacketVersion3,
+		)
+		if err == nil && filter != nil {
+			err = s.SetBPF(filter)
+		}
+		if err == nil && n > 1 {
+			err = s.SetFanout(afpacket.FanoutHashWithDefrag, group)
+		}
+		if err != nil {
+			if s != nil {
+				s.Close()
+			}
+			h.closeSockets()
+			return nil, fmt.Errorf("open live capture on %s: %w", iface, err)
+		}
+		h.socks = append(h.socks, s)
+	}
+
+	if n > 1 {
+		h.pkts = make(chan afpacketPacket, 4096)
+		for _, s := range h.socks {
+			h.wg.Add(1)
+			go h.drain(s)
+		}
+	}
+	return h, nil
+}
+
+// ReadPacketData implements gopacket.PacketDataSource. It returns io.EOF
+// once the handle is closed.
+func (h *afpacketHandle) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	if h.pkts == nil {
+		return h.read(h.socks[0])
+	}
+	select {
+	case p := <-h.pkts:
+		return p.data, p.ci, p.err
+	case <-h.done:
+		return nil, gopacket.CaptureInfo{}, io.EOF
+	}
+}
+
+// read copies the next packet out of s's ring, cut to the snap length,
+// waiting through poll timeouts until the handle is closed.
+func (h *afpacketHandle) read(s *afpacket.TPacket) ([]byte, gopacket.CaptureInfo, error) {
+	for {
+		h.mu.RLock()
+		if h.closed {
+			h.mu.RUnlock()
+			return nil, gopacket.CaptureInfo{}, io.EOF
+		}
+		data, ci, err := s.ZeroCopyReadPacketData()
+		if err == nil {
+			if len(data) > h.snapLen {
+				data = data[:h.snapLen]
+			}
+			ci.CaptureLength = len(data)
+			data = append([]byte(nil), data...)
+		}
+		h.mu.RUnlock()
+		if err == afpacket.ErrTimeout {
+			continue
+		}
+		return data, ci, err
+	}
+}
+
+// drain feeds the packets of one fanout socket to pkts.
+func (h *afpacketHandle) drain(s *afpacket.TPacket) {
+	defer h.wg.Done()
+	for {
+		data, ci, err := h.read(s)
+		if err == io.EOF {
+			return
+		}
+		select {
+		case h.pkts <- afpacketPacket{data, ci, err}:
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// LinkType implements handle.
+func (h *afpacketHandle) LinkType() layers.LinkType {
+	return layers.LinkTypeEthernet
+}
+
+// Stats implements handle. The kernel counts dropped packets as received,
+// as libpcap does on Linux.
+func (h *afpacketHandle) Stats() (Stats, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var st Stats
+	if h.closed {
+		return st, fmt.Errorf("capture closed")
+	}
+	for _, s := range h.socks {
+		_, v3, err := s.SocketStats()
+		if err != nil {
+			return Stats{}, err
+		}
+		st.Received += int(v3.Packets())
+		st.Dropped += int(v3.Drops())
+	}
+	return st, nil
+}
+
+// Close implements handle.
+func (h *afpacketHandle) Close() {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	close(h.done)
+	h.mu.Unlock()
+	h.wg.Wait()
+	h.closeSockets()
+}
+
+func (h *afpacketHandle) closeSockets() {
+	for _, s := range h.socks {
+		s.Close()
+	}
+}
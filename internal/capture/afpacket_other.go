@@ -0,0 +1,11 @@
+//go:build !linux
+
+package capture
+
+import "fmt"
+
+const afpacketSupported = false
+
+func openAFPacket(iface string, opts Options) (handle, error) {
+	return nil, fmt.Errorf("the afpacket capture backend is only available on Linux")
+}
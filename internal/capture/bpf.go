@@ -0,0 +1,28 @@
+package capture
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// Matcher tests packets that were already captured against a BPF filter.
+type Matcher struct {
+	bpf *pcap.BPF
+}
+
+// NewMatcher compiles a tcpdump-syntax filter for packets of link type lt.
+func NewMatcher(lt layers.LinkType, expr string) (*Matcher, error) {
+	bpf, err := pcap.NewBPF(lt, 65535, expr)
+	if err != nil {
+		return nil, fmt.Errorf("BPF filter %q: %w", expr, err)
+	}
+	return &Matcher{bpf: bpf}, nil
+}
+
+// Matches reports whether the filter accepts the packet.
+func (m *Matcher) Matches(ci gopacket.CaptureInfo, data []byte) bool {
+	return m.bpf.Matches(ci, data)
+}
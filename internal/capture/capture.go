@@ -14,9 +14,34 @@ const (
 	DefaultTimeout = 100 * time.Millisecond
 )
 
+// Capture backends.
+const (
+	BackendPcap     = "pcap"     // libpcap/Npcap, the default
+	BackendAFPacket = "afpacket" // Linux AF_PACKET TPACKETv3 rings
+)
+
+// Options selects how a live capture reads packets.
+type Options struct {
+	BPFFilter string
+	SnapLen   int
+	Backend   string // BackendPcap when empty
+	// Fanout is the number of AF_PACKET sockets that split the
+	// interface's traffic by flow, each read by its own goroutine. Zero
+	// or one opens a single socket.
+	Fanout int
+}
+
+// handle is the packet source behind a live capture.
+type handle interface {
+	gopacket.PacketDataSource
+	LinkType() layers.LinkType
+	Stats() (Stats, error)
+	Close()
+}
+
 // LiveCapture manages a live packet capture session.
 type LiveCapture struct {
-	handle *pcap.Handle
+	handle handle
 	iface  string
 }
 
@@ -48,26 +73,79 @@ func ListInterfaces() ([]InterfaceInfo, error) {
 }
 
 // NewLiveCapture opens a live capture on the given interface.
-func NewLiveCapture(iface, bpfFilter string, snapLen int) (*LiveCapture, error) {
-	if snapLen <= 0 {
-		snapLen = DefaultSnapLen
+func NewLiveCapture(iface string, opts Options) (*LiveCapture, error) {
+	if opts.SnapLen <= 0 {
+		opts.SnapLen = DefaultSnapLen
+	}
+	if err := CheckBackend(opts.Backend); err != nil {
+		return nil, err
+	}
+	var h handle
+	var err error
+	if opts.Backend == BackendAFPacket {
+		h, err = openAFPacket(iface, opts)
+	} else {
+		h, err = openPcap(iface, opts)
 	}
-	handle, err := pcap.OpenLive(iface, int32(snapLen), true, DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &LiveCapture{handle: h, iface: iface}, nil
+}
+
+// CheckBackend reports whether backend names a capture backend available
+// on this platform.
+func CheckBackend(backend string) error {
+	switch backend {
+	case "", BackendPcap:
+		return nil
+	case BackendAFPacket:
+		if !afpacketSupported {
+			return fmt.Errorf("the %s capture backend is only available on Linux", backend)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown capture backend %q (pcap or afpacket)", backend)
+}
+
+// pcapHandle adapts a libpcap handle.
+type pcapHandle struct {
+	*pcap.Handle
+}
+
+func openPcap(iface string, opts Options) (handle, error) {
+	h, err := pcap.OpenLive(iface, int32(opts.SnapLen), true, DefaultTimeout)
 	if err != nil {
 		return nil, fmt.Errorf("open live capture on %s: %w", iface, err)
 	}
-	if bpfFilter != "" {
-		if err := handle.SetBPFFilter(bpfFilter); err != nil {
-			handle.Close()
-			return nil, fmt.Errorf("set BPF filter %q: %w", bpfFilter, err)
+	if opts.BPFFilter != "" {
+		if err := h.SetBPFFilter(opts.BPFFilter); err != nil {
+			h.Close()
+			return nil, fmt.Errorf("set BPF filter %q: %w", opts.BPFFilter, err)
 		}
 	}
-	return &LiveCapture{handle: handle, iface: iface}, nil
+	return pcapHandle{h}, nil
+}
+
+func (h pcapHandle) Stats() (Stats, error) {
+	stats, err := h.Handle.Stats()
+	if err != nil {
+		return Stats{}, err
+	}
+	return Stats{
+		Received:  stats.PacketsReceived,
+		Dropped:   stats.PacketsDropped,
+		IfDropped: stats.PacketsIfDropped,
+	}, nil
 }
 
-// Packets returns a gopacket.PacketSource to iterate packets.
+// Packets returns a gopacket.PacketSource to iterate packets. Every
+// backend hands out a fresh buffer per packet, so decoding does not copy
+// it again.
 func (lc *LiveCapture) Packets() *gopacket.PacketSource {
-	return gopacket.NewPacketSource(lc.handle, lc.handle.LinkType())
+	src := gopacket.NewPacketSource(lc.handle, lc.handle.LinkType())
+	src.DecodeOptions.NoCopy = true
+	return src
 }
 
 // Interface returns the interface name.
@@ -80,13 +158,16 @@ func (lc *LiveCapture) LinkType() layers.LinkType {
 	return lc.handle.LinkType()
 }
 
+// Stats are the packet counters of a capture handle since it was opened.
+type Stats struct {
+	Received  int `json:"received"`  // packets that passed the filter
+	Dropped   int `json:"dropped"`   // dropped for lack of buffer space
+	IfDropped int `json:"ifDropped"` // dropped by the interface or its driver
+}
+
 // Stats returns capture statistics.
-func (lc *LiveCapture) Stats() (received, dropped int, err error) {
-	stats, err := lc.handle.Stats()
-	if err != nil {
-		return 0, 0, err
-	}
-	return stats.PacketsReceived, stats.PacketsDropped, nil
+func (lc *LiveCapture) Stats() (Stats, error) {
+	return lc.handle.Stats()
 }
 
 // Close stops the capture.
@@ -95,3 +176,33 @@ func (lc *LiveCapture) Close() {
 		lc.handle.Close()
 	}
 }
+
+// ResolveInterfaces expands "any" to every interface that has an address
+// and drops duplicate names.
+func ResolveInterfaces(names []string) ([]string, error) {
+	var out []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if name != "any" {
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+			continue
+		}
+		devs, err := ListInterfaces()
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range devs {
+			if d.Name != "any" && len(d.Addresses) > 0 && !seen[d.Name] {
+				seen[d.Name] = true
+				out = append(out, d.Name)
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no capture interface selected")
+	}
+	return out, nil
+}
@@ -0,0 +1,45 @@
+package capture
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// Injector transmits raw frames on an interface.
+type Injector struct {
+	handle *pcap.Handle
+	iface  string
+}
+
+// NewInjector opens iface for sending. Frames must match its link type.
+func NewInjector(iface string) (*Injector, error) {
+	handle, err := pcap.OpenLive(iface, DefaultSnapLen, false, DefaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("open %s for injection: %w", iface, err)
+	}
+	return &Injector{handle: handle, iface: iface}, nil
+}
+
+// Write transmits one frame, which must include the link-layer header.
+func (in *Injector) Write(data []byte) error {
+	return in.handle.WritePacketData(data)
+}
+
+// Interface returns the interface name.
+func (in *Injector) Interface() string {
+	return in.iface
+}
+
+// LinkType returns the link layer type frames must have.
+func (in *Injector) LinkType() layers.LinkType {
+	return in.handle.LinkType()
+}
+
+// Close releases the handle.
+func (in *Injector) Close() {
+	if in.handle != nil {
+		in.handle.Close()
+	}
+}
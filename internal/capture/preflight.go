@@ -0,0 +1,146 @@
+package capture
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// Preflight problem codes.
+const (
+	ProblemPcapUnavailable   = "pcap_unavailable"    // libpcap/Npcap missing or unusable
+	ProblemNoInterface       = "no_interface"        // nothing selected, or "any" matched nothing
+	ProblemInterfaceNotFound = "interface_not_found" // not among the capture devices
+	ProblemInterfaceDown     = "interface_down"
+	ProblemPermissionDenied  = "permission_denied"
+	ProblemOpenFailed        = "open_failed" // any other error opening the interface
+	ProblemBadFilter         = "bpf_invalid"
+	ProblemBadBackend        = "backend_unavailable"
+)
+
+// Problem is one reason a capture would fail to start.
+type Problem struct {
+	Code      string `json:"code"`
+	Interface string `json:"interface,omitempty"`
+	Message   string `json:"message"`
+	Hint      string `json:"hint,omitempty"` // what to do about it
+}
+
+// Preflight checks that a capture on names with bpfFilter could start: the
+// interfaces exist and are up, this process may open them, and the filter
+// compiles for their link type. Each interface is opened and closed again.
+func Preflight(names []string, bpfFilter string, snapLen int) (resolved []string, problems []Problem) {
+	if snapLen <= 0 {
+		snapLen = DefaultSnapLen
+	}
+	devs, err := ListInterfaces()
+	if err != nil {
+		return nil, []Problem{{
+			Code:    ProblemPcapUnavailable,
+			Message: err.Error(),
+			Hint:    pcapHint(),
+		}}
+	}
+	resolved, err = ResolveInterfaces(names)
+	if err != nil {
+		return nil, []Problem{{
+			Code:    ProblemNoInterface,
+			Message: err.Error(),
+			Hint:    "Select an interface from the interface list, or \"any\" for every interface with an address.",
+		}}
+	}
+	known := make(map[string]bool, len(devs))
+	for _, d := range devs {
+		known[d.Name] = true
+	}
+
+	filterChecked := false
+	for _, name := range resolved {
+		if !known[name] {
+			problems = append(problems, Problem{
+				Code:      ProblemInterfaceNotFound,
+				Interface: name,
+				Message:   fmt.Sprintf("no capture interface named %s", name),
+				Hint:      "Pick one of the interfaces listed by get_interfaces.",
+			})
+			continue
+		}
+		// Windows device names are not OS interface names; skip them
+		if ifc, err := net.InterfaceByName(name); err == nil && ifc.Flags&net.FlagUp == 0 {
+			problems = append(problems, Problem{
+				Code:      ProblemInterfaceDown,
+				Interface: name,
+				Message:   fmt.Sprintf("%s is down", name),
+				Hint:      fmt.Sprintf("Bring it up first, e.g. `ip link set %s up`.", name),
+			})
+			continue
+		}
+
+		handle, err := pcap.OpenLive(name, int32(snapLen), true, DefaultTimeout)
+		if err != nil {
+			problems = append(problems, openProblem(name, err))
+			continue
+		}
+		if bpfFilter != "" {
+			if _, err := handle.CompileBPFFilter(bpfFilter); err != nil {
+				problems = append(problems, filterProblem(name, bpfFilter, err))
+			}
+			filterChecked = true
+		}
+		handle.Close()
+	}
+
+	// Without an interface to compile against, Ethernet is the best guess
+	if bpfFilter != "" && !filterChecked {
+		if _, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, snapLen, bpfFilter); err != nil {
+			problems = append(problems, filterProblem("", bpfFilter, err))
+		}
+	}
+	return resolved, problems
+}
+
+func openProblem(name string, err error) Problem {
+	msg := err.Error()
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(lower, "permission") || strings.Contains(lower, "not permitted"):
+		return Problem{Code: ProblemPermissionDenied, Interface: name, Message: msg, Hint: permissionHint()}
+	case strings.Contains(lower, "not up") || strings.Contains(lower, "network is down"):
+		return Problem{Code: ProblemInterfaceDown, Interface: name, Message: msg, Hint: fmt.Sprintf("Bring %s up first.", name)}
+	case strings.Contains(lower, "no such device") || strings.Contains(lower, "doesn't exist"):
+		return Problem{Code: ProblemInterfaceNotFound, Interface: name, Message: msg, Hint: "Pick one of the interfaces listed by get_interfaces."}
+	}
+	return Problem{Code: ProblemOpenFailed, Interface: name, Message: msg}
+}
+
+func filterProblem(name, expr string, err error) Problem {
+	return Problem{
+		Code:      ProblemBadFilter,
+		Interface: name,
+		Message:   fmt.Sprintf("BPF filter %q: %v", expr, err),
+		Hint:      "Capture filters use tcpdump syntax, e.g. `tcp port 443 and host 10.0.0.1`; display-filter syntax such as `tcp.port == 443` is not accepted.",
+	}
+}
+
+func permissionHint() string {
+	switch runtime.GOOS {
+	case "linux":
+		return "Run sniffox as root, or grant the binary capture rights with `sudo setcap cap_net_raw,cap_net_admin=eip <path to sniffox>`."
+	case "darwin":
+		return "Run sniffox with sudo, or give your user read access to /dev/bpf* (Wireshark's ChmodBPF does this)."
+	case "windows":
+		return "Install Npcap; if it was installed with \"Restrict Npcap driver's access to Administrators only\", run sniffox as Administrator."
+	}
+	return "Run sniffox with the privileges needed to capture packets."
+}
+
+func pcapHint() string {
+	if runtime.GOOS == "windows" {
+		return "Install Npcap from https://npcap.com (with WinPcap API-compatible mode) and restart sniffox."
+	}
+	return "Install libpcap (e.g. `apt install libpcap0.8` or `dnf install libpcap`) and check that sniffox can load it."
+}
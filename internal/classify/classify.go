@@ -0,0 +1,183 @@
+// Package classify labels flows whose application protocol the parser
+// could not identify, using statistical features of their packets —
+// payload sizes, direction balance and timing — matched against a small
+// built-in set of traffic profiles.
+package classify
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	minPackets = 6     // payload-carrying packets needed before guessing
+	maxFlows   = 20000 // tracked flows; the table is cleared when full
+)
+
+// transportOnly are the parser protocol names that say nothing about the
+// application.
+var transportOnly = map[string]bool{
+	"TCP": true, "UDP": true, "SCTP": true, "ICMP": true, "ICMPv6": true,
+	"IPv4": true, "IPv6": true, "GRE": true, "VLAN": true, "Unknown": true,
+}
+
+// profile is the centroid of one traffic class in feature space.
+type profile struct {
+	label    string
+	features [numFeatures]float64
+}
+
+const (
+	fMeanSize   = iota // ln(mean payload bytes)
+	fSizeCV            // payload size stddev / mean
+	fIAT               // log10(mean inter-arrival ms)
+	fAsymmetry         // |fwd - rev| / total bytes
+	fSmallRatio        // share of payloads < 128 bytes
+	fLargeRatio        // share of payloads > 1000 bytes
+	numFeatures
+)
+
+// scale normalizes each feature's spread so no single one dominates the
+// distance.
+var scale = [numFeatures]float64{1.2, 0.5, 1.0, 0.3, 0.3, 0.3}
+
+var profiles = []profile{
+	{"Interactive Shell", [numFeatures]float64{4.0, 0.8, 2.3, 0.2, 0.9, 0.0}},
+	{"Bulk Transfer", [numFeatures]float64{7.1, 0.3, 0.0, 0.95, 0.05, 0.9}},
+	{"Video Streaming", [numFeatures]float64{7.0, 0.4, 0.9, 0.9, 0.1, 0.75}},
+	{"Web Browsing", [numFeatures]float64{6.3, 1.2, 1.4, 0.7, 0.35, 0.35}},
+	{"Real-time Media", [numFeatures]float64{5.1, 0.1, 1.3, 0.1, 0.15, 0.0}},
+	{"Request/Response", [numFeatures]float64{4.6, 0.5, 1.0, 0.3, 0.8, 0.0}},
+	{"Periodic Beacon", [numFeatures]float64{4.2, 0.1, 4.0, 0.3, 0.95, 0.0}},
+}
+
+// Result is the classification of one flow.
+type Result struct {
+	Protocol   string  // application protocol identified by deep parsing
+	Guess      string  // statistical best guess when Protocol is empty
+	Confidence float64 // of the guess, 0..1
+}
+
+type flowStats struct {
+	fwdEndpoint string
+	app         string
+	n           int
+	sum, sumSq  float64
+	small       int
+	large       int
+	fwdBytes    int64
+	revBytes    int64
+	first, last time.Time
+}
+
+// Classifier accumulates per-flow features.
+type Classifier struct {
+	mu    sync.Mutex
+	flows map[uint64]*flowStats
+}
+
+// New creates an empty classifier.
+func New() *Classifier {
+	return &Classifier{flows: make(map[uint64]*flowStats)}
+}
+
+// Observe adds a packet to flow flowID. src identifies the sending
+// endpoint (ip:port); the first sender is taken as the flow's forward
+// direction. protocol is the parser's protocol name for the packet.
+func (c *Classifier) Observe(flowID uint64, src string, protocol string, payloadLen int, ts time.Time) {
+	if flowID == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, ok := c.flows[flowID]
+	if !ok {
+		if len(c.flows) >= maxFlows {
+			c.flows = make(map[uint64]*flowStats)
+		}
+		f = &flowStats{fwdEndpoint: src}
+		c.flows[flowID] = f
+	}
+	if !transportOnly[protocol] {
+		f.app = protocol
+	}
+	if payloadLen == 0 {
+		return
+	}
+
+	size := float64(payloadLen)
+	f.n++
+	f.sum += size
+	f.sumSq += size * size
+	if payloadLen < 128 {
+		f.small++
+	}
+	if payloadLen > 1000 {
+		f.large++
+	}
+	if src == f.fwdEndpoint {
+		f.fwdBytes += int64(payloadLen)
+	} else {
+		f.revBytes += int64(payloadLen)
+	}
+	if f.first.IsZero() {
+		f.first = ts
+	}
+	f.last = ts
+}
+
+// Classify returns what is known about flow flowID.
+func (c *Classifier) Classify(flowID uint64) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, ok := c.flows[flowID]
+	if !ok {
+		return Result{}
+	}
+	if f.app != "" {
+		return Result{Protocol: f.app}
+	}
+	if f.n < minPackets {
+		return Result{}
+	}
+
+	var x [numFeatures]float64
+	n := float64(f.n)
+	mean := f.sum / n
+	x[fMeanSize] = math.Log(mean)
+	x[fSizeCV] = math.Sqrt(math.Max(f.sumSq/n-mean*mean, 0)) / mean
+	iatMs := float64(f.last.Sub(f.first)) / float64(time.Millisecond) / (n - 1)
+	x[fIAT] = math.Log10(math.Max(iatMs, 0.1))
+	x[fAsymmetry] = math.Abs(float64(f.fwdBytes-f.revBytes)) / f.sum
+	x[fSmallRatio] = float64(f.small) / n
+	x[fLargeRatio] = float64(f.large) / n
+
+	best, second := math.Inf(1), math.Inf(1)
+	label := ""
+	for _, p := range profiles {
+		var d float64
+		for i := range x {
+			diff := (x[i] - p.features[i]) / scale[i]
+			d += diff * diff
+		}
+		d = math.Sqrt(d)
+		if d < best {
+			best, second, label = d, best, p.label
+		} else if d < second {
+			second = d
+		}
+	}
+	// Confidence falls as the runner-up profile gets as close as the best
+	conf := 1 - best/second
+	return Result{Guess: label, Confidence: math.Round(conf*100) / 100}
+}
+
+// Reset forgets all flows.
+func (c *Classifier) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flows = make(map[uint64]*flowStats)
+}
@@ -0,0 +1,166 @@
+// Package clientauth authenticates web clients by the TLS certificate
+// they present. Each certificate maps to a user and a role; admins can use
+// the whole API, viewers can only look.
+package clientauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Roles
+const (
+	RoleAdmin  = "admin"
+	RoleViewer = "viewer"
+)
+
+// User maps client certificates to a name and role. A certificate matches
+// if its SHA-256 fingerprint, its subject common name or one of its email
+// addresses equals the one given; a fingerprint pins one certificate, the
+// others follow reissues.
+type User struct {
+	Name        string `json:"name"`
+	Role        string `json:"role"`
+	Fingerprint string `json:"fingerprint,omitempty"` // hex, colons allowed
+	CommonName  string `json:"cn,omitempty"`
+	Email       string `json:"email,omitempty"`
+}
+
+// Identity is the user a request was authenticated as.
+type Identity struct {
+	Name string
+	Role string
+}
+
+// ReadOnly reports whether the identity may not change anything.
+func (id Identity) ReadOnly() bool {
+	return id.Role != RoleAdmin
+}
+
+type ctxKey struct{}
+
+// FromContext returns the identity of the request ctx belongs to, if
+// client certificates are in use.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(ctxKey{}).(Identity)
+	return id, ok
+}
+
+// validName keeps user names usable as the name of their preferences.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]{0,63}$`)
+
+// LoadUsers reads a JSON array of users.
+func LoadUsers(path string) ([]User, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var users []User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, u := range users {
+		if !validName.MatchString(u.Name) {
+			return nil, fmt.Errorf("%s: user %d: name %q must be 1-64 letters, digits, '.', '_' or '-'", path, i+1, u.Name)
+		}
+		if u.Role != RoleAdmin && u.Role != RoleViewer {
+			return nil, fmt.Errorf("%s: user %s: role must be %q or %q", path, u.Name, RoleAdmin, RoleViewer)
+		}
+		if u.Fingerprint == "" && u.CommonName == "" && u.Email == "" {
+			return nil, fmt.Errorf("%s: user %s: no fingerprint, cn or email to match", path, u.Name)
+		}
+		users[i].Fingerprint = normalizeFingerprint(u.Fingerprint)
+	}
+	return users, nil
+}
+
+func normalizeFingerprint(s string) string {
+	return strings.ToLower(strings.ReplaceAll(s, ":", ""))
+}
+
+// Authenticator maps verified client certificates to identities.
+type Authenticator struct {
+	users []User // nil: every verified certificate is an admin
+	// viewerPaths are the paths viewers may also send writes to: their own
+	// settings, not the server's
+	viewerPaths []string
+}
+
+// New creates an authenticator for users. Without users, any certificate
+// the CA signed is let in as an admin named by its common name.
+func New(users []User) *Authenticator {
+	return &Authenticator{users: users, viewerPaths: []string{"/api/prefs"}}
+}
+
+// Identify returns the identity cert maps to.
+func (a *Authenticator) Identify(cert *x509.Certificate) (Identity, bool) {
+	if a.users == nil {
+		return Identity{Name: cert.Subject.CommonName, Role: RoleAdmin}, true
+	}
+	sum := sha256.Sum256(cert.Raw)
+	fp := hex.EncodeToString(sum[:])
+	for _, u := range a.users {
+		if (u.Fingerprint != "" && u.Fingerprint == fp) ||
+			(u.CommonName != "" && u.CommonName == cert.Subject.CommonName) ||
+			(u.Email != "" && slices.Contains(cert.EmailAddresses, u.Email)) {
+			return Identity{Name: u.Name, Role: u.Role}, true
+		}
+	}
+	return Identity{}, false
+}
+
+// Middleware rejects requests without a mapped certificate and writes by
+// viewers, and passes the identity on in the request context.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "Client certificate required", http.StatusUnauthorized)
+			return
+		}
+		cert := r.TLS.PeerCertificates[0]
+		id, ok := a.Identify(cert)
+		if !ok {
+			log.Printf("Client certificate %q from %s is not mapped to a user", cert.Subject, r.RemoteAddr)
+			http.Error(w, "Certificate not authorized", http.StatusForbidden)
+			return
+		}
+		if id.ReadOnly() && !safeMethod(r.Method) && !slices.Contains(a.viewerPaths, r.URL.Path) {
+			http.Error(w, "Read-only user", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, id)))
+	})
+}
+
+func safeMethod(m string) bool {
+	return m == http.MethodGet || m == http.MethodHead || m == http.MethodOptions
+}
+
+// ServerConfig returns a TLS configuration that requires clients to
+// present a certificate signed by one of the CAs in caFile (PEM).
+func ServerConfig(caFile string) (*tls.Config, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no PEM certificates", caFile)
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+	}, nil
+}
@@ -0,0 +1,88 @@
+// Package coloring assigns packet list colors from an ordered list of
+// display filter rules, like Wireshark's coloring rules: the first enabled
+// rule whose filter matches a packet colors it.
+package coloring
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/filter"
+	"sniffox/internal/models"
+)
+
+// Rule is one coloring rule. Colors are CSS hex colors (#rrggbb).
+type Rule struct {
+	Name       string `json:"name"`
+	Filter     string `json:"filter"`
+	Foreground string `json:"foreground"`
+	Background string `json:"background"`
+	Disabled   bool   `json:"disabled,omitempty"`
+}
+
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Set is an ordered list of coloring rules, safe for concurrent use.
+type Set struct {
+	mu       sync.RWMutex
+	rules    []Rule
+	compiled []*filter.Filter // nil for disabled rules
+}
+
+// New creates an empty rule set; packets are left uncolored.
+func New() *Set {
+	return &Set{}
+}
+
+// SetRules replaces the rules. Nothing changes if any enabled rule's filter
+// or color is invalid.
+func (s *Set) SetRules(rules []Rule) error {
+	compiled := make([]*filter.Filter, len(rules))
+	for i, r := range rules {
+		if strings.TrimSpace(r.Name) == "" {
+			return fmt.Errorf("rule %d: missing name", i+1)
+		}
+		if !hexColor.MatchString(r.Foreground) || !hexColor.MatchString(r.Background) {
+			return fmt.Errorf("rule %q: colors must be #rrggbb", r.Name)
+		}
+		if r.Disabled {
+			continue
+		}
+		f, err := filter.Compile(r.Filter)
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		compiled[i] = f
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append([]Rule(nil), rules...)
+	s.compiled = compiled
+	return nil
+}
+
+// Rules returns a copy of the rules in order.
+func (s *Set) Rules() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Rule{}, s.rules...)
+}
+
+// Match returns the color of the first enabled rule matching the packet,
+// or nil.
+func (s *Set) Match(pkt gopacket.Packet, info *models.PacketInfo) *models.PacketColor {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i, f := range s.compiled {
+		if f != nil && f.Match(pkt, info) {
+			r := s.rules[i]
+			return &models.PacketColor{Rule: r.Name, Foreground: r.Foreground, Background: r.Background}
+		}
+	}
+	return nil
+}
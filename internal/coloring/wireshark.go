@@ -0,0 +1,208 @@
+package coloring
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sniffox/internal/filter"
+)
+
+// Import is the result of translating a Wireshark colorfilters file.
+type Import struct {
+	Rules    []Rule        `json:"rules"`
+	Skipped  []SkippedRule `json:"skipped"`
+	Warnings []string      `json:"warnings"`
+}
+
+// SkippedRule is a Wireshark rule whose filter could not be translated.
+type SkippedRule struct {
+	Name   string `json:"name"`
+	Filter string `json:"filter"`
+	Reason string `json:"reason"`
+}
+
+// wiresharkFields maps Wireshark fields tested for presence to the
+// equivalent expert info filters.
+var wiresharkFields = map[string]string{
+	"_ws.expert":                  `expert.message`,
+	"tcp.analysis.flags":          `expert.message contains "TCP"`,
+	"tcp.analysis.retransmission": `expert.message contains "TCP Retransmission"`,
+	"tcp.analysis.out_of_order":   `expert.message contains "TCP Out-Of-Order"`,
+	"tcp.analysis.lost_segment":   `expert.message contains "TCP Previous segment not captured"`,
+	"tcp.analysis.duplicate_ack":  `expert.message contains "TCP Dup ACK"`,
+	"tcp.analysis.zero_window":    `expert.message contains "TCP ZeroWindow"`,
+	"tcp.analysis.keep_alive":     `expert.message contains "TCP Keep-Alive"`,
+	"ip.checksum_bad":             `expert.message contains "Bad IPv4 header checksum"`,
+	"tcp.checksum_bad":            `expert.message contains "Bad TCP checksum"`,
+}
+
+// badChecksum matches Wireshark's checksum status tests, which Sniffox
+// reports as expert info.
+var badChecksum = regexp.MustCompile(`\b(ip|tcp)\.checksum\.status\s*(==|eq)\s*("Bad"|2)`)
+
+// ImportWireshark translates a Wireshark colorfilters file, whose lines
+// look like
+//
+//	@Bad TCP@tcp.analysis.flags && !tcp.analysis.window_update@[4626,10023,11822][63479,34695,34695]
+//
+// with a leading "!" for disabled rules. Rules whose filter does not
+// compile here are skipped; rules using fields that are only looked up in
+// the decoded layer details are kept with a warning, as those may never
+// match.
+func ImportWireshark(r io.Reader) (*Import, error) {
+	out := &Import{Rules: []Rule{}, Skipped: []SkippedRule{}, Warnings: []string{}}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		disabled := strings.HasPrefix(line, "!")
+		line = strings.TrimPrefix(line, "!")
+
+		name, expr, fg, bg, err := parseColorFilter(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		translated := translateFilter(expr)
+		f, err := filter.Compile(translated)
+		if err != nil {
+			out.Skipped = append(out.Skipped, SkippedRule{Name: name, Filter: expr, Reason: err.Error()})
+			continue
+		}
+		for _, g := range f.GenericFields() {
+			out.Warnings = append(out.Warnings, fmt.Sprintf("%s: %s is not a built-in field and may never match", name, g))
+		}
+		out.Rules = append(out.Rules, Rule{
+			Name:       name,
+			Filter:     translated,
+			Foreground: fg,
+			Background: bg,
+			Disabled:   disabled,
+		})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(out.Rules) == 0 && len(out.Skipped) == 0 {
+		return nil, fmt.Errorf("no coloring rules found")
+	}
+	return out, nil
+}
+
+// parseColorFilter splits "@name@filter@[r,g,b][r,g,b]".
+func parseColorFilter(line string) (name, expr, fg, bg string, err error) {
+	if !strings.HasPrefix(line, "@") {
+		return "", "", "", "", fmt.Errorf("expected @name@filter@[fg][bg]")
+	}
+	rest := line[1:]
+	i := strings.IndexByte(rest, '@')
+	j := strings.LastIndexByte(rest, '@')
+	if i < 0 || j <= i {
+		return "", "", "", "", fmt.Errorf("expected @name@filter@[fg][bg]")
+	}
+	name, expr, colors := rest[:i], strings.TrimSpace(rest[i+1:j]), rest[j+1:]
+
+	var rgb [2]string
+	for k := range rgb {
+		colors = strings.TrimSpace(colors)
+		end := strings.IndexByte(colors, ']')
+		if !strings.HasPrefix(colors, "[") || end < 0 {
+			return "", "", "", "", fmt.Errorf("rule %q: expected [r,g,b] colors", name)
+		}
+		if rgb[k], err = wiresharkColor(colors[1:end]); err != nil {
+			return "", "", "", "", fmt.Errorf("rule %q: %w", name, err)
+		}
+		colors = colors[end+1:]
+	}
+	return name, expr, rgb[0], rgb[1], nil
+}
+
+// wiresharkColor converts Wireshark's 16-bit "r,g,b" to #rrggbb.
+func wiresharkColor(s string) (string, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("bad color [%s]", s)
+	}
+	var c [3]uint64
+	for i, p := range parts {
+		v, err := strconv.ParseUint(strings.TrimSpace(p), 10, 16)
+		if err != nil {
+			return "", fmt.Errorf("bad color [%s]", s)
+		}
+		c[i] = v >> 8
+	}
+	return fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2]), nil
+}
+
+// translateFilter rewrites checksum status tests and Wireshark-only fields
+// tested for presence into their Sniffox equivalents. Quoted strings and
+// other comparisons are left alone.
+func translateFilter(expr string) string {
+	expr = badChecksum.ReplaceAllStringFunc(expr, func(m string) string {
+		if strings.HasPrefix(m, "ip") {
+			return `(expert.message contains "Bad IPv4 header checksum")`
+		}
+		return `(expert.message contains "Bad TCP checksum")`
+	})
+
+	var b strings.Builder
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == '"':
+			j := i + 1
+			for j < len(expr) && expr[j] != '"' {
+				if expr[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(expr))
+			b.WriteString(expr[i:j])
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(expr) && (expr[j] == '_' || expr[j] == '.' || expr[j] >= 'a' && expr[j] <= 'z' ||
+				expr[j] >= 'A' && expr[j] <= 'Z' || expr[j] >= '0' && expr[j] <= '9') {
+				j++
+			}
+			word := expr[i:j]
+			if repl, ok := wiresharkFields[strings.ToLower(word)]; ok && !compared(expr[j:]) {
+				b.WriteString("(" + repl + ")")
+			} else {
+				b.WriteString(word)
+			}
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// compared reports whether rest, the text after a field name, starts with
+// a comparison operator.
+func compared(rest string) bool {
+	rest = strings.TrimLeft(rest, " \t")
+	for _, op := range []string{"==", "!=", ">", "<", "~"} {
+		if strings.HasPrefix(rest, op) {
+			return true
+		}
+	}
+	word := rest
+	if k := strings.IndexAny(word, " \t(\""); k >= 0 {
+		word = word[:k]
+	}
+	switch strings.ToLower(word) {
+	case "eq", "ne", "gt", "lt", "ge", "le", "contains", "matches":
+		return true
+	}
+	return false
+}
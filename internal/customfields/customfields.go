@@ -0,0 +1,241 @@
+// Package customfields extracts user-defined fields from packet payloads
+// with regular expressions: a lightweight alternative to a dissector for
+// pulling a session ID, user name or version string out of a protocol
+// sniffox does not decode.
+package customfields
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/filter"
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+)
+
+// LayerName is the name of the layer extracted fields are added as, so
+// display filters can refer to them as custom.<field>.
+const LayerName = "Custom"
+
+const (
+	// maxMatches caps the matches of one rule in one packet.
+	maxMatches = 16
+	// maxValueLen cuts long extracted values.
+	maxValueLen = 256
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// Rule extracts fields from the payloads of the packets its filter
+// matches. With at most one capture group the field is named after the
+// rule and holds the group, or the whole match if there is none; with
+// several, each group is a field named <rule>_<group name or number>.
+type Rule struct {
+	Name     string `json:"name"`
+	Filter   string `json:"filter,omitempty"` // display filter, usually a protocol; all packets if empty
+	Pattern  string `json:"pattern"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+type compiledRule struct {
+	filter *filter.Filter // nil matches every packet
+	re     *regexp.Regexp
+	fields []string // per submatch, index 0 for the whole match; "" if not extracted
+}
+
+// Set is a list of extraction rules, safe for concurrent use.
+type Set struct {
+	mu       sync.RWMutex
+	rules    []Rule
+	compiled []*compiledRule // nil for disabled rules
+}
+
+// New creates an empty rule set; nothing is extracted.
+func New() *Set {
+	return &Set{}
+}
+
+// SetRules replaces the rules. Nothing changes if any enabled rule's
+// filter or pattern is invalid or two rules share a name.
+func (s *Set) SetRules(rules []Rule) error {
+	compiled := make([]*compiledRule, len(rules))
+	names := make(map[string]bool, len(rules))
+	for i, r := range rules {
+		if !validName.MatchString(r.Name) {
+			return fmt.Errorf("rule %d: name must be a letter followed by letters, digits or underscores", i+1)
+		}
+		if names[strings.ToLower(r.Name)] {
+			return fmt.Errorf("rule %q: duplicate name", r.Name)
+		}
+		names[strings.ToLower(r.Name)] = true
+		if r.Disabled {
+			continue
+		}
+		c, err := compile(r)
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		compiled[i] = c
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append([]Rule(nil), rules...)
+	s.compiled = compiled
+	return nil
+}
+
+func compile(r Rule) (*compiledRule, error) {
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiledRule{re: re, fields: make([]string, re.NumSubexp()+1)}
+	if strings.TrimSpace(r.Filter) != "" {
+		if c.filter, err = filter.Compile(r.Filter); err != nil {
+			return nil, err
+		}
+	}
+	switch re.NumSubexp() {
+	case 0:
+		c.fields[0] = r.Name
+	case 1:
+		c.fields[1] = r.Name
+	default:
+		for i, sub := range re.SubexpNames()[1:] {
+			if sub == "" {
+				sub = strconv.Itoa(i + 1)
+			}
+			c.fields[i+1] = r.Name + "_" + sub
+		}
+	}
+	return c, nil
+}
+
+// Rules returns a copy of the rules in order.
+func (s *Set) Rules() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Rule{}, s.rules...)
+}
+
+// Apply runs the rules on the packet's payload and adds the values they
+// extract to info as a Custom layer, one field per value, positioned in
+// the packet's bytes.
+func (s *Set) Apply(pkt gopacket.Packet, info *models.PacketInfo) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.compiled) == 0 {
+		return
+	}
+	payload, base, ok := parser.Payload(pkt)
+	if !ok {
+		return
+	}
+	var fields []models.LayerField
+	for _, c := range s.compiled {
+		if c == nil || (c.filter != nil && !c.filter.Match(pkt, info)) {
+			continue
+		}
+		for _, m := range c.re.FindAllSubmatchIndex(payload, maxMatches) {
+			for i, name := range c.fields {
+				start, end := m[2*i], m[2*i+1]
+				if name == "" || start < 0 {
+					continue
+				}
+				fields = append(fields, models.LayerField{
+					Name:   name,
+					Value:  value(payload[start:end]),
+					Offset: base + start,
+					Length: end - start,
+				})
+			}
+		}
+	}
+	if len(fields) > 0 {
+		info.Layers = append(info.Layers, models.LayerDetail{Name: LayerName, Fields: fields})
+	}
+}
+
+// value renders extracted bytes as text, quoting what is not printable.
+func value(b []byte) string {
+	if len(b) > maxValueLen {
+		b = b[:maxValueLen]
+	}
+	s := strconv.QuoteToGraphic(string(b))
+	s = s[1 : len(s)-1]
+	return strings.ReplaceAll(s, `\"`, `"`)
+}
+
+// ValueCount is how often a field held one value.
+type ValueCount struct {
+	Value       string `json:"value"`
+	Count       int    `json:"count"`
+	FirstPacket int    `json:"firstPacket"`
+}
+
+// FieldValues is the values one field was extracted with.
+type FieldValues struct {
+	Field  string       `json:"field"`
+	Total  int          `json:"total"` // extractions, including values left out
+	Values []ValueCount `json:"values"`
+}
+
+// Report aggregates extracted values per field.
+type Report struct {
+	fields map[string]map[string]*ValueCount
+	totals map[string]int
+}
+
+// NewReport creates an empty report.
+func NewReport() *Report {
+	return &Report{fields: make(map[string]map[string]*ValueCount), totals: make(map[string]int)}
+}
+
+// Add counts the fields extracted from packet number.
+func (r *Report) Add(number int, fields []models.LayerField) {
+	for _, f := range fields {
+		vals := r.fields[f.Name]
+		if vals == nil {
+			vals = make(map[string]*ValueCount)
+			r.fields[f.Name] = vals
+		}
+		r.totals[f.Name]++
+		if vc, ok := vals[f.Value]; ok {
+			vc.Count++
+		} else {
+			vals[f.Value] = &ValueCount{Value: f.Value, Count: 1, FirstPacket: number}
+		}
+	}
+}
+
+// Fields returns the fields by name, each with its most frequent values
+// first and at most limit of them if limit is positive.
+func (r *Report) Fields(limit int) []FieldValues {
+	out := make([]FieldValues, 0, len(r.fields))
+	for name, vals := range r.fields {
+		fv := FieldValues{Field: name, Total: r.totals[name], Values: make([]ValueCount, 0, len(vals))}
+		for _, vc := range vals {
+			fv.Values = append(fv.Values, *vc)
+		}
+		sort.Slice(fv.Values, func(i, j int) bool {
+			a, b := fv.Values[i], fv.Values[j]
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return a.FirstPacket < b.FirstPacket
+		})
+		if limit > 0 && len(fv.Values) > limit {
+			fv.Values = fv.Values[:limit]
+		}
+		out = append(out, fv)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Field < out[j].Field })
+	return out
+}
@@ -0,0 +1,276 @@
+// Package defrag reassembles fragmented IPv4 and IPv6 datagrams so the
+// transport and application layers of the whole datagram can be decoded.
+package defrag
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/ip4defrag"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// fragmentTimeout is how long an incomplete datagram waits for its
+	// missing fragments (RFC 8200 uses 60s; most stacks give up sooner).
+	fragmentTimeout = 30 * time.Second
+	sweepInterval   = 5 * time.Second
+	maxDatagrams    = 4096 // incomplete datagrams held at once, per IP version
+	maxIPv6Size     = 65535
+)
+
+// marker is attached to a rebuilt packet's ancillary data and records how
+// many fragments it was reassembled from.
+type marker int
+
+type v4Key struct {
+	src, dst string
+	id       uint16
+	proto    layers.IPProtocol
+}
+
+type v4Count struct {
+	n    int
+	seen time.Time
+}
+
+type v6Key struct {
+	src, dst string
+	id       uint32
+}
+
+type v6Fragment struct {
+	offset  int
+	payload []byte
+}
+
+type v6Datagram struct {
+	first     *layers.IPv6 // header of the offset-0 fragment
+	next      layers.IPProtocol
+	prefix    []byte // link-layer bytes in front of the IPv6 header
+	fragments []v6Fragment
+	total     int // payload length, known once the last fragment arrives
+	seen      time.Time
+}
+
+// Defragmenter holds the fragments of incomplete datagrams. It is not safe
+// for concurrent use.
+type Defragmenter struct {
+	v4        *ip4defrag.IPv4Defragmenter
+	v4Counts  map[v4Key]*v4Count
+	v6        map[v6Key]*v6Datagram
+	lastSweep time.Time
+}
+
+// New creates an empty defragmenter.
+func New() *Defragmenter {
+	d := &Defragmenter{}
+	d.Reset()
+	return d
+}
+
+// Reset drops all held fragments.
+func (d *Defragmenter) Reset() {
+	d.v4 = ip4defrag.NewIPv4Defragmenter()
+	d.v4Counts = make(map[v4Key]*v4Count)
+	d.v6 = make(map[v6Key]*v6Datagram)
+	d.lastSweep = time.Time{}
+}
+
+// Process feeds pkt to the defragmenter. When pkt is the fragment that
+// completes a datagram it returns the rebuilt packet — pkt's link-layer
+// header followed by the reassembled IP datagram — otherwise nil.
+func (d *Defragmenter) Process(pkt gopacket.Packet) gopacket.Packet {
+	ts := pkt.Metadata().Timestamp
+	d.sweep(ts)
+
+	if l := pkt.Layer(layers.LayerTypeIPv4); l != nil {
+		ip := l.(*layers.IPv4)
+		if ip.Flags&layers.IPv4MoreFragments == 0 && ip.FragOffset == 0 {
+			return nil
+		}
+		return d.processIPv4(pkt, ip, ts)
+	}
+	if l := pkt.Layer(layers.LayerTypeIPv6Fragment); l != nil {
+		return d.processIPv6(pkt, l.(*layers.IPv6Fragment), ts)
+	}
+	return nil
+}
+
+// Fragments reports how many fragments pkt was reassembled from, or 0 if
+// it was not produced by Process.
+func Fragments(pkt gopacket.Packet) int {
+	for _, a := range pkt.Metadata().AncillaryData {
+		if m, ok := a.(marker); ok {
+			return int(m)
+		}
+	}
+	return 0
+}
+
+// Mark records on pkt that it was reassembled from n fragments, for
+// packets rebuilt from stored bytes.
+func Mark(pkt gopacket.Packet, n int) {
+	md := pkt.Metadata()
+	md.AncillaryData = append(md.AncillaryData, marker(n))
+}
+
+// IsFragment reports whether pkt carries part of a datagram whose transport
+// header is not (fully) present, i.e. one that Process holds back.
+func IsFragment(pkt gopacket.Packet) bool {
+	return pkt.Layer(gopacket.LayerTypeFragment) != nil
+}
+
+func (d *Defragmenter) processIPv4(pkt gopacket.Packet, ip *layers.IPv4, ts time.Time) gopacket.Packet {
+	key := v4Key{ip.SrcIP.String(), ip.DstIP.String(), ip.Id, ip.Protocol}
+	c, ok := d.v4Counts[key]
+	if !ok {
+		if len(d.v4Counts) >= maxDatagrams {
+			return nil
+		}
+		c = &v4Count{}
+		d.v4Counts[key] = c
+	}
+	c.n++
+	c.seen = ts
+	out, err := d.v4.DefragIPv4WithTimestamp(ip, ts)
+	if err != nil || out == nil {
+		if err != nil {
+			delete(d.v4Counts, key)
+		}
+		return nil
+	}
+	delete(d.v4Counts, key)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, out, gopacket.Payload(out.Payload)); err != nil {
+		return nil
+	}
+	return rebuild(pkt, linkPrefix(pkt, ip), buf.Bytes(), c.n)
+}
+
+func (d *Defragmenter) processIPv6(pkt gopacket.Packet, frag *layers.IPv6Fragment, ts time.Time) gopacket.Packet {
+	l := pkt.Layer(layers.LayerTypeIPv6)
+	if l == nil {
+		return nil
+	}
+	ip := l.(*layers.IPv6)
+	key := v6Key{ip.SrcIP.String(), ip.DstIP.String(), frag.Identification}
+	dg, ok := d.v6[key]
+	if !ok {
+		if len(d.v6) >= maxDatagrams {
+			return nil
+		}
+		dg = &v6Datagram{total: -1}
+		d.v6[key] = dg
+	}
+	dg.seen = ts
+
+	offset := int(frag.FragmentOffset) * 8
+	payload := frag.LayerPayload()
+	if offset+len(payload) > maxIPv6Size {
+		delete(d.v6, key)
+		return nil
+	}
+	if offset == 0 {
+		dg.first = ip
+		dg.next = frag.NextHeader
+		dg.prefix = linkPrefix(pkt, ip)
+	}
+	if !frag.MoreFragments {
+		dg.total = offset + len(payload)
+	}
+	dg.fragments = append(dg.fragments, v6Fragment{offset: offset, payload: payload})
+
+	data, ok := dg.assemble()
+	if !ok {
+		return nil
+	}
+	delete(d.v6, key)
+
+	hdr := &layers.IPv6{
+		Version:      6,
+		TrafficClass: dg.first.TrafficClass,
+		FlowLabel:    dg.first.FlowLabel,
+		NextHeader:   dg.next,
+		HopLimit:     dg.first.HopLimit,
+		SrcIP:        dg.first.SrcIP,
+		DstIP:        dg.first.DstIP,
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, hdr, gopacket.Payload(data)); err != nil {
+		return nil
+	}
+	return rebuild(pkt, dg.prefix, buf.Bytes(), len(dg.fragments))
+}
+
+// assemble joins the fragments once the first and last have arrived and
+// there are no holes. Overlapping bytes are taken from the earlier fragment.
+func (dg *v6Datagram) assemble() ([]byte, bool) {
+	if dg.first == nil || dg.total < 0 {
+		return nil, false
+	}
+	sort.SliceStable(dg.fragments, func(i, j int) bool { return dg.fragments[i].offset < dg.fragments[j].offset })
+	data := make([]byte, 0, dg.total)
+	for _, f := range dg.fragments {
+		if f.offset > len(data) {
+			return nil, false
+		}
+		if end := f.offset + len(f.payload); end > len(data) {
+			data = append(data, f.payload[len(data)-f.offset:]...)
+		}
+	}
+	if len(data) < dg.total {
+		return nil, false
+	}
+	return data[:dg.total], true
+}
+
+// sweep drops datagrams that have waited longer than fragmentTimeout.
+func (d *Defragmenter) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < sweepInterval {
+		return
+	}
+	d.lastSweep = now
+	cutoff := now.Add(-fragmentTimeout)
+	d.v4.DiscardOlderThan(cutoff)
+	for k, c := range d.v4Counts {
+		if c.seen.Before(cutoff) {
+			delete(d.v4Counts, k)
+		}
+	}
+	for k, dg := range d.v6 {
+		if dg.seen.Before(cutoff) {
+			delete(d.v6, k)
+		}
+	}
+}
+
+// linkPrefix returns the bytes of pkt in front of the network layer nl.
+func linkPrefix(pkt gopacket.Packet, nl gopacket.Layer) []byte {
+	n := 0
+	for _, l := range pkt.Layers() {
+		if l == nl {
+			break
+		}
+		n += len(l.LayerContents())
+	}
+	return pkt.Data()[:n]
+}
+
+// rebuild decodes prefix+datagram as a new packet carrying pkt's metadata.
+func rebuild(pkt gopacket.Packet, prefix, datagram []byte, fragments int) gopacket.Packet {
+	data := make([]byte, 0, len(prefix)+len(datagram))
+	data = append(append(data, prefix...), datagram...)
+	first := pkt.Layers()[0].LayerType()
+	out := gopacket.NewPacket(data, first, gopacket.Default)
+	md := out.Metadata()
+	md.CaptureInfo = pkt.Metadata().CaptureInfo
+	md.CaptureLength = len(data)
+	md.Length = len(data)
+	md.AncillaryData = nil
+	Mark(out, fragments)
+	return out
+}
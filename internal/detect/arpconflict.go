@@ -0,0 +1,181 @@
+package detect
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+const (
+	// claimTTL is how long an ARP claim keeps a MAC associated with an IP.
+	claimTTL = 10 * time.Minute
+	// probeWindow is how long an RFC 5227 probe waits for a defending reply.
+	probeWindow = 10 * time.Second
+)
+
+type arpProbe struct {
+	mac string
+	at  time.Time
+}
+
+// ARPConflict detects duplicate IPv4 address usage on the segment from ARP
+// claims, gratuitous ARP, RFC 5227 address probes and DHCP DECLINE messages.
+type ARPConflict struct {
+	owners map[string]map[string]time.Time // ip -> mac -> last claim
+	probes map[string]arpProbe             // ip -> most recent probe
+}
+
+// NewARPConflict creates an ARP/IP conflict detector.
+func NewARPConflict() *ARPConflict {
+	d := &ARPConflict{}
+	d.Reset()
+	return d
+}
+
+// Reset implements Detector.
+func (d *ARPConflict) Reset() {
+	d.owners = make(map[string]map[string]time.Time)
+	d.probes = make(map[string]arpProbe)
+}
+
+// Inspect implements Detector.
+func (d *ARPConflict) Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding {
+	if arpLayer := pkt.Layer(layers.LayerTypeARP); arpLayer != nil {
+		return d.inspectARP(arpLayer.(*layers.ARP), ts)
+	}
+	if dhcpLayer := pkt.Layer(layers.LayerTypeDHCPv4); dhcpLayer != nil {
+		return d.inspectDHCP(dhcpLayer.(*layers.DHCPv4), ts)
+	}
+	return nil
+}
+
+func (d *ARPConflict) inspectARP(arp *layers.ARP, ts time.Time) []Finding {
+	if len(arp.SourceProtAddress) != 4 || len(arp.DstProtAddress) != 4 {
+		return nil
+	}
+	senderIP := net.IP(arp.SourceProtAddress).String()
+	targetIP := net.IP(arp.DstProtAddress).String()
+	senderMAC := net.HardwareAddr(arp.SourceHwAddress).String()
+
+	// RFC 5227 probe: sender IP is 0.0.0.0, target is the address being tested
+	if senderIP == "0.0.0.0" {
+		d.probes[targetIP] = arpProbe{mac: senderMAC, at: ts}
+		others := d.otherOwners(targetIP, senderMAC, ts)
+		if len(others) == 0 {
+			return nil
+		}
+		return []Finding{conflictFinding("ip_conflict", "Duplicate Address Probe", targetIP, senderMAC, others,
+			fmt.Sprintf("%s probed %s at %s, but it is already in use by %s",
+				senderMAC, targetIP, ts.Format("15:04:05.000"), describeOwners(others)))}
+	}
+
+	var findings []Finding
+	others := d.otherOwners(senderIP, senderMAC, ts)
+	if len(others) > 0 {
+		title := "IP Address Conflict"
+		if senderIP == targetIP {
+			title = "Gratuitous ARP Conflict"
+		}
+		findings = append(findings, conflictFinding("ip_conflict", title, senderIP, senderMAC, others,
+			fmt.Sprintf("%s claimed %s at %s, also claimed by %s",
+				senderMAC, senderIP, ts.Format("15:04:05.000"), describeOwners(others))))
+	}
+
+	// A claim from a different MAC shortly after a probe means the probe lost
+	if p, ok := d.probes[senderIP]; ok && p.mac != senderMAC && ts.Sub(p.at) <= probeWindow {
+		findings = append(findings, conflictFinding("ip_conflict", "Duplicate Address Detected", senderIP, p.mac,
+			map[string]time.Time{senderMAC: ts},
+			fmt.Sprintf("%s probed %s at %s and %s defended it at %s",
+				p.mac, senderIP, p.at.Format("15:04:05.000"), senderMAC, ts.Format("15:04:05.000"))))
+		delete(d.probes, senderIP)
+	}
+
+	if d.owners[senderIP] == nil {
+		d.owners[senderIP] = make(map[string]time.Time)
+	}
+	d.owners[senderIP][senderMAC] = ts
+	return findings
+}
+
+func (d *ARPConflict) inspectDHCP(dhcp *layers.DHCPv4, ts time.Time) []Finding {
+	var msgType layers.DHCPMsgType
+	var requested net.IP
+	for _, opt := range dhcp.Options {
+		switch opt.Type {
+		case layers.DHCPOptMessageType:
+			if len(opt.Data) > 0 {
+				msgType = layers.DHCPMsgType(opt.Data[0])
+			}
+		case layers.DHCPOptRequestIP:
+			if len(opt.Data) == 4 {
+				requested = net.IP(opt.Data)
+			}
+		}
+	}
+	if msgType != layers.DHCPMsgTypeDecline || requested == nil {
+		return nil
+	}
+
+	ip := requested.String()
+	clientMAC := net.HardwareAddr(dhcp.ClientHWAddr).String()
+	detail := fmt.Sprintf("%s declined %s at %s (address already in use)", clientMAC, ip, ts.Format("15:04:05.000"))
+	others := d.otherOwners(ip, clientMAC, ts)
+	if len(others) > 0 {
+		detail += ", held by " + describeOwners(others)
+	}
+	return []Finding{{
+		Key: "dhcp_decline:" + ip + ":" + clientMAC,
+		Alert: models.Alert{
+			Severity: "medium",
+			Type:     "dhcp_decline",
+			Title:    "DHCP Decline (Duplicate Address)",
+			Detail:   detail,
+			SrcIP:    ip,
+		},
+	}}
+}
+
+// otherOwners returns MACs other than mac that claimed ip within claimTTL.
+func (d *ARPConflict) otherOwners(ip, mac string, ts time.Time) map[string]time.Time {
+	out := make(map[string]time.Time)
+	for m, last := range d.owners[ip] {
+		if m != mac && ts.Sub(last) <= claimTTL {
+			out[m] = last
+		}
+	}
+	return out
+}
+
+func conflictFinding(typ, title, ip, mac string, others map[string]time.Time, detail string) Finding {
+	macs := []string{mac}
+	for m := range others {
+		macs = append(macs, m)
+	}
+	sort.Strings(macs)
+	return Finding{
+		Key: typ + ":" + ip + ":" + strings.Join(macs, ","),
+		Alert: models.Alert{
+			Severity: "high",
+			Type:     typ,
+			Title:    title,
+			Detail:   detail,
+			SrcIP:    ip,
+		},
+	}
+}
+
+func describeOwners(owners map[string]time.Time) string {
+	parts := make([]string, 0, len(owners))
+	for m, last := range owners {
+		parts = append(parts, fmt.Sprintf("%s (last seen %s)", m, last.Format("15:04:05.000")))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
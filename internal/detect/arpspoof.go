@@ -0,0 +1,213 @@
+package detect
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+const (
+	// requestWindow is how long an ARP request stays open for a reply.
+	requestWindow = 5 * time.Second
+	// gratuitousWindow is the period over which gratuitous ARPs are counted.
+	gratuitousWindow = 10 * time.Second
+	// gratuitousThreshold is how many gratuitous ARPs one MAC may send
+	// within gratuitousWindow; a failover sends a handful.
+	gratuitousThreshold = 10
+	// maxPendingRequests bounds the open requests kept before stale ones
+	// are swept.
+	maxPendingRequests = 4096
+)
+
+type arpRequest struct {
+	asker, target string // IPv4 addresses
+}
+
+// arpPending is an open ARP request and the MAC that answered it, if any.
+type arpPending struct {
+	at       time.Time
+	answerer string
+}
+
+type arpBinding struct {
+	mac  string
+	seen time.Time
+}
+
+// ARPSpoof detects ARP cache poisoning: replies nobody asked for, replies
+// that rebind an address to a new MAC, two MACs answering one request,
+// and floods of gratuitous ARP. It
+// keeps its own IP-to-MAC bindings, learned from every ARP sender.
+// Conflicting claims that are not replies are left to ARPConflict.
+type ARPSpoof struct {
+	bindings   map[string]arpBinding      // ip -> current claimant
+	pending    map[arpRequest]*arpPending // open requests by asker and target
+	gratuitous map[string][]time.Time     // mac -> recent gratuitous ARPs
+	excluded   map[string]bool
+}
+
+// NewARPSpoof creates an ARP spoofing detector.
+func NewARPSpoof() *ARPSpoof {
+	d := &ARPSpoof{excluded: make(map[string]bool)}
+	d.Reset()
+	return d
+}
+
+// Reset implements Detector. The exclusion list is configuration and is kept.
+func (d *ARPSpoof) Reset() {
+	d.bindings = make(map[string]arpBinding)
+	d.pending = make(map[arpRequest]*arpPending)
+	d.gratuitous = make(map[string][]time.Time)
+}
+
+// Exclude implements Excluder.
+func (d *ARPSpoof) Exclude(addrs []string) {
+	d.excluded = make(map[string]bool)
+	for _, a := range addrs {
+		a = strings.TrimSpace(a)
+		if mac, err := net.ParseMAC(a); err == nil {
+			d.excluded[mac.String()] = true
+		} else if ip := net.ParseIP(a); ip != nil {
+			d.excluded[ip.String()] = true
+		}
+	}
+}
+
+// Inspect implements Detector.
+func (d *ARPSpoof) Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding {
+	arpLayer := pkt.Layer(layers.LayerTypeARP)
+	if arpLayer == nil {
+		return nil
+	}
+	arp := arpLayer.(*layers.ARP)
+	if len(arp.SourceProtAddress) != 4 || len(arp.DstProtAddress) != 4 {
+		return nil
+	}
+	senderIP := net.IP(arp.SourceProtAddress)
+	if senderIP.IsUnspecified() {
+		// RFC 5227 probes claim nothing
+		return nil
+	}
+	sender, target := senderIP.String(), net.IP(arp.DstProtAddress).String()
+	mac := net.HardwareAddr(arp.SourceHwAddress).String()
+
+	gratuitous := sender == target || (arp.Operation == layers.ARPReply && isBroadcastMAC(arp.DstHwAddress))
+	prev, bound := d.bindings[sender]
+	d.bindings[sender] = arpBinding{mac: mac, seen: ts}
+	if d.excluded[mac] || d.excluded[sender] {
+		return nil
+	}
+
+	var findings []Finding
+	switch {
+	case gratuitous:
+		if f, ok := d.countGratuitous(mac, sender, ts); ok {
+			findings = append(findings, f)
+		}
+	case arp.Operation == layers.ARPRequest:
+		if len(d.pending) >= maxPendingRequests {
+			d.sweep(ts)
+		}
+		d.pending[arpRequest{asker: sender, target: target}] = &arpPending{at: ts}
+	case arp.Operation == layers.ARPReply:
+		p, ok := d.pending[arpRequest{asker: target, target: sender}]
+		switch {
+		case !ok || ts.Sub(p.at) > requestWindow:
+			findings = append(findings, unsolicitedFinding(sender, target, mac, prev, bound, ts))
+		case p.answerer == "":
+			p.answerer = mac
+		case p.answerer != mac:
+			// Two MACs racing to answer one request
+			findings = append(findings, spoofFinding(sender, mac, fmt.Sprintf(
+				"%s and %s both answered %s's request for %s at %s — ARP cache poisoning",
+				p.answerer, mac, target, sender, ts.Format("15:04:05.000"))))
+		}
+	}
+	return findings
+}
+
+// countGratuitous records a gratuitous ARP from mac and reports a flood
+// once it sends gratuitousThreshold of them within gratuitousWindow.
+func (d *ARPSpoof) countGratuitous(mac, ip string, ts time.Time) (Finding, bool) {
+	times := append(d.gratuitous[mac], ts)
+	for len(times) > 0 && ts.Sub(times[0]) > gratuitousWindow {
+		times = times[1:]
+	}
+	d.gratuitous[mac] = times
+	if len(times) < gratuitousThreshold {
+		return Finding{}, false
+	}
+	return Finding{
+		Key: "arp_gratuitous_flood:" + mac,
+		Alert: models.Alert{
+			Severity: "medium",
+			Type:     "arp_gratuitous_flood",
+			Title:    "Gratuitous ARP Flood",
+			Detail: fmt.Sprintf("%s sent %d gratuitous ARPs within %s (latest for %s) — ARP poisoning or a misbehaving failover",
+				mac, len(times), gratuitousWindow, ip),
+			SrcIP: ip,
+		},
+	}, true
+}
+
+// sweep drops requests older than requestWindow.
+func (d *ARPSpoof) sweep(ts time.Time) {
+	for r, p := range d.pending {
+		if ts.Sub(p.at) > requestWindow {
+			delete(d.pending, r)
+		}
+	}
+}
+
+// unsolicitedFinding reports a reply with no matching request. One that
+// moves the address to a different MAC is the signature of poisoning and
+// raised as high severity.
+func unsolicitedFinding(sender, target, mac string, prev arpBinding, bound bool, ts time.Time) Finding {
+	detail := fmt.Sprintf("%s answered %s for %s at %s with no request seen",
+		mac, target, sender, ts.Format("15:04:05.000"))
+	if bound && prev.mac != mac {
+		return spoofFinding(sender, mac, fmt.Sprintf("%s, replacing %s (last seen %s) — ARP cache poisoning",
+			detail, prev.mac, prev.seen.Format("15:04:05.000")))
+	}
+	return Finding{
+		Key: "arp_unsolicited:" + sender + ":" + mac,
+		Alert: models.Alert{
+			Severity: "medium",
+			Type:     "arp_unsolicited",
+			Title:    "Unsolicited ARP Reply",
+			Detail:   detail,
+			SrcIP:    sender,
+		},
+	}
+}
+
+func spoofFinding(ip, mac, detail string) Finding {
+	return Finding{
+		Key: "arp_spoof:" + ip + ":" + mac,
+		Alert: models.Alert{
+			Severity: "high",
+			Type:     "arp_spoof",
+			Title:    "ARP Spoofing",
+			Detail:   detail,
+			SrcIP:    ip,
+		},
+	}
+}
+
+func isBroadcastMAC(b []byte) bool {
+	if len(b) != 6 {
+		return false
+	}
+	for _, x := range b {
+		if x != 0xff {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,508 @@
+package detect
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+)
+
+const (
+	maxCleartextConns = 4096
+	// cleartextIdle is how long a quiet connection is kept when the table
+	// is full
+	cleartextIdle = 2 * time.Minute
+	// maxCredLine caps the unterminated line kept per direction
+	maxCredLine = 8192
+	// maxCleartextSeen caps the credentials remembered as reported, and
+	// cleartextSeenTTL is how long one is, in capture time
+	maxCleartextSeen = 4096
+	cleartextSeenTTL = time.Hour
+)
+
+// credPorts are the server ports of the protocols that send credentials
+// in plaintext. Decode-as rules for HTTP, FTP, SMTP, POP3 and IMAP add to
+// them.
+var credPorts = map[uint16]string{
+	21: "FTP", 23: "Telnet", 25: "SMTP", 587: "SMTP", 110: "POP3", 143: "IMAP",
+	80: "HTTP", 8000: "HTTP", 8008: "HTTP", 8080: "HTTP", 3128: "HTTP",
+}
+
+// Telnet login states
+const (
+	telnetIdle = iota
+	telnetUser // the server asked for the login name
+	telnetPass // the server asked for the password
+)
+
+// Cleartext flags credentials sent in plaintext: HTTP Basic
+// authorization, FTP and POP3 USER/PASS, IMAP LOGIN, SASL PLAIN and LOGIN
+// in SMTP, POP3 and IMAP AUTH, Telnet logins and SNMPv1/v2c communities.
+// TCP connections are read from the stream manager's reassembly, through
+// Stream, so credentials split across segments, typed a character at a
+// time or sent over several commands are found. Each credential is
+// reported once an hour at most, with the secret redacted; only a hash of
+// it is kept to tell repeats.
+type Cleartext struct {
+	// Stream is called from the stream manager's goroutines
+	mu    sync.Mutex
+	conns map[uint64]*credConn
+	seen  map[[sha256.Size]byte]time.Time
+}
+
+// credConn is the state of one TCP connection.
+type credConn struct {
+	proto          string
+	client, server string // ip:port
+	toServer       credStream
+	toClient       credStream
+	last           time.Time
+	ended          int // directions the stream manager has closed
+
+	user string // from USER, or a Telnet login name
+	// sasl is the mechanism of an AUTH whose credentials follow on their
+	// own lines, and saslUser the LOGIN user name already sent
+	sasl     string
+	saslUser string
+	telnet   int
+	typed    []byte // what the client typed at a Telnet prompt
+	prompt   []byte // the tail of the Telnet server's output
+}
+
+// credStream is one direction of a connection.
+type credStream struct {
+	line []byte // an unterminated line
+}
+
+// NewCleartext creates a cleartext credential detector.
+func NewCleartext() *Cleartext {
+	d := &Cleartext{}
+	d.Reset()
+	return d
+}
+
+// Reset implements Detector.
+func (d *Cleartext) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.conns = make(map[uint64]*credConn)
+	d.seen = make(map[[sha256.Size]byte]time.Time)
+}
+
+// Inspect implements Detector. Only SNMP is found in single packets; TCP
+// connections come through Stream.
+func (d *Cleartext) Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding {
+	snmp := parser.ExtractSNMP(pkt)
+	if snmp == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.inspectSNMP(snmp, parser.ExtractFlowTuple(pkt), ts)
+}
+
+// Stream takes the bytes one direction of TCP stream id delivered, in
+// order, as the stream manager reassembles them. client and server are
+// the stream's endpoints as the manager saw them first; nil data means
+// the direction ended.
+func (d *Cleartext) Stream(id uint64, client, server string, clientPort, serverPort uint16, fromClient bool, data []byte, ts time.Time) []Finding {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if data == nil {
+		// Forget the connection once both directions have ended
+		if c := d.conns[id]; c != nil {
+			if c.ended++; c.ended == 2 {
+				delete(d.conns, id)
+			}
+		}
+		return nil
+	}
+	// The manager's client is whoever it saw first, which may be the
+	// server if the capture started mid-connection
+	from := net.JoinHostPort(client, strconv.Itoa(int(clientPort)))
+	to := net.JoinHostPort(server, strconv.Itoa(int(serverPort)))
+	fromPort, toPort := clientPort, serverPort
+	if !fromClient {
+		from, to, fromPort, toPort = to, from, toPort, fromPort
+	}
+	c := d.conns[id]
+	if c == nil {
+		if c = d.newConn(from, to, fromPort, toPort, data, ts); c == nil {
+			return nil
+		}
+		d.conns[id] = c
+	}
+	c.last = ts
+	return d.consume(c, from == c.client, data)
+}
+
+// newConn starts following a connection from src to dst when either is
+// on a credential port, or its first data from src is an HTTP request. It
+// returns nil for any other connection, or when the table is full.
+func (d *Cleartext) newConn(src, dst string, srcPort, dstPort uint16, data []byte, ts time.Time) *credConn {
+	c := &credConn{}
+	if p := credProtocol(dstPort); p != "" {
+		c.proto, c.client, c.server = p, src, dst
+	} else if p := credProtocol(srcPort); p != "" {
+		c.proto, c.client, c.server = p, dst, src
+	} else if isHTTPRequest(data) {
+		c.proto, c.client, c.server = "HTTP", src, dst
+	} else {
+		return nil
+	}
+	if len(d.conns) >= maxCleartextConns {
+		for k, old := range d.conns {
+			if ts.Sub(old.last) > cleartextIdle {
+				delete(d.conns, k)
+			}
+		}
+		if len(d.conns) >= maxCleartextConns {
+			return nil
+		}
+	}
+	return c
+}
+
+// credProtocol returns the credential-carrying protocol a server port
+// runs, by a decode-as rule or its well-known port.
+func credProtocol(port uint16) string {
+	switch p := parser.DecodeAsPort("TCP", port); p {
+	case "HTTP", "FTP", "SMTP", "POP3", "IMAP":
+		return p
+	case "":
+		return credPorts[port]
+	}
+	return ""
+}
+
+func isHTTPRequest(data []byte) bool {
+	for _, m := range []string{"GET ", "POST ", "PUT ", "DELETE ", "HEAD ", "PATCH ", "OPTIONS ", "CONNECT "} {
+		if bytes.HasPrefix(data, []byte(m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// lines appends data to the unterminated line and returns the lines it
+// completes, without their CRLF or LF.
+func (s *credStream) lines(data []byte) []string {
+	var out []string
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		line := append(s.line, data[:i]...)
+		out = append(out, strings.TrimSuffix(string(line), "\r"))
+		s.line, data = nil, data[i+1:]
+	}
+	if len(s.line)+len(data) <= maxCredLine {
+		s.line = append(s.line, data...)
+	} else {
+		s.line = nil
+	}
+	return out
+}
+
+// consume follows the new bytes of one direction of c.
+func (d *Cleartext) consume(c *credConn, fromClient bool, data []byte) []Finding {
+	if c.proto == "Telnet" {
+		return d.telnet(c, fromClient, data)
+	}
+	if !fromClient {
+		// Only the client sends credentials
+		c.toClient.line = nil
+		return nil
+	}
+	var out []Finding
+	for _, line := range c.toServer.lines(data) {
+		out = append(out, d.clientLine(c, line)...)
+	}
+	return out
+}
+
+// clientLine looks for credentials in a line the client sent.
+func (d *Cleartext) clientLine(c *credConn, line string) []Finding {
+	if c.proto == "HTTP" {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || (!strings.EqualFold(name, "Authorization") && !strings.EqualFold(name, "Proxy-Authorization")) {
+			return nil
+		}
+		scheme, cred, _ := strings.Cut(strings.TrimSpace(value), " ")
+		if !strings.EqualFold(scheme, "Basic") {
+			return nil
+		}
+		user, pass, ok := strings.Cut(decodeBase64(cred), ":")
+		if !ok {
+			return nil
+		}
+		return d.report(c, "HTTP Basic", user, pass)
+	}
+
+	if c.sasl != "" {
+		switch _, isCommand := parser.MailCommand(c.proto, line); {
+		case isCommand:
+			// The server refused the mechanism and the client moved on
+			c.sasl = ""
+		case line == "*":
+			// The client cancelled the exchange
+			c.sasl = ""
+			return nil
+		default:
+			return d.saslLine(c, line)
+		}
+	}
+
+	var m parser.MailMessage
+	var ok bool
+	if c.proto == "FTP" {
+		cmd, arg, _ := strings.Cut(line, " ")
+		m, ok = parser.MailMessage{Command: strings.ToUpper(cmd), Arg: strings.TrimSpace(arg)}, true
+	} else {
+		m, ok = parser.MailCommand(c.proto, line)
+	}
+	if !ok {
+		return nil
+	}
+	switch m.Command {
+	case "USER":
+		c.user = m.Arg
+	case "PASS":
+		return d.report(c, c.proto, c.user, m.Arg)
+	case "LOGIN":
+		user, pass := imapAString(m.Arg)
+		pass, _ = imapAString(pass)
+		return d.report(c, c.proto+" LOGIN", user, pass)
+	case "AUTH", "AUTHENTICATE":
+		mech, initial, _ := strings.Cut(m.Arg, " ")
+		mech = strings.ToUpper(mech)
+		if mech != "PLAIN" && mech != "LOGIN" {
+			return nil
+		}
+		c.sasl, c.saslUser = mech, ""
+		if initial = strings.TrimSpace(initial); initial != "" && initial != "=" {
+			return d.saslLine(c, initial)
+		}
+	}
+	return nil
+}
+
+// saslLine takes a client response in a SASL PLAIN or LOGIN exchange.
+func (d *Cleartext) saslLine(c *credConn, line string) []Finding {
+	kind := c.proto + " AUTH " + c.sasl
+	value := decodeBase64(line)
+	if c.sasl == "PLAIN" {
+		c.sasl = ""
+		// authzid NUL authcid NUL passwd
+		f := strings.Split(value, "\x00")
+		if len(f) != 3 {
+			return nil
+		}
+		return d.report(c, kind, f[1], f[2])
+	}
+	if c.saslUser == "" {
+		c.saslUser = value
+		return nil
+	}
+	c.sasl = ""
+	return d.report(c, kind, c.saslUser, value)
+}
+
+// telnet follows a Telnet login: the server's "login:" and "Password:"
+// prompts and what the client types at them, a character at a time or
+// a line at once.
+func (d *Cleartext) telnet(c *credConn, fromClient bool, data []byte) []Finding {
+	data = stripTelnetCommands(data)
+	if !fromClient {
+		c.prompt = append(c.prompt, data...)
+		if len(c.prompt) > 64 {
+			c.prompt = c.prompt[len(c.prompt)-64:]
+		}
+		prompt := strings.ToLower(strings.TrimSpace(string(c.prompt)))
+		switch {
+		case strings.HasSuffix(prompt, "password:"):
+			c.telnet, c.typed, c.prompt = telnetPass, nil, nil
+		case strings.HasSuffix(prompt, "login:") || strings.HasSuffix(prompt, "username:"):
+			c.telnet, c.typed, c.prompt = telnetUser, nil, nil
+		}
+		return nil
+	}
+	if c.telnet == telnetIdle {
+		return nil
+	}
+	for _, b := range data {
+		switch {
+		case b == '\r' || b == '\n':
+			if len(c.typed) == 0 {
+				continue
+			}
+			typed := string(c.typed)
+			state := c.telnet
+			c.telnet, c.typed = telnetIdle, nil
+			if state == telnetUser {
+				c.user = typed
+				continue
+			}
+			return d.report(c, "Telnet", c.user, typed)
+		case b == 0x08 || b == 0x7f:
+			if len(c.typed) > 0 {
+				c.typed = c.typed[:len(c.typed)-1]
+			}
+		case b >= ' ' && len(c.typed) < 256:
+			c.typed = append(c.typed, b)
+		}
+	}
+	return nil
+}
+
+// stripTelnetCommands removes the IAC command and option negotiation
+// sequences from Telnet data.
+func stripTelnetCommands(data []byte) []byte {
+	if bytes.IndexByte(data, 0xff) < 0 {
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] != 0xff || i+1 >= len(data) {
+			out = append(out, data[i])
+			continue
+		}
+		switch cmd := data[i+1]; {
+		case cmd == 0xff:
+			// An escaped 0xff data byte
+			out = append(out, 0xff)
+			i++
+		case cmd == 0xfa:
+			// Subnegotiation, up to IAC SE
+			end := bytes.Index(data[i:], []byte{0xff, 0xf0})
+			if end < 0 {
+				return out
+			}
+			i += end + 1
+		case cmd >= 0xfb && cmd <= 0xfe:
+			// WILL, WONT, DO, DONT and the option
+			i += 2
+		default:
+			i++
+		}
+	}
+	return out
+}
+
+// inspectSNMP flags the community of an SNMPv1 or v2c request or trap.
+// Responses repeat the community of the request they answer, and come
+// from the agent.
+func (d *Cleartext) inspectSNMP(m *parser.SNMPMessage, tuple parser.FlowTuple, ts time.Time) []Finding {
+	if m.Community == "" || m.Version == 3 || !m.HasPDU || m.IsResponse() || !tuple.Valid {
+		return nil
+	}
+	c := &credConn{
+		proto:  "SNMP",
+		client: net.JoinHostPort(tuple.SrcIP, strconv.Itoa(int(tuple.SrcPort))),
+		server: net.JoinHostPort(tuple.DstIP, strconv.Itoa(int(tuple.DstPort))),
+	}
+	c.last = ts
+	return d.report(c, "SNMP "+m.VersionName()+" community", "", m.Community)
+}
+
+// report raises a finding for a credential unless it was reported within
+// cleartextSeenTTL.
+func (d *Cleartext) report(c *credConn, kind, user, secret string) []Finding {
+	if secret == "" && user == "" {
+		return nil
+	}
+	clientIP, _, _ := net.SplitHostPort(c.client)
+	serverIP, _, _ := net.SplitHostPort(c.server)
+	key := "cleartext:" + kind + ":" + clientIP + ":" + c.server + ":" + user + ":" + redact(secret)
+	// The secret itself is not kept
+	seenKey := sha256.Sum256([]byte(key + "\x00" + secret))
+	if at, ok := d.seen[seenKey]; ok && c.last.Sub(at) < cleartextSeenTTL {
+		return nil
+	}
+	if len(d.seen) >= maxCleartextSeen {
+		for k, at := range d.seen {
+			if c.last.Sub(at) >= cleartextSeenTTL {
+				delete(d.seen, k)
+			}
+		}
+		if len(d.seen) >= maxCleartextSeen {
+			// Forget the lot rather than grow; a repeat is reported again
+			clear(d.seen)
+		}
+	}
+	d.seen[seenKey] = c.last
+
+	severity := "high"
+	var detail string
+	if c.proto == "SNMP" {
+		severity = "medium"
+		detail = fmt.Sprintf("%s sent %s %s in cleartext to %s", clientIP, kind, redact(secret), c.server)
+	} else {
+		detail = fmt.Sprintf("%s sent %s credentials in cleartext to %s: user %q, password %s",
+			clientIP, kind, c.server, user, redact(secret))
+	}
+	return []Finding{{
+		Key: key,
+		Alert: models.Alert{
+			Severity:   severity,
+			Type:       "cleartext_credentials",
+			Title:      "Cleartext Credentials",
+			Detail:     detail,
+			SrcIP:      clientIP,
+			Indicators: []models.Indicator{ipIndicator(serverIP)},
+		},
+	}}
+}
+
+// redact keeps the first character of a secret and masks the rest:
+// "hunter2" becomes "h******".
+func redact(s string) string {
+	r := []rune(s)
+	if len(r) == 0 {
+		return `""`
+	}
+	return string(r[0]) + strings.Repeat("*", min(len(r)-1, 15))
+}
+
+func decodeBase64(s string) string {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// imapAString splits an IMAP atom or quoted string off the front of s.
+func imapAString(s string) (value, rest string) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, `"`) {
+		value, rest, _ = strings.Cut(s, " ")
+		return value, rest
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
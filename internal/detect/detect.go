@@ -0,0 +1,257 @@
+package detect
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+)
+
+// dedupWindow suppresses repeats of the same alert key.
+const dedupWindow = 30 * time.Second
+
+// maxAlerts caps the alert log; the oldest half is dropped when it fills.
+const maxAlerts = 10000
+
+// Detector inspects decoded packets and reports security findings.
+type Detector interface {
+	// Inspect is called for every packet in capture order. ts is the
+	// packet capture time, which detectors should use instead of wall time
+	// so PCAP imports produce the same findings as live captures.
+	Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding
+	// Reset drops all per-capture state.
+	Reset()
+}
+
+// StreamDetector is implemented by detectors that read TCP connections as
+// the stream manager reassembles them, rather than packet by packet.
+type StreamDetector interface {
+	// Stream is given the bytes one direction of stream id delivered, in
+	// order, with nil data once it has ended. It can be called from
+	// several goroutines at once.
+	Stream(id uint64, client, server string, clientPort, serverPort uint16, fromClient bool, data []byte, ts time.Time) []Finding
+}
+
+// Finding is an alert produced by a detector, plus the key used to dedupe it.
+type Finding struct {
+	Key   string
+	Alert models.Alert
+}
+
+// Manager fans packets out to a set of detectors and keeps the alert log.
+type Manager struct {
+	mu        sync.Mutex
+	detectors []Detector
+	alerts    []models.Alert
+	fired     map[string]time.Time
+	pruned    time.Time // when fired was last cleared of expired keys
+	nextID    int
+}
+
+// NewManager creates a Manager running the given detectors.
+func NewManager(detectors ...Detector) *Manager {
+	return &Manager{
+		detectors: detectors,
+		fired:     make(map[string]time.Time),
+	}
+}
+
+// Default creates a Manager with all built-in detectors plus any extra
+// detectors the caller configures itself.
+func Default(extra ...Detector) *Manager {
+	return NewManager(append([]Detector{
+		NewARPConflict(),
+		NewARPSpoof(),
+		NewNTLMv1(),
+		NewWPAD(),
+		NewTTLAnomaly(),
+		NewMACFlap(),
+		NewSourceRoute(),
+		NewScan(),
+		NewCleartext(),
+	}, extra...)...)
+}
+
+// Inspect runs every detector over the packet and returns new, deduplicated alerts.
+func (m *Manager) Inspect(pkt gopacket.Packet, info *models.PacketInfo) []models.Alert {
+	ts := pkt.Metadata().Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out []models.Alert
+	// The JA3 fingerprint of a ClientHello that triggers an alert is
+	// recorded as an indicator; parsed lazily since few packets alert.
+	var hello *parser.TLSClientHelloInfo
+	helloDone := false
+	for _, d := range m.detectors {
+		for _, f := range d.Inspect(pkt, info, ts) {
+			if !m.fire(f.Key, ts) {
+				continue
+			}
+
+			m.nextID++
+			a := f.Alert
+			a.ID = m.nextID
+			if a.Timestamp == "" {
+				a.Timestamp = ts.Format("15:04:05")
+			}
+			if a.PktNumber == 0 {
+				a.PktNumber = info.Number
+			}
+			if a.FlowID == 0 {
+				a.FlowID = info.FlowID
+			}
+			if a.Tags == nil {
+				a.Tags = info.Tags
+			}
+			if a.Time.IsZero() {
+				a.Time = ts
+			}
+			if !helloDone {
+				hello, _ = parser.ExtractTLSHello(pkt)
+				helloDone = true
+			}
+			if hello != nil && hello.JA3Hash != "" {
+				a.Indicators = append(a.Indicators, models.Indicator{Type: models.IndicatorJA3, Value: hello.JA3Hash})
+			}
+			m.keep(a)
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// Raise records an alert that is not about a packet, such as a problem
+// with the capture itself, deduplicated like detector findings. ok is false
+// for a repeat.
+func (m *Manager) Raise(f Finding, ts time.Time) (a models.Alert, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.raise(f, ts)
+}
+
+// Stream runs the stream detectors over bytes reassembled by the stream
+// manager, as Inspect runs the detectors over a packet, and returns new,
+// deduplicated alerts. flowID is the flow the stream belongs to.
+func (m *Manager) Stream(id uint64, client, server string, clientPort, serverPort uint16, fromClient bool, data []byte, ts time.Time, flowID uint64) []models.Alert {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	// The detector list is fixed at construction, and stream detectors
+	// lock for themselves so a stream does not hold up packet inspection.
+	var out []models.Alert
+	for _, d := range m.detectors {
+		sd, ok := d.(StreamDetector)
+		if !ok {
+			continue
+		}
+		for _, f := range sd.Stream(id, client, server, clientPort, serverPort, fromClient, data, ts) {
+			if f.Alert.FlowID == 0 {
+				f.Alert.FlowID = flowID
+			}
+			if a, ok := m.Raise(f, ts); ok {
+				out = append(out, a)
+			}
+		}
+	}
+	return out
+}
+
+// raise records an alert for f unless it repeats a recent one. The caller
+// holds m.mu.
+func (m *Manager) raise(f Finding, ts time.Time) (a models.Alert, ok bool) {
+	if !m.fire(f.Key, ts) {
+		return models.Alert{}, false
+	}
+
+	m.nextID++
+	a = f.Alert
+	a.ID = m.nextID
+	if a.Timestamp == "" {
+		a.Timestamp = ts.Format("15:04:05")
+	}
+	if a.Time.IsZero() {
+		a.Time = ts
+	}
+	m.keep(a)
+	return a, true
+}
+
+// fire records that an alert with key is raised at ts, and reports false
+// for a repeat within dedupWindow. Keys older than the window are dropped
+// once per window so the map holds only recent ones. The caller holds
+// m.mu.
+func (m *Manager) fire(key string, ts time.Time) bool {
+	if last, ok := m.fired[key]; ok && ts.Sub(last) < dedupWindow {
+		return false
+	}
+	if ts.Sub(m.pruned) >= dedupWindow {
+		for k, last := range m.fired {
+			if ts.Sub(last) >= dedupWindow {
+				delete(m.fired, k)
+			}
+		}
+		m.pruned = ts
+	}
+	m.fired[key] = ts
+	return true
+}
+
+// keep appends a to the alert log. The caller holds m.mu.
+func (m *Manager) keep(a models.Alert) {
+	if len(m.alerts) >= maxAlerts {
+		m.alerts = append(m.alerts[:0], m.alerts[len(m.alerts)-maxAlerts/2:]...)
+	}
+	m.alerts = append(m.alerts, a)
+}
+
+// ipIndicator returns the indicator for an IPv4 or IPv6 address.
+func ipIndicator(ip string) models.Indicator {
+	if strings.Contains(ip, ":") {
+		return models.Indicator{Type: models.IndicatorIPv6, Value: ip}
+	}
+	return models.Indicator{Type: models.IndicatorIPv4, Value: ip}
+}
+
+// Exclude passes a list of trusted MAC/IP addresses (routers, VRRP/HSRP
+// peers) to every detector that supports exclusions.
+func (m *Manager) Exclude(addrs []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.detectors {
+		if ex, ok := d.(Excluder); ok {
+			ex.Exclude(addrs)
+		}
+	}
+}
+
+// Alerts returns a copy of the alerts raised since the last reset, up to
+// the latest maxAlerts.
+func (m *Manager) Alerts() []models.Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]models.Alert, len(m.alerts))
+	copy(out, m.alerts)
+	return out
+}
+
+// Reset clears the alert log and all detector state.
+func (m *Manager) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.detectors {
+		d.Reset()
+	}
+	m.alerts = nil
+	m.fired = make(map[string]time.Time)
+	m.pruned = time.Time{}
+	m.nextID = 0
+}
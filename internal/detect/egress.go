@@ -0,0 +1,172 @@
+package detect
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/geoip"
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+)
+
+// EgressPolicy lists the destination countries (ISO 3166-1 alpha-2) and
+// autonomous systems internal hosts may talk to. Deny entries always win;
+// when an allow list is non-empty, destinations outside it are violations.
+type EgressPolicy struct {
+	AllowCountries []string `json:"allowCountries"`
+	DenyCountries  []string `json:"denyCountries"`
+	AllowASNs      []uint   `json:"allowAsns"`
+	DenyASNs       []uint   `json:"denyAsns"`
+}
+
+// Empty reports whether the policy has no rules.
+func (p EgressPolicy) Empty() bool {
+	return len(p.AllowCountries) == 0 && len(p.DenyCountries) == 0 && len(p.AllowASNs) == 0 && len(p.DenyASNs) == 0
+}
+
+// violation returns why loc breaks the policy, or "" if it is allowed.
+func (p EgressPolicy) violation(loc geoip.Location) string {
+	for _, c := range p.DenyCountries {
+		if strings.EqualFold(c, loc.Country) {
+			return "country " + loc.Country + " is denied"
+		}
+	}
+	for _, a := range p.DenyASNs {
+		if a == loc.ASN {
+			return fmt.Sprintf("AS%d is denied", loc.ASN)
+		}
+	}
+	if len(p.AllowCountries) > 0 && loc.Country != "" {
+		allowed := false
+		for _, c := range p.AllowCountries {
+			if strings.EqualFold(c, loc.Country) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "country " + loc.Country + " is not in the allow list"
+		}
+	}
+	if len(p.AllowASNs) > 0 && loc.ASN != 0 {
+		allowed := false
+		for _, a := range p.AllowASNs {
+			if a == loc.ASN {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("AS%d is not in the allow list", loc.ASN)
+		}
+	}
+	return ""
+}
+
+// Egress alerts when an internal (private-address) host sends traffic to a
+// public destination whose GeoIP country or ASN the policy disallows.
+type Egress struct {
+	mu      sync.Mutex
+	geo     *geoip.DB
+	policy  EgressPolicy
+	verdict map[string]egressVerdict // dst ip -> cached decision
+}
+
+type egressVerdict struct {
+	loc    geoip.Location
+	reason string // "" = allowed
+}
+
+// NewEgress creates an egress policy detector with an empty policy.
+func NewEgress() *Egress {
+	return &Egress{verdict: make(map[string]egressVerdict)}
+}
+
+// SetGeoIP sets the database used to locate destinations.
+func (d *Egress) SetGeoIP(db *geoip.DB) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.geo = db
+	d.verdict = make(map[string]egressVerdict)
+}
+
+// SetPolicy replaces the egress policy.
+func (d *Egress) SetPolicy(p EgressPolicy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.policy = p
+	d.verdict = make(map[string]egressVerdict)
+}
+
+// Policy returns the current egress policy.
+func (d *Egress) Policy() EgressPolicy {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.policy
+}
+
+// Reset implements Detector. Policy and database are configuration and are kept.
+func (d *Egress) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.verdict = make(map[string]egressVerdict)
+}
+
+// Inspect implements Detector.
+func (d *Egress) Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding {
+	tuple := parser.ExtractFlowTuple(pkt)
+	if !tuple.Valid {
+		return nil
+	}
+	src, dst := net.ParseIP(tuple.SrcIP), net.ParseIP(tuple.DstIP)
+	if src == nil || !src.IsPrivate() || !geoip.IsPublic(dst) {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.geo == nil || d.policy.Empty() {
+		return nil
+	}
+	v, seen := d.verdict[tuple.DstIP]
+	if !seen {
+		v.loc = d.geo.Lookup(dst)
+		v.reason = d.policy.violation(v.loc)
+		if len(d.verdict) >= 50000 {
+			d.verdict = make(map[string]egressVerdict)
+		}
+		d.verdict[tuple.DstIP] = v
+	}
+	if v.reason == "" {
+		return nil
+	}
+	loc := v.loc
+
+	where := loc.Country
+	if loc.CountryName != "" {
+		where = loc.CountryName + " (" + loc.Country + ")"
+	}
+	if loc.ASN != 0 {
+		where += fmt.Sprintf(", AS%d %s", loc.ASN, loc.ASOrg)
+	}
+	dstAddr := tuple.DstIP
+	if tuple.DstPort != 0 {
+		dstAddr = fmt.Sprintf("%s:%d", tuple.DstIP, tuple.DstPort)
+	}
+	return []Finding{{
+		Key: "egress:" + tuple.SrcIP + ":" + tuple.DstIP,
+		Alert: models.Alert{
+			Severity:   "high",
+			Type:       "egress_policy",
+			Title:      "Egress Policy Violation",
+			Detail:     fmt.Sprintf("%s sent %s traffic to %s in %s — %s", tuple.SrcIP, tuple.Protocol, dstAddr, where, v.reason),
+			SrcIP:      tuple.SrcIP,
+			Indicators: []models.Indicator{ipIndicator(tuple.DstIP)},
+		},
+	}}
+}
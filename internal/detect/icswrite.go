@@ -0,0 +1,73 @@
+package detect
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/icsstats"
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+)
+
+// ICSWrite flags state-changing industrial protocol requests: Modbus coil
+// and register writes, DNP3 operate/write commands and S7 variable writes
+// from hosts outside the allowed writer list, plus restarts, PLC stops and
+// program downloads from anyone.
+type ICSWrite struct {
+	writers *icsstats.Tracker
+}
+
+// NewICSWrite creates an ICS write detector that checks clients against
+// the writer list held by the ICS statistics tracker.
+func NewICSWrite(writers *icsstats.Tracker) *ICSWrite {
+	return &ICSWrite{writers: writers}
+}
+
+// Reset implements Detector.
+func (d *ICSWrite) Reset() {}
+
+// Inspect implements Detector.
+func (d *ICSWrite) Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding {
+	op := parser.ExtractICS(pkt)
+	if op == nil || op.Response || !op.Write {
+		return nil
+	}
+
+	target := op.Server
+	if op.Unit != "" {
+		target += " unit " + op.Unit
+	}
+	detail := fmt.Sprintf("%s sent %s %s to %s", op.Client, op.Protocol, op.Function, target)
+	if len(op.Targets) > 0 {
+		detail += " (" + strings.Join(op.Targets, ", ") + ")"
+	}
+
+	if op.Critical {
+		return []Finding{{
+			Key: "ics-critical:" + op.Client + ":" + target + ":" + op.Function,
+			Alert: models.Alert{
+				Severity: "high",
+				Type:     "ics_critical",
+				Title:    "ICS Control Operation",
+				Detail:   detail + "; restarts, stops and program transfers interrupt the process",
+				SrcIP:    op.Client,
+			},
+		}}
+	}
+	if d.writers.Authorized(op.Client) {
+		return nil
+	}
+	return []Finding{{
+		Key: "ics-write:" + op.Client + ":" + target,
+		Alert: models.Alert{
+			Severity: "medium",
+			Type:     "ics_write",
+			Title:    "Unexpected ICS Write",
+			Detail:   detail + "; the client is not in the allowed writer list",
+			SrcIP:    op.Client,
+		},
+	}}
+}
@@ -0,0 +1,223 @@
+package detect
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+const (
+	// flapWindow is the period over which MAC moves are counted.
+	flapWindow = 60 * time.Second
+	// flapThreshold is how many moves within flapWindow count as flapping.
+	flapThreshold = 3
+	// multiIPWindow is how long an IP stays associated with a MAC.
+	multiIPWindow = 5 * time.Minute
+	// multiIPThreshold is how many IPs one MAC may claim before alerting.
+	multiIPThreshold = 10
+)
+
+// Virtual router MAC prefixes: VRRP (IPv4/IPv6), HSRP v1/v2 and GLBP
+// legitimately move between physical routers or answer for many addresses.
+var virtualRouterMACPrefixes = []string{
+	"00:00:5e:00:01:",
+	"00:00:5e:00:02:",
+	"00:00:0c:07:ac:",
+	"00:00:0c:9f:f",
+	"00:07:b4:00:",
+}
+
+// Excluder is implemented by detectors that accept a list of trusted MAC
+// or IP addresses to ignore.
+type Excluder interface {
+	Exclude(addrs []string)
+}
+
+type macBinding struct {
+	mac   string
+	moves []time.Time
+	macs  map[string]bool
+}
+
+// MACFlap detects an IP address or hostname migrating between MAC
+// addresses repeatedly (spoofing, a loop, or port flapping) and a single
+// MAC claiming many IP addresses. Bindings are learned from ARP, IPv6
+// neighbor advertisements and DHCP hostnames.
+type MACFlap struct {
+	bindings map[string]*macBinding          // "ip" or "host:<name>" -> binding
+	macIPs   map[string]map[string]time.Time // mac -> ip -> last claim
+	excluded map[string]bool
+}
+
+// NewMACFlap creates a MAC spoofing / port flapping detector.
+func NewMACFlap() *MACFlap {
+	d := &MACFlap{excluded: make(map[string]bool)}
+	d.Reset()
+	return d
+}
+
+// Reset implements Detector. The exclusion list is configuration and is kept.
+func (d *MACFlap) Reset() {
+	d.bindings = make(map[string]*macBinding)
+	d.macIPs = make(map[string]map[string]time.Time)
+}
+
+// Exclude implements Excluder.
+func (d *MACFlap) Exclude(addrs []string) {
+	d.excluded = make(map[string]bool)
+	for _, a := range addrs {
+		a = strings.TrimSpace(a)
+		if mac, err := net.ParseMAC(a); err == nil {
+			d.excluded[mac.String()] = true
+		} else if ip := net.ParseIP(a); ip != nil {
+			d.excluded[ip.String()] = true
+		}
+	}
+}
+
+// Inspect implements Detector.
+func (d *MACFlap) Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding {
+	if arpLayer := pkt.Layer(layers.LayerTypeARP); arpLayer != nil {
+		arp := arpLayer.(*layers.ARP)
+		if len(arp.SourceProtAddress) != 4 {
+			return nil
+		}
+		ip := net.IP(arp.SourceProtAddress)
+		if ip.IsUnspecified() {
+			return nil
+		}
+		return d.observe(ip.String(), ip.String(), net.HardwareAddr(arp.SourceHwAddress).String(), ts)
+	}
+
+	if naLayer := pkt.Layer(layers.LayerTypeICMPv6NeighborAdvertisement); naLayer != nil {
+		na := naLayer.(*layers.ICMPv6NeighborAdvertisement)
+		for _, opt := range na.Options {
+			if opt.Type == layers.ICMPv6OptTargetAddress && len(opt.Data) == 6 {
+				ip := na.TargetAddress.String()
+				return d.observe(ip, ip, net.HardwareAddr(opt.Data).String(), ts)
+			}
+		}
+		return nil
+	}
+
+	if dhcpLayer := pkt.Layer(layers.LayerTypeDHCPv4); dhcpLayer != nil {
+		dhcp := dhcpLayer.(*layers.DHCPv4)
+		if dhcp.Operation != layers.DHCPOpRequest {
+			return nil
+		}
+		for _, opt := range dhcp.Options {
+			if opt.Type == layers.DHCPOptHostname && len(opt.Data) > 0 {
+				name := strings.ToLower(strings.TrimRight(string(opt.Data), "\x00"))
+				return d.observe("host:"+name, "", dhcp.ClientHWAddr.String(), ts)
+			}
+		}
+	}
+	return nil
+}
+
+// observe records that mac claimed key (an IP, or a hostname with ip empty).
+func (d *MACFlap) observe(key, ip, mac string, ts time.Time) []Finding {
+	if d.trusted(mac, ip) {
+		return nil
+	}
+
+	var findings []Finding
+	b, ok := d.bindings[key]
+	if !ok {
+		d.bindings[key] = &macBinding{mac: mac, macs: map[string]bool{mac: true}}
+	} else if b.mac != mac {
+		b.mac = mac
+		b.macs[mac] = true
+		b.moves = append(b.moves, ts)
+		for len(b.moves) > 0 && ts.Sub(b.moves[0]) > flapWindow {
+			b.moves = b.moves[1:]
+		}
+		if len(b.moves) >= flapThreshold {
+			findings = append(findings, flapFinding(key, b))
+		}
+	}
+
+	if ip == "" {
+		return findings
+	}
+	ips := d.macIPs[mac]
+	if ips == nil {
+		ips = make(map[string]time.Time)
+		d.macIPs[mac] = ips
+	}
+	ips[ip] = ts
+	for other, last := range ips {
+		if ts.Sub(last) > multiIPWindow {
+			delete(ips, other)
+		}
+	}
+	if len(ips) >= multiIPThreshold {
+		findings = append(findings, Finding{
+			Key: "mac_multi_ip:" + mac,
+			Alert: models.Alert{
+				Severity: "medium",
+				Type:     "mac_multi_ip",
+				Title:    "MAC Claiming Many IPs",
+				Detail: fmt.Sprintf("%s claimed %d IP addresses in the last %s (%s) — ARP spoofing or an unlisted router/proxy-ARP device",
+					mac, len(ips), multiIPWindow, sampleIPs(ips, 8)),
+				SrcIP: ip,
+			},
+		})
+	}
+	return findings
+}
+
+func (d *MACFlap) trusted(mac, ip string) bool {
+	if d.excluded[mac] || (ip != "" && d.excluded[ip]) {
+		return true
+	}
+	for _, p := range virtualRouterMACPrefixes {
+		if strings.HasPrefix(mac, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func flapFinding(key string, b *macBinding) Finding {
+	macs := make([]string, 0, len(b.macs))
+	for m := range b.macs {
+		macs = append(macs, m)
+	}
+	sort.Strings(macs)
+
+	subject, srcIP := key, key
+	if name, ok := strings.CutPrefix(key, "host:"); ok {
+		subject, srcIP = "Hostname "+name, ""
+	}
+	return Finding{
+		Key: "mac_flap:" + key,
+		Alert: models.Alert{
+			Severity: "high",
+			Type:     "mac_flap",
+			Title:    "MAC Address Flapping",
+			Detail: fmt.Sprintf("%s moved between MACs %d times within %s (now %s; seen on %s) — MAC spoofing, a bridging loop or port flapping",
+				subject, len(b.moves), flapWindow, b.mac, strings.Join(macs, ", ")),
+			SrcIP: srcIP,
+		},
+	}
+}
+
+func sampleIPs(ips map[string]time.Time, n int) string {
+	list := make([]string, 0, len(ips))
+	for ip := range ips {
+		list = append(list, ip)
+	}
+	sort.Strings(list)
+	if len(list) > n {
+		return strings.Join(list[:n], ", ") + fmt.Sprintf(", +%d more", len(list)-n)
+	}
+	return strings.Join(list, ", ")
+}
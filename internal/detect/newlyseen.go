@@ -0,0 +1,256 @@
+package detect
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/dnsstats"
+	"sniffox/internal/geoip"
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+)
+
+const (
+	maxSeenEntries   = 200000
+	seenSaveInterval = time.Minute
+	// seenTouchInterval limits how often a known entry's last-seen time
+	// is refreshed, so steady traffic doesn't rewrite the memory file.
+	seenTouchInterval = time.Hour
+)
+
+// NewlySeenConfig controls the newly-observed domain and host detector.
+type NewlySeenConfig struct {
+	Domains       bool     `json:"domains"`          // alert on new registrable domains looked up over DNS
+	IPs           bool     `json:"ips"`              // alert on new public IPs contacted
+	Groups        []string `json:"groups,omitempty"` // only alert for clients in these host groups; empty = every client
+	RetentionDays int      `json:"retentionDays"`    // forget entries not seen for this long
+	LearningHours int      `json:"learningHours"`    // record without alerting for this long after the memory is created
+}
+
+// DefaultNewlySeenConfig watches both domains and IPs for every client and
+// learns for a day before alerting.
+func DefaultNewlySeenConfig() NewlySeenConfig {
+	return NewlySeenConfig{Domains: true, IPs: true, RetentionDays: 30, LearningHours: 24}
+}
+
+// seenMemory is the on-disk form of the rolling memory.
+type seenMemory struct {
+	Created time.Time        `json:"created"`
+	Entries map[string]int64 `json:"entries"` // "d:example.com" / "ip:1.2.3.4" -> last seen, unix seconds
+}
+
+// NewlySeen raises a low-severity alert the first time an internal host
+// looks up a registrable domain or contacts a public IP that this
+// deployment has not seen within the retention window. The memory outlives
+// captures and, with a file configured, restarts.
+type NewlySeen struct {
+	mu       sync.Mutex
+	cfg      NewlySeenConfig
+	mem      seenMemory
+	path     string
+	dirty    bool
+	lastSave time.Time
+	saving   bool
+}
+
+// NewNewlySeen creates the detector with the default configuration and an
+// empty in-memory store.
+func NewNewlySeen() *NewlySeen {
+	return &NewlySeen{
+		cfg: DefaultNewlySeenConfig(),
+		mem: seenMemory{Entries: make(map[string]int64)},
+	}
+}
+
+// Load reads the memory from path, if it exists, and persists to it from
+// then on.
+func (d *NewlySeen) Load(path string) error {
+	mem := seenMemory{Entries: make(map[string]int64)}
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &mem); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if mem.Entries == nil {
+			mem.Entries = make(map[string]int64)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.path = path
+	d.mem = mem
+	d.prune(time.Now())
+	return nil
+}
+
+// Config returns the current configuration.
+func (d *NewlySeen) Config() NewlySeenConfig {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cfg
+}
+
+// SetConfig replaces the configuration.
+func (d *NewlySeen) SetConfig(cfg NewlySeenConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cfg = cfg
+}
+
+// Counts returns how many domains and IPs the memory holds and when it
+// started learning.
+func (d *NewlySeen) Counts() (domains, ips int, since time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for k := range d.mem.Entries {
+		if strings.HasPrefix(k, "d:") {
+			domains++
+		} else {
+			ips++
+		}
+	}
+	return domains, ips, d.mem.Created
+}
+
+// Reset implements Detector. The memory spans captures and is kept.
+func (d *NewlySeen) Reset() {}
+
+// Inspect implements Detector.
+func (d *NewlySeen) Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding {
+	tuple := parser.ExtractFlowTuple(pkt)
+	if !tuple.Valid {
+		return nil
+	}
+	src, dst := net.ParseIP(tuple.SrcIP), net.ParseIP(tuple.DstIP)
+	if src == nil || !src.IsPrivate() {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cfg := d.cfg
+	if len(cfg.Groups) > 0 && !slices.ContainsFunc(info.Tags, func(t string) bool { return slices.Contains(cfg.Groups, t) }) {
+		return nil
+	}
+	if d.mem.Created.IsZero() {
+		d.mem.Created = ts
+	}
+	learning := ts.Sub(d.mem.Created) < time.Duration(cfg.LearningHours)*time.Hour
+
+	var out []Finding
+	if cfg.IPs && geoip.IsPublic(dst) && d.observe("ip:"+tuple.DstIP, ts) && !learning {
+		out = append(out, Finding{
+			Key: "newly-seen-ip:" + tuple.DstIP,
+			Alert: models.Alert{
+				Severity:   "low",
+				Type:       "newly_seen_ip",
+				Title:      "Newly Observed Host",
+				Detail:     fmt.Sprintf("%s contacted %s over %s, a public address not seen on this network in the last %d days", tuple.SrcIP, tuple.DstIP, tuple.Protocol, cfg.RetentionDays),
+				SrcIP:      tuple.SrcIP,
+				Indicators: []models.Indicator{ipIndicator(tuple.DstIP)},
+			},
+		})
+	}
+	if cfg.Domains {
+		if l := pkt.Layer(layers.LayerTypeDNS); l != nil && !l.(*layers.DNS).QR {
+			for _, q := range l.(*layers.DNS).Questions {
+				name := strings.TrimSuffix(strings.ToLower(string(q.Name)), ".")
+				base := dnsstats.BaseDomain(name)
+				if !strings.Contains(base, ".") || strings.HasSuffix(base, ".local") || strings.HasSuffix(base, ".arpa") {
+					continue
+				}
+				if d.observe("d:"+base, ts) && !learning {
+					out = append(out, Finding{
+						Key: "newly-seen-domain:" + base,
+						Alert: models.Alert{
+							Severity:   "low",
+							Type:       "newly_seen_domain",
+							Title:      "Newly Observed Domain",
+							Detail:     fmt.Sprintf("%s looked up %s; %s has not been seen on this network in the last %d days", tuple.SrcIP, name, base, cfg.RetentionDays),
+							SrcIP:      tuple.SrcIP,
+							Indicators: []models.Indicator{{Type: models.IndicatorDomain, Value: base}},
+						},
+					})
+				}
+			}
+		}
+	}
+	d.maybeSave()
+	return out
+}
+
+// observe records key as seen at ts and reports whether it was new.
+// Callers hold d.mu.
+func (d *NewlySeen) observe(key string, ts time.Time) bool {
+	now := ts.Unix()
+	last, ok := d.mem.Entries[key]
+	retention := int64(d.cfg.RetentionDays) * 86400
+	isNew := !ok || (retention > 0 && now-last > retention)
+	if isNew || now-last > int64(seenTouchInterval/time.Second) {
+		if !ok && len(d.mem.Entries) >= maxSeenEntries {
+			d.prune(ts)
+			if len(d.mem.Entries) >= maxSeenEntries {
+				return false
+			}
+		}
+		d.mem.Entries[key] = now
+		d.dirty = true
+	}
+	return isNew
+}
+
+// prune drops entries older than the retention window. Callers hold d.mu.
+func (d *NewlySeen) prune(now time.Time) {
+	if d.cfg.RetentionDays <= 0 {
+		return
+	}
+	cutoff := now.Unix() - int64(d.cfg.RetentionDays)*86400
+	for k, last := range d.mem.Entries {
+		if last < cutoff {
+			delete(d.mem.Entries, k)
+			d.dirty = true
+		}
+	}
+}
+
+// maybeSave writes the memory file in the background at most once per
+// seenSaveInterval. Callers hold d.mu.
+func (d *NewlySeen) maybeSave() {
+	if d.path == "" || !d.dirty || d.saving || time.Since(d.lastSave) < seenSaveInterval {
+		return
+	}
+	data, err := json.Marshal(d.mem)
+	if err != nil {
+		return
+	}
+	d.dirty, d.saving, d.lastSave = false, true, time.Now()
+	path := d.path
+	go func() {
+		tmp := path + ".tmp"
+		err := os.WriteFile(tmp, data, 0o644)
+		if err == nil {
+			err = os.Rename(tmp, path)
+		}
+		if err != nil {
+			log.Printf("Saving newly-seen memory: %v", err)
+		}
+		d.mu.Lock()
+		d.saving = false
+		d.mu.Unlock()
+	}()
+}
@@ -0,0 +1,57 @@
+package detect
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+)
+
+// NTLMv1 flags authentications that use the legacy NTLMv1 (or LM) response,
+// which can be cracked or relayed far more easily than NTLMv2.
+type NTLMv1 struct{}
+
+// NewNTLMv1 creates an NTLMv1 usage detector.
+func NewNTLMv1() *NTLMv1 {
+	return &NTLMv1{}
+}
+
+// Reset implements Detector.
+func (d *NTLMv1) Reset() {}
+
+// Inspect implements Detector.
+func (d *NTLMv1) Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding {
+	ntlm := parser.ExtractNTLM(pkt)
+	if ntlm == nil || ntlm.MessageType != 3 || ntlm.NTLMVersion != "NTLMv1" {
+		return nil
+	}
+
+	tuple := parser.ExtractFlowTuple(pkt)
+	account := ntlm.User
+	if ntlm.Domain != "" {
+		account = ntlm.Domain + `\` + ntlm.User
+	}
+	carrier := "SMB"
+	if ntlm.HTTPCarried {
+		carrier = "HTTP"
+	}
+	detail := fmt.Sprintf("%s authenticated as %s from workstation %q to %s over %s using NTLMv1",
+		tuple.SrcIP, account, ntlm.Workstation, tuple.DstIP, carrier)
+	if ntlm.Flags&0x00080000 != 0 {
+		detail += " (NTLM2 session response)"
+	}
+
+	return []Finding{{
+		Key: "ntlmv1:" + tuple.SrcIP + ":" + account,
+		Alert: models.Alert{
+			Severity: "high",
+			Type:     "ntlmv1",
+			Title:    "NTLMv1 Authentication",
+			Detail:   detail,
+			SrcIP:    tuple.SrcIP,
+		},
+	}}
+}
@@ -0,0 +1,102 @@
+package detect
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+	"sniffox/internal/ntpstats"
+	"sniffox/internal/parser"
+)
+
+// ntpFarOffset is the offset from the capture clock beyond which a server
+// reply is reported even without a previous reply to compare against.
+const ntpFarOffset = time.Hour
+
+// NTPRogue flags NTP replies from time servers outside the configured list
+// and servers whose advertised time jumps between replies or is far from
+// the capture clock — the footprint of a rogue or hijacked time source.
+type NTPRogue struct {
+	servers *ntpstats.Tracker
+	offsets map[string]float64 // server -> last offset, ms
+}
+
+// NewNTPRogue creates an NTP detector that checks servers against the list
+// held by the NTP statistics tracker.
+func NewNTPRogue(servers *ntpstats.Tracker) *NTPRogue {
+	d := &NTPRogue{servers: servers}
+	d.Reset()
+	return d
+}
+
+// Reset implements Detector.
+func (d *NTPRogue) Reset() {
+	d.offsets = make(map[string]float64)
+}
+
+// Inspect implements Detector.
+func (d *NTPRogue) Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding {
+	ex := parser.ExtractNTP(pkt)
+	if ex == nil || !ex.Response {
+		return nil
+	}
+
+	var out []Finding
+	if !d.servers.Allowed(ex.Server) {
+		out = append(out, Finding{
+			Key: "ntp-rogue:" + ex.Server + ":" + ex.Client,
+			Alert: models.Alert{
+				Severity:   "medium",
+				Type:       "ntp_rogue",
+				Title:      "Unexpected NTP Server",
+				Detail:     fmt.Sprintf("%s received time from %s (stratum %d), which is not in the allowed time server list", ex.Client, ex.Server, ex.Stratum),
+				SrcIP:      ex.Server,
+				Indicators: []models.Indicator{ipIndicator(ex.Server)},
+			},
+		})
+	}
+	if !ex.HasOffset {
+		return out
+	}
+
+	prev, seen := d.offsets[ex.Server]
+	d.offsets[ex.Server] = ex.OffsetMs
+	switch {
+	case seen && math.Abs(ex.OffsetMs-prev) >= ntpstats.StepThresholdMs:
+		out = append(out, Finding{
+			Key: "ntp-step:" + ex.Server,
+			Alert: models.Alert{
+				Severity: "medium",
+				Type:     "ntp_step",
+				Title:    "Large NTP Time Step",
+				Detail: fmt.Sprintf("%s's clock moved from %s to %s relative to the capture clock in its reply to %s",
+					ex.Server, fmtOffset(prev), fmtOffset(ex.OffsetMs), ex.Client),
+				SrcIP: ex.Server,
+			},
+		})
+	case !seen && math.Abs(ex.OffsetMs) >= float64(ntpFarOffset/time.Millisecond):
+		out = append(out, Finding{
+			Key: "ntp-far:" + ex.Server,
+			Alert: models.Alert{
+				Severity: "high",
+				Type:     "ntp_step",
+				Title:    "NTP Server Time Far Off",
+				Detail: fmt.Sprintf("%s told %s the time is %s off the capture clock",
+					ex.Server, ex.Client, fmtOffset(ex.OffsetMs)),
+				SrcIP: ex.Server,
+			},
+		})
+	}
+	return out
+}
+
+func fmtOffset(ms float64) string {
+	d := time.Duration(ms * float64(time.Millisecond)).Round(time.Millisecond)
+	if d >= 0 {
+		return "+" + d.String()
+	}
+	return d.String()
+}
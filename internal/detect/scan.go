@@ -0,0 +1,332 @@
+package detect
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+const (
+	// scanWindow is the period over which a source's probes are counted.
+	scanWindow = 60 * time.Second
+	// scanPortThreshold is how many ports of one host a source may probe
+	// within scanWindow before it is a vertical scan.
+	scanPortThreshold = 25
+	// scanHostThreshold is how many hosts a source may probe on one port
+	// within scanWindow before it is a horizontal scan.
+	scanHostThreshold = 25
+	// maxProbesPerSource bounds the probes kept per source; the oldest
+	// are dropped.
+	maxProbesPerSource = 2048
+
+	// floodWindow is the period over which SYNs to a service are counted,
+	// in whole seconds.
+	floodWindow = 10 * time.Second
+	// floodSYNThreshold is how many SYNs a service may receive within
+	// floodWindow before the SYN:SYN-ACK ratio is checked.
+	floodSYNThreshold = 200
+	// floodRatio is the SYN:SYN-ACK ratio at which a service is flooded.
+	floodRatio = 4
+	// maxFloodSources bounds the sources counted per flooded service.
+	maxFloodSources = 1024
+
+	// maxScanEntries bounds the probes and services tracked before idle
+	// ones are swept.
+	maxScanEntries = 65536
+)
+
+// scanProbe is a TCP flow a source opened with a SYN. It stops counting
+// as a probe once the source sends data on it.
+type scanProbe struct {
+	src, dst string
+	port     uint16
+	at       time.Time
+	data     bool
+}
+
+// windowCounter counts events over floodWindow in one-second buckets.
+type windowCounter struct {
+	secs   [floodWindow / time.Second]int64
+	counts [floodWindow / time.Second]int
+}
+
+func (c *windowCounter) add(ts time.Time) {
+	s := ts.Unix()
+	i := s % int64(len(c.secs))
+	if c.secs[i] != s {
+		c.secs[i], c.counts[i] = s, 0
+	}
+	c.counts[i]++
+}
+
+func (c *windowCounter) sum(ts time.Time) int {
+	s, n := ts.Unix(), 0
+	for i, sec := range c.secs {
+		if sec <= s && s-sec < int64(len(c.secs)) {
+			n += c.counts[i]
+		}
+	}
+	return n
+}
+
+// synService counts the SYNs a service receives and the SYN-ACKs it
+// answers with.
+type synService struct {
+	syn, synAck windowCounter
+	sources     map[string]int // SYNs per source since the service was last idle
+	others      int            // SYNs from sources past maxFloodSources
+}
+
+// Scan detects port scans and SYN floods from TCP flows. A probe is a flow
+// opened with a SYN on which the initiator sends no data, as in SYN,
+// connect and closed-port scans; a source probing many ports of one host
+// is a vertical scan and one probing one port on many hosts a horizontal
+// scan. A service receiving many SYNs but answering few of them with
+// SYN-ACKs is being SYN flooded.
+type Scan struct {
+	probes   map[uint64]*scanProbe  // flow ID -> probe
+	sources  map[string][]uint64    // source -> its probes' flow IDs, oldest first
+	services map[string]*synService // "ip:port" -> SYN counts
+}
+
+// NewScan creates a port scan and SYN flood detector.
+func NewScan() *Scan {
+	d := &Scan{}
+	d.Reset()
+	return d
+}
+
+// Reset implements Detector.
+func (d *Scan) Reset() {
+	d.probes = make(map[uint64]*scanProbe)
+	d.sources = make(map[string][]uint64)
+	d.services = make(map[string]*synService)
+}
+
+// Inspect implements Detector.
+func (d *Scan) Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding {
+	tcpLayer := pkt.Layer(layers.LayerTypeTCP)
+	nl := pkt.NetworkLayer()
+	if tcpLayer == nil || nl == nil || info.FlowID == 0 {
+		return nil
+	}
+	tcp := tcpLayer.(*layers.TCP)
+	srcEP, dstEP := nl.NetworkFlow().Endpoints()
+	src, dst := net.IP(srcEP.Raw()).String(), net.IP(dstEP.Raw()).String()
+
+	switch {
+	case tcp.SYN && !tcp.ACK:
+		var findings []Finding
+		if _, ok := d.probes[info.FlowID]; !ok {
+			if len(d.probes) >= maxScanEntries {
+				d.sweep(ts)
+			}
+			p := &scanProbe{src: src, dst: dst, port: uint16(tcp.DstPort), at: ts}
+			d.probes[info.FlowID] = p
+			ids := append(d.sources[src], info.FlowID)
+			if len(ids) > maxProbesPerSource {
+				ids = ids[len(ids)-maxProbesPerSource:]
+			}
+			d.sources[src] = ids
+			findings = d.checkScan(src, p, ts)
+		}
+		if f, ok := d.countSYN(src, dst, uint16(tcp.DstPort), ts); ok {
+			findings = append(findings, f)
+		}
+		return findings
+	case tcp.SYN && tcp.ACK:
+		if s := d.services[serviceKey(src, uint16(tcp.SrcPort))]; s != nil {
+			s.synAck.add(ts)
+		}
+	case len(tcp.Payload) > 0:
+		if p := d.probes[info.FlowID]; p != nil && p.src == src {
+			p.data = true
+		}
+	}
+	return nil
+}
+
+// checkScan reports a scan by src once its newest probe, p, makes the
+// ports it probed on p's host or the hosts it probed on p's port within
+// scanWindow reach their threshold.
+func (d *Scan) checkScan(src string, p *scanProbe, ts time.Time) []Finding {
+	ids := d.sources[src]
+	for len(ids) > 0 {
+		if q := d.probes[ids[0]]; q != nil && ts.Sub(q.at) <= scanWindow {
+			break
+		}
+		ids = ids[1:]
+	}
+	d.sources[src] = ids
+	if len(ids) < min(scanPortThreshold, scanHostThreshold) {
+		return nil
+	}
+
+	ports := make(map[uint16]bool)
+	hosts := make(map[string]time.Time)
+	for _, id := range ids {
+		q := d.probes[id]
+		if q == nil || q.data {
+			continue
+		}
+		if q.dst == p.dst {
+			ports[q.port] = true
+		}
+		if q.port == p.port {
+			hosts[q.dst] = q.at
+		}
+	}
+
+	var findings []Finding
+	if len(ports) >= scanPortThreshold {
+		findings = append(findings, Finding{
+			Key: "port_scan:" + src + ">" + p.dst,
+			Alert: models.Alert{
+				Severity: "medium",
+				Type:     "port_scan",
+				Title:    "Vertical Port Scan",
+				Detail: fmt.Sprintf("%s probed %d ports on %s within %s without sending data (%s)",
+					src, len(ports), p.dst, scanWindow, samplePorts(ports, 10)),
+				SrcIP: src,
+			},
+		})
+	}
+	if len(hosts) >= scanHostThreshold {
+		findings = append(findings, Finding{
+			Key: "port_scan:" + src + ">*:" + strconv.Itoa(int(p.port)),
+			Alert: models.Alert{
+				Severity: "medium",
+				Type:     "port_scan",
+				Title:    "Horizontal Port Scan",
+				Detail: fmt.Sprintf("%s probed port %d on %d hosts within %s without sending data (%s)",
+					src, p.port, len(hosts), scanWindow, sampleIPs(hosts, 8)),
+				SrcIP: src,
+			},
+		})
+	}
+	return findings
+}
+
+// countSYN records a SYN from src to dst:port and reports a flood once the
+// service has received floodSYNThreshold SYNs within floodWindow and
+// answered fewer than one in floodRatio.
+func (d *Scan) countSYN(src, dst string, port uint16, ts time.Time) (Finding, bool) {
+	key := serviceKey(dst, port)
+	s := d.services[key]
+	if s == nil {
+		if len(d.services) >= maxScanEntries {
+			d.sweep(ts)
+		}
+		s = &synService{}
+		d.services[key] = s
+	}
+	if s.syn.sum(ts) == 0 {
+		s.sources, s.others = make(map[string]int), 0
+	}
+	s.syn.add(ts)
+	if _, ok := s.sources[src]; ok || len(s.sources) < maxFloodSources {
+		s.sources[src]++
+	} else {
+		s.others++
+	}
+
+	syns, synAcks := s.syn.sum(ts), s.synAck.sum(ts)
+	if syns < floodSYNThreshold || synAcks*floodRatio > syns {
+		return Finding{}, false
+	}
+	return Finding{
+		Key: "syn_flood:" + key,
+		Alert: models.Alert{
+			Severity: "high",
+			Type:     "syn_flood",
+			Title:    "SYN Flood",
+			Detail: fmt.Sprintf("%s received %d SYNs within %s and answered %d with SYN-ACK, from %s",
+				key, syns, floodWindow, synAcks, describeSources(s)),
+			SrcIP: dst,
+		},
+	}, true
+}
+
+// sweep drops probes older than scanWindow and services idle for
+// floodWindow. Tables still half full, as in a flood from spoofed sources,
+// are cleared so that sweeps stay rare.
+func (d *Scan) sweep(ts time.Time) {
+	for id, p := range d.probes {
+		if ts.Sub(p.at) > scanWindow {
+			delete(d.probes, id)
+		}
+	}
+	for src, ids := range d.sources {
+		if len(ids) == 0 || d.probes[ids[len(ids)-1]] == nil {
+			delete(d.sources, src)
+		}
+	}
+	for key, s := range d.services {
+		if s.syn.sum(ts) == 0 && s.synAck.sum(ts) == 0 {
+			delete(d.services, key)
+		}
+	}
+	if len(d.probes) >= maxScanEntries/2 {
+		d.probes = make(map[uint64]*scanProbe)
+		d.sources = make(map[string][]uint64)
+	}
+	if len(d.services) >= maxScanEntries/2 {
+		d.services = make(map[string]*synService)
+	}
+}
+
+func serviceKey(ip string, port uint16) string {
+	return net.JoinHostPort(ip, strconv.Itoa(int(port)))
+}
+
+func samplePorts(ports map[uint16]bool, n int) string {
+	list := make([]int, 0, len(ports))
+	for p := range ports {
+		list = append(list, int(p))
+	}
+	sort.Ints(list)
+	parts := make([]string, 0, n+1)
+	for i, p := range list {
+		if i == n {
+			parts = append(parts, fmt.Sprintf("+%d more", len(list)-n))
+			break
+		}
+		parts = append(parts, strconv.Itoa(p))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeSources names the busiest sources of SYNs to a service.
+func describeSources(s *synService) string {
+	type count struct {
+		src string
+		n   int
+	}
+	list := make([]count, 0, len(s.sources))
+	for src, n := range s.sources {
+		list = append(list, count{src, n})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].n != list[j].n {
+			return list[i].n > list[j].n
+		}
+		return list[i].src < list[j].src
+	})
+	distinct := fmt.Sprintf("%d sources", len(list))
+	if s.others > 0 {
+		distinct = fmt.Sprintf("over %d sources", len(list))
+	}
+	top := make([]string, 0, 3)
+	for _, c := range list[:min(3, len(list))] {
+		top = append(top, fmt.Sprintf("%s (%d)", c.src, c.n))
+	}
+	return distinct + ", busiest " + strings.Join(top, ", ")
+}
@@ -0,0 +1,79 @@
+package detect
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+	"sniffox/internal/rules"
+)
+
+// Signatures raises an alert for each match of a Suricata-style rule set.
+// Alerts name the rule by gid:sid:rev and list the packets that carried
+// the matched bytes, which for a TCP rule can be several segments.
+type Signatures struct {
+	engine *rules.Engine
+}
+
+// NewSignatures creates a detector matching packets against the rules
+// loaded into engine.
+func NewSignatures(engine *rules.Engine) *Signatures {
+	return &Signatures{engine: engine}
+}
+
+// Reset implements Detector.
+func (d *Signatures) Reset() {
+	d.engine.Reset()
+}
+
+// Inspect implements Detector.
+func (d *Signatures) Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding {
+	matches := d.engine.Match(pkt, info)
+	if len(matches) == 0 {
+		return nil
+	}
+	tuple := parser.ExtractFlowTuple(pkt)
+	src := tuple.SrcIP + ":" + strconv.Itoa(int(tuple.SrcPort))
+	dst := tuple.DstIP + ":" + strconv.Itoa(int(tuple.DstPort))
+	var out []Finding
+	for _, m := range matches {
+		r := m.Rule
+		title := r.Msg
+		if title == "" {
+			title = fmt.Sprintf("Signature %d matched", r.SID)
+		}
+		nums := make([]string, len(m.Packets))
+		for i, n := range m.Packets {
+			nums[i] = strconv.Itoa(n)
+		}
+		detail := fmt.Sprintf("[%s] %s → %s %s", r.ID(), src, dst, strings.ToUpper(tuple.Protocol))
+		if r.Classtype != "" {
+			detail += " (" + r.Classtype + ")"
+		}
+		if len(nums) == 1 {
+			detail += ", matched in packet " + nums[0]
+		} else {
+			detail += ", matched in packets " + strings.Join(nums, ", ")
+		}
+		out = append(out, Finding{
+			Key: "signature:" + r.ID() + ":" + src + ">" + dst,
+			Alert: models.Alert{
+				Severity:   r.Severity(),
+				Type:       "signature",
+				Title:      title,
+				Detail:     detail,
+				PktNumber:  m.Packets[len(m.Packets)-1],
+				SrcIP:      tuple.SrcIP,
+				RuleID:     r.ID(),
+				Packets:    m.Packets,
+				Indicators: []models.Indicator{ipIndicator(tuple.SrcIP)},
+			},
+		})
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package detect
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+)
+
+// SourceRoute flags IPv4 packets carrying a loose or strict source route
+// option. Source routing lets the sender pick the path its packets and
+// the replies take, which is used to slip past filters or to spoof a
+// trusted address and still see the answers; legitimate traffic has not
+// used it for decades and most routers drop it.
+type SourceRoute struct{}
+
+// NewSourceRoute creates a source-routing detector.
+func NewSourceRoute() *SourceRoute {
+	return &SourceRoute{}
+}
+
+// Reset implements Detector.
+func (d *SourceRoute) Reset() {}
+
+// Inspect implements Detector.
+func (d *SourceRoute) Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding {
+	ip, ok := pkt.NetworkLayer().(*layers.IPv4)
+	if !ok || ip.IHL <= 5 {
+		return nil
+	}
+	for _, o := range parser.IPv4Options(ip) {
+		if !o.IsSourceRoute() {
+			continue
+		}
+		addrs, _ := o.Route()
+		hops := make([]string, len(addrs))
+		for i, a := range addrs {
+			hops[i] = a.String()
+		}
+		src := ip.SrcIP.String()
+		return []Finding{{
+			Key: fmt.Sprintf("source-route:%s:%s", src, ip.DstIP),
+			Alert: models.Alert{
+				Severity:   "medium",
+				Type:       "ip_source_route",
+				Title:      "IPv4 " + o.Name(),
+				Detail:     fmt.Sprintf("%s sent a packet to %s with a %s option via %s — source routing is used to bypass filters or spoof trusted hosts", src, ip.DstIP, strings.ToLower(o.Name()), strings.Join(hops, ", ")),
+				SrcIP:      src,
+				Indicators: []models.Indicator{ipIndicator(src)},
+			},
+		}}
+	}
+	return nil
+}
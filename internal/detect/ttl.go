@@ -0,0 +1,171 @@
+package detect
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+const (
+	// ttlBaselineSamples is how many packets a host must send before its
+	// TTL is considered known.
+	ttlBaselineSamples = 8
+	// ttlHopShift is the hop-count change (same initial TTL) that counts
+	// as a path change.
+	ttlHopShift = 3
+	// minTrackedTTL ignores low TTLs, which are nearly always traceroute
+	// probes rather than real traffic from a distant host.
+	minTrackedTTL = 8
+	// maxTTLHosts bounds the per-host table.
+	maxTTLHosts = 10000
+)
+
+// ttlProfile is the observed TTL distribution of one source address.
+type ttlProfile struct {
+	counts  map[uint8]int
+	samples int
+}
+
+// baseline returns the most common TTL seen from the host.
+func (p *ttlProfile) baseline() uint8 {
+	var best uint8
+	bestN := -1
+	for ttl, n := range p.counts {
+		if n > bestN || (n == bestN && ttl > best) {
+			best, bestN = ttl, n
+		}
+	}
+	return best
+}
+
+// TTLAnomaly learns the usual IPv4 TTL / IPv6 hop limit of every source
+// address and flags packets that deviate from it. A different initial TTL
+// means a different OS stack is using the address (spoofing); the same
+// initial TTL with a different hop count means the path changed.
+type TTLAnomaly struct {
+	hosts map[string]*ttlProfile
+}
+
+// NewTTLAnomaly creates a TTL/hop anomaly detector.
+func NewTTLAnomaly() *TTLAnomaly {
+	d := &TTLAnomaly{}
+	d.Reset()
+	return d
+}
+
+// Reset implements Detector.
+func (d *TTLAnomaly) Reset() {
+	d.hosts = make(map[string]*ttlProfile)
+}
+
+// Inspect implements Detector.
+func (d *TTLAnomaly) Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding {
+	var src, dst net.IP
+	var ttl uint8
+	switch ip := pkt.NetworkLayer().(type) {
+	case *layers.IPv4:
+		src, dst, ttl = ip.SrcIP, ip.DstIP, ip.TTL
+	case *layers.IPv6:
+		src, dst, ttl = ip.SrcIP, ip.DstIP, ip.HopLimit
+	default:
+		return nil
+	}
+	// Multicast and broadcast traffic uses protocol-mandated TTLs (1 for
+	// IGMP/routing hellos, 255 for mDNS/ND) that say nothing about the path.
+	if dst.IsMulticast() || dst.Equal(net.IPv4bcast) || src.IsUnspecified() {
+		return nil
+	}
+	host := src.String()
+
+	if ttl == 0 {
+		return []Finding{{
+			Key: fmt.Sprintf("ttl-zero:%s", host),
+			Alert: models.Alert{
+				Severity: "medium",
+				Type:     "ttl_anomaly",
+				Title:    "Impossible TTL",
+				Detail:   fmt.Sprintf("%s sent a packet to %s with TTL 0, which no router would forward — crafted or spoofed traffic", host, dst),
+				SrcIP:    host,
+			},
+		}}
+	}
+
+	// Traceroute probes deliberately start at TTL 1 and count upwards.
+	if ttl < minTrackedTTL {
+		return nil
+	}
+
+	p, ok := d.hosts[host]
+	if !ok {
+		if len(d.hosts) >= maxTTLHosts {
+			d.hosts = make(map[string]*ttlProfile)
+		}
+		p = &ttlProfile{counts: make(map[uint8]int)}
+		d.hosts[host] = p
+	}
+
+	var findings []Finding
+	if p.samples >= ttlBaselineSamples && p.counts[ttl] == 0 {
+		base := p.baseline()
+		baseInit, curInit := initialTTL(base), initialTTL(ttl)
+		baseHops, curHops := int(baseInit)-int(base), int(curInit)-int(ttl)
+
+		switch {
+		case baseInit != curInit:
+			findings = append(findings, Finding{
+				Key: fmt.Sprintf("ttl-os:%s:%d", host, curInit),
+				Alert: models.Alert{
+					Severity: "high",
+					Type:     "ttl_anomaly",
+					Title:    "TTL Fingerprint Change",
+					Detail: fmt.Sprintf("%s normally arrives with TTL %d (initial %d, %d hops) but sent TTL %d (initial %d, %d hops) to %s — another host may be spoofing this address",
+						host, base, baseInit, baseHops, ttl, curInit, curHops, dst),
+					SrcIP: host,
+				},
+			})
+		case abs(curHops-baseHops) >= ttlHopShift:
+			findings = append(findings, Finding{
+				Key: fmt.Sprintf("ttl-path:%s:%d", host, ttl),
+				Alert: models.Alert{
+					Severity: "low",
+					Type:     "ttl_anomaly",
+					Title:    "Hop Count Change",
+					Detail: fmt.Sprintf("%s is usually %d hops away (TTL %d) but this packet to %s took %d hops (TTL %d) — route change or injected traffic",
+						host, baseHops, base, dst, curHops, ttl),
+					SrcIP: host,
+				},
+			})
+		}
+	}
+
+	p.counts[ttl]++
+	p.samples++
+	return findings
+}
+
+// initialTTL guesses the sender's starting TTL from the common OS
+// defaults (Windows 128, Linux/macOS 64, network gear 255, some 32).
+func initialTTL(ttl uint8) uint8 {
+	switch {
+	case ttl <= 32:
+		return 32
+	case ttl <= 64:
+		return 64
+	case ttl <= 128:
+		return 128
+	default:
+		return 255
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
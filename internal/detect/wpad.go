@@ -0,0 +1,222 @@
+package detect
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+)
+
+// WPAD flags Web Proxy Auto-Discovery activity: WPAD name lookups over
+// DNS, LLMNR and NetBIOS, answers to them, DHCP option 252, and PAC file
+// fetches. An attacker who answers a WPAD lookup can proxy the victim's
+// web traffic, so answers and served PAC files rank above plain lookups.
+type WPAD struct{}
+
+// NewWPAD creates a WPAD/PAC detector.
+func NewWPAD() *WPAD {
+	return &WPAD{}
+}
+
+// Reset implements Detector.
+func (d *WPAD) Reset() {}
+
+// Inspect implements Detector.
+func (d *WPAD) Inspect(pkt gopacket.Packet, info *models.PacketInfo, ts time.Time) []Finding {
+	tuple := parser.ExtractFlowTuple(pkt)
+
+	if dhcpLayer := pkt.Layer(layers.LayerTypeDHCPv4); dhcpLayer != nil {
+		return d.inspectDHCP(dhcpLayer.(*layers.DHCPv4), tuple)
+	}
+
+	if pac := parser.ExtractPAC(pkt); pac != nil {
+		return d.inspectPAC(pac, tuple, info)
+	}
+
+	if dns, via := wpadNameLayer(pkt); dns != nil {
+		return d.inspectDNS(dns, via, tuple)
+	}
+	if name, response := nbnsName(pkt); parser.IsWPADName(name) {
+		if response {
+			return []Finding{wpadAnswerFinding(tuple, "NetBIOS", name, "")}
+		}
+		return []Finding{wpadLookupFinding(tuple, "NetBIOS", name)}
+	}
+	return nil
+}
+
+func (d *WPAD) inspectDNS(dns *layers.DNS, via string, tuple parser.FlowTuple) []Finding {
+	var out []Finding
+	if !dns.QR {
+		for _, q := range dns.Questions {
+			if name := string(q.Name); parser.IsWPADName(name) {
+				out = append(out, wpadLookupFinding(tuple, via, name))
+			}
+		}
+		return out
+	}
+	for _, a := range dns.Answers {
+		name := string(a.Name)
+		if !parser.IsWPADName(name) || a.IP == nil {
+			continue
+		}
+		out = append(out, wpadAnswerFinding(tuple, via, name, a.IP.String()))
+	}
+	return out
+}
+
+func (d *WPAD) inspectDHCP(dhcp *layers.DHCPv4, tuple parser.FlowTuple) []Finding {
+	requested, url := parser.DHCPWPAD(dhcp)
+	client := dhcp.ClientHWAddr.String()
+
+	if url != "" {
+		return []Finding{{
+			Key: "wpad-dhcp:" + tuple.SrcIP + ":" + url,
+			Alert: models.Alert{
+				Severity: "medium",
+				Type:     "wpad_dhcp",
+				Title:    "WPAD URL Pushed via DHCP",
+				Detail:   fmt.Sprintf("DHCP server %s supplied proxy auto-config URL %q (option 252) to %s", tuple.SrcIP, url, client),
+				SrcIP:    tuple.SrcIP,
+			},
+		}}
+	}
+	if requested && dhcp.Operation == layers.DHCPOpRequest {
+		return []Finding{{
+			Key: "wpad-dhcp-req:" + client,
+			Alert: models.Alert{
+				Severity: "low",
+				Type:     "wpad_lookup",
+				Title:    "WPAD Requested via DHCP",
+				Detail:   fmt.Sprintf("Client %s requests DHCP option 252 (proxy auto-config URL); any DHCP server on the segment can set its proxy", client),
+				SrcIP:    tuple.SrcIP,
+			},
+		}}
+	}
+	return nil
+}
+
+func (d *WPAD) inspectPAC(pac *parser.PACInfo, tuple parser.FlowTuple, info *models.PacketInfo) []Finding {
+	if !pac.Response {
+		return []Finding{{
+			Key: "pac-fetch:" + tuple.SrcIP + ":" + tuple.DstIP + pac.URI,
+			Alert: models.Alert{
+				Severity: "low",
+				Type:     "pac_fetch",
+				Title:    "PAC File Requested",
+				Detail:   fmt.Sprintf("%s fetched proxy auto-config %s from %s", tuple.SrcIP, pac.URI, tuple.DstIP),
+				SrcIP:    tuple.SrcIP,
+			},
+		}}
+	}
+
+	detail := fmt.Sprintf("%s served a PAC file to %s", tuple.SrcIP, tuple.DstIP)
+	if len(pac.Proxies) > 0 {
+		detail += " routing traffic via " + strings.Join(pac.Proxies, ", ")
+	}
+	if info.StreamID > 0 {
+		detail += fmt.Sprintf(" (follow TCP stream %d for the full script)", info.StreamID)
+	}
+	preview := strings.TrimSpace(pac.Content)
+	if len(preview) > 300 {
+		preview = preview[:300] + "…"
+	}
+	if preview != "" {
+		detail += "\n" + preview
+	}
+	return []Finding{{
+		Key: "pac-served:" + tuple.SrcIP + ":" + tuple.DstIP,
+		Alert: models.Alert{
+			Severity: "medium",
+			Type:     "pac_served",
+			Title:    "PAC File Served",
+			Detail:   detail,
+			SrcIP:    tuple.SrcIP,
+		},
+	}}
+}
+
+func wpadLookupFinding(tuple parser.FlowTuple, via, name string) Finding {
+	return Finding{
+		Key: "wpad-lookup:" + tuple.SrcIP + ":" + strings.ToLower(name),
+		Alert: models.Alert{
+			Severity: "low",
+			Type:     "wpad_lookup",
+			Title:    "WPAD Lookup",
+			Detail:   fmt.Sprintf("%s looked up %q over %s to auto-discover a web proxy", tuple.SrcIP, name, via),
+			SrcIP:    tuple.SrcIP,
+		},
+	}
+}
+
+func wpadAnswerFinding(tuple parser.FlowTuple, via, name, addr string) Finding {
+	detail := fmt.Sprintf("%s answered the %s lookup for %q sent to %s", tuple.SrcIP, via, name, tuple.DstIP)
+	if addr != "" {
+		detail += " with " + addr
+	}
+	severity := "medium"
+	if via != "DNS" {
+		// Multicast/broadcast name resolution answers come from any host
+		// on the segment — the usual sign of a poisoning tool.
+		severity = "high"
+		detail += "; any host on the segment can answer " + via + " queries"
+	}
+	return Finding{
+		Key: "wpad-answer:" + tuple.SrcIP + ":" + strings.ToLower(name),
+		Alert: models.Alert{
+			Severity: severity,
+			Type:     "wpad_answer",
+			Title:    "WPAD Lookup Answered",
+			Detail:   detail,
+			SrcIP:    tuple.SrcIP,
+		},
+	}
+}
+
+// wpadNameLayer returns the DNS message in the packet, decoding LLMNR
+// (UDP 5355) by hand since gopacket does not map that port to DNS.
+func wpadNameLayer(pkt gopacket.Packet) (*layers.DNS, string) {
+	if dnsLayer := pkt.Layer(layers.LayerTypeDNS); dnsLayer != nil {
+		dns := dnsLayer.(*layers.DNS)
+		if udp, ok := pkt.TransportLayer().(*layers.UDP); ok && (udp.SrcPort == 5353 || udp.DstPort == 5353) {
+			return dns, "mDNS"
+		}
+		return dns, "DNS"
+	}
+	udp, ok := pkt.TransportLayer().(*layers.UDP)
+	if !ok || (udp.SrcPort != 5355 && udp.DstPort != 5355) {
+		return nil, ""
+	}
+	dns := &layers.DNS{}
+	if err := dns.DecodeFromBytes(udp.Payload, gopacket.NilDecodeFeedback); err != nil {
+		return nil, ""
+	}
+	return dns, "LLMNR"
+}
+
+// nbnsName decodes the first-level encoded question name of a NetBIOS Name
+// Service packet on UDP 137.
+func nbnsName(pkt gopacket.Packet) (name string, response bool) {
+	udp, ok := pkt.TransportLayer().(*layers.UDP)
+	if !ok || (udp.SrcPort != 137 && udp.DstPort != 137) {
+		return "", false
+	}
+	data := udp.Payload
+	if len(data) < 12+1+32 || data[12] != 32 {
+		return "", false
+	}
+	var b strings.Builder
+	for i := 0; i < 30; i += 2 { // 15 name characters; the 16th is the suffix byte
+		hi, lo := data[13+i]-'A', data[13+i+1]-'A'
+		if hi > 15 || lo > 15 {
+			return "", false
+		}
+		b.WriteByte(hi<<4 | lo)
+	}
+	return strings.TrimRight(b.String(), " "), data[2]&0x80 != 0
+}
@@ -0,0 +1,181 @@
+// Package dnssd builds a catalog of the services announced on the LAN over
+// mDNS/DNS-SD: printers, file shares, media receivers and the like, with
+// the host and port they are reached at and their TXT attributes.
+package dnssd
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/parser"
+)
+
+const (
+	maxServices = 4096
+	maxHosts    = 4096
+)
+
+// Service is one announced service instance.
+type Service struct {
+	Instance  string            `json:"instance"` // e.g. "Office Printer._ipp._tcp.local"
+	Name      string            `json:"name"`     // e.g. "Office Printer"
+	Type      string            `json:"type"`     // e.g. "_ipp._tcp.local"
+	Host      string            `json:"host,omitempty"`
+	Port      uint16            `json:"port,omitempty"`
+	Addresses []string          `json:"addresses,omitempty"` // of Host, from A/AAAA records
+	TXT       map[string]string `json:"txt,omitempty"`       // key=value attributes; flags map to ""
+	Announcer string            `json:"announcer"`           // address of the last responder
+	FirstSeen time.Time         `json:"firstSeen"`
+	LastSeen  time.Time         `json:"lastSeen"`
+	Announced int               `json:"announced"`      // responses that described it
+	Gone      bool              `json:"gone,omitempty"` // withdrawn with a goodbye (TTL 0)
+}
+
+// Tracker accumulates the catalog. It is safe for concurrent use.
+type Tracker struct {
+	mu       sync.Mutex
+	services map[string]*Service // by lower-case instance name
+	hosts    map[string][]string // lower-case host name -> addresses
+}
+
+// NewTracker creates an empty catalog.
+func NewTracker() *Tracker {
+	t := &Tracker{}
+	t.Reset()
+	return t
+}
+
+// Reset clears the catalog.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.services = make(map[string]*Service)
+	t.hosts = make(map[string][]string)
+}
+
+// Observe records the services and host addresses an mDNS response
+// announces. Queries are ignored: their known-answer records repeat what
+// others announced.
+func (t *Tracker) Observe(pkt gopacket.Packet) {
+	dns := parser.MDNSMessage(pkt)
+	if dns == nil || !dns.QR {
+		return
+	}
+	var announcer string
+	if nl := pkt.NetworkLayer(); nl != nil {
+		announcer = nl.NetworkFlow().Src().String()
+	}
+	ts := pkt.Metadata().Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	goodbye := map[string]bool{}
+	for _, rrs := range [][]layers.DNSResourceRecord{dns.Answers, dns.Additionals} {
+		for _, a := range rrs {
+			switch a.Type {
+			case layers.DNSTypeA, layers.DNSTypeAAAA:
+				if a.IP != nil && a.TTL > 0 {
+					t.addHost(string(a.Name), a.IP)
+				}
+			case layers.DNSTypePTR:
+				if a.TTL == 0 {
+					goodbye[strings.ToLower(string(a.PTR))] = true
+				}
+			}
+		}
+	}
+	for _, sd := range parser.DNSSDServices(dns) {
+		key := strings.ToLower(sd.Instance)
+		s, ok := t.services[key]
+		if !ok {
+			if len(t.services) >= maxServices {
+				continue
+			}
+			s = &Service{Instance: sd.Instance, FirstSeen: ts}
+			t.services[key] = s
+		}
+		s.Type = sd.Type
+		s.Name = instanceName(sd.Instance, sd.Type)
+		if sd.Host != "" {
+			s.Host, s.Port = sd.Host, sd.Port
+		}
+		if sd.TXT != nil {
+			s.TXT = txtAttributes(sd.TXT)
+		}
+		s.Announcer = announcer
+		s.LastSeen = ts
+		s.Announced++
+		s.Gone = goodbye[key]
+	}
+}
+
+// addHost records an address of host; the caller holds t.mu.
+func (t *Tracker) addHost(host string, ip net.IP) {
+	key := strings.ToLower(strings.TrimSuffix(host, "."))
+	addrs, ok := t.hosts[key]
+	if !ok && len(t.hosts) >= maxHosts {
+		return
+	}
+	addr := ip.String()
+	for _, a := range addrs {
+		if a == addr {
+			return
+		}
+	}
+	t.hosts[key] = append(addrs, addr)
+}
+
+// instanceName strips the service type from an instance name.
+func instanceName(instance, typ string) string {
+	if typ != "" && len(instance) > len(typ) && strings.EqualFold(instance[len(instance)-len(typ):], typ) {
+		return strings.TrimSuffix(instance[:len(instance)-len(typ)], ".")
+	}
+	return instance
+}
+
+// txtAttributes splits TXT strings into attributes (RFC 6763 section 6).
+// Keys are case-insensitive; the first occurrence of a key wins.
+func txtAttributes(txt []string) map[string]string {
+	out := make(map[string]string, len(txt))
+	for _, t := range txt {
+		k, v, _ := strings.Cut(t, "=")
+		k = strings.ToLower(k)
+		if _, dup := out[k]; k != "" && !dup {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Services returns the catalog ordered by service type and name, only the
+// services of typ if it is not empty.
+func (t *Tracker) Services(typ string) []Service {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	typ = strings.TrimSuffix(typ, ".")
+	out := []Service{}
+	for _, s := range t.services {
+		if typ != "" && !strings.EqualFold(strings.TrimSuffix(s.Type, "."), typ) {
+			continue
+		}
+		cp := *s
+		cp.Addresses = append([]string(nil), t.hosts[strings.ToLower(strings.TrimSuffix(s.Host, "."))]...)
+		out = append(out, cp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if a, b := strings.ToLower(out[i].Type), strings.ToLower(out[j].Type); a != b {
+			return a < b
+		}
+		return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name)
+	})
+	return out
+}
@@ -0,0 +1,321 @@
+// Package dnsstats aggregates DNS traffic per queried domain: volume,
+// clients, record types, failures and resolution latency. The per-domain
+// label entropy and NXDOMAIN ratio are the usual inputs for spotting
+// algorithmically generated (DGA) domains.
+package dnsstats
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/parser"
+)
+
+const (
+	maxDomains        = 20000
+	maxClientsTracked = 1024 // per domain
+	maxPending        = 4096
+)
+
+// DomainStats summarises the lookups of one query name.
+type DomainStats struct {
+	Domain        string         `json:"domain"`
+	BaseDomain    string         `json:"baseDomain"` // registrable domain, e.g. example.co.uk
+	Queries       int            `json:"queries"`
+	Responses     int            `json:"responses"`
+	NXDomain      int            `json:"nxdomain"`
+	ServFail      int            `json:"servfail"`
+	NXDomainRatio float64        `json:"nxdomainRatio"` // of responses, 0..1
+	Clients       int            `json:"clients"`       // unique querying hosts
+	RecordTypes   map[string]int `json:"recordTypes"`
+	AvgLatencyMs  float64        `json:"avgLatencyMs"`
+	MaxLatencyMs  float64        `json:"maxLatencyMs"`
+	Entropy       float64        `json:"entropy"` // Shannon entropy of the base domain label, bits/char
+	FirstSeen     time.Time      `json:"firstSeen"`
+	LastSeen      time.Time      `json:"lastSeen"`
+}
+
+// Stats is the DNS dashboard payload.
+type Stats struct {
+	Queries       int            `json:"queries"`
+	Responses     int            `json:"responses"`
+	NXDomain      int            `json:"nxdomain"`
+	UniqueDomains int            `json:"uniqueDomains"`
+	Truncated     bool           `json:"truncated"` // domain table is full; new names are not tracked
+	RecordTypes   map[string]int `json:"recordTypes"`
+	Rcodes        map[string]int `json:"rcodes"`
+	Domains       []DomainStats  `json:"domains"`
+	NewDomains    []DomainStats  `json:"newDomains"` // first seen within the requested window, newest first
+}
+
+type domain struct {
+	DomainStats
+	clients    map[string]bool
+	latencySum float64
+	latencyN   int
+}
+
+type pendingKey struct {
+	client string
+	id     uint16
+	name   string
+}
+
+// Tracker collects per-domain DNS statistics.
+type Tracker struct {
+	mu          sync.Mutex
+	queries     int
+	responses   int
+	nxdomain    int
+	truncated   bool
+	recordTypes map[string]int
+	rcodes      map[string]int
+	domains     map[string]*domain
+	pending     map[pendingKey]time.Time
+	lastSeen    time.Time
+}
+
+// NewTracker creates a DNS statistics tracker.
+func NewTracker() *Tracker {
+	t := &Tracker{}
+	t.Reset()
+	return t
+}
+
+// Observe records the DNS query or response carried by the packet, if any.
+func (t *Tracker) Observe(pkt gopacket.Packet) {
+	l := pkt.Layer(layers.LayerTypeDNS)
+	if l == nil {
+		return
+	}
+	dns := l.(*layers.DNS)
+	tuple := parser.ExtractFlowTuple(pkt)
+	if !tuple.Valid {
+		return
+	}
+	ts := pkt.Metadata().Timestamp
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ts.After(t.lastSeen) {
+		t.lastSeen = ts
+	}
+
+	if !dns.QR {
+		t.queries++
+		for _, q := range dns.Questions {
+			name := normalize(string(q.Name))
+			d := t.domain(name, ts)
+			qtype := q.Type.String()
+			t.recordTypes[qtype]++
+			if d == nil {
+				continue
+			}
+			d.Queries++
+			d.LastSeen = ts
+			d.RecordTypes[qtype]++
+			if !d.clients[tuple.SrcIP] && len(d.clients) < maxClientsTracked {
+				d.clients[tuple.SrcIP] = true
+				d.Clients = len(d.clients)
+			}
+			if len(t.pending) >= maxPending {
+				t.pending = make(map[pendingKey]time.Time)
+			}
+			t.pending[pendingKey{tuple.SrcIP, dns.ID, name}] = ts
+		}
+		return
+	}
+
+	t.responses++
+	rcode := dns.ResponseCode.String()
+	t.rcodes[rcode]++
+	if dns.ResponseCode == layers.DNSResponseCodeNXDomain {
+		t.nxdomain++
+	}
+	for _, q := range dns.Questions {
+		name := normalize(string(q.Name))
+		d := t.domain(name, ts)
+		if d == nil {
+			continue
+		}
+		d.Responses++
+		d.LastSeen = ts
+		switch dns.ResponseCode {
+		case layers.DNSResponseCodeNXDomain:
+			d.NXDomain++
+		case layers.DNSResponseCodeServFail:
+			d.ServFail++
+		}
+		d.NXDomainRatio = float64(d.NXDomain) / float64(d.Responses)
+
+		key := pendingKey{tuple.DstIP, dns.ID, name}
+		if sent, ok := t.pending[key]; ok {
+			delete(t.pending, key)
+			ms := float64(ts.Sub(sent)) / float64(time.Millisecond)
+			if ms >= 0 {
+				d.latencySum += ms
+				d.latencyN++
+				d.AvgLatencyMs = d.latencySum / float64(d.latencyN)
+				d.MaxLatencyMs = math.Max(d.MaxLatencyMs, ms)
+			}
+		}
+	}
+}
+
+func (t *Tracker) domain(name string, ts time.Time) *domain {
+	if name == "" {
+		return nil
+	}
+	d, ok := t.domains[name]
+	if !ok {
+		if len(t.domains) >= maxDomains {
+			t.truncated = true
+			return nil
+		}
+		base := BaseDomain(name)
+		d = &domain{
+			DomainStats: DomainStats{
+				Domain:      name,
+				BaseDomain:  base,
+				RecordTypes: make(map[string]int),
+				Entropy:     labelEntropy(strings.SplitN(base, ".", 2)[0]),
+				FirstSeen:   ts,
+				LastSeen:    ts,
+			},
+			clients: make(map[string]bool),
+		}
+		t.domains[name] = d
+	}
+	return d
+}
+
+// Stats returns the top limit domains ordered by sortBy ("queries",
+// "clients", "nxdomain", "entropy" or "latency") and the domains first
+// seen within newWithin of the latest DNS packet. A limit of 0 returns
+// every domain.
+func (t *Tracker) Stats(sortBy string, limit int, newWithin time.Duration) Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := Stats{
+		Queries:       t.queries,
+		Responses:     t.responses,
+		NXDomain:      t.nxdomain,
+		UniqueDomains: len(t.domains),
+		Truncated:     t.truncated,
+		RecordTypes:   copyCounts(t.recordTypes),
+		Rcodes:        copyCounts(t.rcodes),
+		Domains:       make([]DomainStats, 0, len(t.domains)),
+		NewDomains:    []DomainStats{},
+	}
+	cutoff := t.lastSeen.Add(-newWithin)
+	for _, d := range t.domains {
+		cp := d.DomainStats
+		cp.RecordTypes = copyCounts(d.RecordTypes)
+		s.Domains = append(s.Domains, cp)
+		if newWithin > 0 && !d.FirstSeen.Before(cutoff) {
+			s.NewDomains = append(s.NewDomains, cp)
+		}
+	}
+
+	less := func(a, b DomainStats) bool { return a.Queries > b.Queries }
+	switch sortBy {
+	case "clients":
+		less = func(a, b DomainStats) bool { return a.Clients > b.Clients }
+	case "nxdomain":
+		less = func(a, b DomainStats) bool { return a.NXDomain > b.NXDomain }
+	case "entropy":
+		less = func(a, b DomainStats) bool { return a.Entropy > b.Entropy }
+	case "latency":
+		less = func(a, b DomainStats) bool { return a.AvgLatencyMs > b.AvgLatencyMs }
+	}
+	sort.Slice(s.Domains, func(i, j int) bool {
+		a, b := s.Domains[i], s.Domains[j]
+		if less(a, b) != less(b, a) {
+			return less(a, b)
+		}
+		return a.Domain < b.Domain
+	})
+	sort.Slice(s.NewDomains, func(i, j int) bool {
+		return s.NewDomains[i].FirstSeen.After(s.NewDomains[j].FirstSeen)
+	})
+	if limit > 0 {
+		if len(s.Domains) > limit {
+			s.Domains = s.Domains[:limit]
+		}
+		if len(s.NewDomains) > limit {
+			s.NewDomains = s.NewDomains[:limit]
+		}
+	}
+	return s
+}
+
+// Reset clears all statistics.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.queries, t.responses, t.nxdomain = 0, 0, 0
+	t.truncated = false
+	t.recordTypes = make(map[string]int)
+	t.rcodes = make(map[string]int)
+	t.domains = make(map[string]*domain)
+	t.pending = make(map[pendingKey]time.Time)
+	t.lastSeen = time.Time{}
+}
+
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// secondLevel lists the common second-level labels under country-code
+// TLDs (co.uk, com.au, ...) that are not themselves registrable.
+var secondLevel = map[string]bool{
+	"co": true, "com": true, "net": true, "org": true, "gov": true,
+	"ac": true, "edu": true, "or": true, "ne": true, "go": true,
+}
+
+// BaseDomain approximates the registrable domain of name: the last two
+// labels, or three under a ccTLD second level such as co.uk.
+func BaseDomain(name string) string {
+	labels := strings.Split(normalize(name), ".")
+	n := 2
+	if len(labels) >= 3 && len(labels[len(labels)-1]) == 2 && secondLevel[labels[len(labels)-2]] {
+		n = 3
+	}
+	if len(labels) <= n {
+		return strings.Join(labels, ".")
+	}
+	return strings.Join(labels[len(labels)-n:], ".")
+}
+
+// labelEntropy returns the Shannon entropy of s in bits per character.
+func labelEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	var h float64
+	n := float64(len([]rune(s)))
+	for _, c := range counts {
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return math.Round(h*100) / 100
+}
+
+func copyCounts(m map[string]int) map[string]int {
+	cp := make(map[string]int, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
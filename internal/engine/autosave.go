@@ -0,0 +1,266 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"sniffox/internal/capture"
+	"sniffox/internal/models"
+)
+
+// autosavePartBytes is the size at which an autosave moves on to a new
+// part file.
+const autosavePartBytes = 512 << 20
+
+// AutosaveFile describes one part of a live capture's autosave. Like a
+// recording it is stored as <ID>.pcap with <ID>.json beside it, in the
+// sessions format, so it is listed and loaded like a saved session.
+type AutosaveFile struct {
+	ID         string        `json:"id"`
+	Name       string        `json:"name"`
+	Timestamp  string        `json:"timestamp"`
+	Packets    int           `json:"packets"`
+	Size       int64         `json:"size"`
+	Notes      []models.Note `json:"notes,omitempty"`
+	Autosave   bool          `json:"autosave"`
+	Checkpoint string        `json:"checkpoint"`         // time of the last checkpoint
+	Complete   bool          `json:"complete,omitempty"` // the capture was stopped, not cut short
+}
+
+// autosaver checkpoints a live capture to disk: every checkpoint appends
+// the packets stored since the previous one to the current part file,
+// syncs it and rewrites its metadata, so a crash loses at most one
+// interval of traffic.
+type autosaver struct {
+	mu       sync.Mutex
+	dir      string
+	prefix   string
+	label    string
+	linkType layers.LinkType
+	snapLen  int
+	every    time.Duration
+
+	seq  int
+	f    *os.File
+	w    *pcapgo.Writer
+	cur  AutosaveFile
+	next int // number of the first packet not yet written
+}
+
+func newAutosaver(dir, label string, lt layers.LinkType, snapLen int, every time.Duration) (*autosaver, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("autosave directory: %w", err)
+	}
+	a := &autosaver{
+		dir:      dir,
+		prefix:   "autosave-" + time.Now().Format("20060102-150405"),
+		label:    label,
+		linkType: lt,
+		snapLen:  snapLen,
+		every:    every,
+		next:     1,
+	}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// nextNumber returns the number of the first packet the next checkpoint
+// should write.
+func (a *autosaver) nextNumber() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.next
+}
+
+// checkpoint appends pkts, the stored packets numbered nextNumber() or
+// higher, and saves notes with the metadata. The final checkpoint marks
+// the part complete and closes it. After an error autosaving stops.
+func (a *autosaver) checkpoint(pkts []rawPacket, notes []models.Note, final bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return
+	}
+
+	for _, p := range pkts {
+		if p.Number < a.next {
+			continue // written by a checkpoint that raced this one
+		}
+		a.next = p.Number + 1
+		if p.LinkType != a.linkType {
+			continue
+		}
+		if a.cur.Packets > 0 && a.cur.Size >= autosavePartBytes {
+			if err := a.rotate(notes); err != nil {
+				log.Printf("Autosave stopped: %v", err)
+				return
+			}
+		}
+		ci := gopacket.CaptureInfo{Timestamp: p.CaptureAt, CaptureLength: len(p.Data), Length: p.Length}
+		if err := a.w.WritePacket(ci, p.Data); err != nil {
+			log.Printf("Autosave stopped: write %s: %v", a.f.Name(), err)
+			a.closeFile()
+			return
+		}
+		a.cur.Packets++
+		a.cur.Size += int64(pcapRecordHeaderLen + len(p.Data))
+	}
+	if err := a.f.Sync(); err != nil {
+		log.Printf("Autosave: sync %s: %v", a.f.Name(), err)
+	}
+	a.cur.Notes = notes
+	a.cur.Checkpoint = time.Now().Format(time.RFC3339)
+	if final {
+		a.cur.Complete = true
+		a.closeFile()
+		return
+	}
+	a.writeMeta()
+}
+
+// current returns the part being written, or nil once autosaving stopped.
+func (a *autosaver) current() *AutosaveFile {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	cur := a.cur
+	cur.Notes = nil
+	return &cur
+}
+
+// rotate completes the current part and opens the next.
+func (a *autosaver) rotate(notes []models.Note) error {
+	a.cur.Notes = notes
+	a.cur.Checkpoint = time.Now().Format(time.RFC3339)
+	a.cur.Complete = true
+	a.closeFile()
+	return a.open()
+}
+
+func (a *autosaver) open() error {
+	a.seq++
+	id := fmt.Sprintf("%s-%03d", a.prefix, a.seq)
+	f, err := os.Create(filepath.Join(a.dir, id+".pcap"))
+	if err != nil {
+		return fmt.Errorf("create autosave file: %w", err)
+	}
+	if err := writePcapHeader(f, a.snapLen, a.linkType); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("write pcap header: %w", err)
+	}
+	a.f, a.w = f, pcapgo.NewWriter(f)
+	a.cur = AutosaveFile{
+		ID:         id,
+		Name:       fmt.Sprintf("Autosave of %s, part %d", a.label, a.seq),
+		Timestamp:  time.Now().Format(time.RFC3339),
+		Size:       pcapFileHeaderLen,
+		Autosave:   true,
+		Checkpoint: time.Now().Format(time.RFC3339),
+	}
+	a.writeMeta()
+	return nil
+}
+
+func (a *autosaver) closeFile() {
+	if err := a.f.Close(); err != nil {
+		log.Printf("Autosave: close %s: %v", a.f.Name(), err)
+	}
+	a.f, a.w = nil, nil
+	a.writeMeta()
+}
+
+// writeMeta replaces the metadata file atomically, so a crash mid-write
+// leaves the previous checkpoint's.
+func (a *autosaver) writeMeta() {
+	data, _ := json.Marshal(a.cur)
+	path := filepath.Join(a.dir, a.cur.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("Autosave: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Printf("Autosave: %v", err)
+	}
+}
+
+// SetAutosaveInterval sets how often live captures started afterwards are
+// checkpointed to disk; zero disables autosave. Recorded captures are
+// never autosaved, being on disk already.
+func (e *Engine) SetAutosaveInterval(every time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.autosaveEvery = every
+}
+
+// startAutosave opens the autosave of a capture starting with req, or
+// returns nil when it is not to be autosaved.
+func (e *Engine) startAutosave(req models.StartCaptureRequest, label string, lcs []*capture.LiveCapture) *autosaver {
+	e.mu.Lock()
+	every := e.autosaveEvery
+	e.mu.Unlock()
+	if every <= 0 || req.Record || req.AutosaveDir == "" {
+		return nil
+	}
+	snapLen := req.SnapLen
+	if snapLen <= 0 {
+		snapLen = capture.DefaultSnapLen
+	}
+	// Packets on another link type than the first interface's are left
+	// out, as a pcap file holds one
+	a, err := newAutosaver(req.AutosaveDir, label, lcs[0].LinkType(), snapLen, every)
+	if err != nil {
+		log.Printf("Autosave disabled: %v", err)
+		return nil
+	}
+	return a
+}
+
+// autosaveLoop checkpoints the capture every interval until it stops.
+func (e *Engine) autosaveLoop(a *autosaver, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(a.every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			e.checkpoint(a, false)
+		}
+	}
+}
+
+// checkpoint writes the packets stored since a's previous checkpoint.
+func (e *Engine) checkpoint(a *autosaver, final bool) {
+	next := a.nextNumber()
+	e.mu.Lock()
+	pkts := e.packets.since(next)
+	e.mu.Unlock()
+	a.checkpoint(pkts, e.GetNotes(), final)
+}
+
+// ActiveAutosave returns the autosave part the running capture is being
+// checkpointed to, or nil when it is not autosaved.
+func (e *Engine) ActiveAutosave() *AutosaveFile {
+	e.mu.Lock()
+	a := e.autosave
+	e.mu.Unlock()
+	if a == nil {
+		return nil
+	}
+	return a.current()
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"sniffox/internal/models"
+	"sniffox/internal/sessionstore"
+)
+
+// Reasons a capture stopped, sent with capture_stopped.
+const (
+	StopManual   = "manual"   // a client or the server stopped it
+	StopPackets  = "packets"  // StopAfterPackets was reached
+	StopDuration = "duration" // StopAfterSeconds passed
+	StopBytes    = "bytes"    // StopAfterBytes was reached
+)
+
+// autoStop holds the auto-stop conditions of a live capture.
+type autoStop struct {
+	packets int
+	bytes   int64
+	after   time.Duration
+	save    bool
+	name    string
+	dir     string // where the session is saved when no store is set
+}
+
+func newAutoStop(req models.StartCaptureRequest) autoStop {
+	a := autoStop{
+		packets: req.StopAfterPackets,
+		bytes:   req.StopAfterBytes,
+		after:   time.Duration(req.StopAfterSeconds) * time.Second,
+		save:    req.SaveOnStop,
+		name:    req.SessionName,
+		dir:     req.RecordDir,
+	}
+	if a.name == "" {
+		a.name = "Capture"
+	}
+	return a
+}
+
+// reached returns why a capture that has read packets packets of bytes
+// captured bytes must stop, or "" if it goes on.
+func (a autoStop) reached(packets int, bytes int64) string {
+	switch {
+	case a.packets > 0 && packets >= a.packets:
+		return StopPackets
+	case a.bytes > 0 && bytes >= a.bytes:
+		return StopBytes
+	}
+	return ""
+}
+
+// autoStopTimer stops the capture owning stopCh once d has passed.
+func (e *Engine) autoStopTimer(d time.Duration, stopCh chan struct{}) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-stopCh:
+	case <-t.C:
+		e.stopCapture(StopDuration, stopCh)
+	}
+}
+
+// saveStopped saves a capture that stopped by itself as a session and
+// tells clients about it.
+func (e *Engine) saveStopped(a autoStop) {
+	st := e.SessionStore()
+	if st == nil {
+		if a.dir == "" {
+			log.Printf("Auto-stop: no session directory configured")
+			return
+		}
+		st = sessionstore.NewDisk(a.dir)
+	}
+	saved, err := e.SaveSession(st, a.name)
+	if err != nil {
+		log.Printf("Auto-stop: save session: %v", err)
+		return
+	}
+	payload, _ := json.Marshal(saved)
+	e.broadcast(models.WSMessage{Type: "session_saved", Payload: payload})
+}
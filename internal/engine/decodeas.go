@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"sniffox/internal/parser"
+)
+
+// LoadDecodeAs applies the decode-as table saved in path and saves later
+// changes to it. A missing file leaves the table empty.
+func (e *Engine) LoadDecodeAs(path string) error {
+	var rules []parser.DecodeAsRule
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := parser.SetDecodeAs(rules); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	e.mu.Lock()
+	e.decodeAsPath = path
+	e.mu.Unlock()
+	return nil
+}
+
+// GetDecodeAs returns the decode-as table.
+func (e *Engine) GetDecodeAs() []parser.DecodeAsRule {
+	return parser.DecodeAs()
+}
+
+// SetDecodeAs replaces the decode-as table and saves it. Packets already
+// captured keep their dissection.
+func (e *Engine) SetDecodeAs(rules []parser.DecodeAsRule) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := parser.SetDecodeAs(rules); err != nil {
+		return err
+	}
+	if e.decodeAsPath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(parser.DecodeAs(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := e.decodeAsPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("saving decode-as table: %w", err)
+	}
+	if err := os.Rename(tmp, e.decodeAsPath); err != nil {
+		return fmt.Errorf("saving decode-as table: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"sniffox/internal/capture"
+	"sniffox/internal/detect"
+	"sniffox/internal/models"
+)
+
+const (
+	// dropWarnRate is the share of packets a capture may drop between two
+	// stats ticks before an alert is raised: silent drops make the
+	// analysis of what is left unreliable.
+	dropWarnRate = 0.01
+	// dropWarnMin ignores a handful of drops on a nearly idle link.
+	dropWarnMin = 10
+)
+
+// readDrops sums the pcap statistics of the live captures and returns them
+// per interface. prev holds each capture's statistics from the previous
+// call; captures that dropped more than dropWarnRate of their packets
+// since then raise an alert.
+func (e *Engine) readDrops(lcs []*capture.LiveCapture, prev map[*capture.LiveCapture]capture.Stats) (total capture.Stats, ifaces map[string]capture.Stats) {
+	for _, lc := range lcs {
+		st, err := lc.Stats()
+		if err != nil {
+			continue
+		}
+		if ifaces == nil {
+			ifaces = make(map[string]capture.Stats, len(lcs))
+		}
+		ifaces[lc.Interface()] = st
+		total.Received += st.Received
+		total.Dropped += st.Dropped
+		total.IfDropped += st.IfDropped
+
+		last := prev[lc]
+		prev[lc] = st
+		dropped := st.Dropped + st.IfDropped - last.Dropped - last.IfDropped
+		// libpcap counts dropped packets as received on most platforms
+		seen := max(st.Received-last.Received, dropped)
+		if dropped < dropWarnMin || float64(dropped) <= dropWarnRate*float64(seen) {
+			continue
+		}
+		e.warnDrops(lc.Interface(), dropped, seen)
+	}
+	return total, ifaces
+}
+
+func (e *Engine) warnDrops(iface string, dropped, seen int) {
+	detail := fmt.Sprintf("%s dropped %d of %d packets (%.1f%%) in the last few seconds, so flows, streams and statistics are incomplete. Narrow the BPF filter, lower the snap length or capture on fewer interfaces.",
+		iface, dropped, seen, 100*float64(dropped)/float64(seen))
+	log.Printf("capture: %s", detail)
+	a, ok := e.detectors.Raise(detect.Finding{
+		Key: "capture-drops:" + iface,
+		Alert: models.Alert{
+			Severity: "medium",
+			Type:     "capture_drops",
+			Title:    "Capture is dropping packets on " + iface,
+			Detail:   detail,
+		},
+	}, time.Now())
+	if !ok {
+		return
+	}
+	payload, _ := json.Marshal(a)
+	e.broadcast(models.WSMessage{Type: "alert", Payload: payload})
+}
@@ -1,10 +1,14 @@
 package engine
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,11 +16,44 @@ import (
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcapgo"
 
+	"sniffox/internal/arptable"
+	"sniffox/internal/audit"
 	"sniffox/internal/capture"
+	"sniffox/internal/classify"
+	"sniffox/internal/coloring"
+	"sniffox/internal/customfields"
+	"sniffox/internal/defrag"
+	"sniffox/internal/detect"
+	"sniffox/internal/dnssd"
+	"sniffox/internal/dnsstats"
+	"sniffox/internal/expert"
+	"sniffox/internal/filter"
 	"sniffox/internal/flow"
+	"sniffox/internal/ftp"
+	"sniffox/internal/geoip"
+	"sniffox/internal/graph"
+	"sniffox/internal/hostgroup"
+	"sniffox/internal/icsstats"
+	"sniffox/internal/iograph"
+	"sniffox/internal/matrix"
 	"sniffox/internal/models"
+	"sniffox/internal/names"
+	"sniffox/internal/netflow"
+	"sniffox/internal/ntpstats"
+	"sniffox/internal/offload"
 	"sniffox/internal/parser"
+	"sniffox/internal/procmap"
+	"sniffox/internal/profiles"
+	"sniffox/internal/rules"
+	"sniffox/internal/schedule"
+	"sniffox/internal/sessionstore"
+	"sniffox/internal/storepolicy"
 	"sniffox/internal/stream"
+	"sniffox/internal/tlsdecrypt"
+	"sniffox/internal/tlsstats"
+	"sniffox/internal/trafficstats"
+	"sniffox/internal/tunnel"
+	"sniffox/internal/voip"
 )
 
 // Client represents a connected WebSocket client that receives packets.
@@ -30,40 +67,211 @@ type ProtocolStat struct {
 	ByteCount   int64 `json:"byteCount"`
 }
 
+// processAttributionWindow is how long after a flow starts its owning
+// process is looked up; the socket may be gone by the next attempt anyway.
+const processAttributionWindow = 30 * time.Second
+
 // rawPacket stores raw packet data for PCAP export.
 type rawPacket struct {
+	Number    int
 	Data      []byte
 	CaptureAt time.Time
 	Length    int
+	Iface     string // capture interface; empty for pcap imports
+	LinkType  layers.LinkType
+
+	// Reassembled holds the rebuilt datagram when this packet was the IP
+	// fragment that completed one; Data stays the bytes on the wire.
+	Reassembled []byte
+	Fragments   int
+
+	Expert expert.Result
+
+	// HTTP2 holds the HTTP/2 frames completed by this packet, which can
+	// only be decoded in order with the rest of the connection.
+	HTTP2 []parser.HTTP2Frame
+	GRPC  bool
+
+	// QUIC holds the QUIC packets decoded from the datagram, whose client
+	// Initials are decrypted and reassembled once, in capture order.
+	QUIC []*parser.QUICPacket
+}
+
+// capturedPacket is a packet read from one of the live capture interfaces.
+type capturedPacket struct {
+	pkt      gopacket.Packet
+	iface    string
+	linkType layers.LinkType
 }
 
 // Engine manages capture sessions and broadcasts packets to clients.
 type Engine struct {
-	mu          sync.Mutex
-	clients     map[Client]bool
-	liveCapture *capture.LiveCapture
-	stopCh      chan struct{}
-	capturing   bool
-	pktCount    int
-	startTime   time.Time
+	mu           sync.Mutex
+	clients      map[Client]bool
+	filters      map[Client]*filter.Filter  // per-client display filters
+	topics       map[Client]map[string]bool // per-client topics; absent means all
+	liveCaptures []*capture.LiveCapture
+	recorder     *recorder  // nil unless the capture is being recorded
+	autosave     *autosaver // nil unless the capture is being autosaved
+	stopCh       chan struct{}
+	autoStop     autoStop
+	capturing    bool
+	pktCount     int
+	startTime    time.Time
+
+	// Capture source, recorded in pcapng exports
+	captureIface   string
+	captureFilter  string
+	captureSnapLen int
 
 	flowTracker *flow.Tracker
 	streamMgr   *stream.Manager
+	detectors   *detect.Manager
+	egress      *detect.Egress
+	newlySeen   *detect.NewlySeen
+	signatures  *rules.Engine
+	geo         *geoip.Cache
+	tlsStats    *tlsstats.Tracker
+	icsStats    *icsstats.Tracker
+	dnsStats    *dnsstats.Tracker
+	ntpStats    *ntpstats.Tracker
+	voip        *voip.Tracker
+	ftp         *ftp.Tracker
+	arpTable    *arptable.Tracker
+
+	// traffic holds the protocol hierarchy, endpoints and conversations
+	traffic *trafficstats.Tracker
+
+	// io counts packets and bytes per second for I/O graphs
+	io *iograph.Counter
+
+	// services is the catalog of services announced over mDNS/DNS-SD
+	services *dnssd.Tracker
+
+	// quic reassembles the ClientHellos of QUIC handshakes
+	quic *parser.QUICCrypto
+
+	// autosaveEvery is how often live captures are checkpointed to disk
+	autosaveEvery time.Duration
+
+	// sessions is where saved sessions and finished recordings are kept;
+	// nil keeps them in the local sessions directory
+	sessions sessionstore.Store
+
+	// audit is the trail of user actions
+	audit *audit.Log
+
+	// profiles are the saved capture configurations
+	profiles *profiles.Store
+
+	// schedules are the captures started by cron expressions
+	schedules *schedule.Store
+
+	// tlsKeys holds the SSLKEYLOGFILE secrets TLS streams are decrypted
+	// with; it is safe for concurrent use on its own
+	tlsKeys *tlsdecrypt.KeyLog
+
+	// names holds the hostnames learned from the traffic and reverse
+	// DNS; resolveHosts annotates packets and flows with them
+	names        *names.Cache
+	resolveHosts bool
+
+	// verifyChecksums enables bad-checksum expert info
+	verifyChecksums bool
+	graph           *graph.Graph
+	classifier      *classify.Classifier
+	procs           *procmap.Resolver
+	groups          *hostgroup.Set
+	matrix          *matrix.Matrix
+	coloring        *coloring.Set
+	customFields    *customfields.Set
+
+	// storePolicy decides how much of each packet and stream is kept
+	storePolicy *storepolicy.Set
+
+	// mtu is the link MTU above which packets are flagged as jumbo frames
+	// or offload artifacts; resegment counts such TCP segments as the
+	// packets they were on the wire in flow and protocol statistics
+	mtu       int
+	resegment bool
+
+	// objectLimit is the largest HTTP response body kept whole for
+	// extraction as an object; 0 is stream.DefaultObjectLimit
+	objectLimit int
+
+	// flowExport sends expired flows to a NetFlow v9 or IPFIX collector
+	flowExport *netflow.Exporter
+
+	// Packet replay; replayAllowed gates transmitting on live interfaces
+	replayAllowed bool
+	replay        *replayer
+
+	// File the decode-as table is saved to, if any
+	decodeAsPath string
+
+	// Investigation log
+	notes      []models.Note
+	nextNoteID int
 
 	// Protocol statistics
 	protocolStats map[string]*ProtocolStat
 
+	// Protocol anomalies flagged by the expert pass, by kind
+	anomalies map[string]int
+
+	// Malformed packets quarantined in the current capture, oldest first
+	malformed []models.MalformedPacket
+
 	// Raw packet storage for PCAP export
-	rawPackets []rawPacket
-	linkType   layers.LinkType
+	packets  packetStore
+	linkType layers.LinkType
 }
 
 // New creates a new Engine.
 func New() *Engine {
+	egress := detect.NewEgress()
+	icsStats := icsstats.NewTracker()
+	ntpStats := ntpstats.NewTracker()
+	newlySeen := detect.NewNewlySeen()
+	signatures := rules.NewEngine()
 	e := &Engine{
-		clients:       make(map[Client]bool),
-		flowTracker:   flow.NewTracker(),
-		protocolStats: make(map[string]*ProtocolStat),
+		clients:         make(map[Client]bool),
+		filters:         make(map[Client]*filter.Filter),
+		topics:          make(map[Client]map[string]bool),
+		flowTracker:     flow.NewTracker(),
+		detectors:       detect.Default(egress, detect.NewICSWrite(icsStats), detect.NewNTPRogue(ntpStats), newlySeen, detect.NewSignatures(signatures)),
+		egress:          egress,
+		newlySeen:       newlySeen,
+		signatures:      signatures,
+		geo:             geoip.NewCache(50000),
+		tlsStats:        tlsstats.NewTracker(),
+		icsStats:        icsStats,
+		dnsStats:        dnsstats.NewTracker(),
+		ntpStats:        ntpStats,
+		voip:            voip.NewTracker(),
+		ftp:             ftp.NewTracker(),
+		audit:           audit.New(),
+		profiles:        profiles.New(),
+		schedules:       schedule.New(),
+		tlsKeys:         tlsdecrypt.NewKeyLog(),
+		arpTable:        arptable.NewTracker(),
+		traffic:         trafficstats.NewTracker(),
+		io:              iograph.NewCounter(),
+		services:        dnssd.NewTracker(),
+		quic:            parser.NewQUICCrypto(),
+		names:           names.NewCache(),
+		verifyChecksums: true,
+		mtu:             offload.DefaultMTU,
+		graph:           graph.New(),
+		classifier:      classify.New(),
+		procs:           procmap.New(),
+		groups:          hostgroup.New(),
+		matrix:          matrix.New(),
+		coloring:        coloring.New(),
+		customFields:    customfields.New(),
+		storePolicy:     storepolicy.New(),
+		protocolStats:   make(map[string]*ProtocolStat),
+		anomalies:       make(map[string]int),
 	}
 	return e
 }
@@ -80,6 +288,29 @@ func (e *Engine) UnregisterClient(c Client) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	delete(e.clients, c)
+	delete(e.filters, c)
+	delete(e.topics, c)
+}
+
+// SetDisplayFilter compiles expr and applies it to the packets sent to c.
+// An empty expression removes the client's filter.
+func (e *Engine) SetDisplayFilter(c Client, expr string) error {
+	var f *filter.Filter
+	if strings.TrimSpace(expr) != "" {
+		var err error
+		if f, err = filter.Compile(expr); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if f == nil {
+		delete(e.filters, c)
+	} else {
+		e.filters[c] = f
+	}
+	return nil
 }
 
 // GetInterfaces returns available network interfaces.
@@ -108,60 +339,224 @@ func (e *Engine) StartCapture(req models.StartCaptureRequest) error {
 	}
 	e.mu.Unlock()
 
-	lc, err := capture.NewLiveCapture(req.Interface, req.BPFFilter, req.SnapLen)
+	if req.StopAfterPackets < 0 || req.StopAfterSeconds < 0 || req.StopAfterBytes < 0 {
+		return fmt.Errorf("auto-stop limits must not be negative")
+	}
+	names, err := capture.ResolveInterfaces(req.Interface)
 	if err != nil {
 		return err
 	}
+	var lcs []*capture.LiveCapture
+	for _, name := range names {
+		lc, err := capture.NewLiveCapture(name, capture.Options{
+			BPFFilter: req.BPFFilter,
+			SnapLen:   req.SnapLen,
+			Backend:   req.Backend,
+			Fanout:    req.Fanout,
+		})
+		if err != nil {
+			for _, open := range lcs {
+				open.Close()
+			}
+			return err
+		}
+		lcs = append(lcs, lc)
+	}
+
+	var rec *recorder
+	if req.Record {
+		if rec, err = startRecorder(req, names, lcs, e.SessionStore()); err != nil {
+			for _, lc := range lcs {
+				lc.Close()
+			}
+			return err
+		}
+	}
+
+	as := e.startAutosave(req, strings.Join(names, ", "), lcs)
 
 	// Create and start stream manager
-	smgr := stream.NewManager(e)
+	smgr := e.newStreamManager(false)
 	smgr.Start()
 
+	stop := newAutoStop(req)
+	stopCh := make(chan struct{})
 	e.mu.Lock()
-	e.liveCapture = lc
+	e.liveCaptures = lcs
+	e.recorder = rec
+	e.autosave = as
 	e.capturing = true
 	e.pktCount = 0
 	e.startTime = time.Now()
-	e.stopCh = make(chan struct{})
+	e.stopCh = stopCh
+	e.autoStop = stop
 	e.streamMgr = smgr
-	e.flowTracker.Reset()
-	e.protocolStats = make(map[string]*ProtocolStat)
-	e.rawPackets = nil
-	e.linkType = lc.LinkType()
+	e.resetCaptureState(Retention{
+		MaxPackets: req.MaxPackets,
+		MaxBytes:   req.MaxBytes,
+		MaxAge:     time.Duration(req.MaxDuration) * time.Second,
+	})
+	e.linkType = lcs[0].LinkType()
+	e.captureIface = strings.Join(names, ",")
+	e.captureFilter = req.BPFFilter
+	e.captureSnapLen = req.SnapLen
+	e.resolveHosts = req.ResolveHosts
+	analyzer := expert.NewAnalyzer(e.verifyChecksums, e.mtu)
 	e.mu.Unlock()
 
-	payload, _ := json.Marshal(map[string]string{"interfaceName": req.Interface})
+	payload, _ := json.Marshal(map[string]string{"interfaceName": strings.Join(names, ", ")})
 	e.broadcast(models.WSMessage{Type: "capture_started", Payload: payload})
 
-	go e.captureLoop(lc.Packets())
-	go e.startFlowBroadcaster()
-	go e.startStatsBroadcaster()
+	go e.captureLoop(lcs, rec, analyzer, stop, stopCh)
+	go e.startFlowBroadcaster(stopCh)
+	go e.startStatsBroadcaster(stopCh)
+	if x := e.FlowExporter(); x != nil {
+		go e.flowExportLoop(x, stopCh)
+	}
+	if as != nil {
+		go e.autosaveLoop(as, stopCh)
+	}
+	if stop.after > 0 {
+		go e.autoStopTimer(stop.after, stopCh)
+	}
 
 	return nil
 }
 
 // StopCapture stops the active capture.
 func (e *Engine) StopCapture() {
+	e.stopCapture(StopManual, nil)
+}
+
+// stopCapture stops the active capture for reason, only if it is the one
+// owning stopCh when that is not nil. A capture that stopped by itself is
+// then saved if it was started with SaveOnStop.
+func (e *Engine) stopCapture(reason string, only chan struct{}) {
 	e.mu.Lock()
-	if !e.capturing {
+	if !e.capturing || (only != nil && e.stopCh != only) {
 		e.mu.Unlock()
 		return
 	}
 	e.capturing = false
 	stopCh := e.stopCh
-	lc := e.liveCapture
+	stop := e.autoStop
+	lcs := e.liveCaptures
 	smgr := e.streamMgr
+	rec := e.recorder
+	e.recorder = nil
+	as := e.autosave
+	e.autosave = nil
 	e.mu.Unlock()
 
 	// Broadcast immediately so clients get instant feedback
-	e.broadcast(models.WSMessage{Type: "capture_stopped"})
+	payload, _ := json.Marshal(map[string]string{"reason": reason})
+	e.broadcast(models.WSMessage{Type: "capture_stopped", Payload: payload})
 
 	close(stopCh)
-	lc.Close()
+	for _, lc := range lcs {
+		lc.Close()
+	}
+	if rec != nil {
+		rec.close()
+	}
+	if as != nil {
+		e.checkpoint(as, true)
+	}
 
 	if smgr != nil {
 		smgr.Stop()
 	}
+	if x := e.FlowExporter(); x != nil {
+		e.flushFlowExport(x)
+	}
+	if reason != StopManual && stop.save {
+		e.saveStopped(stop)
+	}
+}
+
+// startRecorder validates the rotation settings in req and opens the first
+// recording file.
+func startRecorder(req models.StartCaptureRequest, names []string, lcs []*capture.LiveCapture, store sessionstore.Store) (*recorder, error) {
+	if req.RecordDir == "" {
+		return nil, fmt.Errorf("no recording directory configured")
+	}
+	if req.RotateMB < 0 || req.RotateSeconds < 0 || req.RotateFiles < 0 {
+		return nil, fmt.Errorf("rotation limits must not be negative")
+	}
+	lt := lcs[0].LinkType()
+	for _, lc := range lcs[1:] {
+		if lc.LinkType() != lt {
+			return nil, fmt.Errorf("cannot record interfaces with different link types to one pcap")
+		}
+	}
+	snapLen := req.SnapLen
+	if snapLen <= 0 {
+		snapLen = capture.DefaultSnapLen
+	}
+	return newRecorder(req.RecordDir, strings.Join(names, ", "), lt, snapLen,
+		int64(req.RotateMB)*1_000_000, time.Duration(req.RotateSeconds)*time.Second, req.RotateFiles, store)
+}
+
+// ActiveRecording returns the file the running capture is being recorded
+// to, or nil when it is not recorded.
+func (e *Engine) ActiveRecording() *RecordingFile {
+	e.mu.Lock()
+	rec := e.recorder
+	e.mu.Unlock()
+	if rec == nil {
+		return nil
+	}
+	return rec.current()
+}
+
+// SetSessionStore sets where saved sessions and finished recording files
+// are kept.
+func (e *Engine) SetSessionStore(s sessionstore.Store) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sessions = s
+}
+
+// SessionStore returns the store set by SetSessionStore, or nil.
+func (e *Engine) SessionStore() sessionstore.Store {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.sessions
+}
+
+// SetAuditLog replaces the in-memory audit trail, typically with one kept
+// in a file.
+func (e *Engine) SetAuditLog(l *audit.Log) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.audit = l
+}
+
+// AuditLog returns the audit trail.
+func (e *Engine) AuditLog() *audit.Log {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.audit
+}
+
+// SetProfiles replaces the in-memory capture profiles, typically with
+// ones kept in a file.
+func (e *Engine) SetProfiles(s *profiles.Store) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.profiles = s
+}
+
+// Profiles returns the capture profiles.
+func (e *Engine) Profiles() *profiles.Store {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.profiles
+}
+
+// TLSKeys returns the TLS key log streams are decrypted with.
+func (e *Engine) TLSKeys() *tlsdecrypt.KeyLog {
+	return e.tlsKeys
 }
 
 // LoadPcapFile reads a pcap file and streams packets to all clients with pacing.
@@ -172,47 +567,26 @@ func (e *Engine) LoadPcapFile(path string) error {
 	}
 	defer reader.Close()
 
+	// Nothing is dropped from a file, so its streams are reassembled
+	// losslessly and kept for the stream views once the load ends
+	smgr := e.newStreamManager(true)
+	smgr.Start()
+
 	e.mu.Lock()
-	e.pktCount = 0
 	e.startTime = time.Time{}
-	e.flowTracker.Reset()
-	e.protocolStats = make(map[string]*ProtocolStat)
-	e.rawPackets = nil
+	e.resetCaptureState(Retention{})
 	e.linkType = reader.LinkType()
+	e.captureIface = filepath.Base(path)
+	e.captureFilter = ""
+	e.captureSnapLen = 0
+	e.streamMgr = smgr
 	e.mu.Unlock()
 
 	source := reader.Packets()
-	var firstTS time.Time
+	fp := e.newFilePipeline(reader.LinkType())
 	batch := 0
 	for pkt := range source.Packets() {
-		if firstTS.IsZero() {
-			firstTS = pkt.Metadata().Timestamp
-		}
-
-		e.mu.Lock()
-		e.pktCount++
-		num := e.pktCount
-		e.rawPackets = append(e.rawPackets, rawPacket{
-			Data:      pkt.Data(),
-			CaptureAt: pkt.Metadata().Timestamp,
-			Length:    pkt.Metadata().Length,
-		})
-		e.mu.Unlock()
-
-		info := parser.Parse(pkt, num, firstTS)
-
-		// Track protocol stats
-		e.trackProtocol(info.Protocol, info.Length)
-
-		// Flow tracking for pcap files too
-		tuple := parser.ExtractFlowTuple(pkt)
-		if tuple.Valid {
-			flowID, _ := e.flowTracker.Track(tuple.SrcIP, tuple.DstIP, tuple.SrcPort, tuple.DstPort, tuple.Protocol, info.Length, tuple.Flags)
-			info.FlowID = flowID
-		}
-
-		payload, _ := json.Marshal(info)
-		e.broadcast(models.WSMessage{Type: "packet", Payload: payload})
+		e.ingestFilePacket(fp, pkt, smgr)
 
 		// Pace: yield every 200 packets so the client can breathe
 		batch++
@@ -221,15 +595,563 @@ func (e *Engine) LoadPcapFile(path string) error {
 			time.Sleep(5 * time.Millisecond)
 		}
 	}
+	smgr.Stop()
+	smgr.Wait()
 
 	return nil
 }
 
+// newStreamManager creates the stream manager for a capture or file,
+// wired to the engine's TLS and detector hooks.
+func (e *Engine) newStreamManager(lossless bool) *stream.Manager {
+	smgr := stream.NewManager(e)
+	smgr.SetLossless(lossless)
+	smgr.SetClientHelloHandler(e.backfillClientHello)
+	smgr.SetDataHandler(e.streamData)
+	smgr.SetKeyLog(e.tlsKeys)
+	e.mu.Lock()
+	smgr.SetObjectLimit(e.objectLimit)
+	e.mu.Unlock()
+	return smgr
+}
+
+// resetCaptureState clears what was learned from the previous capture or
+// file before another starts. The caller holds e.mu.
+func (e *Engine) resetCaptureState(ret Retention) {
+	e.pktCount = 0
+	e.flowTracker.Reset()
+	e.detectors.Reset()
+	e.tlsStats.Reset()
+	e.icsStats.Reset()
+	e.dnsStats.Reset()
+	e.ntpStats.Reset()
+	e.voip.Reset()
+	e.ftp.Reset()
+	if e.flowExport != nil {
+		e.flowExport.Reset()
+	}
+	e.arpTable.Reset()
+	e.names.Reset()
+	e.graph.Reset()
+	e.classifier.Reset()
+	e.matrix.Reset()
+	e.groups.Reset()
+	e.traffic.Reset()
+	e.io.Reset()
+	e.services.Reset()
+	e.quic.Reset()
+	e.notes, e.nextNoteID = nil, 0
+	e.protocolStats = make(map[string]*ProtocolStat)
+	e.anomalies = make(map[string]int)
+	e.malformed = nil
+	e.packets.reset(ret)
+}
+
+// filePipeline is the per-file state packets read from a capture file pass
+// through before processPacket.
+type filePipeline struct {
+	linkType layers.LinkType
+	defrags  *defrag.Defragmenter
+	analyzer *expert.Analyzer
+	h2       *stream.HTTP2Tracker
+	firstTS  time.Time
+}
+
+func (e *Engine) newFilePipeline(linkType layers.LinkType) *filePipeline {
+	e.mu.Lock()
+	analyzer := expert.NewAnalyzer(e.verifyChecksums, e.mtu)
+	e.mu.Unlock()
+	return &filePipeline{
+		linkType: linkType,
+		defrags:  defrag.New(),
+		analyzer: analyzer,
+		h2:       stream.NewHTTP2Tracker(),
+	}
+}
+
+// ingestFilePacket numbers, stores and processes one packet read from a
+// file. Capture times are relative to the file's first packet.
+func (e *Engine) ingestFilePacket(fp *filePipeline, pkt gopacket.Packet, smgr *stream.Manager) {
+	if fp.firstTS.IsZero() {
+		fp.firstTS = pkt.Metadata().Timestamp
+	}
+
+	e.mu.Lock()
+	if e.startTime.IsZero() {
+		e.startTime = fp.firstTS
+	}
+	e.pktCount++
+	num := e.pktCount
+	raw := rawPacket{
+		Number:    num,
+		Data:      pkt.Data(),
+		CaptureAt: pkt.Metadata().Timestamp,
+		Length:    pkt.Metadata().Length,
+		LinkType:  fp.linkType,
+	}
+	malformed := guard("pre-processing", func() {
+		if whole := fp.defrags.Process(pkt); whole != nil {
+			raw.Reassembled, raw.Fragments = whole.Data(), defrag.Fragments(whole)
+			pkt = whole
+		}
+		if inner := tunnel.Decap(pkt); inner != nil {
+			pkt = inner
+		}
+		raw.Expert = fp.analyzer.Analyze(pkt)
+		for _, kind := range raw.Expert.Anomalies {
+			e.anomalies[kind]++
+		}
+		raw.HTTP2, raw.GRPC = fp.h2.Process(pkt)
+		parser.AttachHTTP2(pkt, raw.HTTP2, raw.GRPC)
+		raw.QUIC = parser.DecodeQUIC(pkt, e.quic)
+		parser.AttachQUIC(pkt, raw.QUIC)
+	})
+	e.packets.add(raw)
+	e.mu.Unlock()
+
+	e.processPacket(pkt, num, "", fp.firstTS, smgr, malformed)
+}
+
 // GetFlows returns the current flow table.
 func (e *Engine) GetFlows() []*flow.Flow {
 	return e.flowTracker.GetFlows()
 }
 
+// FlowMetrics returns the RTT, retransmission and throughput detail of
+// the flow with the given ID.
+func (e *Engine) FlowMetrics(id uint64) (flow.FlowMetrics, bool) {
+	return e.flowTracker.Metrics(id)
+}
+
+// GetFlowInfos returns the current flow table in its wire format.
+func (e *Engine) GetFlowInfos() []models.FlowInfo {
+	return e.toFlowInfos(e.flowTracker.GetFlows())
+}
+
+func (e *Engine) toFlowInfos(flows []*flow.Flow) []models.FlowInfo {
+	infos := make([]models.FlowInfo, 0, len(flows))
+	resolve := e.resolvingHosts()
+	for _, f := range flows {
+		fi := models.FlowInfo{
+			ID:            f.ID,
+			SrcIP:         f.SrcIP,
+			DstIP:         f.DstIP,
+			SrcPort:       f.SrcPort,
+			DstPort:       f.DstPort,
+			Protocol:      f.Protocol,
+			Scope:         f.Scope,
+			FwdPath:       f.FwdPath,
+			RevPath:       f.RevPath,
+			PacketCount:   f.PacketCount,
+			ByteCount:     f.ByteCount,
+			FirstSeen:     f.FirstSeen,
+			LastSeen:      f.LastSeen,
+			TCPState:      string(f.TCPState),
+			FwdPackets:    f.FwdPackets,
+			FwdBytes:      f.FwdBytes,
+			RevPackets:    f.RevPackets,
+			RevBytes:      f.RevBytes,
+			AppProtocol:   f.AppProtocol,
+			PID:           f.PID,
+			ProcessName:   f.ProcessName,
+			Tags:          f.Tags,
+			Interfaces:    f.Interfaces,
+			SNI:           f.SNI,
+			JA3:           f.JA3,
+			ICMPErrors:    f.ICMPErrors,
+			LastICMPError: f.LastICMPError,
+			Info:          f.Info,
+			Rate:          f.Rate,
+			RateEnd:       f.RateEnd,
+			Throughput:    f.Throughput,
+			SrcGeo:        e.lookupGeo(f.SrcIP),
+			DstGeo:        e.lookupGeo(f.DstIP),
+		}
+		if m := f.TCP; m != nil {
+			fi.HandshakeRTT, fi.RTT = m.HandshakeRTT, m.RTT
+			fi.Retransmits = m.FwdRetransmits + m.RevRetransmits
+			fi.DupAcks = m.FwdDupAcks + m.RevDupAcks
+			fi.ZeroWindows = m.FwdZeroWindows + m.RevZeroWindows
+		}
+		if resolve {
+			fi.SrcHost, fi.DstHost = e.names.Resolve(f.SrcIP), e.names.Resolve(f.DstIP)
+		}
+		// HTTPS to a public DoH resolver is DNS, whatever ALPN said
+		if parser.IsDoHResolver(f.SNI) {
+			fi.AppProtocol = parser.LabelDoH
+		}
+		if fi.AppProtocol == "" {
+			r := e.classifier.Classify(f.ID)
+			fi.AppProtocol, fi.AppGuess, fi.AppGuessConf = r.Protocol, r.Guess, r.Confidence
+		}
+		infos = append(infos, fi)
+	}
+	return infos
+}
+
+// SetTrustedAddrs sets the MAC/IP addresses the detectors should treat as
+// known infrastructure (routers, VRRP/HSRP peers).
+func (e *Engine) SetTrustedAddrs(addrs []string) {
+	e.detectors.Exclude(addrs)
+}
+
+// SetGeoIP installs the GeoIP/ASN database used to annotate packets and
+// flows and to enforce the egress policy.
+func (e *Engine) SetGeoIP(db *geoip.DB) {
+	e.geo.SetDB(db)
+	e.egress.SetGeoIP(db)
+}
+
+// GeoLookup returns the location of ip, and false if no GeoIP database is
+// loaded.
+func (e *Engine) GeoLookup(ip net.IP) (geoip.Location, bool) {
+	if !e.geo.Loaded() {
+		return geoip.Location{}, false
+	}
+	return e.geo.Lookup(ip), true
+}
+
+// lookupGeo returns the enrichment for a public address, or nil.
+func (e *Engine) lookupGeo(addr string) *models.GeoInfo {
+	loc := e.geo.Lookup(net.ParseIP(addr))
+	if loc.Empty() {
+		return nil
+	}
+	return &models.GeoInfo{
+		Country:     loc.Country,
+		CountryName: loc.CountryName,
+		City:        loc.City,
+		ASN:         loc.ASN,
+		ASOrg:       loc.ASOrg,
+	}
+}
+
+// annotateExpert copies the expert info attached to pkt onto info.
+func annotateExpert(pkt gopacket.Packet, info *models.PacketInfo) {
+	r := expert.From(pkt)
+	info.Annotations, info.Severity = r.Annotations, r.Severity
+}
+
+// SetVerifyChecksums enables or disables bad-checksum expert info for
+// captures started afterwards.
+func (e *Engine) SetVerifyChecksums(on bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.verifyChecksums = on
+}
+
+// SetMTU sets the link MTU used to flag oversized packets, for captures
+// started afterwards. Zero disables the check.
+func (e *Engine) SetMTU(mtu int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mtu = mtu
+}
+
+// SetHTTPObjectLimit sets the largest HTTP response body extracted whole
+// from the streams of captures started afterwards. Zero is the default.
+func (e *Engine) SetHTTPObjectLimit(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.objectLimit = n
+}
+
+// SetResegmentOffload makes flow and protocol statistics count a TCP
+// segment larger than the MTU as the MSS-sized segments it was split into
+// on the wire, rather than as one giant packet.
+func (e *Engine) SetResegmentOffload(on bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resegment = on
+}
+
+// annotateGeo sets the GeoIP enrichment of the packet's IP endpoints.
+func (e *Engine) annotateGeo(pkt gopacket.Packet, info *models.PacketInfo) {
+	if !e.geo.Loaded() {
+		return
+	}
+	if tuple := parser.ExtractFlowTuple(pkt); tuple.Valid {
+		info.SrcGeo = e.lookupGeo(tuple.SrcIP)
+		info.DstGeo = e.lookupGeo(tuple.DstIP)
+	}
+}
+
+// resolvingHosts reports whether packets and flows get host names.
+func (e *Engine) resolvingHosts() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.resolveHosts
+}
+
+// annotateHosts sets the host names of the packet's IP endpoints. Names
+// not known yet are looked up in the background for later packets.
+func (e *Engine) annotateHosts(pkt gopacket.Packet, info *models.PacketInfo) {
+	if !e.resolvingHosts() {
+		return
+	}
+	if tuple := parser.ExtractFlowTuple(pkt); tuple.Valid {
+		info.SrcHost = e.names.Resolve(tuple.SrcIP)
+		info.DstHost = e.names.Resolve(tuple.DstIP)
+	}
+}
+
+// quotedFlow returns the flow of the datagram an ICMP error in pkt quotes,
+// or zero.
+func (e *Engine) quotedFlow(pkt gopacket.Packet) uint64 {
+	q := parser.ExtractICMPQuote(pkt)
+	if q == nil {
+		return 0
+	}
+	id, _ := e.flowTracker.Lookup(q.SrcIP, q.DstIP, q.SrcPort, q.DstPort, q.Protocol, parser.FlowScope(pkt))
+	return id
+}
+
+// trackICMPError counts an ICMP error in pkt on the flow of the datagram
+// it quotes and returns that flow's ID, or 0.
+func (e *Engine) trackICMPError(pkt gopacket.Packet) uint64 {
+	q := parser.ExtractICMPQuote(pkt)
+	if q == nil {
+		return 0
+	}
+	id, _ := e.flowTracker.ICMPError(q.SrcIP, q.DstIP, q.SrcPort, q.DstPort, q.Protocol, parser.FlowScope(pkt), q.Error)
+	return id
+}
+
+// GetEgressPolicy returns the destination country/ASN policy.
+func (e *Engine) GetEgressPolicy() detect.EgressPolicy {
+	return e.egress.Policy()
+}
+
+// SetEgressPolicy replaces the destination country/ASN policy.
+func (e *Engine) SetEgressPolicy(p detect.EgressPolicy) {
+	e.egress.SetPolicy(p)
+}
+
+// LoadSeenMemory loads the newly-observed domain/IP memory from path and
+// keeps it saved there.
+func (e *Engine) LoadSeenMemory(path string) error {
+	return e.newlySeen.Load(path)
+}
+
+// GetNewlySeenConfig returns the newly-observed domain/IP alert settings.
+func (e *Engine) GetNewlySeenConfig() detect.NewlySeenConfig {
+	return e.newlySeen.Config()
+}
+
+// SetNewlySeenConfig replaces the newly-observed domain/IP alert settings.
+func (e *Engine) SetNewlySeenConfig(cfg detect.NewlySeenConfig) {
+	e.newlySeen.SetConfig(cfg)
+}
+
+// NewlySeenCounts returns the size of the newly-observed memory and when
+// it started learning.
+func (e *Engine) NewlySeenCounts() (domains, ips int, since time.Time) {
+	return e.newlySeen.Counts()
+}
+
+// GetGraph returns the host communication graph, optionally limited to the
+// last window of capture time and to the limit heaviest edges.
+func (e *Engine) GetGraph(window time.Duration, limit int) graph.Snapshot {
+	return e.graph.Snapshot(window, limit)
+}
+
+// GetTrafficMatrix returns subnet-to-subnet and subnet-to-internet traffic.
+func (e *Engine) GetTrafficMatrix() matrix.Snapshot {
+	return e.matrix.Snapshot()
+}
+
+// SetSubnets defines the internal subnets of the traffic matrix and clears
+// its counts.
+func (e *Engine) SetSubnets(subnets []matrix.Subnet) error {
+	return e.matrix.SetSubnets(subnets)
+}
+
+// GetHostGroups returns the host group definitions.
+func (e *Engine) GetHostGroups() []hostgroup.Group {
+	return e.groups.Groups()
+}
+
+// SetHostGroups replaces the host group definitions used to tag packets,
+// flows and alerts.
+func (e *Engine) SetHostGroups(groups []hostgroup.Group) error {
+	return e.groups.SetGroups(groups)
+}
+
+// GetHostGroupStats returns the traffic seen per host group.
+func (e *Engine) GetHostGroupStats() []hostgroup.Stat {
+	return e.groups.Stats()
+}
+
+// GetDNSStats returns per-domain DNS statistics; see dnsstats.Tracker.Stats.
+func (e *Engine) GetDNSStats(sortBy string, limit int, newWithin time.Duration) dnsstats.Stats {
+	return e.dnsStats.Stats(sortBy, limit, newWithin)
+}
+
+// GetProtocolHierarchy returns the protocol hierarchy of the capture.
+func (e *Engine) GetProtocolHierarchy() *trafficstats.Node {
+	return e.traffic.Hierarchy()
+}
+
+// GetEndpoints returns a table of the endpoints of kind; see
+// trafficstats.Tracker.Endpoints.
+func (e *Engine) GetEndpoints(kind, sortBy string, limit int) (trafficstats.Table[trafficstats.Endpoint], bool) {
+	return e.traffic.Endpoints(kind, sortBy, limit)
+}
+
+// GetConversations returns a table of the conversations of kind; see
+// trafficstats.Tracker.Conversations.
+func (e *Engine) GetConversations(kind, sortBy string, limit int) (trafficstats.Table[trafficstats.Conversation], bool) {
+	return e.traffic.Conversations(kind, sortBy, limit)
+}
+
+// GetIOGraph returns packets and bytes per interval of capture time, split
+// by protocol if byProtocol. With a display filter expr, only the retained
+// packets that match are counted.
+func (e *Engine) GetIOGraph(interval time.Duration, byProtocol bool, expr string) (iograph.Series, error) {
+	if strings.TrimSpace(expr) == "" {
+		return e.io.Series(interval, byProtocol), nil
+	}
+	f, err := filter.Compile(expr)
+	if err != nil {
+		return iograph.Series{}, err
+	}
+	e.mu.Lock()
+	startTime := e.startTime
+	smgr := e.streamMgr
+	pkts := e.packets.all()
+	e.mu.Unlock()
+
+	c := iograph.NewCounter()
+	for _, p := range pkts {
+		pkt, info := e.storedInfo(p, startTime, smgr)
+		if f.Match(pkt, &info) {
+			c.Add(p.CaptureAt, info.Protocol, 1, info.Length)
+		}
+	}
+	return c.Series(interval, byProtocol), nil
+}
+
+// GetDiscoveredServices returns the services announced over mDNS/DNS-SD,
+// only those of service type typ if it is not empty.
+func (e *Engine) GetDiscoveredServices(typ string) []dnssd.Service {
+	return e.services.Services(typ)
+}
+
+// GetARPTable returns the current IPv4-to-MAC bindings learned from ARP.
+func (e *Engine) GetARPTable() []arptable.Entry {
+	return e.arpTable.Table()
+}
+
+// GetARPTimeline returns the MAC binding history of ip, or of every
+// detected default gateway when ip is empty.
+func (e *Engine) GetARPTimeline(ip string) []arptable.Entry {
+	return e.arpTable.Timeline(ip)
+}
+
+// GetNames returns the hostnames known for addresses, from the traffic
+// and, when resolution is on, reverse DNS.
+func (e *Engine) GetNames() []names.Entry {
+	return e.names.Table()
+}
+
+// GetNTPStats returns per-server NTP statistics.
+func (e *Engine) GetNTPStats() ntpstats.Stats {
+	return e.ntpStats.Stats()
+}
+
+// SetNTPServers sets the time servers clients are expected to use.
+func (e *Engine) SetNTPServers(servers []string) {
+	e.ntpStats.SetAllowed(servers)
+}
+
+// GetVoIPCalls returns the SIP calls seen and their media streams.
+func (e *Engine) GetVoIPCalls() []voip.Call {
+	return e.voip.Calls()
+}
+
+// GetFTPTransfers returns the FTP file transfers seen.
+func (e *Engine) GetFTPTransfers() []ftp.Transfer {
+	return e.ftp.Transfers()
+}
+
+// FTPTransferFile returns an FTP transfer and the file it carried, as
+// reassembled from its data connection.
+func (e *Engine) FTPTransferFile(id int) (ftp.Transfer, []byte, error) {
+	tr, ok := e.ftp.Transfer(id)
+	if !ok {
+		return ftp.Transfer{}, nil, ftp.ErrNotFound
+	}
+	if tr.StreamID == 0 {
+		return tr, nil, stream.ErrStreamNotFound
+	}
+	// The data connection carries the file one way only
+	data, err := e.ExportStream(tr.StreamID, stream.ExportOptions{Format: stream.FormatRaw, Direction: stream.DirBoth})
+	return tr, data, err
+}
+
+// GetColoringRules returns the packet coloring rules in order.
+func (e *Engine) GetColoringRules() []coloring.Rule {
+	return e.coloring.Rules()
+}
+
+// SetColoringRules replaces the packet coloring rules.
+func (e *Engine) SetColoringRules(rules []coloring.Rule) error {
+	return e.coloring.SetRules(rules)
+}
+
+// GetCustomFieldRules returns the field extraction rules in order.
+func (e *Engine) GetCustomFieldRules() []customfields.Rule {
+	return e.customFields.Rules()
+}
+
+// SetCustomFieldRules replaces the field extraction rules. They apply to
+// packets already retained as well as new ones.
+func (e *Engine) SetCustomFieldRules(rules []customfields.Rule) error {
+	return e.customFields.SetRules(rules)
+}
+
+// GetCustomFieldValues returns the values the extraction rules find in the
+// retained packets, per field, with at most limit values each if limit is
+// positive.
+func (e *Engine) GetCustomFieldValues(limit int) []customfields.FieldValues {
+	e.mu.Lock()
+	startTime := e.startTime
+	smgr := e.streamMgr
+	pkts := e.packets.all()
+	e.mu.Unlock()
+
+	r := customfields.NewReport()
+	for _, p := range pkts {
+		_, info := e.storedInfo(p, startTime, smgr)
+		for _, l := range info.Layers {
+			if l.Name == customfields.LayerName {
+				r.Add(p.Number, l.Fields)
+			}
+		}
+	}
+	return r.Fields(limit)
+}
+
+// GetICSStats returns per-device Modbus, DNP3 and S7comm statistics.
+func (e *Engine) GetICSStats() icsstats.Stats {
+	return e.icsStats.Stats()
+}
+
+// SetICSWriters sets the hosts allowed to write to ICS devices.
+func (e *Engine) SetICSWriters(writers []string) {
+	e.icsStats.SetWriters(writers)
+}
+
+// GetTLSInventory returns per-server TLS handshake and resumption statistics.
+func (e *Engine) GetTLSInventory() []tlsstats.ServerStats {
+	return e.tlsStats.Servers()
+}
+
+// GetAlerts returns the alerts raised by the server-side detectors.
+func (e *Engine) GetAlerts() []models.Alert {
+	return e.detectors.Alerts()
+}
+
 // GetStreamData returns reassembled stream data by ID.
 func (e *Engine) GetStreamData(id uint64) *stream.StreamDataResponse {
 	e.mu.Lock()
@@ -242,41 +1164,224 @@ func (e *Engine) GetStreamData(id uint64) *stream.StreamDataResponse {
 	return smgr.GetStreamData(id)
 }
 
-// ExportPcap writes all stored packets as a PCAP file to the given writer.
-func (e *Engine) ExportPcap(w io.Writer) error {
+// ExportStream dumps the reassembled contents of a stream in the format
+// and direction opts selects.
+func (e *Engine) ExportStream(id uint64, opts stream.ExportOptions) ([]byte, error) {
 	e.mu.Lock()
-	pkts := make([]rawPacket, len(e.rawPackets))
-	copy(pkts, e.rawPackets)
-	lt := e.linkType
+	smgr := e.streamMgr
 	e.mu.Unlock()
 
+	if smgr == nil {
+		return nil, stream.ErrStreamNotFound
+	}
+	return smgr.Export(id, opts)
+}
+
+// StreamObjects returns the HTTP objects carried by a stream.
+func (e *Engine) StreamObjects(id uint64) ([]stream.HTTPObject, error) {
+	e.mu.Lock()
+	smgr := e.streamMgr
+	e.mu.Unlock()
+
+	if smgr == nil {
+		return nil, stream.ErrStreamNotFound
+	}
+	return smgr.Objects(id)
+}
+
+// StreamObject returns the HTTP object of a stream at index.
+func (e *Engine) StreamObject(id uint64, index int) (*stream.HTTPObject, error) {
+	e.mu.Lock()
+	smgr := e.streamMgr
+	e.mu.Unlock()
+
+	if smgr == nil {
+		return nil, stream.ErrStreamNotFound
+	}
+	return smgr.Object(id, index)
+}
+
+// ExportOptions trims packets on export, like editcap -s, to make smaller
+// files for sharing. Timestamps and original lengths are kept.
+type ExportOptions struct {
+	PacketSelection
+	SnapLen      int  // keep at most this many bytes per packet; 0 keeps all
+	StripPayload bool // drop everything after the transport (or IP) header
+}
+
+// packetData returns the bytes of p to export.
+func (o ExportOptions) packetData(p rawPacket) []byte {
+	data := p.Data
+	if o.StripPayload {
+		data = data[:headerLen(data, p.LinkType)]
+	}
+	if o.SnapLen > 0 && len(data) > o.SnapLen {
+		data = data[:o.SnapLen]
+	}
+	return data
+}
+
+// snapLen returns the snapshot length to record in file headers, given the
+// capture's own (0 if unknown).
+func (o ExportOptions) snapLen(capture int) int {
+	if o.SnapLen > 0 && (capture <= 0 || o.SnapLen < capture) {
+		return o.SnapLen
+	}
+	return capture
+}
+
+// headerLen returns the length of the protocol headers at the start of
+// data up to and including the transport header, or the network header
+// for packets without one (such as non-first IP fragments). Frames with
+// neither are kept whole.
+func headerLen(data []byte, lt layers.LinkType) int {
+	pkt := gopacket.NewPacket(data, lt, gopacket.NoCopy)
+	var last gopacket.Layer
+	if tl := pkt.TransportLayer(); tl != nil {
+		last = tl
+	} else if nl := pkt.NetworkLayer(); nl != nil {
+		last = nl
+	} else {
+		return len(data)
+	}
+	n := 0
+	for _, l := range pkt.Layers() {
+		n += len(l.LayerContents())
+		if l == last {
+			break
+		}
+	}
+	return min(n, len(data))
+}
+
+// writePcapHeader writes a microsecond pcap file header, as
+// pcapgo.Writer.WriteFileHeader does but with the link type mapped by
+// parser.FileLinkType.
+func writePcapHeader(w io.Writer, snapLen int, lt layers.LinkType) error {
+	var buf [pcapFileHeaderLen]byte
+	le := binary.LittleEndian
+	le.PutUint32(buf[0:], 0xa1b2c3d4)
+	le.PutUint16(buf[4:], 2)
+	le.PutUint16(buf[6:], 4)
+	le.PutUint32(buf[16:], uint32(snapLen))
+	le.PutUint32(buf[20:], parser.FileLinkType(lt))
+	_, err := w.Write(buf[:])
+	return err
+}
+
+// ExportPcap writes the stored packets opts selects, all of them by
+// default, as a PCAP file to the given writer.
+func (e *Engine) ExportPcap(w io.Writer, opts ExportOptions) error {
+	pkts, err := e.selectPackets(opts.PacketSelection)
+	if err != nil {
+		return err
+	}
 	if len(pkts) == 0 {
 		return fmt.Errorf("no packets to export")
 	}
+	lt := pkts[0].LinkType
+	for _, p := range pkts {
+		if p.LinkType != lt {
+			return fmt.Errorf("packets were captured on interfaces with different link types; export as pcapng")
+		}
+	}
 
 	writer := pcapgo.NewWriter(w)
-	if err := writer.WriteFileHeader(65535, lt); err != nil {
+	if err := writePcapHeader(w, opts.snapLen(65535), lt); err != nil {
 		return fmt.Errorf("write pcap header: %w", err)
 	}
 
 	for _, p := range pkts {
+		data := opts.packetData(p)
 		ci := gopacket.CaptureInfo{
 			Timestamp:     p.CaptureAt,
-			CaptureLength: len(p.Data),
+			CaptureLength: len(data),
 			Length:        p.Length,
 		}
-		if err := writer.WritePacket(ci, p.Data); err != nil {
+		if err := writer.WritePacket(ci, data); err != nil {
 			return fmt.Errorf("write packet: %w", err)
 		}
 	}
 	return nil
 }
 
-// PacketCount returns the current packet count.
+// packetSummaries re-decodes the stored raw packets into column summaries.
+func (e *Engine) packetSummaries() []models.PacketSummary {
+	e.mu.Lock()
+	pkts := e.packets.all()
+	startTime := e.startTime
+	smgr := e.streamMgr
+	e.mu.Unlock()
+
+	out := make([]models.PacketSummary, 0, len(pkts))
+	for _, p := range pkts {
+		_, info := e.storedInfo(p, startTime, smgr)
+		out = append(out, info.Summary())
+	}
+	return out
+}
+
+// storedInfo re-parses a stored packet with the flow, stream and host group
+// annotations it was given when captured.
+func (e *Engine) storedInfo(p rawPacket, startTime time.Time, smgr *stream.Manager) (gopacket.Packet, models.PacketInfo) {
+	pkt := decodeRaw(p)
+	info := parser.Parse(pkt, p.Number, startTime)
+	info.Tags = e.groups.Tags(pkt)
+	info.Interface = p.Iface
+	info.Reassembled = defrag.Fragments(pkt)
+	annotateExpert(pkt, &info)
+	e.annotateGeo(pkt, &info)
+	e.annotateHosts(pkt, &info)
+	if tuple := parser.ExtractFlowTuple(pkt); tuple.Valid {
+		info.FlowID, _ = e.flowTracker.Lookup(tuple.SrcIP, tuple.DstIP, tuple.SrcPort, tuple.DstPort, tuple.Protocol, tuple.Scope)
+	}
+	info.QuotedFlowID = e.quotedFlow(pkt)
+	if tl := pkt.TransportLayer(); tl != nil && smgr != nil && pkt.NetworkLayer() != nil {
+		info.StreamID = smgr.GetStreamID(pkt.NetworkLayer().NetworkFlow(), tl.TransportFlow())
+	}
+	e.customFields.Apply(pkt, &info)
+	info.Color = e.coloring.Match(pkt, &info)
+	return pkt, info
+}
+
+// decodeRaw turns a stored raw packet back into a gopacket.Packet. Packets
+// that completed an IP datagram decode as the reassembled datagram, and
+// tunnelled packets as the packet they carry.
+func decodeRaw(p rawPacket) gopacket.Packet {
+	if p.Reassembled != nil {
+		pkt := gopacket.NewPacket(p.Reassembled, p.LinkType, gopacket.Default)
+		md := pkt.Metadata()
+		md.Timestamp = p.CaptureAt
+		md.CaptureLength = len(p.Reassembled)
+		md.Length = len(p.Reassembled)
+		defrag.Mark(pkt, p.Fragments)
+		if inner := tunnel.Decap(pkt); inner != nil {
+			pkt = inner
+		}
+		expert.Attach(pkt, p.Expert)
+		parser.AttachHTTP2(pkt, p.HTTP2, p.GRPC)
+		parser.AttachQUIC(pkt, p.QUIC)
+		return pkt
+	}
+	pkt := gopacket.NewPacket(p.Data, p.LinkType, gopacket.Default)
+	md := pkt.Metadata()
+	md.Timestamp = p.CaptureAt
+	md.CaptureLength = len(p.Data)
+	md.Length = p.Length
+	if inner := tunnel.Decap(pkt); inner != nil {
+		pkt = inner
+	}
+	expert.Attach(pkt, p.Expert)
+	parser.AttachHTTP2(pkt, p.HTTP2, p.GRPC)
+	parser.AttachQUIC(pkt, p.QUIC)
+	return pkt
+}
+
+// PacketCount returns the number of packets currently retained.
 func (e *Engine) PacketCount() int {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	return len(e.rawPackets)
+	return e.packets.len()
 }
 
 // GetProtocolStats returns the current protocol statistics.
@@ -290,6 +1395,23 @@ func (e *Engine) GetProtocolStats() map[string]*ProtocolStat {
 	return result
 }
 
+// GetAnomalyCounts returns how many protocol anomalies of each kind the
+// current capture has flagged.
+func (e *Engine) GetAnomalyCounts() map[string]int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.copyAnomalies()
+}
+
+// copyAnomalies copies the anomaly counts; the caller holds e.mu.
+func (e *Engine) copyAnomalies() map[string]int {
+	counts := make(map[string]int, len(e.anomalies))
+	for k, v := range e.anomalies {
+		counts[k] = v
+	}
+	return counts
+}
+
 // BroadcastStreamEvent implements stream.Broadcaster.
 func (e *Engine) BroadcastStreamEvent(eventType string, payload json.RawMessage) {
 	evt := models.StreamEvent{
@@ -300,7 +1422,23 @@ func (e *Engine) BroadcastStreamEvent(eventType string, payload json.RawMessage)
 	e.broadcast(models.WSMessage{Type: "stream_event", Payload: data})
 }
 
-func (e *Engine) trackProtocol(proto string, length int) {
+// backfillClientHello records the SNI and JA3 of a ClientHello reassembled
+// by the stream manager on its flow.
+func (e *Engine) backfillClientHello(client, server string, clientPort, serverPort uint16, hello *parser.TLSClientHelloInfo) {
+	e.flowTracker.SetStreamTLS(client, server, clientPort, serverPort, hello.SNI, hello.JA3Hash)
+}
+
+// streamData passes reassembled TCP data to the stream detectors and
+// broadcasts what they raise.
+func (e *Engine) streamData(id uint64, client, server string, clientPort, serverPort uint16, fromClient bool, data []byte, ts time.Time) {
+	flowID, _ := e.flowTracker.LookupTuple(client, server, clientPort, serverPort, "TCP")
+	for _, a := range e.detectors.Stream(id, client, server, clientPort, serverPort, fromClient, data, ts, flowID) {
+		payload, _ := json.Marshal(a)
+		e.broadcast(models.WSMessage{Type: "alert", Payload: payload})
+	}
+}
+
+func (e *Engine) trackProtocol(proto string, packets, length int) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	stat, ok := e.protocolStats[proto]
@@ -308,27 +1446,33 @@ func (e *Engine) trackProtocol(proto string, length int) {
 		stat = &ProtocolStat{}
 		e.protocolStats[proto] = stat
 	}
-	stat.PacketCount++
+	stat.PacketCount += packets
 	stat.ByteCount += int64(length)
 }
 
-func (e *Engine) captureLoop(source *gopacket.PacketSource) {
+// captureLoop processes the packets of a live capture until stopCh is
+// closed. analyzer is built from the settings the capture started with.
+func (e *Engine) captureLoop(lcs []*capture.LiveCapture, rec *recorder, analyzer *expert.Analyzer, stop autoStop, stopCh chan struct{}) {
+	// One reader per interface; packets are processed one at a time in
+	// arrival order since stream reassembly is not safe for concurrent use.
+	merged := make(chan capturedPacket, 256)
+	for _, lc := range lcs {
+		go e.readInterface(lc, merged, stopCh)
+	}
+	defrags := defrag.New()
+	h2 := stream.NewHTTP2Tracker()
+	var captured int64
+
 	for {
+		var cp capturedPacket
 		select {
-		case <-e.stopCh:
+		case <-stopCh:
 			return
-		default:
+		case cp = <-merged:
 		}
-
-		pkt, err := source.NextPacket()
-		if err != nil {
-			select {
-			case <-e.stopCh:
-				return
-			default:
-			}
-			log.Printf("Packet read error: %v", err)
-			continue
+		pkt := cp.pkt
+		if rec != nil {
+			rec.write(pkt.Metadata().CaptureInfo, pkt.Data())
 		}
 
 		e.mu.Lock()
@@ -336,111 +1480,321 @@ func (e *Engine) captureLoop(source *gopacket.PacketSource) {
 		num := e.pktCount
 		startTime := e.startTime
 		smgr := e.streamMgr
-		e.rawPackets = append(e.rawPackets, rawPacket{
+		raw := rawPacket{
+			Number:    num,
 			Data:      pkt.Data(),
 			CaptureAt: pkt.Metadata().Timestamp,
 			Length:    pkt.Metadata().Length,
+			Iface:     cp.iface,
+			LinkType:  cp.linkType,
+		}
+		malformed := guard("pre-processing", func() {
+			if whole := defrags.Process(pkt); whole != nil {
+				raw.Reassembled, raw.Fragments = whole.Data(), defrag.Fragments(whole)
+				pkt = whole
+			}
+			if inner := tunnel.Decap(pkt); inner != nil {
+				pkt = inner
+			}
+			raw.Expert = analyzer.Analyze(pkt)
+			for _, kind := range raw.Expert.Anomalies {
+				e.anomalies[kind]++
+			}
+			raw.HTTP2, raw.GRPC = h2.Process(pkt)
+			parser.AttachHTTP2(pkt, raw.HTTP2, raw.GRPC)
+			raw.QUIC = parser.DecodeQUIC(pkt, e.quic)
+			parser.AttachQUIC(pkt, raw.QUIC)
 		})
+		e.packets.add(raw)
 		e.mu.Unlock()
 
-		info := parser.Parse(pkt, num, startTime)
+		e.processPacket(pkt, num, cp.iface, startTime, smgr, malformed)
+
+		captured += int64(len(cp.pkt.Data()))
+		if reason := stop.reached(num, captured); reason != "" {
+			// Stopping waits for the readers this loop drains
+			go e.stopCapture(reason, stopCh)
+			return
+		}
+	}
+}
+
+// readInterface reads packets from one live capture into out until
+// stopCh, the capture's own, is closed.
+func (e *Engine) readInterface(lc *capture.LiveCapture, out chan<- capturedPacket, stopCh <-chan struct{}) {
+	source := lc.Packets()
+	iface, lt := lc.Interface(), lc.LinkType()
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
 
-		// Track protocol stats
-		e.trackProtocol(info.Protocol, info.Length)
+		pkt, err := source.NextPacket()
+		if err != nil {
+			select {
+			case <-stopCh:
+				return
+			default:
+			}
+			log.Printf("Packet read error on %s: %v", iface, err)
+			continue
+		}
 
-		// Flow tracking
-		tuple := parser.ExtractFlowTuple(pkt)
-		if tuple.Valid {
-			flowID, _ := e.flowTracker.Track(tuple.SrcIP, tuple.DstIP, tuple.SrcPort, tuple.DstPort, tuple.Protocol, info.Length, tuple.Flags)
-			info.FlowID = flowID
+		select {
+		case out <- capturedPacket{pkt: pkt, iface: iface, linkType: lt}:
+		case <-stopCh:
+			return
 		}
+	}
+}
 
-		// Stream reassembly — feed TCP packets
-		if tcpLayer := pkt.Layer(layers.LayerTypeTCP); tcpLayer != nil && smgr != nil {
-			smgr.Feed(pkt)
+// processPacket parses a packet, runs it through flow tracking, stream
+// reassembly and the detectors, then broadcasts it and any new alerts.
+// Malformed packets are quarantined instead: those the parser flags, those
+// an earlier stage panicked on (malformed is why) and those a stage here
+// panics on.
+func (e *Engine) processPacket(pkt gopacket.Packet, num int, iface string, startTime time.Time, smgr *stream.Manager, malformed string) {
+	info := parser.Parse(pkt, num, startTime)
+	info.Interface = iface
+	if malformed != "" && info.Malformed == "" {
+		parser.MarkMalformed(&info, malformed)
+	}
+	if info.Malformed != "" {
+		e.quarantine(pkt, &info)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			parser.MarkMalformed(&info, fmt.Sprintf("processing panic: %v", r))
+			e.quarantine(pkt, &info)
+		}
+	}()
 
-			if pkt.NetworkLayer() != nil {
-				streamID := smgr.GetStreamID(pkt.NetworkLayer().NetworkFlow(), tcpLayer.(*layers.TCP).TransportFlow())
-				if streamID > 0 {
-					info.StreamID = streamID
-				}
+	info.Tags = e.groups.Tags(pkt)
+	info.Reassembled = defrag.Fragments(pkt)
+	annotateExpert(pkt, &info)
+	e.annotateGeo(pkt, &info)
+	e.annotateHosts(pkt, &info)
+
+	// Oversized offload segments optionally count as what went on the wire
+	packets, length := 1, info.Length
+	e.mu.Lock()
+	resegment, mtu := e.resegment, e.mtu
+	e.mu.Unlock()
+	if resegment {
+		if o, ok := offload.Inspect(pkt, mtu); ok && o.TCP {
+			packets, length = o.Segments, o.WireBytes
+		}
+	}
+
+	// Track protocol stats
+	e.trackProtocol(info.Protocol, packets, length)
+	e.traffic.Observe(pkt, info.Protocol, packets, length)
+	e.io.Add(pkt.Metadata().Timestamp, info.Protocol, packets, length)
+	e.groups.Count(info.Tags, length)
+
+	// Subnet traffic matrix
+	if nl := pkt.NetworkLayer(); nl != nil {
+		src, dst := nl.NetworkFlow().Endpoints()
+		if src.EndpointType() == layers.EndpointIPv4 || src.EndpointType() == layers.EndpointIPv6 {
+			e.matrix.Add(net.IP(src.Raw()), net.IP(dst.Raw()), length)
+		}
+	}
+
+	// Flow tracking — fragments still being reassembled have no ports yet and
+	// are counted once the whole datagram is rebuilt
+	tuple := parser.ExtractFlowTuple(pkt)
+	if tuple.Valid && !defrag.IsFragment(pkt) {
+		flowID, _ := e.flowTracker.Track(tuple.SrcIP, tuple.DstIP, tuple.SrcPort, tuple.DstPort, tuple.Protocol, tuple.Scope, packets, length, tuple.Flags, tuple.Segment)
+		info.FlowID = flowID
+		info.QuotedFlowID = e.trackICMPError(pkt)
+		if len(info.Tags) > 0 {
+			e.flowTracker.Tag(tuple.SrcIP, tuple.DstIP, tuple.SrcPort, tuple.DstPort, tuple.Protocol, tuple.Scope, info.Tags)
+		}
+		if iface != "" {
+			e.flowTracker.SeenOn(tuple.SrcIP, tuple.DstIP, tuple.SrcPort, tuple.DstPort, tuple.Protocol, tuple.Scope, iface)
+		}
+		if tuple.Path != "" {
+			e.flowTracker.SetPath(tuple.SrcIP, tuple.DstIP, tuple.SrcPort, tuple.DstPort, tuple.Protocol, tuple.Scope, tuple.Path)
+		}
+		e.graph.Add(tuple.SrcIP, tuple.DstIP, info.Protocol, length, pkt.Metadata().Timestamp)
+
+		// Features for the statistical fallback when the app protocol is unknown
+		payloadLen := 0
+		if tl := pkt.TransportLayer(); tl != nil {
+			payloadLen = len(tl.LayerPayload())
+		}
+		e.classifier.Observe(flowID, fmt.Sprintf("%s:%d", tuple.SrcIP, tuple.SrcPort), info.Protocol, payloadLen, pkt.Metadata().Timestamp)
+
+		// Label the flow with the protocol negotiated via TLS ALPN
+		if alpn := parser.NegotiatedALPN(pkt); alpn != "" {
+			e.flowTracker.Label(tuple.SrcIP, tuple.DstIP, tuple.SrcPort, tuple.DstPort, tuple.Protocol, tuple.Scope, parser.ALPNLabel(alpn))
+		}
+		if label := parser.EncryptedDNS(pkt); label != "" {
+			e.flowTracker.Label(tuple.SrcIP, tuple.DstIP, tuple.SrcPort, tuple.DstPort, tuple.Protocol, tuple.Scope, label)
+		}
+
+		// A ClientHello split across segments is picked up by the stream
+		// manager once reassembled
+		if app := pkt.ApplicationLayer(); app != nil && tuple.Protocol == "TCP" {
+			if hello, _ := parser.ParseTLSClientHelloStream(app.LayerContents()); hello != nil {
+				e.flowTracker.SetTLS(tuple.SrcIP, tuple.DstIP, tuple.SrcPort, tuple.DstPort, tuple.Protocol, tuple.Scope, hello.SNI, hello.JA3Hash)
+			}
+		}
+	}
+
+	// Stream reassembly — feed TCP packets, follow UDP conversations
+	if pkt.Layer(layers.LayerTypeUDP) != nil && smgr != nil {
+		info.StreamID = smgr.AddUDP(pkt)
+	}
+	if tcpLayer := pkt.Layer(layers.LayerTypeTCP); tcpLayer != nil && smgr != nil {
+		smgr.Feed(pkt)
+
+		if pkt.NetworkLayer() != nil {
+			streamID := smgr.GetStreamID(pkt.NetworkLayer().NetworkFlow(), tcpLayer.(*layers.TCP).TransportFlow())
+			if streamID > 0 {
+				info.StreamID = streamID
 			}
 		}
+	}
 
-		payload, _ := json.Marshal(info)
-		e.broadcast(models.WSMessage{Type: "packet", Payload: payload})
+	e.tlsStats.Observe(pkt)
+	e.icsStats.Observe(pkt)
+	e.dnsStats.Observe(pkt)
+	e.ntpStats.Observe(pkt)
+	e.voip.Observe(pkt)
+	if tr, ok := e.ftp.Observe(pkt, info.StreamID); ok {
+		e.flowTracker.Label(tuple.SrcIP, tuple.DstIP, tuple.SrcPort, tuple.DstPort, tuple.Protocol, tuple.Scope, "FTP-DATA")
+		e.flowTracker.SetInfo(tuple.SrcIP, tuple.DstIP, tuple.SrcPort, tuple.DstPort, tuple.Protocol, tuple.Scope, tr.Describe())
+	}
+	e.arpTable.Observe(pkt)
+	e.names.Observe(pkt)
+	e.services.Observe(pkt)
+	e.customFields.Apply(pkt, &info)
+	e.applyStorePolicy(pkt, &info, smgr)
+	alerts := e.detectors.Inspect(pkt, &info)
+	info.Color = e.coloring.Match(pkt, &info)
+
+	payload, _ := json.Marshal(info)
+	e.broadcastPacket(pkt, &info, models.WSMessage{Type: "packet", Payload: payload})
+
+	for _, a := range alerts {
+		payload, _ := json.Marshal(a)
+		e.broadcast(models.WSMessage{Type: "alert", Payload: payload})
 	}
 }
 
-// startFlowBroadcaster ticks every 1s and broadcasts the flow table.
-func (e *Engine) startFlowBroadcaster() {
+// startFlowBroadcaster ticks every 1s and broadcasts the flows that
+// changed since the previous tick.
+func (e *Engine) startFlowBroadcaster(stopCh <-chan struct{}) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-e.stopCh:
+		case <-stopCh:
 			return
 		case <-ticker.C:
-			flows := e.flowTracker.GetFlows()
-			if len(flows) == 0 {
+			flows, removed := e.flowTracker.Changes()
+			if len(flows) == 0 && len(removed) == 0 {
 				continue
 			}
+			e.attributeProcesses(flows)
 
-			infos := make([]models.FlowInfo, 0, len(flows))
-			for _, f := range flows {
-				infos = append(infos, models.FlowInfo{
-					ID:          f.ID,
-					SrcIP:       f.SrcIP,
-					DstIP:       f.DstIP,
-					SrcPort:     f.SrcPort,
-					DstPort:     f.DstPort,
-					Protocol:    f.Protocol,
-					PacketCount: f.PacketCount,
-					ByteCount:   f.ByteCount,
-					FirstSeen:   f.FirstSeen,
-					LastSeen:    f.LastSeen,
-					TCPState:    string(f.TCPState),
-					FwdPackets:  f.FwdPackets,
-					FwdBytes:    f.FwdBytes,
-					RevPackets:  f.RevPackets,
-					RevBytes:    f.RevBytes,
-				})
-			}
-
-			payload, _ := json.Marshal(infos)
+			payload, _ := json.Marshal(models.FlowDelta{Flows: e.toFlowInfos(flows), Removed: removed})
 			e.broadcast(models.WSMessage{Type: "flow_update", Payload: payload})
 		}
 	}
 }
 
+// attributeProcesses labels recently started flows with the local process
+// that owns them. Only live captures are attributed: the socket table
+// describes this host, not the one a pcap was recorded on.
+func (e *Engine) attributeProcesses(flows []*flow.Flow) {
+	if !procmap.Supported() {
+		return
+	}
+	cutoff := time.Now().Add(-processAttributionWindow).UnixMilli()
+	for _, f := range flows {
+		if f.PID != 0 || f.FirstSeen < cutoff {
+			continue
+		}
+		p, ok := e.procs.Lookup(f.Protocol, f.SrcIP, f.SrcPort, f.DstIP, f.DstPort)
+		if !ok {
+			continue
+		}
+		f.PID, f.ProcessName = p.PID, p.Name
+		e.flowTracker.SetProcess(f.SrcIP, f.DstIP, f.SrcPort, f.DstPort, f.Protocol, f.Scope, p.PID, p.Name)
+	}
+}
+
 // startStatsBroadcaster ticks every 2s and broadcasts capture statistics.
-func (e *Engine) startStatsBroadcaster() {
+func (e *Engine) startStatsBroadcaster(stopCh <-chan struct{}) {
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
+	prevDrops := make(map[*capture.LiveCapture]capture.Stats)
 
 	for {
 		select {
-		case <-e.stopCh:
+		case <-stopCh:
 			return
 		case <-ticker.C:
 			e.mu.Lock()
+			lcs := e.liveCaptures
 			pktCount := e.pktCount
+			retained, evicted := e.packets.len(), e.packets.evicted
 			protoStats := make(map[string]*ProtocolStat, len(e.protocolStats))
 			for k, v := range e.protocolStats {
 				protoStats[k] = &ProtocolStat{PacketCount: v.PacketCount, ByteCount: v.ByteCount}
 			}
+			anomalies := e.copyAnomalies()
 			e.mu.Unlock()
+			drops, ifaceDrops := e.readDrops(lcs, prevDrops)
 
 			statsPayload := map[string]interface{}{
-				"packetCount":      pktCount,
-				"droppedCount":     0,
-				"protocolStats":    protoStats,
+				"packetCount":   pktCount,
+				"receivedCount": drops.Received,
+				"droppedCount":  drops.Dropped + drops.IfDropped,
+				"captureStats":  ifaceDrops,
+				"retainedCount": retained,
+				"evictedCount":  evicted,
+				"protocolStats": protoStats,
+				"anomalyCounts": anomalies,
 			}
 
 			payload, _ := json.Marshal(statsPayload)
 			e.broadcast(models.WSMessage{Type: "capture_stats", Payload: payload})
+
+			if series, ok := e.io.Updates(); ok {
+				payload, _ := json.Marshal(series)
+				e.broadcast(models.WSMessage{Type: "io_graph", Payload: payload})
+			}
+		}
+	}
+}
+
+// broadcastPacket sends a packet message to every client whose display
+// filter, if any, matches the packet.
+func (e *Engine) broadcastPacket(pkt gopacket.Packet, info *models.PacketInfo, msg models.WSMessage) {
+	e.mu.Lock()
+	clients := make([]Client, 0, len(e.clients))
+	filters := make([]*filter.Filter, 0, len(e.clients))
+	for c := range e.clients {
+		if !e.wants(c, msg.Type) {
+			continue
+		}
+		clients = append(clients, c)
+		filters = append(filters, e.filters[c])
+	}
+	e.mu.Unlock()
+
+	for i, c := range clients {
+		if filters[i] != nil && !filters[i].Match(pkt, info) {
+			continue
 		}
+		c.SendMessage(msg)
 	}
 }
 
@@ -448,6 +1802,9 @@ func (e *Engine) broadcast(msg models.WSMessage) {
 	e.mu.Lock()
 	clients := make([]Client, 0, len(e.clients))
 	for c := range e.clients {
+		if !e.wants(c, msg.Type) {
+			continue
+		}
 		clients = append(clients, c)
 	}
 	e.mu.Unlock()
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"log"
+	"time"
+
+	"sniffox/internal/netflow"
+)
+
+// SetFlowExporter sends the flows of live captures to a NetFlow v9 or
+// IPFIX collector as they expire; nil stops exporting.
+func (e *Engine) SetFlowExporter(x *netflow.Exporter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.flowExport = x
+}
+
+// FlowExporter returns the flow exporter, or nil if flows are not exported.
+func (e *Engine) FlowExporter() *netflow.Exporter {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.flowExport
+}
+
+// flowExportLoop checks the flow table for expired flows every second
+// until the capture stops.
+func (e *Engine) flowExportLoop(x *netflow.Exporter, stopCh chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	logged := false
+	for {
+		select {
+		case <-stopCh:
+			return
+		case now := <-ticker.C:
+			err := x.Export(e.flowTracker.GetFlows(), now)
+			// Log the first failure only; Stats keeps count of the rest
+			if err != nil && !logged {
+				log.Printf("Flow export: %v", err)
+			}
+			logged = logged || err != nil
+		}
+	}
+}
+
+// flushFlowExport sends what the flows of a stopped capture carried that
+// has not been exported yet.
+func (e *Engine) flushFlowExport(x *netflow.Exporter) {
+	if err := x.Flush(e.flowTracker.GetFlows(), time.Now()); err != nil {
+		log.Printf("Flow export: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"sniffox/internal/flow"
+	"sniffox/internal/models"
+)
+
+// Flow sort keys.
+const (
+	FlowSortBytes     = "bytes"
+	FlowSortPackets   = "packets"
+	FlowSortLastSeen  = "last-seen"
+	FlowSortFirstSeen = "first-seen"
+	FlowSortID        = "id"
+)
+
+// FlowQuery selects, orders and pages the flow table.
+type FlowQuery struct {
+	Sort     string // one of the FlowSort keys; last-seen by default
+	Asc      bool   // ascending order; largest or newest first otherwise
+	Protocol string // transport or application protocol, case-insensitive
+	IP       string // either endpoint
+	Port     uint16 // either endpoint
+	Offset   int
+	Limit    int
+}
+
+// FlowPage is one page of the flow table.
+type FlowPage struct {
+	Total  int               `json:"total"` // flows matching the query
+	Offset int               `json:"offset"`
+	Limit  int               `json:"limit"`
+	Flows  []models.FlowInfo `json:"flows"`
+}
+
+// QueryFlows returns the flows matching q in the requested order, skipping
+// the first q.Offset. Only the returned page is enriched with GeoIP and
+// classifier results.
+func (e *Engine) QueryFlows(q FlowQuery) (*FlowPage, error) {
+	var key func(f *flow.Flow) int64
+	switch q.Sort {
+	case FlowSortBytes:
+		key = func(f *flow.Flow) int64 { return f.ByteCount }
+	case FlowSortPackets:
+		key = func(f *flow.Flow) int64 { return int64(f.PacketCount) }
+	case "", FlowSortLastSeen:
+		key = func(f *flow.Flow) int64 { return f.LastSeen }
+	case FlowSortFirstSeen:
+		key = func(f *flow.Flow) int64 { return f.FirstSeen }
+	case FlowSortID:
+		key = func(f *flow.Flow) int64 { return int64(f.ID) }
+	default:
+		return nil, fmt.Errorf("unknown sort key %q", q.Sort)
+	}
+
+	var flows []*flow.Flow
+	for _, f := range e.flowTracker.GetFlows() {
+		if q.matches(f) {
+			flows = append(flows, f)
+		}
+	}
+	slices.SortFunc(flows, func(a, b *flow.Flow) int {
+		c := cmp.Compare(key(a), key(b))
+		if c == 0 {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		if !q.Asc {
+			c = -c
+		}
+		return c
+	})
+
+	page := &FlowPage{Total: len(flows), Offset: q.Offset, Limit: q.Limit, Flows: []models.FlowInfo{}}
+	if q.Offset < len(flows) {
+		end := min(q.Offset+q.Limit, len(flows))
+		page.Flows = e.toFlowInfos(flows[q.Offset:end])
+	}
+	return page, nil
+}
+
+func (q FlowQuery) matches(f *flow.Flow) bool {
+	if q.Protocol != "" && !strings.EqualFold(f.Protocol, q.Protocol) && !strings.EqualFold(f.AppProtocol, q.Protocol) {
+		return false
+	}
+	if q.IP != "" && f.SrcIP != q.IP && f.DstIP != q.IP {
+		return false
+	}
+	if q.Port != 0 && f.SrcPort != q.Port && f.DstPort != q.Port {
+		return false
+	}
+	return true
+}
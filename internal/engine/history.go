@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"strings"
+
+	"sniffox/internal/filter"
+	"sniffox/internal/models"
+	"sniffox/internal/pktdiff"
+)
+
+// PacketPage is one page of the retained packet history.
+type PacketPage struct {
+	Total   int                    `json:"total"` // packets matching the filter
+	Offset  int                    `json:"offset"`
+	Limit   int                    `json:"limit"`
+	Packets []models.PacketSummary `json:"packets"`
+}
+
+// GetPacketPage returns up to limit retained packets matching the display
+// filter expr, skipping the first offset matches. Packets are listed
+// oldest first.
+func (e *Engine) GetPacketPage(offset, limit int, expr string) (*PacketPage, error) {
+	var f *filter.Filter
+	if strings.TrimSpace(expr) != "" {
+		var err error
+		if f, err = filter.Compile(expr); err != nil {
+			return nil, err
+		}
+	}
+
+	e.mu.Lock()
+	startTime := e.startTime
+	smgr := e.streamMgr
+	var pkts []rawPacket
+	total := e.packets.len()
+	if f == nil {
+		pkts = e.packets.slice(offset, limit)
+	} else {
+		pkts = e.packets.all()
+	}
+	e.mu.Unlock()
+
+	page := &PacketPage{Offset: offset, Limit: limit, Packets: []models.PacketSummary{}}
+	if f == nil {
+		page.Total = total
+		for _, p := range pkts {
+			_, info := e.storedInfo(p, startTime, smgr)
+			page.Packets = append(page.Packets, info.Summary())
+		}
+		return page, nil
+	}
+
+	// A filtered page has to decode every packet to count the matches
+	for _, p := range pkts {
+		pkt, info := e.storedInfo(p, startTime, smgr)
+		if !f.Match(pkt, &info) {
+			continue
+		}
+		if page.Total >= offset && (limit <= 0 || len(page.Packets) < limit) {
+			page.Packets = append(page.Packets, info.Summary())
+		}
+		page.Total++
+	}
+	return page, nil
+}
+
+// GetPacket returns the full detail of a retained packet by number.
+func (e *Engine) GetPacket(number int) (*models.PacketInfo, bool) {
+	e.mu.Lock()
+	p, ok := e.packets.find(number)
+	startTime := e.startTime
+	smgr := e.streamMgr
+	e.mu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+	_, info := e.storedInfo(p, startTime, smgr)
+	return &info, true
+}
+
+// DiffPackets compares the layer trees of two retained packets field by
+// field. Fields named in ignore are left out of the comparison. ok is false
+// if either packet is no longer retained.
+func (e *Engine) DiffPackets(a, b int, ignore []string) (diff pktdiff.Diff, ok bool) {
+	pa, ok := e.GetPacket(a)
+	if !ok {
+		return diff, false
+	}
+	pb, ok := e.GetPacket(b)
+	if !ok {
+		return diff, false
+	}
+	return pktdiff.Compare(pa, pb, ignore), true
+}
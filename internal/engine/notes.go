@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sniffox/internal/models"
+)
+
+// AddNote appends a finding to the investigation log. A linked packet
+// must still be retained; its capture time is recorded so the timeline
+// can be ordered by when things happened on the wire.
+func (e *Engine) AddNote(text string, pktNumber int, flowID uint64) (models.Note, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return models.Note{}, fmt.Errorf("note text is required")
+	}
+
+	e.mu.Lock()
+	n := models.Note{
+		CreatedAt: time.Now().Format(time.RFC3339),
+		Text:      text,
+		PktNumber: pktNumber,
+		FlowID:    flowID,
+	}
+	if pktNumber > 0 {
+		p, ok := e.packets.find(pktNumber)
+		if !ok {
+			e.mu.Unlock()
+			return models.Note{}, fmt.Errorf("packet %d is not retained", pktNumber)
+		}
+		n.PacketTime = p.CaptureAt.Format(time.RFC3339Nano)
+	}
+	e.nextNoteID++
+	n.ID = e.nextNoteID
+	e.notes = append(e.notes, n)
+	e.mu.Unlock()
+
+	e.broadcastNotes()
+	return n, nil
+}
+
+// DeleteNote removes a note by ID.
+func (e *Engine) DeleteNote(id int) bool {
+	e.mu.Lock()
+	found := false
+	for i, n := range e.notes {
+		if n.ID == id {
+			e.notes = append(e.notes[:i], e.notes[i+1:]...)
+			found = true
+			break
+		}
+	}
+	e.mu.Unlock()
+
+	if found {
+		e.broadcastNotes()
+	}
+	return found
+}
+
+// GetNotes returns the investigation timeline: notes ordered by the
+// capture time of their linked packet, or by when they were written.
+func (e *Engine) GetNotes() []models.Note {
+	e.mu.Lock()
+	out := make([]models.Note, len(e.notes))
+	copy(out, e.notes)
+	e.mu.Unlock()
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return noteTime(out[i]).Before(noteTime(out[j]))
+	})
+	return out
+}
+
+// SetNotes replaces the investigation log, e.g. when a session is loaded.
+func (e *Engine) SetNotes(notes []models.Note) {
+	e.mu.Lock()
+	e.notes = append([]models.Note(nil), notes...)
+	e.nextNoteID = 0
+	for _, n := range e.notes {
+		e.nextNoteID = max(e.nextNoteID, n.ID)
+	}
+	e.mu.Unlock()
+
+	e.broadcastNotes()
+}
+
+func noteTime(n models.Note) time.Time {
+	if t, err := time.Parse(time.RFC3339Nano, n.PacketTime); err == nil {
+		return t
+	}
+	t, _ := time.Parse(time.RFC3339, n.CreatedAt)
+	return t
+}
+
+func (e *Engine) broadcastNotes() {
+	payload, _ := json.Marshal(e.GetNotes())
+	e.broadcast(models.WSMessage{Type: "notes", Payload: payload})
+}
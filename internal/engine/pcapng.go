@@ -0,0 +1,219 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"sniffox/internal/parser"
+)
+
+// ExportPcapNG writes the stored packets as a pcapng file. Each capture
+// interface gets an interface block recording its name, link type and the
+// BPF filter, comment (if any) is attached to the section header, and
+// server-side alerts and analyst notes are attached to their packets as
+// packet comments. opts selects and trims the packets as for ExportPcap.
+func (e *Engine) ExportPcapNG(w io.Writer, comment string, opts ExportOptions) error {
+	pkts, err := e.selectPackets(opts.PacketSelection)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	fileIface := e.captureIface
+	bpf := e.captureFilter
+	snapLen := e.captureSnapLen
+	total := e.pktCount
+	e.mu.Unlock()
+
+	if len(pkts) == 0 {
+		return fmt.Errorf("no packets to export")
+	}
+
+	comments := make(map[int][]string)
+	for _, a := range e.detectors.Alerts() {
+		if a.PktNumber > 0 {
+			comments[a.PktNumber] = append(comments[a.PktNumber], fmt.Sprintf("[%s] %s: %s", a.Severity, a.Title, a.Detail))
+		}
+	}
+	for _, n := range e.GetNotes() {
+		if n.PktNumber > 0 {
+			comments[n.PktNumber] = append(comments[n.PktNumber], "Note: "+n.Text)
+		}
+	}
+
+	if fileIface == "" {
+		fileIface = "sniffox"
+	}
+	newInterface := func(p rawPacket) pcapgo.NgInterface {
+		intf := pcapgo.DefaultNgInterface
+		intf.Name = p.Iface
+		if intf.Name == "" {
+			intf.Name = fileIface
+		}
+		intf.Filter = bpf
+		intf.LinkType = p.LinkType
+		intf.SnapLength = uint32(opts.snapLen(snapLen))
+		return intf
+	}
+	type ifaceKey struct {
+		name string
+		lt   layers.LinkType
+	}
+	ifaceIDs := map[ifaceKey]int{{pkts[0].Iface, pkts[0].LinkType}: 0}
+	ifaceCounts := []uint64{0}
+
+	ngOpts := pcapgo.NgWriterOptions{SectionInfo: pcapgo.NgSectionInfo{
+		Hardware:    runtime.GOARCH,
+		OS:          runtime.GOOS,
+		Application: "Sniffox",
+		Comment:     comment,
+	}}
+
+	// NgWriter buffers internally and cannot write packet options, so
+	// commented packets are written straight to bw after a flush.
+	bw := bufio.NewWriter(w)
+	writer, err := pcapgo.NewNgWriterInterface(&ngLinkTypeWriter{w: bw}, newInterface(pkts[0]), ngOpts)
+	if err != nil {
+		return fmt.Errorf("write pcapng header: %w", err)
+	}
+
+	for _, p := range pkts {
+		id, ok := ifaceIDs[ifaceKey{p.Iface, p.LinkType}]
+		if !ok {
+			if id, err = writer.AddInterface(newInterface(p)); err != nil {
+				return fmt.Errorf("write interface block: %w", err)
+			}
+			ifaceIDs[ifaceKey{p.Iface, p.LinkType}] = id
+			ifaceCounts = append(ifaceCounts, 0)
+		}
+		ifaceCounts[id]++
+
+		data := opts.packetData(p)
+		ci := gopacket.CaptureInfo{
+			Timestamp:      p.CaptureAt,
+			CaptureLength:  len(data),
+			Length:         p.Length,
+			InterfaceIndex: id,
+		}
+		if c := comments[p.Number]; len(c) > 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			err = writeNgCommentedPacket(bw, ci, data, strings.Join(c, "\n"))
+		} else {
+			err = writer.WritePacket(ci, data)
+		}
+		if err != nil {
+			return fmt.Errorf("write packet: %w", err)
+		}
+	}
+
+	// A single interface also counts the packets evicted from the store;
+	// with several, or a selection, only the exported packets can be
+	// attributed.
+	if len(ifaceCounts) == 1 && opts.all() {
+		ifaceCounts[0] = uint64(total)
+	}
+	for id, count := range ifaceCounts {
+		stats := pcapgo.NgInterfaceStatistics{
+			LastUpdate:      time.Now(),
+			StartTime:       pkts[0].CaptureAt,
+			EndTime:         pkts[len(pkts)-1].CaptureAt,
+			PacketsReceived: count,
+			PacketsDropped:  pcapgo.NgNoValue64,
+		}
+		if err := writer.WriteInterfaceStats(id, stats); err != nil {
+			return fmt.Errorf("write interface statistics: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writeNgCommentedPacket writes an Enhanced Packet Block on interface
+// ci.InterfaceIndex carrying an opt_comment option.
+func writeNgCommentedPacket(w io.Writer, ci gopacket.CaptureInfo, data []byte, comment string) error {
+	pad := func(n int) int { return (4 - n&3) & 3 }
+	if len(comment) > 0xffff {
+		comment = comment[:0xffff]
+	}
+
+	// Options: opt_comment, then opt_endofopt
+	optLen := 4 + len(comment) + pad(len(comment)) + 4
+	dataLen := len(data) + pad(len(data))
+	blockLen := 28 + dataLen + optLen + 4
+
+	buf := make([]byte, blockLen)
+	le := binary.LittleEndian
+	ts := uint64(ci.Timestamp.UnixNano())
+	le.PutUint32(buf[0:], 0x00000006) // Enhanced Packet Block
+	le.PutUint32(buf[4:], uint32(blockLen))
+	le.PutUint32(buf[8:], uint32(ci.InterfaceIndex))
+	le.PutUint32(buf[12:], uint32(ts>>32))
+	le.PutUint32(buf[16:], uint32(ts))
+	le.PutUint32(buf[20:], uint32(len(data)))
+	le.PutUint32(buf[24:], uint32(ci.Length))
+	copy(buf[28:], data)
+
+	off := 28 + dataLen
+	le.PutUint16(buf[off:], 1) // opt_comment
+	le.PutUint16(buf[off+2:], uint16(len(comment)))
+	copy(buf[off+4:], comment)
+	// opt_endofopt is all zeroes
+	le.PutUint32(buf[blockLen-4:], uint32(blockLen))
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// ngLinkTypeWriter passes the blocks written by an NgWriter through to w,
+// rewriting the link type of interface blocks with parser.FileLinkType:
+// NgWriter stores gopacket's 8-bit link type, which cannot hold SLL2.
+type ngLinkTypeWriter struct {
+	w    io.Writer
+	hdr  []byte // start of the current block, up to its link type field
+	rest int    // bytes of the current block after hdr still to pass
+}
+
+func (n *ngLinkTypeWriter) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		if n.rest > 0 {
+			k := min(n.rest, len(p))
+			if _, err := n.w.Write(p[:k]); err != nil {
+				return 0, err
+			}
+			n.rest -= k
+			p = p[k:]
+			continue
+		}
+		k := min(10-len(n.hdr), len(p))
+		n.hdr = append(n.hdr, p[:k]...)
+		p = p[k:]
+		if len(n.hdr) < 10 {
+			break
+		}
+		le := binary.LittleEndian
+		if le.Uint32(n.hdr) == 0x00000001 { // Interface Description Block
+			lt := layers.LinkType(le.Uint16(n.hdr[8:]))
+			le.PutUint16(n.hdr[8:], uint16(parser.FileLinkType(lt)))
+		}
+		if _, err := n.w.Write(n.hdr); err != nil {
+			return 0, err
+		}
+		n.rest = int(le.Uint32(n.hdr[4:])) - len(n.hdr)
+		n.hdr = n.hdr[:0]
+	}
+	return written, nil
+}
@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"sniffox/internal/capture"
+	"sniffox/internal/models"
+)
+
+// ProblemCaptureRunning is reported by PreflightCapture while a capture
+// is already running.
+const ProblemCaptureRunning = "capture_running"
+
+// Preflight is the outcome of PreflightCapture.
+type Preflight struct {
+	OK         bool              `json:"ok"`
+	Interfaces []string          `json:"interfaces,omitempty"` // after expanding "any"
+	Problems   []capture.Problem `json:"problems"`
+}
+
+// PreflightCapture checks up front whether StartCapture would succeed with
+// req: that the interfaces exist, can be opened with the current
+// privileges, and accept the BPF filter.
+func (e *Engine) PreflightCapture(req models.StartCaptureRequest) Preflight {
+	ifaces, problems := capture.Preflight(req.Interface, req.BPFFilter, req.SnapLen)
+	if err := capture.CheckBackend(req.Backend); err != nil {
+		problems = append(problems, capture.Problem{
+			Code:    capture.ProblemBadBackend,
+			Message: err.Error(),
+			Hint:    "Leave backend empty to capture with libpcap.",
+		})
+	}
+
+	e.mu.Lock()
+	if e.capturing {
+		problems = append(problems, capture.Problem{
+			Code:    ProblemCaptureRunning,
+			Message: "capture already running",
+			Hint:    "Stop the running capture first.",
+		})
+	}
+	e.mu.Unlock()
+
+	if problems == nil {
+		problems = []capture.Problem{}
+	}
+	return Preflight{OK: len(problems) == 0, Interfaces: ifaces, Problems: problems}
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+)
+
+// maxQuarantined caps the malformed packets kept for inspection.
+const maxQuarantined = 1000
+
+// guard runs fn, one processing stage, and returns why it panicked if it
+// did, so that a crafted packet cannot take the capture loop down.
+func guard(stage string, fn func()) (reason string) {
+	defer func() {
+		if r := recover(); r != nil {
+			reason = fmt.Sprintf("%s panic: %v", stage, r)
+		}
+	}()
+	fn()
+	return ""
+}
+
+// quarantine keeps a malformed packet, with its raw bytes, out of flow
+// tracking, reassembly and the detectors, and shows it in the packet list.
+func (e *Engine) quarantine(pkt gopacket.Packet, info *models.PacketInfo) {
+	e.mu.Lock()
+	if len(e.malformed) >= maxQuarantined {
+		e.malformed = append(e.malformed[:0], e.malformed[len(e.malformed)-maxQuarantined/2:]...)
+	}
+	e.malformed = append(e.malformed, models.MalformedPacket{
+		Number:    info.Number,
+		Timestamp: info.Timestamp,
+		Interface: info.Interface,
+		Length:    info.Length,
+		Reason:    info.Malformed,
+		RawHex:    info.RawHex,
+	})
+	e.mu.Unlock()
+
+	e.trackProtocol("Malformed", 1, info.Length)
+	payload, _ := json.Marshal(info)
+	e.broadcastPacket(pkt, info, models.WSMessage{Type: "packet", Payload: payload})
+}
+
+// MalformedPackets returns the quarantined packets of the current capture,
+// oldest first.
+func (e *Engine) MalformedPackets() []models.MalformedPacket {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]models.MalformedPacket, len(e.malformed))
+	copy(out, e.malformed)
+	return out
+}
@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"sniffox/internal/sessionstore"
+)
+
+// pcap file and per-record header sizes
+const (
+	pcapFileHeaderLen   = 24
+	pcapRecordHeaderLen = 16
+)
+
+// RecordingFile describes one pcap file written by a recording capture. It
+// is stored next to the file as <ID>.json, with the same fields as a saved
+// session, so recordings are listed and loaded like sessions.
+type RecordingFile struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Timestamp string `json:"timestamp"`
+	Packets   int    `json:"packets"`
+	Size      int64  `json:"size"`
+	Recording bool   `json:"recording"`
+}
+
+// recorder writes live packets to a series of pcap files, starting a new
+// file when the current one reaches maxBytes or spans maxAge (tcpdump -C
+// and -G) and keeping at most maxFiles of them (tcpdump -W).
+type recorder struct {
+	mu       sync.Mutex
+	dir      string
+	prefix   string // file name prefix shared by all parts
+	label    string // capture interfaces, for file names shown in the UI
+	linkType layers.LinkType
+	snapLen  int
+	maxBytes int64
+	maxAge   time.Duration
+	maxFiles int
+
+	seq    int
+	f      *os.File
+	w      *pcapgo.Writer
+	cur    RecordingFile
+	opened time.Time // timestamp of the file's first packet
+	files  []string  // IDs, oldest first
+
+	// With a session store kept elsewhere than dir, each finished file is
+	// uploaded to it and removed from dir. Uploads and removals run in
+	// order on one goroutine, off the capture path.
+	store sessionstore.Store
+	ops   chan func()
+}
+
+func newRecorder(dir, label string, lt layers.LinkType, snapLen int, maxBytes int64, maxAge time.Duration, maxFiles int, store sessionstore.Store) (*recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("recording directory: %w", err)
+	}
+	r := &recorder{
+		dir:      dir,
+		prefix:   "rec-" + time.Now().Format("20060102-150405"),
+		label:    label,
+		linkType: lt,
+		snapLen:  snapLen,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		maxFiles: maxFiles,
+	}
+	if store != nil && !sessionstore.SameDir(store, dir) {
+		r.store = store
+		r.ops = make(chan func(), 64)
+		go func() {
+			for op := range r.ops {
+				op()
+			}
+		}()
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// write appends one packet, rotating first if the current file is full.
+// After a write error the recording stops and later packets are dropped.
+func (r *recorder) write(ci gopacket.CaptureInfo, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return
+	}
+
+	if r.cur.Packets > 0 && ((r.maxBytes > 0 && r.cur.Size >= r.maxBytes) ||
+		(r.maxAge > 0 && ci.Timestamp.Sub(r.opened) >= r.maxAge)) {
+		r.closeFile()
+		if err := r.open(); err != nil {
+			log.Printf("Recording stopped: %v", err)
+			return
+		}
+	}
+	if r.cur.Packets == 0 {
+		r.opened = ci.Timestamp
+	}
+	if err := r.w.WritePacket(ci, data); err != nil {
+		log.Printf("Recording stopped: write %s: %v", r.f.Name(), err)
+		r.closeFile()
+		return
+	}
+	r.cur.Packets++
+	r.cur.Size += int64(pcapRecordHeaderLen + len(data))
+}
+
+// close finishes the current file.
+func (r *recorder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f != nil {
+		r.closeFile()
+	}
+	if r.ops != nil {
+		close(r.ops)
+		r.ops = nil
+	}
+}
+
+// current returns the file being written, or nil once recording stopped.
+func (r *recorder) current() *RecordingFile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	cur := r.cur
+	return &cur
+}
+
+func (r *recorder) open() error {
+	r.seq++
+	id := fmt.Sprintf("%s-%03d", r.prefix, r.seq)
+	f, err := os.Create(filepath.Join(r.dir, id+".pcap"))
+	if err != nil {
+		return fmt.Errorf("create recording file: %w", err)
+	}
+	w := pcapgo.NewWriter(f)
+	if err := writePcapHeader(f, r.snapLen, r.linkType); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("write pcap header: %w", err)
+	}
+	r.f, r.w = f, w
+	r.cur = RecordingFile{
+		ID:        id,
+		Name:      fmt.Sprintf("Recording on %s, part %d", r.label, r.seq),
+		Timestamp: time.Now().Format(time.RFC3339),
+		Size:      pcapFileHeaderLen,
+		Recording: true,
+	}
+	// Written now as well as on close so a file cut short by a crash or
+	// restart is still listed.
+	r.writeMeta()
+
+	r.files = append(r.files, id)
+	for r.maxFiles > 0 && len(r.files) > r.maxFiles {
+		old := r.files[0]
+		r.files = r.files[1:]
+		os.Remove(filepath.Join(r.dir, old+".pcap"))
+		os.Remove(filepath.Join(r.dir, old+".json"))
+		if r.ops != nil {
+			r.ops <- func() {
+				r.store.Remove(old + ".pcap")
+				r.store.Remove(old + ".json")
+			}
+		}
+	}
+	return nil
+}
+
+func (r *recorder) closeFile() {
+	if err := r.f.Close(); err != nil {
+		log.Printf("Recording: close %s: %v", r.f.Name(), err)
+	}
+	r.f, r.w = nil, nil
+	r.writeMeta()
+	if r.ops != nil {
+		id := r.cur.ID
+		r.ops <- func() { r.upload(id) }
+	}
+}
+
+// upload copies a finished file to the session store, metadata last so
+// the store never lists a session without its pcap, and then removes the
+// local copy. After a failure the file stays in dir.
+func (r *recorder) upload(id string) {
+	for _, name := range []string{id + ".pcap", id + ".json"} {
+		if err := copyToStore(r.store, filepath.Join(r.dir, name), name); err != nil {
+			log.Printf("Recording: upload %s to %s: %v", name, r.store, err)
+			return
+		}
+	}
+	os.Remove(filepath.Join(r.dir, id+".pcap"))
+	os.Remove(filepath.Join(r.dir, id+".json"))
+}
+
+func copyToStore(store sessionstore.Store, path, name string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := store.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Abort()
+		return err
+	}
+	return dst.Close()
+}
+
+func (r *recorder) writeMeta() {
+	data, _ := json.Marshal(r.cur)
+	if err := os.WriteFile(filepath.Join(r.dir, r.cur.ID+".json"), data, 0o644); err != nil {
+		log.Printf("Recording: %v", err)
+	}
+}
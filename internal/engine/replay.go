@@ -0,0 +1,328 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"sniffox/internal/capture"
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+)
+
+// Replay timing modes.
+const (
+	ReplayOriginal    = "original"    // the capture's own inter-packet gaps
+	ReplayAccelerated = "accelerated" // the gaps divided by Speed
+	ReplayFixedRate   = "rate"        // Rate packets per second
+)
+
+// replayProgressEvery throttles replay_progress broadcasts.
+const replayProgressEvery = 250 * time.Millisecond
+
+// ErrReplayDisabled is returned by StartReplay unless replay was enabled
+// with SetReplayAllowed: it transmits on a live network.
+var ErrReplayDisabled = errors.New("packet replay is disabled")
+
+// ReplayPace is the timing of a replay.
+type ReplayPace struct {
+	Mode  string  `json:"mode"`
+	Speed float64 `json:"speed,omitempty"` // multiplier for accelerated
+	Rate  float64 `json:"rate,omitempty"`  // packets per second for rate
+}
+
+// ReplayRequest selects the packets to replay and where to send them.
+type ReplayRequest struct {
+	Interface string `json:"interface"`
+	FlowID    uint64 `json:"flowId,omitempty"` // 0 replays every retained packet
+	ReplayPace
+}
+
+// ReplayStatus reports the progress of the current or last replay. It is
+// also broadcast to clients as replay_progress messages.
+type ReplayStatus struct {
+	Running   bool   `json:"running"`
+	Stopped   bool   `json:"stopped,omitempty"` // ended by StopReplay
+	Interface string `json:"interface,omitempty"`
+	FlowID    uint64 `json:"flowId,omitempty"`
+	ReplayPace
+	Total     int    `json:"total"`
+	Sent      int    `json:"sent"`
+	Failed    int    `json:"failed"`
+	Bytes     int64  `json:"bytes"`
+	StartedAt string `json:"startedAt,omitempty"`
+	LastError string `json:"lastError,omitempty"` // most recent send failure
+}
+
+// normalize defaults the mode to original and checks the parameters.
+func (p *ReplayPace) normalize() error {
+	switch p.Mode {
+	case "", ReplayOriginal:
+		*p = ReplayPace{Mode: ReplayOriginal}
+	case ReplayAccelerated:
+		if p.Speed <= 0 {
+			return fmt.Errorf("accelerated replay needs a speed above 0")
+		}
+		p.Rate = 0
+	case ReplayFixedRate:
+		if p.Rate <= 0 {
+			return fmt.Errorf("fixed-rate replay needs a rate above 0")
+		}
+		p.Speed = 0
+	default:
+		return fmt.Errorf("unknown replay mode %q", p.Mode)
+	}
+	return nil
+}
+
+// due returns when pkts[i] is sent, given that pkts[ref] went out at start.
+func (p ReplayPace) due(pkts []rawPacket, ref, i int, start time.Time) time.Time {
+	switch p.Mode {
+	case ReplayFixedRate:
+		return start.Add(time.Duration(float64(i-ref) / p.Rate * float64(time.Second)))
+	case ReplayAccelerated:
+		return start.Add(time.Duration(float64(pkts[i].CaptureAt.Sub(pkts[ref].CaptureAt)) / p.Speed))
+	}
+	return start.Add(pkts[i].CaptureAt.Sub(pkts[ref].CaptureAt))
+}
+
+// replayer transmits a fixed list of packets in the background.
+type replayer struct {
+	eng    *Engine
+	inj    *capture.Injector
+	pkts   []rawPacket
+	paceCh chan ReplayPace
+	stopCh chan struct{}
+	stop   sync.Once
+	done   chan struct{}
+
+	mu     sync.Mutex
+	status ReplayStatus
+}
+
+// SetReplayAllowed enables or disables packet replay.
+func (e *Engine) SetReplayAllowed(on bool) {
+	e.mu.Lock()
+	e.replayAllowed = on
+	e.mu.Unlock()
+}
+
+// StartReplay transmits the retained packets, or those of one flow, on an
+// interface with the requested timing. Progress is broadcast to clients.
+func (e *Engine) StartReplay(req ReplayRequest) error {
+	if err := req.normalize(); err != nil {
+		return err
+	}
+	if req.Interface == "" {
+		return fmt.Errorf("no replay interface selected")
+	}
+
+	e.mu.Lock()
+	if !e.replayAllowed {
+		e.mu.Unlock()
+		return ErrReplayDisabled
+	}
+	if e.replay != nil && e.replay.running() {
+		e.mu.Unlock()
+		return fmt.Errorf("a replay is already running")
+	}
+	pkts := e.packets.all()
+	e.mu.Unlock()
+
+	if req.FlowID != 0 {
+		pkts = e.flowPackets(pkts, req.FlowID)
+		if len(pkts) == 0 {
+			return fmt.Errorf("flow %d has no retained packets", req.FlowID)
+		}
+	}
+	if len(pkts) == 0 {
+		return fmt.Errorf("no packets to replay")
+	}
+
+	inj, err := capture.NewInjector(req.Interface)
+	if err != nil {
+		return err
+	}
+	for _, p := range pkts {
+		if p.LinkType != inj.LinkType() {
+			inj.Close()
+			return fmt.Errorf("packets have link type %s but %s sends %s", p.LinkType, req.Interface, inj.LinkType())
+		}
+	}
+
+	r := &replayer{
+		eng:    e,
+		inj:    inj,
+		pkts:   pkts,
+		paceCh: make(chan ReplayPace),
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+		status: ReplayStatus{
+			Running:    true,
+			Interface:  req.Interface,
+			FlowID:     req.FlowID,
+			ReplayPace: req.ReplayPace,
+			Total:      len(pkts),
+			StartedAt:  time.Now().Format(time.RFC3339),
+		},
+	}
+	e.mu.Lock()
+	if e.replay != nil && e.replay.running() {
+		e.mu.Unlock()
+		inj.Close()
+		return fmt.Errorf("a replay is already running")
+	}
+	e.replay = r
+	e.mu.Unlock()
+
+	go r.run()
+	return nil
+}
+
+// flowPackets returns the packets of pkts that belong to flow id.
+func (e *Engine) flowPackets(pkts []rawPacket, id uint64) []rawPacket {
+	var out []rawPacket
+	for _, p := range pkts {
+		tuple := parser.ExtractFlowTuple(decodeRaw(p))
+		if !tuple.Valid {
+			continue
+		}
+		if fid, ok := e.flowTracker.Lookup(tuple.SrcIP, tuple.DstIP, tuple.SrcPort, tuple.DstPort, tuple.Protocol, tuple.Scope); ok && fid == id {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// StopReplay stops the running replay, if any, and waits for it to end.
+func (e *Engine) StopReplay() {
+	e.mu.Lock()
+	r := e.replay
+	e.mu.Unlock()
+	if r == nil {
+		return
+	}
+	r.stop.Do(func() { close(r.stopCh) })
+	<-r.done
+}
+
+// SetReplayPace changes the timing of the running replay. Packets already
+// sent keep their timing; the next one is due one new gap after the last.
+func (e *Engine) SetReplayPace(p ReplayPace) error {
+	if err := p.normalize(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	r := e.replay
+	e.mu.Unlock()
+	if r != nil {
+		select {
+		case r.paceCh <- p:
+			return nil
+		case <-r.done:
+		}
+	}
+	return fmt.Errorf("no replay is running")
+}
+
+// GetReplayStatus returns the progress of the current or last replay.
+func (e *Engine) GetReplayStatus() ReplayStatus {
+	e.mu.Lock()
+	r := e.replay
+	e.mu.Unlock()
+	if r == nil {
+		return ReplayStatus{}
+	}
+	return r.snapshot()
+}
+
+func (r *replayer) running() bool {
+	select {
+	case <-r.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (r *replayer) snapshot() ReplayStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+func (r *replayer) run() {
+	defer close(r.done)
+	defer r.inj.Close()
+
+	pace := r.snapshot().ReplayPace
+	start, ref := time.Now(), 0
+	var lastSent, lastReport time.Time
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for i := 0; i < len(r.pkts); {
+		if wait := time.Until(pace.due(r.pkts, ref, i, start)); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-r.stopCh:
+				r.finish(true)
+				return
+			case pace = <-r.paceCh:
+				// Re-time from the last packet sent
+				if i > 0 {
+					start, ref = lastSent, i-1
+				} else {
+					start = time.Now()
+				}
+				r.mu.Lock()
+				r.status.ReplayPace = pace
+				r.mu.Unlock()
+				continue
+			}
+		}
+		select {
+		case <-r.stopCh:
+			r.finish(true)
+			return
+		default:
+		}
+
+		p := r.pkts[i]
+		err := r.inj.Write(p.Data)
+		lastSent = time.Now()
+		r.mu.Lock()
+		if err != nil {
+			r.status.Failed++
+			r.status.LastError = err.Error()
+		} else {
+			r.status.Sent++
+			r.status.Bytes += int64(len(p.Data))
+		}
+		r.mu.Unlock()
+		i++
+
+		if lastSent.Sub(lastReport) >= replayProgressEvery {
+			lastReport = lastSent
+			r.report()
+		}
+	}
+	r.finish(false)
+}
+
+// finish marks the replay ended and broadcasts the final progress.
+func (r *replayer) finish(stopped bool) {
+	r.mu.Lock()
+	r.status.Running = false
+	r.status.Stopped = stopped
+	r.mu.Unlock()
+	r.report()
+}
+
+func (r *replayer) report() {
+	payload, _ := json.Marshal(r.snapshot())
+	r.eng.broadcast(models.WSMessage{Type: "replay_progress", Payload: payload})
+}
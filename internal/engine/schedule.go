@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"sniffox/internal/audit"
+	"sniffox/internal/models"
+	"sniffox/internal/schedule"
+)
+
+// SetSchedules replaces the in-memory scheduled captures, typically with
+// ones kept in a file.
+func (e *Engine) SetSchedules(s *schedule.Store) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.schedules = s
+}
+
+// Schedules returns the scheduled captures.
+func (e *Engine) Schedules() *schedule.Store {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.schedules
+}
+
+// RunSchedules starts the scheduled captures as they come due, until stop
+// is closed. Recordings, autosaves and, without a session store, the
+// sessions of each run are written to dir.
+func (e *Engine) RunSchedules(dir string, stop <-chan struct{}) {
+	for {
+		next := time.Now().Truncate(time.Minute).Add(time.Minute)
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Until(next)):
+		}
+		for _, sc := range e.Schedules().Due(next) {
+			e.runSchedule(sc, next, dir)
+		}
+	}
+}
+
+// runSchedule starts a run of sc due at at and tells clients about it.
+func (e *Engine) runSchedule(sc schedule.Schedule, at time.Time, dir string) {
+	req := sc.Request(at)
+	req.RecordDir = dir
+	req.AutosaveDir = dir
+	err := e.StartCapture(req)
+	e.Schedules().MarkRun(sc.Name, at, err)
+	if err != nil {
+		log.Printf("Schedule %s: %v", sc.Name, err)
+		return
+	}
+	iface := strings.Join(req.Interface, ",")
+	e.AuditLog().Record(audit.Entry{Remote: "scheduler", Action: audit.CaptureStart, Target: iface, Detail: "schedule " + sc.Name})
+
+	payload, _ := json.Marshal(map[string]any{
+		"name":      sc.Name,
+		"interface": iface,
+		"duration":  sc.Duration,
+		"session":   req.SessionName,
+	})
+	e.broadcast(models.WSMessage{Type: "schedule_started", Payload: payload})
+}
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"strings"
+
+	"sniffox/internal/filter"
+	"sniffox/internal/parser"
+	"sniffox/internal/search"
+)
+
+const (
+	// maxSearchHits caps the packets a search returns when no limit is
+	// given.
+	maxSearchHits = 1000
+	// maxMatchesPerPacket caps the offsets reported for one packet.
+	maxMatchesPerPacket = 64
+)
+
+// PacketSearch looks for a pattern in the retained packets.
+type PacketSearch struct {
+	Query      string
+	Mode       string // one of the search modes; string by default
+	IgnoreCase bool
+	Protocol   string // display filter the packets must match, usually a protocol name
+	Frame      bool   // search the whole frame instead of the payload
+	Limit      int    // packets returned; maxSearchHits if zero
+}
+
+// SearchHit is a packet that contains the pattern. Offsets are from the
+// start of the frame, or of the reassembled datagram for packets that
+// completed one, so they line up with the hex view.
+type SearchHit struct {
+	Number  int            `json:"number"`
+	Matches []search.Match `json:"matches"`
+}
+
+// SearchResult lists the packets that contain the pattern, oldest first.
+type SearchResult struct {
+	Scanned   int         `json:"scanned"`             // retained packets looked at
+	Total     int         `json:"total"`               // packets that matched
+	Truncated bool        `json:"truncated,omitempty"` // more matched than Hits holds
+	Hits      []SearchHit `json:"hits"`
+}
+
+// SearchPackets scans the retained packets for s.Query. Packets that
+// contain it are fully decoded only to check them against s.Protocol.
+func (e *Engine) SearchPackets(s PacketSearch) (*SearchResult, error) {
+	pat, err := search.Compile(s.Query, s.Mode, s.IgnoreCase)
+	if err != nil {
+		return nil, err
+	}
+	var f *filter.Filter
+	if strings.TrimSpace(s.Protocol) != "" {
+		if f, err = filter.Compile(s.Protocol); err != nil {
+			return nil, err
+		}
+	}
+	limit := s.Limit
+	if limit <= 0 {
+		limit = maxSearchHits
+	}
+
+	e.mu.Lock()
+	startTime := e.startTime
+	smgr := e.streamMgr
+	pkts := e.packets.all()
+	e.mu.Unlock()
+
+	res := &SearchResult{Scanned: len(pkts), Hits: []SearchHit{}}
+	for _, p := range pkts {
+		pkt := decodeRaw(p)
+		data, base := pkt.Data(), 0
+		if !s.Frame {
+			var ok bool
+			if data, base, ok = parser.Payload(pkt); !ok {
+				continue
+			}
+		}
+		matches := pat.FindAll(data, maxMatchesPerPacket)
+		if len(matches) == 0 {
+			continue
+		}
+		if f != nil {
+			pkt, info := e.storedInfo(p, startTime, smgr)
+			if !f.Match(pkt, &info) {
+				continue
+			}
+		}
+		res.Total++
+		if len(res.Hits) >= limit {
+			res.Truncated = true
+			continue
+		}
+		for i := range matches {
+			matches[i].Offset += base
+		}
+		res.Hits = append(res.Hits, SearchHit{Number: p.Number, Matches: matches})
+	}
+	return res, nil
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/capture"
+	"sniffox/internal/filter"
+)
+
+// PacketSelection picks the stored packets to export. Its criteria are
+// ANDed; the zero value selects every packet.
+type PacketSelection struct {
+	Filter   string // display filter
+	BPF      string // capture filter, run against the stored frames
+	From, To int    // packet numbers, inclusive; 0 leaves that end open
+	FlowID   uint64
+	StreamID uint64
+}
+
+// all reports whether s selects every packet.
+func (s PacketSelection) all() bool {
+	return s == PacketSelection{}
+}
+
+// Validate checks the filters and the packet range.
+func (s PacketSelection) Validate() error {
+	_, err := s.compile()
+	if err == nil && s.BPF != "" {
+		_, err = capture.NewMatcher(layers.LinkTypeEthernet, s.BPF)
+	}
+	return err
+}
+
+func (s PacketSelection) compile() (*filter.Filter, error) {
+	if s.From < 0 || s.To < 0 || (s.To > 0 && s.To < s.From) {
+		return nil, fmt.Errorf("invalid packet range %d-%d", s.From, s.To)
+	}
+	if strings.TrimSpace(s.Filter) == "" {
+		return nil, nil
+	}
+	return filter.Compile(s.Filter)
+}
+
+// selectPackets returns the stored packets s selects, oldest first.
+// Packets are only decoded when a display filter, flow or stream is
+// asked for.
+func (e *Engine) selectPackets(s PacketSelection) ([]rawPacket, error) {
+	f, err := s.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	pkts := e.packets.all()
+	startTime := e.startTime
+	smgr := e.streamMgr
+	e.mu.Unlock()
+
+	if s.all() {
+		return pkts, nil
+	}
+
+	// Filters are compiled per link type, as interfaces may differ
+	matchers := make(map[layers.LinkType]*capture.Matcher)
+	decode := f != nil || s.FlowID != 0 || s.StreamID != 0
+	var out []rawPacket
+	for _, p := range pkts {
+		if p.Number < s.From || (s.To > 0 && p.Number > s.To) {
+			continue
+		}
+		if s.BPF != "" {
+			m, ok := matchers[p.LinkType]
+			if !ok {
+				if m, err = capture.NewMatcher(p.LinkType, s.BPF); err != nil {
+					return nil, err
+				}
+				matchers[p.LinkType] = m
+			}
+			ci := gopacket.CaptureInfo{Timestamp: p.CaptureAt, CaptureLength: len(p.Data), Length: p.Length}
+			if !m.Matches(ci, p.Data) {
+				continue
+			}
+		}
+		if decode {
+			pkt, info := e.storedInfo(p, startTime, smgr)
+			if (s.FlowID != 0 && info.FlowID != s.FlowID) ||
+				(s.StreamID != 0 && info.StreamID != s.StreamID) ||
+				(f != nil && !f.Match(pkt, &info)) {
+				continue
+			}
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
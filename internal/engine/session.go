@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"sniffox/internal/models"
+	"sniffox/internal/sessionstore"
+)
+
+// ErrNoPackets is returned by SaveSession when no packets are retained.
+var ErrNoPackets = errors.New("no packets to save")
+
+// SavedSession describes a session written by SaveSession. It is stored as
+// <ID>.json beside <ID>.pcap, in the sessions format.
+type SavedSession struct {
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	Timestamp string        `json:"timestamp"`
+	Packets   int           `json:"packets"`
+	Size      int64         `json:"size"`
+	Notes     []models.Note `json:"notes,omitempty"`
+}
+
+// countWriter counts the bytes written through it.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// SaveSession writes the retained packets and the investigation notes to
+// st as a session named name.
+func (e *Engine) SaveSession(st sessionstore.Store, name string) (*SavedSession, error) {
+	count := e.PacketCount()
+	if count == 0 {
+		return nil, ErrNoPackets
+	}
+
+	id := time.Now().Format("20060102-150405")
+	f, err := st.Create(id + ".pcap")
+	if err != nil {
+		return nil, fmt.Errorf("create session file: %w", err)
+	}
+	cw := &countWriter{w: f}
+	if err := e.ExportPcap(cw, ExportOptions{}); err != nil {
+		f.Abort()
+		return nil, fmt.Errorf("write pcap: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("store session: %w", err)
+	}
+
+	s := &SavedSession{
+		ID:        id,
+		Name:      name,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Packets:   count,
+		Size:      cw.n,
+		Notes:     e.GetNotes(),
+	}
+	data, _ := json.Marshal(s)
+	mf, err := st.Create(id + ".json")
+	if err == nil {
+		mf.Write(data)
+		err = mf.Close()
+	}
+	if err != nil {
+		st.Remove(id + ".pcap")
+		return nil, fmt.Errorf("store session: %w", err)
+	}
+	return s, nil
+}
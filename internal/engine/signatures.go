@@ -0,0 +1,25 @@
+package engine
+
+import (
+	"io"
+
+	"sniffox/internal/rules"
+)
+
+// LoadRules replaces the signature rules with those of a Suricata-style
+// rules file. It returns how many loaded and why the others did not.
+func (e *Engine) LoadRules(r io.Reader) (int, []rules.LoadError) {
+	return e.signatures.Load(r)
+}
+
+// GetRules returns the signature rules with how often each matched in the
+// current capture.
+func (e *Engine) GetRules() []rules.RuleStatus {
+	return e.signatures.Rules()
+}
+
+// SetHomeNet sets the addresses and CIDRs rules refer to as $HOME_NET. It
+// applies to rules loaded afterwards.
+func (e *Engine) SetHomeNet(nets []string) error {
+	return e.signatures.SetHomeNet(nets)
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"sniffox/internal/models"
+	"sniffox/internal/stream"
+)
+
+// Snapshot is a self-contained, read-only copy of the current analysis.
+// It carries no raw packet bytes and grants no capture control.
+type Snapshot struct {
+	Token     string                 `json:"token"`
+	Name      string                 `json:"name"`
+	CreatedAt string                 `json:"createdAt"`
+	LinkType  string                 `json:"linkType"`
+	Packets   []models.PacketSummary `json:"packets"`
+	Flows     []models.FlowInfo      `json:"flows"`
+	Streams   []stream.StreamSummary `json:"streams"`
+	Alerts    []models.Alert         `json:"alerts"`
+	Notes     []models.Note          `json:"notes"`
+}
+
+// BuildSnapshot assembles a snapshot from the stored packets, the flow
+// table, stream metadata and the investigation log. Alerts are supplied by the caller since most
+// detectors run in the browser.
+func (e *Engine) BuildSnapshot(name string, alerts []models.Alert) (*Snapshot, error) {
+	packets := e.packetSummaries()
+	if len(packets) == 0 {
+		return nil, fmt.Errorf("no packets to snapshot")
+	}
+
+	e.mu.Lock()
+	lt := e.linkType
+	smgr := e.streamMgr
+	e.mu.Unlock()
+
+	streams := []stream.StreamSummary{}
+	if smgr != nil {
+		streams = smgr.ListStreams()
+	}
+	if alerts == nil {
+		alerts = []models.Alert{}
+	}
+
+	return &Snapshot{
+		Name:      name,
+		CreatedAt: time.Now().Format(time.RFC3339),
+		LinkType:  lt.String(),
+		Packets:   packets,
+		Flows:     e.GetFlowInfos(),
+		Streams:   streams,
+		Alerts:    alerts,
+		Notes:     e.GetNotes(),
+	}, nil
+}
@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"sort"
+	"time"
+)
+
+// Retention bounds the raw packet store. A zero field means no limit on
+// that dimension; when several are set the tightest one wins.
+type Retention struct {
+	MaxPackets int
+	MaxBytes   int64
+	MaxAge     time.Duration // measured back from the newest packet
+}
+
+// packetStore is a ring buffer of raw packets that evicts the oldest
+// entries once the retention limits are exceeded.
+type packetStore struct {
+	limits  Retention
+	buf     []rawPacket
+	head    int // index of the oldest packet
+	n       int
+	bytes   int64
+	evicted int
+}
+
+// reset empties the store and applies new limits.
+func (s *packetStore) reset(limits Retention) {
+	*s = packetStore{limits: limits}
+}
+
+// add appends a packet and evicts whatever no longer fits.
+func (s *packetStore) add(p rawPacket) {
+	if s.n == len(s.buf) {
+		s.grow()
+	}
+	s.buf[(s.head+s.n)%len(s.buf)] = p
+	s.n++
+	s.bytes += int64(len(p.Data) + len(p.Reassembled))
+
+	for s.n > 1 && s.overLimit(p.CaptureAt) {
+		s.dropOldest()
+	}
+}
+
+// trimNewest cuts the newest packet, if it is the one numbered number, to
+// its first keep bytes, or removes it if keep is negative. The bytes kept
+// are copied so the rest can be freed.
+func (s *packetStore) trimNewest(number, keep int) {
+	if s.n == 0 {
+		return
+	}
+	i := (s.head + s.n - 1) % len(s.buf)
+	p := &s.buf[i]
+	if p.Number != number {
+		return
+	}
+	s.bytes -= int64(len(p.Data) + len(p.Reassembled))
+	if keep < 0 {
+		s.buf[i] = rawPacket{}
+		s.n--
+		return
+	}
+	p.Data, p.Reassembled = clip(p.Data, keep), clip(p.Reassembled, keep)
+	s.bytes += int64(len(p.Data) + len(p.Reassembled))
+}
+
+func clip(b []byte, n int) []byte {
+	if len(b) <= n {
+		return b
+	}
+	return append([]byte(nil), b[:n]...)
+}
+
+func (s *packetStore) overLimit(newest time.Time) bool {
+	l := s.limits
+	if l.MaxPackets > 0 && s.n > l.MaxPackets {
+		return true
+	}
+	if l.MaxBytes > 0 && s.bytes > l.MaxBytes {
+		return true
+	}
+	if l.MaxAge > 0 && newest.Sub(s.buf[s.head].CaptureAt) > l.MaxAge {
+		return true
+	}
+	return false
+}
+
+func (s *packetStore) dropOldest() {
+	s.bytes -= int64(len(s.buf[s.head].Data) + len(s.buf[s.head].Reassembled))
+	s.buf[s.head] = rawPacket{}
+	s.head = (s.head + 1) % len(s.buf)
+	s.n--
+	s.evicted++
+}
+
+// grow doubles the buffer, unrolling the ring so the oldest packet is at 0.
+// A packet-count limit caps the allocation.
+func (s *packetStore) grow() {
+	size := len(s.buf) * 2
+	if size == 0 {
+		size = 1024
+	}
+	if limit := s.limits.MaxPackets + 1; s.limits.MaxPackets > 0 && size > limit {
+		size = limit
+	}
+	buf := make([]rawPacket, size)
+	s.copyTo(buf)
+	s.buf, s.head = buf, 0
+}
+
+func (s *packetStore) copyTo(dst []rawPacket) {
+	if s.n == 0 {
+		return
+	}
+	end := s.head + s.n
+	if end <= len(s.buf) {
+		copy(dst, s.buf[s.head:end])
+		return
+	}
+	k := copy(dst, s.buf[s.head:])
+	copy(dst[k:], s.buf[:end-len(s.buf)])
+}
+
+// at returns the i'th stored packet, oldest first.
+func (s *packetStore) at(i int) rawPacket {
+	return s.buf[(s.head+i)%len(s.buf)]
+}
+
+// find returns the stored packet with the given number. Packets are stored
+// in number order, so this is a binary search.
+func (s *packetStore) find(number int) (rawPacket, bool) {
+	i := sort.Search(s.n, func(i int) bool { return s.at(i).Number >= number })
+	if i < s.n && s.at(i).Number == number {
+		return s.at(i), true
+	}
+	return rawPacket{}, false
+}
+
+// since returns the stored packets numbered number or higher, oldest
+// first.
+func (s *packetStore) since(number int) []rawPacket {
+	i := sort.Search(s.n, func(i int) bool { return s.at(i).Number >= number })
+	return s.slice(i, 0)
+}
+
+// slice returns up to limit packets starting at offset, oldest first.
+func (s *packetStore) slice(offset, limit int) []rawPacket {
+	if offset >= s.n {
+		return nil
+	}
+	if limit <= 0 || offset+limit > s.n {
+		limit = s.n - offset
+	}
+	out := make([]rawPacket, limit)
+	for i := range out {
+		out[i] = s.at(offset + i)
+	}
+	return out
+}
+
+// all returns the stored packets, oldest first.
+func (s *packetStore) all() []rawPacket {
+	out := make([]rawPacket, s.n)
+	s.copyTo(out)
+	return out
+}
+
+func (s *packetStore) len() int {
+	return s.n
+}
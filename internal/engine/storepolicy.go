@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+	"sniffox/internal/storepolicy"
+	"sniffox/internal/stream"
+)
+
+// GetStorePolicy returns the storage rules in order.
+func (e *Engine) GetStorePolicy() []storepolicy.Rule {
+	return e.storePolicy.Rules()
+}
+
+// SetStorePolicy replaces the storage rules. Packets already stored are
+// kept as they are.
+func (e *Engine) SetStorePolicy(rules []storepolicy.Rule) error {
+	return e.storePolicy.SetRules(rules)
+}
+
+// applyStorePolicy cuts the stored copy of a packet just captured to its
+// headers, or drops it, and discards its stream's payload, if a storage
+// rule says so.
+func (e *Engine) applyStorePolicy(pkt gopacket.Packet, info *models.PacketInfo, smgr *stream.Manager) {
+	store := e.storePolicy.Match(pkt, info)
+	if store == storepolicy.StoreFull {
+		return
+	}
+	keep := -1
+	if store == storepolicy.StoreHeaders {
+		keep = len(pkt.Data())
+		if _, off, ok := parser.Payload(pkt); ok {
+			keep = off
+		}
+	}
+	e.mu.Lock()
+	e.packets.trimNewest(info.Number, keep)
+	e.mu.Unlock()
+	if smgr != nil && info.StreamID != 0 {
+		smgr.Discard(info.StreamID)
+	}
+}
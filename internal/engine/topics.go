@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Broadcast topics clients can subscribe to. Messages outside them, such as
+// capture start/stop, notes and replay progress, reach every client.
+const (
+	TopicPackets = "packets"
+	TopicFlows   = "flows"
+	TopicStats   = "stats"
+	TopicAlerts  = "alerts"
+	TopicStreams = "streams"
+)
+
+// Topics lists every broadcast topic.
+var Topics = []string{TopicPackets, TopicFlows, TopicStats, TopicAlerts, TopicStreams}
+
+// messageTopics maps broadcast message types to their topic.
+var messageTopics = map[string]string{
+	"packet":        TopicPackets,
+	"flow_update":   TopicFlows,
+	"capture_stats": TopicStats,
+	"io_graph":      TopicStats,
+	"alert":         TopicAlerts,
+	"stream_event":  TopicStreams,
+}
+
+// Subscribe adds topics to those sent to c and returns the result. Clients
+// start out receiving every topic; their first Subscribe narrows that to
+// just the topics given.
+func (e *Engine) Subscribe(c Client, topics []string) ([]string, error) {
+	if err := checkTopics(topics); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	set, ok := e.topics[c]
+	if !ok {
+		set = make(map[string]bool)
+		e.topics[c] = set
+	}
+	for _, t := range topics {
+		set[t] = true
+	}
+	return subscribed(set, true), nil
+}
+
+// Unsubscribe stops sending topics to c and returns those it still receives.
+func (e *Engine) Unsubscribe(c Client, topics []string) ([]string, error) {
+	if err := checkTopics(topics); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	set, ok := e.topics[c]
+	if !ok {
+		set = make(map[string]bool)
+		for _, t := range Topics {
+			set[t] = true
+		}
+		e.topics[c] = set
+	}
+	for _, t := range topics {
+		delete(set, t)
+	}
+	return subscribed(set, true), nil
+}
+
+// Subscriptions returns the topics sent to c.
+func (e *Engine) Subscriptions(c Client) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	set, ok := e.topics[c]
+	return subscribed(set, ok)
+}
+
+// wants reports whether c receives messages of type msgType. Callers hold
+// e.mu.
+func (e *Engine) wants(c Client, msgType string) bool {
+	topic, ok := messageTopics[msgType]
+	if !ok {
+		return true
+	}
+	set, ok := e.topics[c]
+	return !ok || set[topic]
+}
+
+func checkTopics(topics []string) error {
+	for _, t := range topics {
+		if !slices.Contains(Topics, t) {
+			return fmt.Errorf("unknown topic %q", t)
+		}
+	}
+	return nil
+}
+
+// subscribed lists the topics in set in Topics order, or all of them when
+// the client has never narrowed its subscription.
+func subscribed(set map[string]bool, narrowed bool) []string {
+	out := []string{}
+	for _, t := range Topics {
+		if !narrowed || set[t] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
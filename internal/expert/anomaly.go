@@ -0,0 +1,177 @@
+package expert
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Protocol anomaly kinds, as listed in Result.Anomalies.
+const (
+	AnomalyHTTPNoRequest = "http-response-without-request"
+	AnomalyDNSBadID      = "dns-id-mismatch"
+	AnomalyTLSAlert      = "tls-alert"
+	AnomalyDataAfterFIN  = "tcp-data-after-fin"
+)
+
+// maxQueries caps the outstanding DNS queries tracked; cleared when full.
+const maxQueries = 50000
+
+func (r *Result) anomaly(severity, kind, msg string) {
+	r.add(severity, msg)
+	r.Anomalies = append(r.Anomalies, kind)
+}
+
+// connKey identifies a TCP connection regardless of direction.
+type connKey struct {
+	a, b direction
+}
+
+func (d direction) conn() connKey {
+	rev := direction{d.dst, d.src, d.dstPort, d.srcPort}
+	if d.src < d.dst || (d.src == d.dst && d.srcPort < d.dstPort) {
+		return connKey{d, rev}
+	}
+	return connKey{rev, d}
+}
+
+// httpConn counts the HTTP/1.x requests of a connection still awaiting a
+// response. Only connections whose handshake was captured are tracked, so
+// a capture started mid-exchange does not flag the first response.
+type httpConn struct {
+	pending int
+}
+
+var httpMethods = [][]byte{
+	[]byte("GET "), []byte("POST "), []byte("PUT "), []byte("HEAD "),
+	[]byte("DELETE "), []byte("OPTIONS "), []byte("PATCH "), []byte("CONNECT "),
+	[]byte("TRACE "),
+}
+
+// analyzeHTTP pairs HTTP/1.x responses with requests on a connection. It
+// is given segments carrying new data only.
+func (a *Analyzer) analyzeHTTP(r *Result, dir direction, tcp *layers.TCP) {
+	c, ok := a.http[dir.conn()]
+	if !ok {
+		return
+	}
+	p := tcp.Payload
+	if bytes.HasPrefix(p, []byte("HTTP/1.")) {
+		// 1xx responses are interim and precede the final one
+		if len(p) > 9 && p[9] == '1' {
+			return
+		}
+		if c.pending == 0 {
+			r.anomaly(Warn, AnomalyHTTPNoRequest, "HTTP response without a request")
+			return
+		}
+		c.pending--
+		return
+	}
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(p, m) {
+			c.pending++
+			return
+		}
+	}
+}
+
+// dnsKey identifies a DNS query's source and destination.
+type dnsKey struct {
+	src, dst         string
+	srcPort, dstPort layers.UDPPort
+}
+
+// analyzeDNS flags responses whose transaction ID matches none of the
+// queries outstanding between the two hosts. Responses to queries sent
+// before the capture started have nothing to match and are not flagged.
+func (a *Analyzer) analyzeDNS(r *Result, k dnsKey, d *layers.DNS) {
+	if !d.QR {
+		ids, ok := a.dns[k]
+		if !ok {
+			if len(a.dns) >= maxQueries {
+				a.dns = make(map[dnsKey]map[uint16]bool)
+			}
+			ids = make(map[uint16]bool)
+			a.dns[k] = ids
+		}
+		ids[d.ID] = true
+		return
+	}
+	q := dnsKey{k.dst, k.src, k.dstPort, k.srcPort}
+	ids := a.dns[q]
+	if len(ids) == 0 {
+		return
+	}
+	if !ids[d.ID] {
+		r.anomaly(Warn, AnomalyDNSBadID, fmt.Sprintf("DNS response ID 0x%04x matches no outstanding query", d.ID))
+		return
+	}
+	delete(ids, d.ID)
+	if len(ids) == 0 {
+		delete(a.dns, q)
+	}
+}
+
+var tlsAlertNames = map[byte]string{
+	0:   "close_notify",
+	10:  "unexpected_message",
+	20:  "bad_record_mac",
+	22:  "record_overflow",
+	40:  "handshake_failure",
+	42:  "bad_certificate",
+	43:  "unsupported_certificate",
+	44:  "certificate_revoked",
+	45:  "certificate_expired",
+	46:  "certificate_unknown",
+	47:  "illegal_parameter",
+	48:  "unknown_ca",
+	49:  "access_denied",
+	50:  "decode_error",
+	51:  "decrypt_error",
+	70:  "protocol_version",
+	71:  "insufficient_security",
+	80:  "internal_error",
+	86:  "inappropriate_fallback",
+	90:  "user_canceled",
+	109: "missing_extension",
+	110: "unsupported_extension",
+	112: "unrecognized_name",
+	116: "certificate_required",
+	120: "no_application_protocol",
+}
+
+// checkTLSAlerts flags the alert records among the TLS records a segment
+// starts with. Alerts sent after the handshake are encrypted and only
+// their presence is known; they are usually a close_notify.
+func checkTLSAlerts(r *Result, p []byte) {
+	for len(p) >= 5 && p[1] == 3 && p[2] <= 4 {
+		n := int(p[3])<<8 | int(p[4])
+		if p[0] == 21 {
+			switch {
+			case n == 2 && len(p) >= 7 && (p[5] == 1 || p[5] == 2):
+				name, ok := tlsAlertNames[p[6]]
+				if !ok {
+					name = fmt.Sprintf("%d", p[6])
+				}
+				switch {
+				case p[5] == 2:
+					r.anomaly(Error, AnomalyTLSAlert, "TLS fatal alert: "+name)
+				case p[6] == 0:
+					r.anomaly(Note, AnomalyTLSAlert, "TLS alert: close_notify")
+				default:
+					r.anomaly(Warn, AnomalyTLSAlert, "TLS warning alert: "+name)
+				}
+			default:
+				r.anomaly(Note, AnomalyTLSAlert, "Encrypted TLS alert")
+			}
+		} else if p[0] < 20 || p[0] > 23 {
+			return
+		}
+		if 5+n > len(p) {
+			return
+		}
+		p = p[5+n:]
+	}
+}
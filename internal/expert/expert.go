@@ -0,0 +1,323 @@
+// Package expert flags per-packet anomalies in the manner of Wireshark's
+// expert info: TCP retransmissions, out-of-order segments, zero windows,
+// duplicate ACKs, bad checksums, expired TTLs, invalid TCP flag
+// combinations and packets larger than the MTU. It also flags protocol
+// violations: HTTP responses without a request, DNS responses matching no
+// query, TLS alerts and TCP data sent after a FIN.
+package expert
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/offload"
+)
+
+// Severity levels, lowest first.
+const (
+	Note  = "note"
+	Warn  = "warn"
+	Error = "error"
+)
+
+var rank = map[string]int{Note: 1, Warn: 2, Error: 3}
+
+const (
+	// outOfOrderWindow separates out-of-order segments from
+	// retransmissions: old data arriving this soon after the previous
+	// segment was reordered in flight rather than resent.
+	outOfOrderWindow = 3 * time.Millisecond
+	maxDirections    = 50000 // tracked TCP directions; cleared when full
+)
+
+// Result is the expert info of one packet.
+type Result struct {
+	Annotations []string
+	Severity    string   // highest severity among the annotations
+	Anomalies   []string // protocol anomaly kinds, for counting
+}
+
+func (r *Result) add(severity, msg string) {
+	r.Annotations = append(r.Annotations, msg)
+	if rank[severity] > rank[r.Severity] {
+		r.Severity = severity
+	}
+}
+
+// Attach records r on pkt's ancillary data so later stages can read it
+// with From.
+func Attach(pkt gopacket.Packet, r Result) {
+	if len(r.Annotations) == 0 {
+		return
+	}
+	md := pkt.Metadata()
+	md.AncillaryData = append(md.AncillaryData, r)
+}
+
+// From returns the expert info attached to pkt.
+func From(pkt gopacket.Packet) Result {
+	for _, a := range pkt.Metadata().AncillaryData {
+		if r, ok := a.(Result); ok {
+			return r
+		}
+	}
+	return Result{}
+}
+
+type direction struct {
+	src, dst         string
+	srcPort, dstPort layers.TCPPort
+}
+
+type tcpState struct {
+	nextSeq  uint32 // highest sequence number sent + 1
+	lastSeg  time.Time
+	lastAck  uint32
+	lastWin  uint16
+	dupAcks  int
+	seenData bool
+	finSeq   uint32 // sequence number of the FIN, once finSent
+	finSent  bool
+}
+
+// Analyzer keeps the per-direction TCP state needed to spot sequence
+// anomalies. It is not safe for concurrent use.
+type Analyzer struct {
+	// VerifyChecksums enables IPv4 header and TCP checksum validation.
+	// Packets sent by the capturing host usually carry unfinished
+	// checksums when the NIC offloads them.
+	VerifyChecksums bool
+
+	// MTU is the link MTU; larger packets are flagged as jumbo frames or
+	// offload artifacts. Zero disables the check.
+	MTU int
+
+	tcp  map[direction]*tcpState
+	http map[connKey]*httpConn
+	dns  map[dnsKey]map[uint16]bool
+}
+
+// NewAnalyzer creates an analyzer with no TCP history.
+func NewAnalyzer(verifyChecksums bool, mtu int) *Analyzer {
+	return &Analyzer{
+		VerifyChecksums: verifyChecksums,
+		MTU:             mtu,
+		tcp:             make(map[direction]*tcpState),
+		http:            make(map[connKey]*httpConn),
+		dns:             make(map[dnsKey]map[uint16]bool),
+	}
+}
+
+// Analyze inspects pkt, attaches the result to it and returns it.
+func (a *Analyzer) Analyze(pkt gopacket.Packet) Result {
+	var r Result
+	md := pkt.Metadata()
+	verify := a.VerifyChecksums && md.CaptureLength >= md.Length
+
+	var src, dst string
+	var srcIP, dstIP net.IP
+	if l := pkt.Layer(layers.LayerTypeIPv4); l != nil {
+		ip := l.(*layers.IPv4)
+		src, dst = ip.SrcIP.String(), ip.DstIP.String()
+		if verify && len(ip.Contents) >= 20 && checksum(ip.Contents, 0) != 0 {
+			r.add(Error, fmt.Sprintf("Bad IPv4 header checksum 0x%04x", ip.Checksum))
+		}
+		if ip.TTL == 0 {
+			r.add(Warn, "IPv4 TTL is zero")
+		}
+		srcIP, dstIP = ip.SrcIP.To4(), ip.DstIP.To4()
+	} else if l := pkt.Layer(layers.LayerTypeIPv6); l != nil {
+		ip := l.(*layers.IPv6)
+		src, dst = ip.SrcIP.String(), ip.DstIP.String()
+		if ip.HopLimit == 0 {
+			r.add(Warn, "IPv6 hop limit is zero")
+		}
+		srcIP, dstIP = ip.SrcIP.To16(), ip.DstIP.To16()
+	}
+
+	if o, ok := offload.Inspect(pkt, a.MTU); ok {
+		if o.TCP {
+			r.add(Note, fmt.Sprintf("Oversized TCP segment: %d bytes exceeds the %d-byte MTU (segmentation offload, about %d segments on the wire)", o.IPLength, a.MTU, o.Segments))
+		} else {
+			r.add(Note, fmt.Sprintf("Oversized packet: %d bytes exceeds the %d-byte MTU (jumbo frame or offload)", o.IPLength, a.MTU))
+		}
+	}
+
+	if l := pkt.Layer(layers.LayerTypeICMPv4); l != nil {
+		if l.(*layers.ICMPv4).TypeCode.Type() == layers.ICMPv4TypeTimeExceeded {
+			r.add(Note, "Time to live exceeded in transit")
+		}
+	}
+	if l := pkt.Layer(layers.LayerTypeICMPv6); l != nil {
+		if l.(*layers.ICMPv6).TypeCode.Type() == layers.ICMPv6TypeTimeExceeded {
+			r.add(Note, "Hop limit exceeded in transit")
+		}
+	}
+
+	if l := pkt.Layer(layers.LayerTypeTCP); l != nil && src != "" {
+		tcp := l.(*layers.TCP)
+		checkFlags(&r, tcp)
+		if verify {
+			seg := append(append([]byte{}, tcp.Contents...), tcp.Payload...)
+			if checksum(seg, sum(pseudoHeader(srcIP, dstIP, len(seg)))) != 0 {
+				r.add(Error, fmt.Sprintf("Bad TCP checksum 0x%04x", tcp.Checksum))
+			}
+		}
+		dir := direction{src, dst, tcp.SrcPort, tcp.DstPort}
+		if a.analyzeTCP(&r, dir, tcp, md.Timestamp) {
+			a.analyzeHTTP(&r, dir, tcp)
+			checkTLSAlerts(&r, tcp.Payload)
+		}
+	}
+	if l := pkt.Layer(layers.LayerTypeUDP); l != nil && src != "" {
+		udp := l.(*layers.UDP)
+		if d, ok := pkt.Layer(layers.LayerTypeDNS).(*layers.DNS); ok {
+			a.analyzeDNS(&r, dnsKey{src, dst, udp.SrcPort, udp.DstPort}, d)
+		}
+	}
+
+	Attach(pkt, r)
+	return r
+}
+
+// checkFlags flags combinations no conforming stack sends.
+func checkFlags(r *Result, tcp *layers.TCP) {
+	switch {
+	case tcp.SYN && tcp.FIN:
+		r.add(Warn, "Invalid TCP flags: SYN+FIN")
+	case tcp.SYN && tcp.RST:
+		r.add(Warn, "Invalid TCP flags: SYN+RST")
+	case tcp.FIN && tcp.PSH && tcp.URG && !tcp.ACK:
+		r.add(Warn, "Invalid TCP flags: FIN+PSH+URG without ACK (Xmas scan)")
+	case !tcp.SYN && !tcp.ACK && !tcp.FIN && !tcp.RST && !tcp.PSH && !tcp.URG:
+		r.add(Warn, "Invalid TCP flags: none set (NULL scan)")
+	case tcp.FIN && !tcp.ACK:
+		r.add(Warn, "Invalid TCP flags: FIN without ACK")
+	}
+}
+
+// analyzeTCP tracks one segment and reports whether it carries new data,
+// as opposed to a retransmission, keep-alive or bare ACK.
+func (a *Analyzer) analyzeTCP(r *Result, dir direction, tcp *layers.TCP, ts time.Time) bool {
+	st, ok := a.tcp[dir]
+	if !ok {
+		if len(a.tcp) >= maxDirections {
+			a.tcp = make(map[direction]*tcpState)
+		}
+		st = &tcpState{}
+		a.tcp[dir] = st
+	}
+	if tcp.RST {
+		delete(a.tcp, dir)
+		delete(a.http, dir.conn())
+		return false
+	}
+	if tcp.SYN && !tcp.ACK {
+		// A new connection on the same ports
+		*st = tcpState{}
+		if len(a.http) >= maxDirections {
+			a.http = make(map[connKey]*httpConn)
+		}
+		a.http[dir.conn()] = &httpConn{}
+	}
+
+	segLen := uint32(len(tcp.Payload))
+	if tcp.SYN || tcp.FIN {
+		segLen++
+	}
+
+	if tcp.Window == 0 && !tcp.SYN && !tcp.FIN {
+		r.add(Warn, "TCP ZeroWindow")
+	}
+
+	fresh := len(tcp.Payload) > 0
+	if st.seenData && segLen > 0 {
+		switch {
+		case segLen <= 1 && tcp.Seq == st.nextSeq-1 && !tcp.SYN && !tcp.FIN:
+			r.add(Note, "TCP Keep-Alive")
+			fresh = false
+		case seqLess(st.nextSeq, tcp.Seq):
+			r.add(Warn, "TCP Previous segment not captured")
+		case seqLess(tcp.Seq, st.nextSeq):
+			if ts.Sub(st.lastSeg) < outOfOrderWindow {
+				r.add(Warn, "TCP Out-Of-Order")
+			} else {
+				r.add(Note, "TCP Retransmission")
+				fresh = false
+			}
+		}
+	}
+
+	// Data past the FIN; a retransmission of earlier data is not
+	if st.finSent && len(tcp.Payload) > 0 && seqLess(st.finSeq, tcp.Seq+uint32(len(tcp.Payload))) {
+		r.anomaly(Warn, AnomalyDataAfterFIN, "TCP data after FIN")
+	}
+	if tcp.FIN && !st.finSent {
+		st.finSeq, st.finSent = tcp.Seq+uint32(len(tcp.Payload)), true
+	}
+
+	// A pure ACK repeating the previous acknowledgment and window
+	if segLen == 0 && tcp.ACK && st.seenData && tcp.Ack == st.lastAck && tcp.Window == st.lastWin && tcp.Window != 0 {
+		st.dupAcks++
+		r.add(Note, fmt.Sprintf("TCP Dup ACK #%d", st.dupAcks))
+	} else if tcp.Ack != st.lastAck || segLen > 0 {
+		st.dupAcks = 0
+	}
+
+	if segLen > 0 {
+		if end := tcp.Seq + segLen; !st.seenData || seqLess(st.nextSeq, end) {
+			st.nextSeq = end
+		}
+		st.lastSeg = ts
+	} else if !st.seenData {
+		st.nextSeq = tcp.Seq
+	}
+	st.seenData = true
+	st.lastAck, st.lastWin = tcp.Ack, tcp.Window
+	return fresh
+}
+
+// pseudoHeader builds the IPv4 or IPv6 pseudo-header covered by the TCP
+// checksum.
+func pseudoHeader(src, dst net.IP, length int) []byte {
+	if len(src) == net.IPv4len {
+		h := append(append([]byte{}, src...), dst...)
+		h = append(h, 0, byte(layers.IPProtocolTCP))
+		return binary.BigEndian.AppendUint16(h, uint16(length))
+	}
+	h := append(append([]byte{}, src...), dst...)
+	h = binary.BigEndian.AppendUint32(h, uint32(length))
+	return append(h, 0, 0, 0, byte(layers.IPProtocolTCP))
+}
+
+// seqLess compares sequence numbers modulo 2^32.
+func seqLess(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// sum adds data as big-endian 16-bit words.
+func sum(data []byte) uint32 {
+	var s uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		s += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		s += uint32(data[len(data)-1]) << 8
+	}
+	return s
+}
+
+// checksum returns the ones' complement Internet checksum of data with
+// initial added; a packet whose checksum field is correct yields zero.
+func checksum(data []byte, initial uint32) uint16 {
+	s := initial + sum(data)
+	for s>>16 != 0 {
+		s = s&0xffff + s>>16
+	}
+	return ^uint16(s)
+}
@@ -0,0 +1,58 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+)
+
+// Field is a field named as in display filters, such as tcp.srcport or
+// http.host, for reading its values out of packets rather than testing
+// them.
+type Field struct {
+	name string
+	def  fieldDef
+}
+
+// CompileField looks up a field by its display filter name. Names that are
+// not built-in fields must have the <proto>.<field> form and are looked up
+// in the decoded layer details, as in filters.
+func CompileField(name string) (*Field, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if f, ok := fields[name]; ok {
+		return &Field{name: name, def: f}, nil
+	}
+	if g, ok := genericField(name); ok {
+		return &Field{name: name, def: g}, nil
+	}
+	return nil, fmt.Errorf("unknown field %q", name)
+}
+
+// Name returns the field's name, in lower case.
+func (f *Field) Name() string {
+	return f.name
+}
+
+// Values returns the field's occurrences in the packet as text, in the
+// order they appear.
+func (f *Field) Values(pkt gopacket.Packet, info *models.PacketInfo) []string {
+	vs := f.def.get(&ctx{pkt: pkt, info: info})
+	out := make([]string, len(vs))
+	for i, v := range vs {
+		switch f.def.kind {
+		case kindUint:
+			out[i] = strconv.FormatUint(v.u, 10)
+		case kindIP:
+			out[i] = v.ip.String()
+		case kindBool:
+			out[i] = strconv.FormatBool(v.b)
+		default:
+			out[i] = v.s
+		}
+	}
+	return out
+}
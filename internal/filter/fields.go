@@ -0,0 +1,698 @@
+package filter
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+)
+
+type valueKind int
+
+const (
+	kindUint valueKind = iota
+	kindString
+	kindIP
+	kindMAC
+	kindBool
+)
+
+// value is one field occurrence; only the member matching the field's
+// kind is set.
+type value struct {
+	u  uint64
+	s  string
+	ip net.IP
+	b  bool
+}
+
+// ctx is the packet being evaluated, with lazily decoded extras.
+type ctx struct {
+	pkt      gopacket.Packet
+	info     *models.PacketInfo
+	tlsDone  bool
+	clientHi *parser.TLSClientHelloInfo
+	serverHi *parser.TLSServerHelloInfo
+}
+
+func (c *ctx) tlsHello() (*parser.TLSClientHelloInfo, *parser.TLSServerHelloInfo) {
+	if !c.tlsDone {
+		c.tlsDone = true
+		if c.pkt.Layer(layers.LayerTypeTLS) != nil {
+			c.clientHi, c.serverHi = parser.ExtractTLSHello(c.pkt)
+		}
+	}
+	return c.clientHi, c.serverHi
+}
+
+// layerField returns the values of a named field in a decoded layer
+// detail, matching layer and field names case-insensitively.
+func (c *ctx) layerField(layer, field string) []value {
+	var out []value
+	for _, l := range c.info.Layers {
+		if !strings.EqualFold(l.Name, layer) {
+			continue
+		}
+		for _, f := range l.Fields {
+			if normalizeName(f.Name) == field {
+				out = append(out, value{s: f.Value})
+			}
+		}
+	}
+	return out
+}
+
+type fieldDef struct {
+	kind valueKind
+	get  func(c *ctx) []value
+}
+
+func uints(vs ...uint64) []value {
+	out := make([]value, len(vs))
+	for i, v := range vs {
+		out[i] = value{u: v}
+	}
+	return out
+}
+
+func ips(vs ...net.IP) []value {
+	out := make([]value, len(vs))
+	for i, v := range vs {
+		out[i] = value{ip: v}
+	}
+	return out
+}
+
+func strs(vs ...string) []value {
+	out := make([]value, len(vs))
+	for i, v := range vs {
+		out[i] = value{s: v}
+	}
+	return out
+}
+
+func bools(b bool) []value {
+	return []value{{b: b}}
+}
+
+func ipv4(c *ctx) *layers.IPv4 {
+	if l := c.pkt.Layer(layers.LayerTypeIPv4); l != nil {
+		return l.(*layers.IPv4)
+	}
+	return nil
+}
+
+func ipv6(c *ctx) *layers.IPv6 {
+	if l := c.pkt.Layer(layers.LayerTypeIPv6); l != nil {
+		return l.(*layers.IPv6)
+	}
+	return nil
+}
+
+func tcp(c *ctx) *layers.TCP {
+	if l := c.pkt.Layer(layers.LayerTypeTCP); l != nil {
+		return l.(*layers.TCP)
+	}
+	return nil
+}
+
+func udp(c *ctx) *layers.UDP {
+	if l := c.pkt.Layer(layers.LayerTypeUDP); l != nil {
+		return l.(*layers.UDP)
+	}
+	return nil
+}
+
+func eth(c *ctx) *layers.Ethernet {
+	if l := c.pkt.Layer(layers.LayerTypeEthernet); l != nil {
+		return l.(*layers.Ethernet)
+	}
+	return nil
+}
+
+func dns(c *ctx) *layers.DNS {
+	if l := c.pkt.Layer(layers.LayerTypeDNS); l != nil {
+		return l.(*layers.DNS)
+	}
+	return nil
+}
+
+func tcpFlag(get func(t *layers.TCP) bool) fieldDef {
+	return fieldDef{kindBool, func(c *ctx) []value {
+		if t := tcp(c); t != nil {
+			return bools(get(t))
+		}
+		return nil
+	}}
+}
+
+func httpField(names ...string) fieldDef {
+	return fieldDef{kindString, func(c *ctx) []value {
+		for _, n := range names {
+			if v := c.layerField("HTTP", n); len(v) > 0 {
+				return v
+			}
+		}
+		return nil
+	}}
+}
+
+// fields is the registry of named filter fields, following Wireshark's
+// naming where one exists.
+var fields = map[string]fieldDef{
+	"frame.len":    {kindUint, func(c *ctx) []value { return uints(uint64(c.info.Length)) }},
+	"frame.number": {kindUint, func(c *ctx) []value { return uints(uint64(c.info.Number)) }},
+	"frame.protocol": {kindString, func(c *ctx) []value {
+		return strs(c.info.Protocol)
+	}},
+	"frame.info": {kindString, func(c *ctx) []value { return strs(c.info.Info) }},
+	"flow": {kindUint, func(c *ctx) []value {
+		if c.info.FlowID == 0 {
+			return nil
+		}
+		return uints(c.info.FlowID)
+	}},
+	"stream": {kindUint, func(c *ctx) []value {
+		if c.info.StreamID == 0 {
+			return nil
+		}
+		return uints(c.info.StreamID)
+	}},
+
+	"tag":            {kindString, func(c *ctx) []value { return strs(c.info.Tags...) }},
+	"expert.message": {kindString, func(c *ctx) []value { return strs(c.info.Annotations...) }},
+	"expert.severity": {kindString, func(c *ctx) []value {
+		if c.info.Severity != "" {
+			return strs(c.info.Severity)
+		}
+		return nil
+	}},
+	"malformed": {kindString, func(c *ctx) []value {
+		if c.info.Malformed != "" {
+			return strs(c.info.Malformed)
+		}
+		return nil
+	}},
+	"interface": {kindString, func(c *ctx) []value {
+		if c.info.Interface != "" {
+			return strs(c.info.Interface)
+		}
+		return nil
+	}},
+	"eth.src": {kindMAC, func(c *ctx) []value {
+		if e := eth(c); e != nil {
+			return strs(e.SrcMAC.String())
+		}
+		return nil
+	}},
+	"eth.dst": {kindMAC, func(c *ctx) []value {
+		if e := eth(c); e != nil {
+			return strs(e.DstMAC.String())
+		}
+		return nil
+	}},
+	"eth.addr": {kindMAC, func(c *ctx) []value {
+		if e := eth(c); e != nil {
+			return strs(e.SrcMAC.String(), e.DstMAC.String())
+		}
+		return nil
+	}},
+	"eth.type": {kindUint, func(c *ctx) []value {
+		if e := eth(c); e != nil {
+			return uints(uint64(e.EthernetType))
+		}
+		return nil
+	}},
+	"vlan.id": {kindUint, func(c *ctx) []value {
+		var out []value
+		for _, l := range c.pkt.Layers() {
+			if q, ok := l.(*layers.Dot1Q); ok {
+				out = append(out, value{u: uint64(q.VLANIdentifier)})
+			}
+		}
+		return out
+	}},
+	"mpls.label": {kindUint, func(c *ctx) []value {
+		var out []value
+		for _, l := range c.pkt.Layers() {
+			if m, ok := l.(*layers.MPLS); ok {
+				out = append(out, value{u: uint64(m.Label)})
+			}
+		}
+		return out
+	}},
+
+	"arp.opcode": {kindUint, func(c *ctx) []value {
+		if l := c.pkt.Layer(layers.LayerTypeARP); l != nil {
+			return uints(uint64(l.(*layers.ARP).Operation))
+		}
+		return nil
+	}},
+	"arp.src.proto_ipv4": {kindIP, func(c *ctx) []value {
+		if l := c.pkt.Layer(layers.LayerTypeARP); l != nil {
+			return ips(net.IP(l.(*layers.ARP).SourceProtAddress))
+		}
+		return nil
+	}},
+	"arp.dst.proto_ipv4": {kindIP, func(c *ctx) []value {
+		if l := c.pkt.Layer(layers.LayerTypeARP); l != nil {
+			return ips(net.IP(l.(*layers.ARP).DstProtAddress))
+		}
+		return nil
+	}},
+
+	"ip.src": {kindIP, func(c *ctx) []value {
+		if ip := ipv4(c); ip != nil {
+			return ips(ip.SrcIP)
+		}
+		return nil
+	}},
+	"ip.dst": {kindIP, func(c *ctx) []value {
+		if ip := ipv4(c); ip != nil {
+			return ips(ip.DstIP)
+		}
+		return nil
+	}},
+	"ip.addr": {kindIP, func(c *ctx) []value {
+		if ip := ipv4(c); ip != nil {
+			return ips(ip.SrcIP, ip.DstIP)
+		}
+		return nil
+	}},
+	"ip.ttl": {kindUint, func(c *ctx) []value {
+		if ip := ipv4(c); ip != nil {
+			return uints(uint64(ip.TTL))
+		}
+		return nil
+	}},
+	"ip.proto": {kindUint, func(c *ctx) []value {
+		if ip := ipv4(c); ip != nil {
+			return uints(uint64(ip.Protocol))
+		}
+		return nil
+	}},
+	"ip.len": {kindUint, func(c *ctx) []value {
+		if ip := ipv4(c); ip != nil {
+			return uints(uint64(ip.Length))
+		}
+		return nil
+	}},
+	"ip.id": {kindUint, func(c *ctx) []value {
+		if ip := ipv4(c); ip != nil {
+			return uints(uint64(ip.Id))
+		}
+		return nil
+	}},
+	"ip.flags.df": {kindBool, func(c *ctx) []value {
+		if ip := ipv4(c); ip != nil {
+			return bools(ip.Flags&layers.IPv4DontFragment != 0)
+		}
+		return nil
+	}},
+	"ip.flags.mf": {kindBool, func(c *ctx) []value {
+		if ip := ipv4(c); ip != nil {
+			return bools(ip.Flags&layers.IPv4MoreFragments != 0)
+		}
+		return nil
+	}},
+
+	"ipv6.src": {kindIP, func(c *ctx) []value {
+		if ip := ipv6(c); ip != nil {
+			return ips(ip.SrcIP)
+		}
+		return nil
+	}},
+	"ipv6.dst": {kindIP, func(c *ctx) []value {
+		if ip := ipv6(c); ip != nil {
+			return ips(ip.DstIP)
+		}
+		return nil
+	}},
+	"ipv6.addr": {kindIP, func(c *ctx) []value {
+		if ip := ipv6(c); ip != nil {
+			return ips(ip.SrcIP, ip.DstIP)
+		}
+		return nil
+	}},
+	"ipv6.hlim": {kindUint, func(c *ctx) []value {
+		if ip := ipv6(c); ip != nil {
+			return uints(uint64(ip.HopLimit))
+		}
+		return nil
+	}},
+	"ipv6.nxt": {kindUint, func(c *ctx) []value {
+		if ip := ipv6(c); ip != nil {
+			return uints(uint64(ip.NextHeader))
+		}
+		return nil
+	}},
+
+	"tcp.srcport": {kindUint, func(c *ctx) []value {
+		if t := tcp(c); t != nil {
+			return uints(uint64(t.SrcPort))
+		}
+		return nil
+	}},
+	"tcp.dstport": {kindUint, func(c *ctx) []value {
+		if t := tcp(c); t != nil {
+			return uints(uint64(t.DstPort))
+		}
+		return nil
+	}},
+	"tcp.port": {kindUint, func(c *ctx) []value {
+		if t := tcp(c); t != nil {
+			return uints(uint64(t.SrcPort), uint64(t.DstPort))
+		}
+		return nil
+	}},
+	"tcp.len": {kindUint, func(c *ctx) []value {
+		if t := tcp(c); t != nil {
+			return uints(uint64(len(t.Payload)))
+		}
+		return nil
+	}},
+	"tcp.seq": {kindUint, func(c *ctx) []value {
+		if t := tcp(c); t != nil {
+			return uints(uint64(t.Seq))
+		}
+		return nil
+	}},
+	"tcp.ack": {kindUint, func(c *ctx) []value {
+		if t := tcp(c); t != nil {
+			return uints(uint64(t.Ack))
+		}
+		return nil
+	}},
+	"tcp.window_size": {kindUint, func(c *ctx) []value {
+		if t := tcp(c); t != nil {
+			return uints(uint64(t.Window))
+		}
+		return nil
+	}},
+	"tcp.flags.syn":   tcpFlag(func(t *layers.TCP) bool { return t.SYN }),
+	"tcp.flags.ack":   tcpFlag(func(t *layers.TCP) bool { return t.ACK }),
+	"tcp.flags.fin":   tcpFlag(func(t *layers.TCP) bool { return t.FIN }),
+	"tcp.flags.reset": tcpFlag(func(t *layers.TCP) bool { return t.RST }),
+	"tcp.flags.push":  tcpFlag(func(t *layers.TCP) bool { return t.PSH }),
+	"tcp.flags.urg":   tcpFlag(func(t *layers.TCP) bool { return t.URG }),
+
+	"udp.srcport": {kindUint, func(c *ctx) []value {
+		if u := udp(c); u != nil {
+			return uints(uint64(u.SrcPort))
+		}
+		return nil
+	}},
+	"udp.dstport": {kindUint, func(c *ctx) []value {
+		if u := udp(c); u != nil {
+			return uints(uint64(u.DstPort))
+		}
+		return nil
+	}},
+	"udp.port": {kindUint, func(c *ctx) []value {
+		if u := udp(c); u != nil {
+			return uints(uint64(u.SrcPort), uint64(u.DstPort))
+		}
+		return nil
+	}},
+	"udp.length": {kindUint, func(c *ctx) []value {
+		if u := udp(c); u != nil {
+			return uints(uint64(u.Length))
+		}
+		return nil
+	}},
+
+	"icmp.type": {kindUint, func(c *ctx) []value {
+		if l := c.pkt.Layer(layers.LayerTypeICMPv4); l != nil {
+			return uints(uint64(l.(*layers.ICMPv4).TypeCode.Type()))
+		}
+		return nil
+	}},
+	"icmp.code": {kindUint, func(c *ctx) []value {
+		if l := c.pkt.Layer(layers.LayerTypeICMPv4); l != nil {
+			return uints(uint64(l.(*layers.ICMPv4).TypeCode.Code()))
+		}
+		return nil
+	}},
+	"icmpv6.type": {kindUint, func(c *ctx) []value {
+		if l := c.pkt.Layer(layers.LayerTypeICMPv6); l != nil {
+			return uints(uint64(l.(*layers.ICMPv6).TypeCode.Type()))
+		}
+		return nil
+	}},
+	"icmpv6.code": {kindUint, func(c *ctx) []value {
+		if l := c.pkt.Layer(layers.LayerTypeICMPv6); l != nil {
+			return uints(uint64(l.(*layers.ICMPv6).TypeCode.Code()))
+		}
+		return nil
+	}},
+
+	"dns.qry.name": {kindString, func(c *ctx) []value {
+		d := dns(c)
+		if d == nil {
+			return nil
+		}
+		out := make([]value, 0, len(d.Questions))
+		for _, q := range d.Questions {
+			out = append(out, value{s: string(q.Name)})
+		}
+		return out
+	}},
+	"dns.qry.type": {kindUint, func(c *ctx) []value {
+		d := dns(c)
+		if d == nil {
+			return nil
+		}
+		out := make([]value, 0, len(d.Questions))
+		for _, q := range d.Questions {
+			out = append(out, value{u: uint64(q.Type)})
+		}
+		return out
+	}},
+	"dns.flags.response": {kindBool, func(c *ctx) []value {
+		if d := dns(c); d != nil {
+			return bools(d.QR)
+		}
+		return nil
+	}},
+	"dns.flags.rcode": {kindUint, func(c *ctx) []value {
+		if d := dns(c); d != nil {
+			return uints(uint64(d.ResponseCode))
+		}
+		return nil
+	}},
+	"dns.count.answers": {kindUint, func(c *ctx) []value {
+		if d := dns(c); d != nil {
+			return uints(uint64(d.ANCount))
+		}
+		return nil
+	}},
+	"dns.resp.name": {kindString, func(c *ctx) []value {
+		d := dns(c)
+		if d == nil {
+			return nil
+		}
+		out := make([]value, 0, len(d.Answers))
+		for _, a := range d.Answers {
+			out = append(out, value{s: string(a.Name)})
+		}
+		return out
+	}},
+	"dns.a": {kindIP, func(c *ctx) []value {
+		d := dns(c)
+		if d == nil {
+			return nil
+		}
+		var out []value
+		for _, a := range d.Answers {
+			if a.Type == layers.DNSTypeA && a.IP != nil {
+				out = append(out, value{ip: a.IP})
+			}
+		}
+		return out
+	}},
+	"dns.aaaa": {kindIP, func(c *ctx) []value {
+		d := dns(c)
+		if d == nil {
+			return nil
+		}
+		var out []value
+		for _, a := range d.Answers {
+			if a.Type == layers.DNSTypeAAAA && a.IP != nil {
+				out = append(out, value{ip: a.IP})
+			}
+		}
+		return out
+	}},
+
+	"http.request.method": httpField("method"),
+	"http.request.uri":    httpField("uri"),
+	"http.host":           httpField("host"),
+	"http.user_agent":     httpField("useragent"),
+	"http.content_type":   httpField("contenttype"),
+	"http.server":         httpField("server"),
+	"http.response.code": {kindUint, func(c *ctx) []value {
+		var out []value
+		for _, v := range c.layerField("HTTP", "statuscode") {
+			if n, err := strconv.ParseUint(v.s, 10, 16); err == nil {
+				out = append(out, value{u: n})
+			}
+		}
+		return out
+	}},
+	"http.request": {kindBool, func(c *ctx) []value {
+		if len(c.layerField("HTTP", "method")) > 0 {
+			return bools(true)
+		}
+		return nil
+	}},
+	"http.response": {kindBool, func(c *ctx) []value {
+		if len(c.layerField("HTTP", "statuscode")) > 0 {
+			return bools(true)
+		}
+		return nil
+	}},
+
+	"tls.handshake.extensions_server_name": {kindString, tlsSNI},
+	"tls.sni":                              {kindString, tlsSNI},
+	"tls.handshake.ja3": {kindString, func(c *ctx) []value {
+		if ch, _ := c.tlsHello(); ch != nil && ch.JA3Hash != "" {
+			return strs(ch.JA3Hash)
+		}
+		return nil
+	}},
+	"tls.handshake.type": {kindUint, func(c *ctx) []value {
+		ch, sh := c.tlsHello()
+		switch {
+		case ch != nil:
+			return uints(1)
+		case sh != nil:
+			return uints(2)
+		}
+		return nil
+	}},
+	"tls.handshake.extensions_alpn_str": {kindString, func(c *ctx) []value {
+		ch, sh := c.tlsHello()
+		switch {
+		case ch != nil:
+			return strs(ch.ALPN...)
+		case sh != nil && sh.ALPN != "":
+			return strs(sh.ALPN)
+		}
+		return nil
+	}},
+	"tls.handshake.ciphersuite": {kindUint, func(c *ctx) []value {
+		if _, sh := c.tlsHello(); sh != nil {
+			return uints(uint64(sh.CipherSuite))
+		}
+		return nil
+	}},
+}
+
+func tlsSNI(c *ctx) []value {
+	if ch, _ := c.tlsHello(); ch != nil && ch.SNI != "" {
+		return strs(ch.SNI)
+	}
+	return nil
+}
+
+// protocolLayers maps filter protocol names to decoded layer types.
+var protocolLayers = map[string]gopacket.LayerType{
+	"eth":    layers.LayerTypeEthernet,
+	"sll":    layers.LayerTypeLinuxSLL,
+	"sll2":   parser.LayerTypeLinuxSLL2,
+	"null":   layers.LayerTypeLoopback,
+	"ppp":    layers.LayerTypePPP,
+	"vlan":   layers.LayerTypeDot1Q,
+	"arp":    layers.LayerTypeARP,
+	"ip":     layers.LayerTypeIPv4,
+	"ipv6":   layers.LayerTypeIPv6,
+	"tcp":    layers.LayerTypeTCP,
+	"udp":    layers.LayerTypeUDP,
+	"icmp":   layers.LayerTypeICMPv4,
+	"icmpv6": layers.LayerTypeICMPv6,
+	"dns":    layers.LayerTypeDNS,
+	"dhcp":   layers.LayerTypeDHCPv4,
+	"dhcpv6": layers.LayerTypeDHCPv6,
+	"ntp":    layers.LayerTypeNTP,
+	"tls":    layers.LayerTypeTLS,
+	"igmp":   layers.LayerTypeIGMP,
+	"gre":    layers.LayerTypeGRE,
+	"mpls":   layers.LayerTypeMPLS,
+	"sctp":   layers.LayerTypeSCTP,
+	"stp":    layers.LayerTypeSTP,
+}
+
+// layerAliases maps filter protocol names to the display names used in
+// decoded layer details, for the generic <proto>.<field> lookup.
+var layerAliases = map[string]string{
+	"eth":  "Ethernet II",
+	"sll":  "Linux cooked capture",
+	"sll2": "Linux cooked capture v2",
+	"null": "Null/Loopback",
+	"vlan": "802.1Q VLAN",
+	"qinq": "802.1ad VLAN",
+	"ip":   "IPv4",
+	"icmp": "ICMPv4",
+	"dhcp": "DHCPv4",
+}
+
+// hasProtocol reports whether the packet contains the named protocol,
+// either as a decoded layer or as a heuristically detected application
+// protocol (SSH, QUIC, MQTT, …).
+func hasProtocol(c *ctx, name string) bool {
+	if lt, ok := protocolLayers[name]; ok && c.pkt.Layer(lt) != nil {
+		return true
+	}
+	if strings.EqualFold(c.info.Protocol, name) {
+		return true
+	}
+	layerName := name
+	if alias, ok := layerAliases[name]; ok {
+		layerName = alias
+	}
+	for _, l := range c.info.Layers {
+		if strings.EqualFold(l.Name, layerName) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeName lower-cases a name and strips separators so
+// "User-Agent", "user_agent" and "User Agent" compare equal.
+func normalizeName(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '-' || c == '_':
+		case c >= 'A' && c <= 'Z':
+			b.WriteByte(c + 'a' - 'A')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// genericField resolves <proto>.<field> against the decoded layer details
+// for protocols without registered fields (e.g. ntp.stratum, sip.method).
+func genericField(name string) (fieldDef, bool) {
+	dot := strings.IndexByte(name, '.')
+	if dot <= 0 || dot == len(name)-1 {
+		return fieldDef{}, false
+	}
+	proto, field := name[:dot], normalizeName(strings.ReplaceAll(name[dot+1:], ".", ""))
+	layer := proto
+	if alias, ok := layerAliases[proto]; ok {
+		layer = alias
+	}
+	return fieldDef{kindString, func(c *ctx) []value {
+		return c.layerField(layer, field)
+	}}, true
+}
@@ -0,0 +1,377 @@
+package filter
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+)
+
+// Filter is a compiled display filter expression, e.g.
+//
+//	tcp.port == 443 && ip.src == 10.0.0.0/8 && dns.qry.name contains "example"
+//
+// Fields follow Wireshark naming. A field with several occurrences (ip.addr,
+// tcp.port) matches a comparison if any occurrence does; != is the negation
+// of ==. A bare field or protocol name tests for presence.
+type Filter struct {
+	expr    string
+	root    node
+	generic []string
+}
+
+// Compile parses a filter expression.
+func Compile(expr string) (*Filter, error) {
+	toks, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{toks: toks}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at offset %d", describe(t), t.pos)
+	}
+	return &Filter{expr: expr, root: root, generic: p.generic}, nil
+}
+
+// String returns the source expression.
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// GenericFields returns the field names in the expression that are not
+// built-in fields and are instead looked up in the decoded layer details;
+// a misspelt or unsupported name among them simply never matches.
+func (f *Filter) GenericFields() []string {
+	return f.generic
+}
+
+// Match reports whether the packet satisfies the filter.
+func (f *Filter) Match(pkt gopacket.Packet, info *models.PacketInfo) bool {
+	return f.root.eval(&ctx{pkt: pkt, info: info})
+}
+
+type node interface {
+	eval(c *ctx) bool
+}
+
+type andNode struct{ l, r node }
+type orNode struct{ l, r node }
+type notNode struct{ x node }
+
+func (n andNode) eval(c *ctx) bool { return n.l.eval(c) && n.r.eval(c) }
+func (n orNode) eval(c *ctx) bool  { return n.l.eval(c) || n.r.eval(c) }
+func (n notNode) eval(c *ctx) bool { return !n.x.eval(c) }
+
+// protoNode tests for the presence of a protocol.
+type protoNode struct{ name string }
+
+func (n protoNode) eval(c *ctx) bool { return hasProtocol(c, n.name) }
+
+// existsNode tests that a field has at least one occurrence; for boolean
+// fields the occurrence must also be true.
+type existsNode struct{ f fieldDef }
+
+func (n existsNode) eval(c *ctx) bool {
+	vals := n.f.get(c)
+	if n.f.kind != kindBool {
+		return len(vals) > 0
+	}
+	for _, v := range vals {
+		if v.b {
+			return true
+		}
+	}
+	return false
+}
+
+// cmpNode compares a field against a literal.
+type cmpNode struct {
+	f     fieldDef
+	op    string
+	lit   value
+	num   bool // string field compared as a number
+	ipNet *net.IPNet
+	re    *regexp.Regexp
+}
+
+func (n cmpNode) eval(c *ctx) bool {
+	vals := n.f.get(c)
+	if n.op == "!=" {
+		for _, v := range vals {
+			if n.test(v, "==") {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range vals {
+		if n.test(v, n.op) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n cmpNode) test(v value, op string) bool {
+	switch n.f.kind {
+	case kindUint:
+		return compareOrdered(v.u, n.lit.u, op)
+	case kindBool:
+		return v.b == n.lit.b
+	case kindIP:
+		if n.ipNet != nil {
+			return n.ipNet.Contains(v.ip)
+		}
+		return v.ip.Equal(n.lit.ip)
+	case kindMAC:
+		return strings.EqualFold(v.s, n.lit.s)
+	}
+
+	// String fields
+	switch op {
+	case "contains":
+		return strings.Contains(v.s, n.lit.s)
+	case "matches":
+		return n.re.MatchString(v.s)
+	}
+	if n.num {
+		f, err := strconv.ParseFloat(strings.Fields(v.s + " ")[0], 64)
+		if err != nil {
+			return false
+		}
+		lit, _ := strconv.ParseFloat(n.lit.s, 64)
+		return compareOrdered(f, lit, op)
+	}
+	return compareOrdered(v.s, n.lit.s, op)
+}
+
+func compareOrdered[T uint64 | float64 | string](a, b T, op string) bool {
+	switch op {
+	case "==":
+		return a == b
+	case ">":
+		return a > b
+	case "<":
+		return a < b
+	case ">=":
+		return a >= b
+	case "<=":
+		return a <= b
+	}
+	return false
+}
+
+type exprParser struct {
+	toks    []token
+	pos     int
+	generic []string // field names resolved by genericField
+}
+
+func (p *exprParser) peek() token { return p.toks[p.pos] }
+
+func (p *exprParser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) addGeneric(name string) {
+	if !slices.Contains(p.generic, name) {
+		p.generic = append(p.generic, name)
+	}
+}
+
+func (p *exprParser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = orNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseAnd() (node, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokAnd {
+		p.next()
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = andNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseNot() (node, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("expected ) at offset %d, got %s", closing.pos, describe(closing))
+		}
+		return n, nil
+	case tokWord:
+		return p.parseComparison(t)
+	default:
+		return nil, fmt.Errorf("expected field or protocol at offset %d, got %s", t.pos, describe(t))
+	}
+}
+
+func (p *exprParser) parseComparison(fieldTok token) (node, error) {
+	name := strings.ToLower(fieldTok.text)
+	f, known := fields[name]
+
+	if p.peek().kind != tokOp {
+		if known {
+			return existsNode{f}, nil
+		}
+		if strings.Contains(name, ".") {
+			g, _ := genericField(name)
+			p.addGeneric(name)
+			return existsNode{g}, nil
+		}
+		return protoNode{name}, nil
+	}
+
+	op := p.next()
+	lit := p.next()
+	if lit.kind != tokWord && lit.kind != tokString {
+		return nil, fmt.Errorf("expected value after %s at offset %d", op.text, lit.pos)
+	}
+	if !known {
+		g, ok := genericField(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q at offset %d", fieldTok.text, fieldTok.pos)
+		}
+		f = g
+		p.addGeneric(name)
+	}
+	return buildCmp(f, name, op.text, lit)
+}
+
+func buildCmp(f fieldDef, name, op string, lit token) (node, error) {
+	n := cmpNode{f: f, op: op}
+	bad := func(what string) error {
+		return fmt.Errorf("%s: %q is not a valid %s (offset %d)", name, lit.text, what, lit.pos)
+	}
+	ordered := op == ">" || op == "<" || op == ">=" || op == "<="
+	stringOp := op == "contains" || op == "matches"
+
+	switch f.kind {
+	case kindUint:
+		if stringOp {
+			return nil, fmt.Errorf("%s: %s needs a string field", name, op)
+		}
+		v, err := strconv.ParseUint(lit.text, 0, 64)
+		if err != nil {
+			return nil, bad("number")
+		}
+		n.lit.u = v
+	case kindBool:
+		if op != "==" && op != "!=" {
+			return nil, fmt.Errorf("%s: only == and != apply to flags", name)
+		}
+		switch strings.ToLower(lit.text) {
+		case "1", "true":
+			n.lit.b = true
+		case "0", "false":
+		default:
+			return nil, bad("boolean")
+		}
+	case kindIP:
+		if op != "==" && op != "!=" {
+			return nil, fmt.Errorf("%s: only == and != apply to addresses", name)
+		}
+		if strings.Contains(lit.text, "/") {
+			_, ipNet, err := net.ParseCIDR(lit.text)
+			if err != nil {
+				return nil, bad("CIDR")
+			}
+			n.ipNet = ipNet
+		} else if n.lit.ip = net.ParseIP(lit.text); n.lit.ip == nil {
+			return nil, bad("IP address")
+		}
+	case kindMAC:
+		if op != "==" && op != "!=" {
+			return nil, fmt.Errorf("%s: only == and != apply to MAC addresses", name)
+		}
+		mac, err := net.ParseMAC(lit.text)
+		if err != nil {
+			return nil, bad("MAC address")
+		}
+		n.lit.s = mac.String()
+	case kindString:
+		n.lit.s = lit.text
+		if op == "matches" {
+			re, err := regexp.Compile(lit.text)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid regular expression: %v", name, err)
+			}
+			n.re = re
+		}
+		if ordered || op == "==" || op == "!=" {
+			if _, err := strconv.ParseFloat(lit.text, 64); err == nil && lit.kind == tokWord {
+				n.num = true
+			}
+		}
+	}
+	return n, nil
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokLParen:
+		return "("
+	case tokRParen:
+		return ")"
+	case tokAnd:
+		return "&&"
+	case tokOr:
+		return "||"
+	case tokNot:
+		return "!"
+	default:
+		return strconv.Quote(t.text)
+	}
+}
@@ -0,0 +1,115 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+	tokOp // comparison operator, normalized in token.text
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// wordChar reports whether c can appear in a bare word: field names,
+// numbers, IPv4/IPv6 addresses, CIDRs and MAC addresses.
+func wordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '.' || c == '_' || c == '-' || c == ':' || c == '/'
+}
+
+var keywordTokens = map[string]token{
+	"and":      {kind: tokAnd},
+	"or":       {kind: tokOr},
+	"not":      {kind: tokNot},
+	"eq":       {kind: tokOp, text: "=="},
+	"ne":       {kind: tokOp, text: "!="},
+	"gt":       {kind: tokOp, text: ">"},
+	"lt":       {kind: tokOp, text: "<"},
+	"ge":       {kind: tokOp, text: ">="},
+	"le":       {kind: tokOp, text: "<="},
+	"contains": {kind: tokOp, text: "contains"},
+	"matches":  {kind: tokOp, text: "matches"},
+}
+
+func lex(s string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			toks = append(toks, token{kind: tokLParen, pos: i})
+			i++
+		case c == ')':
+			toks = append(toks, token{kind: tokRParen, pos: i})
+			i++
+		case strings.HasPrefix(s[i:], "&&"):
+			toks = append(toks, token{kind: tokAnd, pos: i})
+			i += 2
+		case strings.HasPrefix(s[i:], "||"):
+			toks = append(toks, token{kind: tokOr, pos: i})
+			i += 2
+		case strings.HasPrefix(s[i:], "=="), strings.HasPrefix(s[i:], "!="),
+			strings.HasPrefix(s[i:], ">="), strings.HasPrefix(s[i:], "<="):
+			toks = append(toks, token{kind: tokOp, text: s[i : i+2], pos: i})
+			i += 2
+		case c == '>' || c == '<':
+			toks = append(toks, token{kind: tokOp, text: string(c), pos: i})
+			i++
+		case c == '~':
+			toks = append(toks, token{kind: tokOp, text: "matches", pos: i})
+			i++
+		case c == '!':
+			toks = append(toks, token{kind: tokNot, pos: i})
+			i++
+		case c == '"':
+			start := i
+			var b strings.Builder
+			i++
+			for i < len(s) && s[i] != '"' {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+				i++
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			i++
+			toks = append(toks, token{kind: tokString, text: b.String(), pos: start})
+		case wordChar(c):
+			start := i
+			for i < len(s) && wordChar(s[i]) {
+				i++
+			}
+			word := s[start:i]
+			if kw, ok := keywordTokens[strings.ToLower(word)]; ok {
+				kw.pos = start
+				toks = append(toks, kw)
+			} else {
+				toks = append(toks, token{kind: tokWord, text: word, pos: start})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(s)}), nil
+}
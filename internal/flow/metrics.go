@@ -0,0 +1,210 @@
+package flow
+
+import "time"
+
+// ThroughputWindow is how many seconds a flow's throughput is averaged over.
+const ThroughputWindow = 10
+
+// maxRTTSamples caps the RTT samples kept per flow.
+const maxRTTSamples = 64
+
+// TCPSegment holds the fields of a TCP segment the performance metrics
+// are computed from.
+type TCPSegment struct {
+	Seq     uint32
+	Ack     uint32
+	Window  uint16
+	Payload int       // bytes of data
+	Time    time.Time // capture timestamp
+}
+
+// TCPMetrics summarizes the performance of a TCP flow. RTTs are in
+// milliseconds and 0 until measured.
+type TCPMetrics struct {
+	// The handshake split at the SYN-ACK: SYN to SYN-ACK is the path to
+	// the server and back, SYN-ACK to ACK the path to the client
+	ServerRTT    float64 `json:"serverRtt,omitempty"`
+	ClientRTT    float64 `json:"clientRtt,omitempty"`
+	HandshakeRTT float64 `json:"handshakeRtt,omitempty"`
+
+	// From segments to the ACKs covering them in either direction, the
+	// handshake included, skipping segments that were retransmitted
+	RTT     float64 `json:"rtt,omitempty"` // latest sample
+	MinRTT  float64 `json:"minRtt,omitempty"`
+	MaxRTT  float64 `json:"maxRtt,omitempty"`
+	AvgRTT  float64 `json:"avgRtt,omitempty"`
+	Samples int     `json:"samples,omitempty"`
+
+	FwdRetransmits int `json:"fwdRetransmits,omitempty"`
+	RevRetransmits int `json:"revRetransmits,omitempty"`
+	FwdDupAcks     int `json:"fwdDupAcks,omitempty"`
+	RevDupAcks     int `json:"revDupAcks,omitempty"`
+	// Times each side advertised a zero receive window
+	FwdZeroWindows int `json:"fwdZeroWindows,omitempty"`
+	RevZeroWindows int `json:"revZeroWindows,omitempty"`
+}
+
+// RTTSample is one round-trip time measurement.
+type RTTSample struct {
+	Time int64   `json:"time"` // unix ms of the acknowledging segment
+	RTT  float64 `json:"rtt"`  // ms
+}
+
+// FlowMetrics is the performance detail of one flow.
+type FlowMetrics struct {
+	FlowID   uint64 `json:"flowId"`
+	Protocol string `json:"protocol"`
+	// Bytes per second over the last ThroughputWindow seconds
+	Throughput float64     `json:"throughput"`
+	TCP        *TCPMetrics `json:"tcp,omitempty"`
+	// The latest RTT samples, oldest first
+	RTTSamples []RTTSample `json:"rttSamples,omitempty"`
+	Rate       []int64     `json:"rate,omitempty"`
+	RateEnd    int64       `json:"rateEnd,omitempty"`
+}
+
+// tcpDir is the sequence state of one direction of a TCP flow.
+type tcpDir struct {
+	seqValid bool
+	nextSeq  uint32 // after the highest sequence number sent
+
+	ackValid bool
+	lastAck  uint32
+	lastWin  uint16
+	zeroWin  bool // the last window advertised was zero
+
+	// The segment being timed for an RTT sample: the sequence number
+	// that acknowledges it and when it was sent
+	timing   bool
+	timedEnd uint32
+	timedAt  time.Time
+}
+
+// tcpPerf computes a TCP flow's performance metrics from its segments.
+type tcpPerf struct {
+	m        TCPMetrics
+	fwd, rev tcpDir
+	synAt    time.Time
+	synAckAt time.Time
+	total    float64 // of the RTT samples, for the average
+	samples  []RTTSample
+}
+
+// seqBefore reports whether sequence number a comes before b, allowing
+// for wraparound.
+func seqBefore(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// observe updates the metrics with a segment sent in the forward
+// direction if fwd is set.
+func (p *tcpPerf) observe(fwd bool, flags TCPFlags, seg TCPSegment) {
+	d, o := &p.fwd, &p.rev
+	retrans, dupAcks, zeroWins := &p.m.FwdRetransmits, &p.m.FwdDupAcks, &p.m.FwdZeroWindows
+	if !fwd {
+		d, o = o, d
+		retrans, dupAcks, zeroWins = &p.m.RevRetransmits, &p.m.RevDupAcks, &p.m.RevZeroWindows
+	}
+
+	// Handshake timing; a retransmitted SYN restarts it
+	switch {
+	case flags.SYN && !flags.ACK && p.synAckAt.IsZero():
+		p.synAt = seg.Time
+	case flags.SYN && flags.ACK && p.synAckAt.IsZero():
+		p.synAckAt = seg.Time
+		if !p.synAt.IsZero() {
+			p.m.ServerRTT = ms(seg.Time.Sub(p.synAt))
+		}
+	case flags.ACK && !flags.SYN && !flags.RST && !p.synAckAt.IsZero() && p.m.ClientRTT == 0 && !p.synAt.IsZero():
+		p.m.ClientRTT = ms(seg.Time.Sub(p.synAckAt))
+		p.m.HandshakeRTT = p.m.ServerRTT + p.m.ClientRTT
+	}
+
+	// Sequence space: SYN and FIN take one number each
+	n := uint32(seg.Payload)
+	if flags.SYN {
+		n++
+	}
+	if flags.FIN {
+		n++
+	}
+	if !d.seqValid {
+		d.seqValid, d.nextSeq = true, seg.Seq
+	}
+	end := seg.Seq + n
+	switch {
+	case n == 0 || flags.RST:
+	case seqBefore(seg.Seq, d.nextSeq):
+		// A keep-alive resends the last byte and is not a retransmission
+		if seg.Payload <= 1 && !flags.SYN && !flags.FIN && end == d.nextSeq {
+			break
+		}
+		*retrans++
+		// Karn's algorithm: an ACK can't tell which copy it answers
+		d.timing = false
+		if seqBefore(d.nextSeq, end) {
+			d.nextSeq = end
+		}
+	default:
+		d.nextSeq = end
+		if !d.timing {
+			d.timing, d.timedEnd, d.timedAt = true, end, seg.Time
+		}
+	}
+
+	if !flags.ACK || flags.RST {
+		return
+	}
+	if o.timing && !seqBefore(seg.Ack, o.timedEnd) {
+		o.timing = false
+		if rtt := seg.Time.Sub(o.timedAt); rtt >= 0 {
+			p.sample(seg.Time, ms(rtt))
+		}
+	}
+	// A duplicate ACK repeats the last one while data is outstanding
+	if d.ackValid && n == 0 && seg.Ack == d.lastAck && seg.Window == d.lastWin &&
+		o.seqValid && seqBefore(seg.Ack, o.nextSeq) {
+		*dupAcks++
+	}
+	d.ackValid, d.lastAck, d.lastWin = true, seg.Ack, seg.Window
+	if seg.Window == 0 && !flags.SYN && !d.zeroWin {
+		*zeroWins++
+	}
+	d.zeroWin = seg.Window == 0
+}
+
+// sample records an RTT measurement taken at t.
+func (p *tcpPerf) sample(t time.Time, rtt float64) {
+	m := &p.m
+	if m.Samples == 0 || rtt < m.MinRTT {
+		m.MinRTT = rtt
+	}
+	m.MaxRTT = max(m.MaxRTT, rtt)
+	m.RTT = rtt
+	m.Samples++
+	p.total += rtt
+	m.AvgRTT = p.total / float64(m.Samples)
+	if len(p.samples) == maxRTTSamples {
+		p.samples = append(p.samples[:0], p.samples[1:]...)
+	}
+	p.samples = append(p.samples, RTTSample{Time: t.UnixMilli(), RTT: rtt})
+}
+
+// ms converts d to fractional milliseconds.
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// throughput returns r's bytes per second over the ThroughputWindow
+// seconds up to end.
+func (r *rateHistory) throughput(end int64) float64 {
+	s := r.series(end)
+	if s == nil {
+		return 0
+	}
+	var sum int64
+	for _, n := range s[len(s)-ThroughputWindow:] {
+		sum += n
+	}
+	return float64(sum) / ThroughputWindow
+}
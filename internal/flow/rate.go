@@ -0,0 +1,51 @@
+package flow
+
+// RateWindow is how many seconds of byte rate history each flow keeps.
+const RateWindow = 60
+
+// rateHistory counts a flow's bytes per second over the last RateWindow
+// seconds in a ring indexed by unix second.
+type rateHistory struct {
+	buckets [RateWindow]int64
+	newest  int64 // unix second of the newest bucket; 0 when empty
+}
+
+// add counts n bytes in second sec.
+func (r *rateHistory) add(sec, n int64) {
+	r.advance(sec)
+	if sec <= r.newest-RateWindow {
+		return // older than the window; the clock went back
+	}
+	r.buckets[sec%RateWindow] += n
+}
+
+// advance moves the newest bucket up to sec, zeroing the seconds skipped.
+func (r *rateHistory) advance(sec int64) {
+	switch {
+	case sec <= r.newest:
+	case r.newest == 0 || sec-r.newest >= RateWindow:
+		r.buckets = [RateWindow]int64{}
+		r.newest = sec
+	default:
+		for s := r.newest + 1; s <= sec; s++ {
+			r.buckets[s%RateWindow] = 0
+		}
+		r.newest = sec
+	}
+}
+
+// series returns the bytes per second of the RateWindow seconds up to and
+// including end, oldest first, or nil if there were none.
+func (r *rateHistory) series(end int64) []int64 {
+	if r.newest == 0 || end-r.newest >= RateWindow {
+		return nil
+	}
+	out := make([]int64, RateWindow)
+	for i := range out {
+		s := end - RateWindow + 1 + int64(i)
+		if s > r.newest-RateWindow && s <= r.newest {
+			out[i] = r.buckets[s%RateWindow]
+		}
+	}
+	return out
+}
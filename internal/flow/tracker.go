@@ -2,6 +2,7 @@ package flow
 
 import (
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 )
@@ -19,30 +20,40 @@ const (
 )
 
 // FlowKey is a normalized 5-tuple. Both directions map to the same flow.
+// Scope holds the VLAN tags and VXLAN or GENEVE networks the packets came
+// in, so the same 5-tuple in two VLANs or overlays is two flows.
 type FlowKey struct {
 	IP1      string
 	IP2      string
 	Port1    uint16
 	Port2    uint16
 	Protocol string
+	Scope    string
 }
 
-func MakeFlowKey(srcIP, dstIP string, srcPort, dstPort uint16, protocol string) FlowKey {
+func MakeFlowKey(srcIP, dstIP string, srcPort, dstPort uint16, protocol, scope string) FlowKey {
 	// Normalize: smaller IP first; if IPs equal, smaller port first
 	if srcIP < dstIP || (srcIP == dstIP && srcPort < dstPort) {
-		return FlowKey{IP1: srcIP, IP2: dstIP, Port1: srcPort, Port2: dstPort, Protocol: protocol}
+		return FlowKey{IP1: srcIP, IP2: dstIP, Port1: srcPort, Port2: dstPort, Protocol: protocol, Scope: scope}
 	}
-	return FlowKey{IP1: dstIP, IP2: srcIP, Port1: dstPort, Port2: dstPort, Protocol: protocol}
+	return FlowKey{IP1: dstIP, IP2: srcIP, Port1: dstPort, Port2: srcPort, Protocol: protocol, Scope: scope}
 }
 
 // Flow holds statistics for a single network flow.
 type Flow struct {
-	ID          uint64   `json:"id"`
-	SrcIP       string   `json:"srcIp"`
-	DstIP       string   `json:"dstIp"`
-	SrcPort     uint16   `json:"srcPort"`
-	DstPort     uint16   `json:"dstPort"`
-	Protocol    string   `json:"protocol"`
+	ID       uint64 `json:"id"`
+	SrcIP    string `json:"srcIp"`
+	DstIP    string `json:"dstIp"`
+	SrcPort  uint16 `json:"srcPort"`
+	DstPort  uint16 `json:"dstPort"`
+	Protocol string `json:"protocol"`
+	// Scope lists the VLAN tags and VXLAN or GENEVE networks the flow was
+	// seen in, such as "VXLAN 100 VLAN 10/20"
+	Scope string `json:"scope,omitempty"`
+	// FwdPath and RevPath list the MPLS labels and tunnels each direction
+	// was last carried in, such as "MPLS 16/17"; see parser.FlowPath
+	FwdPath     string   `json:"fwdPath,omitempty"`
+	RevPath     string   `json:"revPath,omitempty"`
 	PacketCount int      `json:"packetCount"`
 	ByteCount   int64    `json:"byteCount"`
 	FirstSeen   int64    `json:"firstSeen"` // unix ms
@@ -52,6 +63,38 @@ type Flow struct {
 	FwdBytes    int64    `json:"fwdBytes"`
 	RevPackets  int      `json:"revPackets"`
 	RevBytes    int64    `json:"revBytes"`
+	// TCP flags seen in each direction, ORed together as in the TCP
+	// header (FIN 0x01, SYN 0x02, RST 0x04, PSH 0x08, ACK 0x10)
+	FwdTCPFlags uint8    `json:"fwdTcpFlags,omitempty"`
+	RevTCPFlags uint8    `json:"revTcpFlags,omitempty"`
+	AppProtocol string   `json:"appProtocol,omitempty"`
+	PID         int      `json:"pid,omitempty"`
+	ProcessName string   `json:"processName,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Interfaces  []string `json:"interfaces,omitempty"`
+	SNI         string   `json:"sni,omitempty"` // from the TLS ClientHello
+	JA3         string   `json:"ja3,omitempty"`
+
+	// ICMP errors sent about the flow's packets, and the last one's type
+	ICMPErrors    int    `json:"icmpErrors,omitempty"`
+	LastICMPError string `json:"lastIcmpError,omitempty"`
+
+	// Info describes what the flow carries, such as the file of an FTP
+	// data connection
+	Info string `json:"info,omitempty"`
+
+	// Bytes per second over the last RateWindow seconds, oldest first; the
+	// last entry is unix second RateEnd. Filled in on snapshots.
+	Rate    []int64 `json:"rate,omitempty"`
+	RateEnd int64   `json:"rateEnd,omitempty"`
+
+	// Bytes per second over the last ThroughputWindow seconds, and the
+	// performance of a TCP flow. Filled in on snapshots.
+	Throughput float64     `json:"throughput,omitempty"`
+	TCP        *TCPMetrics `json:"tcp,omitempty"`
+
+	rate rateHistory
+	tcp  *tcpPerf
 }
 
 // TCPFlags holds parsed TCP flag bits.
@@ -63,6 +106,27 @@ type TCPFlags struct {
 	PSH bool
 }
 
+// Bits returns the flags as the bits of the TCP header's flags byte.
+func (f TCPFlags) Bits() uint8 {
+	var b uint8
+	if f.FIN {
+		b |= 0x01
+	}
+	if f.SYN {
+		b |= 0x02
+	}
+	if f.RST {
+		b |= 0x04
+	}
+	if f.PSH {
+		b |= 0x08
+	}
+	if f.ACK {
+		b |= 0x10
+	}
+	return b
+}
+
 // Tracker maintains the flow table.
 type Tracker struct {
 	mu       sync.Mutex
@@ -70,20 +134,36 @@ type Tracker struct {
 	nextID   uint64
 	maxFlows int
 	idleTime time.Duration
+
+	// byTuple indexes the keys of flows by their key without the scope
+	byTuple map[FlowKey][]FlowKey
+
+	// clock is the unix second of the newest packet tracked. Rates are
+	// bucketed and read in capture time, so a loaded file or a stopped
+	// capture keeps the throughput it ended with.
+	clock int64
+
+	// Flows changed and IDs evicted since the last call to Changes
+	dirty   map[FlowKey]bool
+	removed []uint64
 }
 
 // NewTracker creates a new flow tracker.
 func NewTracker() *Tracker {
 	return &Tracker{
 		flows:    make(map[FlowKey]*Flow),
+		byTuple:  make(map[FlowKey][]FlowKey),
+		dirty:    make(map[FlowKey]bool),
 		maxFlows: 10000,
 		idleTime: 5 * time.Minute,
 	}
 }
 
 // Track records a packet in the flow table and returns the flow ID and flow reference.
-func (t *Tracker) Track(srcIP, dstIP string, srcPort, dstPort uint16, protocol string, length int, flags TCPFlags) (uint64, *Flow) {
-	key := MakeFlowKey(srcIP, dstIP, srcPort, dstPort, protocol)
+// packets is usually 1; an offloaded segment may stand for several. seg
+// feeds the performance metrics of TCP flows.
+func (t *Tracker) Track(srcIP, dstIP string, srcPort, dstPort uint16, protocol, scope string, packets, length int, flags TCPFlags, seg TCPSegment) (uint64, *Flow) {
+	key := MakeFlowKey(srcIP, dstIP, srcPort, dstPort, protocol, scope)
 	now := time.Now().UnixMilli()
 
 	t.mu.Lock()
@@ -104,28 +184,45 @@ func (t *Tracker) Track(srcIP, dstIP string, srcPort, dstPort uint16, protocol s
 			SrcPort:   srcPort,
 			DstPort:   dstPort,
 			Protocol:  protocol,
+			Scope:     scope,
 			FirstSeen: now,
 			TCPState:  TCPStateNew,
 		}
 		t.flows[key] = f
+		tuple := unscoped(key)
+		t.byTuple[tuple] = append(t.byTuple[tuple], key)
 	}
 
-	f.PacketCount++
+	f.PacketCount += packets
 	f.ByteCount += int64(length)
 	f.LastSeen = now
+	sec := now / 1000
+	if !seg.Time.IsZero() {
+		sec = seg.Time.Unix()
+	}
+	t.clock = max(t.clock, sec)
+	f.rate.add(sec, int64(length))
+	t.dirty[key] = true
 
 	// Directional stats — "forward" = matches original src
-	if srcIP == f.SrcIP && srcPort == f.SrcPort {
-		f.FwdPackets++
+	fwd := srcIP == f.SrcIP && srcPort == f.SrcPort
+	if fwd {
+		f.FwdPackets += packets
 		f.FwdBytes += int64(length)
+		f.FwdTCPFlags |= flags.Bits()
 	} else {
-		f.RevPackets++
+		f.RevPackets += packets
 		f.RevBytes += int64(length)
+		f.RevTCPFlags |= flags.Bits()
 	}
 
 	// TCP state machine
 	if protocol == "TCP" || protocol == "tcp" {
 		f.TCPState = advanceTCPState(f.TCPState, flags)
+		if f.tcp == nil {
+			f.tcp = &tcpPerf{}
+		}
+		f.tcp.observe(fwd, flags, seg)
 	}
 
 	return f.ID, f
@@ -138,18 +235,246 @@ func (t *Tracker) GetFlows() []*Flow {
 
 	result := make([]*Flow, 0, len(t.flows))
 	for _, f := range t.flows {
-		cp := *f
-		result = append(result, &cp)
+		result = append(result, f.snapshot(t.clock))
 	}
 	return result
 }
 
+// snapshot returns a copy of f with its rate series ending at now, a unix
+// second of capture time.
+func (f *Flow) snapshot(now int64) *Flow {
+	cp := *f
+	cp.Tags = slices.Clone(f.Tags)
+	cp.Interfaces = slices.Clone(f.Interfaces)
+	if cp.Rate = f.rate.series(now); cp.Rate != nil {
+		cp.RateEnd = now
+	}
+	cp.Throughput = f.rate.throughput(now)
+	if f.tcp != nil {
+		m := f.tcp.m
+		cp.TCP = &m
+	}
+	cp.tcp = nil
+	return &cp
+}
+
+// Metrics returns the performance detail of the flow with the given ID.
+func (t *Tracker) Metrics(id uint64) (FlowMetrics, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, f := range t.flows {
+		if f.ID != id {
+			continue
+		}
+		cp := f.snapshot(t.clock)
+		m := FlowMetrics{FlowID: f.ID, Protocol: f.Protocol, Throughput: cp.Throughput, TCP: cp.TCP, Rate: cp.Rate, RateEnd: cp.RateEnd}
+		if f.tcp != nil {
+			m.RTTSamples = slices.Clone(f.tcp.samples)
+		}
+		return m, true
+	}
+	return FlowMetrics{}, false
+}
+
+// Label sets the application protocol of the flow matching the 5-tuple.
+func (t *Tracker) Label(srcIP, dstIP string, srcPort, dstPort uint16, protocol, scope, appProtocol string) {
+	key := MakeFlowKey(srcIP, dstIP, srcPort, dstPort, protocol, scope)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if f, ok := t.flows[key]; ok && f.AppProtocol != appProtocol {
+		f.AppProtocol = appProtocol
+		t.dirty[key] = true
+	}
+}
+
+// Tag adds host group names to the flow matching the 5-tuple.
+func (t *Tracker) Tag(srcIP, dstIP string, srcPort, dstPort uint16, protocol, scope string, tags []string) {
+	key := MakeFlowKey(srcIP, dstIP, srcPort, dstPort, protocol, scope)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, ok := t.flows[key]
+	if !ok {
+		return
+	}
+	for _, tag := range tags {
+		if !slices.Contains(f.Tags, tag) {
+			f.Tags = append(f.Tags, tag)
+			t.dirty[key] = true
+		}
+	}
+	slices.Sort(f.Tags)
+}
+
+// SeenOn records that the flow matching the 5-tuple was captured on iface.
+func (t *Tracker) SeenOn(srcIP, dstIP string, srcPort, dstPort uint16, protocol, scope string, iface string) {
+	key := MakeFlowKey(srcIP, dstIP, srcPort, dstPort, protocol, scope)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if f, ok := t.flows[key]; ok && !slices.Contains(f.Interfaces, iface) {
+		f.Interfaces = append(f.Interfaces, iface)
+		slices.Sort(f.Interfaces)
+		t.dirty[key] = true
+	}
+}
+
+// SetProcess records the local process owning the flow matching the 5-tuple.
+func (t *Tracker) SetProcess(srcIP, dstIP string, srcPort, dstPort uint16, protocol, scope string, pid int, name string) {
+	key := MakeFlowKey(srcIP, dstIP, srcPort, dstPort, protocol, scope)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if f, ok := t.flows[key]; ok {
+		f.PID = pid
+		f.ProcessName = name
+		t.dirty[key] = true
+	}
+}
+
+// SetTLS records the SNI and JA3 hash of the TLS ClientHello sent on the
+// flow matching the 5-tuple.
+func (t *Tracker) SetTLS(srcIP, dstIP string, srcPort, dstPort uint16, protocol, scope, sni, ja3 string) {
+	key := MakeFlowKey(srcIP, dstIP, srcPort, dstPort, protocol, scope)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if f, ok := t.flows[key]; ok {
+		f.SNI, f.JA3 = sni, ja3
+		t.dirty[key] = true
+	}
+}
+
+// SetStreamTLS records the SNI and JA3 hash of a TLS ClientHello found by
+// stream reassembly on every flow matching the TCP 5-tuple, whatever its
+// scope: reassembly does not tell VLANs or tunnels apart.
+func (t *Tracker) SetStreamTLS(srcIP, dstIP string, srcPort, dstPort uint16, sni, ja3 string) {
+	tuple := MakeFlowKey(srcIP, dstIP, srcPort, dstPort, "TCP", "")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range t.byTuple[tuple] {
+		f := t.flows[key]
+		f.SNI, f.JA3 = sni, ja3
+		t.dirty[key] = true
+	}
+}
+
+// SetPath records the MPLS labels and tunnels, as returned by
+// parser.FlowPath, a packet from srcIP:srcPort of the flow matching the
+// 5-tuple was carried in.
+func (t *Tracker) SetPath(srcIP, dstIP string, srcPort, dstPort uint16, protocol, scope, path string) {
+	key := MakeFlowKey(srcIP, dstIP, srcPort, dstPort, protocol, scope)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, ok := t.flows[key]
+	if !ok {
+		return
+	}
+	p := &f.RevPath
+	if srcIP == f.SrcIP && srcPort == f.SrcPort {
+		p = &f.FwdPath
+	}
+	if *p != path {
+		*p = path
+		t.dirty[key] = true
+	}
+}
+
+// SetInfo describes what the flow matching the 5-tuple carries.
+func (t *Tracker) SetInfo(srcIP, dstIP string, srcPort, dstPort uint16, protocol, scope, info string) {
+	key := MakeFlowKey(srcIP, dstIP, srcPort, dstPort, protocol, scope)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if f, ok := t.flows[key]; ok && f.Info != info {
+		f.Info = info
+		t.dirty[key] = true
+	}
+}
+
+// ICMPError counts an ICMP error, such as "DestinationUnreachable(Port)",
+// sent about a packet of the flow matching the 5-tuple, and returns the
+// flow's ID if it is tracked.
+func (t *Tracker) ICMPError(srcIP, dstIP string, srcPort, dstPort uint16, protocol, scope, icmpError string) (uint64, bool) {
+	key := MakeFlowKey(srcIP, dstIP, srcPort, dstPort, protocol, scope)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, ok := t.flows[key]
+	if !ok {
+		return 0, false
+	}
+	f.ICMPErrors++
+	f.LastICMPError = icmpError
+	t.dirty[key] = true
+	return f.ID, true
+}
+
+// Lookup returns the ID of the flow matching the given 5-tuple, if tracked.
+func (t *Tracker) Lookup(srcIP, dstIP string, srcPort, dstPort uint16, protocol, scope string) (uint64, bool) {
+	key := MakeFlowKey(srcIP, dstIP, srcPort, dstPort, protocol, scope)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if f, ok := t.flows[key]; ok {
+		return f.ID, true
+	}
+	return 0, false
+}
+
+// LookupTuple returns the ID of the flow matching the given 5-tuple in any
+// scope, for callers such as stream reassembly that do not see VLAN tags
+// or tunnels. When the tuple is tracked in several scopes, the flow seen
+// last is returned.
+func (t *Tracker) LookupTuple(srcIP, dstIP string, srcPort, dstPort uint16, protocol string) (uint64, bool) {
+	tuple := MakeFlowKey(srcIP, dstIP, srcPort, dstPort, protocol, "")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var found *Flow
+	for _, key := range t.byTuple[tuple] {
+		if f := t.flows[key]; found == nil || f.LastSeen > found.LastSeen {
+			found = f
+		}
+	}
+	if found == nil {
+		return 0, false
+	}
+	return found.ID, true
+}
+
 // Reset clears all flows.
 func (t *Tracker) Reset() {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	t.flows = make(map[FlowKey]*Flow)
+	t.byTuple = make(map[FlowKey][]FlowKey)
+	t.dirty = make(map[FlowKey]bool)
+	t.removed = nil
 	t.nextID = 0
+	t.clock = 0
+}
+
+// Changes returns a snapshot of the flows that changed and the IDs of those
+// evicted since the previous call.
+func (t *Tracker) Changes() (changed []*Flow, removed []uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	changed = make([]*Flow, 0, len(t.dirty))
+	for key := range t.dirty {
+		if f, ok := t.flows[key]; ok {
+			changed = append(changed, f.snapshot(t.clock))
+		}
+	}
+	removed = t.removed
+	t.dirty = make(map[FlowKey]bool)
+	t.removed = nil
+	return changed, removed
 }
 
 func (t *Tracker) evictIdle(nowMs int64) {
@@ -157,10 +482,30 @@ func (t *Tracker) evictIdle(nowMs int64) {
 	for key, f := range t.flows {
 		if f.LastSeen < cutoff {
 			delete(t.flows, key)
+			delete(t.dirty, key)
+			t.removed = append(t.removed, f.ID)
+			t.unindex(key)
 		}
 	}
 }
 
+// unscoped returns key without its scope.
+func unscoped(key FlowKey) FlowKey {
+	key.Scope = ""
+	return key
+}
+
+// unindex removes key from byTuple.
+func (t *Tracker) unindex(key FlowKey) {
+	tuple := unscoped(key)
+	keys := slices.DeleteFunc(t.byTuple[tuple], func(k FlowKey) bool { return k == key })
+	if len(keys) == 0 {
+		delete(t.byTuple, tuple)
+	} else {
+		t.byTuple[tuple] = keys
+	}
+}
+
 func advanceTCPState(current TCPState, flags TCPFlags) TCPState {
 	if flags.RST {
 		return TCPStateClosed
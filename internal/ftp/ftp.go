@@ -0,0 +1,263 @@
+// Package ftp follows FTP control connections and the data connections
+// they negotiate with PORT, EPRT, PASV and EPSV, so each file transfer is
+// known by name, size and the stream that carried it.
+package ftp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/parser"
+)
+
+const (
+	maxSessions  = 1024
+	maxTransfers = 4096
+)
+
+// ErrNotFound is returned for a transfer that does not exist.
+var ErrNotFound = errors.New("transfer not found")
+
+// Transfer modes
+const (
+	ModePassive = "passive" // PASV or EPSV: the client connects to the server
+	ModeActive  = "active"  // PORT or EPRT: the server connects to the client
+)
+
+// Transfer is a file or listing sent over an FTP data connection.
+type Transfer struct {
+	ID       int    `json:"id"`
+	Client   string `json:"client"` // control connection, ip:port
+	Server   string `json:"server"`
+	User     string `json:"user,omitempty"`
+	Command  string `json:"command"` // RETR, STOR, STOU, APPE, LIST, NLST or MLSD
+	File     string `json:"file,omitempty"`
+	Mode     string `json:"mode,omitempty"`
+	DataAddr string `json:"dataAddr,omitempty"` // the negotiated endpoint
+	// Size is what the server announced, in a 150 reply or a reply to
+	// SIZE; Bytes is what the data connection carried
+	Size     int64      `json:"size,omitempty"`
+	Bytes    int64      `json:"bytes"`
+	StreamID uint64     `json:"streamId,omitempty"`
+	Status   int        `json:"status,omitempty"` // final reply, such as 226
+	Start    time.Time  `json:"start"`
+	End      *time.Time `json:"end,omitempty"`
+}
+
+// Describe formats the transfer as "RETR report.pdf (52344 bytes)".
+func (tr Transfer) Describe() string {
+	s := tr.Command
+	if tr.File != "" {
+		s += " " + tr.File
+	}
+	switch {
+	case tr.Size > 0:
+		s += fmt.Sprintf(" (%d bytes)", tr.Size)
+	case tr.Bytes > 0:
+		s += fmt.Sprintf(" (%d bytes seen)", tr.Bytes)
+	}
+	return s
+}
+
+// session is the state of one control connection.
+type session struct {
+	user     string
+	dataAddr string // negotiated by the latest PORT, EPRT, PASV or EPSV
+	mode     string
+	last     string // the latest command
+	sizeOf   string // file of the latest SIZE command, and its size
+	size     int64
+	current  *Transfer // awaiting its final reply
+}
+
+// Tracker collects FTP transfers. It is safe for concurrent use.
+type Tracker struct {
+	mu        sync.Mutex
+	sessions  map[string]*session  // by client and server control endpoints
+	channels  map[string]*Transfer // by data endpoint: the latest transfer on it
+	transfers []*Transfer
+}
+
+// NewTracker creates an empty tracker.
+func NewTracker() *Tracker {
+	t := &Tracker{}
+	t.Reset()
+	return t
+}
+
+// Observe records an FTP control message or a packet of an FTP data
+// connection. For the latter it returns the transfer the connection
+// carries, once its command has been seen; streamID is the packet's
+// reassembled stream, if any.
+func (t *Tracker) Observe(pkt gopacket.Packet, streamID uint64) (Transfer, bool) {
+	if pkt.Layer(layers.LayerTypeTCP) == nil {
+		return Transfer{}, false
+	}
+	tuple := parser.ExtractFlowTuple(pkt)
+	if !tuple.Valid {
+		return Transfer{}, false
+	}
+	src := net.JoinHostPort(tuple.SrcIP, strconv.Itoa(int(tuple.SrcPort)))
+	dst := net.JoinHostPort(tuple.DstIP, strconv.Itoa(int(tuple.DstPort)))
+	ts := pkt.Metadata().Timestamp
+
+	if msgs := parser.ExtractFTP(pkt); msgs != nil {
+		t.observeControl(msgs, src, dst, tuple.SrcIP, ts)
+		return Transfer{}, false
+	}
+	if _, ok := parser.FTPDataTransfer(tuple.SrcIP, tuple.SrcPort, tuple.DstIP, tuple.DstPort); !ok {
+		return Transfer{}, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tr := t.channels[dst]
+	if tr == nil {
+		tr = t.channels[src]
+	}
+	if tr == nil {
+		return Transfer{}, false
+	}
+	if tl := pkt.TransportLayer(); tl != nil {
+		tr.Bytes += int64(len(tl.LayerPayload()))
+	}
+	if tr.StreamID == 0 {
+		tr.StreamID = streamID
+	}
+	return *tr, true
+}
+
+// observeControl follows the commands and replies of a control
+// connection. Commands are sent by the client, replies by the server at
+// srcIP.
+func (t *Tracker) observeControl(msgs []parser.FTPMessage, src, dst, srcIP string, ts time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, m := range msgs {
+		client, server := src, dst
+		if m.Response {
+			client, server = dst, src
+		}
+		key := client + " " + server
+		s := t.sessions[key]
+		if s == nil {
+			if len(t.sessions) >= maxSessions {
+				return
+			}
+			s = &session{}
+			t.sessions[key] = s
+		}
+
+		if ip, port, active, ok := m.DataEndpoint(); ok {
+			if ip == "" {
+				// EPSV: the port is on the server's address
+				ip = srcIP
+			}
+			s.dataAddr = net.JoinHostPort(ip, strconv.Itoa(port))
+			s.mode = ModePassive
+			if active {
+				s.mode = ModeActive
+			}
+			parser.ExpectFTPData(ip, port, "")
+		}
+
+		switch {
+		case !m.Response && m.Command == "USER":
+			s.user = m.Arg
+		case !m.Response && m.Command == "SIZE":
+			s.sizeOf, s.size = m.Arg, -1
+		case m.Response && m.Code == 213 && s.last == "SIZE":
+			if n, ok := m.TransferSize(); ok {
+				s.size = n
+			}
+		case m.IsTransfer():
+			t.startTransfer(s, m, client, server, ts)
+		case m.Response && s.current != nil:
+			if n, ok := m.TransferSize(); ok && m.Code < 200 {
+				s.current.Size = n
+			}
+			if m.Code >= 200 {
+				s.current.Status = m.Code
+				end := ts
+				s.current.End = &end
+				s.current = nil
+			}
+		}
+		if !m.Response {
+			s.last = m.Command
+		}
+	}
+}
+
+// startTransfer records a transfer command and ties it to the data
+// endpoint its session negotiated. The caller holds t.mu.
+func (t *Tracker) startTransfer(s *session, m parser.FTPMessage, client, server string, ts time.Time) {
+	if len(t.transfers) >= maxTransfers {
+		return
+	}
+	tr := &Transfer{
+		ID:       len(t.transfers) + 1,
+		Client:   client,
+		Server:   server,
+		User:     s.user,
+		Command:  m.Command,
+		File:     m.Arg,
+		Mode:     s.mode,
+		DataAddr: s.dataAddr,
+		Start:    ts,
+	}
+	if m.Command == "RETR" && s.sizeOf == m.Arg && s.size >= 0 {
+		tr.Size = s.size
+	}
+	t.transfers = append(t.transfers, tr)
+	s.current = tr
+	if s.dataAddr == "" {
+		return
+	}
+	t.channels[s.dataAddr] = tr
+	host, port, _ := net.SplitHostPort(s.dataAddr)
+	p, _ := strconv.Atoi(port)
+	parser.ExpectFTPData(host, p, tr.Command+" "+tr.File)
+	// A data endpoint serves one transfer; the next needs a new PORT or
+	// PASV
+	s.dataAddr = ""
+}
+
+// Transfers returns the transfers seen, oldest first.
+func (t *Tracker) Transfers() []Transfer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Transfer, len(t.transfers))
+	for i, tr := range t.transfers {
+		out[i] = *tr
+	}
+	return out
+}
+
+// Transfer returns the transfer with the given ID.
+func (t *Tracker) Transfer(id int) (Transfer, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if id < 1 || id > len(t.transfers) {
+		return Transfer{}, false
+	}
+	return *t.transfers[id-1], true
+}
+
+// Reset forgets all sessions and transfers, and the data endpoints they
+// registered with the parser.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sessions = make(map[string]*session)
+	t.channels = make(map[string]*Transfer)
+	t.transfers = nil
+	parser.ForgetFTPData()
+}
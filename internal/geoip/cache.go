@@ -0,0 +1,65 @@
+package geoip
+
+import (
+	"net"
+	"sync"
+)
+
+// Cache memoizes lookups per address so hot paths such as the capture
+// loop only walk the database once per host. The database can be swapped
+// at runtime; a Cache without one returns empty locations and does no
+// work.
+type Cache struct {
+	mu      sync.Mutex
+	db      *DB
+	entries map[string]Location
+	max     int
+}
+
+// NewCache creates a cache holding up to max addresses. When full it is
+// cleared rather than evicting entry by entry.
+func NewCache(max int) *Cache {
+	return &Cache{entries: make(map[string]Location), max: max}
+}
+
+// SetDB replaces the database and drops the cached results.
+func (c *Cache) SetDB(db *DB) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.db = db
+	c.entries = make(map[string]Location)
+}
+
+// Loaded reports whether a database is installed.
+func (c *Cache) Loaded() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.db != nil
+}
+
+// Lookup returns the location of ip, consulting the database on a miss.
+func (c *Cache) Lookup(ip net.IP) Location {
+	if !IsPublic(ip) {
+		return Location{}
+	}
+	key := string(ip.To16())
+
+	c.mu.Lock()
+	db := c.db
+	loc, ok := c.entries[key]
+	c.mu.Unlock()
+	if db == nil || ok {
+		return loc
+	}
+
+	loc = db.Lookup(ip)
+	c.mu.Lock()
+	if c.db == db {
+		if len(c.entries) >= c.max {
+			c.entries = make(map[string]Location)
+		}
+		c.entries[key] = loc
+	}
+	c.mu.Unlock()
+	return loc
+}
@@ -0,0 +1,84 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+)
+
+// Location is what the loaded databases know about an address.
+type Location struct {
+	Country     string `json:"country,omitempty"` // ISO 3166-1 alpha-2
+	CountryName string `json:"countryName,omitempty"`
+	City        string `json:"city,omitempty"`
+	ASN         uint   `json:"asn,omitempty"`
+	ASOrg       string `json:"asOrg,omitempty"`
+}
+
+// Empty reports whether no database had data for the address.
+func (l Location) Empty() bool {
+	return l.Country == "" && l.ASN == 0
+}
+
+// DB combines a GeoLite2 Country/City database and a GeoLite2 ASN
+// database. Either may be absent. A DB is read-only and safe for
+// concurrent use.
+type DB struct {
+	geo *mmdb
+	asn *mmdb
+}
+
+// Open loads the databases at the given paths; an empty path skips that
+// database.
+func Open(geoPath, asnPath string) (*DB, error) {
+	db := &DB{}
+	if geoPath != "" {
+		m, err := openMMDB(geoPath)
+		if err != nil {
+			return nil, fmt.Errorf("geoip database %s: %w", geoPath, err)
+		}
+		db.geo = m
+	}
+	if asnPath != "" {
+		m, err := openMMDB(asnPath)
+		if err != nil {
+			return nil, fmt.Errorf("ASN database %s: %w", asnPath, err)
+		}
+		db.asn = m
+	}
+	return db, nil
+}
+
+// Lookup returns the location of ip. Private and special-purpose
+// addresses, and a nil DB, yield an empty Location.
+func (db *DB) Lookup(ip net.IP) Location {
+	var loc Location
+	if db == nil || !IsPublic(ip) {
+		return loc
+	}
+	if db.geo != nil {
+		if rec, err := db.geo.lookup(ip); err == nil && rec != nil {
+			loc.Country = toString(path(rec, "country", "iso_code"))
+			loc.CountryName = toString(path(rec, "country", "names", "en"))
+			loc.City = toString(path(rec, "city", "names", "en"))
+			if loc.Country == "" {
+				// Anycast and satellite ranges only carry a registered country
+				loc.Country = toString(path(rec, "registered_country", "iso_code"))
+				loc.CountryName = toString(path(rec, "registered_country", "names", "en"))
+			}
+		}
+	}
+	if db.asn != nil {
+		if rec, err := db.asn.lookup(ip); err == nil && rec != nil {
+			loc.ASN = uint(toUint(path(rec, "autonomous_system_number")))
+			loc.ASOrg = toString(path(rec, "autonomous_system_organization"))
+		}
+	}
+	return loc
+}
+
+// IsPublic reports whether ip is a globally routable unicast address.
+func IsPublic(ip net.IP) bool {
+	return ip != nil && ip.IsGlobalUnicast() && !ip.IsPrivate() && !cgnat.Contains(ip)
+}
+
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
@@ -0,0 +1,281 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// Minimal reader for the MaxMind DB format used by GeoLite2 databases
+// (https://maxmind.github.io/MaxMind-DB/). It supports lookups and decodes
+// records into generic Go values; it does not verify or write databases.
+
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdb is an opened MaxMind DB file held in memory.
+type mmdb struct {
+	buf          []byte
+	data         []byte // data section
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	databaseType string
+	ipv4Start    uint
+}
+
+func openMMDB(path string) (*mmdb, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	idx := bytes.LastIndex(buf, metadataMarker)
+	if idx < 0 {
+		return nil, errors.New("not a MaxMind DB file")
+	}
+	meta, _, err := decodeValue(buf[idx+len(metadataMarker):], 0)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	m, ok := meta.(map[string]any)
+	if !ok {
+		return nil, errors.New("metadata is not a map")
+	}
+
+	db := &mmdb{
+		buf:          buf,
+		nodeCount:    uint(toUint(m["node_count"])),
+		recordSize:   uint(toUint(m["record_size"])),
+		ipVersion:    uint(toUint(m["ip_version"])),
+		databaseType: toString(m["database_type"]),
+	}
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", db.recordSize)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+16 > uint(idx) {
+		return nil, errors.New("search tree exceeds file size")
+	}
+	db.data = buf[treeSize+16 : idx]
+
+	// IPv4 addresses live under ::/96 in IPv6 trees
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node.
+func (db *mmdb) record(node uint, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		off := node*6 + bit*3
+		b := db.buf[off : off+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		off := node * 7
+		b := db.buf[off : off+7]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		off := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(db.buf[off : off+4]))
+	}
+}
+
+// lookup returns the decoded record for ip, or nil if the address is not
+// in the database.
+func (db *mmdb) lookup(ip net.IP) (any, error) {
+	node := uint(0)
+	bits := ip.To16()
+	if v4 := ip.To4(); v4 != nil {
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+		bits = v4
+	} else if db.ipVersion == 4 {
+		return nil, nil
+	}
+
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-uint(i%8))) & 1
+		node = db.record(node, bit)
+	}
+	if node == db.nodeCount {
+		return nil, nil
+	}
+	if node < db.nodeCount {
+		return nil, errors.New("invalid search tree")
+	}
+	off := node - db.nodeCount - 16
+	if off >= uint(len(db.data)) {
+		return nil, errors.New("record pointer out of range")
+	}
+	v, _, err := decodeValue(db.data, off)
+	return v, err
+}
+
+// decodeValue decodes the data-section value at off, returning it and the
+// offset just past it.
+func decodeValue(data []byte, off uint) (any, uint, error) {
+	if off >= uint(len(data)) {
+		return nil, 0, errors.New("unexpected end of data")
+	}
+	ctrl := data[off]
+	off++
+	typ := uint(ctrl >> 5)
+
+	if typ == 1 { // pointer
+		ss, vvv := uint(ctrl>>3)&3, uint(ctrl&7)
+		n := ss + 1
+		if off+n > uint(len(data)) {
+			return nil, 0, errors.New("truncated pointer")
+		}
+		var p uint
+		b := data[off : off+n]
+		switch ss {
+		case 0:
+			p = vvv<<8 | uint(b[0])
+		case 1:
+			p = (vvv<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			p = (vvv<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			p = uint(binary.BigEndian.Uint32(b))
+		}
+		v, _, err := decodeValue(data, p)
+		return v, off + n, err
+	}
+
+	if typ == 0 { // extended type
+		if off >= uint(len(data)) {
+			return nil, 0, errors.New("truncated extended type")
+		}
+		typ = 7 + uint(data[off])
+		off++
+	}
+
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		if off+n > uint(len(data)) {
+			return nil, 0, errors.New("truncated size")
+		}
+		var v uint
+		for _, c := range data[off : off+n] {
+			v = v<<8 | uint(c)
+		}
+		switch size {
+		case 29:
+			size = 29 + v
+		case 30:
+			size = 285 + v
+		default:
+			size = 65821 + v
+		}
+		off += n
+	}
+
+	switch typ {
+	case 7: // map
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := decodeValue(data, off)
+			if err != nil {
+				return nil, 0, err
+			}
+			v, next, err := decodeValue(data, next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[toString(k)] = v
+			off = next
+		}
+		return m, off, nil
+	case 11: // array
+		a := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := decodeValue(data, off)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			off = next
+		}
+		return a, off, nil
+	case 14: // boolean, value carried in size
+		return size != 0, off, nil
+	}
+
+	if off+size > uint(len(data)) {
+		return nil, 0, errors.New("truncated value")
+	}
+	b := data[off : off+size]
+	off += size
+	switch typ {
+	case 2: // UTF-8 string
+		return string(b), off, nil
+	case 3: // double
+		if size != 8 {
+			return nil, 0, errors.New("bad double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), off, nil
+	case 4: // bytes
+		return b, off, nil
+	case 5, 6, 9, 10: // uint16/32/64/128 (128 truncated to 64 bits)
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, off, nil
+	case 8: // int32
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), off, nil
+	case 15: // float
+		if size != 4 {
+			return nil, 0, errors.New("bad float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), off, nil
+	default:
+		return nil, off, nil
+	}
+}
+
+func toUint(v any) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case int64:
+		return uint64(n)
+	}
+	return 0
+}
+
+func toString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+// path walks nested maps, e.g. path(rec, "country", "iso_code").
+func path(v any, keys ...string) any {
+	for _, k := range keys {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
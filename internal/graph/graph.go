@@ -0,0 +1,231 @@
+package graph
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// bucketSize is the time resolution of windowed queries.
+	bucketSize = 10 * time.Second
+	// maxBuckets bounds per-edge history (one hour at bucketSize).
+	maxBuckets = 360
+	// maxEdges bounds the edge table; the least recently active edges are
+	// dropped when it fills.
+	maxEdges = 20000
+)
+
+// Node is a host in the communication graph.
+type Node struct {
+	ID        string `json:"id"` // IP address
+	Internal  bool   `json:"internal"`
+	Packets   int    `json:"packets"`
+	Bytes     int64  `json:"bytes"`
+	Peers     int    `json:"peers"`
+	FirstSeen int64  `json:"firstSeen"` // unix ms
+	LastSeen  int64  `json:"lastSeen"`  // unix ms
+}
+
+// Edge aggregates the traffic between two hosts in both directions.
+type Edge struct {
+	Source    string           `json:"source"`
+	Target    string           `json:"target"`
+	Packets   int              `json:"packets"`
+	Bytes     int64            `json:"bytes"`
+	FwdBytes  int64            `json:"fwdBytes"`  // source -> target
+	RevBytes  int64            `json:"revBytes"`  // target -> source
+	Protocols map[string]int64 `json:"protocols"` // protocol -> bytes
+	FirstSeen int64            `json:"firstSeen"`
+	LastSeen  int64            `json:"lastSeen"`
+}
+
+// Snapshot is the graph returned to clients.
+type Snapshot struct {
+	Nodes       []Node `json:"nodes"`
+	Edges       []Edge `json:"edges"`
+	WindowStart int64  `json:"windowStart,omitempty"` // unix ms, windowed queries only
+	WindowEnd   int64  `json:"windowEnd"`
+}
+
+type bucket struct {
+	start     int64 // unix ms, multiple of bucketSize
+	packets   int
+	fwdBytes  int64
+	revBytes  int64
+	protocols map[string]int64
+}
+
+type edgeKey struct{ a, b string }
+
+type edgeState struct {
+	firstSeen int64
+	lastSeen  int64
+	buckets   []bucket // oldest first
+}
+
+// Graph accumulates host-to-host traffic incrementally as packets arrive.
+type Graph struct {
+	mu     sync.Mutex
+	edges  map[edgeKey]*edgeState
+	latest int64 // newest packet time, unix ms
+}
+
+// New creates an empty graph.
+func New() *Graph {
+	return &Graph{edges: make(map[edgeKey]*edgeState)}
+}
+
+// Add records one packet between src and dst at ts.
+func (g *Graph) Add(src, dst, protocol string, length int, ts time.Time) {
+	if src == "" || dst == "" || src == dst {
+		return
+	}
+	key, fwd := edgeKey{src, dst}, true
+	if dst < src {
+		key, fwd = edgeKey{dst, src}, false
+	}
+	ms := ts.UnixMilli()
+	start := ms - ms%bucketSize.Milliseconds()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if ms > g.latest {
+		g.latest = ms
+	}
+	e, ok := g.edges[key]
+	if !ok {
+		if len(g.edges) >= maxEdges {
+			g.evictOldest()
+		}
+		e = &edgeState{firstSeen: ms}
+		g.edges[key] = e
+	}
+	if ms > e.lastSeen {
+		e.lastSeen = ms
+	}
+
+	n := len(e.buckets)
+	if n == 0 || e.buckets[n-1].start < start {
+		e.buckets = append(e.buckets, bucket{start: start, protocols: make(map[string]int64)})
+		if len(e.buckets) > maxBuckets {
+			e.buckets = e.buckets[1:]
+		}
+		n = len(e.buckets)
+	}
+	// Out-of-order packets land in the newest bucket
+	b := &e.buckets[n-1]
+	b.packets++
+	if fwd {
+		b.fwdBytes += int64(length)
+	} else {
+		b.revBytes += int64(length)
+	}
+	b.protocols[protocol] += int64(length)
+}
+
+func (g *Graph) evictOldest() {
+	var oldest edgeKey
+	oldestSeen := int64(-1)
+	for k, e := range g.edges {
+		if oldestSeen < 0 || e.lastSeen < oldestSeen {
+			oldest, oldestSeen = k, e.lastSeen
+		}
+	}
+	delete(g.edges, oldest)
+}
+
+// Snapshot builds the graph from all traffic, or only the traffic within
+// window of the newest packet when window > 0. limit > 0 keeps only the
+// heaviest edges (and their nodes).
+func (g *Graph) Snapshot(window time.Duration, limit int) Snapshot {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	snap := Snapshot{WindowEnd: g.latest, Edges: []Edge{}, Nodes: []Node{}}
+	var from int64
+	if window > 0 {
+		from = g.latest - window.Milliseconds()
+		from -= from % bucketSize.Milliseconds()
+		snap.WindowStart = from
+	}
+
+	for k, e := range g.edges {
+		if e.lastSeen < from {
+			continue
+		}
+		edge := Edge{Source: k.a, Target: k.b, Protocols: make(map[string]int64), FirstSeen: e.firstSeen, LastSeen: e.lastSeen}
+		for _, b := range e.buckets {
+			if b.start < from {
+				continue
+			}
+			edge.Packets += b.packets
+			edge.FwdBytes += b.fwdBytes
+			edge.RevBytes += b.revBytes
+			for p, n := range b.protocols {
+				edge.Protocols[p] += n
+			}
+		}
+		if edge.Packets == 0 {
+			continue
+		}
+		edge.Bytes = edge.FwdBytes + edge.RevBytes
+		snap.Edges = append(snap.Edges, edge)
+	}
+
+	sort.Slice(snap.Edges, func(i, j int) bool {
+		if snap.Edges[i].Bytes != snap.Edges[j].Bytes {
+			return snap.Edges[i].Bytes > snap.Edges[j].Bytes
+		}
+		if snap.Edges[i].Source != snap.Edges[j].Source {
+			return snap.Edges[i].Source < snap.Edges[j].Source
+		}
+		return snap.Edges[i].Target < snap.Edges[j].Target
+	})
+	if limit > 0 && len(snap.Edges) > limit {
+		snap.Edges = snap.Edges[:limit]
+	}
+
+	nodes := make(map[string]*Node)
+	touch := func(id string, e Edge) {
+		n, ok := nodes[id]
+		if !ok {
+			ip := net.ParseIP(id)
+			n = &Node{ID: id, Internal: ip != nil && (ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()), FirstSeen: e.FirstSeen}
+			nodes[id] = n
+		}
+		n.Packets += e.Packets
+		n.Bytes += e.Bytes
+		n.Peers++
+		if e.FirstSeen < n.FirstSeen {
+			n.FirstSeen = e.FirstSeen
+		}
+		if e.LastSeen > n.LastSeen {
+			n.LastSeen = e.LastSeen
+		}
+	}
+	for _, e := range snap.Edges {
+		touch(e.Source, e)
+		touch(e.Target, e)
+	}
+	for _, n := range nodes {
+		snap.Nodes = append(snap.Nodes, *n)
+	}
+	sort.Slice(snap.Nodes, func(i, j int) bool {
+		if snap.Nodes[i].Bytes != snap.Nodes[j].Bytes {
+			return snap.Nodes[i].Bytes > snap.Nodes[j].Bytes
+		}
+		return snap.Nodes[i].ID < snap.Nodes[j].ID
+	})
+	return snap
+}
+
+// Reset clears the graph.
+func (g *Graph) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.edges = make(map[edgeKey]*edgeState)
+	g.latest = 0
+}
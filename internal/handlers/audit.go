@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sniffox/internal/audit"
+	"sniffox/internal/clientauth"
+	"sniffox/internal/engine"
+)
+
+// maxAuditPage caps the number of entries /api/audit returns.
+const maxAuditPage = 1000
+
+// recordAudit adds an action by r's client to the audit trail.
+func recordAudit(eng *engine.Engine, r *http.Request, action, target, detail string) {
+	e := audit.Entry{Remote: r.RemoteAddr, Action: action, Target: target, Detail: detail}
+	if id, ok := clientauth.FromContext(r.Context()); ok {
+		e.User = id.Name
+	}
+	eng.AuditLog().Record(e)
+}
+
+// handleAudit lists the audit trail, newest first, filtered by ?user=,
+// ?action= and ?since= (RFC 3339) and capped by ?limit=.
+func handleAudit(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		v := r.URL.Query()
+		q := audit.Query{User: v.Get("user"), Action: v.Get("action"), Limit: 100}
+		if s := v.Get("since"); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				http.Error(w, "Invalid since", http.StatusBadRequest)
+				return
+			}
+			q.Since = t
+		}
+		if s := v.Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			q.Limit = min(n, maxAuditPage)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.AuditLog().Entries(q))
+	}
+}
@@ -2,15 +2,41 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"sniffox/internal/audit"
+	"sniffox/internal/coloring"
+	"sniffox/internal/customfields"
+	"sniffox/internal/detect"
 	"sniffox/internal/engine"
+	"sniffox/internal/filter"
+	"sniffox/internal/ftp"
+	"sniffox/internal/geoip"
+	"sniffox/internal/hostgroup"
+	"sniffox/internal/intel"
+	"sniffox/internal/matrix"
+	"sniffox/internal/models"
+	"sniffox/internal/netflow"
+	"sniffox/internal/parser"
+	"sniffox/internal/prefs"
+	"sniffox/internal/rules"
+	"sniffox/internal/sessionstore"
+	"sniffox/internal/storepolicy"
+	"sniffox/internal/stream"
+	"sniffox/internal/trafficstats"
 	"sniffox/web"
 )
 
@@ -32,11 +58,150 @@ func RegisterRoutes(mux *http.ServeMux, eng *engine.Engine) {
 	// PCAP export
 	mux.HandleFunc("/api/export", handleExport(eng))
 
+	// Alerts as STIX 2.1 bundles or MISP events
+	mux.HandleFunc("/api/alerts/export", handleAlertExport(eng))
+
+	// Paginated history of the retained packets
+	mux.HandleFunc("/api/packets", handlePackets(eng))
+	mux.HandleFunc("/api/packets/detail", handlePacketDetail(eng))
+
+	// Field-level diff of two packets' layer trees
+	mux.HandleFunc("/api/packets/diff", handlePacketDiff(eng))
+
+	// English templates of the Info column's message IDs, for translations
+	mux.HandleFunc("/api/info-templates", handleInfoTemplates())
+
+	// Sorted, filtered and paginated flow table
+	mux.HandleFunc("/api/flows", handleFlows(eng))
+	// RTT samples, retransmissions and throughput of one flow
+	mux.HandleFunc("/api/flows/{id}/metrics", handleFlowMetrics(eng))
+
+	// NetFlow v9 / IPFIX export status
+	mux.HandleFunc("/api/netflow", handleNetFlow(eng))
+
+	// Follow Stream "Save As": raw, hex dump or C arrays
+	mux.HandleFunc("/api/streams/{id}/export", handleStreamExport(eng))
+
+	// Export Objects → HTTP: files carried by a stream's responses
+	mux.HandleFunc("/api/streams/{id}/objects", handleStreamObjects(eng))
+	mux.HandleFunc("/api/streams/{id}/objects/{index}", handleStreamObject(eng))
+
+	// Investigation notes, stored with saved sessions
+	mux.HandleFunc("/api/notes", handleNotes(eng))
+	mux.HandleFunc("/api/notes/delete", handleNoteDelete(eng))
+
+	// Audit trail of captures, session changes, exports and stream views
+	mux.HandleFunc("/api/audit", handleAudit(eng))
+
 	// Session management
 	mux.HandleFunc("/api/sessions", handleSessions(eng))
 	mux.HandleFunc("/api/sessions/save", handleSessionSave(eng))
 	mux.HandleFunc("/api/sessions/load", handleSessionLoad(eng))
 	mux.HandleFunc("/api/sessions/delete", handleSessionDelete(eng))
+
+	// Saved capture profiles: interface, filters, limits and decode-as rules
+	mux.HandleFunc("/api/profiles", handleProfiles(eng))
+	mux.HandleFunc("/api/profiles/{name}", handleProfile(eng))
+	// Captures started by cron expressions and saved as sessions
+	mux.HandleFunc("/api/schedules", handleSchedules(eng))
+	mux.HandleFunc("/api/schedules/{name}", handleSchedule(eng))
+
+	// Per-user preferences, kept on disk
+	mux.HandleFunc("/api/prefs", handlePrefs(prefs.NewStore(prefsDir)))
+
+	// Read-only shareable snapshots
+	mux.HandleFunc("/api/snapshots/create", handleSnapshotCreate(eng))
+	mux.HandleFunc("/api/snapshots/view", handleSnapshotView(eng))
+
+	// TLS server inventory
+	mux.HandleFunc("/api/tls/inventory", handleTLSInventory(eng))
+
+	// SSLKEYLOGFILE secrets for decrypting TLS streams
+	mux.HandleFunc("/api/tls/keys", handleTLSKeys(eng))
+
+	// Host communication graph
+	mux.HandleFunc("/api/graph", handleGraph(eng))
+
+	// GeoIP egress policy and address lookups
+	mux.HandleFunc("/api/egress-policy", handleEgressPolicy(eng))
+	mux.HandleFunc("/api/geoip/", handleGeoIP(eng))
+
+	// Newly-observed domain and host alert settings
+	mux.HandleFunc("/api/newly-seen", handleNewlySeen(eng))
+
+	// Subnet ingress/egress traffic matrix
+	mux.HandleFunc("/api/stats/traffic-matrix", handleTrafficMatrix(eng))
+	mux.HandleFunc("/api/stats/traffic-matrix/subnets", handleMatrixSubnets(eng))
+
+	// Host groups used to tag packets, flows and alerts
+	mux.HandleFunc("/api/groups", handleHostGroups(eng))
+	mux.HandleFunc("/api/stats/groups", handleHostGroupStats(eng))
+
+	// Modbus/DNP3/S7comm device statistics
+	mux.HandleFunc("/api/stats/ics", handleICSStats(eng))
+
+	// Protocol hierarchy, endpoints and conversations
+	mux.HandleFunc("/api/stats/hierarchy", handleHierarchy(eng))
+	mux.HandleFunc("/api/stats/endpoints", handleEndpoints(eng))
+	mux.HandleFunc("/api/stats/conversations", handleConversations(eng))
+
+	// Packets and bytes per interval for I/O graphs
+	mux.HandleFunc("/api/stats/timeseries", handleTimeSeries(eng))
+
+	// Byte pattern search across the retained packets
+	mux.HandleFunc("/api/search", handleSearch(eng))
+
+	// Services announced over mDNS/DNS-SD
+	mux.HandleFunc("/api/services/discovered", handleDiscoveredServices(eng))
+
+	// Per-domain DNS statistics
+	mux.HandleFunc("/api/stats/dns", handleDNSStats(eng))
+
+	// Per-server NTP statistics
+	mux.HandleFunc("/api/stats/ntp", handleNTPStats(eng))
+
+	// SIP calls with their RTP streams' loss and jitter
+	mux.HandleFunc("/api/voip/calls", handleVoIPCalls(eng))
+
+	// FTP transfers and the files their data connections carried
+	mux.HandleFunc("/api/ftp/transfers", handleFTPTransfers(eng))
+	mux.HandleFunc("/api/ftp/transfers/{id}/file", handleFTPTransferFile(eng))
+
+	// Protocol anomaly counts for the current capture
+	mux.HandleFunc("/api/stats/anomalies", handleAnomalyStats(eng))
+
+	// Packets quarantined because dissecting or processing them failed
+	mux.HandleFunc("/api/malformed", handleMalformed(eng))
+
+	// ARP table and gateway MAC history
+	mux.HandleFunc("/api/arp", handleARPTable(eng))
+	mux.HandleFunc("/api/arp/timeline", handleARPTimeline(eng))
+
+	// Hostnames learned from DNS, DHCP, mDNS, LLMNR, NBNS and reverse DNS
+	mux.HandleFunc("/api/names", handleNames(eng))
+
+	// Packet coloring rules, and import from Wireshark colorfilters
+	mux.HandleFunc("/api/coloring-rules", handleColoringRules(eng))
+	mux.HandleFunc("/api/coloring-rules/import", handleColoringImport(eng))
+
+	// Suricata-style signature rules
+	mux.HandleFunc("/api/rules", handleRules(eng))
+
+	// How much of each packet and stream is kept, by display filter
+	mux.HandleFunc("/api/storage-policy", handleStorePolicy(eng))
+
+	// Regex field extraction rules and the values they extract
+	mux.HandleFunc("/api/custom-fields", handleCustomFields(eng))
+	mux.HandleFunc("/api/custom-fields/values", handleCustomFieldValues(eng))
+
+	// Decode-as overrides for protocols on nonstandard ports
+	mux.HandleFunc("/api/decode-as", handleDecodeAs(eng))
+
+	// Replay of the retained packets, or one flow, onto an interface
+	mux.HandleFunc("/api/replay", handleReplay(eng))
+
+	// Checks interfaces, capture permissions and the BPF filter before a capture
+	mux.HandleFunc("/api/capture/preflight", handleCapturePreflight(eng))
 }
 
 func handleUpload(eng *engine.Engine) http.HandlerFunc {
@@ -76,7 +241,6 @@ func handleUpload(eng *engine.Engine) http.HandlerFunc {
 		}
 		tmpFile.Close()
 
-		_ = header // filename available via header.Filename if needed
 		_ = filepath.Base(tmpPath)
 
 		// Stop any active capture before loading file
@@ -86,26 +250,139 @@ func handleUpload(eng *engine.Engine) http.HandlerFunc {
 			http.Error(w, "Failed to read pcap: "+err.Error(), http.StatusBadRequest)
 			return
 		}
+		recordAudit(eng, r, audit.PcapUpload, header.Filename, "")
 
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	}
 }
 
+// exportSelection reads the packets to export from the query: a display
+// filter, a BPF filter, a packet number range and a flow or stream ID.
+func exportSelection(q url.Values) (engine.PacketSelection, error) {
+	sel := engine.PacketSelection{Filter: q.Get("filter"), BPF: q.Get("bpf")}
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"from", &sel.From}, {"to", &sel.To}} {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return sel, fmt.Errorf("%s is not a packet number", p.name)
+			}
+			*p.dst = n
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *uint64
+	}{{"flow", &sel.FlowID}, {"stream", &sel.StreamID}} {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil || n == 0 {
+				return sel, fmt.Errorf("%s is not a %s ID", v, p.name)
+			}
+			*p.dst = n
+		}
+	}
+	return sel, sel.Validate()
+}
+
 func handleExport(eng *engine.Engine) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "GET only", http.StatusMethodNotAllowed)
 			return
 		}
-		w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"sniffox-%s.pcap\"", time.Now().Format("20060102-150405")))
-		if err := eng.ExportPcap(w); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		q := r.URL.Query()
+		var opts engine.ExportOptions
+		if s := q.Get("snaplen"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				http.Error(w, "Invalid snaplen", http.StatusBadRequest)
+				return
+			}
+			opts.SnapLen = n
+		}
+		opts.StripPayload = q.Get("strip") == "payload"
+		sel, err := exportSelection(q)
+		if err != nil {
+			http.Error(w, "Invalid selection: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.PacketSelection = sel
+
+		stamp := time.Now().Format("20060102-150405")
+		switch q.Get("format") {
+		case "", "pcap":
+			recordAudit(eng, r, audit.PcapExport, "pcap", r.URL.RawQuery)
+			w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"sniffox-%s.pcap\"", stamp))
+			if err := eng.ExportPcap(w, opts); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		case "pcapng":
+			recordAudit(eng, r, audit.PcapExport, "pcapng", r.URL.RawQuery)
+			w.Header().Set("Content-Type", "application/x-pcapng")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"sniffox-%s.pcapng\"", stamp))
+			if err := eng.ExportPcapNG(w, q.Get("comment"), opts); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		case engine.RecordsJSONL, engine.RecordsCSV:
+			format := q.Get("format")
+			var fields []string
+			for _, name := range strings.Split(q.Get("fields"), ",") {
+				if name = strings.TrimSpace(name); name == "" {
+					continue
+				}
+				if _, err := filter.CompileField(name); err != nil {
+					http.Error(w, "Invalid field: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				fields = append(fields, name)
+			}
+			recordAudit(eng, r, audit.PcapExport, format, r.URL.RawQuery)
+			if format == engine.RecordsCSV {
+				w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			} else {
+				w.Header().Set("Content-Type", "application/jsonl; charset=utf-8")
+			}
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"sniffox-%s.%s\"", stamp, format))
+			if err := eng.ExportRecords(w, format, fields, sel); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		default:
+			http.Error(w, "Unknown format", http.StatusBadRequest)
+		}
+	}
+}
+
+func handleAlertExport(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		now := time.Now()
+		stamp := now.Format("20060102-150405")
+		var doc any
+		switch r.URL.Query().Get("format") {
+		case "", "stix":
+			doc = intel.STIX(eng.GetAlerts(), "Sniffox", now)
+		case "misp":
+			doc = intel.MISP(eng.GetAlerts(), "Sniffox alerts "+now.Format("2006-01-02 15:04"), now)
+		default:
+			http.Error(w, "Unknown format", http.StatusBadRequest)
+			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"sniffox-alerts-%s.json\"", stamp))
+		json.NewEncoder(w).Encode(doc)
 	}
 }
 
+// sessionsDir is where recordings and autosaves are written, and where
+// sessions are saved unless another session store is configured.
 const sessionsDir = "sessions"
 
 type sessionMeta struct {
@@ -114,10 +391,45 @@ type sessionMeta struct {
 	Timestamp string `json:"timestamp"`
 	Packets   int    `json:"packets"`
 	Size      int64  `json:"size"`
+
+	Notes     []models.Note `json:"notes,omitempty"`
+	NoteCount int           `json:"noteCount"`
+
+	// Recording marks files written by a recording capture; Active is the
+	// one still being written.
+	Recording bool `json:"recording,omitempty"`
+	Active    bool `json:"active,omitempty"`
+
+	// Autosave marks checkpoints of a live capture. One that is neither
+	// complete nor active was cut short by a crash or restart.
+	Autosave    bool   `json:"autosave,omitempty"`
+	Checkpoint  string `json:"checkpoint,omitempty"`
+	Complete    bool   `json:"complete,omitempty"`
+	Interrupted bool   `json:"interrupted,omitempty"`
+}
+
+// sessionStores returns the configured session store followed by the
+// local sessions directory, which holds recordings still being written or
+// not yet uploaded, and autosaves. With no store configured, or one in the
+// sessions directory, only that is returned.
+func sessionStores(eng *engine.Engine) []sessionstore.Store {
+	local := sessionstore.NewDisk(sessionsDir)
+	st := eng.SessionStore()
+	if st == nil || sessionstore.SameDir(st, sessionsDir) {
+		return []sessionstore.Store{local}
+	}
+	return []sessionstore.Store{st, local}
 }
 
-func ensureSessionsDir() error {
-	return os.MkdirAll(sessionsDir, 0o755)
+func readSessionMeta(st sessionstore.Store, name string) (sessionMeta, error) {
+	var meta sessionMeta
+	rc, err := st.Open(name)
+	if err != nil {
+		return meta, err
+	}
+	defer rc.Close()
+	err = json.NewDecoder(io.LimitReader(rc, 16<<20)).Decode(&meta)
+	return meta, err
 }
 
 func handleSessions(eng *engine.Engine) http.HandlerFunc {
@@ -126,32 +438,40 @@ func handleSessions(eng *engine.Engine) http.HandlerFunc {
 			http.Error(w, "GET only", http.StatusMethodNotAllowed)
 			return
 		}
-		if err := ensureSessionsDir(); err != nil {
-			http.Error(w, "sessions dir error", http.StatusInternalServerError)
-			return
-		}
-		entries, err := os.ReadDir(sessionsDir)
-		if err != nil {
-			json.NewEncoder(w).Encode([]sessionMeta{})
-			return
-		}
-		var sessions []sessionMeta
-		for _, e := range entries {
-			if filepath.Ext(e.Name()) != ".json" {
-				continue
-			}
-			data, err := os.ReadFile(filepath.Join(sessionsDir, e.Name()))
+		active := eng.ActiveRecording()
+		autosave := eng.ActiveAutosave()
+		seen := make(map[string]bool)
+		sessions := []sessionMeta{}
+		for i, st := range sessionStores(eng) {
+			names, err := st.List()
 			if err != nil {
+				if i == 0 {
+					http.Error(w, "Session store: "+err.Error(), http.StatusBadGateway)
+					return
+				}
 				continue
 			}
-			var meta sessionMeta
-			if json.Unmarshal(data, &meta) == nil {
+			for _, name := range names {
+				if filepath.Ext(name) != ".json" {
+					continue
+				}
+				meta, err := readSessionMeta(st, name)
+				if err != nil || seen[meta.ID] {
+					continue
+				}
+				seen[meta.ID] = true
+				meta.NoteCount = len(meta.Notes)
+				meta.Notes = nil
+				if active != nil && meta.ID == active.ID {
+					meta.Packets, meta.Size, meta.Active = active.Packets, active.Size, true
+				}
+				if autosave != nil && meta.ID == autosave.ID {
+					meta.Packets, meta.Size, meta.Active = autosave.Packets, autosave.Size, true
+				}
+				meta.Interrupted = meta.Autosave && !meta.Complete && !meta.Active
 				sessions = append(sessions, meta)
 			}
 		}
-		if sessions == nil {
-			sessions = []sessionMeta{}
-		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(sessions)
 	}
@@ -163,10 +483,6 @@ func handleSessionSave(eng *engine.Engine) http.HandlerFunc {
 			http.Error(w, "POST only", http.StatusMethodNotAllowed)
 			return
 		}
-		if err := ensureSessionsDir(); err != nil {
-			http.Error(w, "sessions dir error", http.StatusInternalServerError)
-			return
-		}
 
 		var req struct {
 			Name string `json:"name"`
@@ -175,48 +491,68 @@ func handleSessionSave(eng *engine.Engine) http.HandlerFunc {
 			req.Name = "Capture"
 		}
 
-		count := eng.PacketCount()
-		if count == 0 {
+		saved, err := eng.SaveSession(sessionStores(eng)[0], req.Name)
+		if errors.Is(err, engine.ErrNoPackets) {
 			http.Error(w, "No packets to save", http.StatusBadRequest)
 			return
 		}
-
-		id := time.Now().Format("20060102-150405")
-		pcapPath := filepath.Join(sessionsDir, id+".pcap")
-		f, err := os.Create(pcapPath)
 		if err != nil {
-			http.Error(w, "Failed to create session file", http.StatusInternalServerError)
+			http.Error(w, "Failed to save session: "+err.Error(), http.StatusBadGateway)
 			return
 		}
-		if err := eng.ExportPcap(f); err != nil {
-			f.Close()
-			os.Remove(pcapPath)
-			http.Error(w, "Failed to write pcap: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		f.Close()
-
-		fi, _ := os.Stat(pcapPath)
-		var size int64
-		if fi != nil {
-			size = fi.Size()
-		}
+		recordAudit(eng, r, audit.SessionSave, saved.ID, req.Name)
 
 		meta := sessionMeta{
-			ID:        id,
-			Name:      req.Name,
-			Timestamp: time.Now().Format(time.RFC3339),
-			Packets:   count,
-			Size:      size,
+			ID:        saved.ID,
+			Name:      saved.Name,
+			Timestamp: saved.Timestamp,
+			Packets:   saved.Packets,
+			Size:      saved.Size,
+			Notes:     saved.Notes,
+			NoteCount: len(saved.Notes),
 		}
-		metaData, _ := json.Marshal(meta)
-		os.WriteFile(filepath.Join(sessionsDir, id+".json"), metaData, 0o644)
-
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(meta)
 	}
 }
 
+// fetchSession finds session id in the first store holding it and returns
+// the path of its pcap, downloaded to a temporary file unless the store is
+// on a file system, and a function that removes any download.
+func fetchSession(stores []sessionstore.Store, id string) (sessionstore.Store, string, func(), error) {
+	for _, st := range stores {
+		if l, ok := st.(sessionstore.Local); ok {
+			path := filepath.Join(l.Dir(), id+".pcap")
+			if _, err := os.Stat(path); err == nil {
+				return st, path, func() {}, nil
+			}
+			continue
+		}
+		rc, err := st.Open(id + ".pcap")
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, "", nil, err
+		}
+		defer rc.Close()
+		tmp, err := os.CreateTemp("", "sniffox-"+id+"-*.pcap")
+		if err != nil {
+			return nil, "", nil, err
+		}
+		_, err = io.Copy(tmp, rc)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return nil, "", nil, err
+		}
+		return st, tmp.Name(), func() { os.Remove(tmp.Name()) }, nil
+	}
+	return nil, "", nil, fs.ErrNotExist
+}
+
 func handleSessionLoad(eng *engine.Engine) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -232,17 +568,26 @@ func handleSessionLoad(eng *engine.Engine) http.HandlerFunc {
 		}
 		// Sanitize ID to prevent path traversal
 		base := filepath.Base(req.ID)
-		pcapPath := filepath.Join(sessionsDir, base+".pcap")
-		if _, err := os.Stat(pcapPath); os.IsNotExist(err) {
+		st, pcapPath, cleanup, err := fetchSession(sessionStores(eng), base)
+		if errors.Is(err, fs.ErrNotExist) {
 			http.Error(w, "Session not found", http.StatusNotFound)
 			return
 		}
+		if err != nil {
+			http.Error(w, "Failed to fetch session: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer cleanup()
 
 		eng.StopCapture()
 		if err := eng.LoadPcapFile(pcapPath); err != nil {
 			http.Error(w, "Failed to load session: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if meta, err := readSessionMeta(st, base+".json"); err == nil {
+			eng.SetNotes(meta.Notes)
+		}
+		recordAudit(eng, r, audit.SessionLoad, base, "")
 
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
@@ -263,8 +608,1136 @@ func handleSessionDelete(eng *engine.Engine) http.HandlerFunc {
 			return
 		}
 		base := filepath.Base(req.ID)
-		os.Remove(filepath.Join(sessionsDir, base+".pcap"))
-		os.Remove(filepath.Join(sessionsDir, base+".json"))
+		for _, st := range sessionStores(eng) {
+			if err := st.Remove(base + ".pcap"); err != nil {
+				http.Error(w, "Failed to delete session: "+err.Error(), http.StatusBadGateway)
+				return
+			}
+			st.Remove(base + ".json")
+		}
+		recordAudit(eng, r, audit.SessionDelete, base, "")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	}
+}
+
+func handleTLSInventory(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetTLSInventory())
+	}
+}
+
+func handleGeoIP(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		addr := strings.TrimPrefix(r.URL.Path, "/api/geoip/")
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			http.Error(w, "Invalid IP address", http.StatusBadRequest)
+			return
+		}
+		loc, ok := eng.GeoLookup(ip)
+		if !ok {
+			http.Error(w, "No GeoIP database loaded", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			IP     string `json:"ip"`
+			Public bool   `json:"public"`
+			geoip.Location
+		}{ip.String(), geoip.IsPublic(ip), loc})
+	}
+}
+
+func handleEgressPolicy(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var p detect.EgressPolicy
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			eng.SetEgressPolicy(p)
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetEgressPolicy())
+	}
+}
+
+func handleNewlySeen(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			cfg := eng.GetNewlySeenConfig()
+			if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			eng.SetNewlySeenConfig(cfg)
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		domains, ips, since := eng.NewlySeenCounts()
+		resp := struct {
+			detect.NewlySeenConfig
+			KnownDomains int    `json:"knownDomains"`
+			KnownIPs     int    `json:"knownIps"`
+			LearningFrom string `json:"learningFrom,omitempty"`
+		}{NewlySeenConfig: eng.GetNewlySeenConfig(), KnownDomains: domains, KnownIPs: ips}
+		if !since.IsZero() {
+			resp.LearningFrom = since.Format(time.RFC3339)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func handleGraph(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		var window time.Duration
+		if v := r.URL.Query().Get("window"); v != "" {
+			secs, err := strconv.Atoi(v)
+			if err != nil || secs < 0 {
+				http.Error(w, "Invalid window", http.StatusBadRequest)
+				return
+			}
+			window = time.Duration(secs) * time.Second
+		}
+		limit := 0
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetGraph(window, limit))
+	}
+}
+
+func handleTrafficMatrix(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetTrafficMatrix())
+	}
+}
+
+func handleMatrixSubnets(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var subnets []matrix.Subnet
+			if err := json.NewDecoder(r.Body).Decode(&subnets); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			if err := eng.SetSubnets(subnets); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetTrafficMatrix().Subnets)
+	}
+}
+
+func handleHostGroups(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var groups []hostgroup.Group
+			if err := json.NewDecoder(r.Body).Decode(&groups); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			if err := eng.SetHostGroups(groups); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetHostGroups())
+	}
+}
+
+func handleHostGroupStats(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetHostGroupStats())
+	}
+}
+
+func handleICSStats(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetICSStats())
+	}
+}
+
+func handleDNSStats(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		limit := 100
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		newWithin := 5 * time.Minute
+		if v := q.Get("newWithin"); v != "" {
+			secs, err := strconv.Atoi(v)
+			if err != nil || secs < 0 {
+				http.Error(w, "Invalid newWithin", http.StatusBadRequest)
+				return
+			}
+			newWithin = time.Duration(secs) * time.Second
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetDNSStats(q.Get("sort"), limit, newWithin))
+	}
+}
+
+func handleHierarchy(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetProtocolHierarchy())
+	}
+}
+
+// statsTableQuery parses the kind, sort and limit parameters of the
+// endpoint and conversation tables; kind defaults to ip.
+func statsTableQuery(w http.ResponseWriter, r *http.Request) (kind, sortBy string, limit int, ok bool) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "GET only", http.StatusMethodNotAllowed)
+		return "", "", 0, false
+	}
+	q := r.URL.Query()
+	limit = 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return "", "", 0, false
+		}
+		limit = n
+	}
+	kind = q.Get("type")
+	if kind == "" {
+		kind = trafficstats.IP
+	}
+	return kind, q.Get("sort"), limit, true
+}
+
+func handleEndpoints(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		kind, sortBy, limit, ok := statsTableQuery(w, r)
+		if !ok {
+			return
+		}
+		tbl, ok := eng.GetEndpoints(kind, sortBy, limit)
+		if !ok {
+			http.Error(w, "Unknown type (eth, ip, tcp, udp)", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tbl)
+	}
+}
+
+func handleConversations(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		kind, sortBy, limit, ok := statsTableQuery(w, r)
+		if !ok {
+			return
+		}
+		tbl, ok := eng.GetConversations(kind, sortBy, limit)
+		if !ok {
+			http.Error(w, "Unknown type (eth, ip, tcp, udp)", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tbl)
+	}
+}
+
+func handleTimeSeries(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		interval := time.Second
+		if v := q.Get("interval"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < time.Second || d%time.Second != 0 {
+				http.Error(w, "Invalid interval (whole seconds, e.g. 1s or 1m)", http.StatusBadRequest)
+				return
+			}
+			interval = d
+		}
+		var byProtocol bool
+		switch q.Get("split") {
+		case "":
+		case "protocol":
+			byProtocol = true
+		default:
+			http.Error(w, "Invalid split (protocol)", http.StatusBadRequest)
+			return
+		}
+		series, err := eng.GetIOGraph(interval, byProtocol, q.Get("filter"))
+		if err != nil {
+			http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(series)
+	}
+}
+
+func handleDiscoveredServices(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetDiscoveredServices(r.URL.Query().Get("type")))
+	}
+}
+
+func handleSearch(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		s := engine.PacketSearch{
+			Query:      q.Get("q"),
+			Mode:       q.Get("mode"),
+			IgnoreCase: q.Get("nocase") == "true" || q.Get("nocase") == "1",
+			Protocol:   q.Get("proto"),
+			Frame:      q.Get("in") == "frame",
+		}
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			s.Limit = n
+		}
+		res, err := eng.SearchPackets(s)
+		if err != nil {
+			http.Error(w, "Invalid search: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+func handleNTPStats(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetNTPStats())
+	}
+}
+
+func handleVoIPCalls(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetVoIPCalls())
+	}
+}
+
+// handleNetFlow reports what the flow exporter has sent, or that flows
+// are not exported.
+func handleNetFlow(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		x := eng.FlowExporter()
+		if x == nil {
+			json.NewEncoder(w).Encode(map[string]bool{"enabled": false})
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			Enabled bool `json:"enabled"`
+			netflow.Stats
+		}{true, x.Stats()})
+	}
+}
+
+func handleFTPTransfers(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetFTPTransfers())
+	}
+}
+
+// handleFTPTransferFile downloads the file an FTP transfer carried, named
+// as it was on the server.
+func handleFTPTransferFile(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid transfer ID", http.StatusBadRequest)
+			return
+		}
+		tr, data, err := eng.FTPTransferFile(id)
+		if errors.Is(err, ftp.ErrNotFound) {
+			http.Error(w, "Transfer not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Data connection not captured", http.StatusNotFound)
+			return
+		}
+
+		recordAudit(eng, r, audit.StreamExport, strconv.FormatUint(tr.StreamID, 10), "ftp "+tr.Command+" "+tr.File)
+
+		name := path.Base(strings.ReplaceAll(tr.File, "\\", "/"))
+		if name == "." || name == "/" || name == ".." {
+			name = fmt.Sprintf("ftp-%d-%s.bin", tr.ID, strings.ToLower(tr.Command))
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		w.Write(data)
+	}
+}
+
+func handleAnomalyStats(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetAnomalyCounts())
+	}
+}
+
+// handleMalformed lists the malformed packets of the current capture with
+// the reason each was quarantined and its raw bytes.
+func handleMalformed(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.MalformedPackets())
+	}
+}
+
+// handleInfoTemplates returns the English template of each Info message
+// ID. A translation maps the same IDs to templates with the same {names}.
+func handleInfoTemplates() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(parser.InfoTemplates())
+	}
+}
+
+func handleARPTable(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetARPTable())
+	}
+}
+
+func handleNames(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetNames())
+	}
+}
+
+func handleARPTimeline(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		ip := r.URL.Query().Get("ip")
+		if ip != "" {
+			parsed := net.ParseIP(ip).To4()
+			if parsed == nil {
+				http.Error(w, "Invalid IP address", http.StatusBadRequest)
+				return
+			}
+			ip = parsed.String()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetARPTimeline(ip))
+	}
+}
+
+func handleColoringRules(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var rules []coloring.Rule
+			if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			if err := eng.SetColoringRules(rules); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetColoringRules())
+	}
+}
+
+// handleStorePolicy returns the storage rules, or replaces them with the
+// JSON array posted, e.g. [{"filter":"smb2","store":"none"}].
+func handleStorePolicy(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var rules []storepolicy.Rule
+			if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			if err := eng.SetStorePolicy(rules); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetStorePolicy())
+	}
+}
+
+// handleCustomFields returns the field extraction rules, or replaces them
+// with the JSON array posted, e.g.
+// [{"name":"session","filter":"tcp.port == 9000","pattern":"SID=(\\w+)"}].
+func handleCustomFields(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var rules []customfields.Rule
+			if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			if err := eng.SetCustomFieldRules(rules); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetCustomFieldRules())
+	}
+}
+
+func handleCustomFieldValues(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		limit := 100
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetCustomFieldValues(limit))
+	}
+}
+
+// handleDecodeAs returns the decode-as table, or replaces it with the JSON
+// array of rules posted, e.g. [{"transport":"TCP","port":8883,"protocol":"MQTT"}].
+func handleDecodeAs(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var rules []parser.DecodeAsRule
+			if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			if err := eng.SetDecodeAs(rules); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetDecodeAs())
+	}
+}
+
+// maxColorFiltersSize caps an uploaded Wireshark colorfilters file.
+const maxColorFiltersSize = 1 << 20
+
+// handleColoringImport translates a Wireshark colorfilters file posted as
+// the request body. The imported rules replace the current ones, or with
+// ?append=true are added after them.
+func handleColoringImport(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		imp, err := coloring.ImportWireshark(http.MaxBytesReader(w, r.Body, maxColorFiltersSize))
+		if err != nil {
+			http.Error(w, "Invalid colorfilters file: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		rules := imp.Rules
+		if r.URL.Query().Get("append") == "true" {
+			rules = append(eng.GetColoringRules(), rules...)
+		}
+		if err := eng.SetColoringRules(rules); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(imp)
+	}
+}
+
+// maxRulesSize caps an uploaded rules file.
+const maxRulesSize = 32 << 20
+
+// handleRules lists the signature rules with their hit counts, or replaces
+// them with the rules file posted as the request body. A POST reports how
+// many rules loaded and why the others did not.
+func handleRules(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(eng.GetRules())
+		case http.MethodPost:
+			n, errs := eng.LoadRules(http.MaxBytesReader(w, r.Body, maxRulesSize))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(struct {
+				Loaded int               `json:"loaded"`
+				Errors []rules.LoadError `json:"errors"`
+			}{n, append([]rules.LoadError{}, errs...)})
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func handleReplay(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req struct {
+				Action string `json:"action"` // start, stop or pace
+				engine.ReplayRequest
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			var err error
+			switch req.Action {
+			case "start":
+				if err = eng.StartReplay(req.ReplayRequest); err == nil {
+					recordAudit(eng, r, audit.ReplayStart, req.Interface, "")
+				}
+			case "stop":
+				eng.StopReplay()
+			case "pace":
+				err = eng.SetReplayPace(req.ReplayPace)
+			default:
+				http.Error(w, "Unknown action", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, engine.ErrReplayDisabled) {
+				http.Error(w, "Packet replay is disabled; start sniffox with -allow-replay", http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.GetReplayStatus())
+	}
+}
+
+func handleCapturePreflight(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.StartCaptureRequest
+		switch r.Method {
+		case http.MethodGet:
+			q := r.URL.Query()
+			for _, name := range strings.Split(q.Get("interface"), ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					req.Interface = append(req.Interface, name)
+				}
+			}
+			req.BPFFilter = q.Get("bpfFilter")
+			if v := q.Get("snapLen"); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					http.Error(w, "Invalid snapLen", http.StatusBadRequest)
+					return
+				}
+				req.SnapLen = n
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eng.PreflightCapture(req))
+	}
+}
+
+// maxPacketPage caps the page size of /api/packets.
+const maxPacketPage = 1000
+
+func handlePackets(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		offset, limit := 0, 100
+		if v := q.Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid offset", http.StatusBadRequest)
+				return
+			}
+			offset = n
+		}
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxPacketPage)
+		}
+		page, err := eng.GetPacketPage(offset, limit, q.Get("filter"))
+		if err != nil {
+			http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	}
+}
+
+func handleStreamExport(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil || id == 0 {
+			http.Error(w, "Invalid stream ID", http.StatusBadRequest)
+			return
+		}
+		q := r.URL.Query()
+		opts := stream.ExportOptions{
+			Format:     q.Get("format"),
+			Direction:  q.Get("direction"),
+			Dechunk:    q.Get("dechunk") == "true" || q.Get("dechunk") == "1",
+			Decompress: q.Get("decompress") == "true" || q.Get("decompress") == "1",
+		}
+		if opts.Format == "" {
+			opts.Format = stream.FormatRaw
+		}
+		if opts.Direction == "" {
+			opts.Direction = stream.DirBoth
+		}
+		data, err := eng.ExportStream(id, opts)
+		if errors.Is(err, stream.ErrStreamNotFound) {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		recordAudit(eng, r, audit.StreamExport, strconv.FormatUint(id, 10), opts.Format)
+
+		name := fmt.Sprintf("stream-%d-%s", id, opts.Direction)
+		switch opts.Format {
+		case stream.FormatRaw:
+			w.Header().Set("Content-Type", "application/octet-stream")
+			name += ".bin"
+		case stream.FormatHex:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			name += ".txt"
+		case stream.FormatCArray:
+			w.Header().Set("Content-Type", "text/x-c; charset=utf-8")
+			name += ".c"
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
+		w.Write(data)
+	}
+}
+
+// handleStreamObjects lists the HTTP objects of a stream.
+func handleStreamObjects(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil || id == 0 {
+			http.Error(w, "Invalid stream ID", http.StatusBadRequest)
+			return
+		}
+		objs, err := eng.StreamObjects(id)
+		if err != nil {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+			return
+		}
+		if objs == nil {
+			objs = []stream.HTTPObject{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(objs)
+	}
+}
+
+// handleStreamObject downloads one HTTP object of a stream.
+func handleStreamObject(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil || id == 0 {
+			http.Error(w, "Invalid stream ID", http.StatusBadRequest)
+			return
+		}
+		index, err := strconv.Atoi(r.PathValue("index"))
+		if err != nil || index < 0 {
+			http.Error(w, "Invalid object index", http.StatusBadRequest)
+			return
+		}
+		obj, err := eng.StreamObject(id, index)
+		if errors.Is(err, stream.ErrStreamNotFound) {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Object not found", http.StatusNotFound)
+			return
+		}
+
+		recordAudit(eng, r, audit.StreamExport, strconv.FormatUint(id, 10), "object "+obj.Filename)
+
+		// Served as a download only, never rendered in the UI's origin
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": obj.Filename}))
+		w.Write(obj.Data)
+	}
+}
+
+// maxFlowPage caps the page size of /api/flows.
+const maxFlowPage = 1000
+
+func handleFlows(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		fq := engine.FlowQuery{
+			Sort:     q.Get("sort"),
+			Protocol: q.Get("protocol"),
+			IP:       q.Get("ip"),
+			Limit:    100,
+		}
+		switch q.Get("order") {
+		case "", "desc":
+		case "asc":
+			fq.Asc = true
+		default:
+			http.Error(w, "Invalid order", http.StatusBadRequest)
+			return
+		}
+		if v := q.Get("port"); v != "" {
+			n, err := strconv.ParseUint(v, 10, 16)
+			if err != nil {
+				http.Error(w, "Invalid port", http.StatusBadRequest)
+				return
+			}
+			fq.Port = uint16(n)
+		}
+		if v := q.Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid offset", http.StatusBadRequest)
+				return
+			}
+			fq.Offset = n
+		}
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			fq.Limit = min(n, maxFlowPage)
+		}
+		page, err := eng.QueryFlows(fq)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	}
+}
+
+func handleFlowMetrics(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid flow ID", http.StatusBadRequest)
+			return
+		}
+		m, ok := eng.FlowMetrics(id)
+		if !ok {
+			http.Error(w, "Flow not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m)
+	}
+}
+
+func handlePacketDetail(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		number, err := strconv.Atoi(r.URL.Query().Get("number"))
+		if err != nil || number <= 0 {
+			http.Error(w, "Invalid number", http.StatusBadRequest)
+			return
+		}
+		info, ok := eng.GetPacket(number)
+		if !ok {
+			http.Error(w, "Packet not retained", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	}
+}
+
+func handlePacketDiff(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		a, errA := strconv.Atoi(q.Get("a"))
+		b, errB := strconv.Atoi(q.Get("b"))
+		if errA != nil || errB != nil || a <= 0 || b <= 0 {
+			http.Error(w, "Invalid packet numbers", http.StatusBadRequest)
+			return
+		}
+		var ignore []string
+		for _, name := range strings.Split(q.Get("ignore"), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				ignore = append(ignore, name)
+			}
+		}
+		diff, ok := eng.DiffPackets(a, b, ignore)
+		if !ok {
+			http.Error(w, "Packet not retained", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(diff)
+	}
+}
+
+func handleNotes(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(eng.GetNotes())
+		case http.MethodPost:
+			var req struct {
+				Text      string `json:"text"`
+				PktNumber int    `json:"pktNumber"`
+				FlowID    uint64 `json:"flowId"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			note, err := eng.AddNote(req.Text, req.PktNumber, req.FlowID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(note)
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func handleNoteDelete(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			ID int `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+			http.Error(w, "Missing note ID", http.StatusBadRequest)
+			return
+		}
+		if !eng.DeleteNote(req.ID) {
+			http.Error(w, "Note not found", http.StatusNotFound)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"sniffox/internal/clientauth"
+	"sniffox/internal/prefs"
+)
+
+const prefsDir = "prefs"
+
+// maxPrefsSize caps the body of a preferences update.
+const maxPrefsSize = 1 << 20
+
+// handlePrefs serves the preferences of the user named by ?user=, or of the
+// default user. A user authenticated by client certificate always gets
+// their own. GET returns them all, or one with ?key=; POST merges a JSON
+// object into them, where a null value removes a key.
+func handlePrefs(store *prefs.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.URL.Query().Get("user")
+		if id, ok := clientauth.FromContext(r.Context()); ok {
+			user = id.Name
+		}
+		var all map[string]json.RawMessage
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			all, err = store.Get(user)
+		case http.MethodPost:
+			var changes map[string]json.RawMessage
+			r.Body = http.MaxBytesReader(w, r.Body, maxPrefsSize)
+			if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			all, err = store.Update(user, changes)
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if key := r.URL.Query().Get("key"); key != "" && r.Method == http.MethodGet {
+			v, ok := all[key]
+			if !ok {
+				http.Error(w, "No such preference", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(v)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(all)
+	}
+}
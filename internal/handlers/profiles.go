@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"sniffox/internal/engine"
+	"sniffox/internal/profiles"
+)
+
+// maxProfileSize caps the body of a profile update.
+const maxProfileSize = 64 << 10
+
+// handleProfiles lists the capture profiles on GET and adds or replaces
+// one on POST.
+func handleProfiles(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(eng.Profiles().List())
+		case http.MethodPost:
+			putProfile(eng, w, r, "")
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// handleProfile reads (GET), replaces (PUT) or deletes (DELETE) the
+// profile named in the path.
+func handleProfile(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		switch r.Method {
+		case http.MethodGet:
+			p, err := eng.Profiles().Get(name)
+			if err != nil {
+				http.Error(w, "Profile not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(p)
+		case http.MethodPut:
+			putProfile(eng, w, r, name)
+		case http.MethodDelete:
+			err := eng.Profiles().Delete(name)
+			if errors.Is(err, profiles.ErrNotFound) {
+				http.Error(w, "Profile not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to save profiles: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "GET, PUT or DELETE only", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// putProfile stores the profile in the request body, under name if given.
+func putProfile(eng *engine.Engine, w http.ResponseWriter, r *http.Request, name string) {
+	var p profiles.Profile
+	r.Body = http.MaxBytesReader(w, r.Body, maxProfileSize)
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if name != "" {
+		p.Name = name
+	}
+	if err := p.Check(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p, err := eng.Profiles().Put(p)
+	if err != nil {
+		http.Error(w, "Failed to save profiles: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"sniffox/internal/engine"
+	"sniffox/internal/schedule"
+)
+
+// maxScheduleSize caps the body of a schedule update.
+const maxScheduleSize = 64 << 10
+
+// StartScheduler runs the scheduled captures in the background, keeping
+// their recordings, autosaves and sessions with the saved sessions.
+func StartScheduler(eng *engine.Engine) {
+	go eng.RunSchedules(sessionsDir, nil)
+}
+
+// handleSchedules lists the scheduled captures with their next and last
+// runs on GET and adds or replaces one on POST.
+func handleSchedules(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(eng.Schedules().List(time.Now()))
+		case http.MethodPost:
+			putSchedule(eng, w, r, "")
+		default:
+			http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// handleSchedule reads (GET), replaces (PUT) or deletes (DELETE) the
+// schedule named in the path.
+func handleSchedule(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		switch r.Method {
+		case http.MethodGet:
+			st, err := eng.Schedules().Get(name, time.Now())
+			if err != nil {
+				http.Error(w, "Schedule not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(st)
+		case http.MethodPut:
+			putSchedule(eng, w, r, name)
+		case http.MethodDelete:
+			err := eng.Schedules().Delete(name)
+			if errors.Is(err, schedule.ErrNotFound) {
+				http.Error(w, "Schedule not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to save schedules: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "GET, PUT or DELETE only", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// putSchedule stores the schedule in the request body, under name if
+// given.
+func putSchedule(eng *engine.Engine, w http.ResponseWriter, r *http.Request, name string) {
+	var sc schedule.Schedule
+	r.Body = http.MaxBytesReader(w, r.Body, maxScheduleSize)
+	if err := json.NewDecoder(r.Body).Decode(&sc); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if name != "" {
+		sc.Name = name
+	}
+	if _, err := sc.Check(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sc, err := eng.Schedules().Put(sc)
+	if err != nil {
+		http.Error(w, "Failed to save schedules: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	st, _ := eng.Schedules().Get(sc.Name, time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"sniffox/internal/engine"
+	"sniffox/internal/models"
+)
+
+const snapshotsDir = "snapshots"
+
+// snapshotTokenLen is the hex length of a share token (128 bits).
+const snapshotTokenLen = 32
+
+func newSnapshotToken() (string, error) {
+	b := make([]byte, snapshotTokenLen/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validSnapshotToken rejects anything that is not a plain hex token, which
+// also rules out path traversal when the token is used as a file name.
+func validSnapshotToken(token string) bool {
+	if len(token) != snapshotTokenLen {
+		return false
+	}
+	_, err := hex.DecodeString(token)
+	return err == nil
+}
+
+func handleSnapshotCreate(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Name   string         `json:"name"`
+			Alerts []models.Alert `json:"alerts"`
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid snapshot request", http.StatusBadRequest)
+			return
+		}
+		if req.Name == "" {
+			req.Name = "Snapshot"
+		}
+
+		snap, err := eng.BuildSnapshot(req.Name, req.Alerts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		token, err := newSnapshotToken()
+		if err != nil {
+			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		snap.Token = token
+
+		if err := os.MkdirAll(snapshotsDir, 0o755); err != nil {
+			http.Error(w, "snapshots dir error", http.StatusInternalServerError)
+			return
+		}
+		data, err := json.Marshal(snap)
+		if err != nil {
+			http.Error(w, "Failed to encode snapshot", http.StatusInternalServerError)
+			return
+		}
+		if err := os.WriteFile(filepath.Join(snapshotsDir, token+".json"), data, 0o644); err != nil {
+			http.Error(w, "Failed to write snapshot", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"token": token,
+			"url":   "/snapshot.html?token=" + token,
+		})
+	}
+}
+
+func handleSnapshotView(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.URL.Query().Get("token")
+		if !validSnapshotToken(token) {
+			http.Error(w, "Invalid token", http.StatusBadRequest)
+			return
+		}
+		data, err := os.ReadFile(filepath.Join(snapshotsDir, token+".json"))
+		if err != nil {
+			http.Error(w, "Snapshot not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
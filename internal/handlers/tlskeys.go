@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"sniffox/internal/audit"
+	"sniffox/internal/engine"
+)
+
+// maxKeyLogSize caps a key log upload.
+const maxKeyLogSize = 16 << 20
+
+// handleTLSKeys reports how many TLS sessions have secrets (GET), adds the
+// SSLKEYLOGFILE lines in the request body (POST) or forgets every secret
+// (DELETE).
+func handleTLSKeys(eng *engine.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys := eng.TLSKeys()
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			r.Body = http.MaxBytesReader(w, r.Body, maxKeyLogSize)
+			n, err := keys.Load(r.Body)
+			if err != nil {
+				http.Error(w, "Failed to read key log: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			recordAudit(eng, r, audit.TLSKeysLoad, "", fmt.Sprintf("%d secrets", n))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]int{"added": n, "sessions": keys.Len()})
+			return
+		case http.MethodDelete:
+			keys.Reset()
+			recordAudit(eng, r, audit.TLSKeysClear, "", "")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			http.Error(w, "GET, POST or DELETE only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"sessions": keys.Len()})
+	}
+}
@@ -4,12 +4,18 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 
+	"sniffox/internal/audit"
+	"sniffox/internal/clientauth"
 	"sniffox/internal/engine"
 	"sniffox/internal/models"
+	"sniffox/internal/profiles"
 )
 
 const (
@@ -18,7 +24,22 @@ const (
 )
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
+	CheckOrigin: checkOrigin,
+}
+
+// checkOrigin accepts any origin, except from clients authenticated by
+// certificate: browsers present the certificate to cross-site WebSocket
+// requests as well, so those must come from our own pages.
+func checkOrigin(r *http.Request) bool {
+	if _, ok := clientauth.FromContext(r.Context()); !ok {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // not a browser
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
 }
 
 // WSClient wraps a WebSocket connection and implements engine.Client.
@@ -27,6 +48,14 @@ type WSClient struct {
 	eng    *engine.Engine
 	sendCh chan models.WSMessage
 	done   chan struct{}
+
+	// readOnly clients, viewers authenticated by client certificate,
+	// cannot start or stop captures
+	readOnly bool
+
+	// Who the client is, for the audit trail
+	user   string
+	remote string
 }
 
 // NewWSClient creates a WSClient and registers it with the engine.
@@ -119,6 +148,10 @@ func (c *WSClient) ReadLoop() {
 }
 
 func (c *WSClient) handleCommand(msg models.WSMessage) {
+	if c.readOnly && (msg.Type == "start_capture" || msg.Type == "start_profile" || msg.Type == "stop_capture") {
+		c.sendError("read-only user: " + msg.Type + " not allowed")
+		return
+	}
 	switch msg.Type {
 	case "get_interfaces":
 		ifaces, err := c.eng.GetInterfaces()
@@ -135,36 +168,46 @@ func (c *WSClient) handleCommand(msg models.WSMessage) {
 			c.sendError("invalid start_capture payload")
 			return
 		}
-		if err := c.eng.StartCapture(req); err != nil {
-			c.sendError("capture failed: " + err.Error())
+		c.startCapture(req, req.BPFFilter)
+
+	case "start_profile":
+		var req models.StartProfileRequest
+		if err := json.Unmarshal(msg.Payload, &req); err != nil {
+			c.sendError("invalid start_profile payload")
+			return
+		}
+		p, err := c.eng.Profiles().Get(req.Name)
+		if err != nil {
+			c.sendError(err.Error() + ": " + req.Name)
+			return
+		}
+		if len(p.DecodeAs) > 0 {
+			if err := c.eng.SetDecodeAs(profiles.MergeDecodeAs(c.eng.GetDecodeAs(), p.DecodeAs)); err != nil {
+				c.sendError("profile decode-as rules: " + err.Error())
+				return
+			}
+		}
+		if !c.startCapture(p.Capture, "profile "+p.Name) {
+			return
+		}
+		payload, _ := json.Marshal(p)
+		c.SendMessage(models.WSMessage{Type: "profile_started", Payload: payload})
+
+	case "preflight_capture":
+		var req models.StartCaptureRequest
+		if err := json.Unmarshal(msg.Payload, &req); err != nil {
+			c.sendError("invalid preflight_capture payload")
 			return
 		}
+		payload, _ := json.Marshal(c.eng.PreflightCapture(req))
+		c.SendMessage(models.WSMessage{Type: "capture_preflight", Payload: payload})
 
 	case "stop_capture":
 		c.eng.StopCapture()
+		c.audit(audit.CaptureStop, "", "")
 
 	case "get_flows":
-		flows := c.eng.GetFlows()
-		infos := make([]models.FlowInfo, 0, len(flows))
-		for _, f := range flows {
-			infos = append(infos, models.FlowInfo{
-				ID:          f.ID,
-				SrcIP:       f.SrcIP,
-				DstIP:       f.DstIP,
-				SrcPort:     f.SrcPort,
-				DstPort:     f.DstPort,
-				Protocol:    f.Protocol,
-				PacketCount: f.PacketCount,
-				ByteCount:   f.ByteCount,
-				FirstSeen:   f.FirstSeen,
-				LastSeen:    f.LastSeen,
-				TCPState:    string(f.TCPState),
-				FwdPackets:  f.FwdPackets,
-				FwdBytes:    f.FwdBytes,
-				RevPackets:  f.RevPackets,
-				RevBytes:    f.RevBytes,
-			})
-		}
+		infos := c.eng.GetFlowInfos()
 		payload, _ := json.Marshal(infos)
 		c.SendMessage(models.WSMessage{Type: "flows", Payload: payload})
 
@@ -179,9 +222,41 @@ func (c *WSClient) handleCommand(msg models.WSMessage) {
 			c.sendError("stream not found")
 			return
 		}
+		c.audit(audit.StreamView, strconv.FormatUint(req.StreamID, 10), "")
 		payload, _ := json.Marshal(data)
 		c.SendMessage(models.WSMessage{Type: "stream_data", Payload: payload})
 
+	case "set_display_filter":
+		var req models.DisplayFilterRequest
+		if err := json.Unmarshal(msg.Payload, &req); err != nil {
+			c.sendError("invalid set_display_filter payload")
+			return
+		}
+		if err := c.eng.SetDisplayFilter(c, req.Filter); err != nil {
+			c.sendError("invalid display filter: " + err.Error())
+			return
+		}
+		payload, _ := json.Marshal(models.DisplayFilterStatus{Filter: req.Filter, Active: req.Filter != ""})
+		c.SendMessage(models.WSMessage{Type: "display_filter", Payload: payload})
+
+	case "subscribe", "unsubscribe":
+		var req models.SubscriptionRequest
+		if err := json.Unmarshal(msg.Payload, &req); err != nil {
+			c.sendError("invalid " + msg.Type + " payload")
+			return
+		}
+		update := c.eng.Subscribe
+		if msg.Type == "unsubscribe" {
+			update = c.eng.Unsubscribe
+		}
+		topics, err := update(c, req.Topics)
+		if err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		payload, _ := json.Marshal(models.SubscriptionStatus{Topics: topics})
+		c.SendMessage(models.WSMessage{Type: "subscriptions", Payload: payload})
+
 	case "get_protocol_stats":
 		stats := c.eng.GetProtocolStats()
 		payload, _ := json.Marshal(stats)
@@ -192,6 +267,24 @@ func (c *WSClient) handleCommand(msg models.WSMessage) {
 	}
 }
 
+// startCapture starts a live capture and reports whether it did.
+func (c *WSClient) startCapture(req models.StartCaptureRequest, detail string) bool {
+	// Recordings and autosaves are kept with the saved sessions
+	req.RecordDir = sessionsDir
+	req.AutosaveDir = sessionsDir
+	if err := c.eng.StartCapture(req); err != nil {
+		c.sendError("capture failed: " + err.Error())
+		return false
+	}
+	c.audit(audit.CaptureStart, strings.Join(req.Interface, ","), detail)
+	return true
+}
+
+// audit adds an action by the client to the audit trail.
+func (c *WSClient) audit(action, target, detail string) {
+	c.eng.AuditLog().Record(audit.Entry{User: c.user, Remote: c.remote, Action: action, Target: target, Detail: detail})
+}
+
 func (c *WSClient) sendError(message string) {
 	payload, _ := json.Marshal(models.ErrorPayload{Message: message})
 	c.SendMessage(models.WSMessage{Type: "error", Payload: payload})
@@ -206,6 +299,11 @@ func HandleWebSocket(eng *engine.Engine) http.HandlerFunc {
 			return
 		}
 		client := NewWSClient(conn, eng)
+		client.remote = r.RemoteAddr
+		if id, ok := clientauth.FromContext(r.Context()); ok {
+			client.readOnly = id.ReadOnly()
+			client.user = id.Name
+		}
 		client.ReadLoop()
 	}
 }
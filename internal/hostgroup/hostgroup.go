@@ -0,0 +1,214 @@
+// Package hostgroup tags traffic with user-defined host groups such as
+// "DB servers" (a CIDR list) or "Cameras" (a MAC OUI list).
+package hostgroup
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Group is a named set of hosts. A host belongs to the group if its IP is
+// in one of the CIDRs or its MAC starts with one of the MAC prefixes
+// (an OUI like "00:11:22" or a full address).
+type Group struct {
+	Name  string   `json:"name"`
+	CIDRs []string `json:"cidrs,omitempty"`
+	MACs  []string `json:"macs,omitempty"`
+}
+
+// Stat is the traffic seen to or from a group's members.
+type Stat struct {
+	Name    string `json:"name"`
+	Packets int    `json:"packets"`
+	Bytes   int64  `json:"bytes"`
+}
+
+type compiled struct {
+	name string
+	nets []*net.IPNet
+	macs []string // lower-case, colon-separated prefixes
+}
+
+// Set holds the configured groups and per-group traffic counters.
+type Set struct {
+	mu     sync.Mutex
+	defs   []Group
+	groups []compiled
+	stats  map[string]*Stat
+}
+
+// New creates an empty group set.
+func New() *Set {
+	return &Set{stats: make(map[string]*Stat)}
+}
+
+// SetGroups replaces the group definitions and clears the counters.
+func (s *Set) SetGroups(defs []Group) error {
+	groups := make([]compiled, 0, len(defs))
+	named := make([]Group, 0, len(defs))
+	seen := make(map[string]bool)
+	for _, d := range defs {
+		d.Name = strings.TrimSpace(d.Name)
+		if d.Name == "" {
+			return fmt.Errorf("group name is required")
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("duplicate group %q", d.Name)
+		}
+		seen[d.Name] = true
+		g := compiled{name: d.Name}
+		for _, c := range d.CIDRs {
+			if !strings.Contains(c, "/") {
+				if ip := net.ParseIP(c); ip != nil && ip.To4() != nil {
+					c += "/32"
+				} else {
+					c += "/128"
+				}
+			}
+			_, n, err := net.ParseCIDR(c)
+			if err != nil {
+				return fmt.Errorf("group %q: invalid CIDR %q", d.Name, c)
+			}
+			g.nets = append(g.nets, n)
+		}
+		for _, m := range d.MACs {
+			prefix, err := normalizeMACPrefix(m)
+			if err != nil {
+				return fmt.Errorf("group %q: %v", d.Name, err)
+			}
+			g.macs = append(g.macs, prefix)
+		}
+		groups = append(groups, g)
+		named = append(named, d)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defs = named
+	s.groups = groups
+	s.stats = make(map[string]*Stat)
+	return nil
+}
+
+// normalizeMACPrefix turns "00-11-22", "001122" or "00:11:22" into
+// "00:11:22".
+func normalizeMACPrefix(m string) (string, error) {
+	hex := strings.NewReplacer(":", "", "-", "", ".", "").Replace(strings.ToLower(strings.TrimSpace(m)))
+	if len(hex) < 6 || len(hex) > 12 || len(hex)%2 != 0 {
+		return "", fmt.Errorf("invalid MAC prefix %q", m)
+	}
+	var parts []string
+	for i := 0; i < len(hex); i += 2 {
+		for _, c := range hex[i : i+2] {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+				return "", fmt.Errorf("invalid MAC prefix %q", m)
+			}
+		}
+		parts = append(parts, hex[i:i+2])
+	}
+	return strings.Join(parts, ":"), nil
+}
+
+// Groups returns the current group definitions.
+func (s *Set) Groups() []Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Group{}, s.defs...)
+}
+
+// Tags returns the sorted names of the groups any of the packet's
+// Ethernet or IP endpoints belong to.
+func (s *Set) Tags(pkt gopacket.Packet) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.groups) == 0 {
+		return nil
+	}
+
+	var ips []net.IP
+	var macs []string
+	if l := pkt.Layer(layers.LayerTypeEthernet); l != nil {
+		eth := l.(*layers.Ethernet)
+		macs = append(macs, eth.SrcMAC.String(), eth.DstMAC.String())
+	}
+	if l := pkt.Layer(layers.LayerTypeIPv4); l != nil {
+		ip := l.(*layers.IPv4)
+		ips = append(ips, ip.SrcIP, ip.DstIP)
+	} else if l := pkt.Layer(layers.LayerTypeIPv6); l != nil {
+		ip := l.(*layers.IPv6)
+		ips = append(ips, ip.SrcIP, ip.DstIP)
+	}
+
+	var tags []string
+	for _, g := range s.groups {
+		if g.matches(ips, macs) {
+			tags = append(tags, g.name)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func (g *compiled) matches(ips []net.IP, macs []string) bool {
+	for _, ip := range ips {
+		for _, n := range g.nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	for _, mac := range macs {
+		for _, prefix := range g.macs {
+			if strings.HasPrefix(mac, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Count adds a packet of the given length to each tagged group.
+func (s *Set) Count(tags []string, length int) {
+	if len(tags) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tags {
+		st, ok := s.stats[t]
+		if !ok {
+			st = &Stat{Name: t}
+			s.stats[t] = st
+		}
+		st.Packets++
+		st.Bytes += int64(length)
+	}
+}
+
+// Stats returns per-group traffic in definition order.
+func (s *Set) Stats() []Stat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Stat, 0, len(s.groups))
+	for _, g := range s.groups {
+		if st, ok := s.stats[g.name]; ok {
+			out = append(out, *st)
+		} else {
+			out = append(out, Stat{Name: g.name})
+		}
+	}
+	return out
+}
+
+// Reset clears the counters but keeps the group definitions.
+func (s *Set) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = make(map[string]*Stat)
+}
@@ -0,0 +1,256 @@
+// Package icsstats aggregates industrial control protocol traffic (Modbus,
+// DNP3, S7comm) per field device: function codes, the addresses read and
+// written, and which clients change process state.
+package icsstats
+
+import (
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/parser"
+)
+
+const (
+	maxDevices      = 1024
+	maxTargets      = 256 // per device and direction
+	maxRecentWrites = 100
+)
+
+// DeviceStats summarises the operations addressed to one PLC/RTU unit.
+type DeviceStats struct {
+	Protocol         string         `json:"protocol"`
+	Server           string         `json:"server"`
+	Unit             string         `json:"unit,omitempty"`
+	Requests         int            `json:"requests"`
+	Responses        int            `json:"responses"`
+	Exceptions       int            `json:"exceptions"`
+	Writes           int            `json:"writes"`
+	UnexpectedWrites int            `json:"unexpectedWrites"` // from clients outside the writer list
+	Functions        map[string]int `json:"functions"`
+	ReadTargets      map[string]int `json:"readTargets,omitempty"`
+	WriteTargets     map[string]int `json:"writeTargets,omitempty"`
+	Clients          []string       `json:"clients"`
+	FirstSeen        time.Time      `json:"firstSeen"`
+	LastSeen         time.Time      `json:"lastSeen"`
+}
+
+// WriteEvent is one state-changing request.
+type WriteEvent struct {
+	Time       time.Time `json:"time"`
+	Protocol   string    `json:"protocol"`
+	Client     string    `json:"client"`
+	Server     string    `json:"server"`
+	Unit       string    `json:"unit,omitempty"`
+	Function   string    `json:"function"`
+	Targets    []string  `json:"targets,omitempty"`
+	Critical   bool      `json:"critical"`
+	Unexpected bool      `json:"unexpected"`
+}
+
+// Stats is the ICS dashboard payload.
+type Stats struct {
+	Protocols    map[string]int `json:"protocols"` // operations per protocol
+	Devices      []DeviceStats  `json:"devices"`
+	RecentWrites []WriteEvent   `json:"recentWrites"` // newest first
+	Writers      []string       `json:"writers"`      // configured allowed writers
+}
+
+type deviceKey struct {
+	protocol, server, unit string
+}
+
+// Tracker collects per-device ICS statistics.
+type Tracker struct {
+	mu        sync.Mutex
+	writers   []string
+	protocols map[string]int
+	devices   map[deviceKey]*DeviceStats
+	writes    []WriteEvent
+}
+
+// NewTracker creates an ICS statistics tracker with no allowed writers.
+func NewTracker() *Tracker {
+	return &Tracker{
+		protocols: make(map[string]int),
+		devices:   make(map[deviceKey]*DeviceStats),
+	}
+}
+
+// SetWriters sets the IPs or CIDRs of the engineering workstations and
+// HMIs expected to write to field devices. Writes from anywhere else are
+// reported as unexpected; with an empty list every write is.
+func (t *Tracker) SetWriters(writers []string) {
+	var clean []string
+	for _, w := range writers {
+		if w = strings.TrimSpace(w); w != "" {
+			clean = append(clean, w)
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.writers = clean
+}
+
+// Writers returns the configured allowed writers.
+func (t *Tracker) Writers() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string{}, t.writers...)
+}
+
+// Authorized reports whether client is in the allowed writer list.
+func (t *Tracker) Authorized(client string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ip := net.ParseIP(client)
+	for _, w := range t.writers {
+		if w == client {
+			return true
+		}
+		if _, n, err := net.ParseCIDR(w); err == nil && ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Observe records the ICS operation carried by the packet, if any.
+func (t *Tracker) Observe(pkt gopacket.Packet) {
+	op := parser.ExtractICS(pkt)
+	if op == nil {
+		return
+	}
+	ts := pkt.Metadata().Timestamp
+	unexpected := op.Write && !op.Response && !t.Authorized(op.Client)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.protocols[op.Protocol]++
+	d := t.device(op, ts)
+	if d == nil {
+		return
+	}
+	d.LastSeen = ts
+	if op.Exception {
+		d.Exceptions++
+	}
+	if op.Response {
+		d.Responses++
+		return
+	}
+
+	d.Requests++
+	d.Functions[op.Function]++
+	if !slices.Contains(d.Clients, op.Client) && len(d.Clients) < maxTargets {
+		d.Clients = append(d.Clients, op.Client)
+	}
+	targets := d.ReadTargets
+	if op.Write {
+		targets = d.WriteTargets
+		d.Writes++
+		if unexpected {
+			d.UnexpectedWrites++
+		}
+		t.writes = append(t.writes, WriteEvent{
+			Time:       ts,
+			Protocol:   op.Protocol,
+			Client:     op.Client,
+			Server:     op.Server,
+			Unit:       op.Unit,
+			Function:   op.Function,
+			Targets:    op.Targets,
+			Critical:   op.Critical,
+			Unexpected: unexpected,
+		})
+		if len(t.writes) > maxRecentWrites {
+			t.writes = t.writes[len(t.writes)-maxRecentWrites:]
+		}
+	}
+	for _, target := range op.Targets {
+		if _, ok := targets[target]; ok || len(targets) < maxTargets {
+			targets[target]++
+		}
+	}
+}
+
+func (t *Tracker) device(op *parser.ICSOperation, ts time.Time) *DeviceStats {
+	key := deviceKey{op.Protocol, op.Server, op.Unit}
+	d, ok := t.devices[key]
+	if !ok {
+		if len(t.devices) >= maxDevices {
+			return nil
+		}
+		d = &DeviceStats{
+			Protocol:     op.Protocol,
+			Server:       op.Server,
+			Unit:         op.Unit,
+			Functions:    make(map[string]int),
+			ReadTargets:  make(map[string]int),
+			WriteTargets: make(map[string]int),
+			Clients:      []string{},
+			FirstSeen:    ts,
+		}
+		t.devices[key] = d
+	}
+	return d
+}
+
+// Stats returns a snapshot of the ICS statistics, devices with the most
+// writes first.
+func (t *Tracker) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := Stats{
+		Protocols:    copyCounts(t.protocols),
+		Devices:      make([]DeviceStats, 0, len(t.devices)),
+		RecentWrites: make([]WriteEvent, 0, len(t.writes)),
+		Writers:      append([]string{}, t.writers...),
+	}
+	for _, d := range t.devices {
+		cp := *d
+		cp.Functions = copyCounts(d.Functions)
+		cp.ReadTargets = copyCounts(d.ReadTargets)
+		cp.WriteTargets = copyCounts(d.WriteTargets)
+		cp.Clients = append([]string{}, d.Clients...)
+		s.Devices = append(s.Devices, cp)
+	}
+	sort.Slice(s.Devices, func(i, j int) bool {
+		a, b := s.Devices[i], s.Devices[j]
+		if a.Writes != b.Writes {
+			return a.Writes > b.Writes
+		}
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Server+"/"+a.Unit < b.Server+"/"+b.Unit
+	})
+	for i := len(t.writes) - 1; i >= 0; i-- {
+		s.RecentWrites = append(s.RecentWrites, t.writes[i])
+	}
+	return s
+}
+
+// Reset clears the statistics but keeps the writer list.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.protocols = make(map[string]int)
+	t.devices = make(map[deviceKey]*DeviceStats)
+	t.writes = nil
+}
+
+func copyCounts(m map[string]int) map[string]int {
+	cp := make(map[string]int, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
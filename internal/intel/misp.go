@@ -0,0 +1,120 @@
+package intel
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"sniffox/internal/models"
+)
+
+// MISPEvent is the MISP event JSON accepted by /events/add and the MISP
+// import tools.
+type MISPEvent struct {
+	Event mispEvent `json:"Event"`
+}
+
+type mispEvent struct {
+	UUID          string          `json:"uuid"`
+	Info          string          `json:"info"`
+	Date          string          `json:"date"`
+	Timestamp     string          `json:"timestamp"`
+	ThreatLevelID string          `json:"threat_level_id"` // 1 high, 2 medium, 3 low, 4 undefined
+	Analysis      string          `json:"analysis"`        // 0 initial
+	Distribution  string          `json:"distribution"`    // 0 your organisation only
+	Attribute     []mispAttribute `json:"Attribute"`
+	Tag           []mispTag       `json:"Tag"`
+}
+
+type mispAttribute struct {
+	UUID      string `json:"uuid"`
+	Type      string `json:"type"`
+	Category  string `json:"category"`
+	Value     string `json:"value"`
+	ToIDS     bool   `json:"to_ids"`
+	Comment   string `json:"comment,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+type mispTag struct {
+	Name string `json:"name"`
+}
+
+// MISP builds one event holding an attribute per alert observable,
+// commented with the alert title. Indicators repeated across alerts are
+// listed once.
+func MISP(alerts []models.Alert, info string, now time.Time) MISPEvent {
+	ev := mispEvent{
+		UUID:          uuid5("misp:" + info + ":" + now.UTC().Format(time.RFC3339)),
+		Info:          info,
+		Date:          now.UTC().Format("2006-01-02"),
+		Timestamp:     strconv.FormatInt(now.Unix(), 10),
+		ThreatLevelID: "4",
+		Analysis:      "0",
+		Distribution:  "0",
+		Attribute:     []mispAttribute{},
+		Tag:           []mispTag{{Name: "tlp:amber"}},
+	}
+
+	level := 4
+	seen := make(map[string]int) // type|value -> attribute index
+	for _, a := range alerts {
+		switch a.Severity {
+		case "critical", "high":
+			level = min(level, 1)
+		case "medium":
+			level = min(level, 2)
+		case "low":
+			level = min(level, 3)
+		}
+		for _, ind := range observables(a) {
+			typ, category := mispType(ind, a)
+			if typ == "" {
+				continue
+			}
+			key := typ + "|" + ind.Value
+			if i, ok := seen[key]; ok {
+				if !strings.Contains(ev.Attribute[i].Comment, a.Title) {
+					ev.Attribute[i].Comment += "; " + a.Title
+				}
+				continue
+			}
+			seen[key] = len(ev.Attribute)
+			ev.Attribute = append(ev.Attribute, mispAttribute{
+				UUID:      uuid5("misp-attr:" + ev.UUID + ":" + key),
+				Type:      typ,
+				Category:  category,
+				Value:     ind.Value,
+				ToIDS:     a.Severity == "critical" || a.Severity == "high",
+				Comment:   a.Title,
+				Timestamp: strconv.FormatInt(alertTime(a, now).Unix(), 10),
+			})
+		}
+	}
+	ev.ThreatLevelID = strconv.Itoa(level)
+	return MISPEvent{Event: ev}
+}
+
+// mispType maps an indicator type to a MISP attribute type and category.
+// The alert's source address is ip-src; other addresses are the remote
+// side of the finding (ip-dst).
+func mispType(ind models.Indicator, a models.Alert) (string, string) {
+	switch ind.Type {
+	case models.IndicatorIPv4, models.IndicatorIPv6:
+		if ind.Value == a.SrcIP {
+			return "ip-src", "Network activity"
+		}
+		return "ip-dst", "Network activity"
+	case models.IndicatorDomain:
+		return "domain", "Network activity"
+	case models.IndicatorJA3:
+		return "ja3-fingerprint-md5", "Network activity"
+	case models.IndicatorMD5:
+		return "md5", "Payload delivery"
+	case models.IndicatorSHA1:
+		return "sha1", "Payload delivery"
+	case models.IndicatorSHA256:
+		return "sha256", "Payload delivery"
+	}
+	return "", ""
+}
@@ -0,0 +1,179 @@
+// Package intel converts alerts and the indicators attached to them into
+// threat-intel exchange formats: STIX 2.1 bundles and MISP events.
+package intel
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+	"time"
+
+	"sniffox/internal/models"
+)
+
+// stixTime is the STIX 2.1 timestamp format (UTC, millisecond precision).
+const stixTime = "2006-01-02T15:04:05.000Z"
+
+// Bundle is a STIX 2.1 bundle.
+type Bundle struct {
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Objects []any  `json:"objects"`
+}
+
+type stixIdentity struct {
+	Type          string `json:"type"`
+	SpecVersion   string `json:"spec_version"`
+	ID            string `json:"id"`
+	Created       string `json:"created"`
+	Modified      string `json:"modified"`
+	Name          string `json:"name"`
+	IdentityClass string `json:"identity_class"`
+}
+
+type stixIndicator struct {
+	Type           string   `json:"type"`
+	SpecVersion    string   `json:"spec_version"`
+	ID             string   `json:"id"`
+	CreatedByRef   string   `json:"created_by_ref"`
+	Created        string   `json:"created"`
+	Modified       string   `json:"modified"`
+	Name           string   `json:"name"`
+	Description    string   `json:"description,omitempty"`
+	IndicatorTypes []string `json:"indicator_types"`
+	Pattern        string   `json:"pattern"`
+	PatternType    string   `json:"pattern_type"`
+	ValidFrom      string   `json:"valid_from"`
+	Labels         []string `json:"labels,omitempty"`
+	Confidence     int      `json:"confidence,omitempty"`
+}
+
+// STIX builds a bundle with one indicator per alert whose pattern ORs the
+// alert's observables. Object IDs are derived from the content, so
+// exporting the same alerts twice yields the same IDs.
+func STIX(alerts []models.Alert, producer string, now time.Time) Bundle {
+	created := now.UTC().Format(stixTime)
+	identity := stixIdentity{
+		Type:          "identity",
+		SpecVersion:   "2.1",
+		ID:            "identity--" + uuid5("identity:"+producer),
+		Created:       created,
+		Modified:      created,
+		Name:          producer,
+		IdentityClass: "system",
+	}
+	b := Bundle{Type: "bundle", Objects: []any{identity}}
+
+	var ids []string
+	for _, a := range alerts {
+		var terms []string
+		for _, ind := range observables(a) {
+			if t := stixPattern(ind); t != "" {
+				terms = append(terms, t)
+			}
+		}
+		if len(terms) == 0 {
+			continue
+		}
+		pattern := strings.Join(terms, " OR ")
+		when := alertTime(a, now).UTC().Format(stixTime)
+		id := "indicator--" + uuid5(fmt.Sprintf("%s|%s|%s|%s", a.Type, a.Title, pattern, when))
+		ids = append(ids, id)
+
+		b.Objects = append(b.Objects, stixIndicator{
+			Type:           "indicator",
+			SpecVersion:    "2.1",
+			ID:             id,
+			CreatedByRef:   identity.ID,
+			Created:        when,
+			Modified:       when,
+			Name:           a.Title,
+			Description:    a.Detail,
+			IndicatorTypes: []string{indicatorType(a.Severity)},
+			Pattern:        pattern,
+			PatternType:    "stix",
+			ValidFrom:      when,
+			Labels:         append([]string{a.Type}, a.Tags...),
+			Confidence:     confidence(a.Severity),
+		})
+	}
+	b.ID = "bundle--" + uuid5(identity.ID+"|"+strings.Join(ids, ","))
+	return b
+}
+
+// stixPattern returns the comparison expression matching ind.
+func stixPattern(ind models.Indicator) string {
+	v := strings.ReplaceAll(strings.ReplaceAll(ind.Value, `\`, `\\`), "'", `\'`)
+	switch ind.Type {
+	case models.IndicatorIPv4:
+		return "[ipv4-addr:value = '" + v + "']"
+	case models.IndicatorIPv6:
+		return "[ipv6-addr:value = '" + v + "']"
+	case models.IndicatorDomain:
+		return "[domain-name:value = '" + v + "']"
+	case models.IndicatorMD5:
+		return "[file:hashes.MD5 = '" + v + "']"
+	case models.IndicatorSHA1:
+		return "[file:hashes.'SHA-1' = '" + v + "']"
+	case models.IndicatorSHA256:
+		return "[file:hashes.'SHA-256' = '" + v + "']"
+	case models.IndicatorJA3:
+		// STIX has no JA3 object; custom properties take an x_ prefix
+		return "[network-traffic:x_ja3_hash = '" + v + "']"
+	}
+	return ""
+}
+
+func indicatorType(severity string) string {
+	switch severity {
+	case "critical", "high":
+		return "malicious-activity"
+	}
+	return "anomalous-activity"
+}
+
+func confidence(severity string) int {
+	switch severity {
+	case "critical":
+		return 90
+	case "high":
+		return 75
+	case "medium":
+		return 50
+	}
+	return 25
+}
+
+// observables returns the alert's indicators plus, when none of them is an
+// address, its source address.
+func observables(a models.Alert) []models.Indicator {
+	out := a.Indicators
+	for _, ind := range out {
+		if ind.Type == models.IndicatorIPv4 || ind.Type == models.IndicatorIPv6 {
+			return out
+		}
+	}
+	if a.SrcIP == "" {
+		return out
+	}
+	typ := models.IndicatorIPv4
+	if strings.Contains(a.SrcIP, ":") {
+		typ = models.IndicatorIPv6
+	}
+	return append(out[:len(out):len(out)], models.Indicator{Type: typ, Value: a.SrcIP})
+}
+
+func alertTime(a models.Alert, now time.Time) time.Time {
+	if a.Time.IsZero() {
+		return now
+	}
+	return a.Time
+}
+
+// uuid5 returns a name-based (version 5) UUID for name.
+func uuid5(name string) string {
+	h := sha1.Sum([]byte("sniffox:" + name))
+	h[6] = h[6]&0x0f | 0x50
+	h[8] = h[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
@@ -0,0 +1,178 @@
+// Package iograph counts packets and bytes per second of capture time, for
+// drawing I/O (throughput) graphs without replaying the packets.
+package iograph
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSeconds caps the per-second history; the oldest seconds are
+	// dropped first.
+	maxSeconds = 24 * 60 * 60
+	// MaxPoints caps the points of one series; longer spans keep the
+	// latest.
+	MaxPoints = 10000
+)
+
+// Count is the packets and bytes of a bucket or one protocol in it.
+type Count struct {
+	Packets int   `json:"packets"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// Point is one bucket of a series.
+type Point struct {
+	Time      int64            `json:"t"` // unix ms of the bucket's start
+	Packets   int              `json:"packets"`
+	Bytes     int64            `json:"bytes"`
+	Protocols map[string]Count `json:"protocols,omitempty"` // when split by protocol
+}
+
+// Series is the counters over a span of capture time in buckets of
+// IntervalMs. Buckets without traffic are included, so Points are evenly
+// spaced.
+type Series struct {
+	IntervalMs int64   `json:"intervalMs"`
+	Truncated  bool    `json:"truncated,omitempty"` // earlier buckets were left out
+	Points     []Point `json:"points"`
+}
+
+type second struct {
+	sec       int64 // unix seconds
+	count     Count
+	protocols map[string]Count
+}
+
+// Counter accumulates per-second counters. It is safe for concurrent use.
+type Counter struct {
+	mu      sync.Mutex
+	seconds []second // by sec
+	dirty   int64    // earliest second changed since the last Updates; 0 if none
+}
+
+// NewCounter creates an empty counter.
+func NewCounter() *Counter {
+	return &Counter{}
+}
+
+// Reset clears the counters.
+func (c *Counter) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seconds, c.dirty = nil, 0
+}
+
+// Add counts packets packets of length bytes of protocol captured at ts.
+func (c *Counter) Add(ts time.Time, protocol string, packets, length int) {
+	sec := ts.Unix()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.at(sec)
+	if s == nil {
+		return
+	}
+	s.count.Packets += packets
+	s.count.Bytes += int64(length)
+	p := s.protocols[protocol]
+	p.Packets += packets
+	p.Bytes += int64(length)
+	s.protocols[protocol] = p
+	if c.dirty == 0 || sec < c.dirty {
+		c.dirty = sec
+	}
+}
+
+// at returns the counters of sec, adding them if needed, or nil if sec is
+// older than the history kept. The caller holds c.mu.
+func (c *Counter) at(sec int64) *second {
+	n := len(c.seconds)
+	// Packets nearly always arrive in order
+	i := n
+	if n > 0 && c.seconds[n-1].sec >= sec {
+		i = sort.Search(n, func(i int) bool { return c.seconds[i].sec >= sec })
+		if i < n && c.seconds[i].sec == sec {
+			return &c.seconds[i]
+		}
+		if i == 0 && n >= maxSeconds {
+			return nil
+		}
+	}
+	c.seconds = append(c.seconds, second{})
+	copy(c.seconds[i+1:], c.seconds[i:])
+	c.seconds[i] = second{sec: sec, protocols: make(map[string]Count)}
+	if len(c.seconds) > maxSeconds {
+		c.seconds = c.seconds[1:]
+		i--
+	}
+	return &c.seconds[i]
+}
+
+// Series returns the counters in buckets of interval, a whole number of
+// seconds, split by protocol if byProtocol.
+func (c *Counter) Series(interval time.Duration, byProtocol bool) Series {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return bucket(c.seconds, interval, byProtocol)
+}
+
+// Updates returns the per-second counters, split by protocol, from the
+// earliest second changed since the previous call; ok is false if nothing
+// changed.
+func (c *Counter) Updates() (s Series, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dirty == 0 {
+		return Series{}, false
+	}
+	i := sort.Search(len(c.seconds), func(i int) bool { return c.seconds[i].sec >= c.dirty })
+	c.dirty = 0
+	return bucket(c.seconds[i:], time.Second, true), true
+}
+
+// bucket groups seconds, which are in order, into buckets of interval.
+func bucket(seconds []second, interval time.Duration, byProtocol bool) Series {
+	step := int64(interval / time.Second)
+	if step < 1 {
+		step = 1
+	}
+	out := Series{IntervalMs: step * 1000, Points: []Point{}}
+	if len(seconds) == 0 {
+		return out
+	}
+	first := seconds[0].sec - seconds[0].sec%step
+	last := seconds[len(seconds)-1].sec
+	n := (last-first)/step + 1
+	if n > MaxPoints {
+		first += (n - MaxPoints) * step
+		n = MaxPoints
+		out.Truncated = true
+	}
+	out.Points = make([]Point, n)
+	for i := range out.Points {
+		out.Points[i].Time = (first + int64(i)*step) * 1000
+	}
+	for _, s := range seconds {
+		if s.sec < first {
+			continue
+		}
+		p := &out.Points[(s.sec-first)/step]
+		p.Packets += s.count.Packets
+		p.Bytes += s.count.Bytes
+		if !byProtocol {
+			continue
+		}
+		if p.Protocols == nil {
+			p.Protocols = make(map[string]Count)
+		}
+		for proto, pc := range s.protocols {
+			cur := p.Protocols[proto]
+			cur.Packets += pc.Packets
+			cur.Bytes += pc.Bytes
+			p.Protocols[proto] = cur
+		}
+	}
+	return out
+}
@@ -0,0 +1,218 @@
+package matrix
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"sniffox/internal/geoip"
+)
+
+// Labels for addresses outside every defined subnet.
+const (
+	Internet   = "internet"   // public unicast addresses
+	Unassigned = "unassigned" // private, multicast and other non-public addresses
+)
+
+// Subnet is a named internal network segment.
+type Subnet struct {
+	Name string `json:"name"`
+	CIDR string `json:"cidr"`
+}
+
+// Cell is the traffic sent from one segment to another.
+type Cell struct {
+	Source  string `json:"source"`
+	Target  string `json:"target"`
+	Packets int    `json:"packets"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// Total summarizes a segment's traffic. Ingress and egress count bytes
+// crossing the segment boundary in either direction; internet bytes are the
+// share of those exchanged with public addresses.
+type Total struct {
+	Name          string `json:"name"`
+	InternalBytes int64  `json:"internalBytes"`
+	IngressBytes  int64  `json:"ingressBytes"`
+	EgressBytes   int64  `json:"egressBytes"`
+	FromInternet  int64  `json:"fromInternet"`
+	ToInternet    int64  `json:"toInternet"`
+}
+
+// Snapshot is the matrix returned to clients.
+type Snapshot struct {
+	Subnets []Subnet `json:"subnets"`
+	Cells   []Cell   `json:"cells"`
+	Totals  []Total  `json:"totals"`
+}
+
+type subnet struct {
+	name string
+	net  *net.IPNet
+}
+
+type cellKey struct{ src, dst string }
+
+// Matrix counts traffic between user-defined subnets and the internet.
+type Matrix struct {
+	mu      sync.Mutex
+	defs    []Subnet
+	subnets []subnet // most specific first
+	cells   map[cellKey]*Cell
+}
+
+// New creates a matrix with no subnets defined.
+func New() *Matrix {
+	return &Matrix{cells: make(map[cellKey]*Cell)}
+}
+
+// ParseSubnets parses "name=cidr" or bare "cidr" entries; a bare CIDR is
+// named after itself. The CIDRs are validated by SetSubnets.
+func ParseSubnets(specs []string) []Subnet {
+	var out []Subnet
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		name, cidr, ok := strings.Cut(spec, "=")
+		if !ok {
+			name, cidr = spec, spec
+		}
+		out = append(out, Subnet{Name: strings.TrimSpace(name), CIDR: strings.TrimSpace(cidr)})
+	}
+	return out
+}
+
+// SetSubnets replaces the subnet definitions. Counts are cleared since
+// traffic already seen cannot be re-attributed.
+func (m *Matrix) SetSubnets(defs []Subnet) error {
+	subnets := make([]subnet, 0, len(defs))
+	named := make([]Subnet, 0, len(defs))
+	names := make(map[string]bool)
+	for _, d := range defs {
+		_, n, err := net.ParseCIDR(d.CIDR)
+		if err != nil {
+			return fmt.Errorf("subnet %q: invalid CIDR %q", d.Name, d.CIDR)
+		}
+		if d.Name == "" {
+			d.Name = n.String()
+		}
+		if d.Name == Internet || d.Name == Unassigned {
+			return fmt.Errorf("subnet name %q is reserved", d.Name)
+		}
+		if names[d.Name] {
+			return fmt.Errorf("duplicate subnet name %q", d.Name)
+		}
+		names[d.Name] = true
+		named = append(named, d)
+		subnets = append(subnets, subnet{name: d.Name, net: n})
+	}
+	sort.SliceStable(subnets, func(i, j int) bool {
+		a, _ := subnets[i].net.Mask.Size()
+		b, _ := subnets[j].net.Mask.Size()
+		return a > b
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.defs = named
+	m.subnets = subnets
+	m.cells = make(map[cellKey]*Cell)
+	return nil
+}
+
+// Subnets returns the current subnet definitions.
+func (m *Matrix) Subnets() []Subnet {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Subnet{}, m.defs...)
+}
+
+// Add records one packet from src to dst.
+func (m *Matrix) Add(src, dst net.IP, length int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.subnets) == 0 {
+		return
+	}
+	key := cellKey{m.classify(src), m.classify(dst)}
+	c, ok := m.cells[key]
+	if !ok {
+		c = &Cell{Source: key.src, Target: key.dst}
+		m.cells[key] = c
+	}
+	c.Packets++
+	c.Bytes += int64(length)
+}
+
+func (m *Matrix) classify(ip net.IP) string {
+	for _, s := range m.subnets {
+		if s.net.Contains(ip) {
+			return s.name
+		}
+	}
+	if geoip.IsPublic(ip) {
+		return Internet
+	}
+	return Unassigned
+}
+
+// Snapshot returns the matrix cells, heaviest first, and per-subnet totals
+// in definition order.
+func (m *Matrix) Snapshot() Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snap := Snapshot{Subnets: append([]Subnet{}, m.defs...), Cells: []Cell{}, Totals: []Total{}}
+	totals := make(map[string]*Total)
+	for _, s := range m.subnets {
+		totals[s.name] = &Total{Name: s.name}
+	}
+
+	for _, c := range m.cells {
+		snap.Cells = append(snap.Cells, *c)
+		if c.Source == c.Target {
+			if t := totals[c.Source]; t != nil {
+				t.InternalBytes += c.Bytes
+			}
+			continue
+		}
+		if t := totals[c.Source]; t != nil {
+			t.EgressBytes += c.Bytes
+			if c.Target == Internet {
+				t.ToInternet += c.Bytes
+			}
+		}
+		if t := totals[c.Target]; t != nil {
+			t.IngressBytes += c.Bytes
+			if c.Source == Internet {
+				t.FromInternet += c.Bytes
+			}
+		}
+	}
+
+	sort.Slice(snap.Cells, func(i, j int) bool {
+		if snap.Cells[i].Bytes != snap.Cells[j].Bytes {
+			return snap.Cells[i].Bytes > snap.Cells[j].Bytes
+		}
+		if snap.Cells[i].Source != snap.Cells[j].Source {
+			return snap.Cells[i].Source < snap.Cells[j].Source
+		}
+		return snap.Cells[i].Target < snap.Cells[j].Target
+	})
+	for _, d := range m.defs {
+		snap.Totals = append(snap.Totals, *totals[d.Name])
+	}
+	return snap
+}
+
+// Reset clears the counts but keeps the subnet definitions.
+func (m *Matrix) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cells = make(map[cellKey]*Cell)
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Alert is a security finding. Field names mirror the alerts raised by the
+// browser-side detectors so both can be rendered by the same UI code.
+type Alert struct {
+	ID        int      `json:"id,omitempty"`
+	Severity  string   `json:"severity"` // critical, high, medium, low
+	Type      string   `json:"type"`
+	Title     string   `json:"title"`
+	Detail    string   `json:"detail"`
+	Timestamp string   `json:"timestamp"`
+	PktNumber int      `json:"pktNumber,omitempty"`
+	FlowID    uint64   `json:"flowId,omitempty"` // flow of the triggering packet
+	SrcIP     string   `json:"srcIp,omitempty"`
+	Tags      []string `json:"tags,omitempty"` // host groups of the triggering packet
+
+	// RuleID is the gid:sid:rev of the signature behind the alert, and
+	// Packets the packets that carried what it matched
+	RuleID  string `json:"ruleId,omitempty"`
+	Packets []int  `json:"packets,omitempty"`
+
+	// Time is the full capture time; Timestamp is its display form.
+	Time time.Time `json:"time"`
+	// Indicators are the observables behind the finding, for export to
+	// threat-intel platforms.
+	Indicators []Indicator `json:"indicators,omitempty"`
+}
+
+// Indicator types.
+const (
+	IndicatorIPv4   = "ipv4"
+	IndicatorIPv6   = "ipv6"
+	IndicatorDomain = "domain"
+	IndicatorJA3    = "ja3"
+	IndicatorMD5    = "md5"
+	IndicatorSHA1   = "sha1"
+	IndicatorSHA256 = "sha256"
+)
+
+// Indicator is one observable: an address, domain name, hash or TLS
+// fingerprint.
+type Indicator struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
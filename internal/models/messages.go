@@ -1,6 +1,9 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"strings"
+)
 
 // WSMessage is the envelope for all WebSocket communication.
 type WSMessage struct {
@@ -10,9 +13,80 @@ type WSMessage struct {
 
 // StartCaptureRequest is sent by the client to begin a live capture.
 type StartCaptureRequest struct {
-	Interface string `json:"interface"`
-	BPFFilter string `json:"bpfFilter,omitempty"`
-	SnapLen   int    `json:"snapLen,omitempty"`
+	// Interface is one interface name, a list of names, or "any" for
+	// every interface with an address. Each interface is read by its own
+	// goroutine and packets are tagged with the interface they arrived on.
+	Interface InterfaceList `json:"interface"`
+	BPFFilter string        `json:"bpfFilter,omitempty"`
+	SnapLen   int           `json:"snapLen,omitempty"`
+
+	// Backend is "pcap" (the default) or, on Linux, "afpacket": AF_PACKET
+	// sockets with TPACKETv3 rings, which keep up with faster links.
+	// Fanout splits an afpacket capture over that many sockets, hashed by
+	// flow and read in parallel.
+	Backend string `json:"backend,omitempty"`
+	Fanout  int    `json:"fanout,omitempty"`
+
+	// Retention limits for the in-memory packet store; zero means
+	// unlimited. The oldest packets are evicted first.
+	MaxPackets  int   `json:"maxPackets,omitempty"`
+	MaxBytes    int64 `json:"maxBytes,omitempty"`
+	MaxDuration int   `json:"maxDuration,omitempty"` // seconds
+
+	// Auto-stop conditions: the capture stops by itself after this many
+	// packets, seconds or captured bytes, whichever comes first; zero
+	// disables each. With SaveOnStop the packets are then saved as a
+	// session named SessionName.
+	StopAfterPackets int    `json:"stopAfterPackets,omitempty"`
+	StopAfterSeconds int    `json:"stopAfterSeconds,omitempty"`
+	StopAfterBytes   int64  `json:"stopAfterBytes,omitempty"`
+	SaveOnStop       bool   `json:"saveOnStop,omitempty"`
+	SessionName      string `json:"sessionName,omitempty"`
+
+	// Record writes every packet to pcap files in RecordDir, which the
+	// server sets. A new file is started after RotateMB million bytes or
+	// RotateSeconds seconds (tcpdump -C and -G); with RotateFiles set only
+	// that many of the newest files are kept (tcpdump -W). Zero disables
+	// each limit.
+	Record        bool   `json:"record,omitempty"`
+	RecordDir     string `json:"-"`
+	RotateMB      int    `json:"rotateMB,omitempty"`
+	RotateSeconds int    `json:"rotateSeconds,omitempty"`
+	RotateFiles   int    `json:"rotateFiles,omitempty"`
+
+	// AutosaveDir is where the server checkpoints captures that are not
+	// recorded, so a crash loses little of what was held in memory.
+	AutosaveDir string `json:"-"`
+
+	// ResolveHosts fills in the host names of packet and flow endpoints:
+	// from DNS answers, DHCP, mDNS, LLMNR and NBNS seen in the capture,
+	// and for other addresses from reverse DNS lookups made in the
+	// background.
+	ResolveHosts bool `json:"resolveHosts,omitempty"`
+}
+
+// InterfaceList is a set of capture interfaces. In JSON it is either an
+// array of names or a single, possibly comma-separated, string.
+type InterfaceList []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (l *InterfaceList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*l = nil
+		for _, name := range strings.Split(one, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				*l = append(*l, name)
+			}
+		}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*l = many
+	return nil
 }
 
 // InterfaceInfo describes a network interface available for capture.
@@ -34,23 +108,61 @@ type ErrorPayload struct {
 	Message string `json:"message"`
 }
 
-// FlowInfo is sent in flow_update broadcasts.
+// FlowInfo describes one flow in flow_update broadcasts and flow queries.
 type FlowInfo struct {
-	ID          uint64 `json:"id"`
-	SrcIP       string `json:"srcIp"`
-	DstIP       string `json:"dstIp"`
-	SrcPort     uint16 `json:"srcPort"`
-	DstPort     uint16 `json:"dstPort"`
-	Protocol    string `json:"protocol"`
-	PacketCount int    `json:"packetCount"`
-	ByteCount   int64  `json:"byteCount"`
-	FirstSeen   int64  `json:"firstSeen"`
-	LastSeen    int64  `json:"lastSeen"`
-	TCPState    string `json:"tcpState,omitempty"`
-	FwdPackets  int    `json:"fwdPackets"`
-	FwdBytes    int64  `json:"fwdBytes"`
-	RevPackets  int    `json:"revPackets"`
-	RevBytes    int64  `json:"revBytes"`
+	ID           uint64   `json:"id"`
+	SrcIP        string   `json:"srcIp"`
+	DstIP        string   `json:"dstIp"`
+	SrcPort      uint16   `json:"srcPort"`
+	DstPort      uint16   `json:"dstPort"`
+	Protocol     string   `json:"protocol"`
+	Scope        string   `json:"scope,omitempty"`
+	FwdPath      string   `json:"fwdPath,omitempty"` // MPLS labels and tunnels of each direction
+	RevPath      string   `json:"revPath,omitempty"`
+	PacketCount  int      `json:"packetCount"`
+	ByteCount    int64    `json:"byteCount"`
+	FirstSeen    int64    `json:"firstSeen"`
+	LastSeen     int64    `json:"lastSeen"`
+	TCPState     string   `json:"tcpState,omitempty"`
+	FwdPackets   int      `json:"fwdPackets"`
+	FwdBytes     int64    `json:"fwdBytes"`
+	RevPackets   int      `json:"revPackets"`
+	RevBytes     int64    `json:"revBytes"`
+	AppProtocol  string   `json:"appProtocol,omitempty"`
+	AppGuess     string   `json:"appGuess,omitempty"`     // statistical best guess when AppProtocol is unknown
+	AppGuessConf float64  `json:"appGuessConf,omitempty"` // 0..1
+	PID          int      `json:"pid,omitempty"`          // local captures only
+	ProcessName  string   `json:"processName,omitempty"`  // local captures only
+	Tags         []string `json:"tags,omitempty"`
+	Interfaces   []string `json:"interfaces,omitempty"` // capture interfaces the flow was seen on
+	SNI          string   `json:"sni,omitempty"`
+	JA3          string   `json:"ja3,omitempty"`
+	// ICMP errors sent about the flow's packets, and the last one's type
+	ICMPErrors    int     `json:"icmpErrors,omitempty"`
+	LastICMPError string  `json:"lastIcmpError,omitempty"`
+	Info          string  `json:"info,omitempty"`       // what the flow carries, such as an FTP transfer
+	Rate          []int64 `json:"rate,omitempty"`       // bytes/s over the last 60 s, oldest first
+	RateEnd       int64   `json:"rateEnd,omitempty"`    // unix second of Rate's last entry
+	Throughput    float64 `json:"throughput,omitempty"` // bytes/s over the last 10 s
+	// TCP performance: RTTs in ms, and retransmissions, duplicate ACKs and
+	// zero-window events in both directions; /api/flows/{id}/metrics has more
+	HandshakeRTT float64  `json:"handshakeRtt,omitempty"`
+	RTT          float64  `json:"rtt,omitempty"` // latest sample
+	Retransmits  int      `json:"retransmits,omitempty"`
+	DupAcks      int      `json:"dupAcks,omitempty"`
+	ZeroWindows  int      `json:"zeroWindows,omitempty"`
+	SrcGeo       *GeoInfo `json:"srcGeo,omitempty"`
+	DstGeo       *GeoInfo `json:"dstGeo,omitempty"`
+	SrcHost      string   `json:"srcHost,omitempty"` // when name resolution is on
+	DstHost      string   `json:"dstHost,omitempty"`
+}
+
+// FlowDelta is the payload of flow_update broadcasts: the flows that
+// changed since the previous one and the IDs of flows that were evicted.
+// Clients build the full table from a get_flows reply and apply deltas.
+type FlowDelta struct {
+	Flows   []FlowInfo `json:"flows"`
+	Removed []uint64   `json:"removed,omitempty"`
 }
 
 // StreamEvent is sent for stream-related WebSocket events.
@@ -62,10 +174,41 @@ type StreamEvent struct {
 	Data      json.RawMessage `json:"data,omitempty"`
 }
 
+// StartProfileRequest is sent by the client to start a capture from a
+// saved capture profile. The reply is a "profile_started" message holding
+// the profile, whose display filter the client applies.
+type StartProfileRequest struct {
+	Name string `json:"name"`
+}
+
 // GetStreamDataRequest is sent by the client to request stream data.
 type GetStreamDataRequest struct {
 	StreamID uint64 `json:"streamId"`
 }
 
+// DisplayFilterRequest is sent by the client to set its server-side
+// display filter; an empty filter clears it.
+type DisplayFilterRequest struct {
+	Filter string `json:"filter"`
+}
+
+// DisplayFilterStatus confirms the display filter now applied to a client.
+type DisplayFilterStatus struct {
+	Filter string `json:"filter"`
+	Active bool   `json:"active"`
+}
+
+// SubscriptionRequest is sent by the client with a "subscribe" or
+// "unsubscribe" command to choose which broadcast topics it receives:
+// packets, flows, stats, alerts and streams.
+type SubscriptionRequest struct {
+	Topics []string `json:"topics"`
+}
+
+// SubscriptionStatus lists the topics a client now receives.
+type SubscriptionStatus struct {
+	Topics []string `json:"topics"`
+}
+
 // GetFlowsRequest is sent by the client to request the flow table.
 type GetFlowsRequest struct{}
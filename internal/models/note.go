@@ -0,0 +1,12 @@
+package models
+
+// Note is an analyst finding in a session's investigation log, optionally
+// linked to a packet and/or flow.
+type Note struct {
+	ID         int    `json:"id"`
+	CreatedAt  string `json:"createdAt"` // RFC 3339, when the note was written
+	Text       string `json:"text"`
+	PktNumber  int    `json:"pktNumber,omitempty"`
+	FlowID     uint64 `json:"flowId,omitempty"`
+	PacketTime string `json:"packetTime,omitempty"` // RFC 3339 capture time of the linked packet
+}
@@ -9,17 +9,66 @@ type PacketInfo struct {
 	Protocol  string        `json:"protocol"`
 	Length    int           `json:"length"`
 	Info      string        `json:"info"`
+	InfoParts []InfoPart    `json:"infoParts,omitempty"` // Info broken into components
 	Layers    []LayerDetail `json:"layers"`
 	HexDump   string        `json:"hexDump"`
 	RawHex    string        `json:"rawHex"`
 	FlowID    uint64        `json:"flowId,omitempty"`
 	StreamID  uint64        `json:"streamId,omitempty"`
+	Tags      []string      `json:"tags,omitempty"`      // host groups of either endpoint
+	Interface string        `json:"interface,omitempty"` // capture interface, live captures only
+	// Reassembled is the number of IP fragments this packet's datagram was
+	// rebuilt from; zero for packets that were not fragmented.
+	Reassembled int `json:"reassembled,omitempty"`
+	// Annotations are expert-info findings (retransmissions, bad checksums,
+	// ...); Severity is the highest of them: note, warn or error.
+	Annotations []string     `json:"annotations,omitempty"`
+	Severity    string       `json:"severity,omitempty"`
+	Color       *PacketColor `json:"color,omitempty"` // first matching coloring rule
+	SrcGeo      *GeoInfo     `json:"srcGeo,omitempty"`
+	DstGeo      *GeoInfo     `json:"dstGeo,omitempty"`
+
+	// Host names of the IP endpoints, when name resolution is on
+	SrcHost string `json:"srcHost,omitempty"`
+	DstHost string `json:"dstHost,omitempty"`
+
+	// QuotedFlowID is the flow of the datagram an ICMP error quotes, when
+	// that flow was captured too
+	QuotedFlowID uint64 `json:"quotedFlowId,omitempty"`
+
+	// Malformed is why dissection was cut short: a dissector panic or a
+	// parse limit. The raw bytes are kept; the layers stop where it failed
+	Malformed string `json:"malformed,omitempty"`
+}
+
+// MalformedPacket is a packet quarantined because dissecting or processing
+// it failed, kept with its raw bytes for inspection.
+type MalformedPacket struct {
+	Number    int    `json:"number"`
+	Timestamp string `json:"timestamp"`
+	Interface string `json:"interface,omitempty"`
+	Length    int    `json:"length"`
+	Reason    string `json:"reason"`
+	RawHex    string `json:"rawHex"`
+}
+
+// InfoPart is one component of a packet's Info column: a message ID and
+// the values it is filled with. Info is the English rendering of the parts
+// in order; clients can render the same IDs from their own string table.
+type InfoPart struct {
+	ID   string            `json:"id"`
+	Args map[string]string `json:"args,omitempty"`
 }
 
 // LayerDetail represents one protocol layer in the packet.
 type LayerDetail struct {
 	Name   string       `json:"name"`
 	Fields []LayerField `json:"fields"`
+
+	// Byte range of the layer in the packet data; Length is zero for
+	// layers decoded from elsewhere, such as reassembled streams
+	Offset int `json:"offset,omitempty"`
+	Length int `json:"length,omitempty"`
 }
 
 // LayerField represents a single field within a protocol layer.
@@ -27,4 +76,79 @@ type LayerField struct {
 	Name     string       `json:"name"`
 	Value    string       `json:"value"`
 	Children []LayerField `json:"children,omitempty"`
+
+	// Byte range of the field in the packet data, for highlighting it in
+	// the hex dump. Length is zero for computed values and fields whose
+	// bytes could not be located.
+	Offset int `json:"offset,omitempty"`
+	Length int `json:"length,omitempty"`
+}
+
+// PacketSummary is the compact, column-level view of a packet used in
+// snapshots and history listings where layers and hex are not needed.
+type PacketSummary struct {
+	Number      int          `json:"number"`
+	Timestamp   string       `json:"timestamp"`
+	SrcAddr     string       `json:"srcAddr"`
+	DstAddr     string       `json:"dstAddr"`
+	Protocol    string       `json:"protocol"`
+	Length      int          `json:"length"`
+	Info        string       `json:"info"`
+	InfoParts   []InfoPart   `json:"infoParts,omitempty"`
+	FlowID      uint64       `json:"flowId,omitempty"`
+	StreamID    uint64       `json:"streamId,omitempty"`
+	Tags        []string     `json:"tags,omitempty"`
+	Interface   string       `json:"interface,omitempty"`
+	Reassembled int          `json:"reassembled,omitempty"`
+	Annotations []string     `json:"annotations,omitempty"`
+	Severity    string       `json:"severity,omitempty"`
+	Color       *PacketColor `json:"color,omitempty"`
+	SrcGeo      *GeoInfo     `json:"srcGeo,omitempty"`
+	DstGeo      *GeoInfo     `json:"dstGeo,omitempty"`
+	SrcHost     string       `json:"srcHost,omitempty"`
+	DstHost     string       `json:"dstHost,omitempty"`
+	Malformed   string       `json:"malformed,omitempty"`
+}
+
+// Summary returns the column-level view of the packet.
+func (p PacketInfo) Summary() PacketSummary {
+	return PacketSummary{
+		Number:      p.Number,
+		Timestamp:   p.Timestamp,
+		SrcAddr:     p.SrcAddr,
+		DstAddr:     p.DstAddr,
+		Protocol:    p.Protocol,
+		Length:      p.Length,
+		Info:        p.Info,
+		InfoParts:   p.InfoParts,
+		FlowID:      p.FlowID,
+		StreamID:    p.StreamID,
+		Tags:        p.Tags,
+		Interface:   p.Interface,
+		Reassembled: p.Reassembled,
+		Annotations: p.Annotations,
+		Severity:    p.Severity,
+		Color:       p.Color,
+		SrcGeo:      p.SrcGeo,
+		DstGeo:      p.DstGeo,
+		SrcHost:     p.SrcHost,
+		DstHost:     p.DstHost,
+		Malformed:   p.Malformed,
+	}
+}
+
+// PacketColor is the packet list color given by a coloring rule.
+type PacketColor struct {
+	Rule       string `json:"rule"`
+	Foreground string `json:"fg"`
+	Background string `json:"bg"`
+}
+
+// GeoInfo is the GeoIP/ASN enrichment of a public address.
+type GeoInfo struct {
+	Country     string `json:"country,omitempty"` // ISO 3166-1 alpha-2
+	CountryName string `json:"countryName,omitempty"`
+	City        string `json:"city,omitempty"`
+	ASN         uint   `json:"asn,omitempty"`
+	ASOrg       string `json:"asOrg,omitempty"`
 }
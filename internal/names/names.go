@@ -0,0 +1,135 @@
+// Package names keeps the hostnames known for IP addresses: learned
+// passively from DNS answers, DHCP and the name services hosts use to
+// announce and find each other on the local link (mDNS, LLMNR and NetBIOS
+// Name Service), and optionally by reverse DNS in the background.
+package names
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/parser"
+)
+
+const (
+	maxEntries = 16384
+	maxAliases = 8 // per address; the least recently seen are dropped
+)
+
+// Entry is what is known of one address's names.
+type Entry struct {
+	IP        string    `json:"ip"`
+	Name      string    `json:"name"`   // most recently announced
+	Source    string    `json:"source"` // protocol that announced Name
+	Aliases   []string  `json:"aliases,omitempty"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// Cache maps addresses to names. It is safe for concurrent use.
+type Cache struct {
+	mu      sync.RWMutex
+	entries map[string]*Entry
+	rev     reverse
+}
+
+// NewCache creates an empty cache.
+func NewCache() *Cache {
+	c := &Cache{rev: reverse{
+		queue:   make(chan string, reverseQueue),
+		pending: make(map[string]bool),
+		misses:  make(map[string]time.Time),
+		lookup:  net.DefaultResolver.LookupAddr,
+	}}
+	c.Reset()
+	return c
+}
+
+// Observe records the bindings a packet announces; see
+// parser.NameResolutions.
+func (c *Cache) Observe(pkt gopacket.Packet) {
+	for _, r := range parser.NameResolutions(pkt) {
+		c.Add(r.IP, r.Name, r.Protocol, pkt.Metadata().Timestamp)
+	}
+}
+
+// Add records that source bound name to ip at ts. A different name
+// replaces the current one, which is kept as an alias.
+func (c *Cache) Add(ip, name, source string, ts time.Time) {
+	c.add(ip, name, source, ts, true)
+}
+
+// add records a binding; with replace unset it only names an address that
+// has no name yet.
+func (c *Cache) add(ip, name, source string, ts time.Time, replace bool) {
+	if ip == "" || name == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[ip]
+	if ok && !replace {
+		return
+	}
+	if !ok {
+		if len(c.entries) >= maxEntries {
+			return
+		}
+		e = &Entry{IP: ip, FirstSeen: ts}
+		c.entries[ip] = e
+	}
+	if e.Name != "" && e.Name != name {
+		aliases := []string{e.Name}
+		for _, a := range e.Aliases {
+			if a != name && len(aliases) < maxAliases {
+				aliases = append(aliases, a)
+			}
+		}
+		e.Aliases = aliases
+	}
+	e.Name, e.Source, e.LastSeen = name, source, ts
+}
+
+// Lookup returns the current name of ip.
+func (c *Cache) Lookup(ip string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if e, ok := c.entries[ip]; ok {
+		return e.Name, true
+	}
+	return "", false
+}
+
+// Table returns every entry, sorted by address.
+func (c *Cache) Table() []Entry {
+	c.mu.RLock()
+	out := make([]Entry, 0, len(c.entries))
+	for _, e := range c.entries {
+		cp := *e
+		cp.Aliases = append([]string(nil), e.Aliases...)
+		out = append(out, cp)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		a, b := net.ParseIP(out[i].IP), net.ParseIP(out[j].IP)
+		if (a.To4() == nil) != (b.To4() == nil) {
+			return a.To4() != nil // IPv4 first
+		}
+		return bytes.Compare(a.To16(), b.To16()) < 0
+	})
+	return out
+}
+
+// Reset clears the cache.
+func (c *Cache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*Entry)
+}
@@ -0,0 +1,89 @@
+package names
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	reverseWorkers = 4
+	reverseQueue   = 1024
+	reverseTimeout = 3 * time.Second
+	// An address reverse DNS had no name for is not asked again for this long
+	reverseRetry = 10 * time.Minute
+)
+
+// SourceReverseDNS is the Source of names found by reverse lookup.
+const SourceReverseDNS = "rDNS"
+
+// reverse looks up, in the background, the names of addresses nothing
+// has announced one for.
+type reverse struct {
+	once    sync.Once
+	queue   chan string
+	mu      sync.Mutex
+	pending map[string]bool
+	misses  map[string]time.Time
+	lookup  func(ctx context.Context, addr string) ([]string, error)
+}
+
+// Resolve returns the name of ip, or "". On a miss the address is queued
+// for a reverse DNS lookup whose answer later calls will see; Resolve
+// itself never waits for the network, and drops the request when the
+// queue is full.
+func (c *Cache) Resolve(ip string) string {
+	if name, ok := c.Lookup(ip); ok {
+		return name
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil || addr.IsUnspecified() || addr.IsMulticast() || addr.Equal(net.IPv4bcast) {
+		return ""
+	}
+
+	r := &c.rev
+	r.mu.Lock()
+	if r.pending[ip] || time.Since(r.misses[ip]) < reverseRetry {
+		r.mu.Unlock()
+		return ""
+	}
+	r.pending[ip] = true
+	r.mu.Unlock()
+
+	r.once.Do(func() {
+		for i := 0; i < reverseWorkers; i++ {
+			go c.reverseWorker()
+		}
+	})
+	select {
+	case r.queue <- ip:
+	default:
+		r.mu.Lock()
+		delete(r.pending, ip)
+		r.mu.Unlock()
+	}
+	return ""
+}
+
+func (c *Cache) reverseWorker() {
+	r := &c.rev
+	for ip := range r.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), reverseTimeout)
+		names, err := r.lookup(ctx, ip)
+		cancel()
+
+		r.mu.Lock()
+		delete(r.pending, ip)
+		if err != nil || len(names) == 0 {
+			r.misses[ip] = time.Now()
+		}
+		r.mu.Unlock()
+		// A lookup that finishes late does not replace a name seen on
+		// the wire meanwhile
+		if err == nil && len(names) > 0 {
+			c.add(ip, strings.TrimSuffix(names[0], "."), SourceReverseDNS, time.Now(), false)
+		}
+	}
+}
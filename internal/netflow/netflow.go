@@ -0,0 +1,421 @@
+// Package netflow exports the flow table to a NetFlow v9 (RFC 3954) or
+// IPFIX (RFC 7011) collector over UDP, so sniffox can feed the flow
+// analysis tools a network already runs, as a probe would.
+//
+// Flows are exported the way routers do it: a flow is sent when it has
+// been idle for the inactive timeout or its connection was closed, and a
+// long-lived flow is sent every active timeout with what it carried since.
+// Records are unidirectional, so a flow with traffic both ways yields two.
+package netflow
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/flow"
+)
+
+// Export formats
+const (
+	FormatV9    = "v9"
+	FormatIPFIX = "ipfix"
+)
+
+// Defaults for the timeouts, as used by most routers.
+const (
+	DefaultActiveTimeout   = time.Minute
+	DefaultInactiveTimeout = 15 * time.Second
+)
+
+const (
+	maxMessage      = 1400 // keeps messages within a typical path MTU
+	templateRefresh = time.Minute
+	templateV4      = 256
+	templateV6      = 257
+)
+
+// Flow end reasons (IANA flowEndReason), sent in IPFIX records.
+const (
+	endIdle   = 1
+	endActive = 2
+	endOfFlow = 3
+	endForced = 4
+)
+
+// Config says where and how flows are exported.
+type Config struct {
+	Collector       string        // host:port
+	Format          string        // FormatV9 or FormatIPFIX
+	ActiveTimeout   time.Duration // 0 means DefaultActiveTimeout
+	InactiveTimeout time.Duration // 0 means DefaultInactiveTimeout
+	// DomainID is the source ID of NetFlow v9 or the observation domain
+	// of IPFIX
+	DomainID uint32
+}
+
+// Stats counts what an exporter has sent.
+type Stats struct {
+	Collector string    `json:"collector"`
+	Format    string    `json:"format"`
+	Records   uint64    `json:"records"`
+	Messages  uint64    `json:"messages"`
+	Errors    uint64    `json:"errors"`
+	LastError string    `json:"lastError,omitempty"`
+	LastSent  time.Time `json:"lastSent"`
+}
+
+// exported is what has been sent of a flow so far.
+type exported struct {
+	fwdPackets, revPackets int
+	fwdBytes, revBytes     int64
+	until                  int64 // unix ms the last export covered
+}
+
+// record is one unidirectional flow record.
+type record struct {
+	src, dst       net.IP
+	srcPort        uint16
+	dstPort        uint16
+	proto, flags   uint8
+	bytes, packets uint64
+	start, end     int64 // unix ms
+	reason         uint8
+}
+
+// Exporter sends expired flows to a collector. It is safe for concurrent
+// use.
+type Exporter struct {
+	cfg   Config
+	conn  net.Conn
+	boot  time.Time // sysUptime zero of NetFlow v9
+	proto map[string]uint8
+
+	mu           sync.Mutex
+	flows        map[uint64]*exported
+	seq          uint32 // v9: messages sent; IPFIX: data records sent
+	lastTemplate time.Time
+	stats        Stats
+}
+
+// New validates cfg and opens a UDP socket to its collector.
+func New(cfg Config) (*Exporter, error) {
+	switch cfg.Format {
+	case "", "9", "v9", "netflow9":
+		cfg.Format = FormatV9
+	case "10", "ipfix":
+		cfg.Format = FormatIPFIX
+	default:
+		return nil, fmt.Errorf("unknown flow export format %q (want v9 or ipfix)", cfg.Format)
+	}
+	if cfg.ActiveTimeout <= 0 {
+		cfg.ActiveTimeout = DefaultActiveTimeout
+	}
+	if cfg.InactiveTimeout <= 0 {
+		cfg.InactiveTimeout = DefaultInactiveTimeout
+	}
+	conn, err := net.Dial("udp", cfg.Collector)
+	if err != nil {
+		return nil, err
+	}
+	x := &Exporter{
+		cfg:   cfg,
+		conn:  conn,
+		boot:  time.Now(),
+		proto: make(map[string]uint8),
+		flows: make(map[uint64]*exported),
+		stats: Stats{Collector: cfg.Collector, Format: cfg.Format},
+	}
+	// Flow protocols are named as gopacket names them
+	for i := 0; i < 256; i++ {
+		name := layers.IPProtocol(i).String()
+		if _, dup := x.proto[name]; !dup && !strings.HasPrefix(name, "Unknown") {
+			x.proto[name] = uint8(i)
+		}
+	}
+	return x, nil
+}
+
+// Close closes the socket.
+func (x *Exporter) Close() error {
+	return x.conn.Close()
+}
+
+// Stats returns what has been sent so far.
+func (x *Exporter) Stats() Stats {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.stats
+}
+
+// Export sends the flows, from a snapshot of the flow table, that have
+// expired by now: idle for the inactive timeout, closed, or unsent for the
+// active timeout.
+func (x *Exporter) Export(flows []*flow.Flow, now time.Time) error {
+	return x.export(flows, now, false)
+}
+
+// Flush sends whatever the flows carried that has not been sent yet, as
+// when a capture stops.
+func (x *Exporter) Flush(flows []*flow.Flow, now time.Time) error {
+	return x.export(flows, now, true)
+}
+
+// Reset forgets what was sent, for a flow table that starts over.
+func (x *Exporter) Reset() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.flows = make(map[uint64]*exported)
+}
+
+func (x *Exporter) export(flows []*flow.Flow, now time.Time, force bool) error {
+	nowMs := now.UnixMilli()
+	idle := x.cfg.InactiveTimeout.Milliseconds()
+	active := x.cfg.ActiveTimeout.Milliseconds()
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var recs []record
+	seen := make(map[uint64]bool, len(flows))
+	for _, f := range flows {
+		seen[f.ID] = true
+		ex := x.flows[f.ID]
+		if ex == nil {
+			ex = &exported{until: f.FirstSeen}
+			x.flows[f.ID] = ex
+		}
+		if f.FwdPackets == ex.fwdPackets && f.RevPackets == ex.revPackets {
+			continue
+		}
+		var reason uint8
+		switch {
+		case force:
+			reason = endForced
+		case f.TCPState == flow.TCPStateClosed:
+			reason = endOfFlow
+		case nowMs-f.LastSeen >= idle:
+			reason = endIdle
+		case nowMs-ex.until >= active:
+			reason = endActive
+		default:
+			continue
+		}
+		recs = append(recs, x.records(f, ex, reason)...)
+		ex.fwdPackets, ex.fwdBytes = f.FwdPackets, f.FwdBytes
+		ex.revPackets, ex.revBytes = f.RevPackets, f.RevBytes
+		ex.until = f.LastSeen
+	}
+	// Flows the tracker evicted are gone for good
+	for id := range x.flows {
+		if !seen[id] {
+			delete(x.flows, id)
+		}
+	}
+	return x.send(recs, now)
+}
+
+// records returns the records for what f carried each way since ex.
+func (x *Exporter) records(f *flow.Flow, ex *exported, reason uint8) []record {
+	src, dst := net.ParseIP(f.SrcIP), net.ParseIP(f.DstIP)
+	if src == nil || dst == nil || (src.To4() == nil) != (dst.To4() == nil) {
+		return nil
+	}
+	proto, ok := x.proto[f.Protocol]
+	if !ok {
+		proto = x.proto[strings.ToUpper(f.Protocol)]
+	}
+	start := max(ex.until, f.FirstSeen)
+	var out []record
+	if n := f.FwdPackets - ex.fwdPackets; n > 0 {
+		out = append(out, record{
+			src: src, dst: dst, srcPort: f.SrcPort, dstPort: f.DstPort,
+			proto: proto, flags: f.FwdTCPFlags,
+			bytes: uint64(f.FwdBytes - ex.fwdBytes), packets: uint64(n),
+			start: start, end: f.LastSeen, reason: reason,
+		})
+	}
+	if n := f.RevPackets - ex.revPackets; n > 0 {
+		out = append(out, record{
+			src: dst, dst: src, srcPort: f.DstPort, dstPort: f.SrcPort,
+			proto: proto, flags: f.RevTCPFlags,
+			bytes: uint64(f.RevBytes - ex.revBytes), packets: uint64(n),
+			start: start, end: f.LastSeen, reason: reason,
+		})
+	}
+	return out
+}
+
+// field is a template field: an information element and its length.
+type field struct{ id, length uint16 }
+
+// template returns the fields of the IPv4 or IPv6 template.
+func (x *Exporter) template(v6 bool) []field {
+	fs := []field{{8, 4}, {12, 4}} // sourceIPv4Address, destinationIPv4Address
+	if v6 {
+		fs = []field{{27, 16}, {28, 16}} // sourceIPv6Address, destinationIPv6Address
+	}
+	fs = append(fs,
+		field{7, 2},  // sourceTransportPort
+		field{11, 2}, // destinationTransportPort
+		field{4, 1},  // protocolIdentifier
+		field{6, 1},  // tcpControlBits
+		field{1, 8},  // octetDeltaCount
+		field{2, 8},  // packetDeltaCount
+	)
+	if x.cfg.Format == FormatV9 {
+		// FIRST_SWITCHED and LAST_SWITCHED, in sysUptime milliseconds
+		return append(fs, field{22, 4}, field{21, 4})
+	}
+	return append(fs,
+		field{152, 8}, // flowStartMilliseconds
+		field{153, 8}, // flowEndMilliseconds
+		field{136, 1}, // flowEndReason
+	)
+}
+
+func recordLen(fs []field) int {
+	n := 0
+	for _, f := range fs {
+		n += int(f.length)
+	}
+	return n
+}
+
+// send packs recs into as many messages as they need, one address family
+// per message. The caller holds x.mu.
+func (x *Exporter) send(recs []record, now time.Time) error {
+	var v4, v6 []record
+	for _, r := range recs {
+		if r.src.To4() != nil {
+			v4 = append(v4, r)
+		} else {
+			v6 = append(v6, r)
+		}
+	}
+	tmplLen := 4 + 4 + 4*len(x.template(false)) + 4 + 4*len(x.template(true))
+	var firstErr error
+	for _, fam := range []struct {
+		id   uint16
+		recs []record
+	}{{templateV4, v4}, {templateV6, v6}} {
+		per := (maxMessage - 20 - tmplLen - 4) / recordLen(x.template(fam.id == templateV6))
+		for batch := fam.recs; len(batch) > 0; {
+			n := min(per, len(batch))
+			if err := x.write(fam.id, batch[:n], now); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			batch = batch[n:]
+		}
+	}
+	return firstErr
+}
+
+// write sends one message holding recs in a data set of template id,
+// preceded by the templates when they are due for a refresh.
+func (x *Exporter) write(id uint16, recs []record, now time.Time) error {
+	v9 := x.cfg.Format == FormatV9
+	be := binary.BigEndian
+	hdrLen := 16
+	if v9 {
+		hdrLen = 20
+	}
+	msg := make([]byte, hdrLen, maxMessage)
+	count := len(recs)
+
+	if x.lastTemplate.IsZero() || now.Sub(x.lastTemplate) >= templateRefresh {
+		setID := uint16(2)
+		if v9 {
+			setID = 0
+		}
+		start := len(msg)
+		msg = be.AppendUint16(msg, setID)
+		msg = be.AppendUint16(msg, 0)
+		for _, tid := range []uint16{templateV4, templateV6} {
+			fs := x.template(tid == templateV6)
+			msg = be.AppendUint16(msg, tid)
+			msg = be.AppendUint16(msg, uint16(len(fs)))
+			for _, f := range fs {
+				msg = be.AppendUint16(msg, f.id)
+				msg = be.AppendUint16(msg, f.length)
+			}
+		}
+		be.PutUint16(msg[start+2:], uint16(len(msg)-start))
+		x.lastTemplate = now
+		count += 2
+	}
+
+	start := len(msg)
+	msg = be.AppendUint16(msg, id)
+	msg = be.AppendUint16(msg, 0)
+	for _, r := range recs {
+		msg = x.appendRecord(msg, r)
+	}
+	for len(msg)%4 != 0 {
+		msg = append(msg, 0)
+	}
+	be.PutUint16(msg[start+2:], uint16(len(msg)-start))
+
+	if v9 {
+		be.PutUint16(msg[0:], 9)
+		be.PutUint16(msg[2:], uint16(count))
+		be.PutUint32(msg[4:], x.uptime(now.UnixMilli()))
+		be.PutUint32(msg[8:], uint32(now.Unix()))
+		be.PutUint32(msg[12:], x.seq)
+		be.PutUint32(msg[16:], x.cfg.DomainID)
+		x.seq++
+	} else {
+		be.PutUint16(msg[0:], 10)
+		be.PutUint16(msg[2:], uint16(len(msg)))
+		be.PutUint32(msg[4:], uint32(now.Unix()))
+		be.PutUint32(msg[8:], x.seq)
+		be.PutUint32(msg[12:], x.cfg.DomainID)
+		x.seq += uint32(len(recs))
+	}
+
+	if _, err := x.conn.Write(msg); err != nil {
+		x.stats.Errors++
+		x.stats.LastError = err.Error()
+		// Resend the templates with the next message in case the collector
+		// missed them
+		x.lastTemplate = time.Time{}
+		return err
+	}
+	x.stats.Messages++
+	x.stats.Records += uint64(len(recs))
+	x.stats.LastSent = now
+	return nil
+}
+
+func (x *Exporter) appendRecord(msg []byte, r record) []byte {
+	be := binary.BigEndian
+	if ip4 := r.src.To4(); ip4 != nil {
+		msg = append(msg, ip4...)
+		msg = append(msg, r.dst.To4()...)
+	} else {
+		msg = append(msg, r.src.To16()...)
+		msg = append(msg, r.dst.To16()...)
+	}
+	msg = be.AppendUint16(msg, r.srcPort)
+	msg = be.AppendUint16(msg, r.dstPort)
+	msg = append(msg, r.proto, r.flags)
+	msg = be.AppendUint64(msg, r.bytes)
+	msg = be.AppendUint64(msg, r.packets)
+	if x.cfg.Format == FormatV9 {
+		msg = be.AppendUint32(msg, x.uptime(r.start))
+		return be.AppendUint32(msg, x.uptime(r.end))
+	}
+	msg = be.AppendUint64(msg, uint64(r.start))
+	msg = be.AppendUint64(msg, uint64(r.end))
+	return append(msg, r.reason)
+}
+
+// uptime converts a unix ms time to NetFlow v9 sysUptime, the
+// milliseconds since the exporter started.
+func (x *Exporter) uptime(ms int64) uint32 {
+	return uint32(max(ms-x.boot.UnixMilli(), 0))
+}
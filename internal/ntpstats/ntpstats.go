@@ -0,0 +1,223 @@
+// Package ntpstats aggregates NTP traffic per time server: stratum,
+// reference, the clients that sync against it and how its advertised
+// clock moves relative to the capture clock.
+package ntpstats
+
+import (
+	"math"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/parser"
+)
+
+const (
+	maxServers     = 1024
+	maxClients     = 256 // per server
+	maxRecentSteps = 100
+
+	// StepThresholdMs is the change in a server's offset between replies
+	// that counts as a time step rather than jitter.
+	StepThresholdMs = 1000
+)
+
+// ServerStats summarises one NTP server.
+type ServerStats struct {
+	Server      string    `json:"server"`
+	Stratum     int       `json:"stratum"`
+	RefID       string    `json:"refId,omitempty"`
+	Version     int       `json:"version"`
+	Leap        int       `json:"leap"` // 3 = unsynchronized
+	Requests    int       `json:"requests"`
+	Responses   int       `json:"responses"`
+	Clients     []string  `json:"clients"`
+	Allowed     bool      `json:"allowed"` // in the configured server list, or no list set
+	OffsetMs    float64   `json:"offsetMs"`
+	MinOffsetMs float64   `json:"minOffsetMs"`
+	MaxOffsetMs float64   `json:"maxOffsetMs"`
+	AvgOffsetMs float64   `json:"avgOffsetMs"`
+	DelayMs     float64   `json:"delayMs"`
+	Steps       int       `json:"steps"`
+	FirstSeen   time.Time `json:"firstSeen"`
+	LastSeen    time.Time `json:"lastSeen"`
+
+	offsetSum float64
+	offsets   int
+}
+
+// StepEvent is a jump in a server's advertised time.
+type StepEvent struct {
+	Time         time.Time `json:"time"`
+	Server       string    `json:"server"`
+	Client       string    `json:"client"`
+	FromOffsetMs float64   `json:"fromOffsetMs"`
+	ToOffsetMs   float64   `json:"toOffsetMs"`
+}
+
+// Stats is the NTP dashboard payload.
+type Stats struct {
+	Servers     []ServerStats `json:"servers"`
+	RecentSteps []StepEvent   `json:"recentSteps"` // newest first
+	Allowed     []string      `json:"allowed"`     // configured time servers
+}
+
+// Tracker collects per-server NTP statistics.
+type Tracker struct {
+	mu      sync.Mutex
+	allowed []string
+	servers map[string]*ServerStats
+	steps   []StepEvent
+}
+
+// NewTracker creates an NTP tracker with no server list, so every server
+// is allowed.
+func NewTracker() *Tracker {
+	return &Tracker{servers: make(map[string]*ServerStats)}
+}
+
+// SetAllowed sets the IPs/CIDRs of the time servers clients should use.
+func (t *Tracker) SetAllowed(servers []string) {
+	var clean []string
+	for _, s := range servers {
+		if s = strings.TrimSpace(s); s != "" {
+			clean = append(clean, s)
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.allowed = clean
+}
+
+// Allowed reports whether server is in the configured list. With no list
+// every server is allowed.
+func (t *Tracker) Allowed(server string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.isAllowed(server)
+}
+
+func (t *Tracker) isAllowed(server string) bool {
+	if len(t.allowed) == 0 {
+		return true
+	}
+	ip := net.ParseIP(server)
+	for _, a := range t.allowed {
+		if a == server {
+			return true
+		}
+		if _, n, err := net.ParseCIDR(a); err == nil && ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Observe records an NTP request or reply.
+func (t *Tracker) Observe(pkt gopacket.Packet) {
+	ex := parser.ExtractNTP(pkt)
+	if ex == nil {
+		return
+	}
+	ts := pkt.Metadata().Timestamp
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.servers[ex.Server]
+	if !ok {
+		if len(t.servers) >= maxServers {
+			return
+		}
+		s = &ServerStats{Server: ex.Server, FirstSeen: ts}
+		t.servers[ex.Server] = s
+	}
+	s.LastSeen = ts
+	if len(s.Clients) < maxClients && !slices.Contains(s.Clients, ex.Client) {
+		s.Clients = append(s.Clients, ex.Client)
+	}
+	if !ex.Response {
+		s.Requests++
+		return
+	}
+
+	s.Responses++
+	s.Stratum, s.RefID, s.Version, s.Leap = ex.Stratum, ex.RefID, ex.Version, ex.Leap
+	if !ex.HasOffset {
+		return
+	}
+	if s.offsets > 0 && math.Abs(ex.OffsetMs-s.OffsetMs) >= StepThresholdMs {
+		s.Steps++
+		t.steps = append([]StepEvent{{
+			Time:         ts,
+			Server:       ex.Server,
+			Client:       ex.Client,
+			FromOffsetMs: round(s.OffsetMs),
+			ToOffsetMs:   round(ex.OffsetMs),
+		}}, t.steps...)
+		if len(t.steps) > maxRecentSteps {
+			t.steps = t.steps[:maxRecentSteps]
+		}
+	}
+	if s.offsets == 0 || ex.OffsetMs < s.MinOffsetMs {
+		s.MinOffsetMs = ex.OffsetMs
+	}
+	if s.offsets == 0 || ex.OffsetMs > s.MaxOffsetMs {
+		s.MaxOffsetMs = ex.OffsetMs
+	}
+	s.OffsetMs, s.DelayMs = ex.OffsetMs, ex.DelayMs
+	s.offsetSum += ex.OffsetMs
+	s.offsets++
+}
+
+// Stats returns a snapshot, servers with the most clients first.
+func (t *Tracker) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := Stats{
+		Servers:     make([]ServerStats, 0, len(t.servers)),
+		RecentSteps: append([]StepEvent{}, t.steps...),
+		Allowed:     append([]string{}, t.allowed...),
+	}
+	for _, s := range t.servers {
+		cp := *s
+		cp.Clients = append([]string{}, s.Clients...)
+		sort.Strings(cp.Clients)
+		cp.Allowed = t.isAllowed(s.Server)
+		if s.offsets > 0 {
+			cp.AvgOffsetMs = round(s.offsetSum / float64(s.offsets))
+		}
+		cp.OffsetMs, cp.MinOffsetMs, cp.MaxOffsetMs, cp.DelayMs = round(s.OffsetMs), round(s.MinOffsetMs), round(s.MaxOffsetMs), round(s.DelayMs)
+		out.Servers = append(out.Servers, cp)
+	}
+	sort.Slice(out.Servers, func(i, j int) bool {
+		a, b := out.Servers[i], out.Servers[j]
+		if len(a.Clients) != len(b.Clients) {
+			return len(a.Clients) > len(b.Clients)
+		}
+		return a.Server < b.Server
+	})
+	return out
+}
+
+// Reset clears the statistics but keeps the server list.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.servers = make(map[string]*ServerStats)
+	t.steps = nil
+}
+
+func round(ms float64) float64 {
+	r := math.Round(ms*1000) / 1000
+	if r == 0 {
+		return 0 // not -0
+	}
+	return r
+}
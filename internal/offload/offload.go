@@ -0,0 +1,75 @@
+// Package offload recognizes captured packets larger than the link MTU.
+// Most are not real frames: with TSO/GSO the capturing host hands the NIC
+// one large TCP segment that is split on the wire, and with GRO/LRO the
+// receiving side merges segments before the capture point sees them. Real
+// jumbo frames look the same, so the two are reported together.
+package offload
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// DefaultMTU is the Ethernet MTU assumed when none is configured.
+const DefaultMTU = 1500
+
+// Info describes an oversized packet and the wire packets it stands for.
+type Info struct {
+	IPLength int  // IP header and payload
+	TCP      bool // a TCP segment, as opposed to a jumbo datagram
+
+	// Segments estimates the packets the data takes at the MTU, and
+	// WireBytes their total frame length with the link, IP and transport
+	// headers repeated on each.
+	Segments  int
+	WireBytes int
+}
+
+// Inspect reports whether pkt's IP packet exceeds mtu, estimating how it
+// would be split: TCP into MSS-sized segments, anything else into IPv4
+// fragments (or MTU-sized pieces for IPv6).
+func Inspect(pkt gopacket.Packet, mtu int) (Info, bool) {
+	if mtu <= 0 {
+		return Info{}, false
+	}
+	var ipLen, ipHdr int
+	switch ip := pkt.NetworkLayer().(type) {
+	case *layers.IPv4:
+		ipLen, ipHdr = int(ip.Length), len(ip.Contents)
+	case *layers.IPv6:
+		ipLen, ipHdr = int(ip.Length)+40, len(ip.Contents)
+		// A jumbogram's payload length is in a hop-by-hop option
+		if ip.Length == 0 {
+			ipLen = len(ip.Contents) + len(ip.Payload)
+		}
+	default:
+		return Info{}, false
+	}
+	if ipLen <= mtu {
+		return Info{}, false
+	}
+
+	md := pkt.Metadata()
+	frameLen := md.Length
+	linkHdr := max(frameLen-ipLen, 0)
+	info := Info{IPLength: ipLen}
+
+	payload, perPiece, overhead := ipLen-ipHdr, mtu-ipHdr, linkHdr+ipHdr
+	if tcp, ok := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP); ok {
+		info.TCP = true
+		tcpHdr := len(tcp.Contents)
+		payload -= tcpHdr
+		perPiece -= tcpHdr
+		overhead += tcpHdr
+	} else if _, ok := pkt.NetworkLayer().(*layers.IPv4); ok {
+		perPiece &^= 7 // fragment offsets are in 8-byte units
+	}
+	if perPiece <= 0 || payload <= 0 {
+		info.Segments, info.WireBytes = 1, frameLen
+		return info, true
+	}
+
+	info.Segments = (payload + perPiece - 1) / perPiece
+	info.WireBytes = frameLen + (info.Segments-1)*overhead
+	return info, true
+}
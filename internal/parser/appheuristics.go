@@ -11,42 +11,115 @@ import (
 )
 
 // detectAppProtocol attempts heuristic detection of application-layer protocols
-// from raw payload data. Called from parseLayer's default case.
+// from raw payload data. Called from parseLayer's default case. A decode-as
+// rule for the packet's port stands in for the protocol's well-known port.
 func detectAppProtocol(data []byte, pkt gopacket.Packet) (models.LayerDetail, bool) {
 	if len(data) < 4 {
 		return models.LayerDetail{}, false
 	}
+	forced := decodeAsFor(pkt)
+
+	// FTP-DATA: a data connection negotiated on an FTP control connection,
+	// whatever the file it carries looks like
+	if transfer, ok := ftpData(pkt); ok {
+		return buildFTPDataLayerDetail(data, transfer), true
+	}
 
 	// SSH: payload starts with "SSH-"
 	if isSSH(data) {
 		return parseSSH(data), true
 	}
 
-	// QUIC: UDP 443 + long header bit
-	if getTransportProto(pkt) == "UDP" && portIs(pkt, 443) && isQUIC(data) {
-		return parseQUIC(data), true
+	// FTP: TCP 21 + commands or replies
+	if isFTPControl(pkt) {
+		if msgs := parseFTPMessages(data); len(msgs) > 0 {
+			return buildFTPLayerDetail(msgs), true
+		}
+	}
+
+	// SMTP, POP3, IMAP: TCP 25/587, 110, 143 + commands, replies, message
+	// content or the TLS records that follow STARTTLS
+	if detail, ok := detectMail(data, pkt); ok {
+		return detail, true
+	}
+
+	// QUIC: UDP 443 (or 853 for DNS over QUIC) + long header bit
+	if getTransportProto(pkt) == "UDP" && (forced == "QUIC" || portIsAny(pkt, 443, dnsPort853)) && isQUIC(data) {
+		return parseQUIC(data, pkt), true
 	}
 
 	// MQTT: TCP 1883/8883 + CONNECT packet signature
-	if getTransportProto(pkt) == "TCP" && portIsAny(pkt, 1883, 8883) && isMQTT(data) {
+	if getTransportProto(pkt) == "TCP" && (forced == "MQTT" || portIsAny(pkt, 1883, 8883)) && isMQTT(data) {
 		return parseMQTT(data), true
 	}
 
 	// SIP: UDP 5060 + starts with SIP method/response
-	if portIsAny(pkt, 5060, 5061) && isSIP(data) {
+	if (forced == "SIP" || portIsAny(pkt, 5060, 5061)) && isSIP(data) {
 		return parseSIP(data), true
 	}
 
 	// Modbus: TCP 502 + protocol ID 0x0000
-	if getTransportProto(pkt) == "TCP" && portIs(pkt, 502) && isModbus(data) {
+	if getTransportProto(pkt) == "TCP" && (forced == "Modbus" || portIs(pkt, 502)) && isModbus(data) {
 		return parseModbus(data), true
 	}
 
 	// RDP: TCP 3389 + TPKT version 3
-	if getTransportProto(pkt) == "TCP" && portIs(pkt, 3389) && isRDP(data) {
+	if getTransportProto(pkt) == "TCP" && (forced == "RDP" || portIs(pkt, 3389)) && isRDP(data) {
 		return parseRDP(data), true
 	}
 
+	// SMB: TCP 445/139 + NetBIOS session header + SMB magic
+	if getTransportProto(pkt) == "TCP" && (forced == "SMB" || portIsAny(pkt, 445, 139)) && isSMB(data) {
+		return parseSMB(data), true
+	}
+
+	// Kerberos: port 88, an AS/TGS/AP exchange or KRB-ERROR
+	if krb := findKerberos(data, pkt); krb != nil {
+		return buildKerberosLayerDetail(krb), true
+	}
+
+	// LDAP: ports 389/3268 + an LDAPMessage SEQUENCE
+	if isLDAPPort(pkt) {
+		if msgs := parseLDAPMessages(data); len(msgs) > 0 {
+			return buildLDAPLayerDetail(msgs), true
+		}
+	}
+
+	// mDNS/LLMNR: UDP 5353/5355 in DNS wire format
+	if dns, proto := localDNS(pkt); dns != nil {
+		return buildLocalDNSLayerDetail(dns, proto), true
+	}
+
+	// NBNS: UDP 137 + a well-formed name service packet
+	if nbns := findNBNS(pkt); nbns != nil {
+		return buildNBNSLayerDetail(nbns), true
+	}
+
+	// GTPv2-C: UDP 2123 + a version 2 header
+	if gtp := findGTPv2(pkt); gtp != nil {
+		return buildGTPv2LayerDetail(gtp), true
+	}
+
+	// SNMP: UDP 161/162 + a v1, v2c or v3 message
+	if snmp := findSNMP(pkt); snmp != nil {
+		return buildSNMPLayerDetail(snmp), true
+	}
+
+	// Syslog: UDP/TCP 514 or TCP 601 + a PRI part or a CEF header
+	if msgs := findSyslog(pkt); len(msgs) > 0 {
+		return buildSyslogLayerDetail(msgs), true
+	}
+
+	// RTP/RTCP: UDP to or from an endpoint negotiated in SDP
+	switch mediaKind(pkt, data) {
+	case "RTP":
+		h, _ := parseRTPHeader(data)
+		return buildRTPLayerDetail(h), true
+	case "RTCP":
+		pkts, _ := parseRTCP(data)
+		return buildRTCPLayerDetail(pkts), true
+	}
+
 	return models.LayerDetail{}, false
 }
 
@@ -55,26 +128,44 @@ func detectAppProtocolSummary(data []byte, pkt gopacket.Packet) (string, string)
 	if len(data) < 4 {
 		return "", ""
 	}
+	forced := decodeAsFor(pkt)
+
+	if transfer, ok := ftpData(pkt); ok {
+		return "FTP-DATA", ftpDataSummary(data, transfer)
+	}
 
 	if isSSH(data) {
 		ver := extractSSHVersion(data)
 		return "SSH", fmt.Sprintf("Version: %s", ver)
 	}
 
-	if getTransportProto(pkt) == "UDP" && portIs(pkt, 443) && isQUIC(data) {
-		return "QUIC", "QUIC Connection"
+	if isFTPControl(pkt) {
+		if msgs := parseFTPMessages(data); len(msgs) > 0 {
+			return "FTP", ftpSummary(msgs)
+		}
+	}
+
+	if proto, info := mailProtocolSummary(data, pkt); proto != "" {
+		return proto, info
 	}
 
-	if getTransportProto(pkt) == "TCP" && portIsAny(pkt, 1883, 8883) && isMQTT(data) {
+	if getTransportProto(pkt) == "UDP" && (forced == "QUIC" || portIsAny(pkt, 443, dnsPort853)) && isQUIC(data) {
+		if portIs(pkt, dnsPort853) {
+			return "DoQ", quicSummary(data, pkt)
+		}
+		return "QUIC", quicSummary(data, pkt)
+	}
+
+	if getTransportProto(pkt) == "TCP" && (forced == "MQTT" || portIsAny(pkt, 1883, 8883)) && isMQTT(data) {
 		return "MQTT", "MQTT CONNECT"
 	}
 
-	if portIsAny(pkt, 5060, 5061) && isSIP(data) {
+	if (forced == "SIP" || portIsAny(pkt, 5060, 5061)) && isSIP(data) {
 		method := sipMethod(data)
 		return "SIP", method
 	}
 
-	if getTransportProto(pkt) == "TCP" && portIs(pkt, 502) && isModbus(data) {
+	if getTransportProto(pkt) == "TCP" && (forced == "Modbus" || portIs(pkt, 502)) && isModbus(data) {
 		if len(data) >= 8 {
 			fc := data[7]
 			return "Modbus", fmt.Sprintf("Function Code %d", fc)
@@ -82,10 +173,61 @@ func detectAppProtocolSummary(data []byte, pkt gopacket.Packet) (string, string)
 		return "Modbus", "Modbus/TCP"
 	}
 
-	if getTransportProto(pkt) == "TCP" && portIs(pkt, 3389) && isRDP(data) {
+	if getTransportProto(pkt) == "TCP" && (forced == "RDP" || portIs(pkt, 3389)) && isRDP(data) {
 		return "RDP", "TPKT/RDP Connection"
 	}
 
+	if getTransportProto(pkt) == "TCP" && (forced == "SMB" || portIsAny(pkt, 445, 139)) && isSMB(data) {
+		proto, info := smbSummary(data)
+		if ntlm := findNTLM(data); ntlm != nil {
+			info += ", " + ntlm.Summary()
+		}
+		return proto, info
+	}
+
+	if krb := findKerberos(data, pkt); krb != nil {
+		return "Kerberos", krb.Summary()
+	}
+
+	if isLDAPPort(pkt) {
+		if msgs := parseLDAPMessages(data); len(msgs) > 0 {
+			return "LDAP", ldapSummary(msgs)
+		}
+	}
+
+	if dns, proto := localDNS(pkt); dns != nil {
+		return proto, localDNSSummary(dns)
+	}
+
+	if nbns := findNBNS(pkt); nbns != nil {
+		return "NBNS", nbns.Summary()
+	}
+
+	if gtp := findGTPv2(pkt); gtp != nil {
+		return "GTPv2", gtp.Summary()
+	}
+
+	if snmp := findSNMP(pkt); snmp != nil {
+		return "SNMP", snmp.Summary()
+	}
+
+	if msgs := findSyslog(pkt); len(msgs) > 0 {
+		parts := make([]string, len(msgs))
+		for i, m := range msgs {
+			parts[i] = m.Summary()
+		}
+		return "Syslog", strings.Join(parts, ", ")
+	}
+
+	switch mediaKind(pkt, data) {
+	case "RTP":
+		h, _ := parseRTPHeader(data)
+		return "RTP", rtpSummary(h)
+	case "RTCP":
+		pkts, _ := parseRTCP(data)
+		return "RTCP", rtcpSummary(pkts)
+	}
+
 	return "", ""
 }
 
@@ -110,14 +252,15 @@ func extractSSHVersion(data []byte) string {
 func parseSSH(data []byte) models.LayerDetail {
 	version := extractSSHVersion(data)
 	fields := []models.LayerField{
-		{Name: "Version String", Value: version},
+		{Name: "Version String", Value: version, Offset: 0, Length: len(version)},
 	}
 
 	// Parse "SSH-2.0-OpenSSH_8.9" format
 	parts := strings.SplitN(version, "-", 3)
 	if len(parts) >= 3 {
-		fields = append(fields, models.LayerField{Name: "Protocol Version", Value: parts[0] + "-" + parts[1]})
-		fields = append(fields, models.LayerField{Name: "Software", Value: parts[2]})
+		proto := parts[0] + "-" + parts[1]
+		fields = append(fields, models.LayerField{Name: "Protocol Version", Value: proto, Offset: 0, Length: len(proto)})
+		fields = append(fields, models.LayerField{Name: "Software", Value: parts[2], Offset: len(proto) + 1, Length: len(parts[2])})
 	}
 
 	return models.LayerDetail{Name: "SSH", Fields: fields}
@@ -130,36 +273,6 @@ func isQUIC(data []byte) bool {
 	return len(data) >= 5 && (data[0]&0x80) != 0
 }
 
-func parseQUIC(data []byte) models.LayerDetail {
-	fields := []models.LayerField{
-		{Name: "Header Form", Value: "Long Header"},
-	}
-
-	if len(data) >= 5 {
-		version := bytesToUint32BE(data[1:5])
-		fields = append(fields, models.LayerField{
-			Name:  "Version",
-			Value: quicVersionString(version),
-		})
-	}
-
-	if len(data) >= 6 {
-		dcidLen := int(data[5])
-		fields = append(fields, models.LayerField{
-			Name:  "DCID Length",
-			Value: fmt.Sprintf("%d", dcidLen),
-		})
-		if dcidLen > 0 && len(data) >= 6+dcidLen {
-			fields = append(fields, models.LayerField{
-				Name:  "Destination CID",
-				Value: hexDCID(data, 6, dcidLen),
-			})
-		}
-	}
-
-	return models.LayerDetail{Name: "QUIC", Fields: fields}
-}
-
 // ==================== MQTT Detection ====================
 
 func isMQTT(data []byte) bool {
@@ -175,7 +288,7 @@ func isMQTT(data []byte) bool {
 
 func parseMQTT(data []byte) models.LayerDetail {
 	fields := []models.LayerField{
-		{Name: "Packet Type", Value: "CONNECT"},
+		{Name: "Packet Type", Value: "CONNECT", Offset: 0, Length: 1},
 	}
 
 	// Find "MQTT" to get protocol level
@@ -183,8 +296,10 @@ func parseMQTT(data []byte) models.LayerDetail {
 	if idx >= 0 && idx+5 < len(data) {
 		level := data[idx+4]
 		fields = append(fields, models.LayerField{
-			Name:  "Protocol Level",
-			Value: fmt.Sprintf("%d", level),
+			Name:   "Protocol Level",
+			Value:  fmt.Sprintf("%d", level),
+			Offset: idx + 4,
+			Length: 1,
 		})
 		if idx+6 < len(data) {
 			flags := data[idx+5]
@@ -202,8 +317,10 @@ func parseMQTT(data []byte) models.LayerDetail {
 				flagParts = append(flagParts, "Clean Session")
 			}
 			fields = append(fields, models.LayerField{
-				Name:  "Connect Flags",
-				Value: fmt.Sprintf("0x%02x [%s]", flags, strings.Join(flagParts, ", ")),
+				Name:   "Connect Flags",
+				Value:  fmt.Sprintf("0x%02x [%s]", flags, strings.Join(flagParts, ", ")),
+				Offset: idx + 5,
+				Length: 1,
 			})
 		}
 	}
@@ -265,6 +382,12 @@ func parseSIP(data []byte) models.LayerDetail {
 		fields = append(fields, models.LayerField{Name: "To", Value: to})
 	}
 
+	if m := parseSIPMessage(data); m.SDP != nil {
+		for _, md := range m.SDP.Media {
+			fields = append(fields, models.LayerField{Name: "SDP Media", Value: sdpMediaString(md)})
+		}
+	}
+
 	return models.LayerDetail{Name: "SIP", Fields: fields}
 }
 
@@ -284,31 +407,39 @@ func parseModbus(data []byte) models.LayerDetail {
 	if len(data) >= 2 {
 		txnID := bytesToUint16BE(data[0:2])
 		fields = append(fields, models.LayerField{
-			Name:  "Transaction ID",
-			Value: fmt.Sprintf("0x%04x", txnID),
+			Name:   "Transaction ID",
+			Value:  fmt.Sprintf("0x%04x", txnID),
+			Offset: 0,
+			Length: 2,
 		})
 	}
 
 	if len(data) >= 4 {
 		fields = append(fields, models.LayerField{
-			Name:  "Protocol ID",
-			Value: fmt.Sprintf("0x%04x", bytesToUint16BE(data[2:4])),
+			Name:   "Protocol ID",
+			Value:  fmt.Sprintf("0x%04x", bytesToUint16BE(data[2:4])),
+			Offset: 2,
+			Length: 2,
 		})
 	}
 
 	if len(data) >= 6 {
 		length := bytesToUint16BE(data[4:6])
 		fields = append(fields, models.LayerField{
-			Name:  "Length",
-			Value: fmt.Sprintf("%d", length),
+			Name:   "Length",
+			Value:  fmt.Sprintf("%d", length),
+			Offset: 4,
+			Length: 2,
 		})
 	}
 
 	if len(data) >= 7 {
 		unitID := data[6]
 		fields = append(fields, models.LayerField{
-			Name:  "Unit ID",
-			Value: fmt.Sprintf("%d", unitID),
+			Name:   "Unit ID",
+			Value:  fmt.Sprintf("%d", unitID),
+			Offset: 6,
+			Length: 1,
 		})
 	}
 
@@ -316,8 +447,10 @@ func parseModbus(data []byte) models.LayerDetail {
 		fc := data[7]
 		fcName := modbusFunction(fc)
 		fields = append(fields, models.LayerField{
-			Name:  "Function Code",
-			Value: fmt.Sprintf("%d (%s)", fc, fcName),
+			Name:   "Function Code",
+			Value:  fmt.Sprintf("%d (%s)", fc, fcName),
+			Offset: 7,
+			Length: 1,
 		})
 	}
 
@@ -356,21 +489,25 @@ func isRDP(data []byte) bool {
 
 func parseRDP(data []byte) models.LayerDetail {
 	fields := []models.LayerField{
-		{Name: "TPKT Version", Value: fmt.Sprintf("%d", data[0])},
+		{Name: "TPKT Version", Value: fmt.Sprintf("%d", data[0]), Offset: 0, Length: 1},
 	}
 
 	if len(data) >= 4 {
 		length := bytesToUint16BE(data[2:4])
 		fields = append(fields, models.LayerField{
-			Name:  "TPKT Length",
-			Value: fmt.Sprintf("%d", length),
+			Name:   "TPKT Length",
+			Value:  fmt.Sprintf("%d", length),
+			Offset: 2,
+			Length: 2,
 		})
 	}
 
 	if len(data) >= 5 {
 		fields = append(fields, models.LayerField{
-			Name:  "X.224 Length",
-			Value: fmt.Sprintf("%d", data[4]),
+			Name:   "X.224 Length",
+			Value:  fmt.Sprintf("%d", data[4]),
+			Offset: 4,
+			Length: 1,
 		})
 	}
 
@@ -389,10 +526,93 @@ func parseRDP(data []byte) models.LayerDetail {
 			pduType = fmt.Sprintf("0x%02x", data[5])
 		}
 		fields = append(fields, models.LayerField{
-			Name:  "X.224 PDU Type",
-			Value: pduType,
+			Name:   "X.224 PDU Type",
+			Value:  pduType,
+			Offset: 5,
+			Length: 1,
 		})
 	}
 
 	return models.LayerDetail{Name: "RDP", Fields: fields}
 }
+
+// ==================== SMB Detection ====================
+
+func isSMB(data []byte) bool {
+	// NetBIOS session message (type 0x00) followed by \xFESMB or \xFFSMB
+	if len(data) < 8 || data[0] != 0x00 {
+		return false
+	}
+	return bytes.Equal(data[5:8], []byte("SMB")) && (data[4] == 0xfe || data[4] == 0xff)
+}
+
+func smbSummary(data []byte) (string, string) {
+	if data[4] == 0xff {
+		if len(data) >= 9 {
+			return "SMB", fmt.Sprintf("SMB1 Command 0x%02x", data[8])
+		}
+		return "SMB", "SMB1"
+	}
+	if len(data) < 4+20 {
+		return "SMB2", "SMB2"
+	}
+	hdr := data[4:]
+	cmd := uint16(hdr[12]) | uint16(hdr[13])<<8
+	flags := uint32(hdr[16]) | uint32(hdr[17])<<8 | uint32(hdr[18])<<16 | uint32(hdr[19])<<24
+	dir := "Request"
+	if flags&0x1 != 0 {
+		dir = "Response"
+	}
+	return "SMB2", smb2Command(cmd) + " " + dir
+}
+
+func parseSMB(data []byte) models.LayerDetail {
+	fields := []models.LayerField{
+		{Name: "NetBIOS Length", Value: fmt.Sprintf("%d", int(data[1])<<16|int(data[2])<<8|int(data[3])), Offset: 1, Length: 3},
+	}
+	// The SMB header follows the 4-byte NetBIOS session header; its
+	// protocol ID tells the dialect
+	if data[4] == 0xff {
+		fields = append(fields, models.LayerField{Name: "Dialect", Value: "SMB1", Offset: 4, Length: 4})
+		if len(data) >= 9 {
+			fields = append(fields, models.LayerField{Name: "Command", Value: fmt.Sprintf("0x%02x", data[8]), Offset: 8, Length: 1})
+		}
+		return models.LayerDetail{Name: "SMB", Fields: fields}
+	}
+
+	fields = append(fields, models.LayerField{Name: "Dialect", Value: "SMB2/3", Offset: 4, Length: 4})
+	if len(data) >= 4+48 {
+		hdr := data[4:]
+		cmd := uint16(hdr[12]) | uint16(hdr[13])<<8
+		status := uint32(hdr[8]) | uint32(hdr[9])<<8 | uint32(hdr[10])<<16 | uint32(hdr[11])<<24
+		flags := uint32(hdr[16]) | uint32(hdr[17])<<8 | uint32(hdr[18])<<16 | uint32(hdr[19])<<24
+		msgID := uint64(0)
+		for i := 7; i >= 0; i-- {
+			msgID = msgID<<8 | uint64(hdr[24+i])
+		}
+		sessionID := uint64(0)
+		for i := 7; i >= 0; i-- {
+			sessionID = sessionID<<8 | uint64(hdr[40+i])
+		}
+		fields = append(fields,
+			models.LayerField{Name: "Command", Value: fmt.Sprintf("%s (%d)", smb2Command(cmd), cmd), Offset: 4 + 12, Length: 2},
+			models.LayerField{Name: "Status", Value: fmt.Sprintf("0x%08x", status), Offset: 4 + 8, Length: 4},
+			models.LayerField{Name: "Flags", Value: fmt.Sprintf("0x%08x (%s)", flags, boolToStr(flags&0x1 != 0, "Response", "Request")), Offset: 4 + 16, Length: 4},
+			models.LayerField{Name: "Message ID", Value: fmt.Sprintf("%d", msgID), Offset: 4 + 24, Length: 8},
+			models.LayerField{Name: "Session ID", Value: fmt.Sprintf("0x%016x", sessionID), Offset: 4 + 40, Length: 8},
+		)
+	}
+	return models.LayerDetail{Name: "SMB2", Fields: fields}
+}
+
+func smb2Command(cmd uint16) string {
+	names := []string{
+		"Negotiate", "Session Setup", "Logoff", "Tree Connect", "Tree Disconnect",
+		"Create", "Close", "Flush", "Read", "Write", "Lock", "IOCTL", "Cancel",
+		"Echo", "Query Directory", "Change Notify", "Query Info", "Set Info", "Oplock Break",
+	}
+	if int(cmd) < len(names) {
+		return names[cmd]
+	}
+	return fmt.Sprintf("Command 0x%04x", cmd)
+}
@@ -0,0 +1,117 @@
+package parser
+
+// BER element classes.
+const (
+	berUniversal   = 0
+	berApplication = 1
+	berContext     = 2
+)
+
+// berTLV is one BER-encoded element. Kerberos and LDAP use context and
+// application tags throughout, which encoding/asn1 can only decode into
+// structs declared up front, so they are walked element by element.
+type berTLV struct {
+	Class       int
+	Constructed bool
+	Tag         int
+	Value       []byte
+	Raw         []byte // the whole element, header included
+}
+
+// readBER reads one element from b. Indefinite lengths are not supported.
+func readBER(b []byte) (t berTLV, rest []byte, ok bool) {
+	if len(b) < 2 {
+		return t, nil, false
+	}
+	t.Class = int(b[0] >> 6)
+	t.Constructed = b[0]&0x20 != 0
+	t.Tag = int(b[0] & 0x1f)
+	i := 1
+	if t.Tag == 0x1f {
+		t.Tag = 0
+		for ; ; i++ {
+			if i >= len(b) || i > 4 {
+				return t, nil, false
+			}
+			t.Tag = t.Tag<<7 | int(b[i]&0x7f)
+			if b[i]&0x80 == 0 {
+				i++
+				break
+			}
+		}
+	}
+	if i >= len(b) {
+		return t, nil, false
+	}
+	n := int(b[i])
+	i++
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 4 || i+size > len(b) {
+			return t, nil, false
+		}
+		n = 0
+		for _, c := range b[i : i+size] {
+			n = n<<8 | int(c)
+		}
+		i += size
+	}
+	if n < 0 || n > len(b)-i {
+		return t, nil, false
+	}
+	t.Value = b[i : i+n]
+	t.Raw = b[:i+n]
+	return t, b[i+n:], true
+}
+
+// berChildren splits the value of a constructed element into its elements,
+// stopping at the first that does not parse.
+func berChildren(v []byte) []berTLV {
+	var out []berTLV
+	for len(v) > 0 {
+		t, rest, ok := readBER(v)
+		if !ok {
+			break
+		}
+		out = append(out, t)
+		v = rest
+	}
+	return out
+}
+
+// berFields maps the context tags of a SEQUENCE's elements to the element
+// inside each explicit tag, as Kerberos encodes every field.
+func berFields(v []byte) map[int]berTLV {
+	out := make(map[int]berTLV)
+	for _, t := range berChildren(v) {
+		if t.Class != berContext {
+			continue
+		}
+		if inner, _, ok := readBER(t.Value); ok {
+			out[t.Tag] = inner
+		}
+	}
+	return out
+}
+
+// berInt decodes a two's complement INTEGER or ENUMERATED value.
+func berInt(v []byte) int64 {
+	if len(v) == 0 || len(v) > 8 {
+		return 0
+	}
+	n := int64(int8(v[0]))
+	for _, c := range v[1:] {
+		n = n<<8 | int64(c)
+	}
+	return n
+}
+
+// berElements returns the elements inside the single constructed element
+// raw, such as a SEQUENCE kept as asn1.RawContent.
+func berElements(raw []byte) []berTLV {
+	t, _, ok := readBER(raw)
+	if !ok {
+		return nil
+	}
+	return berChildren(t.Value)
+}
@@ -0,0 +1,202 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// DecodeAsRule dissects traffic on a nonstandard port as a protocol, like
+// Wireshark's Decode As. It takes precedence over the port heuristics.
+type DecodeAsRule struct {
+	Transport string `json:"transport"` // TCP or UDP
+	Port      uint16 `json:"port"`
+	Protocol  string `json:"protocol"`
+}
+
+// String formats the rule as "TCP 8883 → MQTT".
+func (r DecodeAsRule) String() string {
+	return fmt.Sprintf("%s %d → %s", r.Transport, r.Port, r.Protocol)
+}
+
+// decodeAsProtocols lists the protocols a port can be decoded as and the
+// transports each runs over. DNS is decoded by gopacket, which picks UDP
+// payload decoders by port; the rest by the payload heuristics with their
+// port check lifted.
+var decodeAsProtocols = map[string][]string{
+	"DNS":      {"UDP"},
+	"HTTP":     {"TCP"},
+	"FTP":      {"TCP"},
+	"SSH":      {"TCP"},
+	"SMTP":     {"TCP"},
+	"POP3":     {"TCP"},
+	"IMAP":     {"TCP"},
+	"QUIC":     {"UDP"},
+	"MQTT":     {"TCP"},
+	"SIP":      {"TCP", "UDP"},
+	"Modbus":   {"TCP"},
+	"RDP":      {"TCP"},
+	"SMB":      {"TCP"},
+	"Kerberos": {"TCP", "UDP"},
+	"LDAP":     {"TCP", "UDP"},
+	"mDNS":     {"UDP"},
+	"LLMNR":    {"UDP"},
+	"NBNS":     {"UDP"},
+	"GTPv2":    {"UDP"},
+	"SNMP":     {"UDP"},
+	"Syslog":   {"TCP", "UDP"},
+	"RTP":      {"UDP"},
+	"RTCP":     {"UDP"},
+}
+
+// DecodeAsProtocols returns the protocols a decode-as rule may name.
+func DecodeAsProtocols() []string {
+	out := make([]string, 0, len(decodeAsProtocols))
+	for p := range decodeAsProtocols {
+		out = append(out, p)
+	}
+	slices.Sort(out)
+	return out
+}
+
+var decodeAs = struct {
+	sync.RWMutex
+	rules []DecodeAsRule
+	tcp   map[uint16]string
+	udp   map[uint16]string
+	// gopacket's own mapping of the UDP ports the rules took over
+	orig map[uint16]gopacket.LayerType
+}{
+	tcp:  map[uint16]string{},
+	udp:  map[uint16]string{},
+	orig: map[uint16]gopacket.LayerType{},
+}
+
+// normalize canonicalizes the transport and protocol names and checks that
+// the protocol runs over the transport.
+func (r *DecodeAsRule) normalize() error {
+	r.Transport = strings.ToUpper(strings.TrimSpace(r.Transport))
+	if r.Transport != "TCP" && r.Transport != "UDP" {
+		return fmt.Errorf("transport must be TCP or UDP, not %q", r.Transport)
+	}
+	if r.Port == 0 {
+		return fmt.Errorf("decode-as rule needs a port")
+	}
+	for name, transports := range decodeAsProtocols {
+		if strings.EqualFold(name, strings.TrimSpace(r.Protocol)) {
+			r.Protocol = name
+			if !slices.Contains(transports, r.Transport) {
+				return fmt.Errorf("%s does not run over %s", name, r.Transport)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot decode as %q; supported: %s", r.Protocol, strings.Join(DecodeAsProtocols(), ", "))
+}
+
+// CheckDecodeAs returns rules with their transport and protocol names
+// canonicalized, or an error for a rule SetDecodeAs would refuse.
+func CheckDecodeAs(rules []DecodeAsRule) ([]DecodeAsRule, error) {
+	norm, _, _, err := checkDecodeAs(rules)
+	return norm, err
+}
+
+func checkDecodeAs(rules []DecodeAsRule) (norm []DecodeAsRule, tcp, udp map[uint16]string, err error) {
+	tcp, udp = map[uint16]string{}, map[uint16]string{}
+	norm = make([]DecodeAsRule, len(rules))
+	for i, r := range rules {
+		if err := r.normalize(); err != nil {
+			return nil, nil, nil, err
+		}
+		m := tcp
+		if r.Transport == "UDP" {
+			m = udp
+		}
+		if _, dup := m[r.Port]; dup {
+			return nil, nil, nil, fmt.Errorf("%s port %d has two decode-as rules", r.Transport, r.Port)
+		}
+		m[r.Port] = r.Protocol
+		norm[i] = r
+	}
+	return norm, tcp, udp, nil
+}
+
+// SetDecodeAs replaces the decode-as table. Ports named twice for the same
+// transport are an error. Packets decoded from then on use the new table.
+func SetDecodeAs(rules []DecodeAsRule) error {
+	norm, tcp, udp, err := checkDecodeAs(rules)
+	if err != nil {
+		return err
+	}
+
+	decodeAs.Lock()
+	defer decodeAs.Unlock()
+
+	// Give gopacket's port mapping back before applying the new table.
+	// TCP payloads are always left undecoded, so only UDP ports matter.
+	for port, lt := range decodeAs.orig {
+		layers.RegisterUDPPortLayerType(layers.UDPPort(port), lt)
+	}
+	decodeAs.orig = map[uint16]gopacket.LayerType{}
+	for port, proto := range udp {
+		decodeAs.orig[port] = layers.UDPPort(port).LayerType()
+		layers.RegisterUDPPortLayerType(layers.UDPPort(port), decodeAsLayerType(proto))
+	}
+	decodeAs.rules, decodeAs.tcp, decodeAs.udp = norm, tcp, udp
+	return nil
+}
+
+// decodeAsLayerType is what gopacket should decode a UDP port's payload
+// as: DNS, or a plain payload left to the heuristics.
+func decodeAsLayerType(proto string) gopacket.LayerType {
+	if proto == "DNS" {
+		return layers.LayerTypeDNS
+	}
+	return gopacket.LayerTypePayload
+}
+
+// DecodeAs returns the decode-as table.
+func DecodeAs() []DecodeAsRule {
+	decodeAs.RLock()
+	defer decodeAs.RUnlock()
+	return slices.Clone(decodeAs.rules)
+}
+
+// DecodeAsPort returns the protocol a rule assigns to a TCP or UDP port,
+// or "".
+func DecodeAsPort(transport string, port uint16) string {
+	decodeAs.RLock()
+	defer decodeAs.RUnlock()
+	if transport == "UDP" {
+		return decodeAs.udp[port]
+	}
+	return decodeAs.tcp[port]
+}
+
+// decodeAsFor returns the protocol a rule assigns to pkt's ports, the
+// destination port first, or "" if none does.
+func decodeAsFor(pkt gopacket.Packet) string {
+	decodeAs.RLock()
+	defer decodeAs.RUnlock()
+
+	var m map[uint16]string
+	var src, dst uint16
+	if l := pkt.Layer(layers.LayerTypeTCP); l != nil {
+		tcp := l.(*layers.TCP)
+		m, src, dst = decodeAs.tcp, uint16(tcp.SrcPort), uint16(tcp.DstPort)
+	} else if l := pkt.Layer(layers.LayerTypeUDP); l != nil {
+		udp := l.(*layers.UDP)
+		m, src, dst = decodeAs.udp, uint16(udp.SrcPort), uint16(udp.DstPort)
+	}
+	if len(m) == 0 {
+		return ""
+	}
+	if p, ok := m[dst]; ok {
+		return p
+	}
+	return m[src]
+}
@@ -0,0 +1,423 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+// DHCPv6 option codes (RFC 8415, RFC 3646, RFC 4704).
+const (
+	dhcpv6OptClientID     = 1
+	dhcpv6OptServerID     = 2
+	dhcpv6OptIANA         = 3
+	dhcpv6OptIATA         = 4
+	dhcpv6OptIAAddr       = 5
+	dhcpv6OptORO          = 6
+	dhcpv6OptPreference   = 7
+	dhcpv6OptElapsedTime  = 8
+	dhcpv6OptRelayMessage = 9
+	dhcpv6OptUnicast      = 12
+	dhcpv6OptStatusCode   = 13
+	dhcpv6OptRapidCommit  = 14
+	dhcpv6OptInterfaceID  = 18
+	dhcpv6OptDNSServers   = 23
+	dhcpv6OptDomainList   = 24
+	dhcpv6OptIAPD         = 25
+	dhcpv6OptIAPrefix     = 26
+	dhcpv6OptSNTPServers  = 31
+	dhcpv6OptRefreshTime  = 32
+	dhcpv6OptClientFQDN   = 39
+)
+
+var dhcpv6MsgTypes = map[byte]string{
+	1:  "Solicit",
+	2:  "Advertise",
+	3:  "Request",
+	4:  "Confirm",
+	5:  "Renew",
+	6:  "Rebind",
+	7:  "Reply",
+	8:  "Release",
+	9:  "Decline",
+	10: "Reconfigure",
+	11: "Information-request",
+	12: "Relay-forw",
+	13: "Relay-repl",
+}
+
+var dhcpv6OptNames = map[uint16]string{
+	dhcpv6OptClientID:     "Client Identifier",
+	dhcpv6OptServerID:     "Server Identifier",
+	dhcpv6OptIANA:         "IA_NA",
+	dhcpv6OptIATA:         "IA_TA",
+	dhcpv6OptIAAddr:       "IA Address",
+	dhcpv6OptORO:          "Option Request",
+	dhcpv6OptPreference:   "Preference",
+	dhcpv6OptElapsedTime:  "Elapsed Time",
+	dhcpv6OptRelayMessage: "Relay Message",
+	11:                    "Authentication",
+	dhcpv6OptUnicast:      "Server Unicast",
+	dhcpv6OptStatusCode:   "Status Code",
+	dhcpv6OptRapidCommit:  "Rapid Commit",
+	15:                    "User Class",
+	16:                    "Vendor Class",
+	17:                    "Vendor-specific Information",
+	dhcpv6OptInterfaceID:  "Interface-Id",
+	19:                    "Reconfigure Message",
+	20:                    "Reconfigure Accept",
+	21:                    "SIP Server Domain Names",
+	22:                    "SIP Servers",
+	dhcpv6OptDNSServers:   "DNS Recursive Name Servers",
+	dhcpv6OptDomainList:   "Domain Search List",
+	dhcpv6OptIAPD:         "IA_PD",
+	dhcpv6OptIAPrefix:     "IA Prefix",
+	dhcpv6OptSNTPServers:  "SNTP Servers",
+	dhcpv6OptRefreshTime:  "Information Refresh Time",
+	dhcpv6OptClientFQDN:   "Client FQDN",
+	56:                    "NTP Server",
+	82:                    "SOL_MAX_RT",
+	83:                    "INF_MAX_RT",
+}
+
+var dhcpv6StatusCodes = map[uint16]string{
+	0: "Success",
+	1: "UnspecFail",
+	2: "NoAddrsAvail",
+	3: "NoBinding",
+	4: "NotOnLink",
+	5: "UseMulticast",
+	6: "NoPrefixAvail",
+}
+
+// maxDHCPv6Depth caps the nesting of relayed messages and IA options.
+const maxDHCPv6Depth = 4
+
+// duidEpoch is where DUID-LLT times count from.
+var duidEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func dhcpv6MsgType(b byte) string {
+	if name, ok := dhcpv6MsgTypes[b]; ok {
+		return fmt.Sprintf("%s (%d)", name, b)
+	}
+	return fmt.Sprintf("Unknown (%d)", b)
+}
+
+func dhcpv6OptName(code uint16) string {
+	if name, ok := dhcpv6OptNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("Option %d", code)
+}
+
+func parseDHCPv6(dhcp *layers.DHCPv6) models.LayerDetail {
+	return models.LayerDetail{Name: "DHCPv6", Fields: dhcpv6MessageFields(dhcp.Contents, 0, 0)}
+}
+
+// dhcpv6MessageFields describes the message at data[off:], a client/server
+// or relay message; offsets are from the start of data.
+func dhcpv6MessageFields(data []byte, off, depth int) []models.LayerField {
+	msg := data[off:]
+	if len(msg) < 4 {
+		return nil
+	}
+	fields := []models.LayerField{{Name: "Message Type", Value: dhcpv6MsgType(msg[0]), Offset: off, Length: 1}}
+	start := off + 4
+	if msg[0] == 12 || msg[0] == 13 {
+		if len(msg) < 34 {
+			return fields
+		}
+		fields = append(fields,
+			models.LayerField{Name: "Hop Count", Value: fmt.Sprintf("%d", msg[1]), Offset: off + 1, Length: 1},
+			models.LayerField{Name: "Link Address", Value: net.IP(msg[2:18]).String(), Offset: off + 2, Length: 16},
+			models.LayerField{Name: "Peer Address", Value: net.IP(msg[18:34]).String(), Offset: off + 18, Length: 16},
+		)
+		start = off + 34
+	} else {
+		fields = append(fields, models.LayerField{Name: "Transaction ID", Value: fmt.Sprintf("0x%06x", dhcpv6XID(msg)), Offset: off + 1, Length: 3})
+	}
+	return append(fields, dhcpv6OptionFields(data, start, len(data), depth)...)
+}
+
+func dhcpv6XID(msg []byte) uint32 {
+	return uint32(msg[1])<<16 | uint32(msg[2])<<8 | uint32(msg[3])
+}
+
+// dhcpv6OptionFields describes the options in data[off:end].
+func dhcpv6OptionFields(data []byte, off, end, depth int) []models.LayerField {
+	var fields []models.LayerField
+	for off+4 <= end {
+		code := binary.BigEndian.Uint16(data[off:])
+		n := int(binary.BigEndian.Uint16(data[off+2:]))
+		if off+4+n > end {
+			fields = append(fields, models.LayerField{Name: dhcpv6OptName(code), Value: "truncated", Offset: off, Length: end - off})
+			break
+		}
+		f := models.LayerField{Name: dhcpv6OptName(code), Offset: off, Length: 4 + n}
+		f.Value, f.Children = dhcpv6OptionValue(code, data, off+4, n, depth)
+		fields = append(fields, f)
+		off += 4 + n
+	}
+	return fields
+}
+
+// dhcpv6OptionValue describes the n bytes of an option's data at
+// data[off:].
+func dhcpv6OptionValue(code uint16, data []byte, off, n, depth int) (string, []models.LayerField) {
+	d := data[off : off+n]
+	switch code {
+	case dhcpv6OptClientID, dhcpv6OptServerID:
+		return duidFields(d, off)
+	case dhcpv6OptIANA, dhcpv6OptIAPD:
+		if n < 12 || depth >= maxDHCPv6Depth {
+			break
+		}
+		children := []models.LayerField{
+			{Name: "IAID", Value: fmt.Sprintf("0x%08x", binary.BigEndian.Uint32(d)), Offset: off, Length: 4},
+			{Name: "T1", Value: dhcpv6Lifetime(binary.BigEndian.Uint32(d[4:])), Offset: off + 4, Length: 4},
+			{Name: "T2", Value: dhcpv6Lifetime(binary.BigEndian.Uint32(d[8:])), Offset: off + 8, Length: 4},
+		}
+		children = append(children, dhcpv6OptionFields(data, off+12, off+n, depth+1)...)
+		return fmt.Sprintf("IAID 0x%08x%s", binary.BigEndian.Uint32(d), iaSummary(children[3:])), children
+	case dhcpv6OptIATA:
+		if n < 4 || depth >= maxDHCPv6Depth {
+			break
+		}
+		children := []models.LayerField{{Name: "IAID", Value: fmt.Sprintf("0x%08x", binary.BigEndian.Uint32(d)), Offset: off, Length: 4}}
+		children = append(children, dhcpv6OptionFields(data, off+4, off+n, depth+1)...)
+		return fmt.Sprintf("IAID 0x%08x%s", binary.BigEndian.Uint32(d), iaSummary(children[1:])), children
+	case dhcpv6OptIAAddr:
+		if n < 24 {
+			break
+		}
+		addr := net.IP(d[:16]).String()
+		children := []models.LayerField{
+			{Name: "Address", Value: addr, Offset: off, Length: 16},
+			{Name: "Preferred Lifetime", Value: dhcpv6Lifetime(binary.BigEndian.Uint32(d[16:])), Offset: off + 16, Length: 4},
+			{Name: "Valid Lifetime", Value: dhcpv6Lifetime(binary.BigEndian.Uint32(d[20:])), Offset: off + 20, Length: 4},
+		}
+		if depth < maxDHCPv6Depth {
+			children = append(children, dhcpv6OptionFields(data, off+24, off+n, depth+1)...)
+		}
+		return addr, children
+	case dhcpv6OptIAPrefix:
+		if n < 25 {
+			break
+		}
+		prefix := fmt.Sprintf("%s/%d", net.IP(d[9:25]), d[8])
+		children := []models.LayerField{
+			{Name: "Preferred Lifetime", Value: dhcpv6Lifetime(binary.BigEndian.Uint32(d)), Offset: off, Length: 4},
+			{Name: "Valid Lifetime", Value: dhcpv6Lifetime(binary.BigEndian.Uint32(d[4:])), Offset: off + 4, Length: 4},
+			{Name: "Prefix Length", Value: fmt.Sprintf("%d", d[8]), Offset: off + 8, Length: 1},
+			{Name: "Prefix", Value: net.IP(d[9:25]).String(), Offset: off + 9, Length: 16},
+		}
+		if depth < maxDHCPv6Depth {
+			children = append(children, dhcpv6OptionFields(data, off+25, off+n, depth+1)...)
+		}
+		return prefix, children
+	case dhcpv6OptORO:
+		var names []string
+		var children []models.LayerField
+		for i := 0; i+2 <= n; i += 2 {
+			name := dhcpv6OptName(binary.BigEndian.Uint16(d[i:]))
+			names = append(names, name)
+			children = append(children, models.LayerField{Name: "Requested Option", Value: name, Offset: off + i, Length: 2})
+		}
+		return strings.Join(names, ", "), children
+	case dhcpv6OptPreference:
+		if n == 1 {
+			return fmt.Sprintf("%d", d[0]), nil
+		}
+	case dhcpv6OptElapsedTime:
+		if n == 2 {
+			// Hundredths of a second
+			return fmt.Sprintf("%d ms", int(binary.BigEndian.Uint16(d))*10), nil
+		}
+	case dhcpv6OptRelayMessage:
+		if depth < maxDHCPv6Depth && n >= 4 {
+			children := dhcpv6MessageFields(data[:off+n], off, depth+1)
+			return dhcpv6MsgType(d[0]), children
+		}
+	case dhcpv6OptUnicast:
+		if n == 16 {
+			return net.IP(d).String(), nil
+		}
+	case dhcpv6OptStatusCode:
+		if n < 2 {
+			break
+		}
+		code := binary.BigEndian.Uint16(d)
+		status, ok := dhcpv6StatusCodes[code]
+		if !ok {
+			status = fmt.Sprintf("Status %d", code)
+		}
+		if msg := strings.TrimSpace(string(d[2:])); msg != "" {
+			status += ": " + msg
+		}
+		return status, nil
+	case dhcpv6OptRapidCommit:
+		return "", nil
+	case dhcpv6OptInterfaceID:
+		return printableOrHex(d), nil
+	case dhcpv6OptDNSServers, dhcpv6OptSNTPServers, 22:
+		var addrs []string
+		var children []models.LayerField
+		for i := 0; i+16 <= n; i += 16 {
+			a := net.IP(d[i : i+16]).String()
+			addrs = append(addrs, a)
+			children = append(children, models.LayerField{Name: "Address", Value: a, Offset: off + i, Length: 16})
+		}
+		return strings.Join(addrs, ", "), children
+	case dhcpv6OptDomainList, 21:
+		return strings.Join(dnsNameList(d), ", "), nil
+	case dhcpv6OptRefreshTime, 82, 83:
+		if n == 4 {
+			return dhcpv6Lifetime(binary.BigEndian.Uint32(d)), nil
+		}
+	case dhcpv6OptClientFQDN:
+		if n >= 1 {
+			name := strings.Join(dnsNameList(d[1:]), ", ")
+			return fmt.Sprintf("%s (flags 0x%02x)", name, d[0]), nil
+		}
+	}
+	return fmt.Sprintf("%d bytes", n), nil
+}
+
+// iaSummary lists the addresses and prefixes an IA carries, and its
+// status if it is not a success.
+func iaSummary(opts []models.LayerField) string {
+	var parts []string
+	for _, o := range opts {
+		switch o.Name {
+		case "IA Address", "IA Prefix":
+			parts = append(parts, o.Value)
+		case "Status Code":
+			if !strings.HasPrefix(o.Value, "Success") {
+				parts = append(parts, o.Value)
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return ": " + strings.Join(parts, ", ")
+}
+
+// duidFields describes a DHCP Unique Identifier (RFC 8415 section 11).
+func duidFields(d []byte, off int) (string, []models.LayerField) {
+	if len(d) < 2 {
+		return fmt.Sprintf("%x", d), nil
+	}
+	typ := binary.BigEndian.Uint16(d)
+	children := []models.LayerField{{Name: "DUID Type", Offset: off, Length: 2}}
+	var summary string
+	switch {
+	case typ == 1 && len(d) >= 8:
+		children[0].Value = "Link-layer address plus time (1)"
+		t := duidEpoch.Add(time.Duration(binary.BigEndian.Uint32(d[4:])) * time.Second)
+		mac := net.HardwareAddr(d[8:]).String()
+		children = append(children,
+			models.LayerField{Name: "Hardware Type", Value: fmt.Sprintf("%d", binary.BigEndian.Uint16(d[2:])), Offset: off + 2, Length: 2},
+			models.LayerField{Name: "Time", Value: t.Format(time.RFC3339), Offset: off + 4, Length: 4},
+			models.LayerField{Name: "Link-layer Address", Value: mac, Offset: off + 8, Length: len(d) - 8},
+		)
+		summary = "DUID-LLT " + mac
+	case typ == 2 && len(d) >= 6:
+		children[0].Value = "Vendor-assigned (2)"
+		ent := binary.BigEndian.Uint32(d[2:])
+		children = append(children,
+			models.LayerField{Name: "Enterprise Number", Value: fmt.Sprintf("%d", ent), Offset: off + 2, Length: 4},
+			models.LayerField{Name: "Identifier", Value: fmt.Sprintf("%x", d[6:]), Offset: off + 6, Length: len(d) - 6},
+		)
+		summary = fmt.Sprintf("DUID-EN %d %x", ent, d[6:])
+	case typ == 3 && len(d) >= 4:
+		children[0].Value = "Link-layer address (3)"
+		mac := net.HardwareAddr(d[4:]).String()
+		children = append(children,
+			models.LayerField{Name: "Hardware Type", Value: fmt.Sprintf("%d", binary.BigEndian.Uint16(d[2:])), Offset: off + 2, Length: 2},
+			models.LayerField{Name: "Link-layer Address", Value: mac, Offset: off + 4, Length: len(d) - 4},
+		)
+		summary = "DUID-LL " + mac
+	case typ == 4 && len(d) == 18:
+		children[0].Value = "UUID (4)"
+		u := d[2:]
+		uuid := fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+		children = append(children, models.LayerField{Name: "UUID", Value: uuid, Offset: off + 2, Length: 16})
+		summary = "DUID-UUID " + uuid
+	default:
+		children[0].Value = fmt.Sprintf("%d", typ)
+		summary = fmt.Sprintf("%x", d)
+	}
+	return summary, children
+}
+
+// dhcpv6Lifetime formats a lifetime or timer in seconds; all ones means
+// infinity.
+func dhcpv6Lifetime(s uint32) string {
+	if s == 0xffffffff {
+		return "infinity"
+	}
+	return fmt.Sprintf("%d s", s)
+}
+
+// dnsNameList decodes uncompressed DNS names packed one after another, as
+// in DHCPv6 domain options and NDP DNSSL options. Zero padding after the
+// last name is skipped.
+func dnsNameList(d []byte) []string {
+	var names []string
+	var labels []string
+	for i := 0; i < len(d); {
+		n := int(d[i])
+		i++
+		if n == 0 {
+			if len(labels) > 0 {
+				names = append(names, strings.Join(labels, "."))
+			}
+			labels = labels[:0]
+			continue
+		}
+		if i+n > len(d) {
+			break
+		}
+		labels = append(labels, string(d[i:i+n]))
+		i += n
+	}
+	if len(labels) > 0 {
+		names = append(names, strings.Join(labels, "."))
+	}
+	return names
+}
+
+// printableOrHex returns b as text if it is printable ASCII, in hex
+// otherwise.
+func printableOrHex(b []byte) string {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return fmt.Sprintf("%x", b)
+		}
+	}
+	return string(b)
+}
+
+// dhcpv6Summary returns the DHCPv6 message type and, for client/server
+// messages, the transaction ID or, for relayed ones, the client's address.
+func dhcpv6Summary(dhcp *layers.DHCPv6) (msgType, id string) {
+	data := dhcp.Contents
+	if len(data) < 4 {
+		return "Unknown", ""
+	}
+	msgType = dhcpv6MsgType(data[0])
+	if data[0] == 12 || data[0] == 13 {
+		if len(data) >= 34 {
+			id = net.IP(data[18:34]).String()
+		}
+		return msgType, id
+	}
+	return msgType, fmt.Sprintf("0x%06x", dhcpv6XID(data))
+}
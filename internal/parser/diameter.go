@@ -0,0 +1,246 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"unicode/utf8"
+
+	"sniffox/internal/models"
+)
+
+var diameterCommands = map[uint32]string{
+	257: "Capabilities-Exchange",
+	258: "Re-Auth",
+	271: "Accounting",
+	272: "Credit-Control",
+	274: "Abort-Session",
+	275: "Session-Termination",
+	280: "Device-Watchdog",
+	282: "Disconnect-Peer",
+	316: "Update-Location",
+	317: "Cancel-Location",
+	318: "Authentication-Information",
+	319: "Insert-Subscriber-Data",
+	320: "Delete-Subscriber-Data",
+	321: "Purge-UE",
+	323: "Notify",
+}
+
+type diameterAVPType int
+
+const (
+	avpOctets diameterAVPType = iota
+	avpUTF8
+	avpUint32
+	avpUint64
+	avpAddress
+	avpGrouped
+)
+
+var diameterAVPs = map[uint32]struct {
+	name string
+	typ  diameterAVPType
+}{
+	1:   {"User-Name", avpUTF8},
+	25:  {"Class", avpOctets},
+	257: {"Host-IP-Address", avpAddress},
+	258: {"Auth-Application-Id", avpUint32},
+	259: {"Acct-Application-Id", avpUint32},
+	260: {"Vendor-Specific-Application-Id", avpGrouped},
+	263: {"Session-Id", avpUTF8},
+	264: {"Origin-Host", avpUTF8},
+	265: {"Supported-Vendor-Id", avpUint32},
+	266: {"Vendor-Id", avpUint32},
+	267: {"Firmware-Revision", avpUint32},
+	268: {"Result-Code", avpUint32},
+	269: {"Product-Name", avpUTF8},
+	273: {"Disconnect-Cause", avpUint32},
+	277: {"Auth-Session-State", avpUint32},
+	278: {"Origin-State-Id", avpUint32},
+	279: {"Failed-AVP", avpGrouped},
+	281: {"Error-Message", avpUTF8},
+	283: {"Destination-Realm", avpUTF8},
+	285: {"Re-Auth-Request-Type", avpUint32},
+	293: {"Destination-Host", avpUTF8},
+	295: {"Termination-Cause", avpUint32},
+	296: {"Origin-Realm", avpUTF8},
+	297: {"Experimental-Result", avpGrouped},
+	298: {"Experimental-Result-Code", avpUint32},
+	415: {"CC-Request-Number", avpUint32},
+	416: {"CC-Request-Type", avpUint32},
+	443: {"Subscription-Id", avpGrouped},
+	444: {"Subscription-Id-Data", avpUTF8},
+	450: {"Subscription-Id-Type", avpUint32},
+	480: {"Accounting-Record-Type", avpUint32},
+	485: {"Accounting-Record-Number", avpUint32},
+}
+
+// DiameterAVP is one attribute-value pair of a Diameter message.
+type DiameterAVP struct {
+	Code     uint32
+	Vendor   uint32 // 0 when the V flag is clear
+	Flags    uint8
+	Value    []byte
+	Children []DiameterAVP // grouped AVPs
+	at       span          // the whole AVP, in the message
+}
+
+// DiameterMessage is a decoded Diameter message (RFC 6733).
+type DiameterMessage struct {
+	Flags      uint8
+	Command    uint32
+	AppID      uint32
+	HopByHop   uint32
+	EndToEnd   uint32
+	AVPs       []DiameterAVP
+	ResultCode uint32 // 0 when absent
+}
+
+// IsRequest reports whether the R flag is set.
+func (m *DiameterMessage) IsRequest() bool {
+	return m.Flags&0x80 != 0
+}
+
+// CommandName returns e.g. "Capabilities-Exchange Request".
+func (m *DiameterMessage) CommandName() string {
+	name, ok := diameterCommands[m.Command]
+	if !ok {
+		name = fmt.Sprintf("Command %d", m.Command)
+	}
+	if m.IsRequest() {
+		return name + " Request"
+	}
+	return name + " Answer"
+}
+
+// Summary is a one-line description for the info column.
+func (m *DiameterMessage) Summary() string {
+	s := m.CommandName()
+	if m.ResultCode != 0 {
+		s += fmt.Sprintf(", Result-Code %d", m.ResultCode)
+	}
+	return s
+}
+
+// parseDiameter decodes a Diameter message, or returns nil.
+func parseDiameter(data []byte) *DiameterMessage {
+	if len(data) < 20 || data[0] != 1 {
+		return nil
+	}
+	length := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	if length < 20 || length > len(data) {
+		return nil
+	}
+	m := &DiameterMessage{
+		Flags:    data[4],
+		Command:  uint32(data[5])<<16 | uint32(data[6])<<8 | uint32(data[7]),
+		AppID:    binary.BigEndian.Uint32(data[8:12]),
+		HopByHop: binary.BigEndian.Uint32(data[12:16]),
+		EndToEnd: binary.BigEndian.Uint32(data[16:20]),
+	}
+	m.AVPs = parseDiameterAVPs(data[20:length], 20, 0)
+	for _, a := range m.AVPs {
+		if a.Code == 268 && a.Vendor == 0 && len(a.Value) == 4 {
+			m.ResultCode = binary.BigEndian.Uint32(a.Value)
+		}
+		// 3GPP applications report errors in Experimental-Result
+		if a.Code == 297 && m.ResultCode == 0 {
+			for _, c := range a.Children {
+				if c.Code == 298 && len(c.Value) == 4 {
+					m.ResultCode = binary.BigEndian.Uint32(c.Value)
+				}
+			}
+		}
+	}
+	return m
+}
+
+// parseDiameterAVPs decodes a sequence of AVPs found at offset at in the
+// message, descending into grouped AVPs up to a fixed depth.
+func parseDiameterAVPs(data []byte, at, depth int) []DiameterAVP {
+	var avps []DiameterAVP
+	for len(data) >= 8 {
+		a := DiameterAVP{Code: binary.BigEndian.Uint32(data[0:4]), Flags: data[4]}
+		length := int(data[5])<<16 | int(data[6])<<8 | int(data[7])
+		hdr := 8
+		if a.Flags&0x80 != 0 {
+			if len(data) < 12 {
+				break
+			}
+			a.Vendor = binary.BigEndian.Uint32(data[8:12])
+			hdr = 12
+		}
+		if length < hdr || length > len(data) {
+			break
+		}
+		a.Value = data[hdr:length]
+		a.at = span{at, length}
+		if info, ok := diameterAVPs[a.Code]; ok && a.Vendor == 0 && info.typ == avpGrouped && depth < 4 {
+			a.Children = parseDiameterAVPs(a.Value, at+hdr, depth+1)
+		}
+		avps = append(avps, a)
+		padded := (length + 3) &^ 3
+		if padded >= len(data) {
+			break
+		}
+		data = data[padded:]
+		at += padded
+	}
+	return avps
+}
+
+// diameterAVPField renders an AVP, with grouped AVPs as children.
+func diameterAVPField(a DiameterAVP) models.LayerField {
+	name := fmt.Sprintf("AVP %d", a.Code)
+	typ := avpOctets
+	if info, ok := diameterAVPs[a.Code]; ok && a.Vendor == 0 {
+		name, typ = info.name, info.typ
+	} else if a.Vendor != 0 {
+		name = fmt.Sprintf("AVP %d (vendor %d)", a.Code, a.Vendor)
+	}
+
+	f := a.at.field(name, "")
+	v := a.Value
+	switch {
+	case typ == avpGrouped:
+		f.Value = fmt.Sprintf("%d AVPs", len(a.Children))
+		for _, c := range a.Children {
+			f.Children = append(f.Children, diameterAVPField(c))
+		}
+	case typ == avpUint32 && len(v) == 4:
+		f.Value = fmt.Sprintf("%d", binary.BigEndian.Uint32(v))
+	case typ == avpUint64 && len(v) == 8:
+		f.Value = fmt.Sprintf("%d", binary.BigEndian.Uint64(v))
+	case typ == avpAddress && len(v) == 6 && v[1] == 1:
+		f.Value = net.IP(v[2:6]).String()
+	case typ == avpAddress && len(v) == 18 && v[1] == 2:
+		f.Value = net.IP(v[2:18]).String()
+	case typ == avpUTF8 && utf8.Valid(v):
+		f.Value = string(v)
+	default:
+		f.Value = fmt.Sprintf("%x", truncateBytes(v, 32))
+	}
+	return f
+}
+
+func truncateBytes(b []byte, n int) []byte {
+	if len(b) > n {
+		return b[:n]
+	}
+	return b
+}
+
+func buildDiameterLayerDetail(m *DiameterMessage) models.LayerDetail {
+	fields := []models.LayerField{
+		{Name: "Command", Value: fmt.Sprintf("%s (%d)", m.CommandName(), m.Command), Offset: 5, Length: 3},
+		{Name: "Flags", Value: fmt.Sprintf("0x%02x", m.Flags), Offset: 4, Length: 1},
+		{Name: "Application ID", Value: fmt.Sprintf("%d", m.AppID), Offset: 8, Length: 4},
+		{Name: "Hop-by-Hop ID", Value: fmt.Sprintf("0x%08x", m.HopByHop), Offset: 12, Length: 4},
+		{Name: "End-to-End ID", Value: fmt.Sprintf("0x%08x", m.EndToEnd), Offset: 16, Length: 4},
+	}
+	for _, a := range m.AVPs {
+		fields = append(fields, diameterAVPField(a))
+	}
+	return models.LayerDetail{Name: "Diameter", Fields: fields}
+}
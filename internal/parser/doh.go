@@ -0,0 +1,182 @@
+package parser
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// DNSMessageType is the media type of DNS-over-HTTPS wire-format messages
+// (RFC 8484).
+const DNSMessageType = "application/dns-message"
+
+// dnsPort853 is the port assigned to DNS over TLS (RFC 7858) and DNS over
+// QUIC (RFC 9250).
+const dnsPort853 = 853
+
+// maxDNSMessage is the largest DNS message a DoH body may carry.
+const maxDNSMessage = 65535
+
+// Flow labels for encrypted DNS; they match the ALPN display names.
+const (
+	LabelDoT = "DNS-over-TLS"
+	LabelDoQ = "DNS-over-QUIC"
+	LabelDoH = "DNS-over-HTTPS"
+)
+
+// dohResolvers are well-known public DoH server names. Their HTTPS traffic
+// is DNS, so flows to them are labeled DoH from the ClientHello's SNI.
+var dohResolvers = map[string]bool{
+	"dns.google":                       true,
+	"dns.google.com":                   true,
+	"dns64.dns.google":                 true,
+	"cloudflare-dns.com":               true,
+	"one.one.one.one":                  true,
+	"1dot1dot1dot1.cloudflare-dns.com": true,
+	"dns.quad9.net":                    true,
+	"dns9.quad9.net":                   true,
+	"dns10.quad9.net":                  true,
+	"dns11.quad9.net":                  true,
+	"doh.opendns.com":                  true,
+	"doh.familyshield.opendns.com":     true,
+	"dns.adguard.com":                  true,
+	"dns.adguard-dns.com":              true,
+	"dns.nextdns.io":                   true,
+	"doh.cleanbrowsing.org":            true,
+	"doh.mullvad.net":                  true,
+	"dns.alidns.com":                   true,
+	"doh.pub":                          true,
+	"doh.dns.sb":                       true,
+}
+
+// IsDoHResolver reports whether host is a well-known DoH server.
+func IsDoHResolver(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	return dohResolvers[host] || strings.HasSuffix(host, ".cloudflare-dns.com") || strings.HasSuffix(host, ".dns.nextdns.io")
+}
+
+// isDoHPath reports whether an HTTP request path is a DoH endpoint: the
+// RFC 8484 template path, or the JSON API path most resolvers also serve.
+func isDoHPath(path string) bool {
+	p, _, _ := strings.Cut(path, "?")
+	return p == "/dns-query" || p == "/resolve" || strings.HasSuffix(p, "/dns-query")
+}
+
+// DoHQueryMessage returns the DNS message of a DoH GET request, carried
+// base64url-encoded in the dns query parameter, or nil.
+func DoHQueryMessage(path string) []byte {
+	_, query, ok := strings.Cut(path, "?")
+	if !ok {
+		return nil
+	}
+	vals, err := url.ParseQuery(query)
+	if err != nil {
+		return nil
+	}
+	v := strings.TrimRight(vals.Get("dns"), "=")
+	if v == "" {
+		return nil
+	}
+	msg, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil || len(msg) > maxDNSMessage {
+		return nil
+	}
+	return msg
+}
+
+// DecodeDNSMessage decodes a DNS wire-format message, or returns nil.
+func DecodeDNSMessage(msg []byte) *layers.DNS {
+	if len(msg) < 12 {
+		return nil
+	}
+	dns := &layers.DNS{}
+	if err := dns.DecodeFromBytes(msg, gopacket.NilDecodeFeedback); err != nil {
+		return nil
+	}
+	return dns
+}
+
+// DNSSummary is the info column text for a DNS message, e.g.
+// "Query example.com A" or "Response No Error 93.184.216.34 example.com A".
+func DNSSummary(dns *layers.DNS) string {
+	var info string
+	if dns.QR {
+		info = "Response " + dnsRcodeString(dns.ResponseCode)
+		// Show first resolved IP for responses
+		for _, a := range dns.Answers {
+			if a.IP != nil {
+				info += " " + a.IP.String()
+				break
+			}
+		}
+	} else {
+		info = "Query"
+	}
+	for _, q := range dns.Questions {
+		info += " " + string(q.Name) + " " + q.Type.String()
+	}
+	return info
+}
+
+// ExtractDoH decodes the DNS message of a DoH request or response carried
+// over cleartext HTTP/1.x in one segment: a POST or response body of type
+// application/dns-message, or a GET request's dns parameter.
+func ExtractDoH(pkt gopacket.Packet) *layers.DNS {
+	app := pkt.ApplicationLayer()
+	if app == nil {
+		return nil
+	}
+	msg := splitHTTPMessage(app.Payload())
+	if msg == nil {
+		return nil
+	}
+	if msg.contentType() == DNSMessageType && !msg.truncated() {
+		return DecodeDNSMessage(msg.body)
+	}
+	if strings.HasPrefix(msg.startLine, "GET ") {
+		return DecodeDNSMessage(DoHQueryMessage(msg.requestURI()))
+	}
+	return nil
+}
+
+// EncryptedDNS returns the flow label for packets of DNS over TLS, QUIC or
+// HTTPS, or "". DoT and DoQ are recognized by port 853 and DoH by a
+// cleartext DoH message; encrypted DoH is recognized from the flow's SNI
+// with IsDoHResolver.
+func EncryptedDNS(pkt gopacket.Packet) string {
+	app := pkt.ApplicationLayer()
+	if app == nil {
+		return ""
+	}
+	switch getTransportProto(pkt) {
+	case "TCP":
+		if portIs(pkt, dnsPort853) {
+			return LabelDoT
+		}
+	case "UDP":
+		if portIs(pkt, dnsPort853) && isQUIC(app.LayerContents()) {
+			return LabelDoQ
+		}
+	}
+	if ExtractDoH(pkt) != nil {
+		return LabelDoH
+	}
+	if frames, _ := HTTP2From(pkt); isDoHExchange(frames) {
+		return LabelDoH
+	}
+	return ""
+}
+
+// isDoHExchange reports whether HTTP/2 frames carry a DoH message or a
+// request to a DoH path.
+func isDoHExchange(frames []HTTP2Frame) bool {
+	for i := range frames {
+		if frames[i].DNSMessage != nil || isDoHPath(frames[i].Header(":path")) {
+			return true
+		}
+	}
+	return false
+}
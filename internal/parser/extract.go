@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"encoding/binary"
+
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 
@@ -14,7 +16,10 @@ type FlowTuple struct {
 	SrcPort  uint16
 	DstPort  uint16
 	Protocol string
+	Scope    string // see FlowScope
+	Path     string // see FlowPath
 	Flags    flow.TCPFlags
+	Segment  flow.TCPSegment // of a TCP packet
 	Valid    bool
 }
 
@@ -37,8 +42,37 @@ func ExtractFlowTuple(pkt gopacket.Packet) FlowTuple {
 		ip6 := ip6Layer.(*layers.IPv6)
 		t.SrcIP = ip6.SrcIP.String()
 		t.DstIP = ip6.DstIP.String()
-		t.Protocol = ip6.NextHeader.String()
+		// Name the protocol behind the extension headers. gopacket does
+		// not decode the transport layer behind a fragment header or some
+		// routing headers, so read the ports from the bytes; a decoded
+		// layer below overrides them
+		chain := IPv6ExtHeaders(ip6)
+		t.Protocol = chain.Protocol.String()
 		t.Valid = true
+		if b := chain.TransportBytes(); len(b) >= 4 {
+			switch chain.Protocol {
+			case layers.IPProtocolTCP, layers.IPProtocolUDP, layers.IPProtocolSCTP:
+				t.SrcPort = binary.BigEndian.Uint16(b[0:2])
+				t.DstPort = binary.BigEndian.Uint16(b[2:4])
+			}
+			if chain.Protocol == layers.IPProtocolTCP && len(b) >= 14 {
+				t.Flags = flow.TCPFlags{
+					SYN: b[13]&0x02 != 0,
+					ACK: b[13]&0x10 != 0,
+					FIN: b[13]&0x01 != 0,
+					RST: b[13]&0x04 != 0,
+					PSH: b[13]&0x08 != 0,
+				}
+				t.Segment = flow.TCPSegment{
+					Seq:     binary.BigEndian.Uint32(b[4:8]),
+					Ack:     binary.BigEndian.Uint32(b[8:12]),
+					Payload: max(len(b)-int(b[12]>>4)*4, 0),
+				}
+				if len(b) >= 16 {
+					t.Segment.Window = binary.BigEndian.Uint16(b[14:16])
+				}
+			}
+		}
 	}
 
 	// TCP
@@ -54,6 +88,7 @@ func ExtractFlowTuple(pkt gopacket.Packet) FlowTuple {
 			RST: tcp.RST,
 			PSH: tcp.PSH,
 		}
+		t.Segment = flow.TCPSegment{Seq: tcp.Seq, Ack: tcp.Ack, Window: tcp.Window, Payload: len(tcp.Payload)}
 	}
 
 	// UDP
@@ -72,5 +107,10 @@ func ExtractFlowTuple(pkt gopacket.Packet) FlowTuple {
 		t.Protocol = "SCTP"
 	}
 
+	if t.Valid {
+		t.Scope = FlowScope(pkt)
+		t.Path = FlowPath(pkt)
+		t.Segment.Time = pkt.Metadata().Timestamp
+	}
 	return t
 }
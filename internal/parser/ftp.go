@@ -0,0 +1,349 @@
+package parser
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+)
+
+// maxFTPDataEndpoints caps the FTP data endpoints learned from control
+// connections.
+const maxFTPDataEndpoints = 4096
+
+// FTP data connections run between ports negotiated on the control
+// connection with PORT, EPRT, PASV or EPSV, so the FTP tracker registers
+// them here as it sees them, the way Wireshark sets up FTP-DATA
+// conversations. Each endpoint maps to the transfer it carries, such as
+// "RETR report.pdf", or "" until the transfer command is seen.
+var ftpDataEndpoints = struct {
+	sync.RWMutex
+	m map[string]string // "ip:port" → transfer
+}{m: make(map[string]string)}
+
+// ExpectFTPData registers addr:port as an FTP data endpoint carrying
+// transfer, replacing what an earlier registration said it carries.
+func ExpectFTPData(addr string, port int, transfer string) {
+	ip := net.ParseIP(addr)
+	if ip == nil || ip.IsUnspecified() || port <= 0 || port > 0xffff {
+		return
+	}
+	key := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	ftpDataEndpoints.Lock()
+	defer ftpDataEndpoints.Unlock()
+	if _, ok := ftpDataEndpoints.m[key]; !ok && len(ftpDataEndpoints.m) >= maxFTPDataEndpoints {
+		return
+	}
+	ftpDataEndpoints.m[key] = transfer
+}
+
+// ForgetFTPData clears the endpoints registered by ExpectFTPData.
+func ForgetFTPData() {
+	ftpDataEndpoints.Lock()
+	defer ftpDataEndpoints.Unlock()
+	ftpDataEndpoints.m = make(map[string]string)
+}
+
+// FTPDataTransfer reports whether a TCP connection between the two
+// endpoints is an FTP data connection, and the transfer it carries.
+func FTPDataTransfer(srcIP string, srcPort uint16, dstIP string, dstPort uint16) (string, bool) {
+	ftpDataEndpoints.RLock()
+	defer ftpDataEndpoints.RUnlock()
+	if len(ftpDataEndpoints.m) == 0 {
+		return "", false
+	}
+	if t, ok := ftpDataEndpoints.m[net.JoinHostPort(dstIP, strconv.Itoa(int(dstPort)))]; ok {
+		return t, true
+	}
+	t, ok := ftpDataEndpoints.m[net.JoinHostPort(srcIP, strconv.Itoa(int(srcPort)))]
+	return t, ok
+}
+
+// ftpData reports whether pkt travels on an FTP data connection, and the
+// transfer it carries.
+func ftpData(pkt gopacket.Packet) (string, bool) {
+	if getTransportProto(pkt) != "TCP" {
+		return "", false
+	}
+	t := ExtractFlowTuple(pkt)
+	if !t.Valid {
+		return "", false
+	}
+	return FTPDataTransfer(t.SrcIP, t.SrcPort, t.DstIP, t.DstPort)
+}
+
+// FTPMessage is a command sent on an FTP control connection, or the
+// server's reply.
+type FTPMessage struct {
+	Response bool
+	Command  string // upper case; requests only
+	Arg      string
+	Code     int // replies only
+	Text     string
+}
+
+// ftpTransferCommands open a data connection.
+var ftpTransferCommands = map[string]bool{
+	"RETR": true, "STOR": true, "STOU": true, "APPE": true,
+	"LIST": true, "NLST": true, "MLSD": true,
+}
+
+// IsTransfer reports whether m is a command that sends a file or listing
+// over the data connection.
+func (m FTPMessage) IsTransfer() bool {
+	return !m.Response && ftpTransferCommands[m.Command]
+}
+
+// ExtractFTP returns the FTP control messages carried by pkt, or nil.
+func ExtractFTP(pkt gopacket.Packet) []FTPMessage {
+	if !isFTPControl(pkt) {
+		return nil
+	}
+	return parseFTPMessages(transportPayload(pkt))
+}
+
+// isFTPControl reports whether pkt is on TCP port 21 or a port decoded as
+// FTP.
+func isFTPControl(pkt gopacket.Packet) bool {
+	return getTransportProto(pkt) == "TCP" && (decodeAsFor(pkt) == "FTP" || portIs(pkt, 21))
+}
+
+// parseFTPMessages splits a control connection segment into commands and
+// replies. A multi-line reply ("230-Welcome" ... "230 Done") counts as one
+// reply with the text of its first line.
+func parseFTPMessages(data []byte) []FTPMessage {
+	var out []FTPMessage
+	multi := 0 // code of the multi-line reply being skipped
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		code, sep, isReply := ftpReplyCode(line)
+		if multi != 0 {
+			if isReply && code == multi && sep == ' ' {
+				multi = 0
+			}
+			continue
+		}
+		if isReply {
+			out = append(out, FTPMessage{Response: true, Code: code, Text: strings.TrimSpace(line[4:])})
+			if sep == '-' {
+				multi = code
+			}
+			continue
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		if !isFTPCommand(cmd) {
+			// Not FTP, or the middle of something else
+			return out
+		}
+		out = append(out, FTPMessage{Command: strings.ToUpper(cmd), Arg: strings.TrimSpace(arg)})
+	}
+	return out
+}
+
+// ftpReplyCode parses the "NNN " or "NNN-" that starts a reply line.
+func ftpReplyCode(line string) (code int, sep byte, ok bool) {
+	if len(line) < 4 || (line[3] != ' ' && line[3] != '-') {
+		return 0, 0, false
+	}
+	code, err := strconv.Atoi(line[:3])
+	if err != nil || code < 100 || code > 599 {
+		return 0, 0, false
+	}
+	return code, line[3], true
+}
+
+// isFTPCommand reports whether s looks like a command verb: three or four
+// letters.
+func isFTPCommand(s string) bool {
+	if len(s) < 3 || len(s) > 4 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	// h1,h2,h3,h4,p1,p2 of PORT and of 227 replies
+	ftpHostPort = regexp.MustCompile(`(\d{1,3}),(\d{1,3}),(\d{1,3}),(\d{1,3}),(\d{1,3}),(\d{1,3})`)
+	// "(1234 bytes)" in 150 replies
+	ftpReplySize = regexp.MustCompile(`\((\d+) bytes\)`)
+)
+
+// DataEndpoint returns the data connection endpoint a PORT or EPRT command
+// or a 227 or 229 reply negotiates. ip is "" for a 229 reply, whose
+// endpoint is on the server that sent it. active is set for PORT and EPRT,
+// where the server connects to the client.
+func (m FTPMessage) DataEndpoint() (ip string, port int, active, ok bool) {
+	switch {
+	case m.Command == "PORT":
+		ip, port, ok = parseFTPHostPort(m.Arg)
+		return ip, port, true, ok
+	case m.Command == "EPRT":
+		// EPRT |1|132.235.1.2|6275|
+		f := splitFTPDelimited(m.Arg)
+		if len(f) != 3 || net.ParseIP(f[1]) == nil {
+			return "", 0, false, false
+		}
+		port, err := strconv.Atoi(f[2])
+		return f[1], port, true, err == nil && port > 0 && port <= 0xffff
+	case m.Response && m.Code == 227:
+		ip, port, ok = parseFTPHostPort(m.Text)
+		return ip, port, false, ok
+	case m.Response && m.Code == 229:
+		// 229 Entering Extended Passive Mode (|||6446|)
+		lp, rp := strings.IndexByte(m.Text, '('), strings.LastIndexByte(m.Text, ')')
+		if lp < 0 || rp < lp {
+			return "", 0, false, false
+		}
+		f := splitFTPDelimited(m.Text[lp+1 : rp])
+		if len(f) != 3 {
+			return "", 0, false, false
+		}
+		port, err := strconv.Atoi(f[2])
+		return "", port, false, err == nil && port > 0 && port <= 0xffff
+	}
+	return "", 0, false, false
+}
+
+// parseFTPHostPort parses the h1,h2,h3,h4,p1,p2 of PORT and 227 replies.
+func parseFTPHostPort(s string) (string, int, bool) {
+	m := ftpHostPort.FindStringSubmatch(s)
+	if m == nil {
+		return "", 0, false
+	}
+	var n [6]int
+	for i := range n {
+		n[i], _ = strconv.Atoi(m[i+1])
+		if n[i] > 255 {
+			return "", 0, false
+		}
+	}
+	port := n[4]<<8 | n[5]
+	return fmt.Sprintf("%d.%d.%d.%d", n[0], n[1], n[2], n[3]), port, port > 0
+}
+
+// splitFTPDelimited splits the "|1|addr|port|" form of EPRT and 229, whose
+// first character is the delimiter, into its three fields.
+func splitFTPDelimited(s string) []string {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return nil
+	}
+	f := strings.Split(s[1:], s[:1])
+	if len(f) != 4 || f[3] != "" {
+		return nil
+	}
+	return f[:3]
+}
+
+// TransferSize returns the size a 150 reply announces for the file it
+// opens, or the size a 213 reply to SIZE gives.
+func (m FTPMessage) TransferSize() (int64, bool) {
+	if !m.Response {
+		return 0, false
+	}
+	var s string
+	switch m.Code {
+	case 150, 125:
+		sm := ftpReplySize.FindStringSubmatch(m.Text)
+		if sm == nil {
+			return 0, false
+		}
+		s = sm[1]
+	case 213:
+		s = m.Text
+	default:
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	return n, err == nil && n >= 0
+}
+
+// String formats m as Wireshark's Info column does: "Request: USER bob" or
+// "Response: 230 Login successful."
+func (m FTPMessage) String() string {
+	if m.Response {
+		return fmt.Sprintf("Response: %d %s", m.Code, m.Text)
+	}
+	if m.Arg == "" {
+		return "Request: " + m.Command
+	}
+	return "Request: " + m.Command + " " + m.Arg
+}
+
+func ftpSummary(msgs []FTPMessage) string {
+	s := msgs[0].String()
+	if len(msgs) > 1 {
+		s += fmt.Sprintf(" (+%d more)", len(msgs)-1)
+	}
+	return s
+}
+
+func buildFTPLayerDetail(msgs []FTPMessage) models.LayerDetail {
+	var fields []models.LayerField
+	for _, m := range msgs {
+		if m.Response {
+			fields = append(fields,
+				models.LayerField{Name: "Response Code", Value: strconv.Itoa(m.Code)},
+				models.LayerField{Name: "Response Arg", Value: m.Text})
+		} else {
+			fields = append(fields, models.LayerField{Name: "Request Command", Value: m.Command})
+			switch m.Command {
+			case "USER":
+				fields = append(fields, models.LayerField{Name: "User", Value: m.Arg})
+			case "PASS":
+				fields = append(fields, models.LayerField{Name: "Password", Value: m.Arg})
+			default:
+				if m.Arg != "" {
+					fields = append(fields, models.LayerField{Name: "Request Arg", Value: m.Arg})
+				}
+			}
+		}
+		if ip, port, active, ok := m.DataEndpoint(); ok {
+			name := "Passive"
+			if active {
+				name = "Active"
+			}
+			if ip == "" {
+				fields = append(fields, models.LayerField{Name: name + " Port", Value: strconv.Itoa(port)})
+			} else {
+				fields = append(fields, models.LayerField{Name: name + " Address", Value: net.JoinHostPort(ip, strconv.Itoa(port))})
+			}
+		}
+		if n, ok := m.TransferSize(); ok {
+			fields = append(fields, models.LayerField{Name: "File Size", Value: strconv.FormatInt(n, 10)})
+		}
+	}
+	return models.LayerDetail{Name: "FTP", Fields: fields}
+}
+
+// ftpDataSummary is the Info of an FTP data packet: "FTP Data: 1448 bytes
+// (RETR report.pdf)".
+func ftpDataSummary(data []byte, transfer string) string {
+	s := fmt.Sprintf("FTP Data: %d bytes", len(data))
+	if transfer != "" {
+		s += " (" + transfer + ")"
+	}
+	return s
+}
+
+func buildFTPDataLayerDetail(data []byte, transfer string) models.LayerDetail {
+	fields := []models.LayerField{{Name: "Length", Value: strconv.Itoa(len(data))}}
+	if transfer != "" {
+		fields = append(fields, models.LayerField{Name: "Transfer", Value: transfer})
+	}
+	return models.LayerDetail{Name: "FTP-DATA", Fields: fields}
+}
@@ -0,0 +1,471 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+// GTP on mobile core interfaces: GTPv1-U (UDP 2152) carries subscriber
+// traffic between eNodeBs and gateways and is decapsulated by the tunnel
+// package; GTPv2-C (UDP 2123, 3GPP TS 29.274) sets the bearers up.
+
+const portGTPC = 2123
+
+var gtpv1Messages = map[uint8]string{
+	1:   "Echo Request",
+	2:   "Echo Response",
+	26:  "Error Indication",
+	31:  "Supported Extension Headers Notification",
+	254: "End Marker",
+	255: "G-PDU",
+}
+
+var gtpv2Messages = map[uint8]string{
+	1:   "Echo Request",
+	2:   "Echo Response",
+	3:   "Version Not Supported",
+	32:  "Create Session Request",
+	33:  "Create Session Response",
+	34:  "Modify Bearer Request",
+	35:  "Modify Bearer Response",
+	36:  "Delete Session Request",
+	37:  "Delete Session Response",
+	95:  "Create Bearer Request",
+	96:  "Create Bearer Response",
+	97:  "Update Bearer Request",
+	98:  "Update Bearer Response",
+	99:  "Delete Bearer Request",
+	100: "Delete Bearer Response",
+	170: "Release Access Bearers Request",
+	171: "Release Access Bearers Response",
+	176: "Downlink Data Notification",
+	177: "Downlink Data Notification Acknowledge",
+}
+
+// GTPv2 information element types.
+const (
+	gtpIEIMSI          = 1
+	gtpIECause         = 2
+	gtpIERecovery      = 3
+	gtpIEAPN           = 71
+	gtpIEAMBR          = 72
+	gtpIEEBI           = 73
+	gtpIEMEI           = 75
+	gtpIEMSISDN        = 76
+	gtpIEPAA           = 79
+	gtpIERATType       = 82
+	gtpIEServingNet    = 83
+	gtpIEFTEID         = 87
+	gtpIEBearerContext = 93
+	gtpIEPDNType       = 99
+)
+
+var gtpv2IENames = map[uint8]string{
+	gtpIEIMSI:          "IMSI",
+	gtpIECause:         "Cause",
+	gtpIERecovery:      "Recovery",
+	gtpIEAPN:           "APN",
+	gtpIEAMBR:          "AMBR",
+	gtpIEEBI:           "EPS Bearer ID",
+	gtpIEMEI:           "MEI",
+	gtpIEMSISDN:        "MSISDN",
+	gtpIEPAA:           "PDN Address Allocation",
+	gtpIERATType:       "RAT Type",
+	gtpIEServingNet:    "Serving Network",
+	gtpIEFTEID:         "F-TEID",
+	gtpIEBearerContext: "Bearer Context",
+	gtpIEPDNType:       "PDN Type",
+	74:                 "IP Address",
+	77:                 "Indication",
+	78:                 "PCO",
+	80:                 "Bearer QoS",
+	86:                 "User Location Info",
+	94:                 "Charging ID",
+	114:                "UE Time Zone",
+	127:                "APN Restriction",
+	128:                "Selection Mode",
+}
+
+var gtpv2Causes = map[uint8]string{
+	16:  "Request accepted",
+	17:  "Request accepted partially",
+	18:  "New PDN type due to network preference",
+	19:  "New PDN type due to single address bearer only",
+	64:  "Context Not Found",
+	65:  "Invalid Message Format",
+	66:  "Version not supported by next peer",
+	67:  "Invalid length",
+	68:  "Service not supported",
+	69:  "Mandatory IE incorrect",
+	70:  "Mandatory IE missing",
+	72:  "System failure",
+	73:  "No resources available",
+	78:  "Missing or unknown APN",
+	83:  "Preferred PDN type not supported",
+	84:  "All dynamic addresses are occupied",
+	92:  "User authentication failed",
+	93:  "APN access denied - no subscription",
+	94:  "Request rejected (reason not specified)",
+	110: "Temporarily rejected due to handover/TAU/RAU procedure in progress",
+}
+
+var gtpv2RATTypes = map[uint8]string{
+	1: "UTRAN", 2: "GERAN", 3: "WLAN", 4: "GAN", 5: "HSPA Evolution", 6: "EUTRAN", 7: "Virtual", 8: "EUTRAN-NB-IoT", 10: "NR",
+}
+
+var gtpv2Interfaces = map[uint8]string{
+	0:  "S1-U eNodeB GTP-U",
+	1:  "S1-U SGW GTP-U",
+	2:  "S12 RNC GTP-U",
+	3:  "S12 SGW GTP-U",
+	4:  "S5/S8 SGW GTP-U",
+	5:  "S5/S8 PGW GTP-U",
+	6:  "S5/S8 SGW GTP-C",
+	7:  "S5/S8 PGW GTP-C",
+	10: "S11 MME GTP-C",
+	11: "S11/S4 SGW GTP-C",
+}
+
+func gtpv1MessageName(t uint8) string {
+	if n, ok := gtpv1Messages[t]; ok {
+		return n
+	}
+	return fmt.Sprintf("Type %d", t)
+}
+
+func parseGTPv1U(g *layers.GTPv1U) models.LayerDetail {
+	fields := []models.LayerField{
+		{Name: "Version", Value: fmt.Sprintf("%d", g.Version), Offset: 0, Length: 1},
+		{Name: "Message Type", Value: fmt.Sprintf("%s (%d)", gtpv1MessageName(g.MessageType), g.MessageType), Offset: 1, Length: 1},
+		{Name: "Length", Value: fmt.Sprintf("%d", g.MessageLength), Offset: 2, Length: 2},
+		{Name: "TEID", Value: fmt.Sprintf("0x%08x", g.TEID), Offset: 4, Length: 4},
+	}
+	if g.SequenceNumberFlag {
+		fields = append(fields, models.LayerField{Name: "Sequence", Value: fmt.Sprintf("%d", g.SequenceNumber), Offset: 8, Length: 2})
+	}
+	return models.LayerDetail{Name: "GTP-U", Fields: fields}
+}
+
+// GTPv2IE is an information element of a GTPv2-C message. Grouped IEs
+// such as Bearer Context have their members in Children.
+type GTPv2IE struct {
+	Type     uint8
+	Instance uint8
+	Offset   int // of the IE header in the message
+	Data     []byte
+	Children []GTPv2IE
+}
+
+// Name returns the IE's name.
+func (ie GTPv2IE) Name() string {
+	if n, ok := gtpv2IENames[ie.Type]; ok {
+		return n
+	}
+	return fmt.Sprintf("IE %d", ie.Type)
+}
+
+// GTPv2Message is a GTPv2-C message. A piggybacked message is not
+// decoded.
+type GTPv2Message struct {
+	Type    uint8
+	TEID    uint32
+	HasTEID bool
+	Seq     uint32
+	IEs     []GTPv2IE
+}
+
+// Name returns the message type's name.
+func (m *GTPv2Message) Name() string {
+	if n, ok := gtpv2Messages[m.Type]; ok {
+		return n
+	}
+	return fmt.Sprintf("Type %d", m.Type)
+}
+
+// IE returns the first top-level IE of type t.
+func (m *GTPv2Message) IE(t uint8) (GTPv2IE, bool) {
+	for _, ie := range m.IEs {
+		if ie.Type == t {
+			return ie, true
+		}
+	}
+	return GTPv2IE{}, false
+}
+
+// IMSI returns the subscriber's IMSI, or "" if the message has none.
+func (m *GTPv2Message) IMSI() string {
+	if ie, ok := m.IE(gtpIEIMSI); ok {
+		return tbcd(ie.Data)
+	}
+	return ""
+}
+
+// APN returns the access point name, or "" if the message has none.
+func (m *GTPv2Message) APN() string {
+	if ie, ok := m.IE(gtpIEAPN); ok {
+		return apnName(ie.Data)
+	}
+	return ""
+}
+
+// Summary describes the message for the Info column.
+func (m *GTPv2Message) Summary() string {
+	parts := []string{m.Name()}
+	if imsi := m.IMSI(); imsi != "" {
+		parts = append(parts, "IMSI="+imsi)
+	}
+	if apn := m.APN(); apn != "" {
+		parts = append(parts, "APN="+apn)
+	}
+	if ie, ok := m.IE(gtpIECause); ok && len(ie.Data) > 0 {
+		parts = append(parts, gtpv2CauseName(ie.Data[0]))
+	}
+	if m.HasTEID {
+		parts = append(parts, fmt.Sprintf("TEID=0x%08x", m.TEID))
+	}
+	return strings.Join(parts, " ")
+}
+
+func findGTPv2(pkt gopacket.Packet) *GTPv2Message {
+	udpLayer := pkt.Layer(layers.LayerTypeUDP)
+	if udpLayer == nil {
+		return nil
+	}
+	if forced := decodeAsFor(pkt); forced != "GTPv2" && (forced != "" || !portIs(pkt, portGTPC)) {
+		return nil
+	}
+	return parseGTPv2(udpLayer.(*layers.UDP).Payload)
+}
+
+func parseGTPv2(data []byte) *GTPv2Message {
+	if len(data) < 8 || data[0]>>5 != 2 {
+		return nil
+	}
+	m := &GTPv2Message{Type: data[1], HasTEID: data[0]&0x08 != 0}
+	n := int(binary.BigEndian.Uint16(data[2:4])) + 4
+	if n > len(data) {
+		return nil
+	}
+	off := 4
+	if m.HasTEID {
+		if n < 12 {
+			return nil
+		}
+		m.TEID = binary.BigEndian.Uint32(data[4:8])
+		off = 8
+	}
+	m.Seq = uint32(data[off])<<16 | uint32(data[off+1])<<8 | uint32(data[off+2])
+	m.IEs = parseGTPv2IEs(data[:n], off+4, 0)
+	return m
+}
+
+// parseGTPv2IEs parses the IEs in msg from off on. Parsing stops at an IE
+// that runs past the message.
+func parseGTPv2IEs(msg []byte, off, depth int) []GTPv2IE {
+	var out []GTPv2IE
+	for off+4 <= len(msg) {
+		n := int(binary.BigEndian.Uint16(msg[off+1 : off+3]))
+		if off+4+n > len(msg) {
+			break
+		}
+		ie := GTPv2IE{Type: msg[off], Instance: msg[off+3] & 0x0f, Offset: off, Data: msg[off+4 : off+4+n]}
+		if ie.Type == gtpIEBearerContext && depth < 2 {
+			ie.Children = parseGTPv2IEs(msg[:off+4+n], off+4, depth+1)
+		}
+		out = append(out, ie)
+		off += 4 + n
+	}
+	return out
+}
+
+func buildGTPv2LayerDetail(m *GTPv2Message) models.LayerDetail {
+	fields := []models.LayerField{
+		{Name: "Message Type", Value: fmt.Sprintf("%s (%d)", m.Name(), m.Type), Offset: 1, Length: 1},
+	}
+	seqOff := 4
+	if m.HasTEID {
+		fields = append(fields, models.LayerField{Name: "TEID", Value: fmt.Sprintf("0x%08x", m.TEID), Offset: 4, Length: 4})
+		seqOff = 8
+	}
+	fields = append(fields, models.LayerField{Name: "Sequence", Value: fmt.Sprintf("%d", m.Seq), Offset: seqOff, Length: 3})
+	for _, ie := range m.IEs {
+		fields = append(fields, gtpv2IEField(ie))
+	}
+	return models.LayerDetail{Name: "GTPv2", Fields: fields}
+}
+
+func gtpv2IEField(ie GTPv2IE) models.LayerField {
+	f := models.LayerField{Name: ie.Name(), Offset: ie.Offset, Length: 4 + len(ie.Data)}
+	d := ie.Data
+	switch ie.Type {
+	case gtpIEIMSI, gtpIEMSISDN, gtpIEMEI:
+		f.Value = tbcd(d)
+	case gtpIEAPN:
+		f.Value = apnName(d)
+	case gtpIECause:
+		if len(d) > 0 {
+			f.Value = fmt.Sprintf("%s (%d)", gtpv2CauseName(d[0]), d[0])
+		}
+	case gtpIERecovery:
+		if len(d) > 0 {
+			f.Value = fmt.Sprintf("%d", d[0])
+		}
+	case gtpIEEBI:
+		if len(d) > 0 {
+			f.Value = fmt.Sprintf("%d", d[0]&0x0f)
+		}
+	case gtpIERATType:
+		if len(d) > 0 {
+			f.Value = gtpName(gtpv2RATTypes, d[0])
+		}
+	case gtpIEPDNType:
+		if len(d) > 0 {
+			f.Value = gtpPDNType(d[0])
+		}
+	case gtpIEServingNet:
+		if len(d) >= 3 {
+			mcc, mnc := plmn(d)
+			f.Value = fmt.Sprintf("MCC %s, MNC %s", mcc, mnc)
+		}
+	case gtpIEAMBR:
+		if len(d) >= 8 {
+			f.Value = fmt.Sprintf("uplink %d kbps, downlink %d kbps", binary.BigEndian.Uint32(d[0:4]), binary.BigEndian.Uint32(d[4:8]))
+		}
+	case gtpIEFTEID:
+		f.Value, f.Children = gtpFTEID(ie)
+	case gtpIEPAA:
+		f.Value = gtpPAA(d)
+	case gtpIEBearerContext:
+		f.Value = fmt.Sprintf("%d IEs", len(ie.Children))
+		for _, c := range ie.Children {
+			f.Children = append(f.Children, gtpv2IEField(c))
+		}
+	default:
+		f.Value = fmt.Sprintf("%x", d)
+	}
+	if ie.Instance != 0 {
+		f.Name += fmt.Sprintf(" [%d]", ie.Instance)
+	}
+	return f
+}
+
+// gtpFTEID describes a fully qualified TEID: the interface it belongs to,
+// the TEID and the IPv4 and/or IPv6 address of the endpoint.
+func gtpFTEID(ie GTPv2IE) (string, []models.LayerField) {
+	d := ie.Data
+	if len(d) < 5 {
+		return "", nil
+	}
+	iface := gtpName(gtpv2Interfaces, d[0]&0x3f)
+	teid := binary.BigEndian.Uint32(d[1:5])
+	children := []models.LayerField{
+		{Name: "Interface Type", Value: iface, Offset: ie.Offset + 4, Length: 1},
+		{Name: "TEID", Value: fmt.Sprintf("0x%08x", teid), Offset: ie.Offset + 5, Length: 4},
+	}
+	value := fmt.Sprintf("%s TEID 0x%08x", iface, teid)
+	off := 5
+	if d[0]&0x80 != 0 && off+4 <= len(d) {
+		a := net.IP(d[off : off+4]).String()
+		children = append(children, models.LayerField{Name: "IPv4 Address", Value: a, Offset: ie.Offset + 4 + off, Length: 4})
+		value += " " + a
+		off += 4
+	}
+	if d[0]&0x40 != 0 && off+16 <= len(d) {
+		a := net.IP(d[off : off+16]).String()
+		children = append(children, models.LayerField{Name: "IPv6 Address", Value: a, Offset: ie.Offset + 4 + off, Length: 16})
+		value += " " + a
+	}
+	return value, children
+}
+
+// gtpPAA describes a PDN address allocation: the address given to the UE.
+func gtpPAA(d []byte) string {
+	if len(d) < 1 {
+		return ""
+	}
+	t := d[0] & 0x07
+	switch {
+	case t == 1 && len(d) >= 5:
+		return "IPv4 " + net.IP(d[1:5]).String()
+	case t == 2 && len(d) >= 18:
+		return fmt.Sprintf("IPv6 %s/%d", net.IP(d[2:18]), d[1])
+	case t == 3 && len(d) >= 22:
+		return fmt.Sprintf("IPv4v6 %s, %s/%d", net.IP(d[18:22]), net.IP(d[2:18]), d[1])
+	}
+	return gtpPDNType(t)
+}
+
+func gtpPDNType(t uint8) string {
+	switch t & 0x07 {
+	case 1:
+		return "IPv4"
+	case 2:
+		return "IPv6"
+	case 3:
+		return "IPv4v6"
+	case 4:
+		return "Non-IP"
+	}
+	return fmt.Sprintf("Unknown (%d)", t&0x07)
+}
+
+func gtpv2CauseName(c uint8) string {
+	if n, ok := gtpv2Causes[c]; ok {
+		return n
+	}
+	return fmt.Sprintf("Cause %d", c)
+}
+
+func gtpName(names map[uint8]string, v uint8) string {
+	if n, ok := names[v]; ok {
+		return fmt.Sprintf("%s (%d)", n, v)
+	}
+	return fmt.Sprintf("Unknown (%d)", v)
+}
+
+// tbcd decodes telephony BCD digits, low nibble first, as used for IMSI,
+// MSISDN and IMEI. A 0xf nibble pads an odd number of digits.
+func tbcd(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		for _, n := range [2]byte{c & 0x0f, c >> 4} {
+			if n > 9 {
+				return sb.String()
+			}
+			sb.WriteByte('0' + n)
+		}
+	}
+	return sb.String()
+}
+
+// apnName decodes an access point name, encoded like a DNS name as
+// length-prefixed labels.
+func apnName(b []byte) string {
+	var labels []string
+	for len(b) > 0 {
+		n := int(b[0])
+		if n == 0 || 1+n > len(b) {
+			break
+		}
+		labels = append(labels, string(b[1:1+n]))
+		b = b[1+n:]
+	}
+	return strings.Join(labels, ".")
+}
+
+// plmn decodes the mobile country and network codes of a PLMN ID.
+func plmn(b []byte) (mcc, mnc string) {
+	mcc = fmt.Sprintf("%d%d%d", b[0]&0x0f, b[0]>>4, b[1]&0x0f)
+	mnc = fmt.Sprintf("%d%d", b[2]&0x0f, b[2]>>4)
+	if d := b[1] >> 4; d != 0x0f {
+		mnc += fmt.Sprintf("%d", d)
+	}
+	return mcc, mnc
+}
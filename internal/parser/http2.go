@@ -0,0 +1,529 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/http2/hpack"
+
+	"sniffox/internal/models"
+)
+
+// HTTP2Preface is the client connection preface that opens every HTTP/2
+// connection, including h2c upgrades and gRPC with prior knowledge.
+const HTTP2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+const (
+	http2FrameHeaderLen = 9
+	http2MaxBuffered    = 1 << 20 // larger frames are skipped rather than buffered
+)
+
+var http2FrameTypes = []string{"DATA", "HEADERS", "PRIORITY", "RST_STREAM", "SETTINGS", "PUSH_PROMISE", "PING", "GOAWAY", "WINDOW_UPDATE", "CONTINUATION"}
+
+var http2Settings = map[uint16]string{
+	1: "HEADER_TABLE_SIZE",
+	2: "ENABLE_PUSH",
+	3: "MAX_CONCURRENT_STREAMS",
+	4: "INITIAL_WINDOW_SIZE",
+	5: "MAX_FRAME_SIZE",
+	6: "MAX_HEADER_LIST_SIZE",
+	8: "ENABLE_CONNECT_PROTOCOL",
+}
+
+var http2Errors = []string{"NO_ERROR", "PROTOCOL_ERROR", "INTERNAL_ERROR", "FLOW_CONTROL_ERROR", "SETTINGS_TIMEOUT", "STREAM_CLOSED", "FRAME_SIZE_ERROR", "REFUSED_STREAM", "CANCEL", "COMPRESSION_ERROR", "CONNECT_ERROR", "ENHANCE_YOUR_CALM", "INADEQUATE_SECURITY", "HTTP_1_1_REQUIRED"}
+
+var grpcStatuses = []string{"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND", "ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION", "ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED"}
+
+// HTTP/2 frame flags
+const (
+	http2FlagEndStream  = 0x1
+	http2FlagAck        = 0x1
+	http2FlagEndHeaders = 0x4
+	http2FlagPadded     = 0x8
+	http2FlagPriority   = 0x20
+)
+
+// HTTP2Header is one decoded header field.
+type HTTP2Header struct {
+	Name  string
+	Value string
+}
+
+// HTTP2Frame is one HTTP/2 frame, or the connection preface (Type
+// "Magic").
+type HTTP2Frame struct {
+	Type     string
+	Flags    uint8
+	StreamID uint32
+	Length   int
+
+	// Headers holds the decoded header block of a HEADERS or PUSH_PROMISE
+	// frame, on the frame (or CONTINUATION) that ends it. HeadersLost is
+	// set when the block could not be decoded because earlier frames of
+	// the connection were missed.
+	Headers     []HTTP2Header
+	HeadersLost bool
+
+	Settings     []string // SETTINGS parameters as NAME=value
+	ErrorCode    string   // RST_STREAM, GOAWAY
+	LastStreamID uint32   // GOAWAY
+	Increment    uint32   // WINDOW_UPDATE
+
+	// GRPCMethod is the gRPC method (/package.Service/Method) of the
+	// frame's stream, when the stream carries gRPC.
+	GRPCMethod string
+
+	// DNSMessage is the DNS-over-HTTPS message completed by this frame: a
+	// GET request's dns parameter, or an application/dns-message body on
+	// the DATA frame that ends the stream.
+	DNSMessage []byte
+
+	// pos is where the frame starts in the segment that completed it,
+	// which was fed bytes long; it is negative for a frame that began in
+	// an earlier segment.
+	pos, fed int
+}
+
+// span returns the part of the n bytes at i in the frame that lie in the
+// bytes it was completed by, relative to their end: HTTP2Tracker feeds
+// segments minus any retransmitted head, so that is also where they lie
+// from the end of the TCP payload.
+func (f *HTTP2Frame) span(i, n int) span {
+	start, end := max(f.pos+i, 0), min(f.pos+i+n, f.fed)
+	if start >= end {
+		return span{}
+	}
+	return span{start - f.fed, end - start}
+}
+
+// Header returns the value of the named header field, or "".
+func (f *HTTP2Frame) Header(name string) string {
+	for _, h := range f.Headers {
+		if h.Name == name {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// Summary is a one-line description of the frame, e.g.
+// "HEADERS[1]: GET /index.html".
+func (f *HTTP2Frame) Summary() string {
+	if f.Type == "Magic" {
+		return "Magic"
+	}
+	s := fmt.Sprintf("%s[%d]", f.Type, f.StreamID)
+	switch f.Type {
+	case "HEADERS", "CONTINUATION", "PUSH_PROMISE":
+		switch {
+		case f.HeadersLost:
+			s += ": (header state lost)"
+		case f.Header("grpc-status") != "":
+			s += ": grpc-status " + GRPCStatusString(f.Header("grpc-status"))
+		case f.Header(":status") != "":
+			s += ": " + f.Header(":status")
+		case f.Header(":method") != "":
+			if f.GRPCMethod != "" {
+				s += ": " + f.GRPCMethod
+			} else {
+				s += ": " + f.Header(":method") + " " + f.Header(":path")
+			}
+		}
+	case "SETTINGS", "PING":
+		if f.Flags&http2FlagAck != 0 {
+			s += " ACK"
+		}
+	case "RST_STREAM":
+		s += ": " + f.ErrorCode
+	case "GOAWAY":
+		s += fmt.Sprintf(": %s, last stream %d", f.ErrorCode, f.LastStreamID)
+	}
+	return s
+}
+
+// GRPCStatusString formats a grpc-status code with its name, e.g.
+// "14 (UNAVAILABLE)".
+func GRPCStatusString(code string) string {
+	if n, err := strconv.Atoi(code); err == nil && n >= 0 && n < len(grpcStatuses) {
+		return code + " (" + grpcStatuses[n] + ")"
+	}
+	return code
+}
+
+// HTTP2Conn decodes the two directions of one HTTP/2 connection. Frames
+// may be split across or packed into segments; HPACK state is kept per
+// direction, so segments must be fed in order.
+type HTTP2Conn struct {
+	dec      [2]*hpack.Decoder // 0: client to server, 1: server to client
+	buf      [2][]byte
+	block    [2][]byte // header block awaiting CONTINUATION
+	skip     [2]int    // payload bytes left of an oversized frame
+	preface  bool      // client preface consumed
+	lost     [2]bool   // HPACK state is unknown; header blocks cannot be decoded
+	dead     [2]bool   // data was missed; frame boundaries are unknown
+	grpc     map[uint32]string
+	grpcSeen bool
+	doh      map[uint64][]byte // dns-message bodies by stream ID<<1 | direction
+}
+
+// NewHTTP2Conn creates a decoder for a connection starting with the
+// client preface.
+func NewHTTP2Conn() *HTTP2Conn {
+	c := &HTTP2Conn{grpc: make(map[uint32]string), doh: make(map[uint64][]byte)}
+	for i := range c.dec {
+		c.dec[i] = hpack.NewDecoder(4096, nil)
+	}
+	return c
+}
+
+// GRPC reports whether any stream on the connection carried gRPC.
+func (c *HTTP2Conn) GRPC() bool {
+	return c.grpcSeen
+}
+
+// Lost tells the decoder that bytes sent by the server (or client) were
+// missed. Frame boundaries in that direction are then unknown, so its
+// later data is ignored.
+func (c *HTTP2Conn) Lost(fromServer bool) {
+	d := dir(fromServer)
+	c.buf[d], c.block[d] = nil, nil
+	c.dead[d] = true
+}
+
+// Feed decodes the frames completed by data, sent by the client or the
+// server.
+func (c *HTTP2Conn) Feed(fromServer bool, data []byte) []HTTP2Frame {
+	d := dir(fromServer)
+	if c.dead[d] {
+		return nil
+	}
+	fed := len(data)
+	if n := min(c.skip[d], len(data)); n > 0 {
+		c.skip[d] -= n
+		data = data[n:]
+	}
+	// origin is where the buffer starts in the bytes fed; what was
+	// buffered before came in earlier segments
+	origin := fed - len(data) - len(c.buf[d])
+	c.buf[d] = append(c.buf[d], data...)
+
+	var frames []HTTP2Frame
+	if d == 0 && !c.preface {
+		b := c.buf[0]
+		n := min(len(b), len(HTTP2Preface))
+		if string(b[:n]) != HTTP2Preface[:n] {
+			c.preface = true // not the preface after all; parse frames
+		} else if n < len(HTTP2Preface) {
+			return nil
+		} else {
+			c.preface = true
+			c.buf[0] = b[len(HTTP2Preface):]
+			frames = append(frames, HTTP2Frame{Type: "Magic", Length: len(HTTP2Preface), pos: origin, fed: fed})
+			origin += len(HTTP2Preface)
+		}
+	}
+
+	for len(c.buf[d]) >= http2FrameHeaderLen {
+		b := c.buf[d]
+		length := int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+		f := HTTP2Frame{
+			Flags:    b[4],
+			StreamID: binary.BigEndian.Uint32(b[5:9]) & 0x7fffffff,
+			Length:   length,
+			pos:      origin,
+			fed:      fed,
+		}
+		if int(b[3]) < len(http2FrameTypes) {
+			f.Type = http2FrameTypes[b[3]]
+		} else {
+			f.Type = fmt.Sprintf("UNKNOWN(0x%02x)", b[3])
+		}
+
+		if length > http2MaxBuffered {
+			// Report the frame but skip its payload; a header block this
+			// large leaves the HPACK table unknown
+			if f.Type == "HEADERS" || f.Type == "PUSH_PROMISE" || f.Type == "CONTINUATION" {
+				f.HeadersLost = true
+				c.lost[d] = true
+			}
+			f.GRPCMethod = c.grpc[f.StreamID]
+			frames = append(frames, f)
+			rest := b[http2FrameHeaderLen:]
+			n := min(length, len(rest))
+			c.skip[d] = length - n
+			c.buf[d] = rest[n:]
+			origin += http2FrameHeaderLen + n
+			continue
+		}
+		if len(b) < http2FrameHeaderLen+length {
+			break
+		}
+		c.decodeFrame(d, &f, b[http2FrameHeaderLen:http2FrameHeaderLen+length])
+		frames = append(frames, f)
+		c.buf[d] = b[http2FrameHeaderLen+length:]
+		origin += http2FrameHeaderLen + length
+	}
+	if len(c.buf[d]) == 0 {
+		c.buf[d] = nil
+	}
+	return frames
+}
+
+func dir(fromServer bool) int {
+	if fromServer {
+		return 1
+	}
+	return 0
+}
+
+func (c *HTTP2Conn) decodeFrame(d int, f *HTTP2Frame, p []byte) {
+	switch f.Type {
+	case "HEADERS", "PUSH_PROMISE":
+		if f.Flags&http2FlagPadded != 0 && len(p) > 0 {
+			pad := int(p[0])
+			p = p[1:]
+			if pad > len(p) {
+				return
+			}
+			p = p[:len(p)-pad]
+		}
+		if f.Type == "HEADERS" && f.Flags&http2FlagPriority != 0 {
+			if len(p) < 5 {
+				return
+			}
+			p = p[5:]
+		} else if f.Type == "PUSH_PROMISE" {
+			if len(p) < 4 {
+				return
+			}
+			p = p[4:]
+		}
+		c.block[d] = append(c.block[d][:0], p...)
+		if f.Flags&http2FlagEndHeaders != 0 {
+			c.endHeaders(d, f)
+		}
+	case "CONTINUATION":
+		c.block[d] = append(c.block[d], p...)
+		if f.Flags&http2FlagEndHeaders != 0 {
+			c.endHeaders(d, f)
+		}
+	case "SETTINGS":
+		for i := 0; i+6 <= len(p); i += 6 {
+			id, val := binary.BigEndian.Uint16(p[i:]), binary.BigEndian.Uint32(p[i+2:])
+			name, ok := http2Settings[id]
+			if !ok {
+				name = fmt.Sprintf("0x%x", id)
+			}
+			f.Settings = append(f.Settings, fmt.Sprintf("%s=%d", name, val))
+			// The table size a side advertises bounds the table its peer's
+			// encoder may use when sending to it
+			if id == 1 {
+				c.dec[1-d].SetAllowedMaxDynamicTableSize(val)
+			}
+		}
+	case "DATA":
+		key := uint64(f.StreamID)<<1 | uint64(d)
+		body, ok := c.doh[key]
+		if !ok {
+			break
+		}
+		if f.Flags&http2FlagPadded != 0 && len(p) > 0 {
+			pad := int(p[0])
+			p = p[1:]
+			if pad > len(p) {
+				pad = len(p)
+			}
+			p = p[:len(p)-pad]
+		}
+		if len(body)+len(p) > maxDNSMessage {
+			delete(c.doh, key)
+			break
+		}
+		body = append(body, p...)
+		c.doh[key] = body
+		if f.Flags&http2FlagEndStream != 0 {
+			f.DNSMessage = body
+			delete(c.doh, key)
+		}
+	case "RST_STREAM":
+		if len(p) >= 4 {
+			f.ErrorCode = http2ErrorString(binary.BigEndian.Uint32(p))
+		}
+		delete(c.doh, uint64(f.StreamID)<<1)
+		delete(c.doh, uint64(f.StreamID)<<1|1)
+	case "GOAWAY":
+		if len(p) >= 8 {
+			f.LastStreamID = binary.BigEndian.Uint32(p) & 0x7fffffff
+			f.ErrorCode = http2ErrorString(binary.BigEndian.Uint32(p[4:]))
+		}
+	case "WINDOW_UPDATE":
+		if len(p) >= 4 {
+			f.Increment = binary.BigEndian.Uint32(p) & 0x7fffffff
+		}
+	}
+	f.GRPCMethod = c.grpc[f.StreamID]
+}
+
+// endHeaders decodes the completed header block and notes gRPC streams.
+func (c *HTTP2Conn) endHeaders(d int, f *HTTP2Frame) {
+	block := c.block[d]
+	c.block[d] = nil
+	if c.lost[d] {
+		f.HeadersLost = true
+		return
+	}
+	fields, err := c.dec[d].DecodeFull(block)
+	if err != nil {
+		// A decoding error leaves the dynamic table out of sync
+		f.HeadersLost = true
+		c.lost[d] = true
+		return
+	}
+	for _, hf := range fields {
+		f.Headers = append(f.Headers, HTTP2Header{Name: hf.Name, Value: hf.Value})
+	}
+	if d == 0 && strings.HasPrefix(f.Header("content-type"), "application/grpc") {
+		c.grpc[f.StreamID] = f.Header(":path")
+		c.grpcSeen = true
+	}
+	if ct, _, _ := strings.Cut(f.Header("content-type"), ";"); strings.EqualFold(strings.TrimSpace(ct), DNSMessageType) {
+		if f.Flags&http2FlagEndStream == 0 && len(c.doh) < 1024 {
+			c.doh[uint64(f.StreamID)<<1|uint64(d)] = []byte{}
+		}
+	} else if d == 0 && f.Header(":method") == "GET" {
+		f.DNSMessage = DoHQueryMessage(f.Header(":path"))
+	}
+}
+
+func http2ErrorString(code uint32) string {
+	if int(code) < len(http2Errors) {
+		return http2Errors[code]
+	}
+	return fmt.Sprintf("0x%x", code)
+}
+
+// IsHTTP2Preface reports whether payload starts with the client preface.
+func IsHTTP2Preface(payload []byte) bool {
+	return bytes.HasPrefix(payload, []byte(HTTP2Preface))
+}
+
+// http2Frames is the per-packet HTTP/2 decode attached by AttachHTTP2.
+type http2Frames struct {
+	frames []HTTP2Frame
+	grpc   bool
+}
+
+// AttachHTTP2 attaches the HTTP/2 frames decoded from pkt's payload, so
+// that Parse can describe them. grpc marks packets of gRPC connections.
+func AttachHTTP2(pkt gopacket.Packet, frames []HTTP2Frame, grpc bool) {
+	if len(frames) == 0 {
+		return
+	}
+	md := pkt.Metadata()
+	md.AncillaryData = append(md.AncillaryData, http2Frames{frames, grpc})
+}
+
+// HTTP2From returns the HTTP/2 frames attached to pkt and whether its
+// connection carries gRPC.
+func HTTP2From(pkt gopacket.Packet) ([]HTTP2Frame, bool) {
+	for _, a := range pkt.Metadata().AncillaryData {
+		if h, ok := a.(http2Frames); ok {
+			return h.frames, h.grpc
+		}
+	}
+	return nil, false
+}
+
+// http2Summary returns the protocol and info column for a packet carrying
+// HTTP/2 frames.
+func http2Summary(frames []HTTP2Frame, grpc bool) (string, string) {
+	proto := "HTTP2"
+	if grpc {
+		proto = "gRPC"
+	} else if isDoHExchange(frames) {
+		proto = "DoH"
+	}
+	parts := make([]string, 0, len(frames))
+	for i := range frames {
+		s := frames[i].Summary()
+		if dns := DecodeDNSMessage(frames[i].DNSMessage); dns != nil {
+			s += " DNS " + DNSSummary(dns)
+		}
+		parts = append(parts, s)
+	}
+	return proto, strings.Join(parts, ", ")
+}
+
+func buildDoHLayerDetail(dns *layers.DNS) models.LayerDetail {
+	detail := parseDNS(dns)
+	detail.Name = "DNS over HTTPS"
+	return detail
+}
+
+// buildHTTP2LayerDetail describes the frames a segment completed; n is the
+// length of its TCP payload, which the fields' offsets are relative to.
+func buildHTTP2LayerDetail(frames []HTTP2Frame, grpc bool, n int) models.LayerDetail {
+	name := "HTTP/2"
+	if grpc {
+		name = "HTTP/2 (gRPC)"
+	}
+	detail := models.LayerDetail{Name: name}
+	for i := range frames {
+		f := &frames[i]
+		at := func(off, size int) span { return f.span(off, size).shift(n) }
+		// The payload follows the 9-byte frame header. HPACK packs a
+		// header block's fields, so each is placed on the whole payload.
+		payload := at(http2FrameHeaderLen, f.Length)
+		var children []models.LayerField
+		if f.Type != "Magic" {
+			children = append(children,
+				at(5, 4).field("Stream ID", fmt.Sprintf("%d", f.StreamID)),
+				at(0, 3).field("Length", fmt.Sprintf("%d", f.Length)),
+				at(4, 1).field("Flags", fmt.Sprintf("0x%02x", f.Flags)),
+			)
+		}
+		for j, s := range f.Settings {
+			k, v, _ := strings.Cut(s, "=")
+			children = append(children, at(http2FrameHeaderLen+6*j, 6).field(k, v))
+		}
+		for _, h := range f.Headers {
+			children = append(children, payload.field(h.Name, h.Value))
+		}
+		if f.HeadersLost {
+			children = append(children, payload.field("Headers", "Not decoded: earlier frames of this connection were not captured"))
+		}
+		if f.GRPCMethod != "" {
+			// From the stream's request headers, not this frame
+			children = append(children, models.LayerField{Name: "gRPC Method", Value: f.GRPCMethod})
+		}
+		if st := f.Header("grpc-status"); st != "" {
+			children = append(children, payload.field("gRPC Status", GRPCStatusString(st)))
+		}
+		if f.ErrorCode != "" {
+			codeAt := at(http2FrameHeaderLen, 4)
+			if f.Type == "GOAWAY" {
+				codeAt = at(http2FrameHeaderLen+4, 4)
+			}
+			children = append(children, codeAt.field("Error Code", f.ErrorCode))
+		}
+		if f.Type == "GOAWAY" {
+			children = append(children, at(http2FrameHeaderLen, 4).field("Last Stream ID", fmt.Sprintf("%d", f.LastStreamID)))
+		}
+		if f.Type == "WINDOW_UPDATE" {
+			children = append(children, at(http2FrameHeaderLen, 4).field("Window Increment", fmt.Sprintf("%d", f.Increment)))
+		}
+		size := http2FrameHeaderLen + f.Length
+		if f.Type == "Magic" {
+			size = f.Length
+		}
+		top := at(0, size).field(f.Summary(), f.Type)
+		top.Children = children
+		detail.Fields = append(detail.Fields, top)
+	}
+	return detail
+}
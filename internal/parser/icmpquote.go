@@ -0,0 +1,216 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+// ICMPQuote is the start of the datagram an ICMP error was sent about:
+// its IP header and, when the quote is long enough, the ports from the
+// first 8 bytes of its payload (RFC 792, RFC 4443).
+type ICMPQuote struct {
+	Version  int
+	SrcIP    string
+	DstIP    string
+	Protocol string // as ExtractFlowTuple names it: TCP, UDP, ICMPv4, ...
+	TTL      int
+	ID       uint16 // IPv4 identification
+	Length   int    // total length of the original datagram
+	SrcPort  uint16
+	DstPort  uint16
+	HasPorts bool
+	TCPSeq   uint32 // TCP only
+	// ICMP echo quoted by an error about a ping
+	EchoID  uint16
+	EchoSeq uint16
+	HasEcho bool
+	// Error is the type and code of the ICMP message quoting the datagram,
+	// such as "DestinationUnreachable(Port)"
+	Error string
+
+	size      int // bytes quoted
+	transport int // offset of the transport header in the quote
+}
+
+// String formats the quote as "UDP 10.0.0.1:5353 → 8.8.8.8:53".
+func (q *ICMPQuote) String() string {
+	if q.HasPorts {
+		return fmt.Sprintf("%s %s → %s", q.Protocol,
+			net.JoinHostPort(q.SrcIP, strconv.Itoa(int(q.SrcPort))),
+			net.JoinHostPort(q.DstIP, strconv.Itoa(int(q.DstPort))))
+	}
+	return fmt.Sprintf("%s %s → %s", q.Protocol, q.SrcIP, q.DstIP)
+}
+
+// ExtractICMPQuote returns the datagram quoted by an ICMP or ICMPv6 error
+// message in pkt, or nil for other packets.
+func ExtractICMPQuote(pkt gopacket.Packet) *ICMPQuote {
+	if l := pkt.Layer(layers.LayerTypeICMPv4); l != nil {
+		return icmpv4Quote(l.(*layers.ICMPv4))
+	}
+	if l := pkt.Layer(layers.LayerTypeICMPv6); l != nil {
+		return icmpv6Quote(l.(*layers.ICMPv6))
+	}
+	return nil
+}
+
+func icmpv4Quote(icmp *layers.ICMPv4) *ICMPQuote {
+	switch icmp.TypeCode.Type() {
+	case layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4TypeSourceQuench,
+		layers.ICMPv4TypeRedirect, layers.ICMPv4TypeTimeExceeded, layers.ICMPv4TypeParameterProblem:
+		if q := parseQuotedIPv4(icmp.Payload); q != nil {
+			q.Error = icmp.TypeCode.String()
+			return q
+		}
+	}
+	return nil
+}
+
+func icmpv6Quote(icmp *layers.ICMPv6) *ICMPQuote {
+	switch icmp.TypeCode.Type() {
+	case layers.ICMPv6TypeDestinationUnreachable, layers.ICMPv6TypePacketTooBig,
+		layers.ICMPv6TypeTimeExceeded, layers.ICMPv6TypeParameterProblem:
+		// 4 bytes of unused, MTU or pointer precede the quote
+		if len(icmp.Payload) <= 4 {
+			return nil
+		}
+		if q := parseQuotedIPv6(icmp.Payload[4:]); q != nil {
+			q.Error = icmp.TypeCode.String()
+			return q
+		}
+	}
+	return nil
+}
+
+func parseQuotedIPv4(b []byte) *ICMPQuote {
+	if len(b) < 20 || b[0]>>4 != 4 {
+		return nil
+	}
+	ihl := int(b[0]&0x0f) * 4
+	if ihl < 20 || len(b) < ihl {
+		return nil
+	}
+	proto := layers.IPProtocol(b[9])
+	q := &ICMPQuote{
+		Version:  4,
+		Length:   int(binary.BigEndian.Uint16(b[2:4])),
+		ID:       binary.BigEndian.Uint16(b[4:6]),
+		TTL:      int(b[8]),
+		Protocol: proto.String(),
+		SrcIP:    net.IP(b[12:16]).String(),
+		DstIP:    net.IP(b[16:20]).String(),
+		size:     len(b),
+	}
+	// Only the first fragment carries the transport header
+	if binary.BigEndian.Uint16(b[6:8])&0x1fff == 0 {
+		q.readTransport(proto, b, ihl)
+	}
+	return q
+}
+
+func parseQuotedIPv6(b []byte) *ICMPQuote {
+	if len(b) < 40 || b[0]>>4 != 6 {
+		return nil
+	}
+	q := &ICMPQuote{
+		Version: 6,
+		Length:  40 + int(binary.BigEndian.Uint16(b[4:6])),
+		TTL:     int(b[7]),
+		SrcIP:   net.IP(b[8:24]).String(),
+		DstIP:   net.IP(b[24:40]).String(),
+		size:    len(b),
+	}
+	// Walk the extension headers to the transport header
+	next, rest := layers.IPProtocol(b[6]), b[40:]
+	for {
+		switch next {
+		case layers.IPProtocolIPv6HopByHop, layers.IPProtocolIPv6Routing, layers.IPProtocolIPv6Destination:
+			if len(rest) < 2 || len(rest) < (int(rest[1])+1)*8 {
+				q.Protocol = next.String()
+				return q
+			}
+			next, rest = layers.IPProtocol(rest[0]), rest[(int(rest[1])+1)*8:]
+			continue
+		case layers.IPProtocolIPv6Fragment:
+			if len(rest) < 8 || binary.BigEndian.Uint16(rest[2:4])&0xfff8 != 0 {
+				q.Protocol = next.String()
+				return q
+			}
+			next, rest = layers.IPProtocol(rest[0]), rest[8:]
+			continue
+		}
+		break
+	}
+	q.Protocol = next.String()
+	q.readTransport(next, b, len(b)-len(rest))
+	return q
+}
+
+// readTransport reads ports (or the echo identifier) from the transport
+// header at off in the quote.
+func (q *ICMPQuote) readTransport(proto layers.IPProtocol, quote []byte, off int) {
+	q.transport = off
+	b := quote[off:]
+	switch proto {
+	case layers.IPProtocolTCP, layers.IPProtocolUDP, layers.IPProtocolSCTP, layers.IPProtocolUDPLite:
+		if len(b) >= 4 {
+			q.SrcPort = binary.BigEndian.Uint16(b[0:2])
+			q.DstPort = binary.BigEndian.Uint16(b[2:4])
+			q.HasPorts = true
+		}
+		if proto == layers.IPProtocolTCP && len(b) >= 8 {
+			q.TCPSeq = binary.BigEndian.Uint32(b[4:8])
+		}
+	case layers.IPProtocolICMPv4, layers.IPProtocolICMPv6:
+		// Echo request (8, or 128 for ICMPv6)
+		if len(b) >= 8 && (b[0] == 8 || b[0] == 128) {
+			q.EchoID = binary.BigEndian.Uint16(b[4:6])
+			q.EchoSeq = binary.BigEndian.Uint16(b[6:8])
+			q.HasEcho = true
+		}
+	}
+}
+
+// icmpQuoteField describes the quoted datagram, which starts base bytes
+// into the ICMP layer, as a child tree of the layer.
+func icmpQuoteField(q *ICMPQuote, base int) models.LayerField {
+	f := models.LayerField{Name: "Original Datagram", Value: q.String(), Offset: base, Length: q.size}
+	add := func(name, value string, off, n int) {
+		f.Children = append(f.Children, models.LayerField{Name: name, Value: value, Offset: base + off, Length: n})
+	}
+	t := q.transport
+	add("Version", strconv.Itoa(q.Version), 0, 1)
+	if q.Version == 4 {
+		add("Source", q.SrcIP, 12, 4)
+		add("Destination", q.DstIP, 16, 4)
+		add("Protocol", q.Protocol, 9, 1)
+		add("Identification", fmt.Sprintf("0x%04x", q.ID), 4, 2)
+		add("Time to Live", strconv.Itoa(q.TTL), 8, 1)
+		add("Total Length", strconv.Itoa(q.Length), 2, 2)
+	} else {
+		add("Source", q.SrcIP, 8, 16)
+		add("Destination", q.DstIP, 24, 16)
+		add("Protocol", q.Protocol, 6, 1)
+		add("Hop Limit", strconv.Itoa(q.TTL), 7, 1)
+		add("Total Length", strconv.Itoa(q.Length), 4, 2)
+	}
+	if q.HasPorts {
+		add("Source Port", strconv.Itoa(int(q.SrcPort)), t, 2)
+		add("Destination Port", strconv.Itoa(int(q.DstPort)), t+2, 2)
+	}
+	if q.Protocol == "TCP" && q.HasPorts && q.size >= t+8 {
+		add("Sequence Number", strconv.FormatUint(uint64(q.TCPSeq), 10), t+4, 4)
+	}
+	if q.HasEcho {
+		add("Echo Identifier", fmt.Sprintf("0x%04x", q.EchoID), t+4, 2)
+		add("Echo Sequence", strconv.Itoa(int(q.EchoSeq)), t+6, 2)
+	}
+	return f
+}
@@ -0,0 +1,224 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// ICSOperation is one industrial-protocol request or response. Client is
+// the master/HMI side and Server the PLC/RTU, whichever direction the
+// packet travels.
+type ICSOperation struct {
+	Protocol  string // Modbus, DNP3, S7comm
+	Client    string
+	Server    string
+	Unit      string // Modbus unit ID or DNP3 outstation address
+	Function  string
+	Response  bool
+	Exception bool
+	Write     bool     // changes process state: writes, operates, downloads
+	Critical  bool     // restarts, stops, firmware/program transfers
+	Targets   []string // addresses read or written, when the request names them
+}
+
+// ExtractICS decodes a Modbus/TCP (502), DNP3 (20000) or S7comm (102)
+// payload.
+func ExtractICS(pkt gopacket.Packet) *ICSOperation {
+	app := pkt.ApplicationLayer()
+	if app == nil || pkt.NetworkLayer() == nil {
+		return nil
+	}
+	data := app.LayerContents()
+	src, dst := pkt.NetworkLayer().NetworkFlow().Endpoints()
+	srcPort, dstPort := getPortFromPkt(pkt, "src"), getPortFromPkt(pkt, "dst")
+
+	var op *ICSOperation
+	switch {
+	case pkt.Layer(layers.LayerTypeTCP) != nil && (srcPort == 502 || dstPort == 502) && isModbus(data):
+		op = parseModbusOp(data, srcPort == 502)
+	case (srcPort == 20000 || dstPort == 20000) && len(data) >= 10 && data[0] == 0x05 && data[1] == 0x64:
+		op = parseDNP3Op(data)
+	case pkt.Layer(layers.LayerTypeTCP) != nil && (srcPort == 102 || dstPort == 102):
+		op = parseS7Op(data)
+	}
+	if op == nil {
+		return nil
+	}
+	op.Client, op.Server = src.String(), dst.String()
+	if op.Response {
+		op.Client, op.Server = op.Server, op.Client
+	}
+	return op
+}
+
+// ==================== Modbus ====================
+
+func parseModbusOp(data []byte, response bool) *ICSOperation {
+	fc := data[7]
+	op := &ICSOperation{
+		Protocol: "Modbus",
+		Unit:     fmt.Sprintf("%d", data[6]),
+		Response: response,
+	}
+	if fc&0x80 != 0 {
+		op.Exception = true
+		fc &^= 0x80
+	}
+	op.Function = modbusFunction(fc)
+	if op.Function == "Unknown" {
+		op.Function = fmt.Sprintf("Function %d", fc)
+	}
+	switch fc {
+	case 5, 6, 15, 16, 22, 23:
+		op.Write = true
+	case 8:
+		// Diagnostics sub-function 1 restarts communications
+		op.Critical = len(data) >= 10 && binary.BigEndian.Uint16(data[8:10]) == 1
+	}
+	if !response && len(data) >= 12 {
+		addr := binary.BigEndian.Uint16(data[8:10])
+		switch fc {
+		case 1, 2, 3, 4, 15, 16, 23:
+			op.Targets = []string{fmt.Sprintf("%d+%d", addr, binary.BigEndian.Uint16(data[10:12]))}
+		case 5, 6, 22:
+			op.Targets = []string{fmt.Sprintf("%d", addr)}
+		}
+	}
+	return op
+}
+
+// ==================== DNP3 ====================
+
+var dnp3Functions = map[byte]string{
+	0: "Confirm", 1: "Read", 2: "Write", 3: "Select", 4: "Operate",
+	5: "Direct Operate", 6: "Direct Operate No Ack", 7: "Immediate Freeze",
+	8: "Immediate Freeze No Ack", 9: "Freeze Clear", 10: "Freeze Clear No Ack",
+	13: "Cold Restart", 14: "Warm Restart", 15: "Initialize Data",
+	16: "Initialize Application", 17: "Start Application", 18: "Stop Application",
+	20: "Enable Unsolicited", 21: "Disable Unsolicited", 23: "Delay Measure",
+	24: "Record Current Time", 25: "Open File", 26: "Close File", 27: "Delete File",
+	129: "Response", 130: "Unsolicited Response",
+}
+
+// parseDNP3Op reads the link header and the application function code at
+// the start of the first user data block (after its transport header).
+func parseDNP3Op(data []byte) *ICSOperation {
+	ctrl := data[3]
+	dstAddr := binary.LittleEndian.Uint16(data[4:6])
+	srcAddr := binary.LittleEndian.Uint16(data[6:8])
+	// Header block is 8 bytes + 2 CRC; user data needs transport + app
+	// control + function code
+	if len(data) < 13 || ctrl&0x0f != 0x04 && ctrl&0x0f != 0x03 {
+		return nil
+	}
+	fc := data[12]
+	name, ok := dnp3Functions[fc]
+	if !ok {
+		name = fmt.Sprintf("Function %d", fc)
+	}
+	op := &ICSOperation{Protocol: "DNP3", Function: name, Response: fc >= 129}
+	// The outstation is the destination of requests and source of responses
+	if op.Response {
+		op.Unit = fmt.Sprintf("%d", srcAddr)
+	} else {
+		op.Unit = fmt.Sprintf("%d", dstAddr)
+	}
+	switch fc {
+	case 2, 3, 4, 5, 6, 9, 10, 15, 27:
+		op.Write = true
+	case 13, 14, 16, 17, 18:
+		op.Write, op.Critical = true, true
+	}
+	return op
+}
+
+// ==================== S7comm ====================
+
+var s7Functions = map[byte]string{
+	0x00: "CPU Services", 0x04: "Read Var", 0x05: "Write Var",
+	0x1a: "Request Download", 0x1b: "Download Block", 0x1c: "Download Ended",
+	0x1d: "Start Upload", 0x1e: "Upload", 0x1f: "End Upload",
+	0x28: "PI Service", 0x29: "PLC Stop", 0xf0: "Setup Communication",
+}
+
+var s7Areas = map[byte]string{
+	0x81: "I", 0x82: "Q", 0x83: "M", 0x84: "DB", 0x1c: "C", 0x1d: "T",
+}
+
+// parseS7Op reads TPKT, COTP DT and the S7 header and parameter block.
+func parseS7Op(data []byte) *ICSOperation {
+	if len(data) < 7 || data[0] != 0x03 {
+		return nil
+	}
+	cotpLen := int(data[4])
+	if len(data) < 5+cotpLen+1 || data[5] != 0xf0 {
+		return nil
+	}
+	s7 := data[5+cotpLen:]
+	if len(s7) < 10 || s7[0] != 0x32 {
+		return nil
+	}
+	rosctr := s7[1]
+	if rosctr != 1 && rosctr != 3 {
+		return nil // userdata and bare acks carry no operation
+	}
+	paramLen := int(binary.BigEndian.Uint16(s7[6:8]))
+	hdrLen := 10
+	if rosctr == 3 {
+		hdrLen = 12
+	}
+	if len(s7) < hdrLen+1 || paramLen == 0 {
+		return nil
+	}
+	param := s7[hdrLen:min(len(s7), hdrLen+paramLen)]
+	fc := param[0]
+	name, ok := s7Functions[fc]
+	if !ok {
+		name = fmt.Sprintf("Function 0x%02x", fc)
+	}
+	op := &ICSOperation{Protocol: "S7comm", Function: name, Response: rosctr == 3}
+	if op.Response && s7[10] != 0 {
+		op.Exception = true
+	}
+	switch fc {
+	case 0x05:
+		op.Write = true
+	case 0x1a, 0x1b, 0x1c, 0x28, 0x29:
+		op.Write, op.Critical = true, true
+	}
+	if !op.Response && (fc == 0x04 || fc == 0x05) && len(param) >= 2 {
+		op.Targets = s7Items(param[2:], int(param[1]))
+	}
+	return op
+}
+
+// s7Items decodes S7ANY item addresses as "DB1.10.0" (block.byte.bit) or
+// "M5.0".
+func s7Items(b []byte, count int) []string {
+	var out []string
+	for i := 0; i < count && len(b) >= 12; i++ {
+		if b[0] != 0x12 || b[2] != 0x10 {
+			break
+		}
+		n := int(b[1]) + 2
+		dbNum := binary.BigEndian.Uint16(b[6:8])
+		area, ok := s7Areas[b[8]]
+		if !ok {
+			area = fmt.Sprintf("0x%02x", b[8])
+		}
+		bitAddr := int(b[9])<<16 | int(b[10])<<8 | int(b[11])
+		if area == "DB" {
+			out = append(out, fmt.Sprintf("DB%d.%d.%d", dbNum, bitAddr>>3, bitAddr&7))
+		} else {
+			out = append(out, fmt.Sprintf("%s%d.%d", area, bitAddr>>3, bitAddr&7))
+		}
+		if n < 12 || len(b) < n {
+			break
+		}
+		b = b[n:]
+	}
+	return out
+}
@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"strings"
+
+	"sniffox/internal/models"
+)
+
+// infoTemplates holds the English text of each Info message. A {name} is
+// replaced with the part's argument of that name; parts are concatenated,
+// so a part that follows another starts with its own separator.
+var infoTemplates = map[string]string{
+	// Summaries from dissectors that still produce a finished string
+	"text":   "{text}",
+	"suffix": " {text}",
+
+	"tls.handshake":    "Handshake",
+	"tls.server_hello": "Server Hello, {version}, {cipher}",
+	"tls.alpn":         ", ALPN={alpn}",
+	"tls.client_hello": "Client Hello, SNI={sni}",
+	"tls.ja3":          " [JA3:{ja3}]",
+	"tls.app_data":     "Application Data",
+	"tls.ccs":          "Change Cipher Spec",
+	"tls.alert":        "Alert",
+
+	"http.request":  "{method} {uri}",
+	"http.response": "{status} {reason}",
+
+	"ntp":  "NTPv{version} {mode} Stratum={stratum}",
+	"dhcp": "DHCP {type} XID={xid}",
+
+	"dhcpv6":       "DHCPv6 {type} XID={xid}",
+	"dhcpv6.relay": "DHCPv6 {type} Peer={peer}",
+
+	"igmp":           "IGMP",
+	"igmp.query":     "Membership Query",
+	"igmp.v1_report": "IGMPv1 Membership Report",
+	"igmp.v2_report": "IGMPv2 Membership Report",
+	"igmp.leave":     "Leave Group",
+	"igmp.type":      "Type {type}",
+	"igmp.group":     " {group}",
+
+	"gre":        "Encapsulated {protocol}",
+	"stp":        "Spanning Tree Protocol",
+	"icmp":       "{name}",
+	"icmp.quote": " (original {quote})",
+
+	"ndp.ns":       " Who has {target}?",
+	"ndp.target":   " {target}",
+	"ndp.lladdr":   " is at {mac}",
+	"ndp.redirect": " {destination} via {target}",
+	"ndp.prefixes": " Prefix {prefixes}",
+
+	"tcp": "{srcPort} -> {dstPort} [{flags}] Seq={seq} Ack={ack} Win={win} Len={len}",
+	"udp": "{srcPort} -> {dstPort} Len={len}",
+
+	"arp.request": "Who has {target}? Tell {sender}",
+	"arp.reply":   "{sender} is at {mac}",
+
+	"vlan": "VLAN {tags}: ",
+	"mpls": "MPLS {labels}: ",
+
+	"tunnel":         "{kind} {vni}: ",
+	"erspan":         "ERSPAN: ",
+	"erspan.session": "ERSPAN {session}: ",
+	"gtpu":           "GTP-U {teid}: ",
+
+	"malformed": " [Malformed: {reason}]",
+}
+
+// InfoTemplates returns the English template of every Info message ID,
+// the string table a translation starts from.
+func InfoTemplates() map[string]string {
+	out := make(map[string]string, len(infoTemplates))
+	for id, t := range infoTemplates {
+		out[id] = t
+	}
+	return out
+}
+
+// infoPart builds a part from its ID and name/value pairs.
+func infoPart(id string, kv ...string) models.InfoPart {
+	p := models.InfoPart{ID: id}
+	if len(kv) > 0 {
+		p.Args = make(map[string]string, len(kv)/2)
+		for i := 0; i+1 < len(kv); i += 2 {
+			p.Args[kv[i]] = kv[i+1]
+		}
+	}
+	return p
+}
+
+// infoText wraps a finished summary string as a part.
+func infoText(s string) []models.InfoPart {
+	if s == "" {
+		return nil
+	}
+	return []models.InfoPart{infoPart("text", "text", s)}
+}
+
+// RenderInfo renders parts with the English templates.
+func RenderInfo(parts []models.InfoPart) string {
+	var sb strings.Builder
+	for _, p := range parts {
+		t := infoTemplates[p.ID]
+		for {
+			open := strings.IndexByte(t, '{')
+			if open < 0 {
+				break
+			}
+			end := strings.IndexByte(t[open:], '}')
+			if end < 0 {
+				break
+			}
+			sb.WriteString(t[:open])
+			sb.WriteString(p.Args[t[open+1:open+end]])
+			t = t[open+end+1:]
+		}
+		sb.WriteString(t)
+	}
+	return sb.String()
+}
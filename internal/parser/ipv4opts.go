@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+// IPv4 option types (RFC 791, RFC 1108, RFC 2113).
+const (
+	IPv4OptEnd         = 0
+	IPv4OptNOP         = 1
+	IPv4OptRecordRoute = 7
+	IPv4OptTimestamp   = 68
+	IPv4OptSecurity    = 130
+	IPv4OptLSRR        = 131
+	IPv4OptStreamID    = 136
+	IPv4OptSSRR        = 137
+	IPv4OptRouterAlert = 148
+)
+
+var ipv4OptNames = map[uint8]string{
+	IPv4OptEnd:         "End of Options",
+	IPv4OptNOP:         "No-Operation",
+	IPv4OptRecordRoute: "Record Route",
+	IPv4OptTimestamp:   "Timestamp",
+	IPv4OptSecurity:    "Security",
+	IPv4OptLSRR:        "Loose Source Route",
+	IPv4OptStreamID:    "Stream ID",
+	IPv4OptSSRR:        "Strict Source Route",
+	IPv4OptRouterAlert: "Router Alert",
+}
+
+// IPv4Option is one option of an IPv4 header.
+type IPv4Option struct {
+	Type   uint8
+	Offset int    // from the start of the IPv4 header
+	Length int    // of the whole option, type and length included
+	Data   []byte // after the type and length bytes
+}
+
+// Name returns the option's name.
+func (o IPv4Option) Name() string {
+	if n, ok := ipv4OptNames[o.Type]; ok {
+		return n
+	}
+	return fmt.Sprintf("Option %d", o.Type)
+}
+
+// IsSourceRoute reports whether o is a loose or strict source route.
+func (o IPv4Option) IsSourceRoute() bool {
+	return o.Type == IPv4OptLSRR || o.Type == IPv4OptSSRR
+}
+
+// Route returns the addresses of a record route or source route option
+// and the index of the slot its pointer names: addresses before it were
+// recorded or already visited, the one at it is the next.
+func (o IPv4Option) Route() (addrs []net.IP, next int) {
+	if len(o.Data) < 1 {
+		return nil, 0
+	}
+	for i := 1; i+4 <= len(o.Data); i += 4 {
+		addrs = append(addrs, net.IP(o.Data[i:i+4]))
+	}
+	// The pointer counts from the option's first byte and starts at 4
+	return addrs, (int(o.Data[0]) - 4) / 4
+}
+
+// IPv4Options returns the options of ip's header. Parsing stops at the
+// end-of-options marker or an option that runs past the header.
+func IPv4Options(ip *layers.IPv4) []IPv4Option {
+	hdr := int(ip.IHL) * 4
+	if hdr <= 20 || len(ip.Contents) < hdr {
+		return nil
+	}
+	var out []IPv4Option
+	for i := 20; i < hdr; {
+		t := ip.Contents[i]
+		if t == IPv4OptEnd || t == IPv4OptNOP {
+			out = append(out, IPv4Option{Type: t, Offset: i, Length: 1})
+			if t == IPv4OptEnd {
+				break
+			}
+			i++
+			continue
+		}
+		if i+1 >= hdr {
+			break
+		}
+		n := int(ip.Contents[i+1])
+		if n < 2 || i+n > hdr {
+			break
+		}
+		out = append(out, IPv4Option{Type: t, Offset: i, Length: n, Data: ip.Contents[i+2 : i+n]})
+		i += n
+	}
+	return out
+}
+
+// ipv4OptionsField describes the options of ip as a field with one child
+// per option, or returns false if it has none.
+func ipv4OptionsField(ip *layers.IPv4) (models.LayerField, bool) {
+	opts := IPv4Options(ip)
+	if len(opts) == 0 {
+		return models.LayerField{}, false
+	}
+	n := int(ip.IHL)*4 - 20
+	f := models.LayerField{Name: "Options", Value: fmt.Sprintf("%d bytes", n), Offset: 20, Length: n}
+	for _, o := range opts {
+		f.Children = append(f.Children, ipv4OptionField(o))
+	}
+	return f, true
+}
+
+func ipv4OptionField(o IPv4Option) models.LayerField {
+	f := models.LayerField{Name: o.Name(), Offset: o.Offset, Length: o.Length}
+	ptr := models.LayerField{Name: "Pointer", Offset: o.Offset + 2, Length: 1}
+	switch o.Type {
+	case IPv4OptEnd, IPv4OptNOP:
+	case IPv4OptRecordRoute, IPv4OptLSRR, IPv4OptSSRR:
+		addrs, next := o.Route()
+		if len(o.Data) > 0 {
+			ptr.Value = fmt.Sprintf("%d", o.Data[0])
+			f.Children = append(f.Children, ptr)
+		}
+		var hops []string
+		for i, a := range addrs {
+			name, value := "Hop", a.String()
+			switch {
+			case o.Type == IPv4OptRecordRoute && i >= next:
+				name, value = "Empty Slot", "-"
+			case o.Type == IPv4OptRecordRoute:
+				name = "Recorded Hop"
+			case i == next:
+				value += " (next)"
+			}
+			if name != "Empty Slot" {
+				hops = append(hops, a.String())
+			}
+			f.Children = append(f.Children, models.LayerField{Name: name, Value: value, Offset: o.Offset + 3 + 4*i, Length: 4})
+		}
+		if o.Type == IPv4OptRecordRoute {
+			f.Value = fmt.Sprintf("%d of %d slots recorded", min(next, len(addrs)), len(addrs))
+		} else {
+			f.Value = "via " + strings.Join(hops, ", ")
+		}
+	case IPv4OptTimestamp:
+		f.Value, f.Children = ipv4TimestampFields(o, ptr)
+	case IPv4OptRouterAlert:
+		if len(o.Data) == 2 {
+			f.Value = fmt.Sprintf("%d", binary.BigEndian.Uint16(o.Data))
+		}
+	default:
+		f.Value = fmt.Sprintf("%x", o.Data)
+	}
+	return f
+}
+
+// ipv4TimestampFields describes a timestamp option (RFC 791): a pointer,
+// an overflow count and flag, then timestamps in milliseconds since
+// midnight UT, each after an address unless the flag is 0.
+func ipv4TimestampFields(o IPv4Option, ptr models.LayerField) (string, []models.LayerField) {
+	if len(o.Data) < 2 {
+		return "", nil
+	}
+	ptr.Value = fmt.Sprintf("%d", o.Data[0])
+	flag := o.Data[1] & 0x0f
+	flags := map[byte]string{0: "Timestamps only", 1: "Address and timestamp", 3: "Prespecified addresses"}
+	flagName, ok := flags[flag]
+	if !ok {
+		flagName = fmt.Sprintf("Unknown (%d)", flag)
+	}
+	fields := []models.LayerField{
+		ptr,
+		{Name: "Overflow", Value: fmt.Sprintf("%d", o.Data[1]>>4), Offset: o.Offset + 3, Length: 1},
+		{Name: "Flag", Value: flagName, Offset: o.Offset + 3, Length: 1},
+	}
+	entry := 4
+	if flag != 0 {
+		entry = 8
+	}
+	// Entries before the pointer have been filled in
+	used := int(o.Data[0]) - 5
+	count := 0
+	for i := 2; i+entry <= len(o.Data) && i-2 < used; i += entry {
+		value := fmt.Sprintf("%d ms", binary.BigEndian.Uint32(o.Data[i+entry-4:]))
+		if entry == 8 {
+			value = net.IP(o.Data[i:i+4]).String() + " at " + value
+		}
+		fields = append(fields, models.LayerField{Name: "Timestamp", Value: value, Offset: o.Offset + 2 + i, Length: entry})
+		count++
+	}
+	return fmt.Sprintf("%d recorded, %s", count, strings.ToLower(flagName)), fields
+}
@@ -0,0 +1,298 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+// maxIPv6ExtHeaders caps the extension headers walked in one packet, so a
+// crafted chain cannot make every lookup expensive.
+const maxIPv6ExtHeaders = 16
+
+var ipv6ExtNames = map[layers.IPProtocol]string{
+	layers.IPProtocolIPv6HopByHop:    "Hop-by-Hop Options",
+	layers.IPProtocolIPv6Routing:     "Routing",
+	layers.IPProtocolIPv6Fragment:    "Fragment",
+	layers.IPProtocolIPv6Destination: "Destination Options",
+	layers.IPProtocolAH:              "Authentication Header",
+}
+
+// IPv6ExtHeader is one extension header of an IPv6 packet.
+type IPv6ExtHeader struct {
+	Type   layers.IPProtocol
+	Next   layers.IPProtocol // the header after this one
+	Offset int               // from the start of the IPv6 header
+	Length int               // of the whole header
+	Data   []byte            // after the next header and length bytes
+}
+
+// Name returns the header's name.
+func (h IPv6ExtHeader) Name() string {
+	if n, ok := ipv6ExtNames[h.Type]; ok {
+		return n
+	}
+	return h.Type.String()
+}
+
+// Fragment returns the fields of a fragment header: the offset in bytes,
+// the more fragments flag and the identification.
+func (h IPv6ExtHeader) Fragment() (offset int, more bool, id uint32, ok bool) {
+	if h.Type != layers.IPProtocolIPv6Fragment || len(h.Data) < 6 {
+		return 0, false, 0, false
+	}
+	fo := binary.BigEndian.Uint16(h.Data[0:2])
+	return int(fo &^ 7), fo&1 != 0, binary.BigEndian.Uint32(h.Data[2:6]), true
+}
+
+// IPv6Chain is the extension header chain of an IPv6 packet.
+type IPv6Chain struct {
+	Headers []IPv6ExtHeader
+	// Protocol is the header after the last extension header: the
+	// transport protocol, or NoNextHeader, ESP, or a header that could
+	// not be walked
+	Protocol layers.IPProtocol
+	// Transport is the offset of the transport header from the start of
+	// the IPv6 header, or 0 if the packet is a non-first fragment or the
+	// chain ends early
+	Transport int
+	transport []byte
+}
+
+// TransportBytes returns the transport header and what follows it, or
+// nil when the chain does not reach one.
+func (c IPv6Chain) TransportBytes() []byte {
+	return c.transport
+}
+
+// IPv6ExtHeaders walks the extension header chain of ip. gopacket folds a
+// hop-by-hop header into the IPv6 layer and stops at a fragment header,
+// so the chain is read from the packet bytes.
+func IPv6ExtHeaders(ip *layers.IPv6) IPv6Chain {
+	c := IPv6Chain{Protocol: ip.NextHeader}
+	if _, ext := ipv6ExtNames[ip.NextHeader]; !ext {
+		c.Transport, c.transport = 40, ip.Payload
+		return c
+	}
+	var raw []byte
+	if ip.HopByHop != nil {
+		raw = append(append(append(raw, ip.Contents...), ip.HopByHop.Contents...), ip.Payload...)
+	} else {
+		raw = append(append(raw, ip.Contents...), ip.Payload...)
+	}
+	if len(raw) < 40 {
+		return c
+	}
+	off := 40
+	for len(c.Headers) < maxIPv6ExtHeaders {
+		var n int
+		switch c.Protocol {
+		case layers.IPProtocolIPv6HopByHop, layers.IPProtocolIPv6Routing, layers.IPProtocolIPv6Destination:
+			if off+2 > len(raw) {
+				return c
+			}
+			n = (int(raw[off+1]) + 1) * 8
+		case layers.IPProtocolIPv6Fragment:
+			n = 8
+		case layers.IPProtocolAH:
+			if off+2 > len(raw) {
+				return c
+			}
+			n = (int(raw[off+1]) + 2) * 4
+		default:
+			c.Transport, c.transport = off, raw[off:]
+			return c
+		}
+		if off+n > len(raw) {
+			return c
+		}
+		h := IPv6ExtHeader{Type: c.Protocol, Next: layers.IPProtocol(raw[off]), Offset: off, Length: n, Data: raw[off+2 : off+n]}
+		c.Headers = append(c.Headers, h)
+		c.Protocol = h.Next
+		off += n
+		// Only the first fragment carries the transport header
+		if fo, _, _, _ := h.Fragment(); fo != 0 {
+			return c
+		}
+	}
+	return c
+}
+
+// ipv6ExtField describes the extension headers of ip as a field with one
+// child per header, or returns false if it has none.
+func ipv6ExtField(ip *layers.IPv6) (models.LayerField, bool) {
+	c := IPv6ExtHeaders(ip)
+	if len(c.Headers) == 0 {
+		return models.LayerField{}, false
+	}
+	names := make([]string, 0, len(c.Headers)+1)
+	n := 0
+	for _, h := range c.Headers {
+		names = append(names, h.Name())
+		n += h.Length
+	}
+	names = append(names, c.Protocol.String())
+	f := models.LayerField{Name: "Extension Headers", Value: strings.Join(names, " → "), Offset: 40, Length: n}
+	for _, h := range c.Headers {
+		f.Children = append(f.Children, ipv6ExtHeaderField(h))
+	}
+	return f, true
+}
+
+func ipv6ExtHeaderField(h IPv6ExtHeader) models.LayerField {
+	f := models.LayerField{Name: h.Name(), Offset: h.Offset, Length: h.Length}
+	f.Children = append(f.Children, models.LayerField{Name: "Next Header", Value: h.Next.String(), Offset: h.Offset, Length: 1})
+	switch h.Type {
+	case layers.IPProtocolIPv6HopByHop, layers.IPProtocolIPv6Destination:
+		opts := ipv6OptionFields(h)
+		f.Value = fmt.Sprintf("%d options", len(opts))
+		f.Children = append(f.Children, opts...)
+	case layers.IPProtocolIPv6Routing:
+		f.Value, f.Children = ipv6RoutingFields(h, f.Children)
+	case layers.IPProtocolIPv6Fragment:
+		fo, more, id, _ := h.Fragment()
+		f.Value = fmt.Sprintf("id 0x%08x, offset %d", id, fo)
+		if more {
+			f.Value += ", more fragments"
+		}
+		f.Children = append(f.Children,
+			models.LayerField{Name: "Fragment Offset", Value: fmt.Sprintf("%d", fo), Offset: h.Offset + 2, Length: 2},
+			models.LayerField{Name: "More Fragments", Value: fmt.Sprintf("%t", more), Offset: h.Offset + 3, Length: 1},
+			models.LayerField{Name: "Identification", Value: fmt.Sprintf("0x%08x", id), Offset: h.Offset + 4, Length: 4},
+		)
+	case layers.IPProtocolAH:
+		if len(h.Data) >= 10 {
+			spi := binary.BigEndian.Uint32(h.Data[2:6])
+			f.Value = fmt.Sprintf("SPI 0x%08x", spi)
+			f.Children = append(f.Children,
+				models.LayerField{Name: "SPI", Value: fmt.Sprintf("0x%08x", spi), Offset: h.Offset + 4, Length: 4},
+				models.LayerField{Name: "Sequence", Value: fmt.Sprintf("%d", binary.BigEndian.Uint32(h.Data[6:10])), Offset: h.Offset + 8, Length: 4},
+			)
+		}
+	}
+	return f
+}
+
+var ipv6OptNames = map[uint8]string{
+	0x00: "Pad1",
+	0x01: "PadN",
+	0x04: "Tunnel Encapsulation Limit",
+	0x05: "Router Alert",
+	0x06: "Quick-Start",
+	0x07: "CALIPSO",
+	0x63: "RPL Option",
+	0xc2: "Jumbo Payload",
+	0xc9: "Home Address",
+}
+
+var ipv6RouterAlerts = map[uint16]string{0: "MLD", 1: "RSVP", 2: "Active Networks"}
+
+// ipv6OptionFields describes the options of a hop-by-hop or destination
+// options header (RFC 8200 section 4.2). Parsing stops at an option that
+// runs past the header.
+func ipv6OptionFields(h IPv6ExtHeader) []models.LayerField {
+	var out []models.LayerField
+	for i := 0; i < len(h.Data); {
+		t := h.Data[i]
+		off := h.Offset + 2 + i
+		name, ok := ipv6OptNames[t]
+		if !ok {
+			name = fmt.Sprintf("Option 0x%02x", t)
+		}
+		if t == 0 {
+			out = append(out, models.LayerField{Name: name, Offset: off, Length: 1})
+			i++
+			continue
+		}
+		if i+2 > len(h.Data) || i+2+int(h.Data[i+1]) > len(h.Data) {
+			break
+		}
+		data := h.Data[i+2 : i+2+int(h.Data[i+1])]
+		f := models.LayerField{Name: name, Offset: off, Length: 2 + len(data)}
+		switch {
+		case t == 0x01:
+			f.Value = fmt.Sprintf("%d bytes", len(data))
+		case t == 0x05 && len(data) == 2:
+			v := binary.BigEndian.Uint16(data)
+			if n, ok := ipv6RouterAlerts[v]; ok {
+				f.Value = fmt.Sprintf("%s (%d)", n, v)
+			} else {
+				f.Value = fmt.Sprintf("%d", v)
+			}
+		case t == 0x04 && len(data) == 1:
+			f.Value = fmt.Sprintf("%d", data[0])
+		case t == 0xc2 && len(data) == 4:
+			f.Value = fmt.Sprintf("%d", binary.BigEndian.Uint32(data))
+		case t == 0xc9 && len(data) == 16:
+			f.Value = net.IP(data).String()
+		default:
+			f.Value = fmt.Sprintf("%x", data)
+		}
+		out = append(out, f)
+		i += 2 + len(data)
+	}
+	return out
+}
+
+var ipv6RoutingTypes = map[uint8]string{
+	0: "Source Route",
+	2: "Type 2 (Mobile IPv6)",
+	3: "RPL Source Route",
+	4: "Segment Routing",
+}
+
+// ipv6RoutingFields describes a routing header: its type, the segments
+// left and, for source routes, type 2 and segment routing headers, the
+// addresses it lists.
+func ipv6RoutingFields(h IPv6ExtHeader, fields []models.LayerField) (string, []models.LayerField) {
+	if len(h.Data) < 2 {
+		return "", fields
+	}
+	typ, left := h.Data[0], int(h.Data[1])
+	name, ok := ipv6RoutingTypes[typ]
+	if !ok {
+		name = fmt.Sprintf("Unknown (%d)", typ)
+	}
+	fields = append(fields,
+		models.LayerField{Name: "Routing Type", Value: fmt.Sprintf("%s (%d)", name, typ), Offset: h.Offset + 2, Length: 1},
+		models.LayerField{Name: "Segments Left", Value: fmt.Sprintf("%d", left), Offset: h.Offset + 3, Length: 1},
+	)
+	value := fmt.Sprintf("%s, %d segments left", name, left)
+	switch typ {
+	case 0, 2:
+		// Addresses follow 4 reserved bytes, the next one to visit is
+		// segments left from the end
+		addrs := (len(h.Data) - 6) / 16
+		for i := 0; i < addrs; i++ {
+			a := net.IP(h.Data[6+16*i : 22+16*i])
+			v := a.String()
+			if i == addrs-left {
+				v += " (next)"
+			}
+			fields = append(fields, models.LayerField{Name: "Address", Value: v, Offset: h.Offset + 8 + 16*i, Length: 16})
+		}
+	case 4:
+		// RFC 8754: last entry, flags, tag, then the segment list in
+		// reverse order, so segments left indexes the active segment
+		if len(h.Data) < 6 {
+			break
+		}
+		fields = append(fields,
+			models.LayerField{Name: "Last Entry", Value: fmt.Sprintf("%d", h.Data[2]), Offset: h.Offset + 4, Length: 1},
+			models.LayerField{Name: "Tag", Value: fmt.Sprintf("0x%04x", binary.BigEndian.Uint16(h.Data[4:6])), Offset: h.Offset + 6, Length: 2},
+		)
+		for i := 0; 6+16*(i+1) <= len(h.Data) && i <= int(h.Data[2]); i++ {
+			v := net.IP(h.Data[6+16*i : 22+16*i]).String()
+			if i == left {
+				v += " (active)"
+			}
+			fields = append(fields, models.LayerField{Name: fmt.Sprintf("Segment [%d]", i), Value: v, Offset: h.Offset + 8 + 16*i, Length: 16})
+		}
+	}
+	return value, fields
+}
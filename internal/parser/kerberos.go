@@ -0,0 +1,294 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+)
+
+const portKerberos = 88
+
+var kerberosMsgTypes = map[int]string{
+	10: "AS-REQ",
+	11: "AS-REP",
+	12: "TGS-REQ",
+	13: "TGS-REP",
+	14: "AP-REQ",
+	15: "AP-REP",
+	30: "KRB-ERROR",
+}
+
+var kerberosEtypes = map[int64]string{
+	1:  "des-cbc-crc",
+	3:  "des-cbc-md5",
+	17: "aes128-cts-hmac-sha1-96",
+	18: "aes256-cts-hmac-sha1-96",
+	19: "aes128-cts-hmac-sha256-128",
+	20: "aes256-cts-hmac-sha384-192",
+	23: "rc4-hmac",
+	24: "rc4-hmac-exp",
+}
+
+var kerberosPATypes = map[int64]string{
+	1:   "PA-TGS-REQ",
+	2:   "PA-ENC-TIMESTAMP",
+	3:   "PA-PW-SALT",
+	11:  "PA-ETYPE-INFO",
+	16:  "PA-PK-AS-REQ",
+	17:  "PA-PK-AS-REP",
+	19:  "PA-ETYPE-INFO2",
+	128: "PA-PAC-REQUEST",
+	129: "PA-FOR-USER",
+	133: "PA-FX-COOKIE",
+	136: "PA-FX-FAST",
+	138: "PA-ENCRYPTED-CHALLENGE",
+	149: "PA-REQ-ENC-PA-REP",
+	165: "PA-SUPPORTED-ETYPES",
+}
+
+var kerberosErrors = map[int64]string{
+	6:  "KDC_ERR_C_PRINCIPAL_UNKNOWN",
+	7:  "KDC_ERR_S_PRINCIPAL_UNKNOWN",
+	12: "KDC_ERR_POLICY",
+	14: "KDC_ERR_ETYPE_NOSUPP",
+	18: "KDC_ERR_CLIENT_REVOKED",
+	23: "KDC_ERR_KEY_EXPIRED",
+	24: "KDC_ERR_PREAUTH_FAILED",
+	25: "KDC_ERR_PREAUTH_REQUIRED",
+	31: "KRB_AP_ERR_BAD_INTEGRITY",
+	32: "KRB_AP_ERR_TKT_EXPIRED",
+	37: "KRB_AP_ERR_SKEW",
+	41: "KRB_AP_ERR_MODIFIED",
+	52: "KRB_ERR_RESPONSE_TOO_BIG",
+	60: "KRB_ERR_GENERIC",
+	68: "KDC_ERR_WRONG_REALM",
+}
+
+// KerberosMessage is the cleartext part of a Kerberos message (RFC 4120).
+// Ticket and reply contents are encrypted; only their etypes are known.
+type KerberosMessage struct {
+	MsgType   int
+	Realm     string   // realm of the request body, error or ticket
+	CName     string   // client principal
+	CRealm    string   // client realm of replies and errors
+	SName     string   // service principal
+	Etypes    []int64  // requested etypes, or the enc-part etypes of replies
+	PAData    []string // pre-authentication data types
+	ErrorCode int64    // KRB-ERROR only
+	ErrorText string
+
+	// Where the fields are in the message, and the length of the TCP
+	// record marker before it
+	raw                                []byte
+	typeAt, realmAt, cnameAt, crealmAt span
+	snameAt, paAt, errorAt, textAt     span
+	etypeAt                            []span
+	hdr                                int
+}
+
+// at returns where t, an element of the message, is.
+func (m *KerberosMessage) at(t berTLV) span {
+	return spanOf(m.raw, t.Raw)
+}
+
+// Name returns the message type name, e.g. "AS-REQ".
+func (m *KerberosMessage) Name() string {
+	if n, ok := kerberosMsgTypes[m.MsgType]; ok {
+		return n
+	}
+	return fmt.Sprintf("Kerberos %d", m.MsgType)
+}
+
+// Summary is a one-line description for the info column.
+func (m *KerberosMessage) Summary() string {
+	if m.MsgType == 30 {
+		return fmt.Sprintf("KRB-ERROR %s", kerberosErrorString(m.ErrorCode))
+	}
+	s := m.Name()
+	if m.CName != "" {
+		realm := m.CRealm
+		if realm == "" {
+			realm = m.Realm
+		}
+		s += " " + m.CName
+		if realm != "" {
+			s += "@" + realm
+		}
+	}
+	if m.SName != "" {
+		s += " for " + m.SName
+	}
+	return s
+}
+
+func kerberosErrorString(code int64) string {
+	if n, ok := kerberosErrors[code]; ok {
+		return fmt.Sprintf("%s (%d)", n, code)
+	}
+	return fmt.Sprintf("%d", code)
+}
+
+func kerberosEtypeString(e int64) string {
+	if n, ok := kerberosEtypes[e]; ok {
+		return fmt.Sprintf("%s (%d)", n, e)
+	}
+	return fmt.Sprintf("%d", e)
+}
+
+// kerberosPrincipal renders a PrincipalName as its components joined by "/".
+func kerberosPrincipal(t berTLV) string {
+	f := berFields(t.Value)
+	var parts []string
+	for _, s := range berChildren(f[1].Value) {
+		parts = append(parts, string(s.Value))
+	}
+	return strings.Join(parts, "/")
+}
+
+// parseKerberos decodes a Kerberos message. Over TCP it is preceded by a
+// 4-byte record length, which the caller must strip.
+func parseKerberos(data []byte) *KerberosMessage {
+	app, _, ok := readBER(data)
+	if !ok || app.Class != berApplication || kerberosMsgTypes[app.Tag] == "" {
+		return nil
+	}
+	seq, _, ok := readBER(app.Value)
+	if !ok || seq.Tag != 0x10 {
+		return nil
+	}
+	m := &KerberosMessage{MsgType: app.Tag, raw: data}
+	f := berFields(seq.Value)
+	etype := func(e berTLV) {
+		m.Etypes = append(m.Etypes, berInt(e.Value))
+		m.etypeAt = append(m.etypeAt, m.at(e))
+	}
+	switch app.Tag {
+	case 10, 12: // KDC-REQ
+		if berInt(f[2].Value) != int64(app.Tag) {
+			return nil
+		}
+		m.typeAt = m.at(f[2])
+		for _, pa := range berChildren(f[3].Value) {
+			pf := berFields(pa.Value)
+			m.PAData = append(m.PAData, kerberosPAString(berInt(pf[1].Value)))
+		}
+		m.paAt = m.at(f[3])
+		body := berFields(f[4].Value)
+		if c, ok := body[1]; ok {
+			m.CName, m.cnameAt = kerberosPrincipal(c), m.at(c)
+		}
+		m.Realm, m.realmAt = string(body[2].Value), m.at(body[2])
+		if s, ok := body[3]; ok {
+			m.SName, m.snameAt = kerberosPrincipal(s), m.at(s)
+		}
+		for _, e := range berChildren(body[8].Value) {
+			etype(e)
+		}
+	case 11, 13: // KDC-REP
+		if berInt(f[1].Value) != int64(app.Tag) {
+			return nil
+		}
+		m.typeAt = m.at(f[1])
+		for _, pa := range berChildren(f[2].Value) {
+			pf := berFields(pa.Value)
+			m.PAData = append(m.PAData, kerberosPAString(berInt(pf[1].Value)))
+		}
+		m.paAt = m.at(f[2])
+		m.CRealm, m.crealmAt = string(f[3].Value), m.at(f[3])
+		m.CName, m.cnameAt = kerberosPrincipal(f[4]), m.at(f[4])
+		// Ticket ::= [APPLICATION 1] SEQUENCE
+		if tkt, _, ok := readBER(f[5].Value); ok {
+			tf := berFields(tkt.Value)
+			m.Realm, m.realmAt = string(tf[1].Value), m.at(tf[1])
+			m.SName, m.snameAt = kerberosPrincipal(tf[2]), m.at(tf[2])
+			if ef := berFields(tf[3].Value); len(ef) > 0 {
+				etype(ef[0])
+			}
+		}
+		if ef := berFields(f[6].Value); len(ef) > 0 {
+			etype(ef[0])
+		}
+	case 30: // KRB-ERROR
+		if berInt(f[1].Value) != 30 {
+			return nil
+		}
+		m.typeAt = m.at(f[1])
+		m.ErrorCode, m.errorAt = berInt(f[6].Value), m.at(f[6])
+		m.CRealm, m.crealmAt = string(f[7].Value), m.at(f[7])
+		if c, ok := f[8]; ok {
+			m.CName, m.cnameAt = kerberosPrincipal(c), m.at(c)
+		}
+		m.Realm, m.realmAt = string(f[9].Value), m.at(f[9])
+		m.SName, m.snameAt = kerberosPrincipal(f[10]), m.at(f[10])
+		m.ErrorText, m.textAt = string(f[11].Value), m.at(f[11])
+	default: // AP-REQ and AP-REP only carry encrypted parts
+		if berInt(f[1].Value) != int64(app.Tag) {
+			return nil
+		}
+		m.typeAt = m.at(f[1])
+	}
+	return m
+}
+
+func kerberosPAString(t int64) string {
+	if n, ok := kerberosPATypes[t]; ok {
+		return n
+	}
+	return fmt.Sprintf("%d", t)
+}
+
+// findKerberos decodes the Kerberos message in a port 88 payload, or one
+// on a port decoded as Kerberos.
+func findKerberos(data []byte, pkt gopacket.Packet) *KerberosMessage {
+	if !portIs(pkt, portKerberos) && decodeAsFor(pkt) != "Kerberos" {
+		return nil
+	}
+	hdr := 0
+	if getTransportProto(pkt) == "TCP" {
+		if len(data) < 4 || int(binary.BigEndian.Uint32(data)) != len(data)-4 {
+			return nil
+		}
+		data, hdr = data[4:], 4
+	}
+	m := parseKerberos(data)
+	if m != nil {
+		m.hdr = hdr
+	}
+	return m
+}
+
+// buildKerberosLayerDetail describes m; field offsets are relative to the
+// payload, record marker included.
+func buildKerberosLayerDetail(m *KerberosMessage) models.LayerDetail {
+	fields := []models.LayerField{
+		m.typeAt.shift(m.hdr).field("Message Type", fmt.Sprintf("%s (%d)", m.Name(), m.MsgType)),
+	}
+	add := func(at span, name, value string) {
+		if value != "" {
+			fields = append(fields, at.shift(m.hdr).field(name, value))
+		}
+	}
+	if m.MsgType == 30 {
+		add(m.errorAt, "Error Code", kerberosErrorString(m.ErrorCode))
+		add(m.textAt, "Error Text", m.ErrorText)
+	}
+	add(m.crealmAt, "Client Realm", m.CRealm)
+	add(m.cnameAt, "Client Name", m.CName)
+	add(m.realmAt, "Realm", m.Realm)
+	add(m.snameAt, "Server Name", m.SName)
+	if len(m.PAData) > 0 {
+		add(m.paAt, "Pre-authentication", strings.Join(m.PAData, ", "))
+	}
+	if len(m.Etypes) > 0 {
+		f := models.LayerField{Name: "Encryption Types", Value: fmt.Sprintf("%d", len(m.Etypes))}
+		for i, e := range m.Etypes {
+			f.Children = append(f.Children, m.etypeAt[i].shift(m.hdr).field("Etype", kerberosEtypeString(e)))
+		}
+		fields = append(fields, f)
+	}
+	return models.LayerDetail{Name: "Kerberos", Fields: fields}
+}
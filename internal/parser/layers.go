@@ -1,10 +1,12 @@
 package parser
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
@@ -12,20 +14,105 @@ import (
 	"sniffox/internal/models"
 )
 
-func extractLayers(pkt gopacket.Packet) []models.LayerDetail {
-	var result []models.LayerDetail
-	for _, layer := range pkt.Layers() {
+// extractLayers dissects pkt's layers. It stops early, returning why, if
+// the packet has too many layers or fields or dissecting it runs past
+// deadline.
+func extractLayers(pkt gopacket.Packet, deadline time.Time) ([]models.LayerDetail, string) {
+	// Tunnels the packet was stripped from come first
+	result := tunnelLayers(pkt)
+	data := pkt.Data()
+	next := 0 // where the previous layer's contents ended
+	fields := 0
+	for i, layer := range pkt.Layers() {
+		if i == maxLayers {
+			return result, fmt.Sprintf("more than %d layers", maxLayers)
+		}
+		if time.Now().After(deadline) {
+			return result, fmt.Sprintf("dissection took over %v", parseBudget)
+		}
+		contents := layer.LayerContents()
+		start, found := layerStart(data, contents)
+		if !found && next+len(contents) <= len(data) && bytes.Equal(data[next:next+len(contents)], contents) {
+			start, found = next, len(contents) > 0
+		}
+		if found {
+			next = start + len(contents)
+		}
 		if detail, ok := parseLayer(layer, pkt); ok {
+			if found {
+				positionLayer(&detail, data, start, len(contents))
+			}
 			result = append(result, detail)
+			if fields += countFields(detail.Fields); fields > maxFields {
+				return result, fmt.Sprintf("more than %d fields", maxFields)
+			}
+		}
+	}
+	// NTLMSSP rides inside SMB or HTTP payloads rather than as its own
+	// layer; base64 in an HTTP header leaves it nothing to highlight
+	if ntlm := ExtractNTLM(pkt); ntlm != nil {
+		detail := buildNTLMLayerDetail(ntlm)
+		placeLayer(&detail, data, ntlm.raw)
+		result = append(result, detail)
+	}
+	// OCSP, CRL and PAC bodies ride inside HTTP
+	if ocsp := ExtractOCSP(pkt); ocsp != nil {
+		detail := buildOCSPLayerDetail(ocsp)
+		placeLayer(&detail, data, ocsp.raw)
+		result = append(result, detail)
+	} else if crl := ExtractCRL(pkt); crl != nil {
+		detail := buildCRLLayerDetail(crl)
+		placeLayer(&detail, data, crl.raw)
+		result = append(result, detail)
+	} else if pac := ExtractPAC(pkt); pac != nil {
+		detail := buildPACLayerDetail(pac)
+		placeLayer(&detail, data, pkt.ApplicationLayer().Payload())
+		result = append(result, detail)
+	}
+	// HTTP/2 frames are decoded per connection and attached to the packet
+	if frames, grpc := HTTP2From(pkt); len(frames) > 0 {
+		var payload []byte
+		if tl := pkt.TransportLayer(); tl != nil {
+			payload = tl.LayerPayload()
+		}
+		detail := buildHTTP2LayerDetail(frames, grpc, len(payload))
+		placeLayer(&detail, data, payload)
+		result = append(result, detail)
+		for i := range frames {
+			if dns := DecodeDNSMessage(frames[i].DNSMessage); dns != nil {
+				doh := buildDoHLayerDetail(dns)
+				placeLayer(&doh, data, frames[i].DNSMessage)
+				result = append(result, doh)
+			}
 		}
 	}
-	return result
+	// Diameter, S1AP and NGAP ride in SCTP DATA chunks
+	result = append(result, sctpPayloadLayers(pkt)...)
+	// CEF events ride inside syslog messages
+	for _, c := range ExtractCEF(pkt) {
+		result = append(result, buildCEFLayerDetail(c))
+	}
+	// DNS-over-HTTPS messages ride inside HTTP bodies and URLs
+	if dns := ExtractDoH(pkt); dns != nil {
+		doh := buildDoHLayerDetail(dns)
+		placeLayer(&doh, data, dns.Contents)
+		result = append(result, doh)
+	}
+	return result, ""
 }
 
 func parseLayer(layer gopacket.Layer, pkt gopacket.Packet) (models.LayerDetail, bool) {
 	switch l := layer.(type) {
 	case *layers.Ethernet:
 		return parseEthernet(l), true
+	case *layers.LinuxSLL:
+		return parseLinuxSLL(l), true
+	case *LinuxSLL2:
+		return parseLinuxSLL2(l), true
+	case *layers.Loopback:
+		return parseLoopback(l), true
+	case *layers.PPP:
+		return parsePPP(l), true
 	case *layers.ARP:
 		return parseARP(l), true
 	case *layers.IPv4:
@@ -43,9 +130,11 @@ func parseLayer(layer gopacket.Layer, pkt gopacket.Packet) (models.LayerDetail,
 	case *layers.DNS:
 		return parseDNS(l), true
 	case *layers.Dot1Q:
-		return parseVLAN(l), true
+		return parseVLAN(l, vlanTPID(pkt, l)), true
 	case *layers.DHCPv4:
 		return parseDHCPv4(l), true
+	case *layers.DHCPv6:
+		return parseDHCPv6(l), true
 	case *layers.NTP:
 		return parseNTP(l), true
 	case *layers.TLS:
@@ -54,10 +143,16 @@ func parseLayer(layer gopacket.Layer, pkt gopacket.Packet) (models.LayerDetail,
 		return parseIGMP(l), true
 	case *layers.GRE:
 		return parseGRE(l), true
+	case *layers.GTPv1U:
+		return parseGTPv1U(l), true
+	case *layers.MPLS:
+		return parseMPLS(l), true
 	case *layers.SCTP:
 		return parseSCTP(l), true
 	case *layers.STP:
 		return parseSTP(l), true
+	case *layers.SIP:
+		return parseSIP(transportPayload(pkt)), true
 	default:
 		// Generic payload or unknown layer
 		if layer.LayerType() == gopacket.LayerTypePayload {
@@ -78,9 +173,9 @@ func parseEthernet(eth *layers.Ethernet) models.LayerDetail {
 	return models.LayerDetail{
 		Name: "Ethernet II",
 		Fields: []models.LayerField{
-			{Name: "Source", Value: eth.SrcMAC.String()},
-			{Name: "Destination", Value: eth.DstMAC.String()},
-			{Name: "Type", Value: eth.EthernetType.String()},
+			{Name: "Source", Value: eth.SrcMAC.String(), Offset: 6, Length: 6},
+			{Name: "Destination", Value: eth.DstMAC.String(), Offset: 0, Length: 6},
+			{Name: "Type", Value: eth.EthernetType.String(), Offset: 12, Length: 2},
 		},
 	}
 }
@@ -93,52 +188,61 @@ func parseARP(arp *layers.ARP) models.LayerDetail {
 	case 2:
 		op = "Reply (2)"
 	}
+	hs, ps := int(arp.HwAddressSize), int(arp.ProtAddressSize)
 	return models.LayerDetail{
 		Name: "ARP",
 		Fields: []models.LayerField{
-			{Name: "Operation", Value: op},
-			{Name: "Sender MAC", Value: fmt.Sprintf("%x", arp.SourceHwAddress)},
-			{Name: "Sender IP", Value: fmt.Sprintf("%d.%d.%d.%d", arp.SourceProtAddress[0], arp.SourceProtAddress[1], arp.SourceProtAddress[2], arp.SourceProtAddress[3])},
-			{Name: "Target MAC", Value: fmt.Sprintf("%x", arp.DstHwAddress)},
-			{Name: "Target IP", Value: fmt.Sprintf("%d.%d.%d.%d", arp.DstProtAddress[0], arp.DstProtAddress[1], arp.DstProtAddress[2], arp.DstProtAddress[3])},
+			{Name: "Operation", Value: op, Offset: 6, Length: 2},
+			{Name: "Sender MAC", Value: fmt.Sprintf("%x", arp.SourceHwAddress), Offset: 8, Length: hs},
+			{Name: "Sender IP", Value: fmt.Sprintf("%d.%d.%d.%d", arp.SourceProtAddress[0], arp.SourceProtAddress[1], arp.SourceProtAddress[2], arp.SourceProtAddress[3]), Offset: 8 + hs, Length: ps},
+			{Name: "Target MAC", Value: fmt.Sprintf("%x", arp.DstHwAddress), Offset: 8 + hs + ps, Length: hs},
+			{Name: "Target IP", Value: fmt.Sprintf("%d.%d.%d.%d", arp.DstProtAddress[0], arp.DstProtAddress[1], arp.DstProtAddress[2], arp.DstProtAddress[3]), Offset: 8 + 2*hs + ps, Length: ps},
 		},
 	}
 }
 
 func parseIPv4(ip *layers.IPv4) models.LayerDetail {
-	return models.LayerDetail{
+	d := models.LayerDetail{
 		Name: "IPv4",
 		Fields: []models.LayerField{
-			{Name: "Version", Value: fmt.Sprintf("%d", ip.Version)},
-			{Name: "Header Length", Value: fmt.Sprintf("%d bytes", ip.IHL*4)},
-			{Name: "Type of Service", Value: fmt.Sprintf("0x%02x", ip.TOS)},
-			{Name: "Total Length", Value: fmt.Sprintf("%d", ip.Length)},
-			{Name: "Identification", Value: fmt.Sprintf("0x%04x (%d)", ip.Id, ip.Id)},
-			{Name: "Flags", Value: ip.Flags.String()},
-			{Name: "Fragment Offset", Value: fmt.Sprintf("%d", ip.FragOffset)},
-			{Name: "TTL", Value: fmt.Sprintf("%d", ip.TTL)},
-			{Name: "Protocol", Value: ip.Protocol.String()},
-			{Name: "Checksum", Value: fmt.Sprintf("0x%04x", ip.Checksum)},
-			{Name: "Source", Value: ip.SrcIP.String()},
-			{Name: "Destination", Value: ip.DstIP.String()},
+			{Name: "Version", Value: fmt.Sprintf("%d", ip.Version), Offset: 0, Length: 1},
+			{Name: "Header Length", Value: fmt.Sprintf("%d bytes", ip.IHL*4), Offset: 0, Length: 1},
+			{Name: "Type of Service", Value: fmt.Sprintf("0x%02x", ip.TOS), Offset: 1, Length: 1},
+			{Name: "Total Length", Value: fmt.Sprintf("%d", ip.Length), Offset: 2, Length: 2},
+			{Name: "Identification", Value: fmt.Sprintf("0x%04x (%d)", ip.Id, ip.Id), Offset: 4, Length: 2},
+			{Name: "Flags", Value: ip.Flags.String(), Offset: 6, Length: 1},
+			{Name: "Fragment Offset", Value: fmt.Sprintf("%d", ip.FragOffset), Offset: 6, Length: 2},
+			{Name: "TTL", Value: fmt.Sprintf("%d", ip.TTL), Offset: 8, Length: 1},
+			{Name: "Protocol", Value: ip.Protocol.String(), Offset: 9, Length: 1},
+			{Name: "Checksum", Value: fmt.Sprintf("0x%04x", ip.Checksum), Offset: 10, Length: 2},
+			{Name: "Source", Value: ip.SrcIP.String(), Offset: 12, Length: 4},
+			{Name: "Destination", Value: ip.DstIP.String(), Offset: 16, Length: 4},
 		},
 	}
+	if f, ok := ipv4OptionsField(ip); ok {
+		d.Fields = append(d.Fields, f)
+	}
+	return d
 }
 
 func parseIPv6(ip *layers.IPv6) models.LayerDetail {
-	return models.LayerDetail{
+	d := models.LayerDetail{
 		Name: "IPv6",
 		Fields: []models.LayerField{
-			{Name: "Version", Value: fmt.Sprintf("%d", ip.Version)},
-			{Name: "Traffic Class", Value: fmt.Sprintf("0x%02x", ip.TrafficClass)},
-			{Name: "Flow Label", Value: fmt.Sprintf("0x%05x", ip.FlowLabel)},
-			{Name: "Payload Length", Value: fmt.Sprintf("%d", ip.Length)},
-			{Name: "Next Header", Value: ip.NextHeader.String()},
-			{Name: "Hop Limit", Value: fmt.Sprintf("%d", ip.HopLimit)},
-			{Name: "Source", Value: ip.SrcIP.String()},
-			{Name: "Destination", Value: ip.DstIP.String()},
+			{Name: "Version", Value: fmt.Sprintf("%d", ip.Version), Offset: 0, Length: 1},
+			{Name: "Traffic Class", Value: fmt.Sprintf("0x%02x", ip.TrafficClass), Offset: 0, Length: 2},
+			{Name: "Flow Label", Value: fmt.Sprintf("0x%05x", ip.FlowLabel), Offset: 1, Length: 3},
+			{Name: "Payload Length", Value: fmt.Sprintf("%d", ip.Length), Offset: 4, Length: 2},
+			{Name: "Next Header", Value: ip.NextHeader.String(), Offset: 6, Length: 1},
+			{Name: "Hop Limit", Value: fmt.Sprintf("%d", ip.HopLimit), Offset: 7, Length: 1},
+			{Name: "Source", Value: ip.SrcIP.String(), Offset: 8, Length: 16},
+			{Name: "Destination", Value: ip.DstIP.String(), Offset: 24, Length: 16},
 		},
 	}
+	if f, ok := ipv6ExtField(ip); ok {
+		d.Fields = append(d.Fields, f)
+	}
+	return d
 }
 
 func parseTCP(tcp *layers.TCP) models.LayerDetail {
@@ -166,15 +270,15 @@ func parseTCP(tcp *layers.TCP) models.LayerDetail {
 	return models.LayerDetail{
 		Name: "TCP",
 		Fields: []models.LayerField{
-			{Name: "Source Port", Value: fmt.Sprintf("%d", tcp.SrcPort)},
-			{Name: "Destination Port", Value: fmt.Sprintf("%d", tcp.DstPort)},
-			{Name: "Sequence Number", Value: fmt.Sprintf("%d", tcp.Seq)},
-			{Name: "Acknowledgment Number", Value: fmt.Sprintf("%d", tcp.Ack)},
-			{Name: "Data Offset", Value: fmt.Sprintf("%d bytes", tcp.DataOffset*4)},
-			{Name: "Flags", Value: fmt.Sprintf("[%s]", flags)},
-			{Name: "Window Size", Value: fmt.Sprintf("%d", tcp.Window)},
-			{Name: "Checksum", Value: fmt.Sprintf("0x%04x", tcp.Checksum)},
-			{Name: "Urgent Pointer", Value: fmt.Sprintf("%d", tcp.Urgent)},
+			{Name: "Source Port", Value: fmt.Sprintf("%d", tcp.SrcPort), Offset: 0, Length: 2},
+			{Name: "Destination Port", Value: fmt.Sprintf("%d", tcp.DstPort), Offset: 2, Length: 2},
+			{Name: "Sequence Number", Value: fmt.Sprintf("%d", tcp.Seq), Offset: 4, Length: 4},
+			{Name: "Acknowledgment Number", Value: fmt.Sprintf("%d", tcp.Ack), Offset: 8, Length: 4},
+			{Name: "Data Offset", Value: fmt.Sprintf("%d bytes", tcp.DataOffset*4), Offset: 12, Length: 1},
+			{Name: "Flags", Value: fmt.Sprintf("[%s]", flags), Offset: 12, Length: 2},
+			{Name: "Window Size", Value: fmt.Sprintf("%d", tcp.Window), Offset: 14, Length: 2},
+			{Name: "Checksum", Value: fmt.Sprintf("0x%04x", tcp.Checksum), Offset: 16, Length: 2},
+			{Name: "Urgent Pointer", Value: fmt.Sprintf("%d", tcp.Urgent), Offset: 18, Length: 2},
 		},
 	}
 }
@@ -183,45 +287,72 @@ func parseUDP(udp *layers.UDP) models.LayerDetail {
 	return models.LayerDetail{
 		Name: "UDP",
 		Fields: []models.LayerField{
-			{Name: "Source Port", Value: fmt.Sprintf("%d", udp.SrcPort)},
-			{Name: "Destination Port", Value: fmt.Sprintf("%d", udp.DstPort)},
-			{Name: "Length", Value: fmt.Sprintf("%d", udp.Length)},
-			{Name: "Checksum", Value: fmt.Sprintf("0x%04x", udp.Checksum)},
+			{Name: "Source Port", Value: fmt.Sprintf("%d", udp.SrcPort), Offset: 0, Length: 2},
+			{Name: "Destination Port", Value: fmt.Sprintf("%d", udp.DstPort), Offset: 2, Length: 2},
+			{Name: "Length", Value: fmt.Sprintf("%d", udp.Length), Offset: 4, Length: 2},
+			{Name: "Checksum", Value: fmt.Sprintf("0x%04x", udp.Checksum), Offset: 6, Length: 2},
 		},
 	}
 }
 
 func parseICMPv4(icmp *layers.ICMPv4) models.LayerDetail {
-	return models.LayerDetail{
+	d := models.LayerDetail{
 		Name: "ICMPv4",
 		Fields: []models.LayerField{
-			{Name: "Type", Value: fmt.Sprintf("%d (%s)", icmp.TypeCode.Type(), icmp.TypeCode.String())},
-			{Name: "Code", Value: fmt.Sprintf("%d", icmp.TypeCode.Code())},
-			{Name: "Checksum", Value: fmt.Sprintf("0x%04x", icmp.Checksum)},
-			{Name: "Identifier", Value: fmt.Sprintf("0x%04x", icmp.Id)},
-			{Name: "Sequence", Value: fmt.Sprintf("%d", icmp.Seq)},
+			{Name: "Type", Value: fmt.Sprintf("%d (%s)", icmp.TypeCode.Type(), icmp.TypeCode.String()), Offset: 0, Length: 1},
+			{Name: "Code", Value: fmt.Sprintf("%d", icmp.TypeCode.Code()), Offset: 1, Length: 1},
+			{Name: "Checksum", Value: fmt.Sprintf("0x%04x", icmp.Checksum), Offset: 2, Length: 2},
 		},
 	}
+	q := icmpv4Quote(icmp)
+	if q == nil {
+		d.Fields = append(d.Fields,
+			models.LayerField{Name: "Identifier", Value: fmt.Sprintf("0x%04x", icmp.Id), Offset: 4, Length: 2},
+			models.LayerField{Name: "Sequence", Value: fmt.Sprintf("%d", icmp.Seq), Offset: 6, Length: 2},
+		)
+		return d
+	}
+	// Errors have no identifier; fragmentation needed carries the MTU
+	if icmp.TypeCode == layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded) {
+		d.Fields = append(d.Fields, models.LayerField{Name: "Next-Hop MTU", Value: fmt.Sprintf("%d", icmp.Seq), Offset: 6, Length: 2})
+	}
+	d.Fields = append(d.Fields, icmpQuoteField(q, 8))
+	return d
 }
 
 func parseICMPv6(icmp *layers.ICMPv6) models.LayerDetail {
-	return models.LayerDetail{
+	d := models.LayerDetail{
 		Name: "ICMPv6",
 		Fields: []models.LayerField{
-			{Name: "Type", Value: icmp.TypeCode.String()},
-			{Name: "Checksum", Value: fmt.Sprintf("0x%04x", icmp.Checksum)},
+			{Name: "Type", Value: icmp.TypeCode.String(), Offset: 0, Length: 2},
+			{Name: "Checksum", Value: fmt.Sprintf("0x%04x", icmp.Checksum), Offset: 2, Length: 2},
 		},
 	}
+	if q := icmpv6Quote(icmp); q != nil {
+		if icmp.TypeCode.Type() == layers.ICMPv6TypePacketTooBig {
+			d.Fields = append(d.Fields, models.LayerField{Name: "MTU", Value: fmt.Sprintf("%d", binary.BigEndian.Uint32(icmp.Payload[:4])), Offset: 4, Length: 4})
+		}
+		d.Fields = append(d.Fields, icmpQuoteField(q, 8))
+	}
+	d.Fields = append(d.Fields, ndpFields(icmp)...)
+	return d
 }
 
-func parseVLAN(vlan *layers.Dot1Q) models.LayerDetail {
+// parseVLAN describes a VLAN tag; tpid tells an 802.1ad service tag (the
+// outer tag of a QinQ frame) from an 802.1Q customer tag.
+func parseVLAN(vlan *layers.Dot1Q, tpid layers.EthernetType) models.LayerDetail {
+	name := "802.1Q VLAN"
+	if isServiceTag(tpid) {
+		name = "802.1ad VLAN"
+	}
 	return models.LayerDetail{
-		Name: "802.1Q VLAN",
+		Name: name,
 		Fields: []models.LayerField{
-			{Name: "VLAN ID", Value: fmt.Sprintf("%d", vlan.VLANIdentifier)},
-			{Name: "Priority", Value: fmt.Sprintf("%d", vlan.Priority)},
-			{Name: "Drop Eligible", Value: boolToStr(vlan.DropEligible, "Yes", "No")},
-			{Name: "Type", Value: vlan.Type.String()},
+			{Name: "TPID", Value: fmt.Sprintf("0x%04x", uint16(tpid)), Offset: -2, Length: 2},
+			{Name: "VLAN ID", Value: fmt.Sprintf("%d", vlan.VLANIdentifier), Offset: 0, Length: 2},
+			{Name: "Priority", Value: fmt.Sprintf("%d", vlan.Priority), Offset: 0, Length: 1},
+			{Name: "Drop Eligible", Value: boolToStr(vlan.DropEligible, "Yes", "No"), Offset: 0, Length: 1},
+			{Name: "Type", Value: vlan.Type.String(), Offset: 2, Length: 2},
 		},
 	}
 }
@@ -236,40 +367,54 @@ func parseDHCPv4(dhcp *layers.DHCPv4) models.LayerDetail {
 	}
 
 	fields := []models.LayerField{
-		{Name: "Operation", Value: op},
-		{Name: "Hardware Type", Value: fmt.Sprintf("%d", dhcp.HardwareType)},
-		{Name: "Hardware Len", Value: fmt.Sprintf("%d", dhcp.HardwareLen)},
-		{Name: "Transaction ID", Value: fmt.Sprintf("0x%08x", dhcp.Xid)},
-		{Name: "Client IP", Value: dhcp.ClientIP.String()},
-		{Name: "Your IP", Value: dhcp.YourClientIP.String()},
-		{Name: "Server IP", Value: dhcp.NextServerIP.String()},
-		{Name: "Client MAC", Value: net.HardwareAddr(dhcp.ClientHWAddr).String()},
-	}
-
-	// Extract key options
+		{Name: "Operation", Value: op, Offset: 0, Length: 1},
+		{Name: "Hardware Type", Value: fmt.Sprintf("%d", dhcp.HardwareType), Offset: 1, Length: 1},
+		{Name: "Hardware Len", Value: fmt.Sprintf("%d", dhcp.HardwareLen), Offset: 2, Length: 1},
+		{Name: "Transaction ID", Value: fmt.Sprintf("0x%08x", dhcp.Xid), Offset: 4, Length: 4},
+		{Name: "Client IP", Value: dhcp.ClientIP.String(), Offset: 12, Length: 4},
+		{Name: "Your IP", Value: dhcp.YourClientIP.String(), Offset: 16, Length: 4},
+		{Name: "Server IP", Value: dhcp.NextServerIP.String(), Offset: 20, Length: 4},
+		{Name: "Client MAC", Value: net.HardwareAddr(dhcp.ClientHWAddr).String(), Offset: 28, Length: len(dhcp.ClientHWAddr)},
+	}
+
+	// Extract key options; they follow the 240-byte fixed header and magic
+	// cookie, each a type, a length and data, except one-byte pads
+	off := 240
 	for _, opt := range dhcp.Options {
+		dataOff := off + 2
+		if opt.Type == layers.DHCPOptPad {
+			off++
+		} else {
+			off += 2 + len(opt.Data)
+		}
 		switch opt.Type {
 		case layers.DHCPOptMessageType:
 			if len(opt.Data) > 0 {
 				msgType := dhcpMsgType(opt.Data[0])
-				fields = append(fields, models.LayerField{Name: "Message Type", Value: msgType})
+				fields = append(fields, models.LayerField{Name: "Message Type", Value: msgType, Offset: dataOff, Length: 1})
 			}
 		case layers.DHCPOptRequestIP:
 			if len(opt.Data) == 4 {
 				fields = append(fields, models.LayerField{
-					Name:  "Requested IP",
-					Value: net.IP(opt.Data).String(),
+					Name:   "Requested IP",
+					Value:  net.IP(opt.Data).String(),
+					Offset: dataOff,
+					Length: 4,
 				})
 			}
 		case layers.DHCPOptHostname:
-			fields = append(fields, models.LayerField{Name: "Hostname", Value: string(opt.Data)})
+			fields = append(fields, models.LayerField{Name: "Hostname", Value: string(opt.Data), Offset: dataOff, Length: len(opt.Data)})
 		case layers.DHCPOptServerID:
 			if len(opt.Data) == 4 {
 				fields = append(fields, models.LayerField{
-					Name:  "Server ID",
-					Value: net.IP(opt.Data).String(),
+					Name:   "Server ID",
+					Value:  net.IP(opt.Data).String(),
+					Offset: dataOff,
+					Length: 4,
 				})
 			}
+		case DHCPOptWPAD:
+			fields = append(fields, models.LayerField{Name: "WPAD URL", Value: strings.TrimRight(string(opt.Data), "\x00"), Offset: dataOff, Length: len(opt.Data)})
 		}
 	}
 
@@ -321,17 +466,17 @@ func parseNTP(ntp *layers.NTP) models.LayerDetail {
 	return models.LayerDetail{
 		Name: "NTP",
 		Fields: []models.LayerField{
-			{Name: "Version", Value: fmt.Sprintf("%d", ntp.Version)},
-			{Name: "Mode", Value: fmt.Sprintf("%s (%d)", mode, ntp.Mode)},
-			{Name: "Stratum", Value: fmt.Sprintf("%d", ntp.Stratum)},
-			{Name: "Poll Interval", Value: fmt.Sprintf("%d", ntp.Poll)},
-			{Name: "Precision", Value: fmt.Sprintf("%d", ntp.Precision)},
-			{Name: "Root Delay", Value: fmt.Sprintf("%d", ntp.RootDelay)},
-			{Name: "Root Dispersion", Value: fmt.Sprintf("%d", ntp.RootDispersion)},
-			{Name: "Reference Timestamp", Value: fmt.Sprintf("%v", ntp.ReferenceTimestamp)},
-			{Name: "Origin Timestamp", Value: fmt.Sprintf("%v", ntp.OriginTimestamp)},
-			{Name: "Receive Timestamp", Value: fmt.Sprintf("%v", ntp.ReceiveTimestamp)},
-			{Name: "Transmit Timestamp", Value: fmt.Sprintf("%v", ntp.TransmitTimestamp)},
+			{Name: "Version", Value: fmt.Sprintf("%d", ntp.Version), Offset: 0, Length: 1},
+			{Name: "Mode", Value: fmt.Sprintf("%s (%d)", mode, ntp.Mode), Offset: 0, Length: 1},
+			{Name: "Stratum", Value: fmt.Sprintf("%d", ntp.Stratum), Offset: 1, Length: 1},
+			{Name: "Poll Interval", Value: fmt.Sprintf("%d", ntp.Poll), Offset: 2, Length: 1},
+			{Name: "Precision", Value: fmt.Sprintf("%d", ntp.Precision), Offset: 3, Length: 1},
+			{Name: "Root Delay", Value: fmt.Sprintf("%d", ntp.RootDelay), Offset: 4, Length: 4},
+			{Name: "Root Dispersion", Value: fmt.Sprintf("%d", ntp.RootDispersion), Offset: 8, Length: 4},
+			{Name: "Reference Timestamp", Value: fmt.Sprintf("%v", ntp.ReferenceTimestamp), Offset: 16, Length: 8},
+			{Name: "Origin Timestamp", Value: fmt.Sprintf("%v", ntp.OriginTimestamp), Offset: 24, Length: 8},
+			{Name: "Receive Timestamp", Value: fmt.Sprintf("%v", ntp.ReceiveTimestamp), Offset: 32, Length: 8},
+			{Name: "Transmit Timestamp", Value: fmt.Sprintf("%v", ntp.TransmitTimestamp), Offset: 40, Length: 8},
 		},
 	}
 }
@@ -358,15 +503,15 @@ func parseTLS(tls *layers.TLS, pkt gopacket.Packet) models.LayerDetail {
 		version = tlsVersionString(v)
 	}
 
-	var rawData []byte
+	var raw []byte
 	if appLayer := pkt.ApplicationLayer(); appLayer != nil {
-		rawData = appLayer.LayerContents()
+		raw = appLayer.LayerContents()
 	}
-	if len(rawData) == 0 {
-		rawData = tls.Contents
+	if len(raw) == 0 {
+		raw = tls.Contents
 	}
 
-	return buildTLSLayerDetail(contentType, version, rawData)
+	return buildTLSLayerDetail(contentType, version, raw)
 }
 
 // ==================== NEW: IGMP ====================
@@ -391,10 +536,10 @@ func parseIGMP(igmp *layers.IGMPv1or2) models.LayerDetail {
 	return models.LayerDetail{
 		Name: "IGMP",
 		Fields: []models.LayerField{
-			{Name: "Type", Value: typeStr},
-			{Name: "Max Response Time", Value: fmt.Sprintf("%v", igmp.MaxResponseTime)},
-			{Name: "Group Address", Value: igmp.GroupAddress.String()},
-			{Name: "Checksum", Value: fmt.Sprintf("0x%04x", igmp.Checksum)},
+			{Name: "Type", Value: typeStr, Offset: 0, Length: 1},
+			{Name: "Max Response Time", Value: fmt.Sprintf("%v", igmp.MaxResponseTime), Offset: 1, Length: 1},
+			{Name: "Group Address", Value: igmp.GroupAddress.String(), Offset: 4, Length: 4},
+			{Name: "Checksum", Value: fmt.Sprintf("0x%04x", igmp.Checksum), Offset: 2, Length: 2},
 		},
 	}
 }
@@ -403,17 +548,23 @@ func parseIGMP(igmp *layers.IGMPv1or2) models.LayerDetail {
 
 func parseGRE(gre *layers.GRE) models.LayerDetail {
 	fields := []models.LayerField{
-		{Name: "Protocol", Value: fmt.Sprintf("0x%04x (%s)", uint16(gre.Protocol), gre.Protocol.String())},
-		{Name: "Checksum Present", Value: boolToStr(gre.ChecksumPresent, "Yes", "No")},
-		{Name: "Key Present", Value: boolToStr(gre.KeyPresent, "Yes", "No")},
-		{Name: "Sequence Present", Value: boolToStr(gre.SeqPresent, "Yes", "No")},
+		{Name: "Protocol", Value: fmt.Sprintf("0x%04x (%s)", uint16(gre.Protocol), gre.Protocol.String()), Offset: 2, Length: 2},
+		{Name: "Checksum Present", Value: boolToStr(gre.ChecksumPresent, "Yes", "No"), Offset: 0, Length: 1},
+		{Name: "Key Present", Value: boolToStr(gre.KeyPresent, "Yes", "No"), Offset: 0, Length: 1},
+		{Name: "Sequence Present", Value: boolToStr(gre.SeqPresent, "Yes", "No"), Offset: 0, Length: 1},
 	}
 
+	// The optional words follow in checksum, key, sequence order
+	off := 4
+	if gre.ChecksumPresent || gre.RoutingPresent {
+		off += 4
+	}
 	if gre.KeyPresent {
-		fields = append(fields, models.LayerField{Name: "Key", Value: fmt.Sprintf("0x%08x", gre.Key)})
+		fields = append(fields, models.LayerField{Name: "Key", Value: fmt.Sprintf("0x%08x", gre.Key), Offset: off, Length: 4})
+		off += 4
 	}
 	if gre.SeqPresent {
-		fields = append(fields, models.LayerField{Name: "Sequence", Value: fmt.Sprintf("%d", gre.Seq)})
+		fields = append(fields, models.LayerField{Name: "Sequence", Value: fmt.Sprintf("%d", gre.Seq), Offset: off, Length: 4})
 	}
 
 	return models.LayerDetail{Name: "GRE", Fields: fields}
@@ -422,15 +573,24 @@ func parseGRE(gre *layers.GRE) models.LayerDetail {
 // ==================== NEW: SCTP ====================
 
 func parseSCTP(sctp *layers.SCTP) models.LayerDetail {
-	return models.LayerDetail{
-		Name: "SCTP",
-		Fields: []models.LayerField{
-			{Name: "Source Port", Value: fmt.Sprintf("%d", sctp.SrcPort)},
-			{Name: "Destination Port", Value: fmt.Sprintf("%d", sctp.DstPort)},
-			{Name: "Verification Tag", Value: fmt.Sprintf("0x%08x", sctp.VerificationTag)},
-			{Name: "Checksum", Value: fmt.Sprintf("0x%08x", sctp.Checksum)},
-		},
+	fields := []models.LayerField{
+		{Name: "Source Port", Value: fmt.Sprintf("%d", sctp.SrcPort), Offset: 0, Length: 2},
+		{Name: "Destination Port", Value: fmt.Sprintf("%d", sctp.DstPort), Offset: 2, Length: 2},
+		{Name: "Verification Tag", Value: fmt.Sprintf("0x%08x", sctp.VerificationTag), Offset: 4, Length: 4},
+		{Name: "Checksum", Value: fmt.Sprintf("0x%08x", sctp.Checksum), Offset: 8, Length: 4},
+	}
+	// The chunks follow the 12-byte common header
+	base := len(sctp.Contents)
+	for _, c := range parseSCTPChunks(sctp.LayerPayload()) {
+		fields = append(fields, models.LayerField{
+			Name:     "Chunk",
+			Value:    c.name(),
+			Children: sctpChunkFields(c, base),
+			Offset:   base + c.at,
+			Length:   4 + len(c.Value),
+		})
 	}
+	return models.LayerDetail{Name: "SCTP", Fields: fields}
 }
 
 // ==================== NEW: STP ====================
@@ -444,8 +604,8 @@ func parseSTP(stp *layers.STP) models.LayerDetail {
 		protocolID := binary.BigEndian.Uint16(data[0:2])
 		version := data[2]
 		fields = append(fields,
-			models.LayerField{Name: "Protocol ID", Value: fmt.Sprintf("0x%04x", protocolID)},
-			models.LayerField{Name: "Version", Value: fmt.Sprintf("%d", version)},
+			models.LayerField{Name: "Protocol ID", Value: fmt.Sprintf("0x%04x", protocolID), Offset: 0, Length: 2},
+			models.LayerField{Name: "Version", Value: fmt.Sprintf("%d", version), Offset: 2, Length: 1},
 		)
 	}
 	if len(data) >= 4 {
@@ -458,36 +618,36 @@ func parseSTP(stp *layers.STP) models.LayerDetail {
 		default:
 			msgType = fmt.Sprintf("0x%02x", data[3])
 		}
-		fields = append(fields, models.LayerField{Name: "Message Type", Value: msgType})
+		fields = append(fields, models.LayerField{Name: "Message Type", Value: msgType, Offset: 3, Length: 1})
 	}
-	if len(data) >= 12 {
+	if len(data) >= 13 {
 		// Root bridge ID: bytes 5-12 (priority 2 bytes + MAC 6 bytes)
 		rootPri := binary.BigEndian.Uint16(data[5:7])
 		rootMAC := net.HardwareAddr(data[7:13])
 		fields = append(fields,
-			models.LayerField{Name: "Root Priority", Value: fmt.Sprintf("%d", rootPri)},
-			models.LayerField{Name: "Root Bridge ID", Value: rootMAC.String()},
+			models.LayerField{Name: "Root Priority", Value: fmt.Sprintf("%d", rootPri), Offset: 5, Length: 2},
+			models.LayerField{Name: "Root Bridge ID", Value: rootMAC.String(), Offset: 7, Length: 6},
 		)
 	}
 	if len(data) >= 17 {
 		rootPathCost := binary.BigEndian.Uint32(data[13:17])
-		fields = append(fields, models.LayerField{Name: "Root Path Cost", Value: fmt.Sprintf("%d", rootPathCost)})
+		fields = append(fields, models.LayerField{Name: "Root Path Cost", Value: fmt.Sprintf("%d", rootPathCost), Offset: 13, Length: 4})
 	}
 	if len(data) >= 25 {
 		bridgePri := binary.BigEndian.Uint16(data[17:19])
 		bridgeMAC := net.HardwareAddr(data[19:25])
 		fields = append(fields,
-			models.LayerField{Name: "Bridge Priority", Value: fmt.Sprintf("%d", bridgePri)},
-			models.LayerField{Name: "Bridge ID", Value: bridgeMAC.String()},
+			models.LayerField{Name: "Bridge Priority", Value: fmt.Sprintf("%d", bridgePri), Offset: 17, Length: 2},
+			models.LayerField{Name: "Bridge ID", Value: bridgeMAC.String(), Offset: 19, Length: 6},
 		)
 	}
 	if len(data) >= 27 {
 		portID := binary.BigEndian.Uint16(data[25:27])
-		fields = append(fields, models.LayerField{Name: "Port ID", Value: fmt.Sprintf("0x%04x", portID)})
+		fields = append(fields, models.LayerField{Name: "Port ID", Value: fmt.Sprintf("0x%04x", portID), Offset: 25, Length: 2})
 	}
 
 	if len(fields) == 0 {
-		fields = append(fields, models.LayerField{Name: "Data", Value: fmt.Sprintf("%d bytes", len(data))})
+		fields = append(fields, models.LayerField{Name: "Data", Value: fmt.Sprintf("%d bytes", len(data)), Offset: 0, Length: len(data)})
 	}
 
 	return models.LayerDetail{Name: "STP", Fields: fields}
@@ -499,45 +659,102 @@ func parseDNS(dns *layers.DNS) models.LayerDetail {
 	rcodeStr := dnsRcodeString(dns.ResponseCode)
 
 	fields := []models.LayerField{
-		{Name: "Transaction ID", Value: fmt.Sprintf("0x%04x", dns.ID)},
-		{Name: "QR", Value: boolToStr(dns.QR, "Response", "Query")},
-		{Name: "Opcode", Value: fmt.Sprintf("%d", dns.OpCode)},
-		{Name: "Response Code", Value: rcodeStr},
-		{Name: "Questions", Value: fmt.Sprintf("%d", dns.QDCount)},
-		{Name: "Answers", Value: fmt.Sprintf("%d", dns.ANCount)},
-		{Name: "Authority", Value: fmt.Sprintf("%d", dns.NSCount)},
-		{Name: "Additional", Value: fmt.Sprintf("%d", dns.ARCount)},
+		{Name: "Transaction ID", Value: fmt.Sprintf("0x%04x", dns.ID), Offset: 0, Length: 2},
+		{Name: "QR", Value: boolToStr(dns.QR, "Response", "Query"), Offset: 2, Length: 1},
+		{Name: "Opcode", Value: fmt.Sprintf("%d", dns.OpCode), Offset: 2, Length: 1},
+		{Name: "Response Code", Value: rcodeStr, Offset: 3, Length: 1},
+		{Name: "Questions", Value: fmt.Sprintf("%d", dns.QDCount), Offset: 4, Length: 2},
+		{Name: "Answers", Value: fmt.Sprintf("%d", dns.ANCount), Offset: 6, Length: 2},
+		{Name: "Authority", Value: fmt.Sprintf("%d", dns.NSCount), Offset: 8, Length: 2},
+		{Name: "Additional", Value: fmt.Sprintf("%d", dns.ARCount), Offset: 10, Length: 2},
+	}
+
+	questions, records := dnsSpans(dns.Contents)
+	for i, q := range dns.Questions {
+		fields = append(fields, spanAt(questions, i).field("Query",
+			fmt.Sprintf("%s %s %s", string(q.Name), q.Type.String(), q.Class.String())))
+	}
+
+	k := 0
+	for _, section := range []struct {
+		name string
+		rrs  []layers.DNSResourceRecord
+	}{{"Answer", dns.Answers}, {"Authority", dns.Authorities}, {"Additional", dns.Additionals}} {
+		for _, a := range section.rrs {
+			fields = append(fields, spanAt(records, k).field(section.name, dnsResourceString(a)))
+			k++
+		}
 	}
 
-	for _, q := range dns.Questions {
-		fields = append(fields, models.LayerField{
-			Name:  "Query",
-			Value: fmt.Sprintf("%s %s %s", string(q.Name), q.Type.String(), q.Class.String()),
-		})
-	}
+	return models.LayerDetail{Name: "DNS", Fields: fields}
+}
 
-	for _, a := range dns.Answers {
-		fields = append(fields, models.LayerField{
-			Name:  "Answer",
-			Value: dnsResourceString(a),
-		})
+// dnsSpans walks the questions and resource records of the DNS message
+// msg, in wire order, stopping at the first that does not parse.
+func dnsSpans(msg []byte) (questions, records []span) {
+	if len(msg) < 12 {
+		return nil, nil
+	}
+	qd := int(binary.BigEndian.Uint16(msg[4:]))
+	rr := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+	off := 12
+	for i := 0; i < qd+rr; i++ {
+		end, ok := skipDNSName(msg, off)
+		if !ok || end+4 > len(msg) {
+			break
+		}
+		end += 4
+		if i >= qd {
+			if end+6 > len(msg) {
+				break
+			}
+			end += 6 + int(binary.BigEndian.Uint16(msg[end+4:]))
+			if end > len(msg) {
+				break
+			}
+		}
+		if i < qd {
+			questions = append(questions, span{off, end - off})
+		} else {
+			records = append(records, span{off, end - off})
+		}
+		off = end
 	}
+	return questions, records
+}
 
-	for _, a := range dns.Authorities {
-		fields = append(fields, models.LayerField{
-			Name:  "Authority",
-			Value: dnsResourceString(a),
-		})
+// skipDNSName returns the offset just past the name at off, which ends
+// with a zero label or a compression pointer.
+func skipDNSName(msg []byte, off int) (int, bool) {
+	for off < len(msg) {
+		switch l := int(msg[off]); {
+		case l == 0:
+			return off + 1, true
+		case l&0xc0 == 0xc0:
+			return off + 2, off+2 <= len(msg)
+		default:
+			off += 1 + l
+		}
 	}
+	return 0, false
+}
 
-	for _, a := range dns.Additionals {
-		fields = append(fields, models.LayerField{
-			Name:  "Additional",
-			Value: dnsResourceString(a),
-		})
+// spanAt returns spans[i], or the zero span past its end.
+func spanAt(spans []span, i int) span {
+	if i < len(spans) {
+		return spans[i]
 	}
+	return span{}
+}
 
-	return models.LayerDetail{Name: "DNS", Fields: fields}
+// spanning returns the span from the first of spans to the end of the
+// last.
+func spanning(spans []span) span {
+	if len(spans) == 0 {
+		return span{}
+	}
+	last := spans[len(spans)-1]
+	return span{spans[0].off, last.off + last.n - spans[0].off}
 }
 
 func dnsResourceString(a layers.DNSResourceRecord) string {
@@ -561,6 +778,8 @@ func dnsResourceString(a layers.DNSResourceRecord) string {
 		return fmt.Sprintf("%s -> \"%s\" (TXT, TTL: %d)", name, strings.Join(txts, " "), a.TTL)
 	case layers.DNSTypePTR:
 		return fmt.Sprintf("%s -> %s (PTR, TTL: %d)", name, string(a.PTR), a.TTL)
+	case layers.DNSTypeSRV:
+		return fmt.Sprintf("%s -> %s:%d priority=%d weight=%d (SRV, TTL: %d)", name, string(a.SRV.Name), a.SRV.Port, a.SRV.Priority, a.SRV.Weight, a.TTL)
 	case layers.DNSTypeSOA:
 		return fmt.Sprintf("%s (SOA: %s %s, TTL: %d)", name, string(a.SOA.MName), string(a.SOA.RName), a.TTL)
 	}
@@ -652,11 +871,10 @@ func boolToStr(b bool, t, f string) string {
 }
 
 // summarize determines the highest-level protocol and builds address/info strings.
-func summarize(pkt gopacket.Packet) (protocol, src, dst, info string) {
+func summarize(pkt gopacket.Packet) (protocol, src, dst string, info []models.InfoPart) {
 	protocol = "Unknown"
 	src = ""
 	dst = ""
-	info = ""
 
 	// Check for TLS
 	if tlsLayer := pkt.Layer(layers.LayerTypeTLS); tlsLayer != nil {
@@ -665,33 +883,51 @@ func summarize(pkt gopacket.Packet) (protocol, src, dst, info string) {
 		if len(tls.Contents) > 0 {
 			switch tls.Contents[0] {
 			case 22:
-				info = "Handshake"
-				var rawData []byte
+				info = []models.InfoPart{infoPart("tls.handshake")}
+				var raw []byte
 				if appLayer := pkt.ApplicationLayer(); appLayer != nil {
-					rawData = appLayer.LayerContents()
+					raw = appLayer.LayerContents()
 				}
-				if len(rawData) == 0 {
-					rawData = tls.Contents
+				if len(raw) == 0 {
+					raw = tls.Contents
 				}
-				hello := parseTLSClientHello(rawData)
-				if hello != nil {
+				if sh := parseTLSServerHello(raw); sh != nil {
+					info = []models.InfoPart{infoPart("tls.server_hello",
+						"version", tlsVersionString(sh.NegotiatedVersion()),
+						"cipher", cipherSuiteName(sh.CipherSuite))}
+					if sh.ALPN != "" {
+						info = append(info, infoPart("tls.alpn", "alpn", sh.ALPN))
+					}
+				} else if hello := parseTLSClientHello(raw); hello != nil {
 					if hello.SNI != "" {
-						info = fmt.Sprintf("Client Hello, SNI=%s", hello.SNI)
+						info = []models.InfoPart{infoPart("tls.client_hello", "sni", hello.SNI)}
 					}
 					if hello.JA3Hash != "" {
-						info += fmt.Sprintf(" [JA3:%s]", hello.JA3Hash[:12])
+						info = append(info, infoPart("tls.ja3", "ja3", hello.JA3Hash[:12]))
 					}
 				}
 			case 23:
-				info = "Application Data"
+				info = []models.InfoPart{infoPart("tls.app_data")}
 			case 20:
-				info = "Change Cipher Spec"
+				info = []models.InfoPart{infoPart("tls.ccs")}
 			case 21:
-				info = "Alert"
+				info = []models.InfoPart{infoPart("tls.alert")}
 			}
 		}
 	}
 
+	// Cleartext HTTP/2 (h2c, gRPC)
+	if frames, grpc := HTTP2From(pkt); len(frames) > 0 && protocol == "Unknown" {
+		var text string
+		protocol, text = http2Summary(frames, grpc)
+		info = infoText(text)
+	}
+
+	// gopacket decodes UDP 5060 as SIP, leaving only the body as payload
+	if pkt.Layer(layers.LayerTypeSIP) != nil && protocol == "Unknown" {
+		protocol, info = "SIP", infoText(sipMethod(transportPayload(pkt)))
+	}
+
 	// Check for HTTP (in payload)
 	if appLayer := pkt.ApplicationLayer(); appLayer != nil && protocol == "Unknown" {
 		payload := appLayer.Payload()
@@ -705,25 +941,38 @@ func summarize(pkt gopacket.Packet) (protocol, src, dst, info string) {
 					// Response: show "200 OK"
 					parts := strings.SplitN(first, " ", 3)
 					if len(parts) >= 3 {
-						info = parts[1] + " " + parts[2]
+						info = []models.InfoPart{infoPart("http.response", "status", parts[1], "reason", parts[2])}
 					} else {
-						info = first
+						info = infoText(first)
 					}
 				} else {
 					// Request: show "GET /path"
 					parts := strings.SplitN(first, " ", 3)
 					if len(parts) >= 2 {
-						info = parts[0] + " " + parts[1]
+						info = []models.InfoPart{infoPart("http.request", "method", parts[0], "uri", parts[1])}
 					} else {
-						info = first
+						info = infoText(first)
 					}
 				}
 			}
+			if ntlm := findNTLM(payload); ntlm != nil {
+				info = append(info, infoPart("suffix", "text", ntlm.Summary()))
+			}
+			if ocsp := findOCSP(payload); ocsp != nil {
+				info = append(info, infoPart("suffix", "text", ocsp.Summary()))
+			} else if crl := findCRL(payload); crl != nil {
+				info = append(info, infoPart("suffix", "text", crl.Summary()))
+			} else if pac := findPAC(payload); pac != nil {
+				info = append(info, infoPart("suffix", "text", pac.Summary()))
+			}
+			if dns := ExtractDoH(pkt); dns != nil {
+				protocol, info = "DoH", infoText(DNSSummary(dns))
+			}
 		} else {
 			// Try app heuristic detection for summarize
 			if proto, infoStr := detectAppProtocolSummary(payload, pkt); proto != "" {
 				protocol = proto
-				info = infoStr
+				info = infoText(infoStr)
 			}
 		}
 	}
@@ -743,7 +992,10 @@ func summarize(pkt gopacket.Packet) (protocol, src, dst, info string) {
 		default:
 			mode = fmt.Sprintf("Mode %d", ntp.Mode)
 		}
-		info = fmt.Sprintf("NTPv%d %s Stratum=%d", ntp.Version, mode, ntp.Stratum)
+		info = []models.InfoPart{infoPart("ntp",
+			"version", fmt.Sprintf("%d", ntp.Version),
+			"mode", mode,
+			"stratum", fmt.Sprintf("%d", ntp.Stratum))}
 	}
 
 	// DHCPv4
@@ -757,7 +1009,18 @@ func summarize(pkt gopacket.Packet) (protocol, src, dst, info string) {
 				break
 			}
 		}
-		info = fmt.Sprintf("DHCP %s XID=0x%08x", msgType, dhcp.Xid)
+		info = []models.InfoPart{infoPart("dhcp", "type", msgType, "xid", fmt.Sprintf("0x%08x", dhcp.Xid))}
+	}
+
+	// DHCPv6
+	if dhcpLayer := pkt.Layer(layers.LayerTypeDHCPv6); dhcpLayer != nil && protocol == "Unknown" {
+		protocol = "DHCPv6"
+		msgType, id := dhcpv6Summary(dhcpLayer.(*layers.DHCPv6))
+		if strings.HasPrefix(msgType, "Relay") {
+			info = []models.InfoPart{infoPart("dhcpv6.relay", "type", msgType, "peer", id)}
+		} else {
+			info = []models.InfoPart{infoPart("dhcpv6", "type", msgType, "xid", id)}
+		}
 	}
 
 	// IGMP
@@ -766,21 +1029,21 @@ func summarize(pkt gopacket.Packet) (protocol, src, dst, info string) {
 		if igmp, ok := igmpLayer.(*layers.IGMPv1or2); ok {
 			switch igmp.Type {
 			case 0x11:
-				info = "Membership Query"
+				info = []models.InfoPart{infoPart("igmp.query")}
 			case 0x12:
-				info = "IGMPv1 Membership Report"
+				info = []models.InfoPart{infoPart("igmp.v1_report")}
 			case 0x16:
-				info = "IGMPv2 Membership Report"
+				info = []models.InfoPart{infoPart("igmp.v2_report")}
 			case 0x17:
-				info = "Leave Group"
+				info = []models.InfoPart{infoPart("igmp.leave")}
 			default:
-				info = fmt.Sprintf("Type 0x%02x", igmp.Type)
+				info = []models.InfoPart{infoPart("igmp.type", "type", fmt.Sprintf("0x%02x", uint8(igmp.Type)))}
 			}
 			if igmp.GroupAddress != nil {
-				info += " " + igmp.GroupAddress.String()
+				info = append(info, infoPart("igmp.group", "group", igmp.GroupAddress.String()))
 			}
 		} else {
-			info = "IGMP"
+			info = []models.InfoPart{infoPart("igmp")}
 		}
 	}
 
@@ -788,69 +1051,64 @@ func summarize(pkt gopacket.Packet) (protocol, src, dst, info string) {
 	if greLayer := pkt.Layer(layers.LayerTypeGRE); greLayer != nil && protocol == "Unknown" {
 		gre := greLayer.(*layers.GRE)
 		protocol = "GRE"
-		info = fmt.Sprintf("Encapsulated %s", gre.Protocol.String())
+		info = []models.InfoPart{infoPart("gre", "protocol", gre.Protocol.String())}
+	}
+
+	// GTP-U signalling; G-PDUs are decapsulated before they get here
+	if gtpLayer := pkt.Layer(layers.LayerTypeGTPv1U); gtpLayer != nil && protocol == "Unknown" {
+		gtp := gtpLayer.(*layers.GTPv1U)
+		protocol = "GTP-U"
+		info = infoText(fmt.Sprintf("%s TEID=0x%08x", gtpv1MessageName(gtp.MessageType), gtp.TEID))
 	}
 
 	// SCTP
 	if sctpLayer := pkt.Layer(layers.LayerTypeSCTP); sctpLayer != nil && protocol == "Unknown" {
-		sctp := sctpLayer.(*layers.SCTP)
-		protocol = "SCTP"
-		info = fmt.Sprintf("%d -> %d", sctp.SrcPort, sctp.DstPort)
+		var text string
+		protocol, text = sctpSummary(sctpLayer.(*layers.SCTP))
+		info = infoText(text)
 	}
 
 	// STP
 	if stpLayer := pkt.Layer(layers.LayerTypeSTP); stpLayer != nil && protocol == "Unknown" {
 		protocol = "STP"
-		info = "Spanning Tree Protocol"
+		info = []models.InfoPart{infoPart("stp")}
 	}
 
 	// DNS
 	if dnsLayer := pkt.Layer(layers.LayerTypeDNS); dnsLayer != nil {
-		dns := dnsLayer.(*layers.DNS)
 		protocol = "DNS"
-		rcode := dnsRcodeString(dns.ResponseCode)
-		if dns.QR {
-			info = "Response " + rcode
-			// Show first resolved IP for responses
-			for _, a := range dns.Answers {
-				if a.IP != nil {
-					info += " " + a.IP.String()
-					break
-				}
-			}
-		} else {
-			info = "Query"
-		}
-		for _, q := range dns.Questions {
-			info += " " + string(q.Name) + " " + q.Type.String()
-		}
+		info = infoText(DNSSummary(dnsLayer.(*layers.DNS)))
 	}
 
 	// ICMPv6
 	if icmpv6Layer := pkt.Layer(layers.LayerTypeICMPv6); icmpv6Layer != nil && protocol == "Unknown" {
 		icmpv6 := icmpv6Layer.(*layers.ICMPv6)
 		protocol = "ICMPv6"
-		info = icmpv6.TypeCode.String()
+		info = []models.InfoPart{infoPart("icmp",
+			"name", icmpv6.TypeCode.String(),
+			"type", fmt.Sprintf("%d", icmpv6.TypeCode.Type()),
+			"code", fmt.Sprintf("%d", icmpv6.TypeCode.Code()))}
+		if q := icmpv6Quote(icmpv6); q != nil {
+			info = append(info, infoPart("icmp.quote", "quote", q.String()))
+		}
+		info = append(info, ndpSummary(icmpv6)...)
 	}
 
 	// ICMPv4
 	if icmpLayer := pkt.Layer(layers.LayerTypeICMPv4); icmpLayer != nil && protocol == "Unknown" {
 		icmp := icmpLayer.(*layers.ICMPv4)
 		protocol = "ICMP"
-		info = icmp.TypeCode.String()
-	}
-
-	// VLAN
-	if vlanLayer := pkt.Layer(layers.LayerTypeDot1Q); vlanLayer != nil {
-		vlan := vlanLayer.(*layers.Dot1Q)
-		if protocol == "Unknown" {
-			protocol = "VLAN"
+		info = []models.InfoPart{infoPart("icmp",
+			"name", icmp.TypeCode.String(),
+			"type", fmt.Sprintf("%d", icmp.TypeCode.Type()),
+			"code", fmt.Sprintf("%d", icmp.TypeCode.Code()))}
+		if q := icmpv4Quote(icmp); q != nil {
+			info = append(info, infoPart("icmp.quote", "quote", q.String()))
 		}
-		info = fmt.Sprintf("VLAN %d: %s", vlan.VLANIdentifier, info)
 	}
 
 	// TCP
-	if tcpLayer := pkt.Layer(layers.LayerTypeTCP); tcpLayer != nil && (protocol == "Unknown" || protocol == "HTTP" || protocol == "TLS" || protocol == "SSH" || protocol == "MQTT" || protocol == "Modbus" || protocol == "RDP") {
+	if tcpLayer := pkt.Layer(layers.LayerTypeTCP); tcpLayer != nil && (protocol == "Unknown" || protocol == "HTTP" || protocol == "HTTP2" || protocol == "gRPC" || protocol == "DoH" || protocol == "TLS" || protocol == "SSH" || protocol == "MQTT" || protocol == "SIP" || protocol == "Modbus" || protocol == "RDP" || protocol == "SMB" || protocol == "SMB2" || protocol == "Kerberos" || protocol == "LDAP" || protocol == "Syslog" || protocol == "SMTP" || protocol == "POP3" || protocol == "IMAP") {
 		tcp := tcpLayer.(*layers.TCP)
 		if protocol == "Unknown" {
 			protocol = "TCP"
@@ -872,20 +1130,32 @@ func summarize(pkt gopacket.Packet) (protocol, src, dst, info string) {
 			flagParts = append(flagParts, "PSH")
 		}
 		if protocol == "TCP" {
-			info = fmt.Sprintf("%d -> %d [%s] Seq=%d Ack=%d Win=%d Len=%d",
-				tcp.SrcPort, tcp.DstPort, strings.Join(flagParts, ","),
-				tcp.Seq, tcp.Ack, tcp.Window, len(tcp.Payload))
+			info = []models.InfoPart{infoPart("tcp",
+				"srcPort", fmt.Sprintf("%d", tcp.SrcPort),
+				"dstPort", fmt.Sprintf("%d", tcp.DstPort),
+				"flags", strings.Join(flagParts, ","),
+				"seq", fmt.Sprintf("%d", tcp.Seq),
+				"ack", fmt.Sprintf("%d", tcp.Ack),
+				"win", fmt.Sprintf("%d", tcp.Window),
+				"len", fmt.Sprintf("%d", len(tcp.Payload)))}
+			// DNS over TLS, on its own port
+			if len(tcp.Payload) > 0 && portIs(pkt, dnsPort853) {
+				protocol = "DoT"
+			}
 		}
 		src = addPort(src, fmt.Sprintf("%d", tcp.SrcPort))
 		dst = addPort(dst, fmt.Sprintf("%d", tcp.DstPort))
 	}
 
 	// UDP
-	if udpLayer := pkt.Layer(layers.LayerTypeUDP); udpLayer != nil && (protocol == "Unknown" || protocol == "QUIC" || protocol == "SIP") {
+	if udpLayer := pkt.Layer(layers.LayerTypeUDP); udpLayer != nil && (protocol == "Unknown" || protocol == "QUIC" || protocol == "DoQ" || protocol == "SIP" || protocol == "Kerberos" || protocol == "LDAP" || protocol == "mDNS" || protocol == "LLMNR" || protocol == "NBNS" || protocol == "RTP" || protocol == "RTCP" || protocol == "GTP-U" || protocol == "GTPv2" || protocol == "SNMP" || protocol == "Syslog") {
 		udp := udpLayer.(*layers.UDP)
 		if protocol == "Unknown" {
 			protocol = "UDP"
-			info = fmt.Sprintf("%d -> %d Len=%d", udp.SrcPort, udp.DstPort, udp.Length)
+			info = []models.InfoPart{infoPart("udp",
+				"srcPort", fmt.Sprintf("%d", udp.SrcPort),
+				"dstPort", fmt.Sprintf("%d", udp.DstPort),
+				"len", fmt.Sprintf("%d", udp.Length))}
 		}
 		src = addPort(src, fmt.Sprintf("%d", udp.SrcPort))
 		dst = addPort(dst, fmt.Sprintf("%d", udp.DstPort))
@@ -925,10 +1195,32 @@ func summarize(pkt gopacket.Packet) (protocol, src, dst, info string) {
 		src = srcIP
 		dst = dstIP
 		if arp.Operation == 1 {
-			info = fmt.Sprintf("Who has %s? Tell %s", dstIP, srcIP)
+			info = []models.InfoPart{infoPart("arp.request", "target", dstIP, "sender", srcIP)}
 		} else {
-			info = fmt.Sprintf("%s is at %x", srcIP, arp.SourceHwAddress)
+			info = []models.InfoPart{infoPart("arp.reply", "sender", srcIP, "mac", fmt.Sprintf("%x", arp.SourceHwAddress))}
+		}
+	}
+
+	// VLAN tags and MPLS labels, outermost first, prefix the info of
+	// whatever they carry. Labels go in first so the tags end up in front
+	if labels := mplsLabels(pkt); len(labels) > 0 {
+		if protocol == "Unknown" {
+			protocol = "MPLS"
 		}
+		info = append([]models.InfoPart{infoPart("mpls", "labels", joinNumbers(labels))}, info...)
+	}
+
+	if ids := vlanIDs(pkt); len(ids) > 0 {
+		if protocol == "Unknown" {
+			protocol = "VLAN"
+		}
+		info = append([]models.InfoPart{infoPart("vlan", "tags", joinNumbers(ids))}, info...)
+	}
+
+	// Tunnels, outermost first, come before the VLAN tags of the frame
+	// they carry
+	if tun := tunnelInfo(pkt); len(tun) > 0 {
+		info = append(tun, info...)
 	}
 
 	// Ethernet fallback
@@ -942,6 +1234,16 @@ func summarize(pkt gopacket.Packet) (protocol, src, dst, info string) {
 		}
 	}
 
+	// Cooked captures only carry the source address
+	if src == "" {
+		switch l := pkt.LinkLayer().(type) {
+		case *layers.LinuxSLL:
+			src = l.Addr.String()
+		case *LinuxSLL2:
+			src = l.Addr.String()
+		}
+	}
+
 	return
 }
 
@@ -1020,14 +1322,6 @@ func quicVersionString(v uint32) string {
 	}
 }
 
-// hexDCID returns hex-encoded first N bytes of a QUIC destination connection ID.
-func hexDCID(data []byte, offset, length int) string {
-	if offset+length > len(data) {
-		return "truncated"
-	}
-	return fmt.Sprintf("%x", data[offset:offset+length])
-}
-
 // sipMethod extracts the SIP method from the first line.
 func sipMethod(data []byte) string {
 	line := firstLine(data)
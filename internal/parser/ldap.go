@@ -0,0 +1,391 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+)
+
+// LDAP and Active Directory global catalog ports. LDAPS (636) is TLS from
+// the first byte and cannot be dissected.
+const (
+	portLDAP          = 389
+	portGlobalCatalog = 3268
+)
+
+var ldapOps = map[int]string{
+	0:  "bindRequest",
+	1:  "bindResponse",
+	2:  "unbindRequest",
+	3:  "searchRequest",
+	4:  "searchResEntry",
+	5:  "searchResDone",
+	6:  "modifyRequest",
+	7:  "modifyResponse",
+	8:  "addRequest",
+	9:  "addResponse",
+	10: "delRequest",
+	11: "delResponse",
+	12: "modDNRequest",
+	13: "modDNResponse",
+	14: "compareRequest",
+	15: "compareResponse",
+	16: "abandonRequest",
+	19: "searchResRef",
+	23: "extendedReq",
+	24: "extendedResp",
+	25: "intermediateResponse",
+}
+
+var ldapScopes = []string{"baseObject", "singleLevel", "wholeSubtree"}
+
+var ldapResultCodes = map[int64]string{
+	0:  "success",
+	1:  "operationsError",
+	2:  "protocolError",
+	3:  "timeLimitExceeded",
+	4:  "sizeLimitExceeded",
+	7:  "authMethodNotSupported",
+	8:  "strongerAuthRequired",
+	10: "referral",
+	14: "saslBindInProgress",
+	16: "noSuchAttribute",
+	32: "noSuchObject",
+	34: "invalidDNSyntax",
+	48: "inappropriateAuthentication",
+	49: "invalidCredentials",
+	50: "insufficientAccessRights",
+	51: "busy",
+	52: "unavailable",
+	53: "unwillingToPerform",
+	68: "entryAlreadyExists",
+	80: "other",
+}
+
+// LDAPMessage is one decoded LDAP message (RFC 4511).
+type LDAPMessage struct {
+	ID     int64
+	Op     int
+	DN     string // bind name, search base or entry name
+	Auth   string // bind: "simple" or the SASL mechanism
+	Scope  string // search only
+	Filter string // search only, in RFC 4515 string form
+	Attrs  []string
+	Result int64 // responses carrying an LDAPResult
+	HasRes bool
+	Diag   string // diagnostic message of a result
+	OID    string // extended operation name
+
+	// The payload the message was read from, and where it and its fields
+	// are in it
+	raw                                                []byte
+	msgAt, idAt, opAt, dnAt, authAt, scopeAt, filterAt span
+	attrsAt, oidAt, resultAt, diagAt                   span
+}
+
+// at returns where t, an element of the message, is in the payload.
+func (m *LDAPMessage) at(t berTLV) span {
+	return spanOf(m.raw, t.Raw)
+}
+
+// OpName returns the operation name, e.g. "searchRequest".
+func (m *LDAPMessage) OpName() string {
+	if n, ok := ldapOps[m.Op]; ok {
+		return n
+	}
+	return fmt.Sprintf("op %d", m.Op)
+}
+
+// Summary is a Wireshark-style description, e.g.
+// `searchRequest(2) "DC=corp,DC=local" wholeSubtree`.
+func (m *LDAPMessage) Summary() string {
+	s := fmt.Sprintf("%s(%d)", m.OpName(), m.ID)
+	if m.DN != "" || m.Op == 0 || m.Op == 3 {
+		s += fmt.Sprintf(" %q", m.DN)
+	}
+	if m.Auth != "" {
+		s += " " + m.Auth
+	}
+	if m.Scope != "" {
+		s += " " + m.Scope
+	}
+	if m.OID != "" {
+		s += " " + m.OID
+	}
+	if m.HasRes {
+		s += " " + ldapResultString(m.Result)
+	}
+	return s
+}
+
+func ldapResultString(code int64) string {
+	if n, ok := ldapResultCodes[code]; ok {
+		return n
+	}
+	return fmt.Sprintf("result %d", code)
+}
+
+// parseLDAPMessages decodes the LDAP messages in a payload, or returns nil
+// if it does not start with one (SASL-encrypted traffic, for instance).
+func parseLDAPMessages(data []byte) []*LDAPMessage {
+	var out []*LDAPMessage
+	for rest := data; len(rest) > 0; {
+		msg, next, ok := readBER(rest)
+		if !ok || msg.Class != berUniversal || msg.Tag != 0x10 {
+			break
+		}
+		m := parseLDAPMessage(data, msg)
+		if m == nil {
+			break
+		}
+		out = append(out, m)
+		rest = next
+	}
+	return out
+}
+
+// parseLDAPMessage decodes msg, an LDAPMessage SEQUENCE read from data.
+func parseLDAPMessage(data []byte, msg berTLV) *LDAPMessage {
+	id, rest, ok := readBER(msg.Value)
+	if !ok || id.Class != berUniversal || id.Tag != 2 {
+		return nil
+	}
+	op, _, ok := readBER(rest)
+	if !ok || op.Class != berApplication || ldapOps[op.Tag] == "" {
+		return nil
+	}
+	m := &LDAPMessage{ID: berInt(id.Value), Op: op.Tag, raw: data}
+	m.msgAt, m.idAt = m.at(msg), m.at(id)
+	// The operation's header carries its tag
+	m.opAt = span{m.at(op).off, len(op.Raw) - len(op.Value)}
+	if !op.Constructed {
+		// unbindRequest is NULL, delRequest is the DN and abandonRequest
+		// the message ID
+		if op.Tag == 10 {
+			m.DN, m.dnAt = string(op.Value), m.at(op)
+		}
+		return m
+	}
+	c := berChildren(op.Value)
+	switch op.Tag {
+	case 0: // bindRequest
+		if len(c) < 3 {
+			return nil
+		}
+		m.DN, m.dnAt = string(c[1].Value), m.at(c[1])
+		switch {
+		case c[2].Class == berContext && c[2].Tag == 0:
+			m.Auth = "simple"
+		case c[2].Class == berContext && c[2].Tag == 3:
+			if mech := berChildren(c[2].Value); len(mech) > 0 {
+				m.Auth = "sasl " + string(mech[0].Value)
+			}
+		}
+		m.authAt = m.at(c[2])
+	case 3: // searchRequest
+		if len(c) < 8 {
+			return nil
+		}
+		m.DN, m.dnAt = string(c[0].Value), m.at(c[0])
+		if s := berInt(c[1].Value); s >= 0 && int(s) < len(ldapScopes) {
+			m.Scope, m.scopeAt = ldapScopes[s], m.at(c[1])
+		}
+		m.Filter, m.filterAt = ldapFilter(c[6], 0), m.at(c[6])
+		for _, a := range berChildren(c[7].Value) {
+			m.Attrs = append(m.Attrs, string(a.Value))
+		}
+		m.attrsAt = m.at(c[7])
+	case 4: // searchResEntry
+		if len(c) > 0 {
+			m.DN, m.dnAt = string(c[0].Value), m.at(c[0])
+		}
+		if len(c) > 1 {
+			for _, a := range berChildren(c[1].Value) {
+				if ac := berChildren(a.Value); len(ac) > 0 {
+					m.Attrs = append(m.Attrs, string(ac[0].Value))
+				}
+			}
+			m.attrsAt = m.at(c[1])
+		}
+	case 6, 8, 12, 14: // modify, add, modDN and compare name their entry first
+		if len(c) > 0 {
+			m.DN, m.dnAt = string(c[0].Value), m.at(c[0])
+		}
+	case 23: // extendedReq: requestName [0]
+		if len(c) > 0 && c[0].Class == berContext && c[0].Tag == 0 {
+			m.OID, m.oidAt = ldapExtendedName(string(c[0].Value)), m.at(c[0])
+		}
+	case 1, 5, 7, 9, 11, 13, 15, 24: // LDAPResult
+		if len(c) < 3 {
+			return nil
+		}
+		m.Result, m.HasRes, m.resultAt = berInt(c[0].Value), true, m.at(c[0])
+		m.DN, m.dnAt = string(c[1].Value), m.at(c[1])
+		m.Diag, m.diagAt = string(c[2].Value), m.at(c[2])
+	}
+	return m
+}
+
+// ldapExtendedName names the extended operations seen in AD traffic.
+func ldapExtendedName(oid string) string {
+	switch oid {
+	case "1.3.6.1.4.1.1466.20037":
+		return "StartTLS"
+	case "1.3.6.1.4.1.4203.1.11.3":
+		return "WhoAmI"
+	case "1.3.6.1.4.1.4203.1.11.1":
+		return "PasswordModify"
+	}
+	return oid
+}
+
+// ldapFilter renders a search Filter in RFC 4515 string form.
+func ldapFilter(t berTLV, depth int) string {
+	if t.Class != berContext || depth > 16 {
+		return "?"
+	}
+	c := berChildren(t.Value)
+	ava := func(op string) string {
+		if len(c) < 2 {
+			return "?"
+		}
+		return "(" + string(c[0].Value) + op + ldapFilterValue(c[1].Value) + ")"
+	}
+	switch t.Tag {
+	case 0, 1: // and, or
+		var sb strings.Builder
+		op := "(&"
+		if t.Tag == 1 {
+			op = "(|"
+		}
+		sb.WriteString(op)
+		for _, f := range c {
+			sb.WriteString(ldapFilter(f, depth+1))
+		}
+		sb.WriteString(")")
+		return sb.String()
+	case 2: // not
+		if len(c) == 0 {
+			return "?"
+		}
+		return "(!" + ldapFilter(c[0], depth+1) + ")"
+	case 3:
+		return ava("=")
+	case 4: // substrings
+		if len(c) < 2 {
+			return "?"
+		}
+		var initial, final string
+		anys := []string{""}
+		for _, s := range berChildren(c[1].Value) {
+			switch s.Tag {
+			case 0:
+				initial = ldapFilterValue(s.Value)
+			case 1:
+				anys = append(anys, ldapFilterValue(s.Value))
+			case 2:
+				final = ldapFilterValue(s.Value)
+			}
+		}
+		anys = append(anys, "")
+		return "(" + string(c[0].Value) + "=" + initial + strings.Join(anys, "*") + final + ")"
+	case 5:
+		return ava(">=")
+	case 6:
+		return ava("<=")
+	case 7: // present, primitive
+		return "(" + string(t.Value) + "=*)"
+	case 8:
+		return ava("~=")
+	case 9: // extensibleMatch
+		var rule, typ, val string
+		dn := false
+		for _, f := range c {
+			switch f.Tag {
+			case 1:
+				rule = string(f.Value)
+			case 2:
+				typ = string(f.Value)
+			case 3:
+				val = ldapFilterValue(f.Value)
+			case 4:
+				dn = berInt(f.Value) != 0
+			}
+		}
+		s := "(" + typ
+		if dn {
+			s += ":dn"
+		}
+		if rule != "" {
+			s += ":" + rule
+		}
+		return s + ":=" + val + ")"
+	}
+	return "?"
+}
+
+// ldapFilterValue escapes an assertion value as RFC 4515 requires,
+// hex-escaping binary values such as objectSid.
+func ldapFilterValue(v []byte) string {
+	var sb strings.Builder
+	for _, b := range v {
+		switch {
+		case b == '*' || b == '(' || b == ')' || b == '\\' || b < 0x20 || b > 0x7e:
+			fmt.Fprintf(&sb, "\\%02x", b)
+		default:
+			sb.WriteByte(b)
+		}
+	}
+	return sb.String()
+}
+
+// isLDAPPort reports whether pkt uses an LDAP or global catalog port, or a
+// port decoded as LDAP.
+func isLDAPPort(pkt gopacket.Packet) bool {
+	return portIsAny(pkt, portLDAP, portGlobalCatalog) || decodeAsFor(pkt) == "LDAP"
+}
+
+// ldapSummary joins the summaries of the messages in a payload.
+func ldapSummary(msgs []*LDAPMessage) string {
+	parts := make([]string, len(msgs))
+	for i, m := range msgs {
+		parts[i] = m.Summary()
+		if m.Filter != "" {
+			parts[i] += " " + m.Filter
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// buildLDAPLayerDetail describes msgs; field offsets are relative to the
+// payload they were read from.
+func buildLDAPLayerDetail(msgs []*LDAPMessage) models.LayerDetail {
+	var fields []models.LayerField
+	for _, m := range msgs {
+		f := m.msgAt.field("Message", m.Summary())
+		add := func(at span, name, value string) {
+			if value != "" {
+				f.Children = append(f.Children, at.field(name, value))
+			}
+		}
+		add(m.idAt, "Message ID", fmt.Sprintf("%d", m.ID))
+		add(m.opAt, "Operation", fmt.Sprintf("%s (%d)", m.OpName(), m.Op))
+		add(m.dnAt, "DN", m.DN)
+		add(m.authAt, "Authentication", m.Auth)
+		add(m.scopeAt, "Scope", m.Scope)
+		add(m.filterAt, "Filter", m.Filter)
+		if len(m.Attrs) > 0 {
+			add(m.attrsAt, "Attributes", strings.Join(m.Attrs, ", "))
+		}
+		add(m.oidAt, "Extended Operation", m.OID)
+		if m.HasRes {
+			add(m.resultAt, "Result Code", fmt.Sprintf("%s (%d)", ldapResultString(m.Result), m.Result))
+			add(m.diagAt, "Diagnostic Message", m.Diag)
+		}
+		fields = append(fields, f)
+	}
+	return models.LayerDetail{Name: "LDAP", Fields: fields}
+}
@@ -0,0 +1,37 @@
+package parser
+
+import (
+	"time"
+
+	"sniffox/internal/models"
+)
+
+// Limits on the work spent dissecting one packet, so a crafted packet
+// cannot stall or flood the capture. A packet over a limit keeps what was
+// dissected so far and is flagged malformed.
+const (
+	maxLayers   = 48                    // protocol layers dissected
+	maxFields   = 4096                  // fields, counting children, across all layers
+	parseBudget = 50 * time.Millisecond // time spent in the layer dissectors
+)
+
+// countFields returns the number of fields in fs, counting children.
+func countFields(fs []models.LayerField) int {
+	n := len(fs)
+	for _, f := range fs {
+		n += countFields(f.Children)
+	}
+	return n
+}
+
+// MarkMalformed flags info as malformed for reason and notes it in the
+// Info column. A packet whose dissection panicked has no protocol yet and
+// is listed as Malformed.
+func MarkMalformed(info *models.PacketInfo, reason string) {
+	info.Malformed = reason
+	if info.Protocol == "" {
+		info.Protocol = "Malformed"
+	}
+	info.InfoParts = append(info.InfoParts, infoPart("malformed", "reason", reason))
+	info.Info = RenderInfo(info.InfoParts)
+}
@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+// gopacket's LinkType is a byte, so libpcap's DLT_LINUX_SLL2 (276) arrives
+// truncated. Nothing is assigned to the truncated value, so it is claimed
+// here for SLL2; FileLinkType restores the real number when writing files.
+const (
+	LinkTypeLinuxSLL2 = layers.LinkType(linkTypeLinuxSLL2 & 0xff)
+
+	linkTypeLinuxSLL2 = 276
+	linkTypeRaw       = 101
+)
+
+// LayerTypeLinuxSLL2 is the Linux cooked capture v2 header, used by
+// captures on the "any" interface with recent libpcap.
+var LayerTypeLinuxSLL2 = gopacket.RegisterLayerType(1276, gopacket.LayerTypeMetadata{
+	Name:    "LinuxSLL2",
+	Decoder: gopacket.DecodeFunc(decodeLinuxSLL2),
+})
+
+// Link types gopacket does not decode itself. DLT_PPP_HDLC is PPP with
+// the HDLC address and control bytes, which gopacket's PPP decoder skips.
+func init() {
+	layers.LinkTypeMetadata[LinkTypeLinuxSLL2] = layers.EnumMetadata{DecodeWith: LayerTypeLinuxSLL2, Name: "Linux SLL2"}
+	layers.LinkTypeMetadata[layers.LinkTypePPP_HDLC] = layers.EnumMetadata{DecodeWith: layers.LayerTypePPP, Name: "PPP HDLC"}
+	layers.LinkTypeMetadata[layers.LinkTypeIPv4] = layers.EnumMetadata{DecodeWith: layers.LayerTypeIPv4, Name: "IPv4"}
+	layers.LinkTypeMetadata[layers.LinkTypeIPv6] = layers.EnumMetadata{DecodeWith: layers.LayerTypeIPv6, Name: "IPv6"}
+}
+
+// FileLinkType returns the LINKTYPE_ value to write in a pcap or pcapng
+// file for a link type reported by libpcap: SLL2 gets its full number back,
+// and the platform-specific DLT_RAW values (12 and 14) become LINKTYPE_RAW.
+func FileLinkType(lt layers.LinkType) uint32 {
+	switch lt {
+	case LinkTypeLinuxSLL2:
+		return linkTypeLinuxSLL2
+	case 12, 14:
+		return linkTypeRaw
+	}
+	return uint32(lt)
+}
+
+// LinuxSLL2 is a Linux cooked capture v2 header. Unlike v1 it carries the
+// interface index, and the protocol type comes first.
+type LinuxSLL2 struct {
+	layers.BaseLayer
+	EthernetType   layers.EthernetType
+	InterfaceIndex uint32
+	AddrType       uint16 // ARPHRD_ type
+	PacketType     layers.LinuxSLLPacketType
+	Addr           net.HardwareAddr
+}
+
+func (s *LinuxSLL2) LayerType() gopacket.LayerType { return LayerTypeLinuxSLL2 }
+
+// LinkFlow is keyed on the one address the header carries, as for v1.
+func (s *LinuxSLL2) LinkFlow() gopacket.Flow {
+	return gopacket.NewFlow(layers.EndpointMAC, s.Addr, nil)
+}
+
+func decodeLinuxSLL2(data []byte, p gopacket.PacketBuilder) error {
+	if len(data) < 20 {
+		return errors.New("Linux SLL2 packet too small")
+	}
+	s := &LinuxSLL2{
+		EthernetType:   layers.EthernetType(binary.BigEndian.Uint16(data[0:2])),
+		InterfaceIndex: binary.BigEndian.Uint32(data[4:8]),
+		AddrType:       binary.BigEndian.Uint16(data[8:10]),
+		PacketType:     layers.LinuxSLLPacketType(data[10]),
+	}
+	s.Addr = net.HardwareAddr(data[12 : 12+min(int(data[11]), 8)])
+	s.BaseLayer = layers.BaseLayer{Contents: data[:20], Payload: data[20:]}
+	p.AddLayer(s)
+	p.SetLinkLayer(s)
+	return p.NextDecoder(s.EthernetType)
+}
+
+func parseLinuxSLL(sll *layers.LinuxSLL) models.LayerDetail {
+	return models.LayerDetail{
+		Name: "Linux cooked capture",
+		Fields: []models.LayerField{
+			{Name: "Packet Type", Value: sll.PacketType.String(), Offset: 0, Length: 2},
+			{Name: "Link-layer Address Type", Value: fmt.Sprintf("%d", sll.AddrType), Offset: 2, Length: 2},
+			{Name: "Source", Value: sll.Addr.String(), Offset: 6, Length: len(sll.Addr)},
+			{Name: "Protocol", Value: sll.EthernetType.String(), Offset: 14, Length: 2},
+		},
+	}
+}
+
+func parseLinuxSLL2(sll *LinuxSLL2) models.LayerDetail {
+	return models.LayerDetail{
+		Name: "Linux cooked capture v2",
+		Fields: []models.LayerField{
+			{Name: "Protocol", Value: sll.EthernetType.String(), Offset: 0, Length: 2},
+			{Name: "Interface Index", Value: fmt.Sprintf("%d", sll.InterfaceIndex), Offset: 4, Length: 4},
+			{Name: "Link-layer Address Type", Value: fmt.Sprintf("%d", sll.AddrType), Offset: 8, Length: 2},
+			{Name: "Packet Type", Value: sll.PacketType.String(), Offset: 10, Length: 1},
+			{Name: "Source", Value: sll.Addr.String(), Offset: 12, Length: len(sll.Addr)},
+		},
+	}
+}
+
+func parseLoopback(l *layers.Loopback) models.LayerDetail {
+	return models.LayerDetail{
+		Name: "Null/Loopback",
+		Fields: []models.LayerField{
+			{Name: "Family", Value: fmt.Sprintf("%s (%d)", l.Family, uint32(l.Family)), Offset: 0, Length: 4},
+		},
+	}
+}
+
+func parsePPP(ppp *layers.PPP) models.LayerDetail {
+	// Contents is the protocol alone, one byte when compressed, else two;
+	// the address and control bytes precede it
+	fields := []models.LayerField{
+		{Name: "Protocol", Value: fmt.Sprintf("%s (0x%04x)", ppp.PPPType, uint16(ppp.PPPType)), Length: len(ppp.Contents)},
+	}
+	if ppp.HasPPTPHeader {
+		fields = append([]models.LayerField{
+			{Name: "Address", Value: "0xff", Offset: -2, Length: 1},
+			{Name: "Control", Value: "0x03", Offset: -1, Length: 1},
+		}, fields...)
+	}
+	return models.LayerDetail{Name: "PPP", Fields: fields}
+}
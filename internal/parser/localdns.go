@@ -0,0 +1,390 @@
+package parser
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+// Link-local name resolution. Multicast DNS (RFC 6762) and LLMNR (RFC
+// 4795) use the DNS wire format on their own ports, which gopacket leaves
+// undecoded; NetBIOS Name Service is decoded in nbns.go. mDNS also carries
+// DNS-SD (RFC 6763) service announcements.
+
+const (
+	portMDNS  = 5353
+	portLLMNR = 5355
+)
+
+// mDNS reuses the top bit of the class: "unicast response requested" in
+// questions and "cache flush" in records.
+const mdnsClassFlag = 0x8000
+
+// DNSSDService is a service instance announced over DNS-SD.
+type DNSSDService struct {
+	Instance string   `json:"instance"` // e.g. "Office Printer._ipp._tcp.local"
+	Type     string   `json:"type"`     // e.g. "_ipp._tcp.local"
+	Host     string   `json:"host,omitempty"`
+	Port     uint16   `json:"port,omitempty"`
+	TXT      []string `json:"txt,omitempty"` // key=value attributes
+
+	// The records each part came from
+	at, typeAt, targetAt, txtAt span
+}
+
+// NameResolution is a hostname a packet binds to an address.
+type NameResolution struct {
+	IP       string
+	Name     string
+	Protocol string // DNS, DHCP, mDNS, LLMNR or NBNS
+}
+
+// localDNS returns the mDNS or LLMNR message in the packet and which of
+// the two it is. A decode-as rule can put either on another UDP port.
+func localDNS(pkt gopacket.Packet) (*layers.DNS, string) {
+	udpLayer := pkt.Layer(layers.LayerTypeUDP)
+	if udpLayer == nil {
+		return nil, ""
+	}
+	var proto string
+	switch forced := decodeAsFor(pkt); {
+	case forced == "mDNS" || forced == "LLMNR":
+		proto = forced
+	case forced != "":
+		return nil, ""
+	case portIs(pkt, portMDNS):
+		proto = "mDNS"
+	case portIs(pkt, portLLMNR):
+		proto = "LLMNR"
+	default:
+		return nil, ""
+	}
+	if dnsLayer := pkt.Layer(layers.LayerTypeDNS); dnsLayer != nil {
+		return dnsLayer.(*layers.DNS), proto
+	}
+	if dns := DecodeDNSMessage(udpLayer.(*layers.UDP).Payload); dns != nil {
+		return dns, proto
+	}
+	return nil, ""
+}
+
+// MDNSMessage returns the mDNS message in the packet, or nil.
+func MDNSMessage(pkt gopacket.Packet) *layers.DNS {
+	if dns, proto := localDNS(pkt); proto == "mDNS" {
+		return dns
+	}
+	return nil
+}
+
+// localDNSSummary is the info column text of an mDNS or LLMNR message.
+// Responses often carry no question, so their answers are listed instead.
+func localDNSSummary(dns *layers.DNS) string {
+	if !dns.QR {
+		s := "Query"
+		for _, q := range dns.Questions {
+			s += " " + string(q.Name) + " " + q.Type.String()
+			if uint16(q.Class)&mdnsClassFlag != 0 {
+				s += " (QU)"
+			}
+		}
+		return s
+	}
+	s := "Response"
+	if dns.ResponseCode != layers.DNSResponseCodeNoErr {
+		s += " " + dnsRcodeString(dns.ResponseCode)
+	}
+	const maxListed = 3
+	for i, a := range dns.Answers {
+		if i == maxListed {
+			s += fmt.Sprintf(" (+%d more)", len(dns.Answers)-maxListed)
+			break
+		}
+		if i > 0 {
+			s += ","
+		}
+		s += " " + string(a.Name) + " " + a.Type.String()
+		if v := dnsRecordValue(a); v != "" {
+			s += " " + v
+		}
+	}
+	return s
+}
+
+// dnsRecordValue is the short form of a record's data, or "" for types
+// without one.
+func dnsRecordValue(a layers.DNSResourceRecord) string {
+	switch a.Type {
+	case layers.DNSTypeA, layers.DNSTypeAAAA:
+		if a.IP != nil {
+			return a.IP.String()
+		}
+	case layers.DNSTypePTR:
+		return string(a.PTR)
+	case layers.DNSTypeCNAME:
+		return string(a.CNAME)
+	case layers.DNSTypeSRV:
+		return fmt.Sprintf("%s:%d", a.SRV.Name, a.SRV.Port)
+	}
+	return ""
+}
+
+// withoutMDNSFlags returns a copy of dns with the class flag bits cleared,
+// so the classes print as IN, and how many questions and records had them.
+func withoutMDNSFlags(dns *layers.DNS) (clean layers.DNS, unicast, flush int) {
+	clean = *dns
+	clean.Questions = append([]layers.DNSQuestion(nil), dns.Questions...)
+	for i := range clean.Questions {
+		if uint16(clean.Questions[i].Class)&mdnsClassFlag != 0 {
+			clean.Questions[i].Class &^= mdnsClassFlag
+			unicast++
+		}
+	}
+	for _, rrs := range []*[]layers.DNSResourceRecord{&clean.Answers, &clean.Authorities, &clean.Additionals} {
+		*rrs = append([]layers.DNSResourceRecord(nil), (*rrs)...)
+		for i := range *rrs {
+			if uint16((*rrs)[i].Class)&mdnsClassFlag != 0 {
+				(*rrs)[i].Class &^= mdnsClassFlag
+				flush++
+			}
+		}
+	}
+	return clean, unicast, flush
+}
+
+// DNSSDServices collects the service instances a DNS message describes
+// from its PTR, SRV and TXT records, in any section.
+func DNSSDServices(dns *layers.DNS) []DNSSDService {
+	var order []string
+	byInstance := map[string]*DNSSDService{}
+	_, records := dnsSpans(dns.Contents)
+	var at span // of the record being read
+	get := func(instance string) *DNSSDService {
+		key := strings.ToLower(instance)
+		s, ok := byInstance[key]
+		if !ok {
+			s = &DNSSDService{Instance: instance, Type: serviceType(instance), at: at}
+			byInstance[key] = s
+			order = append(order, key)
+		}
+		return s
+	}
+
+	k := 0
+	for _, rrs := range [][]layers.DNSResourceRecord{dns.Answers, dns.Authorities, dns.Additionals} {
+		for _, a := range rrs {
+			at = span{}
+			if k < len(records) {
+				at = records[k]
+			}
+			k++
+			name := string(a.Name)
+			switch a.Type {
+			case layers.DNSTypePTR:
+				// "_services._dns-sd._udp" enumerates types, and the
+				// reverse zones map addresses; neither names an instance
+				if !isServiceType(name) || strings.HasPrefix(strings.ToLower(name), "_services._dns-sd.") {
+					continue
+				}
+				s := get(string(a.PTR))
+				s.Type, s.typeAt = name, at
+			case layers.DNSTypeSRV:
+				if serviceType(name) == "" {
+					continue
+				}
+				s := get(name)
+				s.Host, s.Port, s.targetAt = string(a.SRV.Name), a.SRV.Port, at
+			case layers.DNSTypeTXT:
+				if serviceType(name) == "" {
+					continue
+				}
+				s := get(name)
+				s.TXT, s.txtAt = s.TXT[:0], at
+				for _, t := range a.TXTs {
+					if len(t) > 0 {
+						s.TXT = append(s.TXT, string(t))
+					}
+				}
+			}
+		}
+	}
+
+	out := make([]DNSSDService, 0, len(order))
+	for _, key := range order {
+		out = append(out, *byInstance[key])
+	}
+	return out
+}
+
+// isServiceType reports whether name is a DNS-SD service type such as
+// "_http._tcp.local".
+func isServiceType(name string) bool {
+	labels := strings.Split(strings.ToLower(name), ".")
+	return len(labels) >= 3 && strings.HasPrefix(labels[0], "_") && (labels[1] == "_tcp" || labels[1] == "_udp")
+}
+
+// serviceType returns the service type an instance name belongs to, e.g.
+// "_ipp._tcp.local" for "Office Printer._ipp._tcp.local", or "". The
+// instance label may itself contain dots, so the type is found from the
+// right.
+func serviceType(instance string) string {
+	lower := strings.ToLower(instance)
+	for _, proto := range []string{"._tcp.", "._udp."} {
+		i := strings.LastIndex(lower, proto)
+		if i < 0 {
+			continue
+		}
+		start := strings.LastIndex(lower[:i], "._")
+		if start < 0 {
+			return ""
+		}
+		return instance[start+1:]
+	}
+	return ""
+}
+
+func buildLocalDNSLayerDetail(dns *layers.DNS, proto string) models.LayerDetail {
+	clean, unicast, flush := withoutMDNSFlags(dns)
+	detail := parseDNS(&clean)
+	detail.Name = proto
+	if proto != "mDNS" {
+		return detail
+	}
+	// The flags are counted over the sections they are found in
+	questions, records := dnsSpans(dns.Contents)
+	if unicast > 0 {
+		detail.Fields = append(detail.Fields, spanning(questions).field("Unicast Response Requested", fmt.Sprintf("%d questions", unicast)))
+	}
+	if flush > 0 {
+		detail.Fields = append(detail.Fields, spanning(records).field("Cache Flush", fmt.Sprintf("%d records", flush)))
+	}
+	for _, s := range DNSSDServices(dns) {
+		f := s.at.field("Service", s.Instance)
+		f.Children = append(f.Children, s.typeAt.field("Type", s.Type))
+		if s.Host != "" {
+			f.Children = append(f.Children, s.targetAt.field("Target", fmt.Sprintf("%s:%d", s.Host, s.Port)))
+		}
+		for _, t := range s.TXT {
+			f.Children = append(f.Children, s.txtAt.field("TXT", t))
+		}
+		detail.Fields = append(detail.Fields, f)
+	}
+	return detail
+}
+
+// NameResolutions returns the hostname-to-address bindings a packet
+// announces: DNS, mDNS and LLMNR address records and reverse-lookup
+// answers, the host name a DHCP client gives for its address, and NetBIOS
+// names from NBNS responses, registrations and node status.
+func NameResolutions(pkt gopacket.Packet) []NameResolution {
+	dns, proto := localDNS(pkt)
+	if dns == nil {
+		if dnsLayer := pkt.Layer(layers.LayerTypeDNS); dnsLayer != nil {
+			dns, proto = dnsLayer.(*layers.DNS), "DNS"
+		}
+	}
+	if dns != nil {
+		if !dns.QR {
+			return nil
+		}
+		var out []NameResolution
+		for _, rrs := range [][]layers.DNSResourceRecord{dns.Answers, dns.Additionals} {
+			for _, a := range rrs {
+				name := strings.TrimSuffix(string(a.Name), ".")
+				switch a.Type {
+				case layers.DNSTypeA, layers.DNSTypeAAAA:
+					if a.IP != nil && !a.IP.IsUnspecified() {
+						out = append(out, NameResolution{IP: a.IP.String(), Name: name, Protocol: proto})
+					}
+				case layers.DNSTypePTR:
+					if ip := reverseLookupIP(name); ip != nil {
+						out = append(out, NameResolution{IP: ip.String(), Name: strings.TrimSuffix(string(a.PTR), "."), Protocol: proto})
+					}
+				}
+			}
+		}
+		return out
+	}
+	if dhcpLayer := pkt.Layer(layers.LayerTypeDHCPv4); dhcpLayer != nil {
+		if r, ok := dhcpHostname(dhcpLayer.(*layers.DHCPv4)); ok {
+			return []NameResolution{r}
+		}
+		return nil
+	}
+	if m := findNBNS(pkt); m != nil {
+		return m.resolutions(pkt)
+	}
+	return nil
+}
+
+// dhcpHostname returns the host name option of a DHCP message with the
+// address it goes with: the one offered or acknowledged by a server, or
+// the one a client already holds or is requesting.
+func dhcpHostname(dhcp *layers.DHCPv4) (NameResolution, bool) {
+	var name string
+	var requested net.IP
+	for _, opt := range dhcp.Options {
+		switch opt.Type {
+		case layers.DHCPOptHostname:
+			name = strings.TrimRight(string(opt.Data), "\x00")
+		case layers.DHCPOptRequestIP:
+			if len(opt.Data) == 4 {
+				requested = net.IP(opt.Data)
+			}
+		}
+	}
+	if name == "" {
+		return NameResolution{}, false
+	}
+	var ip net.IP
+	switch {
+	case dhcp.Operation == layers.DHCPOpReply && !dhcp.YourClientIP.IsUnspecified():
+		ip = dhcp.YourClientIP
+	case !dhcp.ClientIP.IsUnspecified():
+		ip = dhcp.ClientIP
+	default:
+		ip = requested
+	}
+	if ip == nil || ip.IsUnspecified() {
+		return NameResolution{}, false
+	}
+	return NameResolution{IP: ip.String(), Name: name, Protocol: "DHCP"}, true
+}
+
+// reverseLookupIP parses an in-addr.arpa or ip6.arpa name back into the
+// address it is for, or returns nil.
+func reverseLookupIP(name string) net.IP {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".in-addr.arpa"):
+		labels := strings.Split(strings.TrimSuffix(lower, ".in-addr.arpa"), ".")
+		if len(labels) != 4 {
+			return nil
+		}
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		return net.ParseIP(strings.Join(labels, ".")).To4()
+	case strings.HasSuffix(lower, ".ip6.arpa"):
+		nibbles := strings.Split(strings.TrimSuffix(lower, ".ip6.arpa"), ".")
+		if len(nibbles) != 32 {
+			return nil
+		}
+		var sb strings.Builder
+		for i := len(nibbles) - 1; i >= 0; i-- {
+			if len(nibbles[i]) != 1 {
+				return nil
+			}
+			sb.WriteString(nibbles[i])
+			if i%4 == 0 && i > 0 {
+				sb.WriteByte(':')
+			}
+		}
+		return net.ParseIP(sb.String())
+	}
+	return nil
+}
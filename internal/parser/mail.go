@@ -0,0 +1,468 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+// Well-known ports of the cleartext mail protocols. Submission (587)
+// speaks SMTP; 465, 993 and 995 are TLS from the first byte and are left
+// to the TLS dissector.
+var mailPorts = map[uint16]string{
+	25:  "SMTP",
+	587: "SMTP",
+	110: "POP3",
+	143: "IMAP",
+}
+
+// MailProtocol returns the mail protocol a TCP server port carries, by a
+// decode-as rule or its well-known port, or "".
+func MailProtocol(port uint16) string {
+	switch p := DecodeAsPort("TCP", port); p {
+	case "SMTP", "POP3", "IMAP":
+		return p
+	case "":
+		return mailPorts[port]
+	}
+	return ""
+}
+
+// mailProtocolFor returns the mail protocol pkt's TCP ports carry, the
+// destination port first.
+func mailProtocolFor(pkt gopacket.Packet) string {
+	l := pkt.Layer(layers.LayerTypeTCP)
+	if l == nil {
+		return ""
+	}
+	tcp := l.(*layers.TCP)
+	if p := MailProtocol(uint16(tcp.DstPort)); p != "" {
+		return p
+	}
+	return MailProtocol(uint16(tcp.SrcPort))
+}
+
+var (
+	smtpCommands = map[string]bool{
+		"HELO": true, "EHLO": true, "MAIL": true, "RCPT": true, "DATA": true,
+		"BDAT": true, "RSET": true, "VRFY": true, "EXPN": true, "HELP": true,
+		"NOOP": true, "QUIT": true, "AUTH": true, "STARTTLS": true, "ETRN": true,
+		"XCLIENT": true, "XFORWARD": true,
+	}
+	pop3Commands = map[string]bool{
+		"USER": true, "PASS": true, "APOP": true, "STAT": true, "LIST": true,
+		"RETR": true, "DELE": true, "NOOP": true, "RSET": true, "QUIT": true,
+		"TOP": true, "UIDL": true, "CAPA": true, "STLS": true, "AUTH": true,
+		"UTF8": true,
+	}
+	imapCommands = map[string]bool{
+		"CAPABILITY": true, "NOOP": true, "LOGOUT": true, "STARTTLS": true,
+		"AUTHENTICATE": true, "LOGIN": true, "SELECT": true, "EXAMINE": true,
+		"CREATE": true, "DELETE": true, "RENAME": true, "SUBSCRIBE": true,
+		"UNSUBSCRIBE": true, "LIST": true, "LSUB": true, "STATUS": true,
+		"APPEND": true, "CHECK": true, "CLOSE": true, "EXPUNGE": true,
+		"SEARCH": true, "FETCH": true, "STORE": true, "COPY": true, "MOVE": true,
+		"UID": true, "IDLE": true, "ENABLE": true, "NAMESPACE": true, "ID": true,
+		"UNSELECT": true, "GETQUOTAROOT": true, "COMPRESS": true,
+	}
+)
+
+// MailMessage is a command sent by a mail client or a server's reply,
+// in SMTP, POP3 or IMAP.
+type MailMessage struct {
+	Response bool
+	Tag      string // IMAP only: the command tag, "*" untagged, "+" continuation
+	Command  string // upper case; requests only
+	Arg      string
+	// Status is the reply code: "250" in SMTP, "+OK", "-ERR" or "+" in
+	// POP3, "OK", "NO", "BAD", "PREAUTH" or "BYE" in IMAP; "" for an
+	// untagged IMAP reply that carries data
+	Status string
+	Text   string
+	Lines  []string // the rest of a multi-line reply
+}
+
+// MailCommand parses line as a client command of proto.
+func MailCommand(proto, line string) (MailMessage, bool) {
+	var m MailMessage
+	if proto == "IMAP" {
+		tag, rest, _ := strings.Cut(line, " ")
+		if strings.EqualFold(tag, "DONE") && rest == "" {
+			// Ends an IDLE; it has no tag
+			return MailMessage{Command: "DONE"}, true
+		}
+		if !isIMAPTag(tag) {
+			return m, false
+		}
+		m.Tag, line = tag, rest
+	}
+	cmd, arg, _ := strings.Cut(line, " ")
+	cmd = strings.ToUpper(cmd)
+	switch proto {
+	case "SMTP":
+		if !smtpCommands[cmd] {
+			return m, false
+		}
+	case "POP3":
+		if !pop3Commands[cmd] {
+			return m, false
+		}
+	case "IMAP":
+		if !imapCommands[cmd] {
+			return m, false
+		}
+	default:
+		return m, false
+	}
+	m.Command, m.Arg = cmd, strings.TrimSpace(arg)
+	return m, true
+}
+
+// MailReply parses line as the first line of a server reply in proto.
+// more reports an SMTP reply that continues on the next line.
+func MailReply(proto, line string) (m MailMessage, more, ok bool) {
+	m.Response = true
+	switch proto {
+	case "SMTP":
+		if len(line) < 3 || (len(line) > 3 && line[3] != ' ' && line[3] != '-') {
+			return m, false, false
+		}
+		code, err := strconv.Atoi(line[:3])
+		if err != nil || code < 200 || code > 599 {
+			return m, false, false
+		}
+		m.Status = line[:3]
+		if len(line) > 3 {
+			m.Text = strings.TrimSpace(line[4:])
+			more = line[3] == '-'
+		}
+		return m, more, true
+	case "POP3":
+		for _, s := range []string{"+OK", "-ERR", "+"} {
+			if line == s || strings.HasPrefix(line, s+" ") {
+				m.Status, m.Text = s, strings.TrimSpace(line[len(s):])
+				return m, false, true
+			}
+		}
+	case "IMAP":
+		tag, rest, _ := strings.Cut(line, " ")
+		if tag != "*" && tag != "+" && !isIMAPTag(tag) {
+			return m, false, false
+		}
+		m.Tag = tag
+		if tag == "+" {
+			m.Text = rest
+			return m, false, true
+		}
+		word, text, _ := strings.Cut(rest, " ")
+		switch status := strings.ToUpper(word); status {
+		case "OK", "NO", "BAD", "PREAUTH", "BYE":
+			m.Status, m.Text = status, text
+			return m, false, true
+		}
+		if tag != "*" {
+			return m, false, false
+		}
+		m.Text = rest
+		return m, false, true
+	}
+	return m, false, false
+}
+
+// isIMAPTag reports whether s can be an IMAP command tag: printable ASCII
+// without the characters RFC 3501 reserves.
+func isIMAPTag(s string) bool {
+	if s == "" || len(s) > 32 {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`(){%*"\]+`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IMAPLiteral returns n when line ends with an IMAP literal "{n}" or
+// "{n+}", which is followed by n bytes of data.
+func IMAPLiteral(line string) (int, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	i := strings.LastIndexByte(line, '{')
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(line[i+1:len(line)-1], "+"))
+	return n, err == nil && n >= 0
+}
+
+// StartsTLS reports whether m is a request to upgrade the connection to
+// TLS: STARTTLS, or STLS in POP3.
+func (m MailMessage) StartsTLS() bool {
+	return !m.Response && (m.Command == "STARTTLS" || m.Command == "STLS")
+}
+
+// Accepted reports whether the reply m is positive.
+func (m MailMessage) Accepted() bool {
+	switch {
+	case m.Status == "+OK" || m.Status == "OK" || m.Status == "PREAUTH":
+		return true
+	case len(m.Status) == 3:
+		return m.Status[0] == '2' || m.Status[0] == '3'
+	}
+	return false
+}
+
+// Address returns the mailbox of a MAIL FROM or RCPT TO command, without
+// its angle brackets.
+func (m MailMessage) Address() string {
+	if m.Command != "MAIL" && m.Command != "RCPT" {
+		return ""
+	}
+	_, addr, ok := strings.Cut(m.Arg, ":")
+	if !ok {
+		return ""
+	}
+	addr = strings.TrimSpace(addr)
+	if strings.HasPrefix(addr, "<") {
+		if end := strings.IndexByte(addr, '>'); end > 0 {
+			return addr[1:end]
+		}
+	}
+	addr, _, _ = strings.Cut(addr, " ")
+	return addr
+}
+
+// AuthMechanism returns the SASL mechanism an AUTH or AUTHENTICATE
+// command names, or "LOGIN" for an IMAP LOGIN.
+func (m MailMessage) AuthMechanism() string {
+	switch m.Command {
+	case "AUTH", "AUTHENTICATE":
+		mech, _, _ := strings.Cut(m.Arg, " ")
+		return strings.ToUpper(mech)
+	case "LOGIN":
+		return "LOGIN"
+	}
+	return ""
+}
+
+// String formats m for the Info column: "C: MAIL FROM:<a@example.com>",
+// "S: 250 OK" or "C: a1 SELECT INBOX".
+func (m MailMessage) String() string {
+	var parts []string
+	if m.Response {
+		parts = append(parts, "S:")
+	} else {
+		parts = append(parts, "C:")
+	}
+	for _, s := range []string{m.Tag, m.Status, m.Command, m.Arg, m.Text} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if (m.Command == "PASS" || m.Command == "LOGIN") && m.Arg != "" {
+		// Keep passwords out of the packet list
+		parts = parts[:len(parts)-1]
+		if m.Command == "LOGIN" {
+			user, _, _ := strings.Cut(m.Arg, " ")
+			parts = append(parts, user)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseMailMessages splits a segment of a mail connection into commands
+// and replies. Continuation lines of a multi-line reply, the data lines of
+// a POP3 reply and IMAP literals are attached to the reply they follow.
+// It stops at the first line that is neither, such as message content.
+func parseMailMessages(proto string, data []byte) []MailMessage {
+	var out []MailMessage
+	text := string(data)
+	inData := false // in the data lines of a POP3 reply
+	for text != "" {
+		line, rest, _ := strings.Cut(text, "\n")
+		line = strings.TrimRight(line, "\r")
+		text = rest
+
+		if inData {
+			if line == "." {
+				inData = false
+			} else {
+				last := &out[len(out)-1]
+				last.Lines = append(last.Lines, line)
+			}
+			continue
+		}
+		if m, more, ok := MailReply(proto, line); ok {
+			for more && text != "" {
+				line, rest, _ = strings.Cut(text, "\n")
+				line = strings.TrimRight(line, "\r")
+				next, cont, ok := MailReply(proto, line)
+				if !ok || next.Status != m.Status {
+					break
+				}
+				m.Lines = append(m.Lines, next.Text)
+				text, more = rest, cont
+			}
+			out = append(out, m)
+			// A POP3 reply with data lines following it in the segment
+			inData = proto == "POP3" && m.Status == "+OK" && text != ""
+		} else if m, ok := MailCommand(proto, line); ok {
+			out = append(out, m)
+		} else {
+			break
+		}
+		if n, ok := IMAPLiteral(line); ok && proto == "IMAP" {
+			// Skip the literal and the rest of the line it is part of
+			text = text[min(n, len(text)):]
+			_, text, _ = strings.Cut(text, "\n")
+		}
+	}
+	return out
+}
+
+// tlsRecordType returns the content type of the TLS record data starts
+// with, or "".
+func tlsRecordType(data []byte) string {
+	if len(data) < 5 || data[1] != 3 || data[2] > 4 {
+		return ""
+	}
+	switch data[0] {
+	case 20:
+		return "ChangeCipherSpec"
+	case 21:
+		return "Alert"
+	case 22:
+		return "Handshake"
+	case 23:
+		return "Application Data"
+	}
+	return ""
+}
+
+// isMailText reports whether data looks like lines of text: message
+// content rather than the TLS that follows STARTTLS.
+func isMailText(data []byte) bool {
+	if len(data) > 64 {
+		data = data[:64]
+	}
+	for _, c := range data {
+		if (c < ' ' && c != '\t' && c != '\r' && c != '\n') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func mailSummary(msgs []MailMessage) string {
+	s := msgs[0].String()
+	if len(msgs) > 1 {
+		s += fmt.Sprintf(" (+%d more)", len(msgs)-1)
+	}
+	return s
+}
+
+func buildMailLayerDetail(proto string, msgs []MailMessage) models.LayerDetail {
+	var fields []models.LayerField
+	for _, m := range msgs {
+		if m.Response {
+			if m.Tag != "" {
+				fields = append(fields, models.LayerField{Name: "Response Tag", Value: m.Tag})
+			}
+			if m.Status != "" {
+				fields = append(fields, models.LayerField{Name: "Response Code", Value: m.Status})
+			}
+			fields = append(fields, models.LayerField{Name: "Response Arg", Value: m.Text})
+			for _, l := range m.Lines {
+				fields = append(fields, models.LayerField{Name: "Response Line", Value: l})
+			}
+			continue
+		}
+		if m.Tag != "" {
+			fields = append(fields, models.LayerField{Name: "Request Tag", Value: m.Tag})
+		}
+		fields = append(fields, models.LayerField{Name: "Request Command", Value: m.Command})
+		switch {
+		case m.Address() != "" && m.Command == "MAIL":
+			fields = append(fields, models.LayerField{Name: "Mail From", Value: m.Address()})
+		case m.Address() != "":
+			fields = append(fields, models.LayerField{Name: "Recipient", Value: m.Address()})
+		case m.Command == "HELO" || m.Command == "EHLO":
+			fields = append(fields, models.LayerField{Name: "Client Name", Value: m.Arg})
+		case m.Command == "USER":
+			fields = append(fields, models.LayerField{Name: "User", Value: m.Arg})
+		case m.Command == "PASS":
+			fields = append(fields, models.LayerField{Name: "Password", Value: m.Arg})
+		case m.Command == "LOGIN":
+			user, pass, _ := strings.Cut(m.Arg, " ")
+			fields = append(fields,
+				models.LayerField{Name: "User", Value: strings.Trim(user, `"`)},
+				models.LayerField{Name: "Password", Value: strings.Trim(pass, `"`)})
+		case m.AuthMechanism() != "":
+			fields = append(fields, models.LayerField{Name: "Auth Mechanism", Value: m.AuthMechanism()})
+		case m.StartsTLS():
+			fields = append(fields, models.LayerField{Name: "STARTTLS", Value: "Client asks to upgrade the connection to TLS"})
+		case m.Arg != "":
+			fields = append(fields, models.LayerField{Name: "Request Arg", Value: m.Arg})
+		}
+	}
+	return models.LayerDetail{Name: proto, Fields: fields}
+}
+
+// detectMail dissects a segment of an SMTP, POP3 or IMAP connection: its
+// commands and replies, a fragment of message content, or a TLS record
+// sent after STARTTLS.
+func detectMail(data []byte, pkt gopacket.Packet) (models.LayerDetail, bool) {
+	proto := mailProtocolFor(pkt)
+	if proto == "" {
+		return models.LayerDetail{}, false
+	}
+	if msgs := parseMailMessages(proto, data); len(msgs) > 0 {
+		return buildMailLayerDetail(proto, msgs), true
+	}
+	if ct := tlsRecordType(data); ct != "" {
+		detail := buildTLSLayerDetail(ct, tlsVersionString(uint16(data[1])<<8|uint16(data[2])), data)
+		detail.Fields = append([]models.LayerField{{Name: "STARTTLS", Value: proto + " connection upgraded to TLS"}}, detail.Fields...)
+		return detail, true
+	}
+	if isMailText(data) {
+		return models.LayerDetail{Name: proto, Fields: []models.LayerField{
+			{Name: "Data Fragment", Value: fmt.Sprintf("%d bytes", len(data))},
+		}}, true
+	}
+	return models.LayerDetail{}, false
+}
+
+// mailProtocolSummary is the protocol and Info of a segment detectMail
+// dissects.
+func mailProtocolSummary(data []byte, pkt gopacket.Packet) (string, string) {
+	proto := mailProtocolFor(pkt)
+	if proto == "" {
+		return "", ""
+	}
+	if msgs := parseMailMessages(proto, data); len(msgs) > 0 {
+		return proto, mailSummary(msgs)
+	}
+	if ct := tlsRecordType(data); ct != "" {
+		s := ct
+		if hello := parseTLSClientHello(data); hello != nil {
+			s = "Client Hello"
+			if hello.SNI != "" {
+				s += " (SNI=" + hello.SNI + ")"
+			}
+		} else if parseTLSServerHello(data) != nil {
+			s = "Server Hello"
+		}
+		return "TLS", s + " after " + proto + " STARTTLS"
+	}
+	if isMailText(data) {
+		return proto, fmt.Sprintf("Data fragment, %d bytes", len(data))
+	}
+	return "", ""
+}
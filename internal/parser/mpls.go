@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+	"sniffox/internal/tunnel"
+)
+
+// gopacket decodes each entry of an MPLS label stack as its own layer and
+// guesses IPv4 or IPv6 after the bottom of the stack.
+
+func parseMPLS(m *layers.MPLS) models.LayerDetail {
+	return models.LayerDetail{
+		Name: "MPLS",
+		Fields: []models.LayerField{
+			{Name: "Label", Value: fmt.Sprintf("%d", m.Label), Offset: 0, Length: 3},
+			{Name: "Traffic Class", Value: fmt.Sprintf("%d", m.TrafficClass), Offset: 2, Length: 1},
+			{Name: "Bottom of Stack", Value: boolToStr(m.StackBottom, "Yes", "No"), Offset: 2, Length: 1},
+			{Name: "TTL", Value: fmt.Sprintf("%d", m.TTL), Offset: 3, Length: 1},
+		},
+	}
+}
+
+// mplsLabels returns the labels of pkt's MPLS stack, outermost first.
+func mplsLabels(pkt gopacket.Packet) []uint32 {
+	var labels []uint32
+	for _, l := range pkt.Layers() {
+		if m, ok := l.(*layers.MPLS); ok {
+			labels = append(labels, m.Label)
+		}
+	}
+	return labels
+}
+
+// FlowScope describes the VXLAN or GENEVE networks and VLAN tags pkt came
+// in, such as "VXLAN 100 VLAN 10/20", or "" for an untagged packet. It
+// keeps the same 5-tuple in different VLANs or overlays apart, so it only
+// holds what both directions of a flow share.
+func FlowScope(pkt gopacket.Packet) string {
+	var parts []string
+	for _, t := range tunnel.From(pkt) {
+		if t.Kind == tunnel.VXLAN || t.Kind == tunnel.GENEVE {
+			parts = append(parts, fmt.Sprintf("%s %d", t.Kind, t.ID))
+		}
+	}
+	if ids := vlanIDs(pkt); len(ids) > 0 {
+		parts = append(parts, "VLAN "+joinNumbers(ids))
+	}
+	return strings.Join(parts, " ")
+}
+
+// FlowPath describes the ERSPAN sessions, GTP-U tunnels and MPLS labels
+// pkt came in, such as "GTP-U 0x0000abcd MPLS 16/17". Unlike FlowScope
+// they are chosen per direction: labels are local to each LSP and each
+// GTP-U endpoint picks the TEID it receives on.
+func FlowPath(pkt gopacket.Packet) string {
+	var parts []string
+	for _, t := range tunnel.From(pkt) {
+		switch t.Kind {
+		case tunnel.GTPU:
+			parts = append(parts, fmt.Sprintf("%s 0x%08x", t.Kind, t.ID))
+		case tunnel.ERSPAN:
+			parts = append(parts, fmt.Sprintf("%s %d", t.Kind, t.ID))
+		}
+	}
+	if labels := mplsLabels(pkt); len(labels) > 0 {
+		parts = append(parts, "MPLS "+joinNumbers(labels))
+	}
+	return strings.Join(parts, " ")
+}
+
+func joinNumbers[T uint16 | uint32](ns []T) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = fmt.Sprintf("%d", n)
+	}
+	return strings.Join(s, "/")
+}
@@ -0,0 +1,390 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+// NetBIOS Name Service (RFC 1002) on UDP 137: name queries, registrations,
+// releases and node status requests. Names are 15 characters plus a suffix
+// byte naming the service, first-level encoded into 32 letters.
+
+const portNBNS = 137
+
+const (
+	nbnsTypeNB     = 0x0020
+	nbnsTypeNBSTAT = 0x0021
+)
+
+var nbnsOpcodes = map[uint8]string{
+	0:  "Name query",
+	5:  "Registration",
+	6:  "Release",
+	7:  "WACK",
+	8:  "Refresh",
+	9:  "Refresh",
+	15: "Multi-homed registration",
+}
+
+var nbnsRcodes = map[uint8]string{
+	1: "Format error",
+	2: "Server failure",
+	3: "Name error",
+	4: "Unsupported request",
+	5: "Refused",
+	6: "Active error",
+	7: "Name in conflict",
+}
+
+// NBNSName is a NetBIOS name and its suffix, e.g. WORKSTATION<20>.
+type NBNSName struct {
+	Name   string
+	Suffix byte
+	Group  bool // group name, e.g. a workgroup; only known from records
+}
+
+func (n NBNSName) String() string {
+	return fmt.Sprintf("%s<%02x>", n.Name, n.Suffix)
+}
+
+// NBNSRecord is a resource record: the addresses of an NB record, or the
+// name table and MAC address of a node status (NBSTAT) response.
+type NBNSRecord struct {
+	Name      NBNSName
+	Type      uint16
+	TTL       uint32
+	Addresses []net.IP
+	Group     bool       // NB addresses belong to a group name
+	Names     []NBNSName // NBSTAT
+	MAC       net.HardwareAddr
+
+	at      span // the whole record
+	addrAt  []span
+	namesAt []span
+	macAt   span
+}
+
+// NBNSMessage is a decoded NetBIOS Name Service packet.
+type NBNSMessage struct {
+	ID          uint16
+	Response    bool
+	Opcode      uint8
+	Broadcast   bool
+	Rcode       uint8
+	Questions   []NBNSQuestion
+	Answers     []NBNSRecord
+	Additionals []NBNSRecord // registrations carry the claimed name here
+}
+
+// NBNSQuestion is a query for a name, by address (NB) or for the node's
+// name table (NBSTAT).
+type NBNSQuestion struct {
+	Name NBNSName
+	Type uint16
+	at   span
+}
+
+func nbnsTypeString(t uint16) string {
+	switch t {
+	case nbnsTypeNB:
+		return "NB"
+	case nbnsTypeNBSTAT:
+		return "NBSTAT"
+	}
+	return fmt.Sprintf("Type %d", t)
+}
+
+// OpName returns the operation, e.g. "Name query".
+func (m *NBNSMessage) OpName() string {
+	if n, ok := nbnsOpcodes[m.Opcode]; ok {
+		return n
+	}
+	return fmt.Sprintf("Opcode %d", m.Opcode)
+}
+
+// Summary is a one-line description for the info column, e.g.
+// "Name query NB WPAD<00>" or "Name query response NB 10.0.0.5".
+func (m *NBNSMessage) Summary() string {
+	s := m.OpName()
+	if m.Response {
+		s += " response"
+		if m.Rcode != 0 {
+			s += ", " + nbnsRcodeString(m.Rcode)
+		}
+	}
+	for _, q := range m.Questions {
+		s += " " + nbnsTypeString(q.Type) + " " + q.Name.String()
+	}
+	for _, a := range m.Answers {
+		s += " " + nbnsTypeString(a.Type) + " " + a.Name.String()
+		for _, ip := range a.Addresses {
+			s += " " + ip.String()
+		}
+		if len(a.Names) > 0 {
+			s += fmt.Sprintf(" (%d names)", len(a.Names))
+		}
+	}
+	if !m.Response {
+		for _, a := range m.Additionals {
+			for _, ip := range a.Addresses {
+				s += " " + ip.String()
+			}
+		}
+	}
+	return s
+}
+
+func nbnsRcodeString(code uint8) string {
+	if n, ok := nbnsRcodes[code]; ok {
+		return n
+	}
+	return fmt.Sprintf("Rcode %d", code)
+}
+
+// findNBNS decodes the NBNS message of a UDP 137 packet, or one on a port
+// decoded as NBNS.
+func findNBNS(pkt gopacket.Packet) *NBNSMessage {
+	udpLayer := pkt.Layer(layers.LayerTypeUDP)
+	if udpLayer == nil {
+		return nil
+	}
+	if forced := decodeAsFor(pkt); forced != "NBNS" && (forced != "" || !portIs(pkt, portNBNS)) {
+		return nil
+	}
+	return parseNBNS(udpLayer.(*layers.UDP).Payload)
+}
+
+func parseNBNS(data []byte) *NBNSMessage {
+	if len(data) < 12 {
+		return nil
+	}
+	flags := binary.BigEndian.Uint16(data[2:])
+	m := &NBNSMessage{
+		ID:        binary.BigEndian.Uint16(data),
+		Response:  flags&0x8000 != 0,
+		Opcode:    uint8(flags>>11) & 0x0f,
+		Broadcast: flags&0x0010 != 0,
+		Rcode:     uint8(flags & 0x000f),
+	}
+	qd := int(binary.BigEndian.Uint16(data[4:]))
+	an := int(binary.BigEndian.Uint16(data[6:]))
+	ns := int(binary.BigEndian.Uint16(data[8:]))
+	ar := int(binary.BigEndian.Uint16(data[10:]))
+	if qd+an+ns+ar == 0 || qd+an+ns+ar > 16 {
+		return nil
+	}
+
+	off := 12
+	for i := 0; i < qd; i++ {
+		name, n, ok := nbnsReadName(data, off)
+		if !ok || n+4 > len(data) {
+			return nil
+		}
+		m.Questions = append(m.Questions, NBNSQuestion{Name: name, Type: binary.BigEndian.Uint16(data[n:]), at: span{off, n + 4 - off}})
+		off = n + 4
+	}
+	for i := 0; i < an+ns+ar; i++ {
+		rr, n, ok := nbnsReadRecord(data, off)
+		if !ok {
+			return nil
+		}
+		switch {
+		case i < an:
+			m.Answers = append(m.Answers, rr)
+		case i >= an+ns:
+			m.Additionals = append(m.Additionals, rr)
+		}
+		off = n
+	}
+	return m
+}
+
+// nbnsReadName decodes the encoded name at off, following one compression
+// pointer, and returns it with the offset just past it. A NetBIOS scope
+// after the name is skipped.
+func nbnsReadName(data []byte, off int) (NBNSName, int, bool) {
+	end := -1 // where the name ends in the record, once a pointer is followed
+	for hops := 0; ; hops++ {
+		if off >= len(data) || hops > 1 {
+			return NBNSName{}, 0, false
+		}
+		if data[off]&0xc0 != 0xc0 {
+			break
+		}
+		if off+2 > len(data) {
+			return NBNSName{}, 0, false
+		}
+		if end < 0 {
+			end = off + 2
+		}
+		off = int(binary.BigEndian.Uint16(data[off:]) & 0x3fff)
+	}
+	if off+33 > len(data) || data[off] != 32 {
+		return NBNSName{}, 0, false
+	}
+	var raw [16]byte
+	for i := range raw {
+		hi, lo := data[off+1+2*i]-'A', data[off+2+2*i]-'A'
+		if hi > 15 || lo > 15 {
+			return NBNSName{}, 0, false
+		}
+		raw[i] = hi<<4 | lo
+	}
+	off += 33
+	for off < len(data) && data[off] != 0 { // scope labels
+		off += 1 + int(data[off])
+	}
+	if off >= len(data) {
+		return NBNSName{}, 0, false
+	}
+	off++
+	if end >= 0 {
+		off = end
+	}
+	return nbnsDecodedName(raw), off, true
+}
+
+func nbnsDecodedName(raw [16]byte) NBNSName {
+	name := strings.TrimRight(string(raw[:15]), " \x00")
+	return NBNSName{Name: strings.Map(printableRune, name), Suffix: raw[15]}
+}
+
+func printableRune(r rune) rune {
+	if r < 0x20 || r > 0x7e {
+		return '.'
+	}
+	return r
+}
+
+func nbnsReadRecord(data []byte, start int) (NBNSRecord, int, bool) {
+	name, off, ok := nbnsReadName(data, start)
+	if !ok || off+10 > len(data) {
+		return NBNSRecord{}, 0, false
+	}
+	rr := NBNSRecord{
+		Name: name,
+		Type: binary.BigEndian.Uint16(data[off:]),
+		TTL:  binary.BigEndian.Uint32(data[off+4:]),
+	}
+	rdlen := int(binary.BigEndian.Uint16(data[off+8:]))
+	off += 10
+	if off+rdlen > len(data) {
+		return NBNSRecord{}, 0, false
+	}
+	rdata := data[off : off+rdlen]
+	switch rr.Type {
+	case nbnsTypeNB:
+		for i := 0; i+6 <= len(rdata); i += 6 {
+			rr.Group = binary.BigEndian.Uint16(rdata[i:])&0x8000 != 0
+			rr.Addresses = append(rr.Addresses, net.IP(append([]byte(nil), rdata[i+2:i+6]...)))
+			rr.addrAt = append(rr.addrAt, span{off + i, 6})
+		}
+		rr.Name.Group = rr.Group
+	case nbnsTypeNBSTAT:
+		if len(rdata) < 1 {
+			break
+		}
+		count := int(rdata[0])
+		p := 1
+		for i := 0; i < count && p+18 <= len(rdata); i++ {
+			var raw [16]byte
+			copy(raw[:], rdata[p:p+16])
+			n := nbnsDecodedName(raw)
+			n.Group = binary.BigEndian.Uint16(rdata[p+16:])&0x8000 != 0
+			rr.Names = append(rr.Names, n)
+			rr.namesAt = append(rr.namesAt, span{off + p, 18})
+			p += 18
+		}
+		if p+6 <= len(rdata) {
+			rr.MAC = net.HardwareAddr(append([]byte(nil), rdata[p:p+6]...))
+			rr.macAt = span{off + p, 6}
+		}
+	}
+	rr.at = span{start, off + rdlen - start}
+	return rr, off + rdlen, true
+}
+
+// resolutions returns the names the message binds to addresses. Only
+// unique workstation (<00>) and server (<20>) names are host names; group
+// names belong to workgroups and domains.
+func (m *NBNSMessage) resolutions(pkt gopacket.Packet) []NameResolution {
+	var out []NameResolution
+	add := func(ip net.IP, n NBNSName) {
+		if n.Group || (n.Suffix != 0x00 && n.Suffix != 0x20) || n.Name == "" || ip == nil || ip.IsUnspecified() {
+			return
+		}
+		for _, r := range out {
+			if r.IP == ip.String() && r.Name == n.Name {
+				return
+			}
+		}
+		out = append(out, NameResolution{IP: ip.String(), Name: n.Name, Protocol: "NBNS"})
+	}
+
+	if m.Response && m.Rcode == 0 {
+		for _, a := range m.Answers {
+			for _, ip := range a.Addresses {
+				add(ip, a.Name)
+			}
+			// Node status lists the responder's own names
+			if len(a.Names) > 0 {
+				if nl := pkt.NetworkLayer(); nl != nil {
+					src := net.ParseIP(nl.NetworkFlow().Src().String())
+					for _, n := range a.Names {
+						add(src, n)
+					}
+				}
+			}
+		}
+	}
+	// Registrations and refreshes claim a name for the sender's address
+	if !m.Response && (m.Opcode == 5 || m.Opcode == 8 || m.Opcode == 9 || m.Opcode == 15) {
+		for _, a := range m.Additionals {
+			for _, ip := range a.Addresses {
+				add(ip, a.Name)
+			}
+		}
+	}
+	return out
+}
+
+func buildNBNSLayerDetail(m *NBNSMessage) models.LayerDetail {
+	fields := []models.LayerField{
+		{Name: "Transaction ID", Value: fmt.Sprintf("0x%04x", m.ID), Offset: 0, Length: 2},
+		{Name: "Operation", Value: m.OpName() + boolToStr(m.Response, " response", ""), Offset: 2, Length: 2},
+		{Name: "Broadcast", Value: boolToStr(m.Broadcast, "Yes", "No"), Offset: 2, Length: 2},
+	}
+	if m.Response {
+		fields = append(fields, models.LayerField{Name: "Response Code", Value: boolToStr(m.Rcode == 0, "No Error (0)", nbnsRcodeString(m.Rcode)), Offset: 2, Length: 2})
+	}
+	for _, q := range m.Questions {
+		fields = append(fields, q.at.field("Query", q.Name.String()+" "+nbnsTypeString(q.Type)))
+	}
+	record := func(label string, rr NBNSRecord) models.LayerField {
+		f := rr.at.field(label, fmt.Sprintf("%s %s TTL %d", rr.Name, nbnsTypeString(rr.Type), rr.TTL))
+		for i, ip := range rr.Addresses {
+			f.Children = append(f.Children, rr.addrAt[i].field("Address", ip.String()+boolToStr(rr.Group, " (group)", "")))
+		}
+		for i, n := range rr.Names {
+			f.Children = append(f.Children, rr.namesAt[i].field("Name", n.String()+boolToStr(n.Group, " (group)", "")))
+		}
+		if rr.MAC != nil {
+			f.Children = append(f.Children, rr.macAt.field("MAC Address", rr.MAC.String()))
+		}
+		return f
+	}
+	for _, a := range m.Answers {
+		fields = append(fields, record("Answer", a))
+	}
+	for _, a := range m.Additionals {
+		fields = append(fields, record("Additional", a))
+	}
+	return models.LayerDetail{Name: "NBNS", Fields: fields}
+}
@@ -0,0 +1,252 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+// NDP option types (RFC 4861, RFC 4191, RFC 8106).
+const (
+	ndpOptSourceLLA     = 1
+	ndpOptTargetLLA     = 2
+	ndpOptPrefixInfo    = 3
+	ndpOptRedirected    = 4
+	ndpOptMTU           = 5
+	ndpOptNonce         = 14
+	ndpOptRouteInfo     = 24
+	ndpOptRDNSS         = 25
+	ndpOptDNSSL         = 31
+	ndpOptCaptivePortal = 37
+)
+
+var ndpOptNames = map[uint8]string{
+	ndpOptSourceLLA:     "Source Link-Layer Address",
+	ndpOptTargetLLA:     "Target Link-Layer Address",
+	ndpOptPrefixInfo:    "Prefix Information",
+	ndpOptRedirected:    "Redirected Header",
+	ndpOptMTU:           "MTU",
+	ndpOptNonce:         "Nonce",
+	ndpOptRouteInfo:     "Route Information",
+	ndpOptRDNSS:         "Recursive DNS Server",
+	ndpOptDNSSL:         "DNS Search List",
+	ndpOptCaptivePortal: "Captive Portal",
+}
+
+// ndpPreferences names the 2-bit router and route preference (RFC 4191).
+var ndpPreferences = [4]string{"Medium", "High", "Reserved", "Low"}
+
+// ndpOptionsStart returns where the options of an NDP message begin in its
+// body, the ICMPv6 payload, or false if icmp is not an NDP message.
+func ndpOptionsStart(icmp *layers.ICMPv6) (int, bool) {
+	switch icmp.TypeCode.Type() {
+	case layers.ICMPv6TypeRouterSolicitation:
+		return 4, true
+	case layers.ICMPv6TypeRouterAdvertisement:
+		return 12, true
+	case layers.ICMPv6TypeNeighborSolicitation, layers.ICMPv6TypeNeighborAdvertisement:
+		return 20, true
+	case layers.ICMPv6TypeRedirect:
+		return 36, true
+	}
+	return 0, false
+}
+
+// ndpFields describes the body of an NDP message and its options. Offsets
+// are from the start of the ICMPv6 header, whose 4 bytes precede the body.
+func ndpFields(icmp *layers.ICMPv6) []models.LayerField {
+	start, ok := ndpOptionsStart(icmp)
+	p := icmp.Payload
+	if !ok || len(p) < start {
+		return nil
+	}
+	var fields []models.LayerField
+	switch icmp.TypeCode.Type() {
+	case layers.ICMPv6TypeRouterAdvertisement:
+		flags := p[1]
+		var set []string
+		if flags&0x80 != 0 {
+			set = append(set, "Managed")
+		}
+		if flags&0x40 != 0 {
+			set = append(set, "Other")
+		}
+		if flags&0x20 != 0 {
+			set = append(set, "Home Agent")
+		}
+		flagValue := fmt.Sprintf("0x%02x", flags)
+		if len(set) > 0 {
+			flagValue += " (" + strings.Join(set, ", ") + ")"
+		}
+		fields = append(fields,
+			models.LayerField{Name: "Cur Hop Limit", Value: fmt.Sprintf("%d", p[0]), Offset: 4, Length: 1},
+			models.LayerField{Name: "Flags", Value: flagValue, Offset: 5, Length: 1, Children: []models.LayerField{
+				{Name: "Managed Address Configuration", Value: boolToStr(flags&0x80 != 0, "Set", "Not set"), Offset: 5, Length: 1},
+				{Name: "Other Configuration", Value: boolToStr(flags&0x40 != 0, "Set", "Not set"), Offset: 5, Length: 1},
+				{Name: "Router Preference", Value: ndpPreferences[flags>>3&3], Offset: 5, Length: 1},
+			}},
+			models.LayerField{Name: "Router Lifetime", Value: fmt.Sprintf("%d s", binary.BigEndian.Uint16(p[2:])), Offset: 6, Length: 2},
+			models.LayerField{Name: "Reachable Time", Value: fmt.Sprintf("%d ms", binary.BigEndian.Uint32(p[4:])), Offset: 8, Length: 4},
+			models.LayerField{Name: "Retrans Timer", Value: fmt.Sprintf("%d ms", binary.BigEndian.Uint32(p[8:])), Offset: 12, Length: 4},
+		)
+	case layers.ICMPv6TypeNeighborAdvertisement:
+		flags := p[0]
+		fields = append(fields,
+			models.LayerField{Name: "Router", Value: boolToStr(flags&0x80 != 0, "Set", "Not set"), Offset: 4, Length: 1},
+			models.LayerField{Name: "Solicited", Value: boolToStr(flags&0x40 != 0, "Set", "Not set"), Offset: 4, Length: 1},
+			models.LayerField{Name: "Override", Value: boolToStr(flags&0x20 != 0, "Set", "Not set"), Offset: 4, Length: 1},
+			models.LayerField{Name: "Target Address", Value: net.IP(p[4:20]).String(), Offset: 8, Length: 16},
+		)
+	case layers.ICMPv6TypeNeighborSolicitation:
+		fields = append(fields, models.LayerField{Name: "Target Address", Value: net.IP(p[4:20]).String(), Offset: 8, Length: 16})
+	case layers.ICMPv6TypeRedirect:
+		fields = append(fields,
+			models.LayerField{Name: "Target Address", Value: net.IP(p[4:20]).String(), Offset: 8, Length: 16},
+			models.LayerField{Name: "Destination Address", Value: net.IP(p[20:36]).String(), Offset: 24, Length: 16},
+		)
+	}
+	for _, o := range ndpOptions(p[start:], 4+start) {
+		fields = append(fields, o.field())
+	}
+	return fields
+}
+
+// ndpOption is one option of an NDP message.
+type ndpOption struct {
+	Type   uint8
+	Offset int    // of the option's type byte
+	Data   []byte // after the type and length bytes
+}
+
+// ndpOptions splits options, each a type, a length in units of 8 bytes
+// and data. Parsing stops at an option with a zero length or one that runs
+// past the message.
+func ndpOptions(b []byte, off int) []ndpOption {
+	var out []ndpOption
+	for len(b) >= 2 {
+		n := int(b[1]) * 8
+		if n == 0 || n > len(b) {
+			break
+		}
+		out = append(out, ndpOption{Type: b[0], Offset: off, Data: b[2:n]})
+		b, off = b[n:], off+n
+	}
+	return out
+}
+
+func (o ndpOption) field() models.LayerField {
+	name, ok := ndpOptNames[o.Type]
+	if !ok {
+		name = fmt.Sprintf("Option %d", o.Type)
+	}
+	f := models.LayerField{Name: name, Offset: o.Offset, Length: 2 + len(o.Data)}
+	d, at := o.Data, o.Offset+2
+	switch o.Type {
+	case ndpOptSourceLLA, ndpOptTargetLLA:
+		// Ethernet addresses fill the option's 6 data bytes
+		f.Value = net.HardwareAddr(d).String()
+	case ndpOptPrefixInfo:
+		if len(d) < 30 {
+			break
+		}
+		prefix := fmt.Sprintf("%s/%d", net.IP(d[14:30]), d[0])
+		f.Value = prefix
+		f.Children = []models.LayerField{
+			{Name: "Prefix Length", Value: fmt.Sprintf("%d", d[0]), Offset: at, Length: 1},
+			{Name: "On-link", Value: boolToStr(d[1]&0x80 != 0, "Set", "Not set"), Offset: at + 1, Length: 1},
+			{Name: "Autonomous Address Configuration", Value: boolToStr(d[1]&0x40 != 0, "Set", "Not set"), Offset: at + 1, Length: 1},
+			{Name: "Valid Lifetime", Value: dhcpv6Lifetime(binary.BigEndian.Uint32(d[2:])), Offset: at + 2, Length: 4},
+			{Name: "Preferred Lifetime", Value: dhcpv6Lifetime(binary.BigEndian.Uint32(d[6:])), Offset: at + 6, Length: 4},
+			{Name: "Prefix", Value: net.IP(d[14:30]).String(), Offset: at + 14, Length: 16},
+		}
+	case ndpOptRedirected:
+		f.Value = fmt.Sprintf("%d bytes", max(len(d)-6, 0))
+	case ndpOptMTU:
+		if len(d) >= 6 {
+			f.Value = fmt.Sprintf("%d", binary.BigEndian.Uint32(d[2:]))
+		}
+	case ndpOptRouteInfo:
+		if len(d) < 6 {
+			break
+		}
+		// The prefix is cut to the 0, 8 or 16 bytes it needs
+		prefix := make(net.IP, 16)
+		copy(prefix, d[6:])
+		f.Value = fmt.Sprintf("%s/%d", prefix, d[0])
+		f.Children = []models.LayerField{
+			{Name: "Prefix Length", Value: fmt.Sprintf("%d", d[0]), Offset: at, Length: 1},
+			{Name: "Route Preference", Value: ndpPreferences[d[1]>>3&3], Offset: at + 1, Length: 1},
+			{Name: "Route Lifetime", Value: dhcpv6Lifetime(binary.BigEndian.Uint32(d[2:])), Offset: at + 2, Length: 4},
+			{Name: "Prefix", Value: prefix.String(), Offset: at + 6, Length: len(d) - 6},
+		}
+	case ndpOptRDNSS:
+		if len(d) < 6 {
+			break
+		}
+		f.Children = []models.LayerField{{Name: "Lifetime", Value: dhcpv6Lifetime(binary.BigEndian.Uint32(d[2:])), Offset: at + 2, Length: 4}}
+		var addrs []string
+		for i := 6; i+16 <= len(d); i += 16 {
+			a := net.IP(d[i : i+16]).String()
+			addrs = append(addrs, a)
+			f.Children = append(f.Children, models.LayerField{Name: "Address", Value: a, Offset: at + i, Length: 16})
+		}
+		f.Value = strings.Join(addrs, ", ")
+	case ndpOptDNSSL:
+		if len(d) < 6 {
+			break
+		}
+		f.Children = []models.LayerField{{Name: "Lifetime", Value: dhcpv6Lifetime(binary.BigEndian.Uint32(d[2:])), Offset: at + 2, Length: 4}}
+		names := dnsNameList(d[6:])
+		for _, n := range names {
+			f.Children = append(f.Children, models.LayerField{Name: "Domain", Value: n})
+		}
+		f.Value = strings.Join(names, ", ")
+	case ndpOptCaptivePortal:
+		f.Value = strings.TrimRight(string(d), "\x00")
+	default:
+		f.Value = fmt.Sprintf("%x", d)
+	}
+	return f
+}
+
+// ndpSummary returns the addresses an NDP message is about for the Info
+// column: the target of a solicitation, advertisement or redirect, the
+// link-layer address an advertisement maps it to, and the prefixes a
+// router advertises.
+func ndpSummary(icmp *layers.ICMPv6) []models.InfoPart {
+	start, ok := ndpOptionsStart(icmp)
+	p := icmp.Payload
+	if !ok || len(p) < start {
+		return nil
+	}
+	var parts []models.InfoPart
+	switch icmp.TypeCode.Type() {
+	case layers.ICMPv6TypeNeighborSolicitation:
+		parts = append(parts, infoPart("ndp.ns", "target", net.IP(p[4:20]).String()))
+	case layers.ICMPv6TypeNeighborAdvertisement:
+		parts = append(parts, infoPart("ndp.target", "target", net.IP(p[4:20]).String()))
+		for _, o := range ndpOptions(p[start:], 0) {
+			if o.Type == ndpOptTargetLLA {
+				parts = append(parts, infoPart("ndp.lladdr", "mac", net.HardwareAddr(o.Data).String()))
+			}
+		}
+	case layers.ICMPv6TypeRedirect:
+		parts = append(parts, infoPart("ndp.redirect", "target", net.IP(p[4:20]).String(), "destination", net.IP(p[20:36]).String()))
+	case layers.ICMPv6TypeRouterAdvertisement:
+		var prefixes []string
+		for _, o := range ndpOptions(p[start:], 0) {
+			if o.Type == ndpOptPrefixInfo && len(o.Data) >= 30 {
+				prefixes = append(prefixes, fmt.Sprintf("%s/%d", net.IP(o.Data[14:30]), o.Data[0]))
+			}
+		}
+		if len(prefixes) > 0 {
+			parts = append(parts, infoPart("ndp.prefixes", "prefixes", strings.Join(prefixes, ", ")))
+		}
+	}
+	return parts
+}
@@ -0,0 +1,287 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+)
+
+// NTLMSSP message parser. NTLM tokens show up raw inside SMB session setup
+// blobs and base64-encoded in HTTP Authorization / WWW-Authenticate headers.
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+const (
+	ntlmNegotiateUnicode = 0x00000001
+	ntlmNegotiateESS     = 0x00080000 // extended session security (NTLM2 session response)
+	ntlmNegotiateVersion = 0x02000000
+)
+
+// NTLMInfo holds the fields extracted from one NTLMSSP message.
+type NTLMInfo struct {
+	MessageType uint32
+	Flags       uint32
+	Domain      string
+	User        string
+	Workstation string
+	TargetName  string
+	Challenge   string
+	OSVersion   string
+	LMRespLen   int
+	NTRespLen   int
+	NTLMVersion string // "NTLMv1", "NTLMv2", "Anonymous" — Authenticate only
+	HTTPCarried bool
+
+	// The message, and where its fields are in it
+	raw                                      []byte
+	flagsAt, domainAt, userAt, workstationAt span
+	targetAt, challengeAt, osAt, lmAt, ntAt  span
+}
+
+// MessageName returns the NTLMSSP message type name.
+func (n *NTLMInfo) MessageName() string {
+	switch n.MessageType {
+	case 1:
+		return "NEGOTIATE"
+	case 2:
+		return "CHALLENGE"
+	case 3:
+		return "AUTHENTICATE"
+	default:
+		return fmt.Sprintf("Type %d", n.MessageType)
+	}
+}
+
+// ExtractNTLM finds and parses an NTLMSSP message in the packet payload.
+func ExtractNTLM(pkt gopacket.Packet) *NTLMInfo {
+	app := pkt.ApplicationLayer()
+	if app == nil {
+		return nil
+	}
+	return findNTLM(app.Payload())
+}
+
+func findNTLM(data []byte) *NTLMInfo {
+	if idx := bytes.Index(data, ntlmSignature); idx >= 0 {
+		return parseNTLMSSP(data[idx:])
+	}
+
+	// HTTP: "Authorization: NTLM <base64>" or "Negotiate <base64>"
+	if !isHTTP(data) {
+		return nil
+	}
+	for _, line := range strings.Split(string(data), "\r\n") {
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(line[:colon]))
+		if name != "authorization" && name != "www-authenticate" && name != "proxy-authorization" && name != "proxy-authenticate" {
+			continue
+		}
+		parts := strings.Fields(line[colon+1:])
+		if len(parts) != 2 || (parts[0] != "NTLM" && parts[0] != "Negotiate") {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			continue
+		}
+		if idx := bytes.Index(raw, ntlmSignature); idx >= 0 {
+			if info := parseNTLMSSP(raw[idx:]); info != nil {
+				info.HTTPCarried = true
+				return info
+			}
+		}
+	}
+	return nil
+}
+
+// parseNTLMSSP parses a message starting at the "NTLMSSP\0" signature.
+func parseNTLMSSP(msg []byte) *NTLMInfo {
+	if len(msg) < 12 || !bytes.HasPrefix(msg, ntlmSignature) {
+		return nil
+	}
+	info := &NTLMInfo{MessageType: binary.LittleEndian.Uint32(msg[8:12]), raw: msg}
+	flags := func(off int) {
+		if len(msg) >= off+4 {
+			info.Flags = binary.LittleEndian.Uint32(msg[off : off+4])
+			info.flagsAt = span{off, 4}
+		}
+	}
+	osVersion := func(off int) {
+		if info.OSVersion = ntlmVersion(msg, off, info.Flags); info.OSVersion != "" {
+			info.osAt = span{off, 8}
+		}
+	}
+
+	switch info.MessageType {
+	case 1:
+		flags(12)
+		// Negotiate domain/workstation are always OEM encoded
+		info.Domain, info.domainAt = ntlmField(msg, 16, false)
+		info.Workstation, info.workstationAt = ntlmField(msg, 24, false)
+		osVersion(32)
+	case 2:
+		flags(20)
+		info.TargetName, info.targetAt = ntlmField(msg, 12, info.Flags&ntlmNegotiateUnicode != 0)
+		if len(msg) >= 32 {
+			info.Challenge = fmt.Sprintf("%x", msg[24:32])
+			info.challengeAt = span{24, 8}
+		}
+		osVersion(48)
+	case 3:
+		flags(60)
+		unicode := info.Flags&ntlmNegotiateUnicode != 0
+		info.LMRespLen = ntlmFieldLen(msg, 12)
+		info.NTRespLen = ntlmFieldLen(msg, 20)
+		info.lmAt, info.ntAt = ntlmBuffer(msg, 12), ntlmBuffer(msg, 20)
+		info.Domain, info.domainAt = ntlmField(msg, 28, unicode)
+		info.User, info.userAt = ntlmField(msg, 36, unicode)
+		info.Workstation, info.workstationAt = ntlmField(msg, 44, unicode)
+		osVersion(64)
+		switch {
+		case info.NTRespLen == 0 && info.LMRespLen <= 1:
+			info.NTLMVersion = "Anonymous"
+		case info.NTRespLen == 24:
+			info.NTLMVersion = "NTLMv1"
+		default:
+			info.NTLMVersion = "NTLMv2"
+		}
+	default:
+		return nil
+	}
+	return info
+}
+
+// ntlmFieldLen reads the length of a security buffer descriptor at off.
+func ntlmFieldLen(msg []byte, off int) int {
+	if len(msg) < off+8 {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint16(msg[off : off+2]))
+}
+
+// ntlmBuffer returns where the data a security buffer descriptor at off
+// refers to is, or the zero span if it is empty or out of bounds.
+func ntlmBuffer(msg []byte, off int) span {
+	if len(msg) < off+8 {
+		return span{}
+	}
+	length := int(binary.LittleEndian.Uint16(msg[off : off+2]))
+	start := int(binary.LittleEndian.Uint32(msg[off+4 : off+8]))
+	if length == 0 || start+length > len(msg) {
+		return span{}
+	}
+	return span{start, length}
+}
+
+// ntlmField reads the string referenced by a security buffer descriptor
+// at off, and where it is.
+func ntlmField(msg []byte, off int, unicode bool) (string, span) {
+	at := ntlmBuffer(msg, off)
+	if at.n == 0 {
+		return "", at
+	}
+	data := msg[at.off : at.off+at.n]
+	if !unicode {
+		return string(data), at
+	}
+	u := make([]uint16, len(data)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(u)), at
+}
+
+// ntlmVersion decodes the 8-byte VERSION structure when negotiated.
+func ntlmVersion(msg []byte, off int, flags uint32) string {
+	if flags&ntlmNegotiateVersion == 0 || len(msg) < off+8 {
+		return ""
+	}
+	build := binary.LittleEndian.Uint16(msg[off+2 : off+4])
+	return fmt.Sprintf("Windows %d.%d build %d (NTLM rev %d)", msg[off], msg[off+1], build, msg[off+7])
+}
+
+// ntlmFlagNames lists the notable negotiate flags.
+func ntlmFlagNames(flags uint32) string {
+	names := []struct {
+		bit  uint32
+		name string
+	}{
+		{0x00000001, "Unicode"},
+		{0x00000200, "NTLM"},
+		{0x00000010, "Sign"},
+		{0x00000020, "Seal"},
+		{ntlmNegotiateESS, "ExtendedSessionSecurity"},
+		{0x00800000, "TargetInfo"},
+		{ntlmNegotiateVersion, "Version"},
+		{0x20000000, "128-bit"},
+		{0x40000000, "KeyExchange"},
+		{0x80000000, "56-bit"},
+	}
+	var parts []string
+	for _, n := range names {
+		if flags&n.bit != 0 {
+			parts = append(parts, n.name)
+		}
+	}
+	return fmt.Sprintf("0x%08x [%s]", flags, strings.Join(parts, ", "))
+}
+
+// Summary returns a short Info-column description of the message.
+func (n *NTLMInfo) Summary() string {
+	s := "NTLMSSP_" + n.MessageName()
+	if n.MessageType == 3 {
+		if n.User != "" {
+			s += " User: " + n.Domain + `\` + n.User
+		}
+		s += " (" + n.NTLMVersion + ")"
+	}
+	return s
+}
+
+// buildNTLMLayerDetail describes n; field offsets are relative to the
+// start of the message.
+func buildNTLMLayerDetail(n *NTLMInfo) models.LayerDetail {
+	fields := []models.LayerField{
+		{Name: "Message Type", Value: fmt.Sprintf("%s (%d)", n.MessageName(), n.MessageType), Offset: 8, Length: 4},
+		n.flagsAt.field("Negotiate Flags", ntlmFlagNames(n.Flags)),
+	}
+	if n.HTTPCarried {
+		fields = append(fields, models.LayerField{Name: "Carried In", Value: "HTTP Authorization header"})
+	}
+	if n.TargetName != "" {
+		fields = append(fields, n.targetAt.field("Target Name", n.TargetName))
+	}
+	if n.Challenge != "" {
+		fields = append(fields, n.challengeAt.field("Server Challenge", n.Challenge))
+	}
+	if n.Domain != "" {
+		fields = append(fields, n.domainAt.field("Domain", n.Domain))
+	}
+	if n.User != "" {
+		fields = append(fields, n.userAt.field("User", n.User))
+	}
+	if n.Workstation != "" {
+		fields = append(fields, n.workstationAt.field("Workstation", n.Workstation))
+	}
+	if n.MessageType == 3 {
+		fields = append(fields,
+			n.lmAt.field("LM Response Length", fmt.Sprintf("%d", n.LMRespLen)),
+			n.ntAt.field("NT Response Length", fmt.Sprintf("%d", n.NTRespLen)),
+			models.LayerField{Name: "NTLM Version", Value: n.NTLMVersion},
+		)
+	}
+	if n.OSVersion != "" {
+		fields = append(fields, n.osAt.field("OS Version", n.OSVersion))
+	}
+	return models.LayerDetail{Name: "NTLMSSP", Fields: fields}
+}
@@ -0,0 +1,121 @@
+package parser
+
+import (
+	"math"
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// NTPExchange is one NTP client request or server reply.
+type NTPExchange struct {
+	Client   string
+	Server   string
+	Mode     string
+	Response bool // sent by the server (server or broadcast mode)
+	Version  int
+	Stratum  int
+	RefID    string
+	Leap     int // 3 = server clock unsynchronized
+	// OffsetMs is the server clock minus the capture clock and DelayMs the
+	// round trip, from the RFC 5905 on-wire formula using the capture time
+	// as the client's receive time. Only replies carry them.
+	OffsetMs  float64
+	DelayMs   float64
+	HasOffset bool
+}
+
+var ntpModes = map[layers.NTPMode]string{
+	1: "symmetric active",
+	2: "symmetric passive",
+	3: "client",
+	4: "server",
+	5: "broadcast",
+}
+
+// ntpEpochOffset is the number of seconds from 1900 to 1970.
+const ntpEpochOffset = 2208988800
+
+// ExtractNTP returns the NTP client/server exchange carried by pkt, or nil
+// for other traffic and NTP control/private messages.
+func ExtractNTP(pkt gopacket.Packet) *NTPExchange {
+	l := pkt.Layer(layers.LayerTypeNTP)
+	if l == nil {
+		return nil
+	}
+	ntp := l.(*layers.NTP)
+	mode, ok := ntpModes[ntp.Mode]
+	if !ok {
+		return nil
+	}
+	tuple := ExtractFlowTuple(pkt)
+	if !tuple.Valid {
+		return nil
+	}
+
+	ex := &NTPExchange{
+		Mode:    mode,
+		Version: int(ntp.Version),
+		Stratum: int(ntp.Stratum),
+		Leap:    int(ntp.LeapIndicator),
+	}
+	ex.Response = ntp.Mode == 4 || ntp.Mode == 5 || ntp.Mode == 2
+	if ex.Response {
+		ex.Server, ex.Client = tuple.SrcIP, tuple.DstIP
+	} else {
+		ex.Server, ex.Client = tuple.DstIP, tuple.SrcIP
+	}
+	if ex.Response {
+		ex.RefID = ntpRefID(ntp)
+	}
+
+	t3 := ntpTime(ntp.TransmitTimestamp)
+	t4 := pkt.Metadata().Timestamp
+	if ex.Response && !t3.IsZero() && !t4.IsZero() {
+		t1, t2 := ntpTime(ntp.OriginTimestamp), ntpTime(ntp.ReceiveTimestamp)
+		if t1.IsZero() || t2.IsZero() {
+			ex.OffsetMs = ms(t3.Sub(t4))
+		} else {
+			ex.OffsetMs = (ms(t2.Sub(t1)) + ms(t3.Sub(t4))) / 2
+			ex.DelayMs = math.Max(ms(t4.Sub(t1))-ms(t3.Sub(t2)), 0)
+		}
+		ex.HasOffset = true
+	}
+	return ex
+}
+
+// ntpTime converts an NTP timestamp to time.Time, taking timestamps with
+// the top bit clear to be in era 1 (after February 2036).
+func ntpTime(ts layers.NTPTimestamp) time.Time {
+	if ts == 0 {
+		return time.Time{}
+	}
+	secs := int64(ts >> 32)
+	if secs < 0x80000000 {
+		secs += 1 << 32
+	}
+	nanos := (int64(ts&0xffffffff) * 1e9) >> 32
+	return time.Unix(secs-ntpEpochOffset, nanos)
+}
+
+func ntpRefID(ntp *layers.NTP) string {
+	id := uint32(ntp.ReferenceID)
+	b := []byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}
+	switch {
+	case ntp.Stratum == 0 || ntp.Stratum == 1:
+		// Kiss code or reference clock name, e.g. "GPS", "RATE"
+		n := 0
+		for n < 4 && b[n] >= 0x20 && b[n] < 0x7f {
+			n++
+		}
+		return string(b[:n])
+	default:
+		return net.IP(b).String()
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
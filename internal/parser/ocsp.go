@@ -0,0 +1,595 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+)
+
+// OCSP (RFC 6960) and CRL (RFC 5280) retrieval over HTTP. OCSP requests
+// travel as a POST body (application/ocsp-request) or base64 in the GET
+// path; responses and CRLs are DER bodies identified by Content-Type.
+
+// OCSPCert describes one certificate queried or reported on.
+type OCSPCert struct {
+	Serial        string
+	HashAlg       string
+	IssuerKeyHash string
+	Status        string // responses only: good, revoked, unknown
+	RevokedAt     string
+	Reason        string
+	ThisUpdate    string
+	NextUpdate    string
+
+	// Where the fields are in the DER body
+	serialAt, keyHashAt, statusAt, thisUpdateAt, nextUpdateAt span
+}
+
+// OCSPInfo holds a decoded OCSP request or response.
+type OCSPInfo struct {
+	Response       bool
+	ResponseStatus string
+	ProducedAt     string
+	Nonce          bool
+	Certs          []OCSPCert
+	Truncated      bool
+
+	// The DER body when it is carried as is, not base64 in a URL, and
+	// where the fields are in it
+	raw                    []byte
+	statusAt, producedAtAt span
+}
+
+// CRLInfo holds what could be decoded of a CRL fetch.
+type CRLInfo struct {
+	Response    bool
+	URI         string
+	Issuer      string
+	ThisUpdate  string
+	NextUpdate  string
+	Number      string
+	Revoked     int
+	Serials     []string
+	Truncated   bool
+	ContentSize int
+
+	// The request, or the DER body of the response, and where the fields
+	// are in it
+	raw                                                []byte
+	uriAt, issuerAt, thisUpdateAt, nextUpdateAt, revAt span
+}
+
+var (
+	oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidOCSPNonce = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+)
+
+var ocspHashNames = map[string]string{
+	"1.3.14.3.2.26":          "SHA-1",
+	"2.16.840.1.101.3.4.2.1": "SHA-256",
+	"2.16.840.1.101.3.4.2.2": "SHA-384",
+	"2.16.840.1.101.3.4.2.3": "SHA-512",
+}
+
+var ocspResponseStatusNames = map[int]string{
+	0: "successful",
+	1: "malformedRequest",
+	2: "internalError",
+	3: "tryLater",
+	5: "sigRequired",
+	6: "unauthorized",
+}
+
+var crlReasonNames = map[int]string{
+	0:  "unspecified",
+	1:  "keyCompromise",
+	2:  "cACompromise",
+	3:  "affiliationChanged",
+	4:  "superseded",
+	5:  "cessationOfOperation",
+	6:  "certificateHold",
+	8:  "removeFromCRL",
+	9:  "privilegeWithdrawn",
+	10: "aACompromise",
+}
+
+// ASN.1 shapes from RFC 6960 section 4.
+
+type ocspCertID struct {
+	Raw           asn1.RawContent
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspSingleRequest struct {
+	Cert ocspCertID
+}
+
+type ocspTBSRequest struct {
+	Version       int           `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName asn1.RawValue `asn1:"explicit,tag:1,optional"`
+	RequestList   []ocspSingleRequest
+	Extensions    []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     asn1.RawValue // OCTET STRING, kept in place for offsets
+}
+
+type ocspResponse struct {
+	Raw      asn1.RawContent
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspSingleResponse struct {
+	Raw        asn1.RawContent
+	CertID     ocspCertID
+	Good       asn1.Flag       `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag       `asn1:"tag:2,optional"`
+	ThisUpdate time.Time       `asn1:"generalized"`
+	NextUpdate time.Time       `asn1:"generalized,explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Raw         asn1.RawContent
+	Version     int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+	Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData ocspResponseData
+}
+
+// httpMessage is the start line, lower-cased headers and (possibly
+// partial) body of an HTTP message contained in one segment.
+type httpMessage struct {
+	startLine string
+	headers   map[string]string
+	body      []byte
+}
+
+func splitHTTPMessage(data []byte) *httpMessage {
+	if !isHTTP(data) {
+		return nil
+	}
+	head, body := data, []byte(nil)
+	if idx := bytes.Index(data, []byte("\r\n\r\n")); idx >= 0 {
+		head, body = data[:idx], data[idx+4:]
+	}
+	lines := strings.Split(string(head), "\r\n")
+	msg := &httpMessage{startLine: lines[0], headers: make(map[string]string)}
+	for _, line := range lines[1:] {
+		if colon := strings.IndexByte(line, ':'); colon > 0 {
+			msg.headers[strings.ToLower(strings.TrimSpace(line[:colon]))] = strings.TrimSpace(line[colon+1:])
+		}
+	}
+	msg.body = body
+	return msg
+}
+
+func (m *httpMessage) isResponse() bool {
+	return strings.HasPrefix(m.startLine, "HTTP/")
+}
+
+func (m *httpMessage) requestURI() string {
+	parts := strings.SplitN(m.startLine, " ", 3)
+	if len(parts) < 2 || m.isResponse() {
+		return ""
+	}
+	return parts[1]
+}
+
+func (m *httpMessage) contentType() string {
+	ct := m.headers["content-type"]
+	if semi := strings.IndexByte(ct, ';'); semi >= 0 {
+		ct = ct[:semi]
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
+// truncated reports whether Content-Length promises more body than this
+// segment carries.
+func (m *httpMessage) truncated() bool {
+	n, err := strconv.Atoi(m.headers["content-length"])
+	return err == nil && n > len(m.body)
+}
+
+// ExtractOCSP decodes an OCSP request or response carried over HTTP.
+func ExtractOCSP(pkt gopacket.Packet) *OCSPInfo {
+	app := pkt.ApplicationLayer()
+	if app == nil {
+		return nil
+	}
+	return findOCSP(app.Payload())
+}
+
+func findOCSP(data []byte) *OCSPInfo {
+	msg := splitHTTPMessage(data)
+	if msg == nil {
+		return nil
+	}
+	switch msg.contentType() {
+	case "application/ocsp-request":
+		info := &OCSPInfo{Truncated: msg.truncated(), raw: msg.body}
+		if !info.Truncated {
+			parseOCSPRequest(msg.body, info)
+		}
+		return info
+	case "application/ocsp-response":
+		info := &OCSPInfo{Response: true, Truncated: msg.truncated(), raw: msg.body}
+		if !info.Truncated {
+			parseOCSPResponse(msg.body, info)
+		}
+		return info
+	}
+
+	// GET {url}/{url-encoded base64 of the DER request} (RFC 6960 A.1)
+	if !strings.HasPrefix(msg.startLine, "GET ") {
+		return nil
+	}
+	// Some clients leave '/' inside the base64 unescaped, so try every
+	// path suffix until one decodes.
+	uri := msg.requestURI()
+	for i := strings.IndexByte(uri, '/'); i >= 0; {
+		seg := uri[i+1:]
+		if unescaped, err := url.PathUnescape(seg); err == nil {
+			seg = unescaped
+		}
+		if len(seg) >= 40 {
+			if der, err := base64.StdEncoding.DecodeString(seg); err == nil && len(der) > 0 && der[0] == 0x30 {
+				info := &OCSPInfo{}
+				if parseOCSPRequest(der, info) {
+					return info
+				}
+			}
+		}
+		next := strings.IndexByte(uri[i+1:], '/')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil
+}
+
+func parseOCSPRequest(der []byte, info *OCSPInfo) bool {
+	var req ocspRequest
+	if _, err := asn1.Unmarshal(der, &req); err != nil || len(req.TBSRequest.RequestList) == 0 {
+		return false
+	}
+	for _, r := range req.TBSRequest.RequestList {
+		info.Certs = append(info.Certs, ocspCertFromID(der, r.Cert))
+	}
+	info.Nonce = hasExtension(req.TBSRequest.Extensions, oidOCSPNonce)
+	return true
+}
+
+func parseOCSPResponse(der []byte, info *OCSPInfo) bool {
+	var resp ocspResponse
+	if _, err := asn1.Unmarshal(der, &resp); err != nil {
+		return false
+	}
+	info.ResponseStatus = ocspResponseStatusNames[int(resp.Status)]
+	if info.ResponseStatus == "" {
+		info.ResponseStatus = fmt.Sprintf("status %d", resp.Status)
+	}
+	if kids := berElements(resp.Raw); len(kids) > 0 {
+		info.statusAt = spanOf(der, kids[0].Raw)
+	}
+	if !resp.Response.ResponseType.Equal(oidOCSPBasic) {
+		return true
+	}
+
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(resp.Response.Response.Bytes, &basic); err != nil {
+		return true
+	}
+	data := basic.TBSResponseData
+	info.ProducedAt = formatASN1Time(data.ProducedAt)
+	for _, e := range berElements(data.Raw) {
+		if e.Class == berUniversal && e.Tag == asn1.TagGeneralizedTime {
+			info.producedAtAt = spanOf(der, e.Raw)
+			break
+		}
+	}
+	info.Nonce = hasExtension(data.Extensions, oidOCSPNonce)
+	for _, r := range data.Responses {
+		c := ocspCertFromID(der, r.CertID)
+		c.ThisUpdate = formatASN1Time(r.ThisUpdate)
+		c.NextUpdate = formatASN1Time(r.NextUpdate)
+		// CertID, status, thisUpdate, then an optional [0] nextUpdate
+		if kids := berElements(r.Raw); len(kids) >= 3 {
+			c.statusAt = spanOf(der, kids[1].Raw)
+			c.thisUpdateAt = spanOf(der, kids[2].Raw)
+			if len(kids) >= 4 && kids[3].Class == berContext && kids[3].Tag == 0 {
+				c.nextUpdateAt = spanOf(der, kids[3].Raw)
+			}
+		}
+		switch {
+		case bool(r.Good):
+			c.Status = "good"
+		case bool(r.Unknown):
+			c.Status = "unknown"
+		case !r.Revoked.RevocationTime.IsZero():
+			c.Status = "revoked"
+			c.RevokedAt = formatASN1Time(r.Revoked.RevocationTime)
+			c.Reason = crlReasonName(int(r.Revoked.Reason))
+		}
+		info.Certs = append(info.Certs, c)
+	}
+	return true
+}
+
+// ocspCertFromID describes a CertID decoded from der.
+func ocspCertFromID(der []byte, id ocspCertID) OCSPCert {
+	c := OCSPCert{
+		HashAlg:       ocspHashNames[id.HashAlgorithm.Algorithm.String()],
+		IssuerKeyHash: fmt.Sprintf("%x", id.IssuerKeyHash),
+	}
+	// hashAlgorithm, issuerNameHash, issuerKeyHash, serialNumber
+	if kids := berElements(id.Raw); len(kids) == 4 {
+		c.keyHashAt = spanOf(der, kids[2].Raw)
+		c.serialAt = spanOf(der, kids[3].Raw)
+	}
+	if c.HashAlg == "" {
+		c.HashAlg = id.HashAlgorithm.Algorithm.String()
+	}
+	if id.SerialNumber != nil {
+		c.Serial = formatSerial(id.SerialNumber)
+	}
+	return c
+}
+
+// ExtractCRL decodes a CRL download carried over HTTP.
+func ExtractCRL(pkt gopacket.Packet) *CRLInfo {
+	app := pkt.ApplicationLayer()
+	if app == nil {
+		return nil
+	}
+	return findCRL(app.Payload())
+}
+
+func findCRL(data []byte) *CRLInfo {
+	msg := splitHTTPMessage(data)
+	if msg == nil {
+		return nil
+	}
+	if !msg.isResponse() {
+		uri := msg.requestURI()
+		path := uri
+		if q := strings.IndexByte(path, '?'); q >= 0 {
+			path = path[:q]
+		}
+		if !strings.HasSuffix(strings.ToLower(path), ".crl") {
+			return nil
+		}
+		// The URI follows the method on the request line
+		at := span{strings.IndexByte(msg.startLine, ' ') + 1, len(uri)}
+		return &CRLInfo{URI: uri, raw: data, uriAt: at}
+	}
+
+	ct := msg.contentType()
+	if ct != "application/pkix-crl" && ct != "application/x-pkcs7-crl" {
+		return nil
+	}
+	info := &CRLInfo{Response: true, ContentSize: len(msg.body), raw: msg.body}
+	if n, err := strconv.Atoi(msg.headers["content-length"]); err == nil {
+		info.ContentSize = n
+	}
+	if msg.truncated() {
+		info.Truncated = true
+		return info
+	}
+	crl, err := x509.ParseRevocationList(msg.body)
+	if err != nil {
+		info.Truncated = true
+		return info
+	}
+	info.Issuer = crl.Issuer.String()
+	info.ThisUpdate = formatASN1Time(crl.ThisUpdate)
+	info.NextUpdate = formatASN1Time(crl.NextUpdate)
+	if crl.Number != nil {
+		info.Number = crl.Number.String()
+	}
+	info.Revoked = len(crl.RevokedCertificateEntries)
+	for i, e := range crl.RevokedCertificateEntries {
+		if i == 20 {
+			break
+		}
+		info.Serials = append(info.Serials, formatSerial(e.SerialNumber))
+	}
+	body := msg.body
+	info.issuerAt = spanOf(body, crl.RawIssuer)
+	// thisUpdate and the optional nextUpdate follow the issuer
+	kids := berElements(crl.RawTBSRevocationList)
+	for i, k := range kids {
+		if spanOf(body, k.Raw) != info.issuerAt || i+1 >= len(kids) {
+			continue
+		}
+		info.thisUpdateAt = spanOf(body, kids[i+1].Raw)
+		if i+2 < len(kids) && kids[i+2].Class == berUniversal && (kids[i+2].Tag == asn1.TagUTCTime || kids[i+2].Tag == asn1.TagGeneralizedTime) {
+			info.nextUpdateAt = spanOf(body, kids[i+2].Raw)
+		}
+		break
+	}
+	if n := len(info.Serials); n > 0 {
+		first := spanOf(body, crl.RevokedCertificateEntries[0].Raw)
+		last := spanOf(body, crl.RevokedCertificateEntries[n-1].Raw)
+		if first.n > 0 && last.n > 0 {
+			info.revAt = span{first.off, last.off + last.n - first.off}
+		}
+	}
+	return info
+}
+
+func hasExtension(exts []pkix.Extension, oid asn1.ObjectIdentifier) bool {
+	for _, e := range exts {
+		if e.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+func crlReasonName(r int) string {
+	if name, ok := crlReasonNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("reason %d", r)
+}
+
+// formatSerial renders a certificate serial the way browsers and openssl
+// show it: colon-separated upper-case hex.
+func formatSerial(n *big.Int) string {
+	b := n.Bytes()
+	if len(b) == 0 {
+		return "00"
+	}
+	parts := make([]string, len(b))
+	for i, v := range b {
+		parts[i] = fmt.Sprintf("%02X", v)
+	}
+	return strings.Join(parts, ":")
+}
+
+func formatASN1Time(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}
+
+// Summary returns a one-line description for the Info column.
+func (o *OCSPInfo) Summary() string {
+	if !o.Response {
+		if len(o.Certs) == 0 {
+			return "OCSP Request"
+		}
+		return "OCSP Request serial=" + o.Certs[0].Serial
+	}
+	if o.Truncated {
+		return "OCSP Response (partial)"
+	}
+	s := "OCSP Response " + o.ResponseStatus
+	if len(o.Certs) > 0 {
+		s += ": " + o.Certs[0].Status + " serial=" + o.Certs[0].Serial
+	}
+	return s
+}
+
+// Summary returns a one-line description for the Info column.
+func (c *CRLInfo) Summary() string {
+	if !c.Response {
+		return "CRL Request"
+	}
+	if c.Truncated {
+		return fmt.Sprintf("CRL (%d bytes, partial)", c.ContentSize)
+	}
+	return fmt.Sprintf("CRL %d revoked", c.Revoked)
+}
+
+// buildOCSPLayerDetail describes o; field offsets are relative to its DER
+// body.
+func buildOCSPLayerDetail(o *OCSPInfo) models.LayerDetail {
+	body := span{0, len(o.raw)}
+	fields := []models.LayerField{
+		body.field("Message", boolToStr(o.Response, "Response", "Request")),
+	}
+	if o.Truncated {
+		fields = append(fields, models.LayerField{Name: "Body", Value: "Spans multiple segments (not decoded)"})
+	}
+	if o.ResponseStatus != "" {
+		fields = append(fields, o.statusAt.field("Response Status", o.ResponseStatus))
+	}
+	if o.ProducedAt != "" {
+		fields = append(fields, o.producedAtAt.field("Produced At", o.ProducedAt))
+	}
+	if o.Nonce {
+		fields = append(fields, models.LayerField{Name: "Nonce", Value: "Present"})
+	}
+	for i, c := range o.Certs {
+		prefix := fmt.Sprintf("Cert %d ", i+1)
+		fields = append(fields,
+			c.serialAt.field(prefix+"Serial", c.Serial),
+			c.keyHashAt.field(prefix+"Issuer Key Hash", c.HashAlg+" "+c.IssuerKeyHash),
+		)
+		if c.Status != "" {
+			fields = append(fields, c.statusAt.field(prefix+"Status", c.Status))
+		}
+		if c.RevokedAt != "" {
+			fields = append(fields, c.statusAt.field(prefix+"Revoked At", c.RevokedAt+" ("+c.Reason+")"))
+		}
+		if c.ThisUpdate != "" {
+			fields = append(fields, c.thisUpdateAt.field(prefix+"This Update", c.ThisUpdate))
+		}
+		if c.NextUpdate != "" {
+			fields = append(fields, c.nextUpdateAt.field(prefix+"Next Update", c.NextUpdate))
+		}
+	}
+	return models.LayerDetail{Name: "OCSP", Fields: fields}
+}
+
+// buildCRLLayerDetail describes c; field offsets are relative to the
+// request, or to the DER body of a response.
+func buildCRLLayerDetail(c *CRLInfo) models.LayerDetail {
+	fields := []models.LayerField{
+		{Name: "Message", Value: boolToStr(c.Response, "CRL Download", "CRL Request")},
+	}
+	if c.URI != "" {
+		fields = append(fields, c.uriAt.field("URI", c.URI))
+	}
+	if c.Response {
+		fields = append(fields, span{0, len(c.raw)}.field("Size", fmt.Sprintf("%d bytes", c.ContentSize)))
+	}
+	if c.Truncated {
+		fields = append(fields, models.LayerField{Name: "Body", Value: "Spans multiple segments (not decoded)"})
+	}
+	if c.Issuer != "" {
+		fields = append(fields,
+			c.issuerAt.field("Issuer", c.Issuer),
+			c.thisUpdateAt.field("This Update", c.ThisUpdate),
+			c.nextUpdateAt.field("Next Update", c.NextUpdate),
+			models.LayerField{Name: "Revoked Certificates", Value: fmt.Sprintf("%d", c.Revoked)},
+		)
+		if c.Number != "" {
+			fields = append(fields, models.LayerField{Name: "CRL Number", Value: c.Number})
+		}
+		if len(c.Serials) > 0 {
+			v := strings.Join(c.Serials, ", ")
+			if c.Revoked > len(c.Serials) {
+				v += fmt.Sprintf(" (+%d more)", c.Revoked-len(c.Serials))
+			}
+			fields = append(fields, c.revAt.field("Revoked Serials", v))
+		}
+	}
+	return models.LayerDetail{Name: "CRL", Fields: fields}
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"bytes"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+)
+
+// minLocateLen is the shortest field value looked up by its text; shorter
+// ones match by chance too often.
+const minLocateLen = 3
+
+// layerStart returns where contents, a layer's bytes, begin in data, the
+// packet's bytes. gopacket slices layers out of the packet's buffer, so
+// the difference in capacity is the offset; ok is false if contents is
+// not part of data.
+func layerStart(data, contents []byte) (int, bool) {
+	off := cap(data) - cap(contents)
+	if len(contents) == 0 || off < 0 || off+len(contents) > len(data) ||
+		!bytes.Equal(data[off:off+len(contents)], contents) {
+		return 0, false
+	}
+	return off, true
+}
+
+// span is the byte range of a field relative to the data a dissector was
+// given. The zero span is a field with no bytes of its own.
+type span struct{ off, n int }
+
+// spanOf returns the span of sub, a slice of data, or the zero span if
+// sub is empty or not part of data.
+func spanOf(data, sub []byte) span {
+	off, ok := layerStart(data, sub)
+	if !ok {
+		return span{}
+	}
+	return span{off, len(sub)}
+}
+
+// shift returns s moved by off bytes; the zero span stays zero.
+func (s span) shift(off int) span {
+	if s.n == 0 {
+		return s
+	}
+	return span{s.off + off, s.n}
+}
+
+// field returns a field whose bytes are at s.
+func (s span) field(name, value string) models.LayerField {
+	return models.LayerField{Name: name, Value: value, Offset: s.off, Length: s.n}
+}
+
+// positionLayer sets the byte range of d, a layer n bytes long at start
+// in data, and turns its fields' offsets, which dissectors give relative
+// to the layer, into packet offsets. In a text layer, fields without an
+// offset whose value appears in the layer, such as HTTP or SIP headers,
+// are given the position of that text; binary dissectors give every
+// offset themselves.
+func positionLayer(d *models.LayerDetail, data []byte, start, n int) {
+	d.Offset, d.Length = start, n
+	cursor := start
+	positionFields(d.Fields, data, start, start+n, isText(data[start:start+n]), &cursor)
+}
+
+// placeLayer positions d, a layer decoded from contents, if contents is
+// part of data. Otherwise, as for a layer decoded from base64 or a
+// reassembled stream, its fields have no bytes to highlight.
+func placeLayer(d *models.LayerDetail, data, contents []byte) {
+	if start, ok := layerStart(data, contents); ok {
+		positionLayer(d, data, start, len(contents))
+	} else {
+		clearOffsets(d.Fields)
+	}
+}
+
+func clearOffsets(fields []models.LayerField) {
+	for i := range fields {
+		fields[i].Offset, fields[i].Length = 0, 0
+		clearOffsets(fields[i].Children)
+	}
+}
+
+// isText reports whether b looks like a text protocol: no control
+// characters but tabs and line breaks near its start.
+func isText(b []byte) bool {
+	for _, c := range b[:min(len(b), 256)] {
+		if (c < ' ' && c != '\t' && c != '\r' && c != '\n') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func positionFields(fields []models.LayerField, data []byte, start, end int, text bool, cursor *int) {
+	for i := range fields {
+		f := &fields[i]
+		if f.Length > 0 {
+			f.Offset += start
+			if f.Offset < 0 || f.Offset+f.Length > len(data) {
+				f.Offset, f.Length = 0, 0
+			}
+		} else if text && len(f.Value) >= minLocateLen {
+			// Fields mostly come in wire order: look after the previous
+			// one first
+			v := []byte(f.Value)
+			if j := bytes.Index(data[*cursor:end], v); j >= 0 {
+				f.Offset, f.Length = *cursor+j, len(v)
+			} else if j := bytes.Index(data[start:end], v); j >= 0 {
+				f.Offset, f.Length = start+j, len(v)
+			}
+			if f.Length > 0 {
+				*cursor = f.Offset + f.Length
+			}
+		}
+		positionFields(f.Children, data, start, end, text, cursor)
+	}
+}
+
+// Payload returns the bytes a packet carries above its transport layer, or
+// above the deepest layer decoded if it has none, and where they begin in
+// the packet's data. ok is false if the packet has no payload.
+func Payload(pkt gopacket.Packet) (payload []byte, offset int, ok bool) {
+	if al := pkt.ApplicationLayer(); al != nil {
+		payload = al.LayerContents()
+	} else if tl := pkt.TransportLayer(); tl != nil {
+		payload = tl.LayerPayload()
+	} else if ls := pkt.Layers(); len(ls) > 0 {
+		payload = ls[len(ls)-1].LayerPayload()
+	}
+	if len(payload) == 0 {
+		return nil, 0, false
+	}
+	offset, ok = layerStart(pkt.Data(), payload)
+	return payload, offset, ok
+}
@@ -10,9 +10,11 @@ import (
 	"sniffox/internal/models"
 )
 
-// Parse converts a raw gopacket.Packet into a PacketInfo.
-func Parse(pkt gopacket.Packet, number int, startTime time.Time) models.PacketInfo {
-	info := models.PacketInfo{
+// Parse converts a raw gopacket.Packet into a PacketInfo. A packet that
+// makes a dissector panic or goes over the limits in limits.go comes back
+// with Malformed set, its raw bytes and whatever was dissected before.
+func Parse(pkt gopacket.Packet, number int, startTime time.Time) (info models.PacketInfo) {
+	info = models.PacketInfo{
 		Number: number,
 		Length: pkt.Metadata().Length,
 	}
@@ -26,18 +28,29 @@ func Parse(pkt gopacket.Packet, number int, startTime time.Time) models.PacketIn
 		info.Timestamp = fmt.Sprintf("%.6f", elapsed.Seconds())
 	}
 
-	// Extract layers
-	info.Layers = extractLayers(pkt)
-
-	// Determine protocol, addresses, info summary
-	info.Protocol, info.SrcAddr, info.DstAddr, info.Info = summarize(pkt)
-
-	// Hex dump
+	// Hex dump, first so that it survives a dissector panic
 	if data := pkt.Data(); len(data) > 0 {
 		info.HexDump = formatHexDump(data)
 		info.RawHex = formatRawHex(data)
 	}
 
+	defer func() {
+		if r := recover(); r != nil {
+			MarkMalformed(&info, fmt.Sprintf("dissector panic: %v", r))
+		}
+	}()
+
+	// Extract layers
+	var malformed string
+	info.Layers, malformed = extractLayers(pkt, time.Now().Add(parseBudget))
+
+	// Determine protocol, addresses, info summary
+	info.Protocol, info.SrcAddr, info.DstAddr, info.InfoParts = summarize(pkt)
+	info.Info = RenderInfo(info.InfoParts)
+	if malformed != "" {
+		MarkMalformed(&info, malformed)
+	}
+
 	return info
 }
 
@@ -0,0 +1,642 @@
+package parser
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+// QUIC Initial packets are encrypted with keys derived from the client's
+// Destination Connection ID (RFC 9001 §5.2, RFC 9369 §3.3.1), so anyone
+// on the path can remove the protection and read the TLS ClientHello
+// carried in CRYPTO frames.
+
+const quicVersion2 = 0x6b3343cf
+
+var (
+	quicV1Salt = []byte{0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17, 0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a}
+	quicV2Salt = []byte{0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93, 0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9}
+)
+
+// QUICPacket is one long-header packet of a UDP datagram. Only client
+// Initial packets can be decrypted; for anything else Decrypted is false
+// and only the header fields are set.
+type QUICPacket struct {
+	Version      uint32
+	Type         string // Initial, 0-RTT, Handshake, Retry
+	DCID         []byte
+	SCID         []byte
+	TokenLen     int
+	Length       int // packet number + payload length
+	Decrypted    bool
+	PacketNumber uint64
+	Frames       []string // frame types in order, repeats collapsed
+	CryptoBytes  int      // CRYPTO frame bytes in this packet
+	ClientHello  *TLSClientHelloInfo
+	Partial      bool   // ClientHello continues in packets not seen yet
+	helloRecord  []byte // reassembled ClientHello wrapped in a TLS record
+
+	// Where the packet and its header fields are in the datagram
+	start, end             int
+	tokenLenAt, lengthAt   span
+	packetNumberAt, dataAt span
+}
+
+// quicLongHeader is the unprotected part of a long header.
+type quicLongHeader struct {
+	first    byte
+	version  uint32
+	dcid     []byte
+	scid     []byte
+	token    []byte
+	length   int
+	pnOffset int
+	end      int // offset of the next coalesced packet
+
+	tokenLenAt, lengthAt span
+}
+
+func quicVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, 0
+	}
+	v := uint64(b[0] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, n
+}
+
+func parseQUICLongHeader(data []byte) (*quicLongHeader, bool) {
+	if len(data) < 7 || data[0]&0x80 == 0 {
+		return nil, false
+	}
+	h := &quicLongHeader{first: data[0], version: binary.BigEndian.Uint32(data[1:5])}
+	pos := 5
+	dcidLen := int(data[pos])
+	pos++
+	if dcidLen > 20 || len(data) < pos+dcidLen+1 {
+		return nil, false
+	}
+	h.dcid = data[pos : pos+dcidLen]
+	pos += dcidLen
+	scidLen := int(data[pos])
+	pos++
+	if scidLen > 20 || len(data) < pos+scidLen {
+		return nil, false
+	}
+	h.scid = data[pos : pos+scidLen]
+	pos += scidLen
+
+	if h.packetType() == "Retry" || h.version == 0 {
+		h.end = len(data)
+		return h, true
+	}
+	if h.packetType() == "Initial" {
+		tokLen, n := quicVarint(data[pos:])
+		if n == 0 || uint64(len(data)-pos-n) < tokLen {
+			return nil, false
+		}
+		h.tokenLenAt = span{pos, n}
+		pos += n
+		h.token = data[pos : pos+int(tokLen)]
+		pos += int(tokLen)
+	}
+	length, n := quicVarint(data[pos:])
+	if n == 0 {
+		return nil, false
+	}
+	h.lengthAt = span{pos, n}
+	pos += n
+	h.length = int(length)
+	h.pnOffset = pos
+	h.end = min(pos+int(length), len(data))
+	return h, true
+}
+
+// packetType decodes the long packet type, whose encoding differs
+// between QUIC v1 and v2.
+func (h *quicLongHeader) packetType() string {
+	t := (h.first >> 4) & 0x03
+	if h.version == quicVersion2 {
+		t = (t + 3) & 0x03 // v2: Initial=1, 0-RTT=2, Handshake=3, Retry=0
+	}
+	return [...]string{"Initial", "0-RTT", "Handshake", "Retry"}[t]
+}
+
+func hkdfExtract(salt, ikm []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(ikm)
+	return mac.Sum(nil)
+}
+
+// hkdfExpandLabel implements TLS 1.3 HKDF-Expand-Label with an empty
+// context.
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	full := "tls13 " + label
+	info := make([]byte, 0, 4+len(full))
+	info = append(info, byte(length>>8), byte(length), byte(len(full)))
+	info = append(info, full...)
+	info = append(info, 0)
+
+	var out, prev []byte
+	for i := byte(1); len(out) < length; i++ {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(prev)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		prev = mac.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:length]
+}
+
+// quicClientInitialKeys derives the client Initial AEAD key, IV and header
+// protection key.
+func quicClientInitialKeys(version uint32, dcid []byte) (key, iv, hp []byte) {
+	salt, prefix := quicV1Salt, "quic "
+	if version == quicVersion2 {
+		salt, prefix = quicV2Salt, "quicv2 "
+	}
+	secret := hkdfExpandLabel(hkdfExtract(salt, dcid), "client in", 32)
+	return hkdfExpandLabel(secret, prefix+"key", 16),
+		hkdfExpandLabel(secret, prefix+"iv", 12),
+		hkdfExpandLabel(secret, prefix+"hp", 16)
+}
+
+// decryptQUICInitial removes header protection and decrypts a client
+// Initial packet, returning the packet number, its length and the
+// plaintext payload.
+func decryptQUICInitial(pkt []byte, h *quicLongHeader) (uint64, int, []byte, bool) {
+	if h.version != 1 && h.version != quicVersion2 {
+		return 0, 0, nil, false
+	}
+	// The header protection sample starts 4 bytes after the packet number
+	if h.end > len(pkt) || h.pnOffset+4+16 > h.end {
+		return 0, 0, nil, false
+	}
+	key, iv, hpKey := quicClientInitialKeys(h.version, h.dcid)
+
+	hpBlock, err := aes.NewCipher(hpKey)
+	if err != nil {
+		return 0, 0, nil, false
+	}
+	mask := make([]byte, 16)
+	hpBlock.Encrypt(mask, pkt[h.pnOffset+4:h.pnOffset+20])
+
+	header := make([]byte, h.pnOffset+4)
+	copy(header, pkt[:h.pnOffset+4])
+	header[0] ^= mask[0] & 0x0f
+	pnLen := int(header[0]&0x03) + 1
+	var pn uint64
+	for i := 0; i < pnLen; i++ {
+		header[h.pnOffset+i] ^= mask[1+i]
+		pn = pn<<8 | uint64(header[h.pnOffset+i])
+	}
+	header = header[:h.pnOffset+pnLen]
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return 0, 0, nil, false
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return 0, 0, nil, false
+	}
+	nonce := make([]byte, len(iv))
+	copy(nonce, iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	plain, err := aead.Open(nil, nonce, pkt[h.pnOffset+pnLen:h.end], header)
+	if err != nil {
+		return 0, 0, nil, false
+	}
+	return pn, pnLen, plain, true
+}
+
+var quicFrameNames = map[uint64]string{
+	0x00: "PADDING", 0x01: "PING", 0x02: "ACK", 0x03: "ACK", 0x06: "CRYPTO",
+	0x1c: "CONNECTION_CLOSE",
+}
+
+type quicCryptoFrag struct {
+	offset uint64
+	data   []byte
+}
+
+// parseQUICFrames walks the frames allowed in Initial packets. Parsing
+// stops at the first frame type that cannot appear there.
+func parseQUICFrames(b []byte) ([]string, []quicCryptoFrag) {
+	var names []string
+	var crypto []quicCryptoFrag
+	add := func(name string) {
+		if len(names) == 0 || names[len(names)-1] != name {
+			names = append(names, name)
+		}
+	}
+	for len(b) > 0 {
+		ft, n := quicVarint(b)
+		if n == 0 {
+			break
+		}
+		b = b[n:]
+		name, ok := quicFrameNames[ft]
+		if !ok {
+			add(fmt.Sprintf("0x%02x", ft))
+			break
+		}
+		add(name)
+		switch ft {
+		case 0x00, 0x01:
+		case 0x02, 0x03:
+			// Largest, delay, range count, first range, then ranges
+			vals := make([]uint64, 4)
+			for i := range vals {
+				if vals[i], n = quicVarint(b); n == 0 {
+					return names, crypto
+				}
+				b = b[n:]
+			}
+			skip := 2 * vals[2]
+			if ft == 0x03 {
+				skip += 3 // ECN counts
+			}
+			for i := uint64(0); i < skip; i++ {
+				if _, n = quicVarint(b); n == 0 {
+					return names, crypto
+				}
+				b = b[n:]
+			}
+		case 0x06:
+			off, n1 := quicVarint(b)
+			if n1 == 0 {
+				return names, crypto
+			}
+			l, n2 := quicVarint(b[n1:])
+			if n2 == 0 || uint64(len(b)-n1-n2) < l {
+				return names, crypto
+			}
+			crypto = append(crypto, quicCryptoFrag{offset: off, data: b[n1+n2 : n1+n2+int(l)]})
+			b = b[n1+n2+int(l):]
+		case 0x1c:
+			// Error code, frame type, reason phrase
+			for i := 0; i < 2; i++ {
+				if _, n = quicVarint(b); n == 0 {
+					return names, crypto
+				}
+				b = b[n:]
+			}
+			l, n := quicVarint(b)
+			if n == 0 || uint64(len(b)-n) < l {
+				return names, crypto
+			}
+			b = b[n+int(l):]
+		}
+	}
+	return names, crypto
+}
+
+// A ClientHello too large for one Initial (post-quantum key shares make
+// this common) arrives in several packets, so CRYPTO data is reassembled
+// per client DCID. The cache is small and bounded; it only has to span a
+// handshake.
+const (
+	quicCryptoConns = 256
+	quicCryptoMax   = 64 * 1024
+)
+
+// QUICCrypto reassembles the CRYPTO data of client Initials across the
+// packets of a capture.
+type QUICCrypto struct {
+	mu    sync.Mutex
+	conns map[string][]quicCryptoFrag
+	order []string
+}
+
+// NewQUICCrypto returns an empty reassembler.
+func NewQUICCrypto() *QUICCrypto {
+	return &QUICCrypto{conns: make(map[string][]quicCryptoFrag)}
+}
+
+// Reset forgets every handshake, for a new capture.
+func (c *QUICCrypto) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conns = make(map[string][]quicCryptoFrag)
+	c.order = nil
+}
+
+// add stores fragments for dcid and returns the contiguous CRYPTO stream
+// from offset 0. A nil c reassembles frags alone.
+func (c *QUICCrypto) add(dcid []byte, frags []quicCryptoFrag) []byte {
+	if c == nil {
+		return quicCryptoStream(frags)
+	}
+	key := string(dcid)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stored, ok := c.conns[key]
+	if !ok {
+		if len(c.order) >= quicCryptoConns {
+			delete(c.conns, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.order = append(c.order, key)
+	}
+	for _, f := range frags {
+		if f.offset+uint64(len(f.data)) > quicCryptoMax {
+			continue
+		}
+		dup := false
+		for _, s := range stored {
+			if s.offset == f.offset && len(s.data) == len(f.data) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			stored = append(stored, quicCryptoFrag{offset: f.offset, data: append([]byte(nil), f.data...)})
+		}
+	}
+	c.conns[key] = stored
+	return quicCryptoStream(stored)
+}
+
+// quicCryptoStream sorts frags by offset and returns the contiguous CRYPTO
+// stream they hold from offset 0.
+func quicCryptoStream(frags []quicCryptoFrag) []byte {
+	sort.Slice(frags, func(i, j int) bool { return frags[i].offset < frags[j].offset })
+	var out []byte
+	for _, s := range frags {
+		if s.offset > uint64(len(out)) {
+			break
+		}
+		if end := s.offset + uint64(len(s.data)); end > uint64(len(out)) {
+			out = append(out, s.data[uint64(len(out))-s.offset:]...)
+		}
+	}
+	return out
+}
+
+// ParseQUICDatagram decodes the coalesced long-header packets of a UDP
+// datagram, decrypting client Initials. Their CRYPTO data is added to
+// crypto, if not nil, to find ClientHellos spanning several datagrams.
+func ParseQUICDatagram(data []byte, crypto *QUICCrypto) []*QUICPacket {
+	var out []*QUICPacket
+	for start := 0; len(data) > 0; {
+		h, ok := parseQUICLongHeader(data)
+		if !ok {
+			break
+		}
+		p := &QUICPacket{
+			Version:    h.version,
+			Type:       h.packetType(),
+			DCID:       h.dcid,
+			SCID:       h.scid,
+			TokenLen:   len(h.token),
+			Length:     h.length,
+			start:      start,
+			end:        start + h.end,
+			tokenLenAt: h.tokenLenAt.shift(start),
+			lengthAt:   h.lengthAt.shift(start),
+		}
+		if h.pnOffset > 0 {
+			p.dataAt = span{start + h.pnOffset, h.end - h.pnOffset}
+		}
+		if h.version == 0 {
+			p.Type = "Version Negotiation"
+		}
+		if p.Type == "Initial" {
+			if pn, pnLen, plain, ok := decryptQUICInitial(data, h); ok {
+				p.Decrypted = true
+				p.PacketNumber = pn
+				p.packetNumberAt = span{start + h.pnOffset, pnLen}
+				p.dataAt = span{start + h.pnOffset + pnLen, h.end - h.pnOffset - pnLen}
+				var frags []quicCryptoFrag
+				p.Frames, frags = parseQUICFrames(plain)
+				for _, f := range frags {
+					p.CryptoBytes += len(f.data)
+				}
+				if len(frags) > 0 {
+					p.parseClientHello(crypto.add(h.dcid, frags))
+				}
+			}
+		}
+		out = append(out, p)
+		if h.end <= 0 || h.end >= len(data) {
+			break
+		}
+		data = data[h.end:]
+		start += h.end
+	}
+	return out
+}
+
+// quicPackets is the per-packet QUIC decode attached by AttachQUIC.
+type quicPackets []*QUICPacket
+
+// DecodeQUIC decodes the QUIC packets in pkt's datagram if it is sent to
+// or from UDP 443 or 853, or a port decoded as QUIC, adding the CRYPTO
+// data of client Initials to crypto. It returns nil for other packets.
+func DecodeQUIC(pkt gopacket.Packet, crypto *QUICCrypto) []*QUICPacket {
+	udp := pkt.Layer(layers.LayerTypeUDP)
+	if udp == nil {
+		return nil
+	}
+	if decodeAsFor(pkt) != "QUIC" && !portIsAny(pkt, 443, dnsPort853) {
+		return nil
+	}
+	if data := udp.LayerPayload(); isQUIC(data) {
+		return ParseQUICDatagram(data, crypto)
+	}
+	return nil
+}
+
+// AttachQUIC attaches the QUIC packets decoded from pkt's datagram, so
+// that Parse describes them without decrypting the Initials again.
+func AttachQUIC(pkt gopacket.Packet, pkts []*QUICPacket) {
+	if len(pkts) == 0 {
+		return
+	}
+	md := pkt.Metadata()
+	md.AncillaryData = append(md.AncillaryData, quicPackets(pkts))
+}
+
+// quicPacketsOf returns the QUIC packets attached to pkt, or decodes data,
+// its datagram, on its own when none are.
+func quicPacketsOf(pkt gopacket.Packet, data []byte) []*QUICPacket {
+	for _, a := range pkt.Metadata().AncillaryData {
+		if q, ok := a.(quicPackets); ok {
+			return q
+		}
+	}
+	return ParseQUICDatagram(data, nil)
+}
+
+func (p *QUICPacket) parseClientHello(stream []byte) {
+	if len(stream) < 4 || stream[0] != 0x01 {
+		return
+	}
+	hsLen := int(stream[1])<<16 | int(stream[2])<<8 | int(stream[3])
+	if len(stream) < 4+hsLen {
+		p.Partial = true
+		return
+	}
+	if hsLen+4 > 0xffff {
+		return
+	}
+	// parseTLSClientHello expects a TLS record around the handshake message
+	record := make([]byte, 0, 5+4+hsLen)
+	record = append(record, 0x16, 0x03, 0x01, byte((hsLen+4)>>8), byte(hsLen+4))
+	record = append(record, stream[:4+hsLen]...)
+	p.helloRecord = record
+	p.ClientHello = parseTLSClientHello(record)
+}
+
+// quicInitial returns the first decrypted client Initial in the datagram.
+func quicInitial(pkts []*QUICPacket) *QUICPacket {
+	for _, p := range pkts {
+		if p.Decrypted {
+			return p
+		}
+	}
+	return nil
+}
+
+func parseQUIC(data []byte, pkt gopacket.Packet) models.LayerDetail {
+	pkts := quicPacketsOf(pkt, data)
+	if len(pkts) == 0 {
+		return models.LayerDetail{Name: "QUIC", Fields: []models.LayerField{
+			{Name: "Header Form", Value: "Long Header", Offset: 0, Length: 1},
+		}}
+	}
+
+	var fields []models.LayerField
+	for i, p := range pkts {
+		dcidAt := span{p.start + 6, len(p.DCID)}
+		pf := []models.LayerField{
+			{Name: "Header Form", Value: "Long Header", Offset: p.start, Length: 1},
+			{Name: "Packet Type", Value: p.Type, Offset: p.start, Length: 1},
+			{Name: "Version", Value: quicVersionString(p.Version), Offset: p.start + 1, Length: 4},
+			{Name: "DCID Length", Value: fmt.Sprintf("%d", len(p.DCID)), Offset: p.start + 5, Length: 1},
+		}
+		if len(p.DCID) > 0 {
+			pf = append(pf, dcidAt.field("Destination CID", fmt.Sprintf("%x", p.DCID)))
+		}
+		if len(p.SCID) > 0 {
+			pf = append(pf, span{dcidAt.off + dcidAt.n + 1, len(p.SCID)}.field("Source CID", fmt.Sprintf("%x", p.SCID)))
+		}
+		if p.Type == "Initial" {
+			pf = append(pf, p.tokenLenAt.field("Token Length", fmt.Sprintf("%d", p.TokenLen)))
+		}
+		if p.Length > 0 {
+			pf = append(pf, p.lengthAt.field("Length", fmt.Sprintf("%d", p.Length)))
+		}
+		if p.Decrypted {
+			// Frames covers the ciphertext they were decrypted from
+			pf = append(pf,
+				p.packetNumberAt.field("Packet Number", fmt.Sprintf("%d", p.PacketNumber)),
+				p.dataAt.field("Frames", strings.Join(p.Frames, ", ")),
+			)
+			pf = append(pf, p.cryptoFields()...)
+		} else if p.Type == "Initial" {
+			pf = append(pf, p.dataAt.field("Payload", "Not decryptable (server Initial or unknown version)"))
+		}
+
+		if len(pkts) == 1 {
+			fields = pf
+			break
+		}
+		fields = append(fields, models.LayerField{
+			Name:     fmt.Sprintf("Packet %d", i+1),
+			Value:    p.Type,
+			Children: pf,
+			Offset:   p.start,
+			Length:   p.end - p.start,
+		})
+	}
+	return models.LayerDetail{Name: "QUIC", Fields: fields}
+}
+
+// cryptoFields describes the CRYPTO data and the ClientHello it carries.
+func (p *QUICPacket) cryptoFields() []models.LayerField {
+	if p.CryptoBytes == 0 {
+		return nil
+	}
+	crypto := models.LayerField{Name: "CRYPTO", Value: fmt.Sprintf("%d bytes", p.CryptoBytes)}
+	switch {
+	case p.ClientHello != nil:
+		crypto.Value += ", TLS Client Hello"
+		crypto.Children = buildTLSLayerDetail("Handshake (22)", tlsVersionString(p.ClientHello.Version), p.helloRecord).Fields[2:]
+		clearOffsets(crypto.Children)
+	case p.Partial:
+		crypto.Value += ", TLS Client Hello (continues in a later packet)"
+	}
+	fields := []models.LayerField{crypto}
+	if ch := p.ClientHello; ch != nil {
+		if ch.SNI != "" {
+			fields = append(fields, models.LayerField{Name: "SNI", Value: ch.SNI})
+		}
+		if len(ch.ALPN) > 0 {
+			fields = append(fields, models.LayerField{Name: "ALPN", Value: strings.Join(ch.ALPN, ", ")})
+		}
+		if ch.JA3Hash != "" {
+			fields = append(fields, models.LayerField{Name: "JA3 Fingerprint", Value: ch.JA3Hash})
+		}
+	}
+	return fields
+}
+
+// quicSummary returns the Info column for a QUIC datagram.
+func quicSummary(data []byte, pkt gopacket.Packet) string {
+	pkts := quicPacketsOf(pkt, data)
+	if len(pkts) == 0 {
+		return "QUIC Connection"
+	}
+	p := pkts[0]
+	if d := quicInitial(pkts); d != nil {
+		p = d
+	}
+	info := p.Type
+	if len(p.DCID) > 0 {
+		info += fmt.Sprintf(", DCID=%x", p.DCID)
+	}
+	switch {
+	case p.ClientHello != nil:
+		info += ", Client Hello"
+		if p.ClientHello.SNI != "" {
+			info += ", SNI=" + p.ClientHello.SNI
+		}
+		if len(p.ClientHello.ALPN) > 0 {
+			info += ", ALPN=" + strings.Join(p.ClientHello.ALPN, ",")
+		}
+		if p.ClientHello.JA3Hash != "" {
+			info += fmt.Sprintf(" [JA3:%s]", p.ClientHello.JA3Hash[:12])
+		}
+	case p.Partial:
+		info += ", Client Hello (partial)"
+	case p.Decrypted:
+		info += ", " + strings.Join(p.Frames, ", ")
+	}
+	if len(pkts) > 1 {
+		info += fmt.Sprintf(" (+%d coalesced)", len(pkts)-1)
+	}
+	return info
+}
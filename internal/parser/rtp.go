@@ -0,0 +1,375 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+// maxMediaEndpoints caps the RTP/RTCP endpoints learned from SDP.
+const maxMediaEndpoints = 8192
+
+// RTP and RTCP have no well-known ports: the endpoints are negotiated in
+// SDP, so the VoIP tracker registers them here as it sees offers and
+// answers, the way Wireshark sets up RTP conversations. A decode-as rule
+// covers streams whose signalling was not captured.
+var mediaEndpoints = struct {
+	sync.RWMutex
+	m map[string]string // "ip:port" → "RTP" or "RTCP"
+}{m: make(map[string]string)}
+
+// ExpectMedia registers addr as receiving RTP on rtpPort and RTCP on
+// rtcpPort, which may be the same port (rtcp-mux).
+func ExpectMedia(addr string, rtpPort, rtcpPort int) {
+	ip := net.ParseIP(addr)
+	if ip == nil || ip.IsUnspecified() || rtpPort <= 0 || rtpPort > 0xffff {
+		return
+	}
+	mediaEndpoints.Lock()
+	defer mediaEndpoints.Unlock()
+	if len(mediaEndpoints.m) >= maxMediaEndpoints {
+		return
+	}
+	mediaEndpoints.m[net.JoinHostPort(ip.String(), strconv.Itoa(rtpPort))] = "RTP"
+	if rtcpPort > 0 && rtcpPort <= 0xffff && rtcpPort != rtpPort {
+		mediaEndpoints.m[net.JoinHostPort(ip.String(), strconv.Itoa(rtcpPort))] = "RTCP"
+	}
+}
+
+// ForgetMedia clears the endpoints registered by ExpectMedia.
+func ForgetMedia() {
+	mediaEndpoints.Lock()
+	defer mediaEndpoints.Unlock()
+	mediaEndpoints.m = make(map[string]string)
+}
+
+// RTPHeader is the fixed header of an RTP packet (RFC 3550 section 5.1).
+type RTPHeader struct {
+	Version     int
+	Padding     bool
+	Extension   bool
+	Marker      bool
+	CSRCCount   int
+	PayloadType int
+	Sequence    uint16
+	Timestamp   uint32
+	SSRC        uint32
+	PayloadLen  int
+	headerLen   int // where the payload starts
+}
+
+// RTCPPacket is one packet of a compound RTCP packet.
+type RTCPPacket struct {
+	Type    int
+	SSRC    uint32 // of the sender
+	Reports []RTCPReport
+	CNAME   string // SDES
+	// Sender reports only
+	SenderPackets uint32
+	SenderOctets  uint32
+
+	at      span // the whole packet, in the compound packet
+	cnameAt span
+}
+
+// RTCPReport is a reception report block about one source.
+type RTCPReport struct {
+	SSRC           uint32
+	FractionLost   float64 // since the previous report, 0-1
+	CumulativeLost int
+	HighestSeq     uint32
+	Jitter         uint32 // in RTP timestamp units
+	at             span
+}
+
+// MediaPacket is an RTP or RTCP packet and the UDP endpoints it travels
+// between.
+type MediaPacket struct {
+	Src  string // ip:port
+	Dst  string
+	RTP  *RTPHeader
+	RTCP []RTCPPacket
+}
+
+var rtcpTypeNames = map[int]string{
+	200: "Sender Report",
+	201: "Receiver Report",
+	202: "Source Description",
+	203: "Goodbye",
+	204: "Application-defined",
+	205: "Transport Feedback",
+	206: "Payload-specific Feedback",
+	207: "Extended Report",
+}
+
+// staticRTPCodecs are the RTP/AVP static payload types (RFC 3551).
+var staticRTPCodecs = map[int]RTPCodec{
+	0:  {"PCMU", 8000},
+	3:  {"GSM", 8000},
+	4:  {"G723", 8000},
+	5:  {"DVI4", 8000},
+	6:  {"DVI4", 16000},
+	7:  {"LPC", 8000},
+	8:  {"PCMA", 8000},
+	9:  {"G722", 8000},
+	10: {"L16", 44100},
+	11: {"L16", 44100},
+	12: {"QCELP", 8000},
+	13: {"CN", 8000},
+	14: {"MPA", 90000},
+	15: {"G728", 8000},
+	16: {"DVI4", 11025},
+	17: {"DVI4", 22050},
+	18: {"G729", 8000},
+	25: {"CelB", 90000},
+	26: {"JPEG", 90000},
+	28: {"nv", 90000},
+	31: {"H261", 90000},
+	32: {"MPV", 90000},
+	33: {"MP2T", 90000},
+	34: {"H263", 90000},
+}
+
+// StaticRTPCodec returns the codec of a static payload type.
+func StaticRTPCodec(pt int) (RTPCodec, bool) {
+	c, ok := staticRTPCodecs[pt]
+	return c, ok
+}
+
+// mediaKind returns "RTP" or "RTCP" for a UDP packet to or from a
+// registered media endpoint or on a port decoded as either, or "".
+// Multiplexed RTCP is told from RTP by its packet type.
+func mediaKind(pkt gopacket.Packet, data []byte) string {
+	l := pkt.Layer(layers.LayerTypeUDP)
+	if l == nil {
+		return ""
+	}
+	kind := decodeAsFor(pkt)
+	if kind != "RTP" && kind != "RTCP" {
+		kind = ""
+		t := ExtractFlowTuple(pkt)
+		mediaEndpoints.RLock()
+		if len(mediaEndpoints.m) > 0 && t.Valid {
+			kind = mediaEndpoints.m[net.JoinHostPort(t.DstIP, strconv.Itoa(int(t.DstPort)))]
+			if kind == "" {
+				kind = mediaEndpoints.m[net.JoinHostPort(t.SrcIP, strconv.Itoa(int(t.SrcPort)))]
+			}
+		}
+		mediaEndpoints.RUnlock()
+	}
+	switch {
+	case kind == "":
+		return ""
+	case isRTCP(data):
+		return "RTCP"
+	case kind == "RTP":
+		if _, ok := parseRTPHeader(data); ok {
+			return "RTP"
+		}
+	}
+	return ""
+}
+
+// ExtractMedia returns the RTP or RTCP packet carried by pkt, or nil.
+func ExtractMedia(pkt gopacket.Packet) *MediaPacket {
+	data := transportPayload(pkt)
+	kind := mediaKind(pkt, data)
+	if kind == "" {
+		return nil
+	}
+	t := ExtractFlowTuple(pkt)
+	m := &MediaPacket{
+		Src: net.JoinHostPort(t.SrcIP, strconv.Itoa(int(t.SrcPort))),
+		Dst: net.JoinHostPort(t.DstIP, strconv.Itoa(int(t.DstPort))),
+	}
+	if kind == "RTCP" {
+		m.RTCP, _ = parseRTCP(data)
+	} else {
+		h, _ := parseRTPHeader(data)
+		m.RTP = &h
+	}
+	return m
+}
+
+func parseRTPHeader(data []byte) (RTPHeader, bool) {
+	if len(data) < 12 || data[0]>>6 != 2 {
+		return RTPHeader{}, false
+	}
+	h := RTPHeader{
+		Version:     2,
+		Padding:     data[0]&0x20 != 0,
+		Extension:   data[0]&0x10 != 0,
+		CSRCCount:   int(data[0] & 0x0f),
+		Marker:      data[1]&0x80 != 0,
+		PayloadType: int(data[1] & 0x7f),
+		Sequence:    binary.BigEndian.Uint16(data[2:4]),
+		Timestamp:   binary.BigEndian.Uint32(data[4:8]),
+		SSRC:        binary.BigEndian.Uint32(data[8:12]),
+	}
+	n := 12 + 4*h.CSRCCount
+	if h.Extension {
+		if len(data) < n+4 {
+			return RTPHeader{}, false
+		}
+		n += 4 + 4*int(binary.BigEndian.Uint16(data[n+2:n+4]))
+	}
+	end := len(data)
+	if h.Padding && end > 0 {
+		end -= int(data[end-1])
+	}
+	if n > end {
+		return RTPHeader{}, false
+	}
+	h.PayloadLen = end - n
+	h.headerLen = n
+	return h, true
+}
+
+// isRTCP checks that data is a well-formed compound RTCP packet.
+func isRTCP(data []byte) bool {
+	pkts, ok := parseRTCP(data)
+	return ok && len(pkts) > 0
+}
+
+func parseRTCP(data []byte) ([]RTCPPacket, bool) {
+	var out []RTCPPacket
+	for off := 0; len(data) > 0; {
+		if len(data) < 8 || data[0]>>6 != 2 {
+			return nil, false
+		}
+		typ := int(data[1])
+		if _, ok := rtcpTypeNames[typ]; !ok {
+			return nil, false
+		}
+		n := (int(binary.BigEndian.Uint16(data[2:4])) + 1) * 4
+		if n > len(data) {
+			return nil, false
+		}
+		body, count := data[4:n], int(data[0]&0x1f)
+		p := RTCPPacket{Type: typ, SSRC: binary.BigEndian.Uint32(body[:4]), at: span{off, n}}
+		blocks := body[4:]
+		switch typ {
+		case 200:
+			if len(blocks) < 20 {
+				return nil, false
+			}
+			p.SenderPackets = binary.BigEndian.Uint32(blocks[12:16])
+			p.SenderOctets = binary.BigEndian.Uint32(blocks[16:20])
+			blocks = blocks[20:]
+			fallthrough
+		case 201:
+			for i := 0; i < count && len(blocks) >= 24; i++ {
+				b := blocks[:24]
+				lost := int(b[5])<<16 | int(b[6])<<8 | int(b[7])
+				if lost&0x800000 != 0 {
+					lost -= 1 << 24
+				}
+				p.Reports = append(p.Reports, RTCPReport{
+					SSRC:           binary.BigEndian.Uint32(b[0:4]),
+					FractionLost:   float64(b[4]) / 256,
+					CumulativeLost: lost,
+					HighestSeq:     binary.BigEndian.Uint32(b[8:12]),
+					Jitter:         binary.BigEndian.Uint32(b[12:16]),
+					at:             span{off + n - len(blocks), 24},
+				})
+				blocks = blocks[24:]
+			}
+		case 202:
+			// First chunk: SSRC then items (type, length, text) up to a
+			// null item
+			for len(blocks) >= 2 && blocks[0] != 0 {
+				l := int(blocks[1])
+				if len(blocks) < 2+l {
+					break
+				}
+				if blocks[0] == 1 {
+					p.CNAME = string(blocks[2 : 2+l])
+					p.cnameAt = span{off + n - len(blocks) + 2, l}
+					break
+				}
+				blocks = blocks[2+l:]
+			}
+		}
+		out = append(out, p)
+		data, off = data[n:], off+n
+	}
+	return out, true
+}
+
+func rtpPayloadTypeString(pt int) string {
+	if c, ok := staticRTPCodecs[pt]; ok {
+		return fmt.Sprintf("%s (%d)", c.Name, pt)
+	}
+	if pt >= 96 {
+		return fmt.Sprintf("Dynamic (%d)", pt)
+	}
+	return strconv.Itoa(pt)
+}
+
+func rtpSummary(h RTPHeader) string {
+	pt := strconv.Itoa(h.PayloadType)
+	if c, ok := staticRTPCodecs[h.PayloadType]; ok {
+		pt = c.Name
+	}
+	s := fmt.Sprintf("PT=%s, SSRC=0x%08X, Seq=%d, Time=%d", pt, h.SSRC, h.Sequence, h.Timestamp)
+	if h.Marker {
+		s += ", Mark"
+	}
+	return s
+}
+
+func rtcpSummary(pkts []RTCPPacket) string {
+	names := make([]string, len(pkts))
+	for i, p := range pkts {
+		names[i] = rtcpTypeNames[p.Type]
+	}
+	return strings.Join(names, ", ")
+}
+
+func buildRTPLayerDetail(h RTPHeader) models.LayerDetail {
+	fields := []models.LayerField{
+		{Name: "Version", Value: strconv.Itoa(h.Version), Offset: 0, Length: 1},
+		{Name: "Padding", Value: boolToStr(h.Padding, "Yes", "No"), Offset: 0, Length: 1},
+		{Name: "Extension", Value: boolToStr(h.Extension, "Yes", "No"), Offset: 0, Length: 1},
+		{Name: "CSRC Count", Value: strconv.Itoa(h.CSRCCount), Offset: 0, Length: 1},
+		{Name: "Marker", Value: boolToStr(h.Marker, "Yes", "No"), Offset: 1, Length: 1},
+		{Name: "Payload Type", Value: rtpPayloadTypeString(h.PayloadType), Offset: 1, Length: 1},
+		{Name: "Sequence Number", Value: strconv.Itoa(int(h.Sequence)), Offset: 2, Length: 2},
+		{Name: "Timestamp", Value: strconv.FormatUint(uint64(h.Timestamp), 10), Offset: 4, Length: 4},
+		{Name: "SSRC", Value: fmt.Sprintf("0x%08X", h.SSRC), Offset: 8, Length: 4},
+		{Name: "Payload Length", Value: strconv.Itoa(h.PayloadLen), Offset: h.headerLen, Length: h.PayloadLen},
+	}
+	return models.LayerDetail{Name: "RTP", Fields: fields}
+}
+
+func buildRTCPLayerDetail(pkts []RTCPPacket) models.LayerDetail {
+	var fields []models.LayerField
+	for _, p := range pkts {
+		f := p.at.field(rtcpTypeNames[p.Type], fmt.Sprintf("SSRC 0x%08X", p.SSRC))
+		if p.Type == 200 {
+			// The sender info follows the SSRC: NTP and RTP timestamps,
+			// then the counts
+			f.Children = append(f.Children,
+				span{p.at.off + 20, 4}.field("Sender's Packet Count", strconv.FormatUint(uint64(p.SenderPackets), 10)),
+				span{p.at.off + 24, 4}.field("Sender's Octet Count", strconv.FormatUint(uint64(p.SenderOctets), 10)))
+		}
+		for _, r := range p.Reports {
+			f.Children = append(f.Children, r.at.field("Report Block",
+				fmt.Sprintf("SSRC 0x%08X: lost %.1f%% (%d cumulative), jitter %d, highest seq %d",
+					r.SSRC, r.FractionLost*100, r.CumulativeLost, r.Jitter, r.HighestSeq)))
+		}
+		if p.CNAME != "" {
+			f.Children = append(f.Children, p.cnameAt.field("CNAME", p.CNAME))
+		}
+		fields = append(fields, f)
+	}
+	return models.LayerDetail{Name: "RTCP", Fields: fields}
+}
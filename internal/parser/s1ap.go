@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"sniffox/internal/models"
+)
+
+var s1apProcedures = map[uint8]string{
+	0:  "HandoverPreparation",
+	1:  "HandoverResourceAllocation",
+	2:  "HandoverNotification",
+	3:  "PathSwitchRequest",
+	4:  "HandoverCancel",
+	5:  "E-RABSetup",
+	6:  "E-RABModify",
+	7:  "E-RABRelease",
+	8:  "E-RABReleaseIndication",
+	9:  "InitialContextSetup",
+	10: "Paging",
+	11: "DownlinkNASTransport",
+	12: "InitialUEMessage",
+	13: "UplinkNASTransport",
+	14: "Reset",
+	15: "ErrorIndication",
+	16: "NASNonDeliveryIndication",
+	17: "S1Setup",
+	18: "UEContextReleaseRequest",
+	19: "DownlinkS1cdma2000tunnelling",
+	20: "UplinkS1cdma2000tunnelling",
+	21: "UEContextModification",
+	22: "UECapabilityInfoIndication",
+	23: "UEContextRelease",
+	24: "eNBStatusTransfer",
+	25: "MMEStatusTransfer",
+	26: "DeactivateTrace",
+	27: "TraceStart",
+	28: "TraceFailureIndication",
+	29: "ENBConfigurationUpdate",
+	30: "MMEConfigurationUpdate",
+	31: "LocationReportingControl",
+	32: "LocationReportingFailureIndication",
+	33: "LocationReport",
+	34: "OverloadStart",
+	35: "OverloadStop",
+	36: "WriteReplaceWarning",
+	37: "eNBDirectInformationTransfer",
+	38: "MMEDirectInformationTransfer",
+	39: "PrivateMessage",
+	40: "eNBConfigurationTransfer",
+	41: "MMEConfigurationTransfer",
+	42: "CellTrafficTrace",
+	43: "Kill",
+}
+
+var s1apIEs = map[uint16]string{
+	0:   "MME-UE-S1AP-ID",
+	2:   "Cause",
+	8:   "eNB-UE-S1AP-ID",
+	26:  "NAS-PDU",
+	59:  "Global-ENB-ID",
+	60:  "eNBname",
+	61:  "MMEname",
+	64:  "SupportedTAs",
+	67:  "TAI",
+	100: "EUTRAN-CGI",
+	134: "RRC-Establishment-Cause",
+}
+
+var apPDUTypes = []string{"initiatingMessage", "successfulOutcome", "unsuccessfulOutcome"}
+
+var apCriticality = []string{"reject", "ignore", "notify"}
+
+// apIE is one protocol IE of an S1AP or NGAP message.
+type apIE struct {
+	ID          uint16
+	Criticality string
+	Length      int
+	at          span // the whole IE, in the PDU
+}
+
+// apPDU is the top level of an S1AP or NGAP message: both are ASN.1 PER
+// (aligned) PDUs with the same structure, a procedure code and a list of
+// protocol IEs. The IE values are not decoded.
+type apPDU struct {
+	Type        string
+	Procedure   uint8
+	Name        string // procedure name, when known
+	Criticality string
+	IEs         []apIE
+}
+
+// Summary is a one-line description, e.g. "S1Setup (initiatingMessage)".
+func (m *apPDU) Summary() string {
+	name := m.Name
+	if name == "" {
+		name = fmt.Sprintf("Procedure %d", m.Procedure)
+	}
+	return name + " (" + m.Type + ")"
+}
+
+// perLength reads an aligned PER length determinant.
+func perLength(b []byte) (n, size int, ok bool) {
+	if len(b) < 1 {
+		return 0, 0, false
+	}
+	switch {
+	case b[0]&0x80 == 0:
+		return int(b[0]), 1, true
+	case b[0]&0xc0 == 0x80 && len(b) >= 2:
+		return int(binary.BigEndian.Uint16(b) & 0x3fff), 2, true
+	}
+	return 0, 0, false // fragmented encodings are not handled
+}
+
+// parseAPPDU decodes the top level of an S1AP or NGAP PDU, naming the
+// procedure from names. Returns nil if data does not look like one.
+func parseAPPDU(data []byte, names map[uint8]string) *apPDU {
+	if len(data) < 4 || data[0]&0x80 != 0 {
+		return nil
+	}
+	choice := int(data[0]>>5) & 0x3
+	crit := int(data[2] >> 6)
+	if choice >= len(apPDUTypes) || crit >= len(apCriticality) || data[0]&0x1f != 0 || data[2]&0x3f != 0 {
+		return nil
+	}
+	m := &apPDU{
+		Type:        apPDUTypes[choice],
+		Procedure:   data[1],
+		Name:        names[data[1]],
+		Criticality: apCriticality[crit],
+	}
+	n, size, ok := perLength(data[3:])
+	if !ok || 3+size+n > len(data) {
+		return nil
+	}
+	value := data[3+size : 3+size+n]
+
+	// SEQUENCE { protocolIEs, ... }: extension bit, then a 16-bit IE count
+	if len(value) < 3 {
+		return m
+	}
+	count := int(binary.BigEndian.Uint16(value[1:3]))
+	b, at := value[3:], 3+size+3
+	for i := 0; i < count && len(b) >= 4; i++ {
+		ie := apIE{ID: binary.BigEndian.Uint16(b), Criticality: "?"}
+		if c := int(b[2] >> 6); c < len(apCriticality) {
+			ie.Criticality = apCriticality[c]
+		}
+		l, size, ok := perLength(b[3:])
+		if !ok || 3+size+l > len(b) {
+			break
+		}
+		ie.Length = l
+		ie.at = span{at, 3 + size + l}
+		m.IEs = append(m.IEs, ie)
+		b = b[3+size+l:]
+		at += 3 + size + l
+	}
+	return m
+}
+
+func buildAPLayerDetail(proto string, m *apPDU, ieNames map[uint16]string) models.LayerDetail {
+	fields := []models.LayerField{
+		{Name: "PDU", Value: m.Type, Offset: 0, Length: 1},
+		{Name: "Procedure Code", Value: fmt.Sprintf("%d", m.Procedure), Offset: 1, Length: 1},
+		{Name: "Criticality", Value: m.Criticality, Offset: 2, Length: 1},
+	}
+	if m.Name != "" {
+		fields = append(fields, models.LayerField{Name: "Procedure", Value: m.Name, Offset: 1, Length: 1})
+	}
+	for _, ie := range m.IEs {
+		name := ieNames[ie.ID]
+		if name == "" {
+			name = fmt.Sprintf("IE %d", ie.ID)
+		}
+		fields = append(fields, ie.at.field("Protocol IE", fmt.Sprintf("%s (id %d, %s, %d bytes)", name, ie.ID, ie.Criticality, ie.Length)))
+	}
+	return models.LayerDetail{Name: proto, Fields: fields}
+}
@@ -0,0 +1,326 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+var sctpChunkNames = map[uint8]string{
+	0:   "DATA",
+	1:   "INIT",
+	2:   "INIT_ACK",
+	3:   "SACK",
+	4:   "HEARTBEAT",
+	5:   "HEARTBEAT_ACK",
+	6:   "ABORT",
+	7:   "SHUTDOWN",
+	8:   "SHUTDOWN_ACK",
+	9:   "ERROR",
+	10:  "COOKIE_ECHO",
+	11:  "COOKIE_ACK",
+	14:  "SHUTDOWN_COMPLETE",
+	15:  "AUTH",
+	64:  "I_DATA",
+	128: "ASCONF_ACK",
+	130: "RE_CONFIG",
+	132: "PAD",
+	192: "FORWARD_TSN",
+	193: "ASCONF",
+}
+
+// SCTP payload protocol identifiers (IANA)
+const (
+	ppidM3UA         = 3
+	ppidS1AP         = 18
+	ppidX2AP         = 27
+	ppidDiameter     = 46
+	ppidDiameterDTLS = 47
+	ppidNGAP         = 60
+)
+
+var sctpPPIDNames = map[uint32]string{
+	0:                "Unspecified",
+	ppidM3UA:         "M3UA",
+	ppidS1AP:         "S1AP",
+	ppidX2AP:         "X2AP",
+	ppidDiameter:     "Diameter",
+	ppidDiameterDTLS: "Diameter (DTLS)",
+	50:               "WebRTC DCEP",
+	51:               "WebRTC String",
+	53:               "WebRTC Binary",
+	ppidNGAP:         "NGAP",
+}
+
+// Well-known SCTP ports of the payloads dissected here, for peers that
+// leave the PPID unspecified.
+const (
+	sctpPortDiameter = 3868
+	sctpPortS1AP     = 36412
+	sctpPortNGAP     = 38412
+)
+
+// sctpChunk is one chunk of an SCTP packet.
+type sctpChunk struct {
+	Type  uint8
+	Flags uint8
+	Value []byte // without the 4-byte chunk header and padding
+	at    int    // offset of the chunk header in the data parsed
+}
+
+// sctpDataChunk is the header of a DATA chunk and its user data.
+type sctpDataChunk struct {
+	TSN       uint32
+	StreamID  uint16
+	StreamSeq uint16
+	PPID      uint32
+	Unordered bool
+	Begin     bool
+	End       bool
+	Payload   []byte
+}
+
+// parseSCTPChunks splits the chunks following the SCTP common header.
+func parseSCTPChunks(data []byte) []sctpChunk {
+	var chunks []sctpChunk
+	for at := 0; len(data) >= 4; {
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if length < 4 || length > len(data) {
+			break
+		}
+		chunks = append(chunks, sctpChunk{Type: data[0], Flags: data[1], Value: data[4:length], at: at})
+		padded := (length + 3) &^ 3
+		if padded >= len(data) {
+			break
+		}
+		data = data[padded:]
+		at += padded
+	}
+	return chunks
+}
+
+func (c sctpChunk) name() string {
+	if n, ok := sctpChunkNames[c.Type]; ok {
+		return n
+	}
+	return fmt.Sprintf("Unknown (%d)", c.Type)
+}
+
+// data decodes a DATA chunk.
+func (c sctpChunk) data() (sctpDataChunk, bool) {
+	if c.Type != 0 || len(c.Value) < 12 {
+		return sctpDataChunk{}, false
+	}
+	v := c.Value
+	return sctpDataChunk{
+		TSN:       binary.BigEndian.Uint32(v[0:4]),
+		StreamID:  binary.BigEndian.Uint16(v[4:6]),
+		StreamSeq: binary.BigEndian.Uint16(v[6:8]),
+		PPID:      binary.BigEndian.Uint32(v[8:12]),
+		Unordered: c.Flags&0x4 != 0,
+		Begin:     c.Flags&0x2 != 0,
+		End:       c.Flags&0x1 != 0,
+		Payload:   v[12:],
+	}, true
+}
+
+func sctpPPIDString(ppid uint32) string {
+	if n, ok := sctpPPIDNames[ppid]; ok {
+		return fmt.Sprintf("%s (%d)", n, ppid)
+	}
+	return fmt.Sprintf("%d", ppid)
+}
+
+// sctpChunkFields describes one chunk for the SCTP layer detail. Offsets
+// are relative to base, where the chunks begin.
+func sctpChunkFields(c sctpChunk, base int) []models.LayerField {
+	h := base + c.at // chunk header
+	fields := []models.LayerField{
+		{Name: "Flags", Value: fmt.Sprintf("0x%02x", c.Flags), Offset: h + 1, Length: 1},
+		{Name: "Length", Value: fmt.Sprintf("%d", len(c.Value)+4), Offset: h + 2, Length: 2},
+	}
+	v, o := c.Value, h+4
+	switch c.Type {
+	case 0:
+		d, ok := c.data()
+		if !ok {
+			break
+		}
+		fields = append(fields,
+			models.LayerField{Name: "TSN", Value: fmt.Sprintf("%d", d.TSN), Offset: o, Length: 4},
+			models.LayerField{Name: "Stream ID", Value: fmt.Sprintf("%d", d.StreamID), Offset: o + 4, Length: 2},
+			models.LayerField{Name: "Stream Sequence", Value: fmt.Sprintf("%d", d.StreamSeq), Offset: o + 6, Length: 2},
+			models.LayerField{Name: "Payload Protocol", Value: sctpPPIDString(d.PPID), Offset: o + 8, Length: 4},
+			models.LayerField{Name: "Fragment", Value: sctpFragment(d), Offset: h + 1, Length: 1},
+			models.LayerField{Name: "User Data", Value: fmt.Sprintf("%d bytes", len(d.Payload)), Offset: o + 12, Length: len(d.Payload)},
+		)
+		if d.Unordered {
+			fields = append(fields, models.LayerField{Name: "Unordered", Value: "Yes", Offset: h + 1, Length: 1})
+		}
+	case 1, 2: // INIT, INIT_ACK
+		if len(v) < 16 {
+			break
+		}
+		fields = append(fields,
+			models.LayerField{Name: "Initiate Tag", Value: fmt.Sprintf("0x%08x", binary.BigEndian.Uint32(v[0:4])), Offset: o, Length: 4},
+			models.LayerField{Name: "Receiver Window", Value: fmt.Sprintf("%d", binary.BigEndian.Uint32(v[4:8])), Offset: o + 4, Length: 4},
+			models.LayerField{Name: "Outbound Streams", Value: fmt.Sprintf("%d", binary.BigEndian.Uint16(v[8:10])), Offset: o + 8, Length: 2},
+			models.LayerField{Name: "Inbound Streams", Value: fmt.Sprintf("%d", binary.BigEndian.Uint16(v[10:12])), Offset: o + 10, Length: 2},
+			models.LayerField{Name: "Initial TSN", Value: fmt.Sprintf("%d", binary.BigEndian.Uint32(v[12:16])), Offset: o + 12, Length: 4},
+		)
+	case 3: // SACK
+		if len(v) < 12 {
+			break
+		}
+		gaps := binary.BigEndian.Uint16(v[8:10])
+		dups := binary.BigEndian.Uint16(v[10:12])
+		fields = append(fields,
+			models.LayerField{Name: "Cumulative TSN Ack", Value: fmt.Sprintf("%d", binary.BigEndian.Uint32(v[0:4])), Offset: o, Length: 4},
+			models.LayerField{Name: "Receiver Window", Value: fmt.Sprintf("%d", binary.BigEndian.Uint32(v[4:8])), Offset: o + 4, Length: 4},
+			models.LayerField{Name: "Gap Blocks", Value: fmt.Sprintf("%d", gaps), Offset: o + 8, Length: 2},
+			models.LayerField{Name: "Duplicate TSNs", Value: fmt.Sprintf("%d", dups), Offset: o + 10, Length: 2},
+		)
+		for i, off := 0, 12; i < int(gaps) && off+4 <= len(v); i, off = i+1, off+4 {
+			fields = append(fields, models.LayerField{
+				Name:   "Gap Block",
+				Value:  fmt.Sprintf("%d-%d", binary.BigEndian.Uint16(v[off:]), binary.BigEndian.Uint16(v[off+2:])),
+				Offset: o + off,
+				Length: 4,
+			})
+		}
+	case 4, 5: // HEARTBEAT, HEARTBEAT_ACK carry an opaque info parameter
+		if len(v) >= 4 {
+			fields = append(fields, models.LayerField{Name: "Heartbeat Info", Value: fmt.Sprintf("%d bytes", int(binary.BigEndian.Uint16(v[2:4]))-4), Offset: o, Length: len(v)})
+		}
+	case 7: // SHUTDOWN
+		if len(v) >= 4 {
+			fields = append(fields, models.LayerField{Name: "Cumulative TSN Ack", Value: fmt.Sprintf("%d", binary.BigEndian.Uint32(v)), Offset: o, Length: 4})
+		}
+	case 6, 9: // ABORT, ERROR
+		if len(v) >= 2 {
+			fields = append(fields, models.LayerField{Name: "Cause Code", Value: fmt.Sprintf("%d", binary.BigEndian.Uint16(v)), Offset: o, Length: 2})
+		}
+	}
+	return fields
+}
+
+func sctpFragment(d sctpDataChunk) string {
+	switch {
+	case d.Begin && d.End:
+		return "Complete"
+	case d.Begin:
+		return "First"
+	case d.End:
+		return "Last"
+	}
+	return "Middle"
+}
+
+// sctpMessages returns the complete (unfragmented) user messages of the
+// DATA chunks in pkt.
+func sctpMessages(pkt gopacket.Packet) (*layers.SCTP, []sctpDataChunk) {
+	l := pkt.Layer(layers.LayerTypeSCTP)
+	if l == nil {
+		return nil, nil
+	}
+	sctp := l.(*layers.SCTP)
+	var msgs []sctpDataChunk
+	for _, c := range parseSCTPChunks(sctp.LayerPayload()) {
+		if d, ok := c.data(); ok && d.Begin && d.End {
+			msgs = append(msgs, d)
+		}
+	}
+	return sctp, msgs
+}
+
+// sctpPayloadProto picks the dissector for a DATA chunk from its PPID, or
+// from the port when the PPID is unspecified.
+func sctpPayloadProto(sctp *layers.SCTP, ppid uint32) uint32 {
+	switch ppid {
+	case ppidDiameter, ppidDiameterDTLS:
+		return ppidDiameter
+	case ppidS1AP, ppidNGAP:
+		return ppid
+	case 0:
+		port := func(p uint16) bool { return uint16(sctp.SrcPort) == p || uint16(sctp.DstPort) == p }
+		switch {
+		case port(sctpPortDiameter):
+			return ppidDiameter
+		case port(sctpPortS1AP):
+			return ppidS1AP
+		case port(sctpPortNGAP):
+			return ppidNGAP
+		}
+	}
+	return 0
+}
+
+// sctpPayloadLayers dissects Diameter, S1AP and NGAP messages carried in
+// the packet's DATA chunks.
+func sctpPayloadLayers(pkt gopacket.Packet) []models.LayerDetail {
+	sctp, msgs := sctpMessages(pkt)
+	var out []models.LayerDetail
+	for _, d := range msgs {
+		var detail models.LayerDetail
+		switch sctpPayloadProto(sctp, d.PPID) {
+		case ppidDiameter:
+			if m := parseDiameter(d.Payload); m != nil {
+				detail = buildDiameterLayerDetail(m)
+			}
+		case ppidS1AP:
+			if m := parseAPPDU(d.Payload, s1apProcedures); m != nil {
+				detail = buildAPLayerDetail("S1AP", m, s1apIEs)
+			}
+		case ppidNGAP:
+			if m := parseAPPDU(d.Payload, nil); m != nil {
+				detail = buildAPLayerDetail("NGAP", m, nil)
+			}
+		}
+		if detail.Name != "" {
+			placeLayer(&detail, pkt.Data(), d.Payload)
+			out = append(out, detail)
+		}
+	}
+	return out
+}
+
+// sctpSummary returns the protocol and info column for an SCTP packet: the
+// first dissected payload message, or the list of chunks.
+func sctpSummary(sctp *layers.SCTP) (string, string) {
+	var names []string
+	var proto, info string
+	for _, c := range parseSCTPChunks(sctp.LayerPayload()) {
+		names = append(names, c.name())
+		d, ok := c.data()
+		if !ok || !d.Begin || !d.End || proto != "" {
+			continue
+		}
+		switch sctpPayloadProto(sctp, d.PPID) {
+		case ppidDiameter:
+			if m := parseDiameter(d.Payload); m != nil {
+				proto, info = "Diameter", m.Summary()
+			}
+		case ppidS1AP:
+			if m := parseAPPDU(d.Payload, s1apProcedures); m != nil {
+				proto, info = "S1AP", m.Summary()
+			}
+		case ppidNGAP:
+			if m := parseAPPDU(d.Payload, nil); m != nil {
+				proto, info = "NGAP", m.Summary()
+			}
+		}
+	}
+	if proto != "" {
+		return proto, info
+	}
+	info = fmt.Sprintf("%d -> %d", sctp.SrcPort, sctp.DstPort)
+	if len(names) > 0 {
+		info += " " + strings.Join(names, ", ")
+	}
+	return "SCTP", info
+}
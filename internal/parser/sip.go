@@ -0,0 +1,215 @@
+package parser
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// SIPMessage is a SIP request or response with the headers call tracking
+// needs and the SDP session it carries, if any.
+type SIPMessage struct {
+	Method     string // request method; for responses the CSeq method
+	Response   bool
+	StatusCode int
+	Reason     string
+	CallID     string
+	From       string
+	To         string
+	SDP        *SDPSession
+}
+
+// SDPSession is the part of an SDP offer or answer that says where media
+// is sent.
+type SDPSession struct {
+	Media []SDPMedia
+}
+
+// SDPMedia is one m= line: the address and ports a party receives a media
+// stream on and the RTP payload types it accepts.
+type SDPMedia struct {
+	Type     string // audio, video, ...
+	Addr     string
+	Port     int
+	RTCPPort int  // a=rtcp, else Port+1
+	RTCPMux  bool // RTCP shares the RTP port
+	Formats  []int
+	Codecs   map[int]RTPCodec // from a=rtpmap
+}
+
+// RTPCodec is a payload type's encoding and RTP clock rate.
+type RTPCodec struct {
+	Name      string `json:"name"`
+	ClockRate int    `json:"clockRate"`
+}
+
+// ExtractSIP returns the SIP message carried by pkt, or nil.
+func ExtractSIP(pkt gopacket.Packet) *SIPMessage {
+	data := transportPayload(pkt)
+	if !(decodeAsFor(pkt) == "SIP" || portIsAny(pkt, 5060, 5061)) || !isSIP(data) {
+		return nil
+	}
+	return parseSIPMessage(data)
+}
+
+// transportPayload returns the bytes after the TCP or UDP header, which
+// for SIP is the whole message: gopacket decodes UDP 5060 into a SIP layer
+// whose payload is only the body.
+func transportPayload(pkt gopacket.Packet) []byte {
+	if l := pkt.Layer(layers.LayerTypeUDP); l != nil {
+		return l.LayerPayload()
+	}
+	if l := pkt.Layer(layers.LayerTypeTCP); l != nil {
+		return l.LayerPayload()
+	}
+	return nil
+}
+
+func parseSIPMessage(data []byte) *SIPMessage {
+	m := &SIPMessage{
+		CallID: sipHeaderAny(data, "Call-ID", "i"),
+		From:   sipHeaderAny(data, "From", "f"),
+		To:     sipHeaderAny(data, "To", "t"),
+	}
+	line := firstLine(data)
+	if strings.HasPrefix(line, "SIP/") {
+		m.Response = true
+		parts := strings.SplitN(line, " ", 3)
+		if len(parts) >= 2 {
+			m.StatusCode, _ = strconv.Atoi(parts[1])
+		}
+		if len(parts) == 3 {
+			m.Reason = parts[2]
+		}
+		if f := strings.Fields(sipHeader(data, "CSeq")); len(f) == 2 {
+			m.Method = f[1]
+		}
+	} else {
+		m.Method, _, _ = strings.Cut(line, " ")
+	}
+
+	ctype := strings.ToLower(sipHeaderAny(data, "Content-Type", "c"))
+	if i := bytes.Index(data, []byte("\r\n\r\n")); i >= 0 && strings.HasPrefix(ctype, "application/sdp") {
+		m.SDP = parseSDP(data[i+4:])
+	}
+	return m
+}
+
+// sipHeaderAny returns the header by its full or compact name.
+func sipHeaderAny(data []byte, name, compact string) string {
+	if v := sipHeader(data, name); v != "" {
+		return v
+	}
+	return sipHeader(data, compact)
+}
+
+// parseSDP reads the media descriptions of an SDP body. A media-level c=
+// line overrides the session-level one.
+func parseSDP(body []byte) *SDPSession {
+	s := &SDPSession{}
+	sessionAddr := ""
+	var cur *SDPMedia
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) < 2 || line[1] != '=' {
+			continue
+		}
+		val := line[2:]
+		switch line[0] {
+		case 'c':
+			// c=IN IP4 192.0.2.1 (multicast addresses carry /ttl)
+			f := strings.Fields(val)
+			if len(f) < 3 {
+				continue
+			}
+			addr, _, _ := strings.Cut(f[2], "/")
+			if cur != nil {
+				cur.Addr = addr
+			} else {
+				sessionAddr = addr
+			}
+		case 'm':
+			// m=audio 49170 RTP/AVP 0 8 97
+			f := strings.Fields(val)
+			if len(f) < 3 {
+				cur = nil
+				continue
+			}
+			port, err := strconv.Atoi(strings.SplitN(f[1], "/", 2)[0])
+			if err != nil {
+				cur = nil
+				continue
+			}
+			s.Media = append(s.Media, SDPMedia{Type: f[0], Port: port, Codecs: make(map[int]RTPCodec)})
+			cur = &s.Media[len(s.Media)-1]
+			for _, pt := range f[3:] {
+				if n, err := strconv.Atoi(pt); err == nil {
+					cur.Formats = append(cur.Formats, n)
+				}
+			}
+		case 'a':
+			if cur == nil {
+				continue
+			}
+			name, arg, _ := strings.Cut(val, ":")
+			switch name {
+			case "rtcp":
+				if p, err := strconv.Atoi(strings.Fields(arg + " ")[0]); err == nil {
+					cur.RTCPPort = p
+				}
+			case "rtcp-mux":
+				cur.RTCPMux = true
+			case "rtpmap":
+				// a=rtpmap:97 iLBC/8000
+				f := strings.Fields(arg)
+				if len(f) < 2 {
+					continue
+				}
+				pt, err := strconv.Atoi(f[0])
+				if err != nil {
+					continue
+				}
+				enc := strings.Split(f[1], "/")
+				c := RTPCodec{Name: enc[0]}
+				if len(enc) > 1 {
+					c.ClockRate, _ = strconv.Atoi(enc[1])
+				}
+				cur.Codecs[pt] = c
+			}
+		}
+	}
+	for i := range s.Media {
+		m := &s.Media[i]
+		if m.Addr == "" {
+			m.Addr = sessionAddr
+		}
+		if m.RTCPPort == 0 && m.Port != 0 {
+			m.RTCPPort = m.Port + 1
+		}
+	}
+	return s
+}
+
+// sdpMediaString formats a media description as
+// "audio 192.0.2.1:49170 PCMU, PCMA, telephone-event".
+func sdpMediaString(m SDPMedia) string {
+	codecs := make([]string, 0, len(m.Formats))
+	for _, pt := range m.Formats {
+		if c, ok := m.Codecs[pt]; ok {
+			codecs = append(codecs, c.Name)
+		} else if c, ok := staticRTPCodecs[pt]; ok {
+			codecs = append(codecs, c.Name)
+		} else {
+			codecs = append(codecs, strconv.Itoa(pt))
+		}
+	}
+	s := m.Type + " " + net.JoinHostPort(m.Addr, strconv.Itoa(m.Port))
+	if len(codecs) > 0 {
+		s += " " + strings.Join(codecs, ", ")
+	}
+	return s
+}
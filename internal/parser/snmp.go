@@ -0,0 +1,540 @@
+package parser
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+// SNMP agent and trap receiver ports.
+const (
+	portSNMP     = 161
+	portSNMPTrap = 162
+)
+
+// SNMP versions as encoded in the message.
+const (
+	snmpV1  = 0
+	snmpV2c = 1
+	snmpV3  = 3
+)
+
+// SNMP PDU types, the context tags of the PDU.
+const (
+	snmpGetRequest     = 0
+	snmpGetNextRequest = 1
+	snmpResponse       = 2
+	snmpSetRequest     = 3
+	snmpTrapV1         = 4
+	snmpGetBulkRequest = 5
+	snmpInformRequest  = 6
+	snmpTrapV2         = 7
+	snmpReport         = 8
+)
+
+var snmpPDUNames = map[int]string{
+	snmpGetRequest:     "get-request",
+	snmpGetNextRequest: "get-next-request",
+	snmpResponse:       "get-response",
+	snmpSetRequest:     "set-request",
+	snmpTrapV1:         "trap",
+	snmpGetBulkRequest: "getBulkRequest",
+	snmpInformRequest:  "informRequest",
+	snmpTrapV2:         "snmpV2-trap",
+	snmpReport:         "report",
+}
+
+var snmpErrors = []string{
+	"noError", "tooBig", "noSuchName", "badValue", "readOnly", "genErr",
+	"noAccess", "wrongType", "wrongLength", "wrongEncoding", "wrongValue",
+	"noCreation", "inconsistentValue", "resourceUnavailable", "commitFailed",
+	"undoFailed", "authorizationError", "notWritable", "inconsistentName",
+}
+
+var snmpGenericTraps = []string{
+	"coldStart", "warmStart", "linkDown", "linkUp", "authenticationFailure",
+	"egpNeighborLoss", "enterpriseSpecific",
+}
+
+var snmpSecurityModels = map[int64]string{1: "SNMPv1", 2: "SNMPv2c", 3: "USM", 4: "TSM"}
+
+// snmpMaxVarBinds caps the variable bindings decoded from one message.
+const snmpMaxVarBinds = 64
+
+// SNMPVarBind is one variable binding: an OID and its value.
+type SNMPVarBind struct {
+	OID   string
+	Name  string // the OID resolved against the built-in MIB subset
+	Type  string // e.g. "OCTET STRING", "Counter32", "noSuchObject"
+	Value string // empty for NULL
+
+	at, oidAt, valueAt span
+}
+
+// String renders the binding as `sysDescr.0 = OCTET STRING: Linux`.
+func (v SNMPVarBind) String() string {
+	if v.Type == "NULL" {
+		return v.Name
+	}
+	if v.Value == "" {
+		return v.Name + " = " + v.Type
+	}
+	return v.Name + " = " + v.Type + ": " + v.Value
+}
+
+// SNMPMessage is one decoded SNMP message (RFC 1157, 3416 and 3412).
+type SNMPMessage struct {
+	Version   int
+	Community string // v1 and v2c
+
+	// v3 header and USM security parameters
+	MsgID         int64
+	MsgFlags      byte
+	SecurityModel int64
+	EngineID      []byte
+	User          string
+	ContextName   string
+	Encrypted     bool // the scoped PDU is encrypted and was not decoded
+
+	PDU         int
+	HasPDU      bool
+	RequestID   int64
+	ErrorStatus int64 // non-repeaters in a GetBulkRequest
+	ErrorIndex  int64 // max-repetitions in a GetBulkRequest
+	VarBinds    []SNMPVarBind
+
+	// v1 Trap-PDU
+	Enterprise   string
+	AgentAddr    string
+	GenericTrap  int64
+	SpecificTrap int64
+	TimeStamp    int64
+
+	// The message, and where its fields are in it. headerAt holds the
+	// request ID, error status and error index, or the five fields of a
+	// v1 trap.
+	raw                                           []byte
+	versionAt, communityAt, msgIDAt, flagsAt      span
+	modelAt, engineIDAt, userAt, contextAt, pduAt span
+	headerAt                                      []span
+}
+
+// at returns where t, an element of the message, is.
+func (m *SNMPMessage) at(t berTLV) span {
+	return spanOf(m.raw, t.Raw)
+}
+
+// VersionName returns "v1", "v2c" or "v3".
+func (m *SNMPMessage) VersionName() string {
+	switch m.Version {
+	case snmpV1:
+		return "v1"
+	case snmpV2c:
+		return "v2c"
+	case snmpV3:
+		return "v3"
+	}
+	return fmt.Sprintf("version %d", m.Version)
+}
+
+// PDUName returns the PDU type, e.g. "get-request".
+func (m *SNMPMessage) PDUName() string {
+	if m.Encrypted {
+		return "encryptedPDU"
+	}
+	if n, ok := snmpPDUNames[m.PDU]; ok {
+		return n
+	}
+	return fmt.Sprintf("PDU %d", m.PDU)
+}
+
+// IsResponse reports whether the message is an agent's reply to a
+// request: a get-response or a report.
+func (m *SNMPMessage) IsResponse() bool {
+	return m.HasPDU && (m.PDU == snmpResponse || m.PDU == snmpReport)
+}
+
+// ErrorName returns the error status of a response.
+func (m *SNMPMessage) ErrorName() string {
+	if m.ErrorStatus >= 0 && int(m.ErrorStatus) < len(snmpErrors) {
+		return snmpErrors[m.ErrorStatus]
+	}
+	return fmt.Sprintf("error %d", m.ErrorStatus)
+}
+
+// Summary describes the message as Wireshark does, with OIDs resolved:
+// `get-response sysDescr.0 sysUpTime.0`. A v2c trap names its trap OID.
+func (m *SNMPMessage) Summary() string {
+	s := m.PDUName()
+	if !m.HasPDU {
+		return s
+	}
+	if m.PDU == snmpTrapV1 {
+		s += " " + m.trapName()
+	}
+	if m.PDU == snmpResponse && m.ErrorStatus != 0 {
+		s += " " + m.ErrorName()
+	}
+	for i, v := range m.VarBinds {
+		if i == 4 {
+			s += fmt.Sprintf(" …(%d more)", len(m.VarBinds)-i)
+			break
+		}
+		// The trap OID says more than the sysUpTime.0 before it
+		if (m.PDU == snmpTrapV2 || m.PDU == snmpInformRequest) && v.Name == "snmpTrapOID.0" {
+			s += " " + v.Value
+			continue
+		}
+		s += " " + v.Name
+	}
+	return s
+}
+
+func (m *SNMPMessage) trapName() string {
+	if m.GenericTrap >= 0 && int(m.GenericTrap) < len(snmpGenericTraps) {
+		if m.GenericTrap == 6 {
+			return fmt.Sprintf("%s %s.%d", snmpGenericTraps[6], snmpOIDName(m.Enterprise), m.SpecificTrap)
+		}
+		return snmpGenericTraps[m.GenericTrap]
+	}
+	return fmt.Sprintf("generic-trap %d", m.GenericTrap)
+}
+
+// ExtractSNMP returns the SNMP message carried by pkt, or nil.
+func ExtractSNMP(pkt gopacket.Packet) *SNMPMessage {
+	return findSNMP(pkt)
+}
+
+// findSNMP decodes the SNMP message in a packet to or from UDP 161 or
+// 162, or a port decoded as SNMP.
+func findSNMP(pkt gopacket.Packet) *SNMPMessage {
+	udpLayer := pkt.Layer(layers.LayerTypeUDP)
+	if udpLayer == nil {
+		return nil
+	}
+	if forced := decodeAsFor(pkt); forced != "SNMP" && (forced != "" || !portIsAny(pkt, portSNMP, portSNMPTrap)) {
+		return nil
+	}
+	return parseSNMP(udpLayer.(*layers.UDP).Payload)
+}
+
+func parseSNMP(data []byte) *SNMPMessage {
+	msg, _, ok := readBER(data)
+	if !ok || msg.Class != berUniversal || msg.Tag != 0x10 {
+		return nil
+	}
+	c := berChildren(msg.Value)
+	if len(c) < 3 || c[0].Tag != 2 {
+		return nil
+	}
+	m := &SNMPMessage{Version: int(berInt(c[0].Value)), raw: data}
+	m.versionAt = m.at(c[0])
+	switch m.Version {
+	case snmpV1, snmpV2c:
+		if c[1].Tag != 4 {
+			return nil
+		}
+		m.Community, m.communityAt = string(c[1].Value), m.at(c[1])
+		m.parsePDU(c[2])
+	case snmpV3:
+		if len(c) < 4 || !m.parseV3(c[1], c[2], c[3]) {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return m
+}
+
+// parseV3 decodes the header data, USM security parameters and scoped
+// PDU of an SNMPv3 message.
+func (m *SNMPMessage) parseV3(global, security, data berTLV) bool {
+	g := berChildren(global.Value)
+	if len(g) < 4 || len(g[2].Value) != 1 {
+		return false
+	}
+	m.MsgID, m.msgIDAt = berInt(g[0].Value), m.at(g[0])
+	m.MsgFlags, m.flagsAt = g[2].Value[0], m.at(g[2])
+	m.SecurityModel, m.modelAt = berInt(g[3].Value), m.at(g[3])
+	if m.SecurityModel == 3 {
+		if usm, _, ok := readBER(security.Value); ok {
+			if p := berChildren(usm.Value); len(p) >= 4 {
+				m.EngineID, m.engineIDAt = p[0].Value, m.at(p[0])
+				m.User, m.userAt = string(p[3].Value), m.at(p[3])
+			}
+		}
+	}
+	// With the privacy flag set the scoped PDU is an encrypted OCTET STRING
+	if data.Class == berUniversal && data.Tag == 4 {
+		m.Encrypted, m.pduAt = true, m.at(data)
+		return true
+	}
+	sc := berChildren(data.Value)
+	if len(sc) < 3 {
+		return false
+	}
+	m.ContextName, m.contextAt = string(sc[1].Value), m.at(sc[1])
+	m.parsePDU(sc[2])
+	return true
+}
+
+func (m *SNMPMessage) parsePDU(pdu berTLV) {
+	if pdu.Class != berContext || !pdu.Constructed || snmpPDUNames[pdu.Tag] == "" {
+		return
+	}
+	m.PDU, m.HasPDU = pdu.Tag, true
+	// The PDU's header carries its type
+	m.pduAt = span{m.at(pdu).off, len(pdu.Raw) - len(pdu.Value)}
+	c := berChildren(pdu.Value)
+	var binds berTLV
+	if pdu.Tag == snmpTrapV1 {
+		// enterprise, agent-addr, generic-trap, specific-trap, time-stamp
+		if len(c) < 6 {
+			return
+		}
+		for _, t := range c[:5] {
+			m.headerAt = append(m.headerAt, m.at(t))
+		}
+		m.Enterprise = berOID(c[0].Value)
+		if len(c[1].Value) == 4 {
+			m.AgentAddr = net.IP(c[1].Value).String()
+		}
+		m.GenericTrap = berInt(c[2].Value)
+		m.SpecificTrap = berInt(c[3].Value)
+		m.TimeStamp = berInt(c[4].Value)
+		binds = c[5]
+	} else {
+		if len(c) < 4 {
+			return
+		}
+		for _, t := range c[:3] {
+			m.headerAt = append(m.headerAt, m.at(t))
+		}
+		m.RequestID = berInt(c[0].Value)
+		m.ErrorStatus = berInt(c[1].Value)
+		m.ErrorIndex = berInt(c[2].Value)
+		binds = c[3]
+	}
+	for _, vb := range berChildren(binds.Value) {
+		if len(m.VarBinds) == snmpMaxVarBinds {
+			break
+		}
+		kv := berChildren(vb.Value)
+		if len(kv) < 2 || kv[0].Tag != 6 {
+			continue
+		}
+		oid := berOID(kv[0].Value)
+		typ, val := snmpValue(kv[1])
+		m.VarBinds = append(m.VarBinds, SNMPVarBind{
+			OID: oid, Name: snmpOIDName(oid), Type: typ, Value: val,
+			at: m.at(vb), oidAt: m.at(kv[0]), valueAt: m.at(kv[1]),
+		})
+	}
+}
+
+// snmpValue returns the type and rendered value of a variable binding.
+func snmpValue(t berTLV) (string, string) {
+	switch t.Class {
+	case berUniversal:
+		switch t.Tag {
+		case 2:
+			return "INTEGER", strconv.FormatInt(berInt(t.Value), 10)
+		case 4:
+			return "OCTET STRING", snmpString(t.Value)
+		case 5:
+			return "NULL", ""
+		case 6:
+			return "OID", snmpOIDName(berOID(t.Value))
+		}
+	case berApplication:
+		switch t.Tag {
+		case 0:
+			if len(t.Value) == 4 {
+				return "IpAddress", net.IP(t.Value).String()
+			}
+		case 1, 2, 6:
+			name := map[int]string{1: "Counter32", 2: "Gauge32", 6: "Counter64"}[t.Tag]
+			return name, strconv.FormatUint(berUint(t.Value), 10)
+		case 3:
+			ticks := berUint(t.Value)
+			return "Timeticks", fmt.Sprintf("(%d) %s", ticks, snmpUptime(ticks))
+		case 4:
+			return "Opaque", fmt.Sprintf("%x", t.Value)
+		}
+	case berContext:
+		switch t.Tag {
+		case 0:
+			return "noSuchObject", ""
+		case 1:
+			return "noSuchInstance", ""
+		case 2:
+			return "endOfMibView", ""
+		}
+	}
+	return fmt.Sprintf("tag %d", t.Tag), fmt.Sprintf("%x", t.Value)
+}
+
+// snmpString shows an OCTET STRING as text if it is printable, such as a
+// sysDescr, or as hex, such as a MAC address.
+func snmpString(v []byte) string {
+	if utf8.Valid(v) {
+		printable := true
+		for _, r := range string(v) {
+			if r < 0x20 && r != '\t' && r != '\r' && r != '\n' {
+				printable = false
+				break
+			}
+		}
+		if printable {
+			return strings.TrimRight(string(v), "\x00")
+		}
+	}
+	parts := make([]string, len(v))
+	for i, b := range v {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// snmpUptime renders hundredths of a second as days and h:mm:ss.cc.
+func snmpUptime(ticks uint64) string {
+	cs := ticks % 100
+	s := ticks / 100
+	d, h, mi := s/86400, s/3600%24, s/60%60
+	out := fmt.Sprintf("%d:%02d:%02d.%02d", h, mi, s%60, cs)
+	if d > 0 {
+		out = fmt.Sprintf("%d days, %s", d, out)
+	}
+	return out
+}
+
+// berUint decodes an unsigned INTEGER, as the SNMP counters are, which
+// carry a leading zero byte when the high bit is set.
+func berUint(v []byte) uint64 {
+	if len(v) > 9 || (len(v) == 9 && v[0] != 0) {
+		return 0
+	}
+	var n uint64
+	for _, c := range v {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+// berOID decodes an OBJECT IDENTIFIER to dotted form.
+func berOID(v []byte) string {
+	if len(v) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	var n uint64
+	first := true
+	for i, c := range v {
+		n = n<<7 | uint64(c&0x7f)
+		if c&0x80 != 0 {
+			if i == len(v)-1 || n > 1<<56 {
+				break
+			}
+			continue
+		}
+		if first {
+			// The first subidentifier packs the first two arcs
+			a := min(n/40, 2)
+			fmt.Fprintf(&sb, "%d.%d", a, n-a*40)
+			first = false
+		} else {
+			fmt.Fprintf(&sb, ".%d", n)
+		}
+		n = 0
+	}
+	return sb.String()
+}
+
+// buildSNMPLayerDetail describes m; field offsets are relative to the
+// start of the message.
+func buildSNMPLayerDetail(m *SNMPMessage) models.LayerDetail {
+	var fields []models.LayerField
+	add := func(at span, name, value string) {
+		fields = append(fields, at.field(name, value))
+	}
+	header := func(i int) span {
+		if i < len(m.headerAt) {
+			return m.headerAt[i]
+		}
+		return span{}
+	}
+	add(m.versionAt, "Version", m.VersionName())
+	if m.Version == snmpV3 {
+		add(m.msgIDAt, "Message ID", fmt.Sprintf("%d", m.MsgID))
+		var flags []string
+		for _, f := range []struct {
+			bit  byte
+			name string
+		}{{0x01, "auth"}, {0x02, "priv"}, {0x04, "reportable"}} {
+			if m.MsgFlags&f.bit != 0 {
+				flags = append(flags, f.name)
+			}
+		}
+		if len(flags) > 0 {
+			add(m.flagsAt, "Flags", fmt.Sprintf("0x%02x (%s)", m.MsgFlags, strings.Join(flags, ", ")))
+		} else {
+			add(m.flagsAt, "Flags", fmt.Sprintf("0x%02x", m.MsgFlags))
+		}
+		model, ok := snmpSecurityModels[m.SecurityModel]
+		if !ok {
+			model = "unknown"
+		}
+		add(m.modelAt, "Security Model", fmt.Sprintf("%s (%d)", model, m.SecurityModel))
+		if len(m.EngineID) > 0 {
+			add(m.engineIDAt, "Engine ID", fmt.Sprintf("%x", m.EngineID))
+		}
+		if m.User != "" {
+			add(m.userAt, "User Name", m.User)
+		}
+		if m.ContextName != "" {
+			add(m.contextAt, "Context Name", m.ContextName)
+		}
+	} else {
+		add(m.communityAt, "Community", m.Community)
+	}
+	add(m.pduAt, "PDU Type", m.PDUName())
+	if !m.HasPDU {
+		return models.LayerDetail{Name: "SNMP", Fields: fields}
+	}
+	switch m.PDU {
+	case snmpTrapV1:
+		add(header(0), "Enterprise", snmpOIDName(m.Enterprise))
+		add(header(1), "Agent Address", m.AgentAddr)
+		add(header(2), "Generic Trap", m.trapName())
+		add(header(3), "Specific Trap", fmt.Sprintf("%d", m.SpecificTrap))
+		add(header(4), "Time Stamp", snmpUptime(uint64(max(m.TimeStamp, 0))))
+	case snmpGetBulkRequest:
+		add(header(0), "Request ID", fmt.Sprintf("%d", m.RequestID))
+		add(header(1), "Non-repeaters", fmt.Sprintf("%d", m.ErrorStatus))
+		add(header(2), "Max Repetitions", fmt.Sprintf("%d", m.ErrorIndex))
+	default:
+		add(header(0), "Request ID", fmt.Sprintf("%d", m.RequestID))
+		add(header(1), "Error Status", fmt.Sprintf("%s (%d)", m.ErrorName(), m.ErrorStatus))
+		add(header(2), "Error Index", fmt.Sprintf("%d", m.ErrorIndex))
+	}
+	for _, v := range m.VarBinds {
+		f := v.at.field("Variable Binding", v.String())
+		f.Children = []models.LayerField{
+			v.oidAt.field("OID", v.OID),
+			v.oidAt.field("Name", v.Name),
+			v.valueAt.field("Type", v.Type),
+		}
+		if v.Value != "" {
+			f.Children = append(f.Children, v.valueAt.field("Value", v.Value))
+		}
+		fields = append(fields, f)
+	}
+	return models.LayerDetail{Name: "SNMP", Fields: fields}
+}
@@ -0,0 +1,168 @@
+package parser
+
+import "strings"
+
+// snmpMIB names the objects of the MIBs most polling and trap traffic
+// uses: SNMPv2-MIB, IF-MIB, IP-MIB, TCP/UDP-MIB, HOST-RESOURCES-MIB,
+// ENTITY-MIB, the standard traps and the Net-SNMP UCD-SNMP-MIB. OIDs under
+// a named object resolve to its name and the instance, e.g. ifInOctets.3.
+var snmpMIB = map[string]string{
+	// SNMPv2-SMI
+	"1.3.6.1":           "internet",
+	"1.3.6.1.2.1":       "mib-2",
+	"1.3.6.1.4.1":       "enterprises",
+	"1.3.6.1.6.3":       "snmpModules",
+	"1.3.6.1.4.1.9":     "cisco",
+	"1.3.6.1.4.1.2636":  "juniperMIB",
+	"1.3.6.1.4.1.8072":  "netSnmp",
+	"1.3.6.1.4.1.2021":  "ucdavis",
+	"1.3.6.1.4.1.311":   "microsoft",
+	"1.3.6.1.4.1.11":    "hp",
+	"1.3.6.1.4.1.674":   "dell",
+	"1.3.6.1.4.1.6876":  "vmware",
+	"1.3.6.1.4.1.12356": "fortinet",
+	"1.3.6.1.4.1.25461": "paloAltoNetworks",
+
+	// SNMPv2-MIB system group
+	"1.3.6.1.2.1.1":     "system",
+	"1.3.6.1.2.1.1.1":   "sysDescr",
+	"1.3.6.1.2.1.1.2":   "sysObjectID",
+	"1.3.6.1.2.1.1.3":   "sysUpTime",
+	"1.3.6.1.2.1.1.4":   "sysContact",
+	"1.3.6.1.2.1.1.5":   "sysName",
+	"1.3.6.1.2.1.1.6":   "sysLocation",
+	"1.3.6.1.2.1.1.7":   "sysServices",
+	"1.3.6.1.2.1.1.8":   "sysORLastChange",
+	"1.3.6.1.2.1.1.9":   "sysORTable",
+	"1.3.6.1.2.1.11":    "snmp",
+	"1.3.6.1.2.1.11.1":  "snmpInPkts",
+	"1.3.6.1.2.1.11.4":  "snmpInBadCommunityNames",
+	"1.3.6.1.2.1.11.30": "snmpEnableAuthenTraps",
+
+	// IF-MIB
+	"1.3.6.1.2.1.2":           "interfaces",
+	"1.3.6.1.2.1.2.1":         "ifNumber",
+	"1.3.6.1.2.1.2.2":         "ifTable",
+	"1.3.6.1.2.1.2.2.1":       "ifEntry",
+	"1.3.6.1.2.1.2.2.1.1":     "ifIndex",
+	"1.3.6.1.2.1.2.2.1.2":     "ifDescr",
+	"1.3.6.1.2.1.2.2.1.3":     "ifType",
+	"1.3.6.1.2.1.2.2.1.4":     "ifMtu",
+	"1.3.6.1.2.1.2.2.1.5":     "ifSpeed",
+	"1.3.6.1.2.1.2.2.1.6":     "ifPhysAddress",
+	"1.3.6.1.2.1.2.2.1.7":     "ifAdminStatus",
+	"1.3.6.1.2.1.2.2.1.8":     "ifOperStatus",
+	"1.3.6.1.2.1.2.2.1.9":     "ifLastChange",
+	"1.3.6.1.2.1.2.2.1.10":    "ifInOctets",
+	"1.3.6.1.2.1.2.2.1.11":    "ifInUcastPkts",
+	"1.3.6.1.2.1.2.2.1.13":    "ifInDiscards",
+	"1.3.6.1.2.1.2.2.1.14":    "ifInErrors",
+	"1.3.6.1.2.1.2.2.1.15":    "ifInUnknownProtos",
+	"1.3.6.1.2.1.2.2.1.16":    "ifOutOctets",
+	"1.3.6.1.2.1.2.2.1.17":    "ifOutUcastPkts",
+	"1.3.6.1.2.1.2.2.1.19":    "ifOutDiscards",
+	"1.3.6.1.2.1.2.2.1.20":    "ifOutErrors",
+	"1.3.6.1.2.1.31":          "ifMIB",
+	"1.3.6.1.2.1.31.1.1":      "ifXTable",
+	"1.3.6.1.2.1.31.1.1.1":    "ifXEntry",
+	"1.3.6.1.2.1.31.1.1.1.1":  "ifName",
+	"1.3.6.1.2.1.31.1.1.1.2":  "ifInMulticastPkts",
+	"1.3.6.1.2.1.31.1.1.1.3":  "ifInBroadcastPkts",
+	"1.3.6.1.2.1.31.1.1.1.4":  "ifOutMulticastPkts",
+	"1.3.6.1.2.1.31.1.1.1.5":  "ifOutBroadcastPkts",
+	"1.3.6.1.2.1.31.1.1.1.6":  "ifHCInOctets",
+	"1.3.6.1.2.1.31.1.1.1.7":  "ifHCInUcastPkts",
+	"1.3.6.1.2.1.31.1.1.1.10": "ifHCOutOctets",
+	"1.3.6.1.2.1.31.1.1.1.11": "ifHCOutUcastPkts",
+	"1.3.6.1.2.1.31.1.1.1.15": "ifHighSpeed",
+	"1.3.6.1.2.1.31.1.1.1.18": "ifAlias",
+
+	// IP-MIB, TCP-MIB, UDP-MIB
+	"1.3.6.1.2.1.4":          "ip",
+	"1.3.6.1.2.1.4.1":        "ipForwarding",
+	"1.3.6.1.2.1.4.20":       "ipAddrTable",
+	"1.3.6.1.2.1.4.20.1.1":   "ipAdEntAddr",
+	"1.3.6.1.2.1.4.20.1.2":   "ipAdEntIfIndex",
+	"1.3.6.1.2.1.4.20.1.3":   "ipAdEntNetMask",
+	"1.3.6.1.2.1.4.21":       "ipRouteTable",
+	"1.3.6.1.2.1.4.22":       "ipNetToMediaTable",
+	"1.3.6.1.2.1.4.22.1.2":   "ipNetToMediaPhysAddress",
+	"1.3.6.1.2.1.4.24":       "ipForward",
+	"1.3.6.1.2.1.4.34":       "ipAddressTable",
+	"1.3.6.1.2.1.4.35":       "ipNetToPhysicalTable",
+	"1.3.6.1.2.1.6":          "tcp",
+	"1.3.6.1.2.1.6.5":        "tcpActiveOpens",
+	"1.3.6.1.2.1.6.9":        "tcpCurrEstab",
+	"1.3.6.1.2.1.6.13":       "tcpConnTable",
+	"1.3.6.1.2.1.7":          "udp",
+	"1.3.6.1.2.1.7.1":        "udpInDatagrams",
+	"1.3.6.1.2.1.4.31.1.1.3": "ipSystemStatsHCInReceives",
+
+	// HOST-RESOURCES-MIB
+	"1.3.6.1.2.1.25":         "host",
+	"1.3.6.1.2.1.25.1.1":     "hrSystemUptime",
+	"1.3.6.1.2.1.25.1.5":     "hrSystemNumUsers",
+	"1.3.6.1.2.1.25.1.6":     "hrSystemProcesses",
+	"1.3.6.1.2.1.25.2.2":     "hrMemorySize",
+	"1.3.6.1.2.1.25.2.3":     "hrStorageTable",
+	"1.3.6.1.2.1.25.2.3.1.2": "hrStorageType",
+	"1.3.6.1.2.1.25.2.3.1.3": "hrStorageDescr",
+	"1.3.6.1.2.1.25.2.3.1.4": "hrStorageAllocationUnits",
+	"1.3.6.1.2.1.25.2.3.1.5": "hrStorageSize",
+	"1.3.6.1.2.1.25.2.3.1.6": "hrStorageUsed",
+	"1.3.6.1.2.1.25.3.2.1.3": "hrDeviceDescr",
+	"1.3.6.1.2.1.25.3.3.1.2": "hrProcessorLoad",
+	"1.3.6.1.2.1.25.4.2.1.2": "hrSWRunName",
+	"1.3.6.1.2.1.25.6.3.1.2": "hrSWInstalledName",
+
+	// ENTITY-MIB
+	"1.3.6.1.2.1.47.1.1.1.1.2":  "entPhysicalDescr",
+	"1.3.6.1.2.1.47.1.1.1.1.7":  "entPhysicalName",
+	"1.3.6.1.2.1.47.1.1.1.1.11": "entPhysicalSerialNum",
+	"1.3.6.1.2.1.47.1.1.1.1.13": "entPhysicalModelName",
+
+	// SNMPv2-MIB notifications and their objects
+	"1.3.6.1.6.3.1.1.4.1":  "snmpTrapOID",
+	"1.3.6.1.6.3.1.1.4.3":  "snmpTrapEnterprise",
+	"1.3.6.1.6.3.1.1.5.1":  "coldStart",
+	"1.3.6.1.6.3.1.1.5.2":  "warmStart",
+	"1.3.6.1.6.3.1.1.5.3":  "linkDown",
+	"1.3.6.1.6.3.1.1.5.4":  "linkUp",
+	"1.3.6.1.6.3.1.1.5.5":  "authenticationFailure",
+	"1.3.6.1.6.3.15.1.1.1": "usmStatsUnsupportedSecLevels",
+	"1.3.6.1.6.3.15.1.1.2": "usmStatsNotInTimeWindows",
+	"1.3.6.1.6.3.15.1.1.3": "usmStatsUnknownUserNames",
+	"1.3.6.1.6.3.15.1.1.4": "usmStatsUnknownEngineIDs",
+	"1.3.6.1.6.3.15.1.1.5": "usmStatsWrongDigests",
+	"1.3.6.1.6.3.15.1.1.6": "usmStatsDecryptionErrors",
+	"1.3.6.1.6.3.10.2.1.1": "snmpEngineID",
+	"1.3.6.1.6.3.10.2.1.2": "snmpEngineBoots",
+	"1.3.6.1.6.3.10.2.1.3": "snmpEngineTime",
+
+	// UCD-SNMP-MIB
+	"1.3.6.1.4.1.2021.4.5":    "memTotalReal",
+	"1.3.6.1.4.1.2021.4.6":    "memAvailReal",
+	"1.3.6.1.4.1.2021.4.11":   "memTotalFree",
+	"1.3.6.1.4.1.2021.10.1.3": "laLoad",
+	"1.3.6.1.4.1.2021.11.9":   "ssCpuUser",
+	"1.3.6.1.4.1.2021.11.10":  "ssCpuSystem",
+	"1.3.6.1.4.1.2021.11.11":  "ssCpuIdle",
+	"1.3.6.1.4.1.2021.9.1.2":  "dskPath",
+	"1.3.6.1.4.1.2021.9.1.9":  "dskPercent",
+}
+
+// snmpOIDName resolves oid to the longest object in snmpMIB it falls
+// under, followed by the rest of its arcs, or returns it unchanged.
+func snmpOIDName(oid string) string {
+	for prefix := oid; prefix != ""; {
+		if name, ok := snmpMIB[prefix]; ok {
+			return name + oid[len(prefix):]
+		}
+		i := strings.LastIndexByte(prefix, '.')
+		if i < 0 {
+			break
+		}
+		prefix = prefix[:i]
+	}
+	return oid
+}
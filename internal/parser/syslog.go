@@ -0,0 +1,457 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+)
+
+// Syslog ports: UDP and TCP 514, and TCP 601 for RFC 6587 reliable syslog.
+// Syslog over TLS (6514) is encrypted and cannot be dissected.
+const (
+	portSyslog    = 514
+	portSyslogTCP = 601
+)
+
+// syslogMaxMessages caps the messages decoded from one TCP segment.
+const syslogMaxMessages = 32
+
+var syslogFacilities = []string{
+	"KERN", "USER", "MAIL", "DAEMON", "AUTH", "SYSLOG", "LPR", "NEWS",
+	"UUCP", "CRON", "AUTHPRIV", "FTP", "NTP", "AUDIT", "ALERT", "CLOCK",
+	"LOCAL0", "LOCAL1", "LOCAL2", "LOCAL3", "LOCAL4", "LOCAL5", "LOCAL6", "LOCAL7",
+}
+
+var syslogSeverities = []string{"EMERG", "ALERT", "CRIT", "ERR", "WARNING", "NOTICE", "INFO", "DEBUG"}
+
+var syslogMonths = []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+
+// SyslogMessage is one decoded syslog message, RFC 5424 or the BSD format
+// of RFC 3164.
+type SyslogMessage struct {
+	Priority  int // -1 for a bare CEF message sent without a syslog header
+	RFC5424   bool
+	Timestamp string
+	Hostname  string
+	AppName   string
+	ProcID    string
+	MsgID     string // RFC 5424 only
+	// RFC 5424 structured data elements, such as
+	// `[origin ip="10.0.0.1"]`
+	StructuredData []string
+	Message        string
+}
+
+// Facility returns the facility name, e.g. "LOCAL0".
+func (m *SyslogMessage) Facility() string {
+	if f := m.Priority >> 3; m.Priority >= 0 && f < len(syslogFacilities) {
+		return syslogFacilities[f]
+	}
+	return ""
+}
+
+// Severity returns the severity name, e.g. "NOTICE".
+func (m *SyslogMessage) Severity() string {
+	if m.Priority < 0 {
+		return ""
+	}
+	return syslogSeverities[m.Priority&7]
+}
+
+// Summary describes the message as Wireshark does, with its origin:
+// `LOCAL0.NOTICE: web01 nginx[812]: upstream timed out`.
+func (m *SyslogMessage) Summary() string {
+	var sb strings.Builder
+	if m.Priority >= 0 {
+		sb.WriteString(m.Facility() + "." + m.Severity() + ": ")
+	}
+	if m.Hostname != "" {
+		sb.WriteString(m.Hostname + " ")
+	}
+	if m.AppName != "" {
+		sb.WriteString(m.AppName)
+		if m.ProcID != "" {
+			sb.WriteString("[" + m.ProcID + "]")
+		}
+		sb.WriteString(": ")
+	}
+	msg := m.Message
+	if cef := parseCEF(msg); cef != nil {
+		msg = cef.Summary()
+	}
+	if len(msg) > 200 {
+		msg = msg[:200] + "…"
+	}
+	sb.WriteString(msg)
+	return sb.String()
+}
+
+// isSyslogPort reports whether pkt uses a syslog port, or a port decoded
+// as syslog.
+func isSyslogPort(pkt gopacket.Packet) bool {
+	if forced := decodeAsFor(pkt); forced != "" {
+		return forced == "Syslog"
+	}
+	switch getTransportProto(pkt) {
+	case "UDP":
+		return portIs(pkt, portSyslog)
+	case "TCP":
+		return portIsAny(pkt, portSyslog, portSyslogTCP)
+	}
+	return false
+}
+
+// findSyslog decodes the syslog messages in a packet on a syslog port.
+func findSyslog(pkt gopacket.Packet) []*SyslogMessage {
+	if !isSyslogPort(pkt) {
+		return nil
+	}
+	data := transportPayload(pkt)
+	if getTransportProto(pkt) == "UDP" {
+		if m := parseSyslog(data); m != nil {
+			return []*SyslogMessage{m}
+		}
+		return nil
+	}
+	return parseSyslogStream(data)
+}
+
+// parseSyslogStream splits a TCP payload into messages framed by octet
+// counting or by newlines (RFC 6587), and decodes them.
+func parseSyslogStream(data []byte) []*SyslogMessage {
+	var out []*SyslogMessage
+	for len(data) > 0 && len(out) < syslogMaxMessages {
+		var frame []byte
+		if sp := bytes.IndexByte(data, ' '); sp > 0 && sp <= 9 && data[0] >= '1' && data[0] <= '9' {
+			n, err := strconv.Atoi(string(data[:sp]))
+			if err != nil || sp+1+n > len(data) {
+				break
+			}
+			frame, data = data[sp+1:sp+1+n], data[sp+1+n:]
+		} else {
+			end := bytes.IndexAny(data, "\n\x00")
+			if end < 0 {
+				end = len(data)
+			}
+			frame, data = data[:end], data[min(end+1, len(data)):]
+			if len(bytes.TrimSpace(frame)) == 0 {
+				continue
+			}
+		}
+		m := parseSyslog(frame)
+		if m == nil {
+			break
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// parseSyslog decodes one message, or returns nil if data does not start
+// with a PRI part or a bare CEF header.
+func parseSyslog(data []byte) *SyslogMessage {
+	s := strings.TrimRight(string(data), "\r\n\x00")
+	if strings.HasPrefix(s, "CEF:") && parseCEF(s) != nil {
+		return &SyslogMessage{Priority: -1, Message: s}
+	}
+	end := strings.IndexByte(s, '>')
+	if len(s) < 3 || s[0] != '<' || end < 2 || end > 4 {
+		return nil
+	}
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri < 0 || pri > 191 || (end > 2 && s[1] == '0') {
+		return nil
+	}
+	m := &SyslogMessage{Priority: pri}
+	rest := s[end+1:]
+	if strings.HasPrefix(rest, "1 ") {
+		m.RFC5424 = true
+		m.parse5424(rest[2:])
+	} else {
+		m.parse3164(rest)
+	}
+	return m
+}
+
+// parse5424 reads the header, structured data and message that follow
+// the version of an RFC 5424 message.
+func (m *SyslogMessage) parse5424(s string) {
+	var hdr [5]string
+	for i := range hdr {
+		var tok string
+		tok, s, _ = strings.Cut(s, " ")
+		if tok != "-" {
+			hdr[i] = tok
+		}
+	}
+	m.Timestamp, m.Hostname, m.AppName, m.ProcID, m.MsgID = hdr[0], hdr[1], hdr[2], hdr[3], hdr[4]
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	} else {
+		for strings.HasPrefix(s, "[") {
+			end := sdElementEnd(s)
+			if end < 0 {
+				break
+			}
+			m.StructuredData = append(m.StructuredData, s[:end+1])
+			s = s[end+1:]
+		}
+	}
+	s = strings.TrimPrefix(s, " ")
+	m.Message = strings.TrimPrefix(s, "\ufeff") // UTF-8 BOM
+}
+
+// sdElementEnd returns the index of the "]" closing the structured data
+// element s starts with, skipping quoted parameter values.
+func sdElementEnd(s string) int {
+	quoted := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == ']' && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+// parse3164 reads the optional timestamp and hostname, and the tag, of a
+// BSD syslog message.
+func (m *SyslogMessage) parse3164(s string) {
+	// "Mmm dd hh:mm:ss "; senders that leave it out leave out the
+	// hostname too
+	if len(s) > 16 && slices.Contains(syslogMonths, s[:3]) && s[3] == ' ' && s[9] == ':' && s[12] == ':' && s[15] == ' ' {
+		m.Timestamp = s[:15]
+		m.Hostname, s, _ = strings.Cut(s[16:], " ")
+	}
+	// TAG[pid]: message
+	if i := strings.IndexAny(s, ":[ "); i > 0 && i <= 48 {
+		tag, rest := s[:i], s[i:]
+		if rest[0] == '[' {
+			if end := strings.Index(rest, "]:"); end > 0 {
+				m.AppName, m.ProcID, s = tag, rest[1:end], strings.TrimPrefix(rest[end+2:], " ")
+			}
+		} else if rest[0] == ':' && !strings.HasPrefix(tag, "CEF") {
+			m.AppName, s = tag, strings.TrimPrefix(rest[1:], " ")
+		}
+	}
+	m.Message = s
+}
+
+func buildSyslogLayerDetail(msgs []*SyslogMessage) models.LayerDetail {
+	if len(msgs) == 1 {
+		return models.LayerDetail{Name: "Syslog", Fields: syslogFields(msgs[0])}
+	}
+	fields := make([]models.LayerField, 0, len(msgs))
+	for _, m := range msgs {
+		fields = append(fields, models.LayerField{Name: "Message", Value: m.Summary(), Children: syslogFields(m)})
+	}
+	return models.LayerDetail{Name: "Syslog", Fields: fields}
+}
+
+func syslogFields(m *SyslogMessage) []models.LayerField {
+	var fields []models.LayerField
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, models.LayerField{Name: name, Value: value})
+		}
+	}
+	if m.Priority >= 0 {
+		add("Priority", fmt.Sprintf("%d", m.Priority))
+		add("Facility", fmt.Sprintf("%s (%d)", m.Facility(), m.Priority>>3))
+		add("Severity", fmt.Sprintf("%s (%d)", m.Severity(), m.Priority&7))
+		if m.RFC5424 {
+			add("Format", "RFC 5424")
+		} else {
+			add("Format", "RFC 3164")
+		}
+	}
+	add("Timestamp", m.Timestamp)
+	add("Hostname", m.Hostname)
+	add("App Name", m.AppName)
+	add("Process ID", m.ProcID)
+	add("Message ID", m.MsgID)
+	for _, sd := range m.StructuredData {
+		add("Structured Data", sd)
+	}
+	add("Message", m.Message)
+	return fields
+}
+
+// CEFEvent is an ArcSight Common Event Format event carried in a syslog
+// message: `CEF:0|Vendor|Product|1.0|100|Name|5|src=10.0.0.1 act=blocked`.
+type CEFEvent struct {
+	Version       string
+	DeviceVendor  string
+	DeviceProduct string
+	DeviceVersion string
+	SignatureID   string
+	Name          string
+	Severity      string
+	Extensions    []CEFExtension // in message order
+}
+
+// CEFExtension is one key=value pair of a CEF event's extension.
+type CEFExtension struct {
+	Key   string
+	Value string
+}
+
+// Summary describes the event: `Vendor Product: Name (severity 5)`.
+func (c *CEFEvent) Summary() string {
+	return fmt.Sprintf("CEF: %s %s: %s (severity %s)", c.DeviceVendor, c.DeviceProduct, c.Name, c.Severity)
+}
+
+// Extension returns the value of the extension key, if present.
+func (c *CEFEvent) Extension(key string) (string, bool) {
+	for _, e := range c.Extensions {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return "", false
+}
+
+// ExtractCEF returns the CEF events in a packet's syslog messages.
+func ExtractCEF(pkt gopacket.Packet) []*CEFEvent {
+	var out []*CEFEvent
+	for _, m := range findSyslog(pkt) {
+		if c := parseCEF(m.Message); c != nil {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// parseCEF decodes the CEF event in a syslog message body, which may be
+// preceded by a header the sender added, or returns nil.
+func parseCEF(s string) *CEFEvent {
+	i := strings.Index(s, "CEF:")
+	if i < 0 {
+		return nil
+	}
+	s = s[i+4:]
+	// Seven header fields separated by unescaped pipes, then the extension
+	var parts []string
+	start := 0
+	for j := 0; j < len(s) && len(parts) < 7; j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '|':
+			parts = append(parts, cefUnescape(s[start:j], "|\\"))
+			start = j + 1
+		}
+	}
+	if len(parts) < 7 {
+		return nil
+	}
+	c := &CEFEvent{
+		Version:       strings.TrimSpace(parts[0]),
+		DeviceVendor:  parts[1],
+		DeviceProduct: parts[2],
+		DeviceVersion: parts[3],
+		SignatureID:   parts[4],
+		Name:          parts[5],
+		Severity:      parts[6],
+	}
+	c.Extensions = parseCEFExtension(s[start:])
+	return c
+}
+
+// parseCEFExtension splits the extension into key=value pairs. Values may
+// contain spaces, so a value runs up to the space before the next key.
+func parseCEFExtension(s string) []CEFExtension {
+	var out []CEFExtension
+	key, valStart := "", -1
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			continue
+		case '=':
+		default:
+			continue
+		}
+		// The key is the word before the '='
+		ks := strings.LastIndexByte(s[:i], ' ') + 1
+		if ks < valStart || !cefKey(s[ks:i]) {
+			continue
+		}
+		if valStart >= 0 {
+			out = append(out, CEFExtension{Key: key, Value: cefUnescape(strings.TrimRight(s[valStart:max(ks-1, valStart)], " "), "=\\")})
+		}
+		key, valStart = s[ks:i], i+1
+	}
+	if valStart >= 0 {
+		out = append(out, CEFExtension{Key: key, Value: cefUnescape(strings.TrimRight(s[valStart:], " "), "=\\")})
+	}
+	return out
+}
+
+// cefKey reports whether s can be an extension key.
+func cefKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-' || r == '[' || r == ']') {
+			return false
+		}
+	}
+	return true
+}
+
+// cefUnescape removes the backslashes before the characters in escaped,
+// and turns \n and \r into line breaks.
+func cefUnescape(s, escaped string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; {
+		case c == 'n':
+			sb.WriteByte('\n')
+		case c == 'r':
+			sb.WriteByte('\r')
+		case strings.IndexByte(escaped, c) >= 0:
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+func buildCEFLayerDetail(c *CEFEvent) models.LayerDetail {
+	fields := []models.LayerField{
+		{Name: "Version", Value: c.Version},
+		{Name: "Device Vendor", Value: c.DeviceVendor},
+		{Name: "Device Product", Value: c.DeviceProduct},
+		{Name: "Device Version", Value: c.DeviceVersion},
+		{Name: "Signature ID", Value: c.SignatureID},
+		{Name: "Name", Value: c.Name},
+		{Name: "Severity", Value: c.Severity},
+	}
+	// Extensions keep their CEF keys, so cef.src or cef.suser filter on them
+	for _, e := range c.Extensions {
+		fields = append(fields, models.LayerField{Name: e.Key, Value: e.Value})
+	}
+	return models.LayerDetail{Name: "CEF", Fields: fields}
+}
@@ -7,6 +7,8 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/google/gopacket"
+
 	"sniffox/internal/models"
 )
 
@@ -21,7 +23,49 @@ type TLSClientHelloInfo struct {
 	Extensions      []uint16
 	SupportedGroups []uint16
 	ECPointFormats  []uint8
+	ALPN            []string
 	JA3Hash         string
+	SessionID       string // hex; non-empty when offering ID-based resumption
+	TicketLen       int    // session_ticket extension length (TLS 1.2 resumption)
+	OffersPSK       bool   // pre_shared_key extension (TLS 1.3 resumption)
+	EarlyData       bool   // early_data extension (TLS 1.3 0-RTT)
+
+	// Where the fields are in the record parsed
+	sniAt, versionAt, sessionIDAt, suitesAt, alpnAt span
+	ticketAt, pskAt, earlyDataAt, extensionsAt      span
+}
+
+// TLSServerHelloInfo holds extracted ServerHello fields.
+type TLSServerHelloInfo struct {
+	Version         uint16 // legacy_version field
+	SelectedVersion uint16 // supported_versions extension, TLS 1.3+
+	CipherSuite     uint16
+	SessionID       string
+	Extensions      []uint16
+	ALPN            string
+	AcceptsPSK      bool // pre_shared_key extension selected by the server
+
+	// Where the fields are in the record parsed
+	versionAt, selectedAt, suiteAt, sessionIDAt span
+	alpnAt, pskAt, extensionsAt                 span
+}
+
+// Resumes reports whether the ServerHello resumes the session offered in
+// the ClientHello: by PSK in TLS 1.3, by echoing the session ID before that.
+func (s *TLSServerHelloInfo) Resumes(ch *TLSClientHelloInfo) bool {
+	if s.NegotiatedVersion() >= 0x0304 {
+		return s.AcceptsPSK
+	}
+	return ch != nil && ch.SessionID != "" && ch.SessionID == s.SessionID
+}
+
+// NegotiatedVersion returns the version actually negotiated, preferring the
+// supported_versions extension over the frozen legacy_version field.
+func (s *TLSServerHelloInfo) NegotiatedVersion() uint16 {
+	if s.SelectedVersion != 0 {
+		return s.SelectedVersion
+	}
+	return s.Version
 }
 
 // parseTLSClientHello parses a TLS ClientHello from raw handshake data.
@@ -55,6 +99,7 @@ func parseTLSClientHello(data []byte) *TLSClientHelloInfo {
 	}
 
 	info.Version = binary.BigEndian.Uint16(data[pos : pos+2])
+	info.versionAt = span{pos, 2}
 	pos += 2
 
 	if len(data) < pos+32 {
@@ -70,6 +115,8 @@ func parseTLSClientHello(data []byte) *TLSClientHelloInfo {
 	if len(data) < pos+sessionIDLen {
 		return info
 	}
+	info.SessionID = fmt.Sprintf("%x", data[pos:pos+sessionIDLen])
+	info.sessionIDAt = span{pos, sessionIDLen}
 	pos += sessionIDLen
 
 	if len(data) < pos+2 {
@@ -80,6 +127,7 @@ func parseTLSClientHello(data []byte) *TLSClientHelloInfo {
 	if len(data) < pos+cipherSuitesLen {
 		cipherSuitesLen = len(data) - pos
 	}
+	info.suitesAt = span{pos, cipherSuitesLen}
 	for i := 0; i+1 < cipherSuitesLen; i += 2 {
 		cs := binary.BigEndian.Uint16(data[pos+i : pos+i+2])
 		info.CipherSuites = append(info.CipherSuites, cs)
@@ -106,10 +154,12 @@ func parseTLSClientHello(data []byte) *TLSClientHelloInfo {
 	if extEnd > len(data) {
 		extEnd = len(data)
 	}
+	info.extensionsAt = span{pos, extEnd - pos}
 
 	for pos+4 <= extEnd {
 		extType := binary.BigEndian.Uint16(data[pos : pos+2])
 		extDataLen := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		extAt := span{pos, 4 + extDataLen}
 		pos += 4
 
 		if pos+extDataLen > extEnd {
@@ -125,6 +175,7 @@ func parseTLSClientHello(data []byte) *TLSClientHelloInfo {
 				nameLen := int(binary.BigEndian.Uint16(sniData[3:5]))
 				if 5+nameLen <= len(sniData) {
 					info.SNI = string(sniData[5 : 5+nameLen])
+					info.sniAt = span{pos + 5, nameLen}
 				}
 			}
 		}
@@ -141,6 +192,25 @@ func parseTLSClientHello(data []byte) *TLSClientHelloInfo {
 			}
 		}
 
+		// ALPN (type 0x0010)
+		if extType == 0x0010 {
+			info.ALPN = parseALPNList(data[pos : pos+extDataLen])
+			info.alpnAt = extAt
+		}
+
+		// Resumption and 0-RTT signals
+		switch extType {
+		case 0x0023:
+			info.TicketLen = extDataLen
+			info.ticketAt = extAt
+		case 0x0029:
+			info.OffersPSK = true
+			info.pskAt = extAt
+		case 0x002a:
+			info.EarlyData = true
+			info.earlyDataAt = extAt
+		}
+
 		// EC Point Formats (type 0x000b)
 		if extType == 0x000b && extDataLen >= 1 {
 			fmtData := data[pos : pos+extDataLen]
@@ -157,6 +227,205 @@ func parseTLSClientHello(data []byte) *TLSClientHelloInfo {
 	return info
 }
 
+// parseTLSServerHello parses a TLS ServerHello from raw record data.
+func parseTLSServerHello(data []byte) *TLSServerHelloInfo {
+	// record header (5) + handshake header (4) + version (2) + random (32)
+	if len(data) < 43 || data[0] != 0x16 || data[5] != 0x02 {
+		return nil
+	}
+	info := &TLSServerHelloInfo{}
+	pos := 9
+
+	info.Version = binary.BigEndian.Uint16(data[pos : pos+2])
+	info.versionAt = span{pos, 2}
+	pos += 2 + 32
+
+	if len(data) < pos+1 {
+		return info
+	}
+	sidLen := int(data[pos])
+	pos++
+	if len(data) < pos+sidLen {
+		return info
+	}
+	info.SessionID = fmt.Sprintf("%x", data[pos:pos+sidLen])
+	info.sessionIDAt = span{pos, sidLen}
+	pos += sidLen
+
+	if len(data) < pos+3 {
+		return info
+	}
+	info.CipherSuite = binary.BigEndian.Uint16(data[pos : pos+2])
+	info.suiteAt = span{pos, 2}
+	pos += 3 // cipher suite + compression method
+
+	if len(data) < pos+2 {
+		return info
+	}
+	extEnd := pos + 2 + int(binary.BigEndian.Uint16(data[pos:pos+2]))
+	pos += 2
+	if extEnd > len(data) {
+		extEnd = len(data)
+	}
+	info.extensionsAt = span{pos, extEnd - pos}
+
+	for pos+4 <= extEnd {
+		extType := binary.BigEndian.Uint16(data[pos : pos+2])
+		extDataLen := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		extAt := span{pos, 4 + extDataLen}
+		pos += 4
+		if pos+extDataLen > extEnd {
+			break
+		}
+		info.Extensions = append(info.Extensions, extType)
+		ext := data[pos : pos+extDataLen]
+
+		switch extType {
+		case 0x002b: // supported_versions: the single selected version
+			if len(ext) >= 2 {
+				info.SelectedVersion = binary.BigEndian.Uint16(ext[0:2])
+				info.selectedAt = span{pos, 2}
+			}
+		case 0x0010: // ALPN: exactly one protocol in a ServerHello
+			if names := parseALPNList(ext); len(names) > 0 {
+				info.ALPN = names[0]
+				info.alpnAt = extAt
+			}
+		case 0x0029: // pre_shared_key: selected identity
+			info.AcceptsPSK = true
+			info.pskAt = extAt
+		}
+		pos += extDataLen
+	}
+	return info
+}
+
+// parseALPNList decodes an ALPN ProtocolNameList extension body.
+func parseALPNList(ext []byte) []string {
+	if len(ext) < 2 {
+		return nil
+	}
+	end := 2 + int(binary.BigEndian.Uint16(ext[0:2]))
+	if end > len(ext) {
+		end = len(ext)
+	}
+	var names []string
+	for pos := 2; pos < end; {
+		n := int(ext[pos])
+		pos++
+		if pos+n > end {
+			break
+		}
+		names = append(names, string(ext[pos:pos+n]))
+		pos += n
+	}
+	return names
+}
+
+// alpnLabels maps ALPN identifiers to display names.
+var alpnLabels = map[string]string{
+	"http/1.0":    "HTTP/1.0",
+	"http/1.1":    "HTTP/1.1",
+	"h2":          "HTTP/2",
+	"h2c":         "HTTP/2",
+	"h3":          "HTTP/3",
+	"spdy/3.1":    "SPDY",
+	"dot":         "DNS-over-TLS",
+	"doq":         "DNS-over-QUIC",
+	"imap":        "IMAP",
+	"pop3":        "POP3",
+	"smtp":        "SMTP",
+	"ftp":         "FTP",
+	"xmpp-client": "XMPP",
+	"mqtt":        "MQTT",
+	"stun.turn":   "TURN",
+	"acme-tls/1":  "ACME",
+}
+
+// ALPNLabel returns the display name for an ALPN protocol identifier.
+func ALPNLabel(alpn string) string {
+	if label, ok := alpnLabels[alpn]; ok {
+		return label
+	}
+	return alpn
+}
+
+// ExtractTLSHello returns the ClientHello or ServerHello carried by the
+// packet; at most one of the two is non-nil.
+func ExtractTLSHello(pkt gopacket.Packet) (*TLSClientHelloInfo, *TLSServerHelloInfo) {
+	app := pkt.ApplicationLayer()
+	if app == nil {
+		return nil, nil
+	}
+	data := app.LayerContents()
+	if sh := parseTLSServerHello(data); sh != nil {
+		return nil, sh
+	}
+	return parseTLSClientHello(data), nil
+}
+
+// ParseTLSClientHelloStream parses the ClientHello at the start of a TCP
+// connection's client data, which may span several segments and TLS
+// records. more is true when data ends before the ClientHello does; once
+// it is false, hello is the parsed ClientHello or nil if the stream does
+// not start with one.
+func ParseTLSClientHelloStream(data []byte) (hello *TLSClientHelloInfo, more bool) {
+	var hs []byte // handshake message reassembled from the record bodies
+	for pos := 0; ; {
+		if len(data) < pos+5 {
+			return nil, true
+		}
+		if data[pos] != 0x16 {
+			return nil, false
+		}
+		n := int(binary.BigEndian.Uint16(data[pos+3 : pos+5]))
+		if len(data) < pos+5+n {
+			return nil, true
+		}
+		hs = append(hs, data[pos+5:pos+5+n]...)
+		pos += 5 + n
+
+		if len(hs) < 4 {
+			continue
+		}
+		if hs[0] != 0x01 {
+			return nil, false
+		}
+		want := 4 + (int(hs[1])<<16 | int(hs[2])<<8 | int(hs[3]))
+		if len(hs) < want {
+			continue
+		}
+		if want > 0xffff {
+			return nil, false
+		}
+		record := append([]byte{0x16, data[1], data[2], byte(want >> 8), byte(want)}, hs[:want]...)
+		return parseTLSClientHello(record), false
+	}
+}
+
+// TLSVersionString returns the display name of a TLS protocol version.
+func TLSVersionString(v uint16) string {
+	return tlsVersionString(v)
+}
+
+// CipherSuiteName returns the IANA name of a cipher suite.
+func CipherSuiteName(cs uint16) string {
+	return cipherSuiteName(cs)
+}
+
+// NegotiatedALPN returns the ALPN protocol selected in a ServerHello, if the
+// packet carries one.
+func NegotiatedALPN(pkt gopacket.Packet) string {
+	app := pkt.ApplicationLayer()
+	if app == nil {
+		return ""
+	}
+	if sh := parseTLSServerHello(app.LayerContents()); sh != nil {
+		return sh.ALPN
+	}
+	return ""
+}
+
 // isGREASE returns true if the value is a GREASE value (RFC 8701).
 func isGREASE(val uint16) bool {
 	return (val & 0x0f0f) == 0x0a0a
@@ -250,22 +519,48 @@ func cipherSuiteName(cs uint16) string {
 	return fmt.Sprintf("0x%04x", cs)
 }
 
-// buildTLSLayerDetail builds a LayerDetail from gopacket TLS layer + raw data.
+// buildTLSLayerDetail builds a LayerDetail from gopacket TLS layer + raw
+// data. Field offsets are relative to rawData.
 func buildTLSLayerDetail(contentType string, version string, rawData []byte) models.LayerDetail {
 	fields := []models.LayerField{
-		{Name: "Content Type", Value: contentType},
-		{Name: "Version", Value: version},
+		{Name: "Content Type", Value: contentType, Offset: 0, Length: 1},
+		{Name: "Version", Value: version, Offset: 1, Length: 2},
+	}
+
+	if sh := parseTLSServerHello(rawData); sh != nil {
+		fields = append(fields,
+			models.LayerField{Name: "Handshake Type", Value: "Server Hello (2)", Offset: 5, Length: 1},
+			sh.versionAt.field("Legacy Version", tlsVersionString(sh.Version)),
+		)
+		if sh.SelectedVersion != 0 {
+			fields = append(fields, sh.selectedAt.field("Selected Version", tlsVersionString(sh.SelectedVersion)+" (supported_versions)"))
+		}
+		fields = append(fields, sh.suiteAt.field("Cipher Suite", cipherSuiteName(sh.CipherSuite)))
+		if sh.ALPN != "" {
+			fields = append(fields, sh.alpnAt.field("ALPN", sh.ALPN))
+		}
+		if sh.SessionID != "" {
+			fields = append(fields, sh.sessionIDAt.field("Session ID", sh.SessionID))
+		}
+		if sh.AcceptsPSK {
+			fields = append(fields, sh.pskAt.field("Pre-Shared Key", "Accepted (session resumed)"))
+		}
+		if len(sh.Extensions) > 0 {
+			extStrs := make([]string, 0, len(sh.Extensions))
+			for _, ext := range sh.Extensions {
+				extStrs = append(extStrs, fmt.Sprintf("%d", ext))
+			}
+			fields = append(fields, sh.extensionsAt.field("Extensions", strings.Join(extStrs, ", ")))
+		}
+		return models.LayerDetail{Name: "TLS", Fields: fields}
 	}
 
 	hello := parseTLSClientHello(rawData)
 	if hello != nil {
 		if hello.SNI != "" {
-			fields = append(fields, models.LayerField{Name: "SNI", Value: hello.SNI})
+			fields = append(fields, hello.sniAt.field("SNI", hello.SNI))
 		}
-		fields = append(fields, models.LayerField{
-			Name:  "Client Version",
-			Value: tlsVersionString(hello.Version),
-		})
+		fields = append(fields, hello.versionAt.field("Client Version", tlsVersionString(hello.Version)))
 		if len(hello.CipherSuites) > 0 {
 			// Show named cipher suites
 			named := make([]string, 0, len(hello.CipherSuites))
@@ -280,10 +575,7 @@ func buildTLSLayerDetail(contentType string, version string, rawData []byte) mod
 			if len(display) > 300 {
 				display = display[:300] + "..."
 			}
-			fields = append(fields, models.LayerField{
-				Name:  "Cipher Suites",
-				Value: fmt.Sprintf("%d suites: %s", len(hello.CipherSuites), display),
-			})
+			fields = append(fields, hello.suitesAt.field("Cipher Suites", fmt.Sprintf("%d suites: %s", len(hello.CipherSuites), display)))
 		}
 		if hello.JA3Hash != "" {
 			fields = append(fields, models.LayerField{
@@ -291,6 +583,21 @@ func buildTLSLayerDetail(contentType string, version string, rawData []byte) mod
 				Value: hello.JA3Hash,
 			})
 		}
+		if len(hello.ALPN) > 0 {
+			fields = append(fields, hello.alpnAt.field("ALPN", strings.Join(hello.ALPN, ", ")))
+		}
+		if hello.SessionID != "" {
+			fields = append(fields, hello.sessionIDAt.field("Session ID", hello.SessionID))
+		}
+		if hello.TicketLen > 0 {
+			fields = append(fields, hello.ticketAt.field("Session Ticket", fmt.Sprintf("Present (%d bytes)", hello.TicketLen)))
+		}
+		if hello.OffersPSK {
+			fields = append(fields, hello.pskAt.field("Pre-Shared Key", "Offered (resumption attempt)"))
+		}
+		if hello.EarlyData {
+			fields = append(fields, hello.earlyDataAt.field("Early Data", "Requested (0-RTT)"))
+		}
 		if len(hello.Extensions) > 0 {
 			extStrs := make([]string, 0, len(hello.Extensions))
 			for _, ext := range hello.Extensions {
@@ -298,10 +605,7 @@ func buildTLSLayerDetail(contentType string, version string, rawData []byte) mod
 					extStrs = append(extStrs, fmt.Sprintf("%d", ext))
 				}
 			}
-			fields = append(fields, models.LayerField{
-				Name:  "Extensions",
-				Value: strings.Join(extStrs, ", "),
-			})
+			fields = append(fields, hello.extensionsAt.field("Extensions", strings.Join(extStrs, ", ")))
 		}
 	}
 
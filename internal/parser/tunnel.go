@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/models"
+	"sniffox/internal/tunnel"
+)
+
+// tunnelLayers describes the tunnels stripped from pkt, outermost first.
+// Their headers are not part of the packet's bytes, so the fields have no
+// offsets.
+func tunnelLayers(pkt gopacket.Packet) []models.LayerDetail {
+	var out []models.LayerDetail
+	for _, t := range tunnel.From(pkt) {
+		out = append(out, buildTunnelLayerDetail(t))
+	}
+	return out
+}
+
+func buildTunnelLayerDetail(t tunnel.Tunnel) models.LayerDetail {
+	fields := []models.LayerField{
+		{Name: "Outer Source", Value: tunnelEndpoint(t.SrcIP, t.SrcPort)},
+		{Name: "Outer Destination", Value: tunnelEndpoint(t.DstIP, t.DstPort)},
+	}
+	switch t.Kind {
+	case tunnel.VXLAN:
+		fields = append(fields, models.LayerField{Name: "VNI", Value: fmt.Sprintf("%d", t.ID)})
+	case tunnel.GENEVE:
+		fields = append(fields,
+			models.LayerField{Name: "VNI", Value: fmt.Sprintf("%d", t.ID)},
+			models.LayerField{Name: "OAM", Value: boolToStr(t.OAM, "Yes", "No")},
+			models.LayerField{Name: "Options", Value: fmt.Sprintf("%d bytes", t.Options)},
+		)
+	case tunnel.GTPU:
+		fields = append(fields, models.LayerField{Name: "TEID", Value: fmt.Sprintf("0x%08x", t.ID)})
+	case tunnel.ERSPAN:
+		fields = append(fields, models.LayerField{Name: "Type", Value: fmt.Sprintf("%d", t.Version)})
+		if t.Version > 1 {
+			fields = append(fields,
+				models.LayerField{Name: "Session ID", Value: fmt.Sprintf("%d", t.ID)},
+				models.LayerField{Name: "VLAN", Value: fmt.Sprintf("%d", t.VLAN)},
+			)
+		}
+	}
+	fields = append(fields, models.LayerField{Name: "Encapsulation", Value: fmt.Sprintf("%d bytes", t.HeaderLen)})
+	return models.LayerDetail{Name: t.Kind, Fields: fields}
+}
+
+func tunnelEndpoint(ip string, port uint16) string {
+	if port == 0 {
+		return ip
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(int(port)))
+}
+
+// tunnelInfo returns the info parts naming the tunnels pkt was carried
+// in, outermost first.
+func tunnelInfo(pkt gopacket.Packet) []models.InfoPart {
+	var out []models.InfoPart
+	for _, t := range tunnel.From(pkt) {
+		switch {
+		case t.Kind == tunnel.ERSPAN && t.Version == 1:
+			out = append(out, infoPart("erspan"))
+		case t.Kind == tunnel.ERSPAN:
+			out = append(out, infoPart("erspan.session", "session", fmt.Sprintf("%d", t.ID)))
+		case t.Kind == tunnel.GTPU:
+			out = append(out, infoPart("gtpu", "teid", fmt.Sprintf("0x%08x", t.ID)))
+		default:
+			out = append(out, infoPart("tunnel", "kind", t.Kind, "vni", fmt.Sprintf("%d", t.ID)))
+		}
+	}
+	return out
+}
@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Pre-standard QinQ tag protocol identifiers, still used by some switches
+// for the outer tag. gopacket only knows 0x8100 and 0x88a8.
+const (
+	ethernetTypeQinQ9100 layers.EthernetType = 0x9100
+	ethernetTypeQinQ9200 layers.EthernetType = 0x9200
+	ethernetTypeQinQ9300 layers.EthernetType = 0x9300
+)
+
+func init() {
+	for _, t := range []layers.EthernetType{ethernetTypeQinQ9100, ethernetTypeQinQ9200, ethernetTypeQinQ9300} {
+		layers.EthernetTypeMetadata[t] = layers.EnumMetadata{DecodeWith: layers.LayerTypeDot1Q, Name: "QinQ", LayerType: layers.LayerTypeDot1Q}
+	}
+}
+
+// vlanTPID returns the tag protocol identifier that introduced tag: the
+// type field of the layer before it.
+func vlanTPID(pkt gopacket.Packet, tag *layers.Dot1Q) layers.EthernetType {
+	var tpid layers.EthernetType
+	for _, l := range pkt.Layers() {
+		if l == tag {
+			return tpid
+		}
+		switch l := l.(type) {
+		case *layers.Ethernet:
+			tpid = l.EthernetType
+		case *layers.LinuxSLL:
+			tpid = l.EthernetType
+		case *LinuxSLL2:
+			tpid = l.EthernetType
+		case *layers.Dot1Q:
+			tpid = l.Type
+		}
+	}
+	return tpid
+}
+
+// isServiceTag reports whether a tag with this TPID is an outer (service)
+// tag rather than an 802.1Q customer tag.
+func isServiceTag(tpid layers.EthernetType) bool {
+	switch tpid {
+	case layers.EthernetTypeQinQ, ethernetTypeQinQ9100, ethernetTypeQinQ9200, ethernetTypeQinQ9300:
+		return true
+	}
+	return false
+}
+
+// vlanIDs returns the VLAN IDs of pkt's tags, outermost first.
+func vlanIDs(pkt gopacket.Packet) []uint16 {
+	var ids []uint16
+	for _, l := range pkt.Layers() {
+		if q, ok := l.(*layers.Dot1Q); ok {
+			ids = append(ids, q.VLANIdentifier)
+		}
+	}
+	return ids
+}
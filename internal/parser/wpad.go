@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+)
+
+// Web Proxy Auto-Discovery (WPAD). Clients locate a proxy auto-config
+// (PAC) script through DHCP option 252 or by resolving "wpad.<domain>",
+// then fetch it over HTTP. Whoever answers first controls the client's
+// proxy, which makes WPAD a classic interception vector.
+
+// DHCPOptWPAD is the private-use DHCP option carrying the PAC URL.
+const DHCPOptWPAD layers.DHCPOpt = 252
+
+const pacPreviewLen = 2048
+
+// PACInfo describes a PAC file request or response seen in an HTTP segment.
+type PACInfo struct {
+	Response    bool
+	URI         string
+	ContentType string
+	Content     string   // response body in this segment, capped at pacPreviewLen
+	Proxies     []string // PROXY/SOCKS directives found in the content
+	Truncated   bool
+}
+
+var (
+	pacContentTypes = map[string]bool{
+		"application/x-ns-proxy-autoconfig": true,
+		"application/x-javascript-config":   true,
+	}
+	pacDirective = regexp.MustCompile(`(?i)\b(PROXY|SOCKS[45]?|HTTPS)\s+([A-Za-z0-9._\-\[\]:]+)`)
+)
+
+// IsWPADName reports whether a DNS/LLMNR/NetBIOS name is a WPAD lookup.
+func IsWPADName(name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	return name == "wpad" || strings.HasPrefix(name, "wpad.")
+}
+
+// IsPACPath reports whether an HTTP request path looks like a PAC fetch.
+func IsPACPath(uri string) bool {
+	path := uri
+	if q := strings.IndexAny(path, "?#"); q >= 0 {
+		path = path[:q]
+	}
+	path = strings.ToLower(path)
+	return strings.HasSuffix(path, "/wpad.dat") || strings.HasSuffix(path, ".pac")
+}
+
+// DHCPWPAD returns the DHCP option 252 state of a packet: whether the
+// client asked for it in the parameter request list and the URL the server
+// supplied, if any.
+func DHCPWPAD(dhcp *layers.DHCPv4) (requested bool, url string) {
+	for _, opt := range dhcp.Options {
+		switch opt.Type {
+		case layers.DHCPOptParamsRequest:
+			for _, b := range opt.Data {
+				if layers.DHCPOpt(b) == DHCPOptWPAD {
+					requested = true
+				}
+			}
+		case DHCPOptWPAD:
+			url = strings.TrimRight(string(opt.Data), "\x00")
+		}
+	}
+	return requested, url
+}
+
+// ExtractPAC finds a PAC file request or response in the packet payload.
+func ExtractPAC(pkt gopacket.Packet) *PACInfo {
+	app := pkt.ApplicationLayer()
+	if app == nil {
+		return nil
+	}
+	return findPAC(app.Payload())
+}
+
+func findPAC(data []byte) *PACInfo {
+	msg := splitHTTPMessage(data)
+	if msg == nil {
+		return nil
+	}
+	if !msg.isResponse() {
+		uri := msg.requestURI()
+		if !IsPACPath(uri) {
+			return nil
+		}
+		return &PACInfo{URI: uri}
+	}
+
+	ct := msg.contentType()
+	if !pacContentTypes[ct] {
+		return nil
+	}
+	info := &PACInfo{Response: true, ContentType: ct, Truncated: msg.truncated()}
+	body := msg.body
+	if len(body) > pacPreviewLen {
+		body = body[:pacPreviewLen]
+		info.Truncated = true
+	}
+	info.Content = string(body)
+
+	seen := make(map[string]bool)
+	for _, m := range pacDirective.FindAllStringSubmatch(info.Content, -1) {
+		p := strings.ToUpper(m[1]) + " " + m[2]
+		if !seen[p] {
+			seen[p] = true
+			info.Proxies = append(info.Proxies, p)
+		}
+	}
+	return info
+}
+
+// Summary returns a one-line description for the Info column.
+func (p *PACInfo) Summary() string {
+	if !p.Response {
+		return "[PAC request]"
+	}
+	if len(p.Proxies) > 0 {
+		return "[PAC: " + strings.Join(p.Proxies, "; ") + "]"
+	}
+	return "[PAC file]"
+}
+
+func buildPACLayerDetail(p *PACInfo) models.LayerDetail {
+	fields := []models.LayerField{
+		{Name: "Message", Value: boolToStr(p.Response, "PAC Response", "PAC Request")},
+	}
+	if p.URI != "" {
+		fields = append(fields, models.LayerField{Name: "URI", Value: p.URI})
+	}
+	if p.ContentType != "" {
+		fields = append(fields, models.LayerField{Name: "Content-Type", Value: p.ContentType})
+	}
+	if len(p.Proxies) > 0 {
+		fields = append(fields, models.LayerField{Name: "Proxies", Value: strings.Join(p.Proxies, "; ")})
+	}
+	if p.Response {
+		content := p.Content
+		if p.Truncated {
+			content += "\n… (continues in TCP stream)"
+		}
+		fields = append(fields, models.LayerField{Name: "Script", Value: content})
+	}
+	return models.LayerDetail{Name: "PAC", Fields: fields}
+}
@@ -0,0 +1,135 @@
+// Package pktdiff compares the decoded layer trees of two packets field by
+// field, for lining up a working and a failing request side by side.
+package pktdiff
+
+import (
+	"fmt"
+	"strings"
+
+	"sniffox/internal/models"
+)
+
+// Change kinds.
+const (
+	Changed = "changed" // present in both with different values
+	Added   = "added"   // only in packet B
+	Removed = "removed" // only in packet A
+)
+
+// FieldDiff is one field that differs between the packets.
+type FieldDiff struct {
+	Path   string `json:"path"` // field names from the layer down, joined by " > "
+	Change string `json:"change"`
+	A      string `json:"a,omitempty"`
+	B      string `json:"b,omitempty"`
+}
+
+// LayerDiff compares one layer. Layers are paired by name and position, so
+// the second VLAN tag of A is compared with the second of B.
+type LayerDiff struct {
+	Name      string      `json:"name"`
+	Change    string      `json:"change,omitempty"` // empty when in both
+	Fields    []FieldDiff `json:"fields,omitempty"`
+	Unchanged int         `json:"unchanged"` // fields equal in both
+}
+
+// Diff is the comparison of packet A with packet B.
+type Diff struct {
+	A      models.PacketSummary `json:"a"`
+	B      models.PacketSummary `json:"b"`
+	Layers []LayerDiff          `json:"layers"`
+	Equal  bool                 `json:"equal"` // no field differs
+}
+
+// Compare diffs a against b, skipping fields whose name is in ignore (such
+// as "Checksum" or "Identification", which differ in every pair).
+func Compare(a, b *models.PacketInfo, ignore []string) Diff {
+	skip := make(map[string]bool, len(ignore))
+	for _, name := range ignore {
+		skip[strings.ToLower(name)] = true
+	}
+	d := Diff{A: a.Summary(), B: b.Summary(), Layers: []LayerDiff{}, Equal: true}
+
+	bLayers := keyed(b.Layers, func(l models.LayerDetail) string { return l.Name })
+	used := make(map[string]bool)
+	for _, k := range keys(a.Layers, func(l models.LayerDetail) string { return l.Name }) {
+		la := a.Layers[k.index]
+		ld := LayerDiff{Name: la.Name}
+		if j, ok := bLayers[k.key]; ok {
+			used[k.key] = true
+			compareFields(&ld, "", la.Fields, b.Layers[j].Fields, skip)
+		} else {
+			ld.Change = Removed
+		}
+		d.Layers = append(d.Layers, ld)
+	}
+	for _, k := range keys(b.Layers, func(l models.LayerDetail) string { return l.Name }) {
+		if !used[k.key] {
+			d.Layers = append(d.Layers, LayerDiff{Name: b.Layers[k.index].Name, Change: Added})
+		}
+	}
+	for _, l := range d.Layers {
+		if l.Change != "" || len(l.Fields) > 0 {
+			d.Equal = false
+		}
+	}
+	return d
+}
+
+func compareFields(ld *LayerDiff, prefix string, a, b []models.LayerField, skip map[string]bool) {
+	name := func(f models.LayerField) string { return f.Name }
+	bFields := keyed(b, name)
+	used := make(map[string]bool)
+	for _, k := range keys(a, name) {
+		fa := a[k.index]
+		if skip[strings.ToLower(fa.Name)] {
+			continue
+		}
+		path := prefix + fa.Name
+		j, ok := bFields[k.key]
+		if !ok {
+			ld.Fields = append(ld.Fields, FieldDiff{Path: path, Change: Removed, A: fa.Value})
+			continue
+		}
+		used[k.key] = true
+		fb := b[j]
+		if fa.Value != fb.Value {
+			ld.Fields = append(ld.Fields, FieldDiff{Path: path, Change: Changed, A: fa.Value, B: fb.Value})
+		} else {
+			ld.Unchanged++
+		}
+		compareFields(ld, path+" > ", fa.Children, fb.Children, skip)
+	}
+	for _, k := range keys(b, name) {
+		fb := b[k.index]
+		if !used[k.key] && !skip[strings.ToLower(fb.Name)] {
+			ld.Fields = append(ld.Fields, FieldDiff{Path: prefix + fb.Name, Change: Added, B: fb.Value})
+		}
+	}
+}
+
+// key identifies an element by its name and how many of that name came
+// before it, so repeated fields pair up in order.
+type key struct {
+	key   string
+	index int
+}
+
+func keys[T any](items []T, name func(T) string) []key {
+	seen := make(map[string]int)
+	out := make([]key, len(items))
+	for i, it := range items {
+		n := name(it)
+		out[i] = key{key: fmt.Sprintf("%s#%d", n, seen[n]), index: i}
+		seen[n]++
+	}
+	return out
+}
+
+func keyed[T any](items []T, name func(T) string) map[string]int {
+	m := make(map[string]int, len(items))
+	for _, k := range keys(items, name) {
+		m[k.key] = k.index
+	}
+	return m
+}
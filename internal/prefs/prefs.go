@@ -0,0 +1,117 @@
+// Package prefs stores user preferences (column layouts, default filters,
+// theme, pinned interfaces) as one JSON file per user, so settings follow
+// a user across browsers and restarts. Values are opaque to the server.
+package prefs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// DefaultUser owns the preferences of requests that name no user.
+const DefaultUser = "default"
+
+// maxKeys caps the preferences kept per user.
+const maxKeys = 256
+
+var validUser = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Store reads and writes preference files under a directory.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewStore creates a store keeping its files in dir, which is created on
+// the first write.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Get returns the preferences of user, empty if none were saved.
+func (s *Store) Get(user string) (map[string]json.RawMessage, error) {
+	path, err := s.path(user)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return load(path)
+}
+
+// Update merges changes into the preferences of user and saves them. A
+// null value removes its key. It returns the resulting preferences.
+func (s *Store) Update(user string, changes map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	path, err := s.path(user)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefs, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range changes {
+		if k == "" {
+			return nil, fmt.Errorf("empty preference key")
+		}
+		if string(v) == "null" {
+			delete(prefs, k)
+		} else {
+			prefs[k] = v
+		}
+	}
+	if len(prefs) > maxKeys {
+		return nil, fmt.Errorf("too many preferences (at most %d)", maxKeys)
+	}
+
+	data, err := json.MarshalIndent(prefs, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+// path returns the file of user, rejecting names that are not plain
+// identifiers, which also rules out path traversal.
+func (s *Store) path(user string) (string, error) {
+	if user == "" {
+		user = DefaultUser
+	}
+	if !validUser.MatchString(user) || user[0] == '.' {
+		return "", fmt.Errorf("invalid user name %q", user)
+	}
+	return filepath.Join(s.dir, user+".json"), nil
+}
+
+func load(path string) (map[string]json.RawMessage, error) {
+	prefs := make(map[string]json.RawMessage)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return prefs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return prefs, nil
+}
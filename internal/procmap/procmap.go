@@ -0,0 +1,116 @@
+// Package procmap attributes local sockets to the processes that own them,
+// for traffic captured on the host itself.
+package procmap
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// minRefresh rate-limits socket table rebuilds.
+const minRefresh = 500 * time.Millisecond
+
+// Process identifies a socket owner.
+type Process struct {
+	PID  int
+	Name string
+}
+
+// socket is one entry of the host socket table.
+type socket struct {
+	proto  string // "TCP" or "UDP"
+	local  string // ip:port
+	remote string // ip:port, "" for unconnected sockets
+	inode  uint64
+}
+
+// Resolver maps flow endpoints to owning processes using a periodically
+// rebuilt snapshot of the host socket table.
+type Resolver struct {
+	mu        sync.Mutex
+	refreshed time.Time
+	connected map[string]Process // proto|local|remote
+	bound     map[string]Process // proto|local, plus proto|*:port for wildcard binds
+}
+
+// New creates a resolver. Lookups always miss on platforms without
+// support; see Supported.
+func New() *Resolver {
+	return &Resolver{}
+}
+
+// Lookup returns the process owning the local end of the flow between a and
+// b, trying either address as the local one. The socket table is rebuilt
+// at most every minRefresh.
+func (r *Resolver) Lookup(proto, ipA string, portA uint16, ipB string, portB uint16) (Process, bool) {
+	if !Supported() || (proto != "TCP" && proto != "UDP") {
+		return Process{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.refreshed) >= minRefresh {
+		r.refresh()
+	}
+	a := endpoint(ipA, portA)
+	b := endpoint(ipB, portB)
+	if p, ok := r.connected[proto+"|"+a+"|"+b]; ok {
+		return p, true
+	}
+	if p, ok := r.connected[proto+"|"+b+"|"+a]; ok {
+		return p, true
+	}
+	for _, ep := range []struct {
+		addr string
+		port uint16
+	}{{a, portA}, {b, portB}} {
+		if p, ok := r.bound[proto+"|"+ep.addr]; ok {
+			return p, true
+		}
+		if p, ok := r.bound[proto+"|*:"+strconv.Itoa(int(ep.port))]; ok {
+			return p, true
+		}
+	}
+	return Process{}, false
+}
+
+func (r *Resolver) refresh() {
+	r.refreshed = time.Now()
+	r.connected = make(map[string]Process)
+	r.bound = make(map[string]Process)
+
+	sockets := readSockets()
+	if len(sockets) == 0 {
+		return
+	}
+	owners := socketOwners()
+	for _, s := range sockets {
+		p, ok := owners[s.inode]
+		if !ok {
+			continue
+		}
+		if s.remote != "" {
+			r.connected[s.proto+"|"+s.local+"|"+s.remote] = p
+			continue
+		}
+		r.bound[s.proto+"|"+s.local] = p
+		if host, port, err := net.SplitHostPort(s.local); err == nil {
+			if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+				r.bound[s.proto+"|*:"+port] = p
+			}
+		}
+	}
+}
+
+func endpoint(ip string, port uint16) string {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		if v4 := parsed.To4(); v4 != nil {
+			ip = v4.String()
+		} else {
+			ip = parsed.String()
+		}
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(int(port)))
+}
@@ -0,0 +1,110 @@
+//go:build linux
+
+package procmap
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Supported reports whether process attribution works on this platform.
+func Supported() bool {
+	return true
+}
+
+// readSockets parses /proc/net/{tcp,tcp6,udp,udp6}.
+func readSockets() []socket {
+	var out []socket
+	for _, src := range []struct{ file, proto string }{
+		{"tcp", "TCP"}, {"tcp6", "TCP"}, {"udp", "UDP"}, {"udp6", "UDP"},
+	} {
+		f, err := os.Open(filepath.Join("/proc/net", src.file))
+		if err != nil {
+			continue
+		}
+		sc := bufio.NewScanner(f)
+		sc.Scan() // header
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) < 10 {
+				continue
+			}
+			local, ok1 := parseProcAddr(fields[1])
+			remote, ok2 := parseProcAddr(fields[2])
+			inode, err := strconv.ParseUint(fields[9], 10, 64)
+			if !ok1 || !ok2 || err != nil || inode == 0 {
+				continue
+			}
+			s := socket{proto: src.proto, local: local, inode: inode}
+			if !strings.HasSuffix(fields[2], ":0000") {
+				s.remote = remote
+			}
+			out = append(out, s)
+		}
+		f.Close()
+	}
+	return out
+}
+
+// parseProcAddr decodes "0100007F:0050" (IPv4) or the 32-digit IPv6 form.
+// Addresses are stored as 32-bit words in host (little-endian) order.
+func parseProcAddr(s string) (string, bool) {
+	hexIP, hexPort, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", false
+	}
+	raw, err := hex.DecodeString(hexIP)
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return "", false
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return "", false
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	return endpoint(ip.String(), uint16(port)), true
+}
+
+// socketOwners maps socket inodes to processes by walking /proc/*/fd.
+// Processes we may not inspect are skipped, so attribution is complete
+// only when running as root.
+func socketOwners() map[uint64]Process {
+	owners := make(map[uint64]Process)
+	procs, _ := os.ReadDir("/proc")
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join("/proc", p.Name(), "fd")
+		fds, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		var name string
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(dir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(link[len("socket:["):], "]"), 10, 64)
+			if err != nil {
+				continue
+			}
+			if name == "" {
+				comm, _ := os.ReadFile(filepath.Join("/proc", p.Name(), "comm"))
+				name = strings.TrimSpace(string(comm))
+			}
+			owners[inode] = Process{PID: pid, Name: name}
+		}
+	}
+	return owners
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package procmap
+
+// Supported reports whether process attribution works on this platform.
+func Supported() bool {
+	return false
+}
+
+func readSockets() []socket {
+	return nil
+}
+
+func socketOwners() map[uint64]Process {
+	return nil
+}
@@ -0,0 +1,198 @@
+// Package profiles keeps named capture configurations on the server: what
+// to capture and how, the decode-as rules the traffic needs and the display
+// filter to look at it through, so a usual capture starts in one click.
+package profiles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"sniffox/internal/filter"
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+)
+
+// maxProfiles caps the profiles kept.
+const maxProfiles = 256
+
+// ErrNotFound is returned for a profile that does not exist.
+var ErrNotFound = errors.New("profile not found")
+
+// Profile is a named capture configuration. Capture holds the interface,
+// BPF filter, snap length and ring buffer (retention and rotation) limits.
+type Profile struct {
+	Name          string                     `json:"name"`
+	Description   string                     `json:"description,omitempty"`
+	Capture       models.StartCaptureRequest `json:"capture"`
+	DecodeAs      []parser.DecodeAsRule      `json:"decodeAs,omitempty"`
+	DisplayFilter string                     `json:"displayFilter,omitempty"`
+}
+
+// Check validates p and canonicalizes its decode-as rules.
+func (p *Profile) Check() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" || utf8.RuneCountInString(p.Name) > 64 || strings.ContainsAny(p.Name, "/\\") {
+		return fmt.Errorf("profile name must be 1-64 characters without slashes")
+	}
+	if len(p.Capture.Interface) == 0 {
+		return fmt.Errorf("profile %s: no interface", p.Name)
+	}
+	if p.Capture.SnapLen < 0 || p.Capture.MaxPackets < 0 || p.Capture.MaxBytes < 0 || p.Capture.MaxDuration < 0 ||
+		p.Capture.RotateMB < 0 || p.Capture.RotateSeconds < 0 || p.Capture.RotateFiles < 0 {
+		return fmt.Errorf("profile %s: negative limit", p.Name)
+	}
+	rules, err := parser.CheckDecodeAs(p.DecodeAs)
+	if err != nil {
+		return fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	p.DecodeAs = rules
+	if p.DisplayFilter != "" {
+		if _, err := filter.Compile(p.DisplayFilter); err != nil {
+			return fmt.Errorf("profile %s: display filter: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// Store holds the profiles, saved to a JSON file. It is safe for
+// concurrent use.
+type Store struct {
+	mu       sync.Mutex
+	path     string // "" keeps them in memory only
+	profiles map[string]Profile
+}
+
+// New creates an empty store kept in memory only.
+func New() *Store {
+	return &Store{profiles: make(map[string]Profile)}
+}
+
+// Open creates a store saved to path, loading the profiles already there.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, profiles: make(map[string]Profile)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Profile
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, p := range list {
+		if err := p.Check(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		s.profiles[p.Name] = p
+	}
+	return s, nil
+}
+
+// List returns the profiles sorted by name.
+func (s *Store) List() []Profile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+func (s *Store) list() []Profile {
+	out := make([]Profile, 0, len(s.profiles))
+	for _, p := range s.profiles {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Get returns the profile called name.
+func (s *Store) Get(name string) (Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.profiles[name]
+	if !ok {
+		return Profile{}, ErrNotFound
+	}
+	return p, nil
+}
+
+// Put adds p, or replaces the profile of the same name, and saves the
+// store. It returns p as stored.
+func (s *Store) Put(p Profile) (Profile, error) {
+	if err := p.Check(); err != nil {
+		return Profile{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, existed := s.profiles[p.Name]
+	if !existed && len(s.profiles) >= maxProfiles {
+		return Profile{}, fmt.Errorf("too many profiles (at most %d)", maxProfiles)
+	}
+	s.profiles[p.Name] = p
+	if err := s.save(); err != nil {
+		if existed {
+			s.profiles[p.Name] = old
+		} else {
+			delete(s.profiles, p.Name)
+		}
+		return Profile{}, err
+	}
+	return p, nil
+}
+
+// Delete removes the profile called name and saves the store.
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.profiles[name]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.profiles, name)
+	if err := s.save(); err != nil {
+		s.profiles[name] = old
+		return err
+	}
+	return nil
+}
+
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// MergeDecodeAs returns the decode-as table with the profile's rules
+// added, replacing any rule for the same transport and port.
+func MergeDecodeAs(table, rules []parser.DecodeAsRule) []parser.DecodeAsRule {
+	out := make([]parser.DecodeAsRule, 0, len(table)+len(rules))
+	for _, t := range table {
+		replaced := false
+		for _, r := range rules {
+			if r.Transport == t.Transport && r.Port == t.Port {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			out = append(out, t)
+		}
+	}
+	return append(out, rules...)
+}
@@ -0,0 +1,213 @@
+package rules
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// addrSpec is a rule's source or destination: an address matches if it is
+// in one of the included networks (any when there are none) and in none
+// of the excluded ones.
+type addrSpec struct {
+	include, exclude []*net.IPNet
+}
+
+func (a addrSpec) match(ip net.IP) bool {
+	if ip == nil {
+		return len(a.include) == 0 && len(a.exclude) == 0
+	}
+	for _, n := range a.exclude {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(a.include) == 0 {
+		return true
+	}
+	for _, n := range a.include {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAddrs parses "any", an address, a CIDR, a $VARIABLE or a
+// bracketed list of them, each optionally negated with !.
+func parseAddrs(s string, vars Vars) (addrSpec, error) {
+	s, err := vars.expand(s, 0)
+	if err != nil {
+		return addrSpec{}, err
+	}
+	var a addrSpec
+	err = walkList(s, false, func(item string, negated bool) error {
+		if item == "any" {
+			if negated {
+				return fmt.Errorf("!any never matches")
+			}
+			return nil
+		}
+		n, err := parseNet(item)
+		if err != nil {
+			return err
+		}
+		if negated {
+			a.exclude = append(a.exclude, n)
+		} else {
+			a.include = append(a.include, n)
+		}
+		return nil
+	})
+	return a, err
+}
+
+func parseNet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or CIDR", s)
+		}
+		return n, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("%q is not an address or CIDR", s)
+	}
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// walkList calls fn for each item of a possibly nested, possibly negated
+// list such as "[1.2.3.4,![10.0.0.0/8,!10.1.0.0/16]]", telling it whether
+// the item ends up negated.
+func walkList(s string, negated bool, fn func(item string, negated bool) error) error {
+	s = strings.TrimSpace(s)
+	for strings.HasPrefix(s, "!") {
+		negated = !negated
+		s = strings.TrimSpace(s[1:])
+	}
+	if s == "" {
+		return fmt.Errorf("empty list item")
+	}
+	if s[0] != '[' {
+		return fn(s, negated)
+	}
+	if s[len(s)-1] != ']' {
+		return fmt.Errorf("unbalanced brackets in %q", s)
+	}
+	depth, start := 0, 1
+	inner := s[:len(s)-1]
+	for i := 1; i <= len(inner); i++ {
+		if i < len(inner) {
+			switch inner[i] {
+			case '[':
+				depth++
+				continue
+			case ']':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		if depth != 0 {
+			return fmt.Errorf("unbalanced brackets in %q", s)
+		}
+		if err := walkList(inner[start:i], negated, fn); err != nil {
+			return err
+		}
+		start = i + 1
+	}
+	return nil
+}
+
+// portSpec is a rule's source or destination ports, matched like
+// addrSpec.
+type portSpec struct {
+	include, exclude [][2]uint16
+}
+
+func (p portSpec) match(port uint16) bool {
+	for _, r := range p.exclude {
+		if port >= r[0] && port <= r[1] {
+			return false
+		}
+	}
+	if len(p.include) == 0 {
+		return true
+	}
+	for _, r := range p.include {
+		if port >= r[0] && port <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePorts parses "any", a port, a range such as 1024: or 80:90, a
+// $VARIABLE or a bracketed list of them, each optionally negated with !.
+func parsePorts(s string, vars Vars) (portSpec, error) {
+	s, err := vars.expand(s, 0)
+	if err != nil {
+		return portSpec{}, err
+	}
+	var p portSpec
+	err = walkList(s, false, func(item string, negated bool) error {
+		if item == "any" {
+			if negated {
+				return fmt.Errorf("!any never matches")
+			}
+			return nil
+		}
+		r, err := parsePortRange(item)
+		if err != nil {
+			return err
+		}
+		if negated {
+			p.exclude = append(p.exclude, r)
+		} else {
+			p.include = append(p.include, r)
+		}
+		return nil
+	})
+	return p, err
+}
+
+func parsePortRange(s string) ([2]uint16, error) {
+	bad := fmt.Errorf("%q is not a port or port range", s)
+	port := func(s string, def uint16) (uint16, error) {
+		if s == "" {
+			return def, nil
+		}
+		n, err := strconv.ParseUint(s, 10, 16)
+		if err != nil {
+			return 0, bad
+		}
+		return uint16(n), nil
+	}
+	lo, hi, isRange := strings.Cut(s, ":")
+	a, err := port(lo, 0)
+	if err != nil {
+		return [2]uint16{}, err
+	}
+	if !isRange {
+		if lo == "" {
+			return [2]uint16{}, bad
+		}
+		return [2]uint16{a, a}, nil
+	}
+	b, err := port(hi, 0xffff)
+	if err != nil || b < a {
+		return [2]uint16{}, bad
+	}
+	return [2]uint16{a, b}, nil
+}
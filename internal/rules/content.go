@@ -0,0 +1,276 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxCandidates caps the occurrences of one content or PCRE tried when
+// the rest of a rule fails to match after it.
+const maxCandidates = 64
+
+// buffer is the data a rule's contents are matched against: a packet
+// payload, or the retained part of a reassembled stream that starts base
+// bytes into it.
+type buffer struct {
+	data  []byte
+	lower []byte // data in lower case, made when a nocase content needs it
+	base  int64
+}
+
+func (b *buffer) folded() []byte {
+	if b.lower == nil {
+		b.lower = bytes.ToLower(b.data)
+	}
+	return b.lower
+}
+
+// matcher is a content or pcre option.
+type matcher interface {
+	isNegated() bool
+	// candidates returns the [start, end) ranges in b where the option
+	// matches, given where the previous match ended
+	candidates(b *buffer, prevEnd int) [][2]int
+	check() error
+}
+
+// content is a content option with its modifiers.
+type content struct {
+	pattern  []byte
+	negated  bool
+	nocase   bool
+	offset   int
+	depth    int // 0 is unlimited
+	distance int
+	within   int // 0 is unlimited
+	relative bool
+	endsWith bool
+	hasAbs   bool // offset or depth set
+}
+
+// parseContent parses a content value: a quoted string in which |41 42|
+// stands for bytes given in hex, optionally negated with !.
+func parseContent(val string) (*content, error) {
+	c := &content{}
+	if strings.HasPrefix(val, "!") {
+		c.negated = true
+		val = strings.TrimSpace(val[1:])
+	}
+	s, err := unquote(val)
+	if err != nil {
+		return nil, err
+	}
+	for s != "" {
+		bar := strings.IndexByte(s, '|')
+		if bar < 0 {
+			c.pattern = append(c.pattern, s...)
+			break
+		}
+		c.pattern = append(c.pattern, s[:bar]...)
+		end := strings.IndexByte(s[bar+1:], '|')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated |hex| in content")
+		}
+		h := strings.Join(strings.Fields(s[bar+1:bar+1+end]), "")
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, fmt.Errorf("bad hex %q in content", s[bar+1:bar+1+end])
+		}
+		c.pattern = append(c.pattern, b...)
+		s = s[bar+end+2:]
+	}
+	if len(c.pattern) == 0 {
+		return nil, fmt.Errorf("empty content")
+	}
+	return c, nil
+}
+
+// modify applies a content modifier keyword.
+func (c *content) modify(key, val string) error {
+	num := func() (int, error) {
+		n, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", val)
+		}
+		return n, nil
+	}
+	var err error
+	switch key {
+	case "nocase":
+		c.nocase = true
+		c.pattern = bytes.ToLower(c.pattern)
+	case "offset":
+		c.offset, err = num()
+		c.hasAbs = true
+	case "depth":
+		c.depth, err = num()
+		c.hasAbs = true
+	case "distance":
+		c.distance, err = num()
+		c.relative = true
+	case "within":
+		c.within, err = num()
+		c.relative = true
+	case "startswith":
+		c.offset, c.depth, c.hasAbs = 0, len(c.pattern), true
+	case "endswith":
+		c.endsWith = true
+	}
+	return err
+}
+
+func (c *content) check() error {
+	switch {
+	case c.hasAbs && c.relative:
+		return fmt.Errorf("content mixes offset/depth with distance/within")
+	case c.offset < 0 || c.depth < 0 || c.within < 0:
+		return fmt.Errorf("content offset, depth and within must not be negative")
+	case c.depth > 0 && c.depth < len(c.pattern):
+		return fmt.Errorf("content depth is shorter than the pattern")
+	case c.within > 0 && c.within < len(c.pattern):
+		return fmt.Errorf("content within is shorter than the pattern")
+	}
+	return nil
+}
+
+func (c *content) isNegated() bool { return c.negated }
+
+func (c *content) candidates(b *buffer, prevEnd int) [][2]int {
+	data := b.data
+	if c.nocase {
+		data = b.folded()
+	}
+	lo, hi := 0, len(data)
+	if c.relative {
+		lo = prevEnd + c.distance
+		if c.within > 0 {
+			hi = min(hi, prevEnd+c.distance+c.within)
+		}
+	} else {
+		// offset and depth count from the start of the stream
+		lo = c.offset - int(b.base)
+		if c.depth > 0 {
+			hi = min(hi, c.offset+c.depth-int(b.base))
+		}
+	}
+	lo = max(lo, 0)
+	if c.endsWith {
+		lo = max(lo, hi-len(c.pattern))
+	}
+	var out [][2]int
+	for lo+len(c.pattern) <= hi && len(out) < maxCandidates {
+		i := bytes.Index(data[lo:hi], c.pattern)
+		if i < 0 {
+			break
+		}
+		start := lo + i
+		if !c.endsWith || start+len(c.pattern) == len(data) {
+			out = append(out, [2]int{start, start + len(c.pattern)})
+		}
+		lo = start + 1
+	}
+	return out
+}
+
+// pcre is a pcre option. Go's regexp is RE2, so backreferences and
+// lookaround make a rule fail to load.
+type pcre struct {
+	re       *regexp.Regexp
+	negated  bool
+	relative bool
+}
+
+// parsePCRE parses "/pattern/flags", optionally negated with !. The i, s,
+// m and R flags are supported.
+func parsePCRE(val string) (*pcre, error) {
+	p := &pcre{}
+	if strings.HasPrefix(val, "!") {
+		p.negated = true
+		val = strings.TrimSpace(val[1:])
+	}
+	s, err := unquote(val)
+	if err != nil {
+		return nil, err
+	}
+	end := strings.LastIndexByte(s, '/')
+	if !strings.HasPrefix(s, "/") || end == 0 {
+		return nil, fmt.Errorf("pattern must be /regex/flags")
+	}
+	expr, flags := s[1:end], s[end+1:]
+	var inline string
+	for _, f := range flags {
+		switch f {
+		case 'i', 's', 'm':
+			inline += string(f)
+		case 'R':
+			p.relative = true
+		default:
+			return nil, fmt.Errorf("flag %q not supported", f)
+		}
+	}
+	if inline != "" {
+		expr = "(?" + inline + ")" + expr
+	}
+	if p.re, err = regexp.Compile(expr); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *pcre) check() error    { return nil }
+func (p *pcre) isNegated() bool { return p.negated }
+
+func (p *pcre) candidates(b *buffer, prevEnd int) [][2]int {
+	lo := 0
+	if p.relative {
+		lo = min(max(prevEnd, 0), len(b.data))
+	}
+	var out [][2]int
+	for _, m := range p.re.FindAllIndex(b.data[lo:], maxCandidates) {
+		out = append(out, [2]int{lo + m[0], lo + m[1]})
+	}
+	return out
+}
+
+// maxSteps caps the candidates tried for one rule on one buffer, so a rule
+// with many repeated contents cannot stall the capture.
+const maxSteps = 4096
+
+// match reports whether the rule's contents and PCREs all match b, with
+// the matched bytes ending after newFrom so data seen before is not
+// matched again. It returns the span of the positive matches.
+func (r *Rule) match(b *buffer, newFrom int) (span [2]int, ok bool) {
+	steps := 0
+	return matchFrom(r.matches, b, 0, [2]int{-1, -1}, newFrom, &steps)
+}
+
+func matchFrom(ms []matcher, b *buffer, prevEnd int, span [2]int, newFrom int, steps *int) ([2]int, bool) {
+	if len(ms) == 0 {
+		return span, span[0] < 0 || span[1] > newFrom
+	}
+	m := ms[0]
+	if m.isNegated() {
+		if len(m.candidates(b, prevEnd)) > 0 {
+			return span, false
+		}
+		return matchFrom(ms[1:], b, prevEnd, span, newFrom, steps)
+	}
+	for _, c := range m.candidates(b, prevEnd) {
+		if *steps++; *steps > maxSteps {
+			return span, false
+		}
+		s := span
+		if s[0] < 0 || c[0] < s[0] {
+			s[0] = c[0]
+		}
+		s[1] = max(s[1], c[1])
+		if res, ok := matchFrom(ms[1:], b, c[1], s, newFrom, steps); ok {
+			return res, true
+		}
+	}
+	return span, false
+}
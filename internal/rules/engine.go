@@ -0,0 +1,397 @@
+package rules
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/models"
+	"sniffox/internal/parser"
+)
+
+const (
+	// maxFlows caps the connections whose streams are followed
+	maxFlows = 20000
+	// flowIdle is how long a connection is kept without packets once the
+	// table is full
+	flowIdle = 2 * time.Minute
+	// streamWindow is how much of each direction of a stream is kept for
+	// matching; patterns must fall within it
+	streamWindow = 16 << 10
+	// maxPending caps the out-of-order segments held per direction
+	maxPending = 8
+)
+
+// Match is a rule that matched, with the packets that carried the bytes
+// it matched, oldest first.
+type Match struct {
+	Rule    *Rule
+	Packets []int
+}
+
+// RuleStatus is a loaded rule and how often it matched in this capture.
+type RuleStatus struct {
+	*Rule
+	ID   string `json:"id"`
+	Hits int    `json:"hits"`
+}
+
+// Engine matches packets against a rule set. It is safe for concurrent
+// use.
+type Engine struct {
+	mu    sync.Mutex
+	vars  Vars
+	rules []*Rule
+	hits  []int
+	flows map[string]*flowState
+}
+
+// NewEngine creates an engine with no rules and the default variables.
+func NewEngine() *Engine {
+	return &Engine{vars: DefaultVars(), flows: make(map[string]*flowState)}
+}
+
+// SetHomeNet sets $HOME_NET, and with it $EXTERNAL_NET and the server
+// variables, to a list of addresses and CIDRs. It applies to rules loaded
+// afterwards.
+func (e *Engine) SetHomeNet(nets []string) error {
+	list := "[" + strings.Join(nets, ",") + "]"
+	if _, err := parseAddrs(list, nil); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.vars["HOME_NET"] = list
+	return nil
+}
+
+// Load replaces the rules with those of a rules file. It returns how many
+// loaded and why the others did not; the rules are replaced even if some
+// fail.
+func (e *Engine) Load(r io.Reader) (int, []LoadError) {
+	e.mu.Lock()
+	vars := maps.Clone(e.vars)
+	e.mu.Unlock()
+	rules, errs := ParseRules(r, vars)
+	e.SetRules(rules)
+	return len(rules), errs
+}
+
+// SetRules replaces the rules and clears their hit counts.
+func (e *Engine) SetRules(rules []*Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = rules
+	e.hits = make([]int, len(rules))
+}
+
+// Rules returns the loaded rules with their hit counts.
+func (e *Engine) Rules() []RuleStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]RuleStatus, len(e.rules))
+	for i, r := range e.rules {
+		out[i] = RuleStatus{Rule: r, ID: r.ID(), Hits: e.hits[i]}
+	}
+	return out
+}
+
+// Reset forgets the streams followed and the hit counts, keeping the
+// rules.
+func (e *Engine) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.flows = make(map[string]*flowState)
+	e.hits = make([]int, len(e.rules))
+}
+
+// flowState is a connection seen by the engine.
+type flowState struct {
+	client   string // ip:port of the side that opened it
+	fromBoth [2]bool
+	streams  [2]*tcpStream // from the client, from the server
+	last     time.Time
+}
+
+// packetInfo is what the rules look at in a packet.
+type packetInfo struct {
+	srcIP, dstIP     net.IP
+	srcPort, dstPort uint16
+	transport        string // tcp, udp, icmp or ""
+	payload          []byte
+	toServer         bool
+	established      bool
+	info             *models.PacketInfo
+}
+
+// Match returns the rules the packet matches. TCP rules with contents are
+// matched against the direction's stream as reassembled up to and
+// including this packet, and only match if the matched bytes include some
+// the packet brought.
+func (e *Engine) Match(pkt gopacket.Packet, info *models.PacketInfo) []Match {
+	tuple := parser.ExtractFlowTuple(pkt)
+	if !tuple.Valid {
+		return nil
+	}
+	p := packetInfo{
+		srcIP: net.ParseIP(tuple.SrcIP), dstIP: net.ParseIP(tuple.DstIP),
+		srcPort: tuple.SrcPort, dstPort: tuple.DstPort,
+		info: info,
+	}
+	var tcp *layers.TCP
+	switch {
+	case pkt.Layer(layers.LayerTypeTCP) != nil:
+		tcp = pkt.Layer(layers.LayerTypeTCP).(*layers.TCP)
+		p.transport, p.payload = "tcp", tcp.LayerPayload()
+	case pkt.Layer(layers.LayerTypeUDP) != nil:
+		p.transport, p.payload = "udp", pkt.Layer(layers.LayerTypeUDP).LayerPayload()
+	case pkt.Layer(layers.LayerTypeICMPv4) != nil:
+		p.transport, p.payload = "icmp", pkt.Layer(layers.LayerTypeICMPv4).LayerPayload()
+	case pkt.Layer(layers.LayerTypeICMPv6) != nil:
+		p.transport, p.payload = "icmp", pkt.Layer(layers.LayerTypeICMPv6).LayerPayload()
+	case pkt.NetworkLayer() != nil:
+		p.payload = pkt.NetworkLayer().LayerPayload()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.rules) == 0 {
+		return nil
+	}
+
+	ts := pkt.Metadata().Timestamp
+	fs := e.flow(tuple, tcp, ts)
+	dir := 0
+	if fs != nil {
+		src := net.JoinHostPort(tuple.SrcIP, strconv.Itoa(int(tuple.SrcPort)))
+		p.toServer = src == fs.client
+		if !p.toServer {
+			dir = 1
+		}
+		fs.fromBoth[dir] = true
+		p.established = fs.fromBoth[0] && fs.fromBoth[1]
+	}
+
+	// The packet's data as it extends its stream
+	var stream *buffer
+	var st *tcpStream
+	newFrom := 0
+	if tcp != nil && fs != nil {
+		if fs.streams[dir] == nil {
+			fs.streams[dir] = &tcpStream{}
+		}
+		st = fs.streams[dir]
+		newFrom = st.add(tcp, info.Number)
+		stream = &buffer{data: st.buf, base: st.base}
+	}
+	payload := &buffer{data: p.payload}
+
+	var out []Match
+	for i, r := range e.rules {
+		if !r.matchHeader(&p) {
+			continue
+		}
+		packets := []int{info.Number}
+		if len(r.matches) > 0 {
+			if st != nil && r.hasPositiveMatch {
+				if newFrom >= len(st.buf) {
+					continue
+				}
+				span, ok := r.match(stream, newFrom)
+				if !ok {
+					continue
+				}
+				packets = st.packets(st.base+int64(span[0]), st.base+int64(span[1]))
+			} else if _, ok := r.match(payload, -1); !ok {
+				continue
+			}
+		}
+		e.hits[i]++
+		out = append(out, Match{Rule: r, Packets: packets})
+	}
+	return out
+}
+
+// flow returns the state of the packet's connection, or nil if the table
+// is full. The caller holds e.mu.
+func (e *Engine) flow(tuple parser.FlowTuple, tcp *layers.TCP, ts time.Time) *flowState {
+	a := net.JoinHostPort(tuple.SrcIP, strconv.Itoa(int(tuple.SrcPort)))
+	b := net.JoinHostPort(tuple.DstIP, strconv.Itoa(int(tuple.DstPort)))
+	key := tuple.Protocol + " " + min(a, b) + " " + max(a, b)
+	fs := e.flows[key]
+	if fs == nil {
+		if len(e.flows) >= maxFlows {
+			for k, f := range e.flows {
+				if ts.Sub(f.last) > flowIdle {
+					delete(e.flows, k)
+				}
+			}
+			if len(e.flows) >= maxFlows {
+				return nil
+			}
+		}
+		fs = &flowState{client: a}
+		if tcp != nil && tcp.SYN && tcp.ACK {
+			fs.client = b
+		}
+		e.flows[key] = fs
+	}
+	fs.last = ts
+	return fs
+}
+
+// matchHeader checks the rule header, flow and dsize against the packet.
+func (r *Rule) matchHeader(p *packetInfo) bool {
+	if !r.matchProto(p) {
+		return false
+	}
+	fwd := r.src.match(p.srcIP) && r.dst.match(p.dstIP) &&
+		r.srcPorts.match(p.srcPort) && r.dstPorts.match(p.dstPort)
+	if !fwd && !(r.bidirectional && r.src.match(p.dstIP) && r.dst.match(p.srcIP) &&
+		r.srcPorts.match(p.dstPort) && r.dstPorts.match(p.srcPort)) {
+		return false
+	}
+	switch {
+	case r.flow.toServer && !p.toServer,
+		r.flow.toClient && p.toServer,
+		r.flow.established && !p.established:
+		return false
+	}
+	return r.dsize == nil || r.dsize.contains(len(p.payload))
+}
+
+// matchProto checks the rule's protocol: ip, a transport, or an
+// application protocol such as http or dns that the packet was decoded as.
+func (r *Rule) matchProto(p *packetInfo) bool {
+	switch r.Proto {
+	case "ip", "pkthdr":
+		return true
+	case "tcp", "udp", "icmp":
+		return p.transport == r.Proto
+	}
+	if strings.EqualFold(p.info.Protocol, r.Proto) {
+		return true
+	}
+	return slices.ContainsFunc(p.info.Layers, func(l models.LayerDetail) bool {
+		return strings.EqualFold(l.Name, r.Proto)
+	})
+}
+
+// tcpStream is one direction of a TCP connection, reassembled in sequence
+// order, of which the last streamWindow bytes are kept.
+type tcpStream struct {
+	started bool
+	origin  uint32 // sequence number of the first data byte
+	next    uint32 // next sequence number expected
+	buf     []byte
+	base    int64 // stream offset of buf[0]
+	segs    []segment
+	pending []pendingSegment
+}
+
+// segment records which packet brought the stream bytes [start, end).
+type segment struct {
+	start, end int64
+	number     int
+}
+
+type pendingSegment struct {
+	seq    uint32
+	data   []byte
+	number int
+}
+
+// add adds a segment's data, with any held segments it makes contiguous,
+// and returns where in buf the new data starts.
+func (s *tcpStream) add(tcp *layers.TCP, number int) int {
+	newFrom := len(s.buf)
+	seq := tcp.Seq
+	if tcp.SYN {
+		s.started, s.origin, s.next = true, seq+1, seq+1
+		seq++
+	}
+	if len(tcp.Payload) == 0 {
+		return newFrom
+	}
+	if !s.started {
+		// Picked up mid-stream
+		s.started, s.origin, s.next = true, seq, seq
+	}
+	s.insert(seq, tcp.Payload, number)
+	for len(s.pending) > 0 {
+		progressed := false
+		for i, p := range s.pending {
+			if int32(p.seq-s.next) <= 0 {
+				s.pending = slices.Delete(s.pending, i, i+1)
+				s.insert(p.seq, p.data, p.number)
+				progressed = true
+				break
+			}
+		}
+		if !progressed {
+			break
+		}
+	}
+	if len(s.buf) > streamWindow {
+		drop := len(s.buf) - streamWindow
+		s.buf = s.buf[drop:]
+		s.base += int64(drop)
+		newFrom = max(newFrom-drop, 0)
+		for len(s.segs) > 0 && s.segs[0].end <= s.base {
+			s.segs = s.segs[1:]
+		}
+	}
+	return newFrom
+}
+
+// insert appends data if it continues the stream, trims what a
+// retransmission repeats and holds data that arrived early.
+func (s *tcpStream) insert(seq uint32, data []byte, number int) {
+	switch d := int32(seq - s.next); {
+	case d > 0:
+		if len(s.pending) < maxPending {
+			s.pending = append(s.pending, pendingSegment{seq, slices.Clone(data), number})
+			return
+		}
+		// Too much is missing: give up on the gap
+		s.base += int64(len(s.buf)) + int64(d)
+		s.buf, s.segs = nil, nil
+		s.next = seq
+	case d < 0:
+		if int(-d) >= len(data) {
+			return
+		}
+		data = data[-d:]
+	}
+	start := s.base + int64(len(s.buf))
+	s.buf = append(s.buf, data...)
+	s.segs = append(s.segs, segment{start, start + int64(len(data)), number})
+	s.next += uint32(len(data))
+}
+
+// packets returns the numbers of the packets that brought the stream bytes
+// [start, end).
+func (s *tcpStream) packets(start, end int64) []int {
+	var out []int
+	for _, seg := range s.segs {
+		if seg.start < end && seg.end > start && !slices.Contains(out, seg.number) {
+			out = append(out, seg.number)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// String describes the rule as its ID and message.
+func (r *Rule) String() string {
+	return fmt.Sprintf("[%s] %s", r.ID(), r.Msg)
+}
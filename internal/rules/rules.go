@@ -0,0 +1,458 @@
+// Package rules is a small signature engine reading a subset of the
+// Suricata/Snort rule language:
+//
+//	alert tcp $EXTERNAL_NET any -> $HOME_NET 445 (msg:"SMB probe"; flow:to_server,established; content:"|ff|SMB"; depth:8; sid:1000001; rev:1;)
+//
+// Rules match on protocol, addresses, ports, flow direction, payload size,
+// content (with nocase, offset, depth, distance and within) and PCRE. TCP
+// rules are matched against each direction's reassembled stream, so a
+// pattern split across segments is still found; other rules are matched
+// against the packet payload.
+//
+// Keywords that would change what a rule matches but are not supported,
+// such as flowbits or the HTTP buffers, make the rule fail to load rather
+// than have it match more than its author meant.
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rule is a parsed signature.
+type Rule struct {
+	GID       int    `json:"gid"`
+	SID       int    `json:"sid"`
+	Rev       int    `json:"rev"`
+	Msg       string `json:"msg"`
+	Classtype string `json:"classtype,omitempty"`
+	Priority  int    `json:"priority,omitempty"`
+	Proto     string `json:"proto"`
+	Text      string `json:"text"` // as written
+
+	src, dst         addrSpec
+	srcPorts         portSpec
+	dstPorts         portSpec
+	bidirectional    bool
+	flow             flowOpts
+	dsize            *sizeRange
+	matches          []matcher // contents and PCREs, in order
+	hasPositiveMatch bool
+}
+
+// ID returns the rule's gid:sid:rev, as Suricata shows it.
+func (r *Rule) ID() string {
+	return fmt.Sprintf("%d:%d:%d", r.GID, r.SID, r.Rev)
+}
+
+// Severity maps the rule's priority to an alert severity: 1 is high, 2
+// medium and 3 or more low. Rules without one are medium.
+func (r *Rule) Severity() string {
+	switch {
+	case r.Priority == 1:
+		return "high"
+	case r.Priority >= 3:
+		return "low"
+	}
+	return "medium"
+}
+
+// flowOpts is the flow keyword: which direction and connection state the
+// rule applies to.
+type flowOpts struct {
+	toServer, toClient bool
+	established        bool
+	stateless          bool
+}
+
+// sizeRange is a dsize condition on the payload length.
+type sizeRange struct {
+	min, max int // inclusive
+}
+
+func (s sizeRange) contains(n int) bool {
+	return n >= s.min && n <= s.max
+}
+
+// Vars are the address and port variables rules refer to as $NAME.
+type Vars map[string]string
+
+// DefaultVars are the variables of the stock suricata.yaml, with HOME_NET
+// the private address ranges.
+func DefaultVars() Vars {
+	return Vars{
+		"HOME_NET":        "[10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7]",
+		"EXTERNAL_NET":    "!$HOME_NET",
+		"HTTP_SERVERS":    "$HOME_NET",
+		"SMTP_SERVERS":    "$HOME_NET",
+		"SQL_SERVERS":     "$HOME_NET",
+		"DNS_SERVERS":     "$HOME_NET",
+		"TELNET_SERVERS":  "$HOME_NET",
+		"AIM_SERVERS":     "$EXTERNAL_NET",
+		"DC_SERVERS":      "$HOME_NET",
+		"DNP3_SERVER":     "$HOME_NET",
+		"DNP3_CLIENT":     "$HOME_NET",
+		"MODBUS_CLIENT":   "$HOME_NET",
+		"MODBUS_SERVER":   "$HOME_NET",
+		"ENIP_CLIENT":     "$HOME_NET",
+		"ENIP_SERVER":     "$HOME_NET",
+		"HTTP_PORTS":      "80",
+		"SHELLCODE_PORTS": "!80",
+		"ORACLE_PORTS":    "1521",
+		"SSH_PORTS":       "22",
+		"DNP3_PORTS":      "20000",
+		"MODBUS_PORTS":    "502",
+		"FILE_DATA_PORTS": "[$HTTP_PORTS,110,143]",
+		"FTP_PORTS":       "21",
+		"GENEVE_PORTS":    "6081",
+		"VXLAN_PORTS":     "4789",
+		"TEREDO_PORTS":    "3544",
+	}
+}
+
+// expand replaces $NAME references in s, following variables that refer
+// to others.
+func (v Vars) expand(s string, depth int) (string, error) {
+	if depth > 8 {
+		return "", fmt.Errorf("variables nested too deeply in %q", s)
+	}
+	var err error
+	out := varRef.ReplaceAllStringFunc(s, func(ref string) string {
+		val, ok := v[ref[1:]]
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("undefined variable %s", ref)
+			}
+			return ""
+		}
+		expanded, e := v.expand(val, depth+1)
+		if e != nil && err == nil {
+			err = e
+		}
+		return expanded
+	})
+	return out, err
+}
+
+var varRef = regexp.MustCompile(`\$[A-Za-z_][A-Za-z0-9_]*`)
+
+// LoadError is a rule that could not be loaded.
+type LoadError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ParseRules reads a rules file: one rule per line, with # comments and
+// blank lines skipped and lines ending in \ continued. It returns the rules
+// that loaded and why the others did not.
+func ParseRules(r io.Reader, vars Vars) ([]*Rule, []LoadError) {
+	var rules []*Rule
+	var errs []LoadError
+	seen := make(map[[2]int]bool)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	var pending strings.Builder
+	start, n := 0, 0
+	for sc.Scan() {
+		n++
+		line := strings.TrimSpace(sc.Text())
+		if pending.Len() == 0 {
+			start = n
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+		}
+		if strings.HasSuffix(line, `\`) {
+			pending.WriteString(strings.TrimSuffix(line, `\`))
+			continue
+		}
+		pending.WriteString(line)
+		text := pending.String()
+		pending.Reset()
+
+		rule, err := Parse(text, vars)
+		if err != nil {
+			errs = append(errs, LoadError{Line: start, Error: err.Error()})
+			continue
+		}
+		if rule == nil {
+			continue
+		}
+		key := [2]int{rule.GID, rule.SID}
+		if seen[key] {
+			errs = append(errs, LoadError{Line: start, Error: fmt.Sprintf("duplicate sid %d", rule.SID)})
+			continue
+		}
+		seen[key] = true
+		rules = append(rules, rule)
+	}
+	if err := sc.Err(); err != nil {
+		errs = append(errs, LoadError{Line: n + 1, Error: err.Error()})
+	}
+	return rules, errs
+}
+
+// Parse parses one rule. It returns nil and no error for rules with an
+// action other than alert, such as pass or drop, which a passive sniffer
+// has no use for.
+func Parse(text string, vars Vars) (*Rule, error) {
+	text = strings.TrimSpace(text)
+	open := strings.IndexByte(text, '(')
+	if open < 0 || !strings.HasSuffix(text, ")") {
+		return nil, fmt.Errorf("rule options must be in parentheses")
+	}
+	header := strings.Fields(text[:open])
+	if len(header) != 7 {
+		return nil, fmt.Errorf("rule header must be: action proto src sport -> dst dport")
+	}
+	switch header[0] {
+	case "alert":
+	case "pass", "drop", "reject", "rejectsrc", "rejectdst", "rejectboth", "log":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown action %q", header[0])
+	}
+
+	r := &Rule{GID: 1, Proto: strings.ToLower(header[1]), Text: text}
+	switch header[4] {
+	case "->":
+	case "<>":
+		r.bidirectional = true
+	default:
+		return nil, fmt.Errorf("direction must be -> or <>, not %q", header[4])
+	}
+	var err error
+	if r.src, err = parseAddrs(header[2], vars); err != nil {
+		return nil, fmt.Errorf("source: %w", err)
+	}
+	if r.srcPorts, err = parsePorts(header[3], vars); err != nil {
+		return nil, fmt.Errorf("source port: %w", err)
+	}
+	if r.dst, err = parseAddrs(header[5], vars); err != nil {
+		return nil, fmt.Errorf("destination: %w", err)
+	}
+	if r.dstPorts, err = parsePorts(header[6], vars); err != nil {
+		return nil, fmt.Errorf("destination port: %w", err)
+	}
+
+	opts, err := splitOptions(text[open+1 : len(text)-1])
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range opts {
+		if err := r.applyOption(o[0], o[1]); err != nil {
+			return nil, fmt.Errorf("%s: %w", o[0], err)
+		}
+	}
+	if r.SID == 0 {
+		return nil, fmt.Errorf("rule has no sid")
+	}
+	for _, m := range r.matches {
+		if err := m.check(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// splitOptions splits "msg:"a;b"; sid:1;" into keyword, value pairs,
+// honoring quotes and backslash escapes.
+func splitOptions(s string) ([][2]string, error) {
+	var out [][2]string
+	var cur strings.Builder
+	quoted, escaped := false, false
+	flush := func() {
+		opt := strings.TrimSpace(cur.String())
+		cur.Reset()
+		if opt == "" {
+			return
+		}
+		k, v, _ := strings.Cut(opt, ":")
+		out = append(out, [2]string{strings.ToLower(strings.TrimSpace(k)), strings.TrimSpace(v)})
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ';' && !quoted:
+			flush()
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in options")
+	}
+	flush()
+	return out, nil
+}
+
+// unquote strips the quotes around an option value and resolves the
+// \" \; \\ escapes inside.
+func unquote(v string) (string, error) {
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return "", fmt.Errorf("value must be quoted")
+	}
+	v = v[1 : len(v)-1]
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+1 < len(v) {
+			i++
+		}
+		b.WriteByte(v[i])
+	}
+	return b.String(), nil
+}
+
+// ignoredOptions do not change what a rule matches.
+var ignoredOptions = map[string]bool{
+	"reference": true, "metadata": true, "target": true,
+	"fast_pattern": true, "rawbytes": true,
+}
+
+func (r *Rule) applyOption(key, val string) error {
+	if ignoredOptions[key] {
+		return nil
+	}
+	switch key {
+	case "msg":
+		msg, err := unquote(val)
+		if err != nil {
+			return err
+		}
+		r.Msg = msg
+	case "sid", "rev", "gid", "priority":
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%q is not a number", val)
+		}
+		switch key {
+		case "sid":
+			r.SID = n
+		case "rev":
+			r.Rev = n
+		case "gid":
+			r.GID = n
+		default:
+			r.Priority = n
+		}
+	case "classtype":
+		r.Classtype = val
+	case "flow":
+		return r.parseFlow(val)
+	case "dsize":
+		d, err := parseSize(val)
+		if err != nil {
+			return err
+		}
+		r.dsize = &d
+	case "content":
+		c, err := parseContent(val)
+		if err != nil {
+			return err
+		}
+		r.matches = append(r.matches, c)
+		r.hasPositiveMatch = r.hasPositiveMatch || !c.negated
+	case "pcre":
+		p, err := parsePCRE(val)
+		if err != nil {
+			return err
+		}
+		r.matches = append(r.matches, p)
+		r.hasPositiveMatch = r.hasPositiveMatch || !p.negated
+	case "nocase", "offset", "depth", "distance", "within", "startswith", "endswith":
+		c := r.lastContent()
+		if c == nil {
+			return fmt.Errorf("no content before it")
+		}
+		return c.modify(key, val)
+	default:
+		return fmt.Errorf("keyword not supported")
+	}
+	return nil
+}
+
+func (r *Rule) lastContent() *content {
+	if len(r.matches) == 0 {
+		return nil
+	}
+	c, _ := r.matches[len(r.matches)-1].(*content)
+	return c
+}
+
+func (r *Rule) parseFlow(val string) error {
+	for _, f := range strings.Split(val, ",") {
+		switch strings.TrimSpace(f) {
+		case "to_server", "from_client":
+			r.flow.toServer = true
+		case "to_client", "from_server":
+			r.flow.toClient = true
+		case "established":
+			r.flow.established = true
+		case "stateless":
+			r.flow.stateless = true
+		case "not_established", "only_stream", "no_stream", "only_frag", "no_frag":
+			return fmt.Errorf("%q not supported", f)
+		default:
+			return fmt.Errorf("unknown flow option %q", f)
+		}
+	}
+	if r.flow.toServer && r.flow.toClient {
+		return fmt.Errorf("to_server and to_client together never match")
+	}
+	return nil
+}
+
+// parseSize parses dsize: "100", ">100", "<100", "100<>200", ">=100" or
+// "<=100".
+func parseSize(val string) (sizeRange, error) {
+	atoi := func(s string) (int, error) {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q is not a size", val)
+		}
+		return n, nil
+	}
+	val = strings.TrimSpace(val)
+	if lo, hi, ok := strings.Cut(val, "<>"); ok {
+		a, err := atoi(lo)
+		if err != nil {
+			return sizeRange{}, err
+		}
+		b, err := atoi(hi)
+		if err != nil {
+			return sizeRange{}, err
+		}
+		// Both ends are exclusive
+		return sizeRange{a + 1, b - 1}, nil
+	}
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		if rest, ok := strings.CutPrefix(val, op); ok {
+			n, err := atoi(rest)
+			if err != nil {
+				return sizeRange{}, err
+			}
+			switch op {
+			case ">=":
+				return sizeRange{n, 1 << 30}, nil
+			case "<=":
+				return sizeRange{0, n}, nil
+			case ">":
+				return sizeRange{n + 1, 1 << 30}, nil
+			default:
+				return sizeRange{0, n - 1}, nil
+			}
+		}
+	}
+	n, err := atoi(val)
+	return sizeRange{n, n}, err
+}
@@ -0,0 +1,263 @@
+// Package schedule keeps captures that run by themselves: a capture
+// configuration, how long to capture and a cron expression saying when.
+// Each run is saved as a session.
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"sniffox/internal/models"
+)
+
+// maxSchedules caps the schedules kept.
+const maxSchedules = 256
+
+// ErrNotFound is returned for a schedule that does not exist.
+var ErrNotFound = errors.New("schedule not found")
+
+// Schedule is a named capture started whenever Cron comes due and stopped
+// after Duration seconds, or earlier if Capture sets another auto-stop
+// limit.
+type Schedule struct {
+	Name     string                     `json:"name"`
+	Cron     string                     `json:"cron"`
+	Duration int                        `json:"duration"` // seconds
+	Capture  models.StartCaptureRequest `json:"capture"`
+	Disabled bool                       `json:"disabled,omitempty"`
+}
+
+// Check validates s and returns its parsed cron expression.
+func (s *Schedule) Check() (*Cron, error) {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" || utf8.RuneCountInString(s.Name) > 64 || strings.ContainsAny(s.Name, "/\\") {
+		return nil, fmt.Errorf("schedule name must be 1-64 characters without slashes")
+	}
+	c, err := ParseCron(s.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("schedule %s: %w", s.Name, err)
+	}
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule %s: cron expression is never due", s.Name)
+	}
+	if s.Duration <= 0 {
+		return nil, fmt.Errorf("schedule %s: duration must be positive", s.Name)
+	}
+	if len(s.Capture.Interface) == 0 {
+		return nil, fmt.Errorf("schedule %s: no interface", s.Name)
+	}
+	if s.Capture.SnapLen < 0 || s.Capture.MaxPackets < 0 || s.Capture.MaxBytes < 0 || s.Capture.MaxDuration < 0 ||
+		s.Capture.StopAfterPackets < 0 || s.Capture.StopAfterBytes < 0 {
+		return nil, fmt.Errorf("schedule %s: negative limit", s.Name)
+	}
+	return c, nil
+}
+
+// Request returns the capture request for a run of s: its capture,
+// stopped after its duration and saved as a session named after it.
+func (s Schedule) Request(start time.Time) models.StartCaptureRequest {
+	req := s.Capture
+	req.StopAfterSeconds = s.Duration
+	req.SaveOnStop = true
+	req.SessionName = s.Name + " " + start.Format("2006-01-02 15:04")
+	// Recording would keep the packets twice
+	req.Record = false
+	return req
+}
+
+// Status is a schedule with its next and last runs.
+type Status struct {
+	Schedule
+	Next      *time.Time `json:"next,omitempty"` // nil when disabled or never due
+	LastRun   *time.Time `json:"lastRun,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+}
+
+type entry struct {
+	sched     Schedule
+	cron      *Cron
+	lastRun   time.Time
+	lastError string
+}
+
+// Store holds the schedules, saved to a JSON file, and when each last
+// ran. It is safe for concurrent use.
+type Store struct {
+	mu      sync.Mutex
+	path    string // "" keeps them in memory only
+	entries map[string]*entry
+}
+
+// New creates an empty store kept in memory only.
+func New() *Store {
+	return &Store{entries: make(map[string]*entry)}
+}
+
+// Open creates a store saved to path, loading the schedules already there.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, entries: make(map[string]*entry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Schedule
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, sc := range list {
+		c, err := sc.Check()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		s.entries[sc.Name] = &entry{sched: sc, cron: c}
+	}
+	return s, nil
+}
+
+// List returns the schedules and their runs sorted by name, with the next
+// run after now.
+func (s *Store) List(now time.Time) []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Status, 0, len(s.entries))
+	for _, e := range s.sorted() {
+		out = append(out, e.status(now))
+	}
+	return out
+}
+
+func (s *Store) sorted() []*entry {
+	out := make([]*entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].sched.Name < out[j].sched.Name })
+	return out
+}
+
+func (e *entry) status(now time.Time) Status {
+	st := Status{Schedule: e.sched, LastError: e.lastError}
+	if !e.sched.Disabled {
+		if next := e.cron.Next(now); !next.IsZero() {
+			st.Next = &next
+		}
+	}
+	if !e.lastRun.IsZero() {
+		last := e.lastRun
+		st.LastRun = &last
+	}
+	return st
+}
+
+// Get returns the schedule called name with its runs.
+func (s *Store) Get(name string, now time.Time) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[name]
+	if !ok {
+		return Status{}, ErrNotFound
+	}
+	return e.status(now), nil
+}
+
+// Put adds sc, or replaces the schedule of the same name, and saves the
+// store. It returns sc as stored.
+func (s *Store) Put(sc Schedule) (Schedule, error) {
+	c, err := sc.Check()
+	if err != nil {
+		return Schedule{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, existed := s.entries[sc.Name]
+	if !existed && len(s.entries) >= maxSchedules {
+		return Schedule{}, fmt.Errorf("too many schedules (at most %d)", maxSchedules)
+	}
+	e := &entry{sched: sc, cron: c}
+	if existed {
+		e.lastRun, e.lastError = old.lastRun, old.lastError
+	}
+	s.entries[sc.Name] = e
+	if err := s.save(); err != nil {
+		if existed {
+			s.entries[sc.Name] = old
+		} else {
+			delete(s.entries, sc.Name)
+		}
+		return Schedule{}, err
+	}
+	return sc, nil
+}
+
+// Delete removes the schedule called name and saves the store.
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.entries[name]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.entries, name)
+	if err := s.save(); err != nil {
+		s.entries[name] = old
+		return err
+	}
+	return nil
+}
+
+// Due returns the enabled schedules due in the minute starting at t.
+func (s *Store) Due(t time.Time) []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Schedule
+	for _, e := range s.sorted() {
+		if !e.sched.Disabled && e.cron.Matches(t) {
+			out = append(out, e.sched)
+		}
+	}
+	return out
+}
+
+// MarkRun records that the schedule called name was started at t, and
+// why it failed to if err is not nil.
+func (s *Store) MarkRun(name string, t time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[name]
+	if !ok {
+		return
+	}
+	e.lastRun, e.lastError = t, ""
+	if err != nil {
+		e.lastError = err.Error()
+	}
+}
+
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	list := make([]Schedule, 0, len(s.entries))
+	for _, e := range s.sorted() {
+		list = append(list, e.sched)
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,111 @@
+// Package search finds byte patterns in packet data: a hex byte sequence,
+// an ASCII string or a regular expression.
+package search
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Pattern kinds.
+const (
+	ModeString = "string"
+	ModeHex    = "hex"
+	ModeRegex  = "regex"
+)
+
+// Match is one occurrence of a pattern.
+type Match struct {
+	Offset int `json:"offset"`
+	Length int `json:"length"`
+}
+
+// Pattern is a compiled search pattern. It is safe for concurrent use.
+type Pattern struct {
+	lit        []byte // string and hex patterns
+	ignoreCase bool   // lit is lower case and is matched ASCII case-insensitively
+	re         *regexp.Regexp
+}
+
+// Compile parses query as a pattern of the given mode; an empty mode is a
+// string. Hex patterns may separate bytes with spaces, colons or dashes
+// and start with 0x. ignoreCase folds ASCII letters for strings and
+// regular expressions; it does not apply to hex.
+func Compile(query, mode string, ignoreCase bool) (*Pattern, error) {
+	if query == "" {
+		return nil, fmt.Errorf("empty search pattern")
+	}
+	switch mode {
+	case "", ModeString:
+		p := &Pattern{lit: []byte(query), ignoreCase: ignoreCase}
+		if ignoreCase {
+			p.lit = lowerASCII(p.lit)
+		}
+		return p, nil
+	case ModeHex:
+		s := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(query)), "0x")
+		s = strings.NewReplacer(" ", "", ":", "", "-", "").Replace(s)
+		b, err := hex.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid hex pattern %q", query)
+		}
+		return &Pattern{lit: b}, nil
+	case ModeRegex:
+		if ignoreCase {
+			query = "(?i)" + query
+		}
+		re, err := regexp.Compile(query)
+		if err != nil {
+			return nil, err
+		}
+		return &Pattern{re: re}, nil
+	}
+	return nil, fmt.Errorf("unknown search mode %q", mode)
+}
+
+// FindAll returns up to limit non-overlapping matches in data, or all of
+// them if limit is not positive. Regular expressions match bytes, and
+// empty matches are skipped.
+func (p *Pattern) FindAll(data []byte, limit int) []Match {
+	var out []Match
+	if p.re != nil {
+		n := limit
+		if n <= 0 {
+			n = -1
+		}
+		for _, loc := range p.re.FindAllIndex(data, n) {
+			if loc[1] > loc[0] {
+				out = append(out, Match{Offset: loc[0], Length: loc[1] - loc[0]})
+			}
+		}
+		return out
+	}
+	if p.ignoreCase {
+		data = lowerASCII(data)
+	}
+	for i := 0; limit <= 0 || len(out) < limit; {
+		j := bytes.Index(data[i:], p.lit)
+		if j < 0 {
+			break
+		}
+		out = append(out, Match{Offset: i + j, Length: len(p.lit)})
+		i += j + len(p.lit)
+	}
+	return out
+}
+
+// lowerASCII returns a copy of b with ASCII letters in lower case, so
+// offsets into it are offsets into b.
+func lowerASCII(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		out[i] = c
+	}
+	return out
+}
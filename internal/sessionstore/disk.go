@@ -0,0 +1,139 @@
+package sessionstore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Disk stores sessions as files in a directory.
+type Disk struct {
+	dir string
+	// A share's directory is a mount point. It is never created, so
+	// sessions saved while the share is not mounted fail rather than fill
+	// the local disk, and files are synced before they are renamed into
+	// place, as network file systems may otherwise publish them unwritten.
+	share bool
+}
+
+// NewDisk returns a store in dir, which is created on the first write.
+func NewDisk(dir string) *Disk {
+	return &Disk{dir: dir}
+}
+
+// NewShare returns a store in dir on a mounted network share, which must
+// exist.
+func NewShare(dir string) (*Disk, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("network share: %w", err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("network share %s is not a directory", dir)
+	}
+	return &Disk{dir: dir, share: true}, nil
+}
+
+// Dir returns the directory the files are in.
+func (d *Disk) Dir() string { return d.dir }
+
+func (d *Disk) String() string {
+	if d.share {
+		return "network share " + d.dir
+	}
+	return "directory " + d.dir
+}
+
+// List returns the names of the files in the directory; a directory not
+// created yet holds none.
+func (d *Disk) List() ([]string, error) {
+	entries, err := os.ReadDir(d.dir)
+	if os.IsNotExist(err) && !d.share {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasSuffix(e.Name(), ".tmp") {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func (d *Disk) Open(name string) (io.ReadCloser, error) {
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(d.dir, name))
+}
+
+func (d *Disk) Create(name string) (Writer, error) {
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	if !d.share {
+		if err := os.MkdirAll(d.dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	path := filepath.Join(d.dir, name)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &diskFile{f: f, path: path, sync: d.share}, nil
+}
+
+func (d *Disk) Remove(name string) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(d.dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// diskFile is written under a temporary name and renamed into place when
+// closed, unless a write failed.
+type diskFile struct {
+	f    *os.File
+	path string
+	sync bool
+	err  error
+}
+
+func (f *diskFile) Write(p []byte) (int, error) {
+	n, err := f.f.Write(p)
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+	return n, err
+}
+
+func (f *diskFile) Close() error {
+	err := f.err
+	if err == nil && f.sync {
+		err = f.f.Sync()
+	}
+	if cerr := f.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.f.Name())
+	}
+	return err
+}
+
+func (f *diskFile) Abort() {
+	f.f.Close()
+	os.Remove(f.f.Name())
+}
@@ -0,0 +1,343 @@
+package sessionstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Request bodies are not hashed, so uploads stream from disk; S3 and its
+// clones accept this for SigV4.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3 stores sessions as objects in an S3-compatible bucket (AWS S3,
+// MinIO, Ceph RGW and the like), under an optional key prefix.
+type S3 struct {
+	scheme    string
+	host      string
+	bucket    string
+	prefix    string // "" or ending in "/"
+	region    string
+	pathStyle bool // bucket in the path, not the host name
+
+	accessKey string
+	secretKey string
+	token     string
+
+	client *http.Client
+}
+
+// newS3FromURL configures a store from s3://bucket/prefix. Without an
+// endpoint query parameter it talks to AWS, addressing the bucket by host
+// name; with one, the bucket goes in the path, which is what self-hosted
+// object stores expect.
+func newS3FromURL(u *url.URL) (*S3, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("session store %s: no bucket", u.Redacted())
+	}
+	q := u.Query()
+	s := &S3{
+		bucket:    u.Host,
+		prefix:    strings.Trim(u.Path, "/"),
+		region:    q.Get("region"),
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.prefix != "" {
+		s.prefix += "/"
+	}
+	if s.region == "" {
+		s.region = os.Getenv("AWS_REGION")
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, fmt.Errorf("session store %s: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set", s)
+	}
+
+	endpoint := q.Get("endpoint")
+	if endpoint == "" {
+		endpoint = "https://s3." + s.region + ".amazonaws.com"
+	} else {
+		s.pathStyle = true
+	}
+	ep, err := url.Parse(endpoint)
+	if err != nil || (ep.Scheme != "http" && ep.Scheme != "https") || ep.Host == "" {
+		return nil, fmt.Errorf("session store %s: endpoint %q is not an http(s) URL", s, endpoint)
+	}
+	s.scheme, s.host = ep.Scheme, ep.Host
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.ResponseHeaderTimeout = time.Minute
+	s.client = &http.Client{Transport: tr}
+	return s, nil
+}
+
+func (s *S3) String() string {
+	return "s3://" + s.bucket + "/" + s.prefix
+}
+
+// List returns the names of the objects under the prefix, leaving out
+// any in "subdirectories".
+func (s *S3) List() ([]string, error) {
+	var names []string
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := s.do(http.MethodGet, "", q, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		var res struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 list: %w", err)
+		}
+		for _, c := range res.Contents {
+			name := strings.TrimPrefix(c.Key, s.prefix)
+			if name != "" && !strings.Contains(name, "/") {
+				names = append(names, name)
+			}
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return names, nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+func (s *S3) Open(name string) (io.ReadCloser, error) {
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	resp, err := s.do(http.MethodGet, s.prefix+name, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Create spools the file to a temporary file, as S3 needs the length of
+// an upload up front, and uploads it on Close.
+func (s *S3) Create(name string) (Writer, error) {
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp("", "sniffox-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	return &s3Upload{s: s, key: s.prefix + name, f: f}, nil
+}
+
+func (s *S3) Remove(name string) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodDelete, s.prefix+name, nil, nil, 0)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type s3Upload struct {
+	s   *S3
+	key string
+	f   *os.File
+}
+
+func (u *s3Upload) Write(p []byte) (int, error) { return u.f.Write(p) }
+
+func (u *s3Upload) Close() error {
+	defer os.Remove(u.f.Name())
+	defer u.f.Close()
+	size, err := u.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := u.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	resp, err := u.s.do(http.MethodPut, u.key, nil, u.f, size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (u *s3Upload) Abort() {
+	u.f.Close()
+	os.Remove(u.f.Name())
+}
+
+// s3Error is an error response from the object store.
+type s3Error struct {
+	Op      string
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3 %s: %s", e.Op, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("s3 %s: %s: %s", e.Op, e.Code, e.Message)
+}
+
+func (e *s3Error) Unwrap() error {
+	if e.Status == http.StatusNotFound && e.Code != "NoSuchBucket" {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+// do sends a signed request for key (the bucket itself when empty) and
+// returns the response if it succeeded.
+func (s *S3) do(method, key string, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	host, path := s.host, "/"
+	if s.pathStyle {
+		path += s.bucket + "/"
+	} else {
+		host = s.bucket + "." + host
+	}
+	path = uriEncode(path+key, false)
+	rawQuery := canonicalQuery(query)
+	u := s.scheme + "://" + host + path
+	if rawQuery != "" {
+		u += "?" + rawQuery
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	s.sign(req, host, path, rawQuery, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s: %w", method, key, err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	e := &s3Error{Op: method + " " + key, Status: resp.StatusCode}
+	var doc struct {
+		Code    string
+		Message string
+	}
+	if xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&doc) == nil {
+		e.Code, e.Message = doc.Code, doc.Message
+	}
+	return nil, e
+}
+
+// sign adds an AWS Signature Version 4 Authorization header.
+func (s *S3) sign(req *http.Request, host, path, rawQuery string, now time.Time) {
+	stamp := now.UTC().Format("20060102T150405Z")
+	date := stamp[:8]
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if s.token != "" {
+		req.Header.Set("X-Amz-Security-Token", s.token)
+		signed = append(signed, "x-amz-security-token")
+	}
+
+	var headers strings.Builder
+	for _, h := range signed {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = host
+		}
+		headers.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	canonical := strings.Join([]string{
+		req.Method, path, rawQuery, headers.String(), strings.Join(signed, ";"), unsignedPayload,
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, strings.Join(signed, ";"), hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// canonicalQuery encodes query the way SigV4 signs it: sorted by key,
+// every value percent-encoded.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but RFC 3986 unreserved characters
+// and, unless encodeSlash is set, "/".
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
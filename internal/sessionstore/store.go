@@ -0,0 +1,93 @@
+// Package sessionstore keeps saved captures — a pcap file and its JSON
+// metadata per session — on local disk, a mounted network share or
+// S3-compatible object storage, so a team can keep its captures in one
+// place.
+package sessionstore
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Store holds session files by name. Names are flat: "<id>.pcap" and
+// "<id>.json".
+type Store interface {
+	// List returns the names of all stored files.
+	List() ([]string, error)
+	// Open reads a file. A missing file is an error wrapping
+	// fs.ErrNotExist.
+	Open(name string) (io.ReadCloser, error)
+	// Create writes a file, which replaces any of the same name when the
+	// writer is closed without error. Readers never see it half-written.
+	Create(name string) (Writer, error)
+	// Remove deletes a file; removing a missing one is not an error.
+	Remove(name string) error
+	// String describes the store for logs.
+	String() string
+}
+
+// Writer writes a file to a store.
+type Writer interface {
+	io.WriteCloser
+	// Abort discards the file instead of closing it.
+	Abort()
+}
+
+// Local is implemented by stores whose files are in a directory on a file
+// system, so they can be read in place instead of copied.
+type Local interface {
+	Dir() string
+}
+
+// Open returns the store described by spec:
+//
+//	sessions                    directory on local disk
+//	file:///var/lib/sniffox     the same, as a URL
+//	share:///mnt/captures       mounted network share (SMB, NFS)
+//	s3://bucket/prefix?region=eu-west-1&endpoint=http://minio:9000
+//
+// S3 credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+// and AWS_SESSION_TOKEN.
+func Open(spec string) (Store, error) {
+	if !strings.Contains(spec, "://") {
+		return NewDisk(spec), nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("session store %q: %w", spec, err)
+	}
+	switch u.Scheme {
+	case "file":
+		return NewDisk(u.Path), nil
+	case "share":
+		return NewShare(u.Path)
+	case "s3":
+		return newS3FromURL(u)
+	default:
+		return nil, fmt.Errorf("session store %q: unknown scheme %q (want file, share or s3)", spec, u.Scheme)
+	}
+}
+
+// SameDir reports whether s keeps its files in dir, where files put in
+// dir are therefore already stored.
+func SameDir(s Store, dir string) bool {
+	l, ok := s.(Local)
+	if !ok {
+		return false
+	}
+	a, err1 := filepath.Abs(l.Dir())
+	b, err2 := filepath.Abs(dir)
+	return err1 == nil && err2 == nil && a == b
+}
+
+// validName rejects names that would leave the store's directory or
+// prefix.
+func validName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid session file name %q", name)
+	}
+	return nil
+}
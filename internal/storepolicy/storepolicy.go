@@ -0,0 +1,93 @@
+// Package storepolicy decides how much of each packet a capture keeps,
+// from an ordered list of display filter rules: whole packets for the
+// protocols worth investigating, headers only for bulk encrypted data,
+// nothing at all for traffic that only costs memory.
+package storepolicy
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/filter"
+	"sniffox/internal/models"
+)
+
+// Storage levels.
+const (
+	// StoreFull keeps the whole packet, and its stream's payload.
+	StoreFull = "full"
+	// StoreHeaders keeps the packet up to its transport payload and none
+	// of its stream's payload.
+	StoreHeaders = "headers"
+	// StoreNone keeps neither the packet nor its stream's payload. The
+	// packet is still dissected, counted and shown live.
+	StoreNone = "none"
+)
+
+// Rule is one storage rule.
+type Rule struct {
+	Filter   string `json:"filter"`
+	Store    string `json:"store"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// Set is an ordered list of storage rules, safe for concurrent use.
+type Set struct {
+	mu       sync.RWMutex
+	rules    []Rule
+	compiled []*filter.Filter // nil for disabled rules
+}
+
+// New creates an empty rule set; every packet is kept whole.
+func New() *Set {
+	return &Set{}
+}
+
+// SetRules replaces the rules. Nothing changes if any enabled rule's
+// filter or storage level is invalid.
+func (s *Set) SetRules(rules []Rule) error {
+	compiled := make([]*filter.Filter, len(rules))
+	for i, r := range rules {
+		switch r.Store {
+		case StoreFull, StoreHeaders, StoreNone:
+		default:
+			return fmt.Errorf("rule %d: store must be %s, %s or %s", i+1, StoreFull, StoreHeaders, StoreNone)
+		}
+		if r.Disabled {
+			continue
+		}
+		f, err := filter.Compile(r.Filter)
+		if err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		compiled[i] = f
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append([]Rule(nil), rules...)
+	s.compiled = compiled
+	return nil
+}
+
+// Rules returns a copy of the rules in order.
+func (s *Set) Rules() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Rule{}, s.rules...)
+}
+
+// Match returns the storage level of the first enabled rule matching the
+// packet, or StoreFull.
+func (s *Set) Match(pkt gopacket.Packet, info *models.PacketInfo) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i, f := range s.compiled {
+		if f != nil && f.Match(pkt, info) {
+			return s.rules[i].Store
+		}
+	}
+	return StoreFull
+}
@@ -1,8 +1,11 @@
 package stream
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
+	"log"
 	"sync"
 	"time"
 
@@ -10,6 +13,9 @@ import (
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/tcpassembly"
 	"github.com/google/gopacket/tcpassembly/tcpreader"
+
+	"sniffox/internal/parser"
+	"sniffox/internal/tlsdecrypt"
 )
 
 const (
@@ -23,9 +29,11 @@ type Broadcaster interface {
 	BroadcastStreamEvent(eventType string, payload json.RawMessage)
 }
 
-// StreamData holds the reassembled data for one stream.
+// StreamData holds the reassembled data for one TCP stream or UDP
+// conversation.
 type StreamData struct {
 	ID         uint64           `json:"id"`
+	Protocol   string           `json:"protocol"` // TCP or UDP
 	ClientData []byte           `json:"-"`
 	ServerData []byte           `json:"-"`
 	HTTPInfo   *HTTPTransaction `json:"httpInfo,omitempty"`
@@ -35,17 +43,91 @@ type StreamData struct {
 	DstPort    uint16           `json:"dstPort"`
 	StartTime  time.Time        `json:"startTime"`
 	LastSeen   time.Time        `json:"lastSeen"`
+	Datagrams  []Datagram       `json:"-"` // UDP only
+
+	// SNI and JA3 come from a TLS ClientHello parsed from the reassembled
+	// client data, so they are found even when it spans several segments.
+	SNI     string `json:"sni,omitempty"`
+	JA3     string `json:"ja3,omitempty"`
+	tlsDone bool   // the ClientHello was parsed or the stream is not TLS
+
+	// discarded streams keep no payload, by the capture's storage policy
+	discarded bool
+	// dropped is set once a handler panicked on the stream; no handler is
+	// given it again
+	dropped bool
+	// ftpData is set for an FTP data connection, which keeps up to the
+	// object limit so the file can be exported whole
+	ftpData bool
+
+	turns []turn // order in which the two directions' data arrived
 }
 
 // StreamDataResponse is what we send to clients.
 type StreamDataResponse struct {
 	StreamID   uint64           `json:"streamId"`
+	Protocol   string           `json:"protocol"`
 	ClientData string           `json:"clientData"` // base64
 	ServerData string           `json:"serverData"` // base64
 	HTTPInfo   *HTTPTransaction `json:"httpInfo,omitempty"`
+	HTTP2      []HTTP2Exchange  `json:"http2,omitempty"`     // cleartext HTTP/2 and gRPC
+	Datagrams  []Datagram       `json:"datagrams,omitempty"` // UDP message boundaries
+
+	// WebSocket lists the frames sent after an HTTP/1.1 Upgrade to
+	// WebSocket, in both directions
+	WebSocket []WebSocketFrame `json:"websocket,omitempty"`
+
+	// Mail is the SMTP, POP3 or IMAP conversation, up to a STARTTLS
+	Mail *MailSession `json:"mail,omitempty"`
+
+	// DecodedServerData is ServerData with its HTTP/1.x bodies dechunked
+	// and decompressed, base64; omitted when that changes nothing.
+	DecodedServerData string `json:"decodedServerData,omitempty"`
+
+	// TLS is set when a TLS stream was decrypted with key log secrets. The
+	// plaintext is in DecryptedClientData and DecryptedServerData, base64,
+	// and HTTPInfo, HTTP2 and DecodedServerData are taken from it.
+	TLS                 *tlsdecrypt.Session `json:"tls,omitempty"`
+	DecryptedClientData string              `json:"decryptedClientData,omitempty"`
+	DecryptedServerData string              `json:"decryptedServerData,omitempty"`
+	// TLSError is why a TLS stream could not be decrypted, when key log
+	// secrets are loaded
+	TLSError string `json:"tlsError,omitempty"`
+	// Discarded is set when the storage policy dropped the stream's payload
+	Discarded bool `json:"discarded,omitempty"`
+}
+
+// StreamSummary is the metadata of a stream without its payload.
+type StreamSummary struct {
+	StreamID    uint64    `json:"streamId"`
+	Protocol    string    `json:"protocol"`
+	SrcAddr     string    `json:"srcAddr"`
+	DstAddr     string    `json:"dstAddr"`
+	SrcPort     uint16    `json:"srcPort"`
+	DstPort     uint16    `json:"dstPort"`
+	ClientBytes int       `json:"clientBytes"`
+	ServerBytes int       `json:"serverBytes"`
+	StartTime   time.Time `json:"startTime"`
+	LastSeen    time.Time `json:"lastSeen"`
+	HTTPMethod  string    `json:"httpMethod,omitempty"`
+	HTTPURL     string    `json:"httpUrl,omitempty"`
+	HTTPStatus  int       `json:"httpStatus,omitempty"`
+	SNI         string    `json:"sni,omitempty"`
+	JA3         string    `json:"ja3,omitempty"`
 }
 
-// Manager coordinates TCP stream reassembly.
+// ClientHelloHandler is called with a TCP stream's endpoints, oriented
+// client to server, once its ClientHello has been reassembled and parsed.
+type ClientHelloHandler func(client, server string, clientPort, serverPort uint16, hello *parser.TLSClientHelloInfo)
+
+// DataHandler is called with the bytes one direction of a TCP stream
+// delivers, in order, as they are reassembled. The endpoints are those of
+// the stream, fromClient tells the direction and ts is when the segment
+// completing data was captured. data is nil once the direction has ended.
+type DataHandler func(id uint64, client, server string, clientPort, serverPort uint16, fromClient bool, data []byte, ts time.Time)
+
+// Manager coordinates TCP stream reassembly and UDP conversation
+// following.
 type Manager struct {
 	mu          sync.Mutex
 	factory     *sniffoxStreamFactory
@@ -55,13 +137,20 @@ type Manager struct {
 	lookupMap   map[flowKey]uint64 // (net,transport) -> streamID
 	inputCh     chan gopacket.Packet
 	stopCh      chan struct{}
+	doneCh      chan struct{} // closed when the assembler goroutine exits
+	lossless    bool          // Feed waits instead of dropping
 	broadcaster Broadcaster
+	onHello     ClientHelloHandler
+	onData      DataHandler
+	keys        *tlsdecrypt.KeyLog // nil: TLS streams are not decrypted
+	objectLimit int                // largest HTTP object; 0 is DefaultObjectLimit
 	nextID      uint64
 }
 
 type flowKey struct {
 	net       string
 	transport string
+	kind      gopacket.EndpointType // keeps TCP and UDP on the same ports apart
 }
 
 // NewManager creates a new stream reassembly manager.
@@ -71,6 +160,7 @@ func NewManager(broadcaster Broadcaster) *Manager {
 		lookupMap:   make(map[flowKey]uint64),
 		inputCh:     make(chan gopacket.Packet, inputChanCap),
 		stopCh:      make(chan struct{}),
+		doneCh:      make(chan struct{}),
 		broadcaster: broadcaster,
 	}
 
@@ -81,8 +171,42 @@ func NewManager(broadcaster Broadcaster) *Manager {
 	return m
 }
 
-// Feed sends a packet to the assembler goroutine. Non-blocking.
+// SetClientHelloHandler sets the function told about TLS ClientHellos found
+// in reassembled streams.
+func (m *Manager) SetClientHelloHandler(h ClientHelloHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onHello = h
+}
+
+// SetDataHandler sets the function given the reassembled bytes of every
+// TCP stream, including those whose payload is discarded.
+func (m *Manager) SetDataHandler(h DataHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onData = h
+}
+
+// SetKeyLog sets the TLS secrets streams are decrypted with.
+func (m *Manager) SetKeyLog(k *tlsdecrypt.KeyLog) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = k
+}
+
+// SetLossless makes Feed wait for the assembler rather than drop packets
+// when it falls behind. Call it before Start.
+func (m *Manager) SetLossless(on bool) {
+	m.lossless = on
+}
+
+// Feed sends a packet to the assembler goroutine. Non-blocking unless the
+// manager is lossless.
 func (m *Manager) Feed(pkt gopacket.Packet) {
+	if m.lossless {
+		m.inputCh <- pkt
+		return
+	}
 	select {
 	case m.inputCh <- pkt:
 	default:
@@ -100,6 +224,11 @@ func (m *Manager) Stop() {
 	close(m.stopCh)
 }
 
+// Wait blocks until the assembler has stopped and flushed its streams.
+func (m *Manager) Wait() {
+	<-m.doneCh
+}
+
 // GetStreamData returns the reassembled data for a stream.
 func (m *Manager) GetStreamData(id uint64) *StreamDataResponse {
 	m.mu.Lock()
@@ -112,17 +241,109 @@ func (m *Manager) GetStreamData(id uint64) *StreamDataResponse {
 
 	resp := &StreamDataResponse{
 		StreamID:   id,
+		Protocol:   sd.Protocol,
 		ClientData: base64.StdEncoding.EncodeToString(sd.ClientData),
 		ServerData: base64.StdEncoding.EncodeToString(sd.ServerData),
 		HTTPInfo:   sd.HTTPInfo,
+		HTTP2:      tryParseHTTP2(sd.ClientData, sd.ServerData),
+		Datagrams:  append([]Datagram(nil), sd.Datagrams...),
+		Discarded:  sd.discarded,
+	}
+	if sd.HTTPInfo != nil {
+		// The transaction was parsed from the first data; the response
+		// may have arrived since
+		if tx, err := tryParseHTTP(sd.ClientData, sd.ServerData); err == nil {
+			resp.HTTPInfo = tx
+		}
+		if decoded := decodeHTTPBodies(sd.ServerData, true); !bytes.Equal(decoded, sd.ServerData) {
+			resp.DecodedServerData = base64.StdEncoding.EncodeToString(decoded)
+		}
+		resp.WebSocket = tryParseWebSocket(sd.ClientData, sd.ServerData, sd.turns)
 	}
+	if sd.Protocol == "TCP" {
+		resp.Mail = tryParseMail(parser.MailProtocol(sd.DstPort), sd.ClientData, sd.ServerData)
+	}
+	m.decrypt(sd, resp)
 	return resp
 }
 
+// decrypt fills in the plaintext of a TLS stream the key log has secrets
+// for, and the HTTP found in it. A mail stream is decrypted from its
+// STARTTLS on, after the cleartext that precedes it. The caller holds
+// m.mu.
+func (m *Manager) decrypt(sd *StreamData, resp *StreamDataResponse) {
+	client, server := sd.ClientData, sd.ServerData
+	var clearClient, clearServer []byte
+	if resp.Mail != nil && resp.Mail.STARTTLS != nil {
+		u := resp.Mail.STARTTLS
+		clearClient, client = client[:u.ClientOffset], client[u.ClientOffset:]
+		clearServer, server = server[:u.ServerOffset], server[u.ServerOffset:]
+	}
+	if m.keys == nil || m.keys.Len() == 0 || sd.Protocol != "TCP" || len(client) == 0 || client[0] != 0x16 {
+		return
+	}
+	sess, err := tlsdecrypt.Decrypt(client, server, m.keys)
+	if err != nil {
+		if err != tlsdecrypt.ErrNotTLS {
+			resp.TLSError = err.Error()
+		}
+		return
+	}
+	resp.TLS = sess
+	resp.DecryptedClientData = base64.StdEncoding.EncodeToString(append(clearClient[:len(clearClient):len(clearClient)], sess.ClientData...))
+	resp.DecryptedServerData = base64.StdEncoding.EncodeToString(append(clearServer[:len(clearServer):len(clearServer)], sess.ServerData...))
+	if tx, err := tryParseHTTP(sess.ClientData, sess.ServerData); err == nil {
+		resp.HTTPInfo = tx
+		if decoded := decodeHTTPBodies(sess.ServerData, true); !bytes.Equal(decoded, sess.ServerData) {
+			resp.DecodedServerData = base64.StdEncoding.EncodeToString(decoded)
+		}
+		// Record boundaries do not say how the directions interleave
+		resp.WebSocket = tryParseWebSocket(sess.ClientData, sess.ServerData, nil)
+	}
+	if h2 := tryParseHTTP2(sess.ClientData, sess.ServerData); len(h2) > 0 {
+		resp.HTTP2 = h2
+	}
+}
+
+// ListStreams returns metadata for every tracked stream, ordered by ID.
+func (m *Manager) ListStreams() []StreamSummary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]StreamSummary, 0, len(m.streams))
+	for id := uint64(1); id <= m.nextID; id++ {
+		sd, ok := m.streams[id]
+		if !ok {
+			continue
+		}
+		sum := StreamSummary{
+			StreamID:    id,
+			Protocol:    sd.Protocol,
+			SrcAddr:     sd.SrcAddr,
+			DstAddr:     sd.DstAddr,
+			SrcPort:     sd.SrcPort,
+			DstPort:     sd.DstPort,
+			ClientBytes: len(sd.ClientData),
+			ServerBytes: len(sd.ServerData),
+			StartTime:   sd.StartTime,
+			LastSeen:    sd.LastSeen,
+			SNI:         sd.SNI,
+			JA3:         sd.JA3,
+		}
+		if sd.HTTPInfo != nil {
+			sum.HTTPMethod = sd.HTTPInfo.Method
+			sum.HTTPURL = sd.HTTPInfo.URL
+			sum.HTTPStatus = sd.HTTPInfo.StatusCode
+		}
+		out = append(out, sum)
+	}
+	return out
+}
+
 // GetStreamID returns the stream ID for a given network/transport flow.
-func (m *Manager) GetStreamID(netFlow, tcpFlow gopacket.Flow) uint64 {
-	key := makeFlowKey(netFlow, tcpFlow)
-	reverseKey := makeFlowKey(netFlow.Reverse(), tcpFlow.Reverse())
+func (m *Manager) GetStreamID(netFlow, transportFlow gopacket.Flow) uint64 {
+	key := makeFlowKey(netFlow, transportFlow)
+	reverseKey := makeFlowKey(netFlow.Reverse(), transportFlow.Reverse())
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -140,38 +361,48 @@ func makeFlowKey(net, transport gopacket.Flow) flowKey {
 	return flowKey{
 		net:       net.String(),
 		transport: transport.String(),
+		kind:      transport.EndpointType(),
 	}
 }
 
 func (m *Manager) assembleLoop() {
+	defer close(m.doneCh)
 	flushTicker := time.NewTicker(flushInterval)
 	defer flushTicker.Stop()
 
 	for {
 		select {
 		case <-m.stopCh:
+			// A lossless manager reassembles everything it was fed
+			for m.lossless && len(m.inputCh) > 0 {
+				m.assemble(<-m.inputCh)
+			}
 			m.assembler.FlushAll()
 			return
 		case pkt, ok := <-m.inputCh:
 			if !ok {
 				return
 			}
-			tcpLayer := pkt.Layer(layers.LayerTypeTCP)
-			if tcpLayer == nil {
-				continue
-			}
-			tcp := tcpLayer.(*layers.TCP)
-			m.assembler.AssembleWithTimestamp(
-				pkt.NetworkLayer().NetworkFlow(),
-				tcp,
-				pkt.Metadata().Timestamp,
-			)
+			m.assemble(pkt)
 		case <-flushTicker.C:
 			m.assembler.FlushOlderThan(time.Now().Add(-flushInterval))
 		}
 	}
 }
 
+func (m *Manager) assemble(pkt gopacket.Packet) {
+	tcpLayer := pkt.Layer(layers.LayerTypeTCP)
+	if tcpLayer == nil {
+		return
+	}
+	tcp := tcpLayer.(*layers.TCP)
+	m.assembler.AssembleWithTimestamp(
+		pkt.NetworkLayer().NetworkFlow(),
+		tcp,
+		pkt.Metadata().Timestamp,
+	)
+}
+
 func (m *Manager) registerStream(netFlow, tcpFlow gopacket.Flow) (uint64, *StreamData) {
 	key := makeFlowKey(netFlow, tcpFlow)
 	reverseKey := makeFlowKey(netFlow.Reverse(), tcpFlow.Reverse())
@@ -189,13 +420,15 @@ func (m *Manager) registerStream(netFlow, tcpFlow gopacket.Flow) (uint64, *Strea
 
 	sd := &StreamData{
 		ID:        id,
+		Protocol:  "TCP",
 		SrcAddr:   netFlow.Src().String(),
 		DstAddr:   netFlow.Dst().String(),
-		SrcPort:   uint16(tcpFlow.Src().EndpointType()),
-		DstPort:   uint16(tcpFlow.Dst().EndpointType()),
+		SrcPort:   endpointPort(tcpFlow.Src()),
+		DstPort:   endpointPort(tcpFlow.Dst()),
 		StartTime: time.Now(),
 		LastSeen:  time.Now(),
 	}
+	_, sd.ftpData = parser.FTPDataTransfer(sd.SrcAddr, sd.SrcPort, sd.DstAddr, sd.DstPort)
 
 	m.streams[id] = sd
 	m.lookupMap[key] = id
@@ -203,24 +436,48 @@ func (m *Manager) registerStream(netFlow, tcpFlow gopacket.Flow) (uint64, *Strea
 	return id, sd
 }
 
-func (m *Manager) appendData(id uint64, netFlow gopacket.Flow, data []byte) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// endpointPort returns the port number of a TCP or UDP endpoint.
+func endpointPort(ep gopacket.Endpoint) uint16 {
+	if raw := ep.Raw(); len(raw) == 2 {
+		return binary.BigEndian.Uint16(raw)
+	}
+	return 0
+}
 
+func (m *Manager) appendData(id uint64, netFlow gopacket.Flow, data []byte, ts time.Time) {
+	m.mu.Lock()
 	sd, ok := m.streams[id]
 	if !ok {
+		m.mu.Unlock()
 		return
 	}
 
 	sd.LastSeen = time.Now()
-
 	// Determine direction: if netFlow.Src matches stored SrcAddr, it's client data
 	isClient := netFlow.Src().String() == sd.SrcAddr
+	onData := m.onData
+	if sd.dropped {
+		onData = nil
+	}
+	client, server, clientPort, serverPort := sd.SrcAddr, sd.DstAddr, sd.SrcPort, sd.DstPort
+	if sd.discarded {
+		m.mu.Unlock()
+		if onData != nil {
+			m.runHandlers(id, func() {
+				onData(id, client, server, clientPort, serverPort, isClient, data, ts)
+			})
+		}
+		return
+	}
 
 	if isClient {
-		sd.ClientData = appendCapped(sd.ClientData, data, maxStreamBuffer)
+		n := len(sd.ClientData)
+		sd.ClientData = appendCapped(sd.ClientData, data, m.dataCap(sd, true))
+		sd.addTurn(true, len(sd.ClientData)-n)
 	} else {
-		sd.ServerData = appendCapped(sd.ServerData, data, maxStreamBuffer)
+		n := len(sd.ServerData)
+		sd.ServerData = appendCapped(sd.ServerData, data, m.dataCap(sd, false))
+		sd.addTurn(false, len(sd.ServerData)-n)
 	}
 
 	// Try HTTP parse on first data
@@ -229,6 +486,71 @@ func (m *Manager) appendData(id uint64, netFlow gopacket.Flow, data []byte) {
 			sd.HTTPInfo = tx
 		}
 	}
+
+	// Parse the ClientHello once the client has sent all of it
+	var hello *parser.TLSClientHelloInfo
+	if isClient && !sd.tlsDone {
+		var more bool
+		if hello, more = parser.ParseTLSClientHelloStream(sd.ClientData); !more || len(sd.ClientData) >= maxStreamBuffer {
+			sd.tlsDone = true
+		}
+		if hello != nil {
+			sd.SNI, sd.JA3 = hello.SNI, hello.JA3Hash
+		}
+	}
+	onHello := m.onHello
+	if sd.dropped {
+		onHello = nil
+	}
+	m.mu.Unlock()
+
+	if (hello == nil || onHello == nil) && onData == nil {
+		return
+	}
+	m.runHandlers(id, func() {
+		if hello != nil && onHello != nil {
+			onHello(client, server, clientPort, serverPort, hello)
+		}
+		if onData != nil {
+			onData(id, client, server, clientPort, serverPort, isClient, data, ts)
+		}
+	})
+}
+
+// runHandlers calls the handlers of stream id through fn. They run on the
+// stream's reassembly goroutine, so a panic is recovered there: it is
+// logged and the stream dropped, its payload discarded and no handler
+// given it again.
+func (m *Manager) runHandlers(id uint64, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("stream %d: handler panic, dropping the stream: %v", id, r)
+			m.mu.Lock()
+			if sd, ok := m.streams[id]; ok {
+				sd.dropped = true
+			}
+			m.mu.Unlock()
+			m.Discard(id)
+		}
+	}()
+	fn()
+}
+
+// endData tells the data handler that one direction of a stream ended.
+func (m *Manager) endData(id uint64, netFlow gopacket.Flow, ts time.Time) {
+	m.mu.Lock()
+	sd, ok := m.streams[id]
+	onData := m.onData
+	if !ok || onData == nil || sd.dropped {
+		m.mu.Unlock()
+		return
+	}
+	isClient := netFlow.Src().String() == sd.SrcAddr
+	client, server, clientPort, serverPort := sd.SrcAddr, sd.DstAddr, sd.SrcPort, sd.DstPort
+	m.mu.Unlock()
+	m.runHandlers(id, func() {
+		onData(id, client, server, clientPort, serverPort, isClient, nil, ts)
+	})
 }
 
 func appendCapped(buf, data []byte, cap int) []byte {
@@ -259,14 +581,43 @@ func (f *sniffoxStreamFactory) New(netFlow, tcpFlow gopacket.Flow) tcpassembly.S
 	}
 
 	go s.readLoop()
-	return &reader
+	return s
 }
 
+// sniffoxStream is one direction of a TCP stream. The assembler hands it
+// segments in order and readLoop passes their bytes on.
 type sniffoxStream struct {
 	id      uint64
 	mgr     *Manager
 	netFlow gopacket.Flow
 	reader  *tcpreader.ReaderStream
+
+	// seen is the capture time of the last segment reassembled. The
+	// reader hands all of a segment's bytes on before the next is
+	// reassembled, so it dates what readLoop reads.
+	mu   sync.Mutex
+	seen time.Time
+}
+
+// Reassembled implements tcpassembly.Stream.
+func (s *sniffoxStream) Reassembled(rs []tcpassembly.Reassembly) {
+	if len(rs) > 0 {
+		s.mu.Lock()
+		s.seen = rs[len(rs)-1].Seen
+		s.mu.Unlock()
+	}
+	s.reader.Reassembled(rs)
+}
+
+// ReassemblyComplete implements tcpassembly.Stream.
+func (s *sniffoxStream) ReassemblyComplete() {
+	s.reader.ReassemblyComplete()
+}
+
+func (s *sniffoxStream) lastSeen() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seen
 }
 
 func (s *sniffoxStream) readLoop() {
@@ -276,14 +627,30 @@ func (s *sniffoxStream) readLoop() {
 		if n > 0 {
 			data := make([]byte, n)
 			copy(data, buf[:n])
-			s.mgr.appendData(s.id, s.netFlow, data)
+			s.mgr.appendData(s.id, s.netFlow, data, s.lastSeen())
 		}
 		if err != nil {
+			s.mgr.endData(s.id, s.netFlow, s.lastSeen())
 			return
 		}
 	}
 }
 
+// Discard drops the payload buffered for a stream and keeps none of what
+// follows; the stream is still listed. HTTP and TLS details already parsed
+// from it are kept.
+func (m *Manager) Discard(id uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sd, ok := m.streams[id]
+	if !ok || sd.discarded {
+		return
+	}
+	sd.discarded = true
+	sd.ClientData, sd.ServerData = nil, nil
+	sd.Datagrams, sd.turns = nil, nil
+}
+
 // Reset clears all stream data.
 func (m *Manager) Reset() {
 	m.mu.Lock()
@@ -292,4 +659,3 @@ func (m *Manager) Reset() {
 	m.lookupMap = make(map[flowKey]uint64)
 	m.nextID = 0
 }
-
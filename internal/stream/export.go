@@ -0,0 +1,321 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Export formats, as in Wireshark's Follow Stream "Show data as".
+const (
+	FormatRaw    = "raw"  // the bytes as sent
+	FormatHex    = "hex"  // hex dump with offsets and ASCII
+	FormatCArray = "carr" // one C array per turn, peer0 the client
+)
+
+// Export directions.
+const (
+	DirClient = "client"
+	DirServer = "server"
+	DirBoth   = "both" // both directions in arrival order
+)
+
+// ErrStreamNotFound is returned when no stream has the requested ID.
+var ErrStreamNotFound = errors.New("stream not found")
+
+// ExportOptions selects what Export writes.
+type ExportOptions struct {
+	Format    string
+	Direction string
+	// Dechunk decodes HTTP/1.1 chunked bodies and drops their
+	// Transfer-Encoding header. Each turn is decoded separately.
+	Dechunk bool
+	// Decompress also undoes gzip, deflate and br Content-Encoding; it
+	// implies Dechunk.
+	Decompress bool
+}
+
+// turn is a run of data one side sent before the other replied.
+type turn struct {
+	fromClient bool
+	n          int
+}
+
+// addTurn records n bytes stored for one direction, extending the last
+// turn if the same side sent it.
+func (sd *StreamData) addTurn(fromClient bool, n int) {
+	if n <= 0 {
+		return
+	}
+	if last := len(sd.turns) - 1; last >= 0 && sd.turns[last].fromClient == fromClient {
+		sd.turns[last].n += n
+		return
+	}
+	sd.turns = append(sd.turns, turn{fromClient: fromClient, n: n})
+}
+
+// piece is the data of one turn, or of a whole direction.
+type piece struct {
+	fromClient bool
+	data       []byte
+}
+
+func (o ExportOptions) validate() error {
+	switch o.Format {
+	case FormatRaw, FormatHex, FormatCArray:
+	default:
+		return fmt.Errorf("unknown export format %q", o.Format)
+	}
+	switch o.Direction {
+	case DirClient, DirServer, DirBoth:
+	default:
+		return fmt.Errorf("unknown direction %q", o.Direction)
+	}
+	return nil
+}
+
+// Export dumps the reassembled contents of a stream like Wireshark's
+// Follow Stream "Save As".
+func (m *Manager) Export(id uint64, opts ExportOptions) ([]byte, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	sd, ok := m.streams[id]
+	var pieces []piece
+	if ok {
+		pieces = sd.pieces(opts.Direction)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return nil, ErrStreamNotFound
+	}
+
+	if opts.Dechunk || opts.Decompress {
+		for i := range pieces {
+			pieces[i].data = decodeHTTPBodies(pieces[i].data, opts.Decompress)
+		}
+	}
+
+	var buf bytes.Buffer
+	switch opts.Format {
+	case FormatRaw:
+		for _, p := range pieces {
+			buf.Write(p.data)
+		}
+	case FormatHex:
+		writeHexDump(&buf, pieces)
+	case FormatCArray:
+		writeCArrays(&buf, pieces)
+	}
+	return buf.Bytes(), nil
+}
+
+// pieces copies the data of one direction, or of both split into turns.
+// The caller holds m.mu.
+func (sd *StreamData) pieces(dir string) []piece {
+	switch dir {
+	case DirClient:
+		return []piece{{true, bytes.Clone(sd.ClientData)}}
+	case DirServer:
+		return []piece{{false, bytes.Clone(sd.ServerData)}}
+	}
+	var out []piece
+	var client, server int
+	for _, t := range sd.turns {
+		if t.fromClient {
+			out = append(out, piece{true, bytes.Clone(sd.ClientData[client : client+t.n])})
+			client += t.n
+		} else {
+			out = append(out, piece{false, bytes.Clone(sd.ServerData[server : server+t.n])})
+			server += t.n
+		}
+	}
+	return out
+}
+
+// writeHexDump writes 16 bytes per line with an offset that counts each
+// direction separately. Server data is indented, as Wireshark does.
+func writeHexDump(buf *bytes.Buffer, pieces []piece) {
+	var offsets [2]int
+	for _, p := range pieces {
+		indent, side := "", 0
+		if !p.fromClient {
+			indent, side = "    ", 1
+		}
+		for i := 0; i < len(p.data); i += 16 {
+			line := p.data[i:min(i+16, len(p.data))]
+			fmt.Fprintf(buf, "%s%08x  ", indent, offsets[side]+i)
+			for j := 0; j < 16; j++ {
+				if j < len(line) {
+					fmt.Fprintf(buf, "%02x ", line[j])
+				} else {
+					buf.WriteString("   ")
+				}
+				if j == 7 {
+					buf.WriteByte(' ')
+				}
+			}
+			buf.WriteByte(' ')
+			for _, c := range line {
+				if c < 0x20 || c > 0x7e {
+					c = '.'
+				}
+				buf.WriteByte(c)
+			}
+			buf.WriteByte('\n')
+		}
+		offsets[side] += len(p.data)
+	}
+}
+
+// writeCArrays writes each turn as a C array named peer0_N for the client
+// and peer1_N for the server.
+func writeCArrays(buf *bytes.Buffer, pieces []piece) {
+	var counts [2]int
+	for _, p := range pieces {
+		side := 0
+		if !p.fromClient {
+			side = 1
+		}
+		fmt.Fprintf(buf, "char peer%d_%d[] = {", side, counts[side])
+		counts[side]++
+		for i, c := range p.data {
+			switch {
+			case i%8 == 0:
+				buf.WriteString("\n")
+			default:
+				buf.WriteString(" ")
+			}
+			fmt.Fprintf(buf, "0x%02x", c)
+			if i < len(p.data)-1 {
+				buf.WriteByte(',')
+			}
+		}
+		buf.WriteString(" };\n")
+	}
+}
+
+// decodeHTTPBodies decodes the chunked bodies of the HTTP/1.x messages in
+// data and, with decompress, their gzip, deflate or br Content-Encoding.
+// The headers that no longer apply are dropped or corrected. Anything that
+// does not parse as HTTP is copied unchanged.
+func decodeHTTPBodies(data []byte, decompress bool) []byte {
+	var out bytes.Buffer
+	for len(data) > 0 {
+		end := bytes.Index(data, []byte("\r\n\r\n"))
+		if end < 0 || !isHTTPStartLine(data) {
+			out.Write(data)
+			break
+		}
+		head, body := data[:end+4], data[end+4:]
+		chunked, length, encoding := false, -1, ""
+		var kept [][]byte
+		for _, line := range bytes.Split(head[:end], []byte("\r\n")) {
+			name, value, _ := strings.Cut(string(line), ":")
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "transfer-encoding":
+				if strings.EqualFold(strings.TrimSpace(value), "chunked") {
+					chunked = true
+					continue
+				}
+			case "content-length":
+				if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && n >= 0 {
+					length = n
+				}
+			case "content-encoding":
+				encoding = strings.TrimSpace(value)
+			}
+			kept = append(kept, line)
+		}
+
+		var msgBody []byte
+		switch {
+		case chunked:
+			decoded, rest, ok := decodeChunked(body)
+			if !ok {
+				out.Write(data)
+				return out.Bytes()
+			}
+			msgBody, data = decoded, rest
+		case length >= 0:
+			n := min(length, len(body))
+			msgBody, data = body[:n], body[n:]
+		default:
+			// No framing: the body runs to the end of the turn
+			msgBody, data = body, nil
+		}
+
+		decoded := false
+		if decompress && encoding != "" {
+			if plain, ok := decodeContent(encoding, msgBody); ok {
+				msgBody, decoded = plain, true
+			}
+		}
+		if !chunked && !decoded {
+			out.Write(head)
+			out.Write(msgBody)
+			continue
+		}
+		for _, line := range kept {
+			name, _, _ := strings.Cut(string(line), ":")
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "content-encoding":
+				if decoded {
+					continue
+				}
+			case "content-length":
+				if decoded {
+					fmt.Fprintf(&out, "Content-Length: %d\r\n", len(msgBody))
+					continue
+				}
+			}
+			out.Write(line)
+			out.WriteString("\r\n")
+		}
+		out.WriteString("\r\n")
+		out.Write(msgBody)
+	}
+	return out.Bytes()
+}
+
+// isHTTPStartLine reports whether data begins with a request or status
+// line.
+func isHTTPStartLine(data []byte) bool {
+	line, _, _ := bytes.Cut(data, []byte("\r\n"))
+	return bytes.HasPrefix(line, []byte("HTTP/1.")) || bytes.HasSuffix(line, []byte(" HTTP/1.1")) || bytes.HasSuffix(line, []byte(" HTTP/1.0"))
+}
+
+// decodeChunked decodes a chunked body and returns what follows it. A
+// body cut short by the capture is returned as far as it goes; ok is false
+// only if a chunk header is malformed.
+func decodeChunked(body []byte) (decoded, rest []byte, ok bool) {
+	for {
+		line, after, found := bytes.Cut(body, []byte("\r\n"))
+		if !found {
+			return decoded, nil, true
+		}
+		sizeField, _, _ := bytes.Cut(line, []byte(";"))
+		size, err := strconv.ParseUint(strings.TrimSpace(string(sizeField)), 16, 31)
+		if err != nil {
+			return nil, nil, false
+		}
+		if size == 0 {
+			// Skip the trailer section up to its empty line
+			for {
+				line, after, found = bytes.Cut(after, []byte("\r\n"))
+				if !found || len(line) == 0 {
+					return decoded, after, true
+				}
+			}
+		}
+		if int(size) > len(after) {
+			return append(decoded, after...), nil, true
+		}
+		decoded = append(decoded, after[:size]...)
+		body = bytes.TrimPrefix(after[size:], []byte("\r\n"))
+	}
+}
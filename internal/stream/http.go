@@ -3,10 +3,17 @@ package stream
 import (
 	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/andybalholm/brotli"
+
+	"sniffox/internal/parser"
 )
 
 // HTTPTransaction holds extracted HTTP request/response data.
@@ -19,6 +26,11 @@ type HTTPTransaction struct {
 	RespHeaders map[string]string `json:"respHeaders,omitempty"`
 	ContentType string            `json:"contentType,omitempty"`
 	BodyPreview string            `json:"bodyPreview,omitempty"`
+	DNS         []string          `json:"dns,omitempty"` // DNS-over-HTTPS query and response
+
+	// ContentEncoding is the response's Content-Encoding. A gzip, deflate
+	// or br body is decompressed before BodyPreview is taken from it.
+	ContentEncoding string `json:"contentEncoding,omitempty"`
 }
 
 // tryParseHTTP attempts to parse HTTP request from clientData and response from serverData.
@@ -50,6 +62,11 @@ func tryParseHTTP(clientData, serverData []byte) (*HTTPTransaction, error) {
 			tx.ReqHeaders[k] = strings.Join(v, ", ")
 		}
 		tx.ContentType = req.Header.Get("Content-Type")
+		if s := dohSummary(tx.ContentType, req.Body); s != "" {
+			tx.DNS = append(tx.DNS, s)
+		} else if dns := parser.DecodeDNSMessage(parser.DoHQueryMessage(req.URL.RequestURI())); dns != nil && req.Method == "GET" {
+			tx.DNS = append(tx.DNS, parser.DNSSummary(dns))
+		}
 		req.Body.Close()
 	}
 
@@ -67,11 +84,21 @@ func tryParseHTTP(clientData, serverData []byte) (*HTTPTransaction, error) {
 				tx.ContentType = resp.Header.Get("Content-Type")
 			}
 
-			// Read a small body preview
-			bodyBuf := make([]byte, 512)
-			n, _ := io.ReadAtLeast(resp.Body, bodyBuf, 1)
-			if n > 0 {
-				preview := string(bodyBuf[:n])
+			if s := dohSummary(resp.Header.Get("Content-Type"), resp.Body); s != "" {
+				tx.DNS = append(tx.DNS, s)
+				resp.Body.Close()
+				return tx, nil
+			}
+
+			// Read a small body preview, decompressed if need be. A body
+			// cut short by the capture is previewed as far as it goes.
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, maxStreamBuffer))
+			tx.ContentEncoding = resp.Header.Get("Content-Encoding")
+			if plain, ok := decodeContent(tx.ContentEncoding, body); ok {
+				body = plain
+			}
+			if n := min(len(body), 512); n > 0 {
+				preview := string(body[:n])
 				// Only keep printable ASCII
 				var sb strings.Builder
 				for _, c := range preview {
@@ -93,3 +120,57 @@ func tryParseHTTP(clientData, serverData []byte) (*HTTPTransaction, error) {
 
 	return tx, nil
 }
+
+// dohSummary decodes the DNS message in an application/dns-message body and
+// returns its summary, or "" for other bodies.
+func dohSummary(contentType string, body io.Reader) string {
+	if ct, _, _ := strings.Cut(contentType, ";"); !strings.EqualFold(strings.TrimSpace(ct), parser.DNSMessageType) {
+		return ""
+	}
+	msg, _ := io.ReadAll(io.LimitReader(body, 65535))
+	if dns := parser.DecodeDNSMessage(msg); dns != nil {
+		return parser.DNSSummary(dns)
+	}
+	return ""
+}
+
+// decodeContent undoes a Content-Encoding of gzip, deflate or br, or a list
+// of them applied in order. ok is false if the encoding is identity or
+// unknown, or nothing could be decoded. Truncated data decodes as far as
+// it goes, up to maxStreamBuffer bytes.
+func decodeContent(encoding string, body []byte) (decoded []byte, ok bool) {
+	return decodeContentLimit(encoding, body, maxStreamBuffer)
+}
+
+// decodeContentLimit is decodeContent decoding up to limit bytes.
+func decodeContentLimit(encoding string, body []byte, limit int) (decoded []byte, ok bool) {
+	codings := strings.Split(encoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		var r io.Reader
+		switch strings.ToLower(strings.TrimSpace(codings[i])) {
+		case "gzip", "x-gzip":
+			zr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, false
+			}
+			r = zr
+		case "deflate":
+			// Properly zlib-wrapped, but some servers send raw deflate
+			if zr, err := zlib.NewReader(bytes.NewReader(body)); err == nil {
+				r = zr
+			} else {
+				r = flate.NewReader(bytes.NewReader(body))
+			}
+		case "br":
+			r = brotli.NewReader(bytes.NewReader(body))
+		default:
+			return nil, false
+		}
+		out, _ := io.ReadAll(io.LimitReader(r, int64(limit)))
+		if len(out) == 0 {
+			return nil, false
+		}
+		body = out
+	}
+	return body, true
+}
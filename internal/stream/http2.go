@@ -0,0 +1,184 @@
+package stream
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"sniffox/internal/parser"
+)
+
+// maxHTTP2Conns caps the connections an HTTP2Tracker follows at once.
+const maxHTTP2Conns = 4096
+
+// HTTP2Exchange is one HTTP/2 stream of a connection: a request and its
+// response, or a gRPC call.
+type HTTP2Exchange struct {
+	StreamID    uint32 `json:"streamId"`
+	Method      string `json:"method,omitempty"`
+	Authority   string `json:"authority,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Status      string `json:"status,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	GRPCMethod  string `json:"grpcMethod,omitempty"`
+	GRPCStatus  string `json:"grpcStatus,omitempty"`
+	GRPCMessage string `json:"grpcMessage,omitempty"`
+	ReqBytes    int    `json:"reqBytes"`
+	RespBytes   int    `json:"respBytes"`
+	Reset       string `json:"reset,omitempty"` // RST_STREAM error code
+
+	// DNS summarizes the DNS-over-HTTPS query and response, if any.
+	DNS []string `json:"dns,omitempty"`
+}
+
+// tryParseHTTP2 decodes the exchanges of a cleartext HTTP/2 connection from
+// its reassembled client and server data. Returns nil if the client data
+// does not start with the HTTP/2 preface.
+func tryParseHTTP2(clientData, serverData []byte) []HTTP2Exchange {
+	if !parser.IsHTTP2Preface(clientData) {
+		return nil
+	}
+	conn := parser.NewHTTP2Conn()
+	byID := make(map[uint32]*HTTP2Exchange)
+	var order []uint32
+	get := func(id uint32) *HTTP2Exchange {
+		if ex, ok := byID[id]; ok {
+			return ex
+		}
+		ex := &HTTP2Exchange{StreamID: id}
+		byID[id] = ex
+		order = append(order, id)
+		return ex
+	}
+
+	// HPACK state is per direction, so each side can be decoded in one go
+	for dir, data := range [][]byte{clientData, serverData} {
+		fromServer := dir == 1
+		for _, f := range conn.Feed(fromServer, data) {
+			if f.StreamID == 0 {
+				continue
+			}
+			ex := get(f.StreamID)
+			switch f.Type {
+			case "HEADERS", "CONTINUATION":
+				if v := f.Header(":method"); v != "" {
+					ex.Method = v
+				}
+				if v := f.Header(":authority"); v != "" {
+					ex.Authority = v
+				}
+				if v := f.Header(":path"); v != "" {
+					ex.Path = v
+				}
+				if v := f.Header(":status"); v != "" {
+					ex.Status = v
+				}
+				if v := f.Header("content-type"); v != "" && ex.ContentType == "" {
+					ex.ContentType = v
+				}
+				if v := f.Header("grpc-status"); v != "" {
+					ex.GRPCStatus = parser.GRPCStatusString(v)
+				}
+				if v := f.Header("grpc-message"); v != "" {
+					ex.GRPCMessage = v
+				}
+			case "DATA":
+				if fromServer {
+					ex.RespBytes += f.Length
+				} else {
+					ex.ReqBytes += f.Length
+				}
+			case "RST_STREAM":
+				ex.Reset = f.ErrorCode
+			}
+			if f.GRPCMethod != "" {
+				ex.GRPCMethod = f.GRPCMethod
+			}
+			if dns := parser.DecodeDNSMessage(f.DNSMessage); dns != nil {
+				ex.DNS = append(ex.DNS, parser.DNSSummary(dns))
+			}
+		}
+	}
+
+	out := make([]HTTP2Exchange, 0, len(order))
+	for _, id := range order {
+		out = append(out, *byID[id])
+	}
+	return out
+}
+
+// HTTP2Tracker decodes HTTP/2 frames packet by packet for cleartext
+// connections that open with the client preface. Segments must arrive in
+// capture order; retransmitted bytes are skipped, and a direction with a
+// gap stops being decoded since its frame boundaries are lost. It is not
+// safe for concurrent use.
+type HTTP2Tracker struct {
+	conns map[string]*http2Conn
+}
+
+type http2Conn struct {
+	dec    *parser.HTTP2Conn
+	client string // "ip:port" of the side that sent the preface
+	next   [2]uint32
+	seen   [2]bool
+	fins   int
+}
+
+// NewHTTP2Tracker creates an empty tracker.
+func NewHTTP2Tracker() *HTTP2Tracker {
+	return &HTTP2Tracker{conns: make(map[string]*http2Conn)}
+}
+
+// Process returns the HTTP/2 frames completed by pkt's TCP payload and
+// whether its connection carries gRPC.
+func (t *HTTP2Tracker) Process(pkt gopacket.Packet) ([]parser.HTTP2Frame, bool) {
+	tcp, ok := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !ok || pkt.NetworkLayer() == nil {
+		return nil, false
+	}
+	nf := pkt.NetworkLayer().NetworkFlow()
+	src := fmt.Sprintf("%s:%d", nf.Src(), tcp.SrcPort)
+	dst := fmt.Sprintf("%s:%d", nf.Dst(), tcp.DstPort)
+	key := src + "|" + dst
+	if dst < src {
+		key = dst + "|" + src
+	}
+
+	c := t.conns[key]
+	if c == nil {
+		if !parser.IsHTTP2Preface(tcp.Payload) || len(t.conns) >= maxHTTP2Conns {
+			return nil, false
+		}
+		c = &http2Conn{dec: parser.NewHTTP2Conn(), client: src}
+		t.conns[key] = c
+	}
+
+	var frames []parser.HTTP2Frame
+	if payload := tcp.Payload; len(payload) > 0 {
+		fromServer := src != c.client
+		d := 0
+		if fromServer {
+			d = 1
+		}
+		if !c.seen[d] {
+			c.next[d], c.seen[d] = tcp.Seq, true
+		}
+		switch diff := int32(tcp.Seq - c.next[d]); {
+		case diff > 0:
+			c.dec.Lost(fromServer)
+		case -int(diff) < len(payload):
+			payload = payload[-diff:]
+			c.next[d] = tcp.Seq + uint32(len(tcp.Payload))
+			frames = c.dec.Feed(fromServer, payload)
+		}
+	}
+
+	if tcp.FIN {
+		c.fins++
+	}
+	if tcp.RST || c.fins >= 2 {
+		delete(t.conns, key)
+	}
+	return frames, c.dec.GRPC()
+}
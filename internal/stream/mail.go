@@ -0,0 +1,473 @@
+package stream
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"sniffox/internal/parser"
+)
+
+const (
+	maxMailExchanges = 1000
+	maxMailMessages  = 100
+)
+
+// MailSession is an SMTP, POP3 or IMAP conversation parsed from a
+// reassembled stream, up to the point it upgraded to TLS.
+type MailSession struct {
+	Protocol     string   `json:"protocol"` // SMTP, POP3 or IMAP
+	Greeting     string   `json:"greeting,omitempty"`
+	ClientName   string   `json:"clientName,omitempty"`   // EHLO or HELO
+	Capabilities []string `json:"capabilities,omitempty"` // EHLO keywords, CAPA or CAPABILITY
+	// AuthMechanism is the SASL mechanism of the last AUTH or
+	// AUTHENTICATE, or LOGIN, and Authenticated whether the server took it
+	AuthMechanism string         `json:"authMechanism,omitempty"`
+	Authenticated bool           `json:"authenticated,omitempty"`
+	User          string         `json:"user,omitempty"`
+	Exchanges     []MailExchange `json:"exchanges"`
+	Messages      []MailItem     `json:"messages,omitempty"`
+	STARTTLS      *TLSUpgrade    `json:"starttls,omitempty"`
+}
+
+// MailExchange is a command and the server's reply to it. The greeting
+// is an exchange without a command.
+type MailExchange struct {
+	Command    string   `json:"command,omitempty"` // "MAIL FROM:<a@example.com>", "a1 SELECT INBOX"
+	Reply      string   `json:"reply,omitempty"`   // "250 2.1.0 Ok", "a1 OK SELECT completed"
+	ReplyLines []string `json:"replyLines,omitempty"`
+	// Offsets of the command in ClientData and of the reply in ServerData
+	ClientOffset int `json:"clientOffset"`
+	ServerOffset int `json:"serverOffset"`
+}
+
+// MailItem is a message sent with DATA or BDAT, retrieved with RETR or
+// TOP, fetched with FETCH or stored with APPEND, while the connection was
+// in cleartext.
+type MailItem struct {
+	// Envelope sender and recipients, SMTP only
+	From string   `json:"from,omitempty"`
+	To   []string `json:"to,omitempty"`
+	// Headers are the message's own, with encoded words decoded
+	Headers map[string]string `json:"headers,omitempty"`
+	Size    int               `json:"size"`
+}
+
+// TLSUpgrade marks where a mail connection switched to TLS: the first
+// byte of each direction that is TLS rather than the mail protocol.
+type TLSUpgrade struct {
+	Exchange     int `json:"exchange"` // index of the STARTTLS exchange
+	ClientOffset int `json:"clientOffset"`
+	ServerOffset int `json:"serverOffset"`
+}
+
+// mailReader reads complete lines from one direction of a stream.
+type mailReader struct {
+	data []byte
+	off  int
+}
+
+// line returns the next CRLF- or LF-terminated line without its
+// terminator, and the offset it starts at. An unterminated line is not
+// returned.
+func (r *mailReader) line() (string, int, bool) {
+	i := bytes.IndexByte(r.data[r.off:], '\n')
+	if i < 0 {
+		return "", r.off, false
+	}
+	start := r.off
+	r.off += i + 1
+	return strings.TrimSuffix(string(r.data[start:start+i]), "\r"), start, true
+}
+
+// take returns the next n bytes, or as many as there are.
+func (r *mailReader) take(n int) []byte {
+	n = min(n, len(r.data)-r.off)
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+// dotBody reads the lines of a message or multi-line reply up to the "."
+// that ends it, undoing dot-stuffing.
+func (r *mailReader) dotBody() ([]byte, bool) {
+	var body bytes.Buffer
+	for {
+		line, _, ok := r.line()
+		if !ok {
+			return body.Bytes(), false
+		}
+		if line == "." {
+			return body.Bytes(), true
+		}
+		body.WriteString(strings.TrimPrefix(line, "."))
+		body.WriteString("\r\n")
+	}
+}
+
+// mailParser walks both directions of a mail stream in step, pairing
+// each command with its reply.
+type mailParser struct {
+	proto          string
+	client, server mailReader
+	s              *MailSession
+	envelope       *MailItem // the SMTP transaction MAIL FROM opened
+	chunks         []byte    // BDAT chunks so far
+}
+
+// tryParseMail parses the SMTP, POP3 or IMAP conversation of a stream
+// whose server port carries proto, or returns nil if the server did not
+// greet the client.
+func tryParseMail(proto string, clientData, serverData []byte) *MailSession {
+	if proto == "" {
+		return nil
+	}
+	p := &mailParser{
+		proto:  proto,
+		client: mailReader{data: clientData},
+		server: mailReader{data: serverData},
+		s:      &MailSession{Protocol: proto},
+	}
+	greeting, ok := p.reply()
+	if !ok {
+		return nil
+	}
+	p.s.Greeting = greeting.Text
+	p.s.Exchanges = append(p.s.Exchanges, p.exchange(nil, greeting, 0, 0))
+
+	for len(p.s.Exchanges) < maxMailExchanges {
+		line, off, ok := p.client.line()
+		if !ok {
+			break
+		}
+		cmd, ok := parser.MailCommand(proto, line)
+		if !ok {
+			break
+		}
+		var done bool
+		switch proto {
+		case "SMTP":
+			done = p.smtp(cmd, off)
+		case "POP3":
+			done = p.pop3(cmd, off)
+		case "IMAP":
+			done = p.imap(cmd, line, off)
+		}
+		if done {
+			break
+		}
+	}
+	return p.s
+}
+
+// reply reads the server's next reply line, and the lines that continue a
+// multi-line SMTP reply.
+func (p *mailParser) reply() (parser.MailMessage, bool) {
+	line, _, ok := p.server.line()
+	if !ok {
+		return parser.MailMessage{}, false
+	}
+	m, more, ok := parser.MailReply(p.proto, line)
+	for ok && more {
+		if line, _, ok = p.server.line(); !ok {
+			break
+		}
+		var next parser.MailMessage
+		next, more, ok = parser.MailReply(p.proto, line)
+		m.Lines = append(m.Lines, next.Text)
+	}
+	return m, ok
+}
+
+// exchange pairs cmd with its reply. cmd is nil for the greeting.
+func (p *mailParser) exchange(cmd *parser.MailMessage, reply parser.MailMessage, clientOff, serverOff int) MailExchange {
+	x := MailExchange{ClientOffset: clientOff, ServerOffset: serverOff}
+	if cmd != nil {
+		x.Command = strings.TrimPrefix(cmd.String(), "C: ")
+	}
+	if reply.Response {
+		x.Reply = strings.TrimPrefix(reply.String(), "S: ")
+		x.ReplyLines = reply.Lines
+	}
+	return x
+}
+
+// upgrade records that the server accepted the STARTTLS of the last
+// exchange: the TLS handshake starts right after the command and after
+// the reply.
+func (p *mailParser) upgrade() {
+	p.s.STARTTLS = &TLSUpgrade{
+		Exchange:     len(p.s.Exchanges) - 1,
+		ClientOffset: p.client.off,
+		ServerOffset: p.server.off,
+	}
+}
+
+// addMessage records a message and its headers.
+func (p *mailParser) addMessage(item MailItem, body []byte) {
+	if len(p.s.Messages) >= maxMailMessages {
+		return
+	}
+	item.Size = len(body)
+	item.Headers = mailHeaders(body)
+	p.s.Messages = append(p.s.Messages, item)
+}
+
+// mailHeaders returns the header fields of a message, the first value of
+// each, with RFC 2047 encoded words decoded.
+func mailHeaders(body []byte) map[string]string {
+	msg, err := mail.ReadMessage(bytes.NewReader(body))
+	if err != nil || len(msg.Header) == 0 {
+		return nil
+	}
+	dec := new(mime.WordDecoder)
+	out := make(map[string]string, len(msg.Header))
+	for k, v := range msg.Header {
+		s, err := dec.DecodeHeader(v[0])
+		if err != nil {
+			s = v[0]
+		}
+		out[k] = s
+	}
+	return out
+}
+
+// sasl follows the challenges of an SMTP or POP3 AUTH, each answered by a
+// client line, and returns the final reply.
+func (p *mailParser) sasl(reply parser.MailMessage) (parser.MailMessage, bool) {
+	for reply.Status == "334" || reply.Status == "+" {
+		if _, _, ok := p.client.line(); !ok {
+			return reply, false
+		}
+		var ok bool
+		if reply, ok = p.reply(); !ok {
+			return reply, false
+		}
+	}
+	return reply, true
+}
+
+// smtp follows an SMTP command, the message DATA or BDAT sends, and the
+// replies. It reports whether parsing stops there.
+func (p *mailParser) smtp(cmd parser.MailMessage, clientOff int) bool {
+	serverOff := p.server.off
+	reply, ok := p.reply()
+	if ok && cmd.Command == "AUTH" {
+		p.s.AuthMechanism = cmd.AuthMechanism()
+		reply, ok = p.sasl(reply)
+		p.s.Authenticated = reply.Status == "235"
+	}
+	if cmd.Command == "BDAT" {
+		// The chunk follows the command, before the reply
+		size, last, _ := strings.Cut(cmd.Arg, " ")
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 0 {
+			ok = false
+		} else {
+			p.chunks = append(p.chunks, p.client.take(n)...)
+		}
+		if ok && strings.EqualFold(strings.TrimSpace(last), "LAST") {
+			p.finishMessage(p.chunks)
+		}
+	}
+	p.s.Exchanges = append(p.s.Exchanges, p.exchange(&cmd, reply, clientOff, serverOff))
+	if !ok {
+		return true
+	}
+
+	switch cmd.Command {
+	case "EHLO", "HELO":
+		p.s.ClientName = cmd.Arg
+		if cmd.Command == "EHLO" && reply.Accepted() {
+			p.s.Capabilities = reply.Lines
+		}
+	case "MAIL":
+		p.envelope, p.chunks = nil, nil
+		if reply.Accepted() {
+			p.envelope = &MailItem{From: cmd.Address()}
+		}
+	case "RCPT":
+		if reply.Accepted() && p.envelope != nil {
+			p.envelope.To = append(p.envelope.To, cmd.Address())
+		}
+	case "RSET":
+		p.envelope, p.chunks = nil, nil
+	case "STARTTLS":
+		if reply.Accepted() {
+			p.upgrade()
+			return true
+		}
+	case "DATA":
+		if reply.Status != "354" {
+			break
+		}
+		bodyOff := p.client.off
+		body, ok := p.client.dotBody()
+		if !ok {
+			return true
+		}
+		p.finishMessage(body)
+		// The message is an exchange of its own, with the server's
+		// verdict on it
+		serverOff = p.server.off
+		reply, ok := p.reply()
+		x := p.exchange(nil, reply, bodyOff, serverOff)
+		x.Command = fmt.Sprintf("DATA fragment, %d bytes", len(body))
+		p.s.Exchanges = append(p.s.Exchanges, x)
+		return !ok
+	}
+	return false
+}
+
+// finishMessage records the message of the current SMTP transaction.
+func (p *mailParser) finishMessage(body []byte) {
+	item := MailItem{}
+	if p.envelope != nil {
+		item = *p.envelope
+	}
+	p.addMessage(item, body)
+	p.envelope, p.chunks = nil, nil
+}
+
+// pop3MultiLine reports whether a positive reply to cmd is followed by
+// data lines ending with ".".
+func pop3MultiLine(cmd parser.MailMessage) bool {
+	switch cmd.Command {
+	case "RETR", "TOP", "CAPA":
+		return true
+	case "LIST", "UIDL", "AUTH":
+		return cmd.Arg == ""
+	}
+	return false
+}
+
+// pop3 follows a POP3 command and its reply, with the data lines of a
+// multi-line reply. It reports whether parsing stops there.
+func (p *mailParser) pop3(cmd parser.MailMessage, clientOff int) bool {
+	serverOff := p.server.off
+	reply, ok := p.reply()
+	if ok {
+		switch cmd.Command {
+		case "USER":
+			p.s.User = cmd.Arg
+		case "PASS":
+			p.s.AuthMechanism, p.s.Authenticated = "USER", reply.Accepted()
+		case "APOP":
+			p.s.User, _, _ = strings.Cut(cmd.Arg, " ")
+			p.s.AuthMechanism, p.s.Authenticated = "APOP", reply.Accepted()
+		case "AUTH":
+			if cmd.Arg != "" {
+				p.s.AuthMechanism = cmd.AuthMechanism()
+				reply, ok = p.sasl(reply)
+				p.s.Authenticated = reply.Accepted()
+			}
+		}
+	}
+	x := p.exchange(&cmd, reply, clientOff, serverOff)
+	if ok && reply.Status == "+OK" && pop3MultiLine(cmd) {
+		var body []byte
+		body, ok = p.server.dotBody()
+		lines := strings.Split(strings.TrimSuffix(string(body), "\r\n"), "\r\n")
+		switch {
+		case !ok:
+		case cmd.Command == "RETR" || cmd.Command == "TOP":
+			p.addMessage(MailItem{}, body)
+		case cmd.Command == "CAPA":
+			p.s.Capabilities = lines
+		default:
+			x.ReplyLines = lines[:min(len(lines), 100)]
+		}
+	}
+	p.s.Exchanges = append(p.s.Exchanges, x)
+	if ok && cmd.StartsTLS() && reply.Accepted() {
+		p.upgrade()
+		return true
+	}
+	return !ok
+}
+
+// imap follows an IMAP command, the literals it carries, and the server's
+// responses up to the tagged one that completes it. It reports whether
+// parsing stops there.
+func (p *mailParser) imap(cmd parser.MailMessage, line string, clientOff int) bool {
+	// A literal "{n}" ends the line; n bytes follow, then the rest of
+	// the command. APPEND sends the message this way.
+	var literal []byte
+	for {
+		n, ok := parser.IMAPLiteral(line)
+		if !ok {
+			break
+		}
+		if literal = p.client.take(n); len(literal) < n {
+			return true
+		}
+		if line, _, ok = p.client.line(); !ok {
+			return true
+		}
+	}
+
+	x := p.exchange(&cmd, parser.MailMessage{}, clientOff, p.server.off)
+	if cmd.Command == "DONE" {
+		// The tagged reply went to the IDLE it ends
+		p.s.Exchanges = append(p.s.Exchanges, x)
+		return false
+	}
+	for {
+		line, _, ok := p.server.line()
+		if !ok {
+			p.s.Exchanges = append(p.s.Exchanges, x)
+			return true
+		}
+		m, _, ok := parser.MailReply("IMAP", line)
+		if n, lit := parser.IMAPLiteral(line); lit {
+			data := p.server.take(n)
+			if strings.Contains(strings.ToUpper(line), " FETCH ") && len(data) == n {
+				p.addMessage(MailItem{}, data)
+			}
+		}
+		switch {
+		case !ok:
+			// The rest of a response after a literal
+		case m.Tag == "+":
+			// A client line answers an AUTHENTICATE challenge, and DONE
+			// ends an IDLE
+			if cmd.Command == "AUTHENTICATE" || cmd.Command == "IDLE" {
+				if _, _, ok := p.client.line(); !ok {
+					p.s.Exchanges = append(p.s.Exchanges, x)
+					return true
+				}
+			}
+		case m.Tag == "*":
+			if f := strings.Fields(m.Text); len(f) > 1 && strings.EqualFold(f[0], "CAPABILITY") {
+				p.s.Capabilities = f[1:]
+			}
+			if len(x.ReplyLines) < 100 {
+				x.ReplyLines = append(x.ReplyLines, strings.TrimPrefix(m.String(), "S: "))
+			}
+		default:
+			x.Reply = strings.TrimPrefix(m.String(), "S: ")
+			p.s.Exchanges = append(p.s.Exchanges, x)
+			switch cmd.Command {
+			case "LOGIN":
+				user, _, _ := strings.Cut(cmd.Arg, " ")
+				p.s.User = strings.Trim(user, `"`)
+				fallthrough
+			case "AUTHENTICATE":
+				p.s.AuthMechanism, p.s.Authenticated = cmd.AuthMechanism(), m.Status == "OK"
+			case "APPEND":
+				if m.Status == "OK" && literal != nil {
+					p.addMessage(MailItem{}, literal)
+				}
+			case "STARTTLS":
+				if m.Status == "OK" {
+					p.upgrade()
+					return true
+				}
+			}
+			return false
+		}
+	}
+}
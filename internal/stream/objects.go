@@ -0,0 +1,235 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"sniffox/internal/tlsdecrypt"
+)
+
+// DefaultObjectLimit is the largest HTTP response body extracted as an
+// object unless SetObjectLimit says otherwise.
+const DefaultObjectLimit = 8 << 20
+
+// ErrObjectNotFound is returned when a stream has no object at the
+// requested index.
+var ErrObjectNotFound = errors.New("object not found")
+
+// HTTPObject is a response body carried by an HTTP/1.x stream, dechunked
+// and decompressed, as in Wireshark's Export Objects → HTTP.
+type HTTPObject struct {
+	Index       int    `json:"index"`
+	Method      string `json:"method,omitempty"`
+	Host        string `json:"host,omitempty"`
+	URL         string `json:"url,omitempty"`
+	StatusCode  int    `json:"statusCode"`
+	ContentType string `json:"contentType"` // declared, or sniffed from the body
+	Filename    string `json:"filename"`
+	Size        int    `json:"size"`
+	SHA256      string `json:"sha256"`
+	// Encoding is the Content-Encoding the body was decompressed from
+	Encoding string `json:"encoding,omitempty"`
+	// Truncated is set when the capture or the object limit cut the body
+	// short; Size and SHA256 are of the part kept
+	Truncated bool `json:"truncated,omitempty"`
+
+	Data []byte `json:"-"`
+}
+
+// SetObjectLimit sets the largest response body extracted as an object.
+// HTTP streams keep that much server data, and FTP data connections that
+// much in each direction, rather than the usual 256KB, so bodies and files
+// up to the limit are kept whole. Call it before Start.
+func (m *Manager) SetObjectLimit(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objectLimit = n
+}
+
+// dataCap is how much data sd keeps from the client or the server. The
+// caller holds m.mu.
+func (m *Manager) dataCap(sd *StreamData, fromClient bool) int {
+	if m.objectLimit > maxStreamBuffer && (sd.ftpData || sd.HTTPInfo != nil && !fromClient) {
+		return m.objectLimit
+	}
+	return maxStreamBuffer
+}
+
+// Objects returns the HTTP objects of a stream, from its plaintext if it
+// is a TLS stream the key log has secrets for.
+func (m *Manager) Objects(id uint64) ([]HTTPObject, error) {
+	m.mu.Lock()
+	sd, ok := m.streams[id]
+	if !ok {
+		m.mu.Unlock()
+		return nil, ErrStreamNotFound
+	}
+	client, server := bytes.Clone(sd.ClientData), bytes.Clone(sd.ServerData)
+	isTLS := sd.Protocol == "TCP" && len(client) > 0 && client[0] == 0x16
+	keys, limit := m.keys, m.objectLimit
+	m.mu.Unlock()
+
+	if limit <= 0 {
+		limit = DefaultObjectLimit
+	}
+	if isTLS && keys != nil && keys.Len() > 0 {
+		sess, err := tlsdecrypt.Decrypt(client, server, keys)
+		if err != nil {
+			// No plaintext to find HTTP in
+			return nil, nil
+		}
+		client, server = sess.ClientData, sess.ServerData
+	}
+	return extractHTTPObjects(client, server, limit), nil
+}
+
+// Object returns the object of a stream at index.
+func (m *Manager) Object(id uint64, index int) (*HTTPObject, error) {
+	objs, err := m.Objects(id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range objs {
+		if objs[i].Index == index {
+			return &objs[i], nil
+		}
+	}
+	return nil, ErrObjectNotFound
+}
+
+// extractHTTPObjects pairs the requests in clientData with the responses
+// in serverData and returns the non-empty response bodies, each at most
+// limit bytes.
+func extractHTTPObjects(clientData, serverData []byte, limit int) []HTTPObject {
+	if !isHTTPStartLine(serverData) {
+		return nil
+	}
+	reqs := bufio.NewReader(bytes.NewReader(clientData))
+	resps := bufio.NewReader(bytes.NewReader(serverData))
+	var out []HTTPObject
+	for index := 0; ; index++ {
+		req, err := http.ReadRequest(reqs)
+		if err != nil {
+			req = nil
+		} else {
+			io.Copy(io.Discard, req.Body)
+		}
+		resp, err := readFinalResponse(resps, req)
+		if err != nil {
+			return out
+		}
+		obj, complete := readObject(resp, limit)
+		if obj != nil {
+			obj.Index = index
+			if req != nil {
+				obj.Method, obj.Host, obj.URL = req.Method, req.Host, req.URL.String()
+			}
+			obj.Filename = objectFilename(resp, req, obj.ContentType, index)
+			out = append(out, *obj)
+		}
+		if !complete {
+			return out
+		}
+	}
+}
+
+// readFinalResponse reads the response to req, skipping interim 1xx
+// responses such as 100 Continue.
+func readFinalResponse(r *bufio.Reader, req *http.Request) (*http.Response, error) {
+	for {
+		resp, err := http.ReadResponse(r, req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 200 || resp.StatusCode == http.StatusSwitchingProtocols {
+			return resp, nil
+		}
+	}
+}
+
+// readObject reads the body of resp, dechunked and decompressed. It returns
+// nil for an empty body, and complete false when the body was cut short or
+// the connection changed protocol, so nothing after it can be parsed.
+func readObject(resp *http.Response, limit int) (obj *HTTPObject, complete bool) {
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		return nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	complete = err == nil && len(body) <= limit
+	truncated := !complete
+	if len(body) > limit {
+		body = body[:limit]
+		// Skip the rest so a following response can still be read
+		_, err = io.Copy(io.Discard, resp.Body)
+		complete = err == nil
+	}
+	if len(body) == 0 {
+		return nil, complete
+	}
+
+	obj = &HTTPObject{StatusCode: resp.StatusCode, Truncated: truncated}
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" {
+		if plain, ok := decodeContentLimit(enc, body, limit); ok {
+			body, obj.Encoding = plain, enc
+		}
+	}
+	obj.Data = body
+	obj.Size = len(body)
+	sum := sha256.Sum256(body)
+	obj.SHA256 = hex.EncodeToString(sum[:])
+
+	obj.ContentType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if obj.ContentType == "" || obj.ContentType == "application/octet-stream" {
+		obj.ContentType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	}
+	return obj, complete
+}
+
+// preferredExt overrides the first of mime.ExtensionsByType, which is
+// sorted, for types whose usual extension is not first.
+var preferredExt = map[string]string{
+	"image/jpeg": ".jpg",
+	"text/html":  ".html",
+	"text/plain": ".txt",
+}
+
+// objectFilename names an object after its Content-Disposition, or else
+// the last element of its request path, adding an extension for its
+// content type if that has none.
+func objectFilename(resp *http.Response, req *http.Request, contentType string, index int) string {
+	var name string
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		name = params["filename"]
+	}
+	if name == "" && req != nil {
+		name = path.Base(req.URL.Path)
+	}
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == ".." || name == "/" {
+		name = "object" + strconv.Itoa(index)
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if path.Ext(name) == "" {
+		if ext, ok := preferredExt[contentType]; ok {
+			name += ext
+		} else if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	return name
+}
@@ -0,0 +1,86 @@
+package stream
+
+import (
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// udpIdleTimeout starts a new conversation when a 5-tuple is reused
+	// after this much silence.
+	udpIdleTimeout = 2 * time.Minute
+	// maxDatagrams caps the per-conversation datagram index.
+	maxDatagrams = 4096
+)
+
+// Datagram locates one UDP payload within a conversation's client or
+// server data, so message boundaries survive concatenation.
+type Datagram struct {
+	FromClient bool      `json:"fromClient"`
+	Offset     int       `json:"offset"` // into ClientData or ServerData
+	Length     int       `json:"length"`
+	Time       time.Time `json:"time"`
+}
+
+// AddUDP appends the payload of a UDP packet to its conversation, keyed on
+// the 5-tuple in either direction, and returns the conversation's stream
+// ID. The first sender is the client. Conversations share the ID space
+// and the per-direction cap of TCP streams.
+func (m *Manager) AddUDP(pkt gopacket.Packet) uint64 {
+	udpLayer := pkt.Layer(layers.LayerTypeUDP)
+	if udpLayer == nil || pkt.NetworkLayer() == nil {
+		return 0
+	}
+	udp := udpLayer.(*layers.UDP)
+	netFlow := pkt.NetworkLayer().NetworkFlow()
+	key := makeFlowKey(netFlow, udp.TransportFlow())
+	reverseKey := makeFlowKey(netFlow.Reverse(), udp.TransportFlow().Reverse())
+	ts := pkt.Metadata().Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, fromClient := m.lookupMap[key], true
+	if id == 0 {
+		id, fromClient = m.lookupMap[reverseKey], false
+	}
+	sd := m.streams[id]
+	if sd == nil || ts.Sub(sd.LastSeen) > udpIdleTimeout {
+		m.nextID++
+		id, fromClient = m.nextID, true
+		sd = &StreamData{
+			ID:        id,
+			Protocol:  "UDP",
+			SrcAddr:   netFlow.Src().String(),
+			DstAddr:   netFlow.Dst().String(),
+			SrcPort:   uint16(udp.SrcPort),
+			DstPort:   uint16(udp.DstPort),
+			StartTime: ts,
+		}
+		m.streams[id] = sd
+		delete(m.lookupMap, reverseKey)
+		m.lookupMap[key] = id
+	}
+	sd.LastSeen = ts
+
+	payload := udp.Payload
+	if len(payload) == 0 || sd.discarded {
+		return id
+	}
+	buf := &sd.ClientData
+	if !fromClient {
+		buf = &sd.ServerData
+	}
+	offset := len(*buf)
+	*buf = appendCapped(*buf, payload, maxStreamBuffer)
+	sd.addTurn(fromClient, len(*buf)-offset)
+	if n := len(*buf) - offset; n > 0 && len(sd.Datagrams) < maxDatagrams {
+		sd.Datagrams = append(sd.Datagrams, Datagram{FromClient: fromClient, Offset: offset, Length: n, Time: ts})
+	}
+	return id
+}
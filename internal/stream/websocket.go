@@ -0,0 +1,279 @@
+package stream
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxWebSocketFrames caps the frames listed per stream.
+	maxWebSocketFrames = 1000
+	// wsPreviewLen is how much of a frame's payload is previewed.
+	wsPreviewLen = 256
+)
+
+// wsOpcodeNames names the WebSocket opcodes (RFC 6455 section 5.2).
+var wsOpcodeNames = map[byte]string{
+	0x0: "continuation",
+	0x1: "text",
+	0x2: "binary",
+	0x8: "close",
+	0x9: "ping",
+	0xa: "pong",
+}
+
+// WebSocketFrame is one frame of a WebSocket connection set up by an
+// HTTP/1.1 Upgrade.
+type WebSocketFrame struct {
+	FromClient bool   `json:"fromClient"`
+	Fin        bool   `json:"fin"`
+	Opcode     int    `json:"opcode"`
+	Type       string `json:"type"` // text, binary, close, ping, pong or continuation
+	// Message is the type of the message a continuation frame is part of
+	Message string `json:"message,omitempty"`
+	Masked  bool   `json:"masked"`
+	Length  int64  `json:"length"` // of the payload as sent
+	// Compressed is set for permessage-deflate frames (RSV1). The preview
+	// is of the inflated payload when it could be inflated.
+	Compressed bool   `json:"compressed,omitempty"`
+	CloseCode  int    `json:"closeCode,omitempty"`
+	Preview    string `json:"preview,omitempty"` // text, or hex for binary payloads
+	// Truncated is set when the capture cut the frame short
+	Truncated bool `json:"truncated,omitempty"`
+
+	offset int // where the frame starts in its direction's data
+}
+
+// tryParseWebSocket decodes the frames that follow a WebSocket upgrade
+// handshake in both directions, in arrival order as turns records it.
+// Returns nil if the stream is not an upgraded WebSocket connection.
+func tryParseWebSocket(clientData, serverData []byte, turns []turn) []WebSocketFrame {
+	clientStart, ok := wsHandshake(clientData, false)
+	if !ok {
+		return nil
+	}
+	serverStart, ok := wsHandshake(serverData, true)
+	if !ok {
+		return nil
+	}
+	client := parseWebSocketFrames(clientData, clientStart, true)
+	server := parseWebSocketFrames(serverData, serverStart, false)
+	frames := mergeWebSocketFrames(client, server, turns)
+	if len(frames) > maxWebSocketFrames {
+		frames = frames[:maxWebSocketFrames]
+	}
+	return frames
+}
+
+// wsHandshake checks for the Upgrade request or its 101 response at the
+// start of data and returns where the frames after it begin.
+func wsHandshake(data []byte, response bool) (int, bool) {
+	end := bytes.Index(data, []byte("\r\n\r\n"))
+	if end < 0 {
+		return 0, false
+	}
+	head := string(data[:end+2])
+	line, headers, _ := strings.Cut(head, "\r\n")
+	if response {
+		if !strings.HasPrefix(line, "HTTP/1.1 101") {
+			return 0, false
+		}
+	} else if !strings.HasPrefix(line, "GET ") {
+		return 0, false
+	}
+	upgrade := false
+	for _, h := range strings.Split(headers, "\r\n") {
+		name, value, _ := strings.Cut(h, ":")
+		if http.CanonicalHeaderKey(strings.TrimSpace(name)) == "Upgrade" &&
+			strings.EqualFold(strings.TrimSpace(value), "websocket") {
+			upgrade = true
+		}
+	}
+	return end + 4, upgrade
+}
+
+// parseWebSocketFrames decodes the frames of one direction from start on.
+func parseWebSocketFrames(data []byte, start int, fromClient bool) []WebSocketFrame {
+	var out []WebSocketFrame
+	var message string // type of the fragmented message in progress
+	var inflater *wsInflater
+	pos := start
+	for pos+2 <= len(data) && len(out) < maxWebSocketFrames {
+		b0, b1 := data[pos], data[pos+1]
+		f := WebSocketFrame{
+			FromClient: fromClient,
+			Fin:        b0&0x80 != 0,
+			Compressed: b0&0x40 != 0,
+			Opcode:     int(b0 & 0x0f),
+			Masked:     b1&0x80 != 0,
+			offset:     pos,
+		}
+		name, ok := wsOpcodeNames[b0&0x0f]
+		if !ok {
+			// Reserved opcode: not WebSocket, or we lost the framing
+			break
+		}
+		f.Type = name
+
+		hdr := 2
+		n := uint64(b1 & 0x7f)
+		switch n {
+		case 126:
+			if pos+4 > len(data) {
+				return out
+			}
+			n = uint64(binary.BigEndian.Uint16(data[pos+2:]))
+			hdr = 4
+		case 127:
+			if pos+10 > len(data) {
+				return out
+			}
+			n = binary.BigEndian.Uint64(data[pos+2:])
+			hdr = 10
+		}
+		var key []byte
+		if f.Masked {
+			if pos+hdr+4 > len(data) {
+				return out
+			}
+			key = data[pos+hdr : pos+hdr+4]
+			hdr += 4
+		}
+		payloadStart := pos + hdr
+		payloadEnd := len(data)
+		f.Length = int64(min(n, math.MaxInt64))
+		if n <= uint64(len(data)-payloadStart) {
+			payloadEnd = payloadStart + int(n)
+		} else {
+			f.Truncated = true
+		}
+		payload := bytes.Clone(data[payloadStart:payloadEnd])
+		if key != nil {
+			for i := range payload {
+				payload[i] ^= key[i%4]
+			}
+		}
+
+		switch {
+		case f.Opcode == 0:
+			f.Message = message
+		case f.Opcode < 8:
+			message = f.Type
+		}
+		switch {
+		case f.Compressed && !f.Fin:
+			// Fragments of a compressed message are not inflated, and the
+			// window is lost with them
+			if inflater != nil {
+				inflater.broken = true
+			}
+		case f.Compressed && !f.Truncated:
+			if inflater == nil {
+				inflater = &wsInflater{}
+			}
+			if plain, ok := inflater.inflate(payload); ok {
+				payload = plain
+			}
+		}
+		kind := f.Type
+		if f.Opcode == 0 {
+			kind = f.Message
+		}
+		if f.Fin && f.Opcode < 8 {
+			message = ""
+		}
+		if f.Opcode == 8 && len(payload) >= 2 {
+			f.CloseCode = int(binary.BigEndian.Uint16(payload))
+			payload = payload[2:]
+			kind = "text"
+		}
+		f.Preview = wsPreview(payload, kind)
+		out = append(out, f)
+		if f.Truncated {
+			break
+		}
+		pos = payloadEnd
+	}
+	return out
+}
+
+// wsInflater inflates permessage-deflate payloads, keeping the window
+// across messages for context takeover.
+type wsInflater struct {
+	history []byte // the last 32KB inflated
+	broken  bool
+}
+
+// inflate inflates one message's payload. ok is false if it could not be
+// inflated, such as when an earlier message was missed.
+func (w *wsInflater) inflate(payload []byte) ([]byte, bool) {
+	if w.broken {
+		return nil, false
+	}
+	// RFC 7692 strips the final empty stored block; put it back
+	src := io.MultiReader(bytes.NewReader(payload), bytes.NewReader([]byte{0, 0, 0xff, 0xff}))
+	r := flate.NewReaderDict(src, w.history)
+	out, err := io.ReadAll(io.LimitReader(r, maxStreamBuffer))
+	if err != nil && err != io.ErrUnexpectedEOF {
+		w.broken = true
+		return nil, false
+	}
+	w.history = append(w.history, out...)
+	if len(w.history) > 32<<10 {
+		w.history = w.history[len(w.history)-32<<10:]
+	}
+	return out, true
+}
+
+// wsPreview shows the start of a payload as text, or as hex for binary
+// payloads and text that is not UTF-8.
+func wsPreview(payload []byte, kind string) string {
+	if len(payload) == 0 {
+		return ""
+	}
+	p := payload[:min(len(payload), wsPreviewLen)]
+	if kind == "text" || (kind != "binary" && utf8.Valid(p)) {
+		var sb strings.Builder
+		for _, c := range string(p) {
+			if c == utf8.RuneError || c < 32 && c != '\n' && c != '\r' && c != '\t' {
+				sb.WriteByte('.')
+			} else {
+				sb.WriteRune(c)
+			}
+		}
+		return sb.String()
+	}
+	return hex.EncodeToString(p[:min(len(p), 64)])
+}
+
+// mergeWebSocketFrames interleaves the two directions' frames in the
+// order their data arrived, or lists the client's first when turns are
+// not known.
+func mergeWebSocketFrames(client, server []WebSocketFrame, turns []turn) []WebSocketFrame {
+	out := make([]WebSocketFrame, 0, len(client)+len(server))
+	if len(turns) == 0 {
+		return append(append(out, client...), server...)
+	}
+	var clientEnd, serverEnd int
+	for _, t := range turns {
+		if t.fromClient {
+			clientEnd += t.n
+			for len(client) > 0 && client[0].offset < clientEnd {
+				out, client = append(out, client[0]), client[1:]
+			}
+		} else {
+			serverEnd += t.n
+			for len(server) > 0 && server[0].offset < serverEnd {
+				out, server = append(out, server[0]), server[1:]
+			}
+		}
+	}
+	return append(append(out, client...), server...)
+}
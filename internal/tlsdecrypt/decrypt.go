@@ -0,0 +1,538 @@
+package tlsdecrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"hash"
+
+	"sniffox/internal/parser"
+)
+
+// TLS record content types
+const (
+	recordChangeCipherSpec = 20
+	recordHandshake        = 22
+	recordApplicationData  = 23
+)
+
+var (
+	// ErrNotTLS is returned for a stream that does not start with a TLS
+	// handshake.
+	ErrNotTLS = errors.New("not a TLS connection")
+	// ErrNoKeys is returned when the key log has no secrets for the
+	// connection.
+	ErrNoKeys = errors.New("no key log secrets for this connection")
+	// ErrUnsupported is returned for protocol versions and cipher suites
+	// that cannot be decrypted.
+	ErrUnsupported = errors.New("TLS version or cipher suite not supported")
+	// ErrBadKeys is returned when the secrets do not decrypt the records.
+	ErrBadKeys = errors.New("the key log secrets do not decrypt this connection")
+)
+
+// Session is a TLS connection decrypted from its two reassembled
+// directions.
+type Session struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipherSuite"`
+	ALPN        string `json:"alpn,omitempty"`
+	ClientData  []byte `json:"-"` // application data, client to server
+	ServerData  []byte `json:"-"` // application data, server to client
+}
+
+// suite describes how a cipher suite protects records.
+type suite struct {
+	hash   func() hash.Hash // TLS 1.2 PRF and TLS 1.3 HKDF hash
+	keyLen int
+	mac    func() hash.Hash // CBC suites only
+}
+
+var (
+	aes128GCM    = suite{hash: sha256.New, keyLen: 16}
+	aes256GCM    = suite{hash: sha512.New384, keyLen: 32}
+	aes128CBC    = suite{hash: sha256.New, keyLen: 16, mac: sha1.New}
+	aes256CBC    = suite{hash: sha256.New, keyLen: 32, mac: sha1.New}
+	aes128CBC256 = suite{hash: sha256.New, keyLen: 16, mac: sha256.New}
+	aes256CBC256 = suite{hash: sha256.New, keyLen: 32, mac: sha256.New}
+	aes256CBC384 = suite{hash: sha512.New384, keyLen: 32, mac: sha512.New384}
+)
+
+// suites12 are the TLS 1.2 cipher suites that can be decrypted.
+var suites12 = map[uint16]suite{
+	0x009c: aes128GCM, 0x009e: aes128GCM, 0xc02b: aes128GCM, 0xc02f: aes128GCM,
+	0x009d: aes256GCM, 0x009f: aes256GCM, 0xc02c: aes256GCM, 0xc030: aes256GCM,
+	0x002f: aes128CBC, 0xc009: aes128CBC, 0xc013: aes128CBC,
+	0x0035: aes256CBC, 0xc00a: aes256CBC, 0xc014: aes256CBC,
+	0x003c: aes128CBC256, 0xc023: aes128CBC256, 0xc027: aes128CBC256,
+	0x003d: aes256CBC256,
+	0xc024: aes256CBC384, 0xc028: aes256CBC384,
+}
+
+// suites13 are the TLS 1.3 cipher suites that can be decrypted.
+var suites13 = map[uint16]suite{
+	0x1301: aes128GCM,
+	0x1302: aes256GCM,
+}
+
+// record is one TLS record.
+type record struct {
+	header []byte // type, version, length
+	body   []byte
+}
+
+func (r record) typ() byte { return r.header[0] }
+
+// records splits a direction of a connection into its complete records.
+func records(data []byte) []record {
+	var out []record
+	for len(data) >= 5 {
+		n := int(binary.BigEndian.Uint16(data[3:5]))
+		if len(data) < 5+n {
+			break
+		}
+		out = append(out, record{header: data[:5], body: data[5 : 5+n]})
+		data = data[5+n:]
+	}
+	return out
+}
+
+// handshake concatenates the bodies of the plaintext handshake records at
+// the start of recs.
+func handshake(recs []record) []byte {
+	var hs []byte
+	for _, r := range recs {
+		if r.typ() != recordHandshake {
+			break
+		}
+		hs = append(hs, r.body...)
+	}
+	return hs
+}
+
+// message returns the body of the first handshake message in hs, which
+// must be of type typ.
+func message(hs []byte, typ byte) []byte {
+	if len(hs) < 4 || hs[0] != typ {
+		return nil
+	}
+	n := int(hs[1])<<16 | int(hs[2])<<8 | int(hs[3])
+	if len(hs) < 4+n {
+		return nil
+	}
+	return hs[4 : 4+n]
+}
+
+// serverHello holds what decryption needs from a ServerHello.
+type serverHello struct {
+	random  []byte
+	version uint16
+	suite   uint16
+	alpn    string
+	etm     bool // encrypt_then_mac negotiated
+}
+
+func parseServerHello(b []byte) (*serverHello, bool) {
+	if len(b) < 35 {
+		return nil, false
+	}
+	sh := &serverHello{version: binary.BigEndian.Uint16(b), random: b[2:34]}
+	pos := 35 + int(b[34])
+	if len(b) < pos+3 {
+		return nil, false
+	}
+	sh.suite = binary.BigEndian.Uint16(b[pos:])
+	extensions(b[pos+3:], func(typ uint16, ext []byte) {
+		switch typ {
+		case 0x002b: // supported_versions
+			if len(ext) >= 2 {
+				sh.version = binary.BigEndian.Uint16(ext)
+			}
+		case 0x0010:
+			sh.alpn = alpn(ext)
+		case 0x0016:
+			sh.etm = true
+		}
+	})
+	return sh, true
+}
+
+// extensions calls fn with each extension in b, a hello's extensions
+// block.
+func extensions(b []byte, fn func(typ uint16, ext []byte)) {
+	if len(b) < 2 {
+		return
+	}
+	end := min(len(b), 2+int(binary.BigEndian.Uint16(b)))
+	for pos := 2; pos+4 <= end; {
+		typ := binary.BigEndian.Uint16(b[pos:])
+		n := int(binary.BigEndian.Uint16(b[pos+2:]))
+		pos += 4
+		if pos+n > end {
+			return
+		}
+		fn(typ, b[pos:pos+n])
+		pos += n
+	}
+}
+
+// alpn returns the protocol a server selected in its ALPN extension.
+func alpn(ext []byte) string {
+	if len(ext) < 3 || len(ext) < 3+int(ext[2]) {
+		return ""
+	}
+	return string(ext[3 : 3+int(ext[2])])
+}
+
+// helloRetryRandom is the ServerHello random of a TLS 1.3
+// HelloRetryRequest.
+var helloRetryRandom = []byte{
+	0xcf, 0x21, 0xad, 0x74, 0xe5, 0x9a, 0x61, 0x11, 0xbe, 0x1d, 0x8c, 0x02, 0x1e, 0x65, 0xb8, 0x91,
+	0xc2, 0xa2, 0x11, 0x16, 0x7a, 0xbb, 0x8c, 0x5e, 0x07, 0x9e, 0x09, 0xe2, 0xc8, 0xcc, 0x96, 0x33,
+}
+
+// Decrypt decrypts the application data of a TLS connection from its
+// reassembled client and server data with secrets from keys. TLS 1.2 with
+// AES-GCM or AES-CBC and TLS 1.3 with AES-GCM are supported; TLS 1.3 key
+// updates, 0-RTT data and HelloRetryRequests are not.
+func Decrypt(client, server []byte, keys *KeyLog) (*Session, error) {
+	crecs, srecs := records(client), records(server)
+	ch := message(handshake(crecs), 1)
+	if len(ch) < 34 {
+		return nil, ErrNotTLS
+	}
+	sh, ok := parseServerHello(message(handshake(srecs), 2))
+	if !ok {
+		return nil, ErrNotTLS
+	}
+	if string(sh.random) == string(helloRetryRandom) {
+		return nil, ErrUnsupported
+	}
+	secrets, ok := keys.Lookup(ch[2:34])
+	if !ok {
+		return nil, ErrNoKeys
+	}
+
+	s := &Session{
+		Version:     parser.TLSVersionString(sh.version),
+		CipherSuite: parser.CipherSuiteName(sh.suite),
+		ALPN:        sh.alpn,
+	}
+	var err error
+	switch sh.version {
+	case 0x0303:
+		err = s.decrypt12(crecs, srecs, ch[2:34], sh, secrets)
+	case 0x0304:
+		err = s.decrypt13(crecs, srecs, sh, secrets)
+	default:
+		err = ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// decrypt12 decrypts a TLS 1.2 connection. Each direction is encrypted from
+// its ChangeCipherSpec on, starting with its Finished message.
+func (s *Session) decrypt12(crecs, srecs []record, clientRandom []byte, sh *serverHello, secrets Secrets) error {
+	cs, ok := suites12[sh.suite]
+	if !ok {
+		return ErrUnsupported
+	}
+	if len(secrets.Master) != 48 {
+		return ErrNoKeys
+	}
+	macLen, ivLen := 0, 4
+	if cs.mac != nil {
+		macLen, ivLen = cs.mac().Size(), 16
+	}
+	seed := append(append([]byte{}, sh.random...), clientRandom...)
+	kb := prf12(cs.hash, secrets.Master, "key expansion", seed, 2*(macLen+cs.keyLen+ivLen))
+	cmac, kb := kb[:macLen], kb[macLen:]
+	smac, kb := kb[:macLen], kb[macLen:]
+	ckey, kb := kb[:cs.keyLen], kb[cs.keyLen:]
+	skey, kb := kb[:cs.keyLen], kb[cs.keyLen:]
+	civ, siv := kb[:ivLen], kb[ivLen:]
+
+	var err error
+	if s.ClientData, err = open12(crecs, cs, ckey, civ, cmac, sh.etm); err != nil {
+		return err
+	}
+	s.ServerData, err = open12(srecs, cs, skey, siv, smac, sh.etm)
+	return err
+}
+
+// open12 decrypts the TLS 1.2 records of one direction and returns their
+// application data.
+func open12(recs []record, cs suite, key, iv, macKey []byte, etm bool) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	var gcm cipher.AEAD
+	if cs.mac == nil {
+		if gcm, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	var out []byte
+	var seq uint64
+	encrypted := false
+	for _, r := range recs {
+		if !encrypted {
+			encrypted = r.typ() == recordChangeCipherSpec
+			continue
+		}
+		var pt []byte
+		var ok bool
+		if gcm != nil {
+			pt, ok = openGCM12(gcm, iv, seq, r)
+		} else {
+			pt, ok = openCBC12(block, cs.mac, macKey, etm, seq, r)
+		}
+		if !ok {
+			if seq == 0 {
+				return nil, ErrBadKeys
+			}
+			break
+		}
+		if r.typ() == recordApplicationData {
+			out = append(out, pt...)
+		}
+		seq++
+	}
+	return out, nil
+}
+
+// additionalData returns a TLS 1.2 record's MAC or AEAD header for a
+// plaintext of n bytes.
+func additionalData(seq uint64, r record, n int) []byte {
+	ad := binary.BigEndian.AppendUint64(make([]byte, 0, 13), seq)
+	ad = append(ad, r.header[:3]...)
+	return binary.BigEndian.AppendUint16(ad, uint16(n))
+}
+
+func openGCM12(gcm cipher.AEAD, iv []byte, seq uint64, r record) ([]byte, bool) {
+	if len(r.body) < 8+gcm.Overhead() {
+		return nil, false
+	}
+	nonce := append(append([]byte{}, iv...), r.body[:8]...)
+	ct := r.body[8:]
+	pt, err := gcm.Open(nil, nonce, ct, additionalData(seq, r, len(ct)-gcm.Overhead()))
+	return pt, err == nil
+}
+
+func openCBC12(block cipher.Block, newMAC func() hash.Hash, macKey []byte, etm bool, seq uint64, r record) ([]byte, bool) {
+	mac := hmac.New(newMAC, macKey)
+	body := r.body
+	if etm {
+		// The MAC covers the IV and ciphertext
+		if len(body) < mac.Size() {
+			return nil, false
+		}
+		body, tag := body[:len(body)-mac.Size()], body[len(body)-mac.Size():]
+		mac.Write(additionalData(seq, r, len(body)))
+		mac.Write(body)
+		if !hmac.Equal(mac.Sum(nil), tag) {
+			return nil, false
+		}
+		pt, ok := decryptCBC(block, body)
+		return pt, ok
+	}
+	pt, ok := decryptCBC(block, body)
+	if !ok || len(pt) < mac.Size() {
+		return nil, false
+	}
+	pt, tag := pt[:len(pt)-mac.Size()], pt[len(pt)-mac.Size():]
+	mac.Write(additionalData(seq, r, len(pt)))
+	mac.Write(pt)
+	return pt, hmac.Equal(mac.Sum(nil), tag)
+}
+
+// decryptCBC decrypts a record body made of an explicit IV and the
+// ciphertext, and strips its padding.
+func decryptCBC(block cipher.Block, body []byte) ([]byte, bool) {
+	bs := block.BlockSize()
+	if len(body) < 2*bs || len(body)%bs != 0 {
+		return nil, false
+	}
+	pt := make([]byte, len(body)-bs)
+	cipher.NewCBCDecrypter(block, body[:bs]).CryptBlocks(pt, body[bs:])
+	pad := int(pt[len(pt)-1])
+	if pad+1 > len(pt) {
+		return nil, false
+	}
+	for _, b := range pt[len(pt)-1-pad:] {
+		if int(b) != pad {
+			return nil, false
+		}
+	}
+	return pt[:len(pt)-1-pad], true
+}
+
+// prf12 is the TLS 1.2 pseudorandom function.
+func prf12(newHash func() hash.Hash, secret []byte, label string, seed []byte, n int) []byte {
+	seed = append([]byte(label), seed...)
+	out := make([]byte, 0, n)
+	mac := hmac.New(newHash, secret)
+	mac.Write(seed)
+	a := mac.Sum(nil)
+	for len(out) < n {
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(seed)
+		out = mac.Sum(out)
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+	}
+	return out[:n]
+}
+
+// decrypt13 decrypts a TLS 1.3 connection. Each direction sends its
+// handshake messages under the handshake secret, then application data
+// under the traffic secret.
+func (s *Session) decrypt13(crecs, srecs []record, sh *serverHello, secrets Secrets) error {
+	cs, ok := suites13[sh.suite]
+	if !ok {
+		return ErrUnsupported
+	}
+	if secrets.ClientTraffic == nil || secrets.ServerTraffic == nil {
+		return ErrNoKeys
+	}
+	var err error
+	if s.ClientData, _, err = open13(crecs, cs, secrets.ClientHandshake, secrets.ClientTraffic); err != nil {
+		return err
+	}
+	var hs []byte
+	if s.ServerData, hs, err = open13(srecs, cs, secrets.ServerHandshake, secrets.ServerTraffic); err != nil {
+		return err
+	}
+	// In TLS 1.3 the server picks ALPN in its EncryptedExtensions
+	if ee := message(hs, 8); ee != nil {
+		extensions(ee, func(typ uint16, ext []byte) {
+			if typ == 0x0010 {
+				s.ALPN = alpn(ext)
+			}
+		})
+	}
+	return nil
+}
+
+// aead13 is one TLS 1.3 traffic key.
+type aead13 struct {
+	aead cipher.AEAD
+	iv   []byte
+	seq  uint64
+}
+
+func newAEAD13(cs suite, secret []byte) (*aead13, error) {
+	block, err := aes.NewCipher(expandLabel(cs.hash, secret, "key", cs.keyLen))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &aead13{aead: gcm, iv: expandLabel(cs.hash, secret, "iv", 12)}, nil
+}
+
+// open decrypts r and returns its content and inner content type; the
+// sequence number advances only when it succeeds.
+func (k *aead13) open(r record) ([]byte, byte, bool) {
+	nonce := append([]byte{}, k.iv...)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(k.seq >> (8 * i))
+	}
+	pt, err := k.aead.Open(nil, nonce, r.body, r.header)
+	if err != nil {
+		return nil, 0, false
+	}
+	k.seq++
+	// Content, then its real type, then zero padding
+	i := len(pt) - 1
+	for i >= 0 && pt[i] == 0 {
+		i--
+	}
+	if i < 0 {
+		return nil, 0, false
+	}
+	return pt[:i], pt[i], true
+}
+
+// open13 decrypts the TLS 1.3 records of one direction and returns their
+// application data and handshake messages. Without the handshake secret
+// the handshake records are skipped.
+func open13(recs []record, cs suite, hsSecret, appSecret []byte) (data, handshake []byte, err error) {
+	var hs *aead13
+	if hsSecret != nil {
+		if hs, err = newAEAD13(cs, hsSecret); err != nil {
+			return nil, nil, err
+		}
+	}
+	app, err := newAEAD13(cs, appSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	appStarted := false
+	for _, r := range recs {
+		if r.typ() != recordApplicationData {
+			continue // plaintext hellos and compatibility ChangeCipherSpecs
+		}
+		if hs != nil && !appStarted {
+			if pt, typ, ok := hs.open(r); ok {
+				if typ == recordHandshake {
+					handshake = append(handshake, pt...)
+				}
+				continue
+			}
+		}
+		pt, typ, ok := app.open(r)
+		if !ok {
+			if !appStarted {
+				continue // a handshake record
+			}
+			break
+		}
+		appStarted = true
+		if typ == recordApplicationData {
+			data = append(data, pt...)
+		}
+	}
+	if !appStarted && (hs == nil || hs.seq == 0) {
+		for _, r := range recs {
+			if r.typ() == recordApplicationData {
+				return nil, nil, ErrBadKeys
+			}
+		}
+	}
+	return data, handshake, nil
+}
+
+// expandLabel is TLS 1.3's HKDF-Expand-Label with an empty context.
+func expandLabel(newHash func() hash.Hash, secret []byte, label string, n int) []byte {
+	label = "tls13 " + label
+	info := binary.BigEndian.AppendUint16(nil, uint16(n))
+	info = append(info, byte(len(label)))
+	info = append(info, label...)
+	info = append(info, 0)
+
+	// HKDF-Expand
+	mac := hmac.New(newHash, secret)
+	var out, t []byte
+	for i := byte(1); len(out) < n; i++ {
+		mac.Reset()
+		mac.Write(t)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		t = mac.Sum(nil)
+		out = append(out, t...)
+	}
+	return out[:n]
+}
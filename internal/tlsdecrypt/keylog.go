@@ -0,0 +1,191 @@
+// Package tlsdecrypt decrypts TLS 1.2 and 1.3 connections with the secrets
+// browsers and TLS libraries write to an SSLKEYLOGFILE, so HTTPS streams
+// can be followed as plaintext.
+package tlsdecrypt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSessions caps the sessions kept; the oldest are dropped first.
+const maxSessions = 100000
+
+// Secrets are the key log entries of one TLS session.
+type Secrets struct {
+	Master          []byte // CLIENT_RANDOM, TLS 1.2
+	ClientHandshake []byte // CLIENT_HANDSHAKE_TRAFFIC_SECRET, TLS 1.3
+	ServerHandshake []byte // SERVER_HANDSHAKE_TRAFFIC_SECRET
+	ClientTraffic   []byte // CLIENT_TRAFFIC_SECRET_0
+	ServerTraffic   []byte // SERVER_TRAFFIC_SECRET_0
+}
+
+// KeyLog holds the secrets read from key log files, keyed by the
+// ClientHello random of their session. It is safe for concurrent use.
+type KeyLog struct {
+	mu       sync.Mutex
+	sessions map[[32]byte]*Secrets
+	order    [][32]byte // insertion order, for dropping the oldest
+}
+
+// NewKeyLog creates an empty key log.
+func NewKeyLog() *KeyLog {
+	return &KeyLog{sessions: make(map[[32]byte]*Secrets)}
+}
+
+// Load reads key log lines ("LABEL <client random> <secret>", both hex)
+// from r and returns how many secrets it added. Comments, unknown labels
+// and malformed lines are skipped, as NSS does.
+func (k *KeyLog) Load(r io.Reader) (int, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 4096), 64<<10)
+	added := 0
+	for sc.Scan() {
+		if k.addLine(sc.Text()) {
+			added++
+		}
+	}
+	return added, sc.Err()
+}
+
+func (k *KeyLog) addLine(line string) bool {
+	f := strings.Fields(line)
+	if len(f) != 3 || strings.HasPrefix(f[0], "#") {
+		return false
+	}
+	random, err := hex.DecodeString(f[1])
+	if err != nil || len(random) != 32 {
+		return false
+	}
+	secret, err := hex.DecodeString(f[2])
+	if err != nil || len(secret) == 0 {
+		return false
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key := [32]byte(random)
+	s, ok := k.sessions[key]
+	if !ok {
+		s = &Secrets{}
+	}
+	switch f[0] {
+	case "CLIENT_RANDOM":
+		s.Master = secret
+	case "CLIENT_HANDSHAKE_TRAFFIC_SECRET":
+		s.ClientHandshake = secret
+	case "SERVER_HANDSHAKE_TRAFFIC_SECRET":
+		s.ServerHandshake = secret
+	case "CLIENT_TRAFFIC_SECRET_0":
+		s.ClientTraffic = secret
+	case "SERVER_TRAFFIC_SECRET_0":
+		s.ServerTraffic = secret
+	default:
+		return false
+	}
+	if !ok {
+		if len(k.order) >= maxSessions {
+			drop := k.order[:maxSessions/10]
+			for _, r := range drop {
+				delete(k.sessions, r)
+			}
+			k.order = append(k.order[:0], k.order[len(drop):]...)
+		}
+		k.sessions[key] = s
+		k.order = append(k.order, key)
+	}
+	return true
+}
+
+// Lookup returns the secrets of the session whose ClientHello carried
+// random.
+func (k *KeyLog) Lookup(random []byte) (Secrets, bool) {
+	if len(random) != 32 {
+		return Secrets{}, false
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	s, ok := k.sessions[[32]byte(random)]
+	if !ok {
+		return Secrets{}, false
+	}
+	return *s, true
+}
+
+// Len returns the number of sessions with secrets.
+func (k *KeyLog) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.sessions)
+}
+
+// Reset forgets every secret.
+func (k *KeyLog) Reset() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.sessions = make(map[[32]byte]*Secrets)
+	k.order = nil
+}
+
+// Watch loads the key log file at path, then every interval the lines
+// appended to it since, until stop is closed. The file need not exist yet;
+// a file that shrinks is read again from the start.
+func (k *KeyLog) Watch(path string, interval time.Duration, stop <-chan struct{}) {
+	var off int64
+	var failed bool
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := k.loadFrom(path, &off)
+		switch {
+		case err != nil && !os.IsNotExist(err):
+			if !failed {
+				log.Printf("TLS key log %s: %v", path, err)
+			}
+			failed = true
+		case n > 0:
+			log.Printf("TLS key log %s: loaded %d secrets", path, n)
+			failed = false
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// loadFrom loads the complete lines of path after *off and advances it.
+func (k *KeyLog) loadFrom(path string, off *int64) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if st.Size() < *off {
+		*off = 0
+	}
+	if st.Size() == *off {
+		return 0, nil
+	}
+	data := make([]byte, st.Size()-*off)
+	n, err := f.ReadAt(data, *off)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	// A line still being written is read on the next pass
+	end := bytes.LastIndexByte(data[:n], '\n') + 1
+	*off += int64(end)
+	return k.Load(bytes.NewReader(data[:end]))
+}
@@ -0,0 +1,152 @@
+package tlsstats
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/parser"
+)
+
+// ServerStats summarises the TLS handshakes observed towards one server.
+type ServerStats struct {
+	Server         string         `json:"server"` // ip:port
+	SNI            string         `json:"sni,omitempty"`
+	Handshakes     int            `json:"handshakes"`
+	Resumed        int            `json:"resumed"`
+	ResumptionRate float64        `json:"resumptionRate"` // 0..1
+	ResumeOffers   int            `json:"resumeOffers"`   // ClientHellos offering a session ID, ticket or PSK
+	EarlyData      int            `json:"earlyData"`      // ClientHellos sending 0-RTT data
+	Versions       map[string]int `json:"versions"`
+	Ciphers        map[string]int `json:"ciphers"`
+	ALPN           map[string]int `json:"alpn,omitempty"`
+}
+
+type connKey struct {
+	client string
+	server string
+}
+
+// Tracker pairs ClientHello and ServerHello messages per connection to
+// determine whether each handshake resumed a previous session.
+type Tracker struct {
+	mu         sync.Mutex
+	pending    map[connKey]*parser.TLSClientHelloInfo
+	servers    map[string]*ServerStats
+	maxPending int
+}
+
+// NewTracker creates a new TLS inventory tracker.
+func NewTracker() *Tracker {
+	return &Tracker{
+		pending:    make(map[connKey]*parser.TLSClientHelloInfo),
+		servers:    make(map[string]*ServerStats),
+		maxPending: 4096,
+	}
+}
+
+// Observe records the TLS hello carried by the packet, if any.
+func (t *Tracker) Observe(pkt gopacket.Packet) {
+	ch, sh := parser.ExtractTLSHello(pkt)
+	if ch == nil && sh == nil {
+		return
+	}
+	tuple := parser.ExtractFlowTuple(pkt)
+	if !tuple.Valid {
+		return
+	}
+	src := fmt.Sprintf("%s:%d", tuple.SrcIP, tuple.SrcPort)
+	dst := fmt.Sprintf("%s:%d", tuple.DstIP, tuple.DstPort)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ch != nil {
+		if len(t.pending) >= t.maxPending {
+			t.pending = make(map[connKey]*parser.TLSClientHelloInfo)
+		}
+		t.pending[connKey{client: src, server: dst}] = ch
+
+		s := t.server(dst)
+		if ch.SNI != "" {
+			s.SNI = ch.SNI
+		}
+		if ch.SessionID != "" || ch.TicketLen > 0 || ch.OffersPSK {
+			s.ResumeOffers++
+		}
+		if ch.EarlyData {
+			s.EarlyData++
+		}
+		return
+	}
+
+	key := connKey{client: dst, server: src}
+	hello := t.pending[key]
+	delete(t.pending, key)
+
+	s := t.server(src)
+	s.Handshakes++
+	if sh.Resumes(hello) {
+		s.Resumed++
+	}
+	s.ResumptionRate = float64(s.Resumed) / float64(s.Handshakes)
+	s.Versions[parser.TLSVersionString(sh.NegotiatedVersion())]++
+	s.Ciphers[parser.CipherSuiteName(sh.CipherSuite)]++
+	if sh.ALPN != "" {
+		s.ALPN[sh.ALPN]++
+	}
+}
+
+func (t *Tracker) server(addr string) *ServerStats {
+	s, ok := t.servers[addr]
+	if !ok {
+		s = &ServerStats{
+			Server:   addr,
+			Versions: make(map[string]int),
+			Ciphers:  make(map[string]int),
+			ALPN:     make(map[string]int),
+		}
+		t.servers[addr] = s
+	}
+	return s
+}
+
+// Servers returns a snapshot of per-server statistics, busiest first.
+func (t *Tracker) Servers() []ServerStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make([]ServerStats, 0, len(t.servers))
+	for _, s := range t.servers {
+		cp := *s
+		cp.Versions = copyCounts(s.Versions)
+		cp.Ciphers = copyCounts(s.Ciphers)
+		cp.ALPN = copyCounts(s.ALPN)
+		result = append(result, cp)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Handshakes != result[j].Handshakes {
+			return result[i].Handshakes > result[j].Handshakes
+		}
+		return result[i].Server < result[j].Server
+	})
+	return result
+}
+
+// Reset clears all tracked handshakes.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = make(map[connKey]*parser.TLSClientHelloInfo)
+	t.servers = make(map[string]*ServerStats)
+}
+
+func copyCounts(m map[string]int) map[string]int {
+	cp := make(map[string]int, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
@@ -0,0 +1,345 @@
+// Package trafficstats computes Wireshark-style capture statistics: the
+// protocol hierarchy, and endpoint and conversation tables at the
+// Ethernet, IP, TCP and UDP levels.
+package trafficstats
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Table kinds
+const (
+	Ethernet = "eth"
+	IP       = "ip" // IPv4 and IPv6
+	TCP      = "tcp"
+	UDP      = "udp"
+)
+
+// Kinds lists the table kinds.
+var Kinds = []string{Ethernet, IP, TCP, UDP}
+
+// maxEntries caps the endpoints and the conversations kept per kind; new
+// ones are not tracked once a table is full.
+const maxEntries = 50000
+
+// Node is one protocol in the hierarchy: the packets that carry it and
+// their bytes, and the protocols found inside it.
+type Node struct {
+	Protocol string  `json:"protocol"`
+	Packets  int     `json:"packets"`
+	Bytes    int64   `json:"bytes"`
+	Children []*Node `json:"children,omitempty"`
+}
+
+// Endpoint is the traffic sent and received by one address, or address
+// and port.
+type Endpoint struct {
+	Address   string `json:"address"`
+	Port      uint16 `json:"port,omitempty"`
+	Packets   int    `json:"packets"`
+	Bytes     int64  `json:"bytes"`
+	TxPackets int    `json:"txPackets"`
+	TxBytes   int64  `json:"txBytes"`
+	RxPackets int    `json:"rxPackets"`
+	RxBytes   int64  `json:"rxBytes"`
+}
+
+// Conversation is the traffic between two endpoints; A is the one that
+// sent the first packet.
+type Conversation struct {
+	AddressA    string    `json:"addressA"`
+	PortA       uint16    `json:"portA,omitempty"`
+	AddressB    string    `json:"addressB"`
+	PortB       uint16    `json:"portB,omitempty"`
+	Packets     int       `json:"packets"`
+	Bytes       int64     `json:"bytes"`
+	PacketsAToB int       `json:"packetsAToB"`
+	BytesAToB   int64     `json:"bytesAToB"`
+	PacketsBToA int       `json:"packetsBToA"`
+	BytesBToA   int64     `json:"bytesBToA"`
+	Start       time.Time `json:"start"`
+	DurationMs  int64     `json:"durationMs"`
+}
+
+// Table is a page of an endpoint or conversation table.
+type Table[T any] struct {
+	Kind      string `json:"kind"`
+	Total     int    `json:"total"`     // entries in the table
+	Truncated bool   `json:"truncated"` // the table is full; new entries are not tracked
+	Entries   []T    `json:"entries"`
+}
+
+type endpointKey struct {
+	addr string
+	port uint16
+}
+
+type convKey struct{ a, b endpointKey } // a < b
+
+type conversation struct {
+	Conversation
+	last time.Time
+}
+
+// Tracker accumulates the statistics of a capture. It is safe for
+// concurrent use.
+type Tracker struct {
+	mu        sync.Mutex
+	root      *Node
+	endpoints map[string]map[endpointKey]*Endpoint
+	convs     map[string]map[convKey]*conversation
+}
+
+// NewTracker creates an empty tracker.
+func NewTracker() *Tracker {
+	t := &Tracker{}
+	t.reset()
+	return t
+}
+
+func (t *Tracker) reset() {
+	t.root = &Node{Protocol: "Frame"}
+	t.endpoints = make(map[string]map[endpointKey]*Endpoint)
+	t.convs = make(map[string]map[convKey]*conversation)
+	for _, k := range Kinds {
+		t.endpoints[k] = make(map[endpointKey]*Endpoint)
+		t.convs[k] = make(map[convKey]*conversation)
+	}
+}
+
+// Reset clears all statistics.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reset()
+}
+
+// Observe counts a packet standing for packets packets of length bytes.
+// protocol is the name the parser gave it, which places protocols found
+// by port or heuristics, such as HTTP, under their transport.
+func (t *Tracker) Observe(pkt gopacket.Packet, protocol string, packets, length int) {
+	path := hierarchyPath(pkt, protocol)
+	ts := pkt.Metadata().Timestamp
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := t.root
+	n.Packets += packets
+	n.Bytes += int64(length)
+	for _, p := range path {
+		n = n.child(p)
+		n.Packets += packets
+		n.Bytes += int64(length)
+	}
+
+	if eth, ok := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok {
+		t.count(Ethernet, endpointKey{addr: eth.SrcMAC.String()}, endpointKey{addr: eth.DstMAC.String()}, packets, length, ts)
+	}
+	var src, dst string
+	switch ip := pkt.NetworkLayer().(type) {
+	case *layers.IPv4:
+		src, dst = ip.SrcIP.String(), ip.DstIP.String()
+	case *layers.IPv6:
+		src, dst = ip.SrcIP.String(), ip.DstIP.String()
+	default:
+		return
+	}
+	t.count(IP, endpointKey{addr: src}, endpointKey{addr: dst}, packets, length, ts)
+	switch tl := pkt.TransportLayer().(type) {
+	case *layers.TCP:
+		t.count(TCP, endpointKey{src, uint16(tl.SrcPort)}, endpointKey{dst, uint16(tl.DstPort)}, packets, length, ts)
+	case *layers.UDP:
+		t.count(UDP, endpointKey{src, uint16(tl.SrcPort)}, endpointKey{dst, uint16(tl.DstPort)}, packets, length, ts)
+	}
+}
+
+// hierarchyPath returns the protocols of pkt from the link layer up.
+func hierarchyPath(pkt gopacket.Packet, protocol string) []string {
+	var path []string
+	for _, l := range pkt.Layers() {
+		switch l.LayerType() {
+		case gopacket.LayerTypePayload, gopacket.LayerTypeDecodeFailure, gopacket.LayerTypeFragment:
+			continue
+		}
+		path = append(path, l.LayerType().String())
+	}
+	if protocol == "" || protocol == "Unknown" {
+		return path
+	}
+	for _, p := range path {
+		if p == protocol {
+			return path
+		}
+	}
+	return append(path, protocol)
+}
+
+func (n *Node) child(protocol string) *Node {
+	for _, c := range n.Children {
+		if c.Protocol == protocol {
+			return c
+		}
+	}
+	c := &Node{Protocol: protocol}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// count adds a packet from src to dst to the endpoint and conversation
+// tables of kind; the caller holds t.mu.
+func (t *Tracker) count(kind string, src, dst endpointKey, packets, length int, ts time.Time) {
+	eps := t.endpoints[kind]
+	if e := endpoint(eps, src); e != nil {
+		e.Packets += packets
+		e.Bytes += int64(length)
+		e.TxPackets += packets
+		e.TxBytes += int64(length)
+	}
+	if e := endpoint(eps, dst); e != nil {
+		e.Packets += packets
+		e.Bytes += int64(length)
+		e.RxPackets += packets
+		e.RxBytes += int64(length)
+	}
+
+	key := convKey{src, dst}
+	if less(dst, src) {
+		key = convKey{dst, src}
+	}
+	convs := t.convs[kind]
+	c, ok := convs[key]
+	if !ok {
+		if len(convs) >= maxEntries {
+			return
+		}
+		c = &conversation{Conversation: Conversation{
+			AddressA: src.addr, PortA: src.port,
+			AddressB: dst.addr, PortB: dst.port,
+			Start: ts,
+		}}
+		convs[key] = c
+	}
+	c.Packets += packets
+	c.Bytes += int64(length)
+	if src.addr == c.AddressA && src.port == c.PortA {
+		c.PacketsAToB += packets
+		c.BytesAToB += int64(length)
+	} else {
+		c.PacketsBToA += packets
+		c.BytesBToA += int64(length)
+	}
+	if ts.Before(c.Start) {
+		c.Start = ts
+	}
+	if ts.After(c.last) {
+		c.last = ts
+	}
+}
+
+func endpoint(eps map[endpointKey]*Endpoint, k endpointKey) *Endpoint {
+	e, ok := eps[k]
+	if !ok {
+		if len(eps) >= maxEntries {
+			return nil
+		}
+		e = &Endpoint{Address: k.addr, Port: k.port}
+		eps[k] = e
+	}
+	return e
+}
+
+func less(a, b endpointKey) bool {
+	if a.addr != b.addr {
+		return a.addr < b.addr
+	}
+	return a.port < b.port
+}
+
+// Hierarchy returns a copy of the protocol hierarchy, children ordered by
+// bytes, largest first.
+func (t *Tracker) Hierarchy() *Node {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.root.copy()
+}
+
+func (n *Node) copy() *Node {
+	c := &Node{Protocol: n.Protocol, Packets: n.Packets, Bytes: n.Bytes}
+	for _, ch := range n.Children {
+		c.Children = append(c.Children, ch.copy())
+	}
+	sort.Slice(c.Children, func(i, j int) bool { return c.Children[i].Bytes > c.Children[j].Bytes })
+	return c
+}
+
+// Endpoints returns the endpoints of kind ordered by sortBy, "packets" or
+// "bytes" (the default), at most limit of them (0: all). ok is false for
+// an unknown kind.
+func (t *Tracker) Endpoints(kind, sortBy string, limit int) (Table[Endpoint], bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	eps, ok := t.endpoints[kind]
+	if !ok {
+		return Table[Endpoint]{}, false
+	}
+	out := make([]Endpoint, 0, len(eps))
+	for _, e := range eps {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if sortBy == "packets" && out[i].Packets != out[j].Packets {
+			return out[i].Packets > out[j].Packets
+		}
+		if out[i].Bytes != out[j].Bytes {
+			return out[i].Bytes > out[j].Bytes
+		}
+		return less(endpointKey{out[i].Address, out[i].Port}, endpointKey{out[j].Address, out[j].Port})
+	})
+	tbl := Table[Endpoint]{Kind: kind, Total: len(out), Truncated: len(eps) >= maxEntries}
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	tbl.Entries = out
+	return tbl, true
+}
+
+// Conversations returns the conversations of kind ordered by sortBy,
+// "packets", "duration" or "bytes" (the default), at most limit of them
+// (0: all). ok is false for an unknown kind.
+func (t *Tracker) Conversations(kind, sortBy string, limit int) (Table[Conversation], bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	convs, ok := t.convs[kind]
+	if !ok {
+		return Table[Conversation]{}, false
+	}
+	out := make([]Conversation, 0, len(convs))
+	for _, c := range convs {
+		conv := c.Conversation
+		conv.DurationMs = c.last.Sub(c.Start).Milliseconds()
+		out = append(out, conv)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case sortBy == "packets" && a.Packets != b.Packets:
+			return a.Packets > b.Packets
+		case sortBy == "duration" && a.DurationMs != b.DurationMs:
+			return a.DurationMs > b.DurationMs
+		case a.Bytes != b.Bytes:
+			return a.Bytes > b.Bytes
+		}
+		return a.Start.Before(b.Start)
+	})
+	tbl := Table[Conversation]{Kind: kind, Total: len(out), Truncated: len(convs) >= maxEntries}
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	tbl.Entries = out
+	return tbl, true
+}
@@ -0,0 +1,195 @@
+// Package tunnel strips the VXLAN, GENEVE and ERSPAN encapsulation that
+// monitoring ports and traffic mirrors wrap packets in, and the GTP-U
+// tunnels of mobile core networks, so the inner packet is dissected,
+// flow-tracked and reassembled like one captured directly.
+package tunnel
+
+import (
+	"encoding/binary"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Tunnel kinds.
+const (
+	VXLAN  = "VXLAN"
+	GENEVE = "GENEVE"
+	ERSPAN = "ERSPAN"
+	GTPU   = "GTP-U"
+)
+
+// maxDepth caps the tunnels stripped from one packet.
+const maxDepth = 4
+
+// gtpGPDU is the GTP-U message type of a tunnelled packet.
+const gtpGPDU = 255
+
+// GRE protocol types of ERSPAN type I/II and type III.
+const (
+	greERSPAN   = 0x88be
+	greERSPANv3 = 0x22eb
+)
+
+// Tunnel describes one layer of encapsulation stripped from a packet.
+type Tunnel struct {
+	Kind string
+	// ID is the VNI of a VXLAN or GENEVE tunnel, the ERSPAN session or
+	// the GTP-U TEID
+	ID uint32
+	// Version is the ERSPAN type: 1, 2 or 3
+	Version int
+	// VLAN is the VLAN an ERSPAN mirrored frame was seen on
+	VLAN uint16
+	// OAM and Options are the GENEVE OAM flag and option bytes
+	OAM     bool
+	Options int
+
+	SrcIP, DstIP     string // outer addresses
+	SrcPort, DstPort uint16 // outer UDP ports, 0 for ERSPAN over GRE
+	HeaderLen        int    // bytes stripped, outer headers included
+}
+
+// From returns the tunnels stripped from pkt, outermost first.
+func From(pkt gopacket.Packet) []Tunnel {
+	var out []Tunnel
+	for _, a := range pkt.Metadata().AncillaryData {
+		if t, ok := a.(Tunnel); ok {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Decap returns the packet carried by a VXLAN, GENEVE, ERSPAN or GTP-U
+// packet, stripping nested tunnels too, or nil if pkt is not tunnelled.
+// The inner packet has pkt's metadata, with its lengths reduced by the
+// headers stripped and the tunnels recorded for From.
+func Decap(pkt gopacket.Packet) gopacket.Packet {
+	var inner gopacket.Packet
+	for i := 0; i < maxDepth; i++ {
+		t, data, first, ok := find(pkt)
+		if !ok || len(data) == 0 {
+			break
+		}
+		outer := pkt.Metadata()
+		t.HeaderLen = len(pkt.Data()) - len(data)
+		next := gopacket.NewPacket(data, first, gopacket.Default)
+		md := next.Metadata()
+		md.CaptureInfo = outer.CaptureInfo
+		md.Truncated = outer.Truncated
+		md.CaptureLength = len(data)
+		md.Length = max(outer.Length-t.HeaderLen, len(data))
+		md.AncillaryData = append(append([]interface{}(nil), outer.AncillaryData...), t)
+		inner, pkt = next, next
+	}
+	return inner
+}
+
+// find looks for the outermost tunnel header in pkt and returns it with
+// the bytes it carries and the layer they start with.
+func find(pkt gopacket.Packet) (Tunnel, []byte, gopacket.Decoder, bool) {
+	var t Tunnel
+	for _, l := range pkt.Layers() {
+		switch l := l.(type) {
+		case *layers.VXLAN:
+			if !l.ValidIDFlag {
+				return t, nil, nil, false
+			}
+			t = Tunnel{Kind: VXLAN, ID: l.VNI}
+			outerAddrs(&t, pkt)
+			return t, l.LayerPayload(), layers.LayerTypeEthernet, true
+		case *layers.Geneve:
+			t = Tunnel{Kind: GENEVE, ID: l.VNI, OAM: l.OAMPacket, Options: int(l.OptionsLength) * 4}
+			outerAddrs(&t, pkt)
+			var first gopacket.Decoder
+			switch l.Protocol {
+			case layers.EthernetTypeTransparentEthernetBridging:
+				first = layers.LayerTypeEthernet
+			case layers.EthernetTypeIPv4:
+				first = layers.LayerTypeIPv4
+			case layers.EthernetTypeIPv6:
+				first = layers.LayerTypeIPv6
+			default:
+				return t, nil, nil, false
+			}
+			return t, l.LayerPayload(), first, true
+		case *layers.GTPv1U:
+			// Only G-PDUs carry user traffic; the rest is signalling
+			data := l.LayerPayload()
+			if l.MessageType != gtpGPDU || len(data) == 0 {
+				return t, nil, nil, false
+			}
+			t = Tunnel{Kind: GTPU, ID: l.TEID}
+			outerAddrs(&t, pkt)
+			switch data[0] >> 4 {
+			case 4:
+				return t, data, layers.LayerTypeIPv4, true
+			case 6:
+				return t, data, layers.LayerTypeIPv6, true
+			}
+			return t, nil, nil, false
+		case *layers.GRE:
+			t = Tunnel{Kind: ERSPAN}
+			data, ok := erspan(&t, l)
+			if !ok {
+				return t, nil, nil, false
+			}
+			outerAddrs(&t, pkt)
+			return t, data, layers.LayerTypeEthernet, true
+		}
+	}
+	return t, nil, nil, false
+}
+
+// erspan reads the ERSPAN header behind a GRE header and returns the
+// mirrored frame. Type I has no header and is told from type II by the
+// GRE sequence number only type II sends.
+func erspan(t *Tunnel, gre *layers.GRE) ([]byte, bool) {
+	b := gre.LayerPayload()
+	switch {
+	case gre.Protocol == greERSPAN && !gre.SeqPresent:
+		t.Version = 1
+		return b, true
+	case gre.Protocol == greERSPAN:
+		if len(b) < 8 {
+			return nil, false
+		}
+		t.Version = 2
+		t.VLAN = binary.BigEndian.Uint16(b[0:2]) & 0x0fff
+		t.ID = uint32(binary.BigEndian.Uint16(b[2:4]) & 0x03ff)
+		return b[8:], true
+	case gre.Protocol == greERSPANv3:
+		if len(b) < 12 {
+			return nil, false
+		}
+		t.Version = 3
+		t.VLAN = binary.BigEndian.Uint16(b[0:2]) & 0x0fff
+		t.ID = uint32(binary.BigEndian.Uint16(b[2:4]) & 0x03ff)
+		n := 12
+		// The O flag announces an 8-byte platform subheader
+		if b[11]&0x01 != 0 {
+			n += 8
+		}
+		// Frame types other than 0 (Ethernet) are not decoded
+		if len(b) < n || (b[10]>>2)&0x1f != 0 {
+			return nil, false
+		}
+		return b[n:], true
+	}
+	return nil, false
+}
+
+// outerAddrs fills in the addresses and UDP ports of the headers before
+// the tunnel header.
+func outerAddrs(t *Tunnel, pkt gopacket.Packet) {
+	switch ip := pkt.NetworkLayer().(type) {
+	case *layers.IPv4:
+		t.SrcIP, t.DstIP = ip.SrcIP.String(), ip.DstIP.String()
+	case *layers.IPv6:
+		t.SrcIP, t.DstIP = ip.SrcIP.String(), ip.DstIP.String()
+	}
+	if udp, ok := pkt.TransportLayer().(*layers.UDP); ok {
+		t.SrcPort, t.DstPort = uint16(udp.SrcPort), uint16(udp.DstPort)
+	}
+}
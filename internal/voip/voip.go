@@ -0,0 +1,379 @@
+// Package voip groups SIP signalling and the RTP and RTCP media it sets
+// up into calls, with per-stream packet loss and jitter as RFC 3550
+// defines them and as the receivers report them in RTCP.
+package voip
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"sniffox/internal/parser"
+)
+
+const (
+	maxCalls   = 1024
+	maxStreams = 16 // per call
+
+	// defaultClockRate is assumed for payload types with no known codec,
+	// as most voice codecs run at 8 kHz.
+	defaultClockRate = 8000
+)
+
+// Call states
+const (
+	StateCalling   = "calling"
+	StateRinging   = "ringing"
+	StateInCall    = "in call"
+	StateEnded     = "ended"
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+	// StateMediaOnly marks RTP whose signalling was not captured, grouped
+	// by its endpoints.
+	StateMediaOnly = "media only"
+)
+
+// Call is a SIP dialog set up by an INVITE and the media streams it
+// negotiated.
+type Call struct {
+	CallID      string     `json:"callId,omitempty"`
+	From        string     `json:"from,omitempty"`
+	To          string     `json:"to,omitempty"`
+	State       string     `json:"state"`
+	Status      int        `json:"status,omitempty"` // final response to the INVITE
+	Start       time.Time  `json:"start"`
+	Answered    *time.Time `json:"answered,omitempty"`
+	End         *time.Time `json:"end,omitempty"`
+	DurationSec float64    `json:"durationSec"` // from the answer
+	SIPPackets  int        `json:"sipPackets"`
+	Media       []string   `json:"media"` // endpoints offered in SDP
+	Streams     []Stream   `json:"streams"`
+	// Totals over the streams: loss over all their packets and the worst
+	// current jitter
+	LossPct  float64   `json:"lossPct"`
+	JitterMs float64   `json:"jitterMs"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// Stream is one RTP source (SSRC) sending from Src to Dst.
+type Stream struct {
+	SSRC        string    `json:"ssrc"`
+	Src         string    `json:"src"`
+	Dst         string    `json:"dst"`
+	PayloadType int       `json:"payloadType"`
+	Codec       string    `json:"codec,omitempty"`
+	Packets     int       `json:"packets"`
+	Expected    int       `json:"expected"`
+	Lost        int       `json:"lost"`
+	LossPct     float64   `json:"lossPct"`
+	OutOfOrder  int       `json:"outOfOrder"`
+	JitterMs    float64   `json:"jitterMs"`
+	MaxJitterMs float64   `json:"maxJitterMs"`
+	FirstSeen   time.Time `json:"firstSeen"`
+	LastSeen    time.Time `json:"lastSeen"`
+
+	// From the latest RTCP report block about this SSRC: what the
+	// receiver saw, including loss after the capture point
+	Reported         bool    `json:"reported"`
+	ReportedLossPct  float64 `json:"reportedLossPct,omitempty"`
+	ReportedLost     int     `json:"reportedLost,omitempty"`
+	ReportedJitterMs float64 `json:"reportedJitterMs,omitempty"`
+}
+
+type call struct {
+	Call
+	streams map[string]*stream
+}
+
+type stream struct {
+	Stream
+	ssrc      uint32
+	clockRate int
+
+	baseSeq  uint16
+	maxSeq   uint16
+	cycles   uint32
+	prevTS   uint32
+	prevTime time.Time
+	jitter   float64 // in timestamp units
+}
+
+// endpoint is where a party receives media, per its SDP.
+type endpoint struct {
+	call   *call
+	codecs map[int]parser.RTPCodec
+}
+
+// Tracker collects calls. It is safe for concurrent use.
+type Tracker struct {
+	mu        sync.Mutex
+	calls     map[string]*call // by Call-ID, or endpoint pair for media only
+	endpoints map[string]*endpoint
+}
+
+// NewTracker creates an empty tracker.
+func NewTracker() *Tracker {
+	t := &Tracker{}
+	t.Reset()
+	return t
+}
+
+// Observe records a SIP message or an RTP/RTCP packet.
+func (t *Tracker) Observe(pkt gopacket.Packet) {
+	ts := pkt.Metadata().Timestamp
+	if m := parser.ExtractSIP(pkt); m != nil {
+		t.observeSIP(m, ts)
+	} else if m := parser.ExtractMedia(pkt); m != nil {
+		t.observeMedia(m, ts)
+	}
+}
+
+func (t *Tracker) observeSIP(m *parser.SIPMessage, ts time.Time) {
+	if m.CallID == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := t.calls[m.CallID]
+	if c == nil {
+		// Only an INVITE starts a call; REGISTER, OPTIONS and the like
+		// are not tracked
+		if m.Response || m.Method != "INVITE" || len(t.calls) >= maxCalls {
+			return
+		}
+		c = &call{
+			Call:    Call{CallID: m.CallID, From: m.From, To: m.To, State: StateCalling, Start: ts},
+			streams: make(map[string]*stream),
+		}
+		t.calls[m.CallID] = c
+	}
+	c.SIPPackets++
+	c.LastSeen = ts
+
+	if m.SDP != nil {
+		for _, md := range m.SDP.Media {
+			ip := net.ParseIP(md.Addr)
+			if md.Port == 0 || ip == nil {
+				continue // stream declined, or an FQDN address
+			}
+			rtcp := md.RTCPPort
+			if md.RTCPMux {
+				rtcp = md.Port
+			}
+			parser.ExpectMedia(md.Addr, md.Port, rtcp)
+			ep := &endpoint{call: c, codecs: md.Codecs}
+			addr := net.JoinHostPort(ip.String(), strconv.Itoa(md.Port))
+			t.endpoints[addr] = ep
+			t.endpoints[net.JoinHostPort(ip.String(), strconv.Itoa(rtcp))] = ep
+			if !slices.Contains(c.Media, addr) {
+				c.Media = append(c.Media, addr)
+			}
+		}
+	}
+
+	end := func(state string) {
+		c.State = state
+		if c.End == nil {
+			c.End = &ts
+		}
+	}
+	switch {
+	case !m.Response && m.Method == "BYE":
+		end(StateEnded)
+	case !m.Response && m.Method == "CANCEL" && c.Answered == nil:
+		end(StateCancelled)
+	case m.Response && m.Method == "INVITE":
+		code := m.StatusCode
+		switch {
+		case code > 100 && code < 200:
+			if c.State == StateCalling {
+				c.State = StateRinging
+			}
+		case code >= 200 && code < 300:
+			if c.Answered == nil {
+				c.Answered = &ts
+				c.Status = code
+			}
+			if c.End == nil {
+				c.State = StateInCall
+			}
+		case code >= 300 && c.Answered == nil:
+			// A failed re-INVITE leaves an answered call up
+			c.Status = code
+			if code == 487 {
+				end(StateCancelled)
+			} else {
+				end(StateFailed)
+			}
+		}
+	}
+}
+
+func (t *Tracker) observeMedia(m *parser.MediaPacket, ts time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ep := t.endpoints[m.Dst]
+	if ep == nil {
+		ep = t.endpoints[m.Src]
+	}
+	var c *call
+	if ep != nil {
+		c = ep.call
+	} else if m.RTP != nil {
+		// Media without signalling: one call per endpoint pair
+		key := "rtp " + m.Src + " " + m.Dst
+		if m.Dst < m.Src {
+			key = "rtp " + m.Dst + " " + m.Src
+		}
+		if c = t.calls[key]; c == nil {
+			if len(t.calls) >= maxCalls {
+				return
+			}
+			c = &call{
+				Call:    Call{State: StateMediaOnly, Start: ts},
+				streams: make(map[string]*stream),
+			}
+			t.calls[key] = c
+		}
+	} else {
+		return
+	}
+	c.LastSeen = ts
+
+	if m.RTP != nil {
+		h := m.RTP
+		key := fmt.Sprintf("%08X %s %s", h.SSRC, m.Src, m.Dst)
+		s := c.streams[key]
+		if s == nil {
+			if len(c.streams) >= maxStreams {
+				return
+			}
+			s = &stream{
+				Stream: Stream{
+					SSRC:        fmt.Sprintf("0x%08X", h.SSRC),
+					Src:         m.Src,
+					Dst:         m.Dst,
+					PayloadType: h.PayloadType,
+					FirstSeen:   ts,
+				},
+				ssrc:      h.SSRC,
+				clockRate: defaultClockRate,
+			}
+			// Payload types are those the receiver listed in its SDP
+			codec, ok := parser.RTPCodec{}, false
+			if dst := t.endpoints[m.Dst]; dst != nil {
+				codec, ok = dst.codecs[h.PayloadType]
+			}
+			if !ok {
+				codec, ok = parser.StaticRTPCodec(h.PayloadType)
+			}
+			if ok {
+				s.Codec = codec.Name
+				if codec.ClockRate > 0 {
+					s.clockRate = codec.ClockRate
+				}
+			}
+			c.streams[key] = s
+		}
+		s.update(h, ts)
+		return
+	}
+
+	for _, p := range m.RTCP {
+		for _, r := range p.Reports {
+			for _, s := range c.streams {
+				if s.ssrc != r.SSRC {
+					continue
+				}
+				s.Reported = true
+				s.ReportedLossPct = r.FractionLost * 100
+				s.ReportedLost = r.CumulativeLost
+				s.ReportedJitterMs = float64(r.Jitter) / float64(s.clockRate) * 1000
+			}
+		}
+	}
+}
+
+// update counts a packet of the stream, tracking the extended highest
+// sequence number and the interarrival jitter estimate (RFC 3550
+// appendices A.1 and A.8).
+func (s *stream) update(h *parser.RTPHeader, ts time.Time) {
+	if s.Packets == 0 {
+		s.baseSeq, s.maxSeq = h.Sequence, h.Sequence
+	} else if delta := h.Sequence - s.maxSeq; delta != 0 {
+		if delta < 0x8000 {
+			if h.Sequence < s.maxSeq {
+				s.cycles += 1 << 16 // wrapped
+			}
+			s.maxSeq = h.Sequence
+		} else {
+			s.OutOfOrder++
+		}
+	}
+	s.Packets++
+	s.LastSeen = ts
+	s.Expected = int(s.cycles + uint32(s.maxSeq) - uint32(s.baseSeq) + 1)
+	s.Lost = max(s.Expected-s.Packets, 0)
+	s.LossPct = float64(s.Lost) / float64(s.Expected) * 100
+
+	if !s.prevTime.IsZero() {
+		d := ts.Sub(s.prevTime).Seconds()*float64(s.clockRate) - float64(int32(h.Timestamp-s.prevTS))
+		s.jitter += (math.Abs(d) - s.jitter) / 16
+		s.JitterMs = s.jitter / float64(s.clockRate) * 1000
+		s.MaxJitterMs = max(s.MaxJitterMs, s.JitterMs)
+	}
+	s.prevTime, s.prevTS = ts, h.Timestamp
+}
+
+// Calls returns every call, most recently started first.
+func (t *Tracker) Calls() []Call {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]Call, 0, len(t.calls))
+	for _, c := range t.calls {
+		cp := c.Call
+		cp.Media = append([]string{}, c.Media...)
+		cp.Streams = make([]Stream, 0, len(c.streams))
+		var expected, lost int
+		for _, s := range c.streams {
+			cp.Streams = append(cp.Streams, s.Stream)
+			expected += s.Expected
+			lost += s.Lost
+			cp.JitterMs = max(cp.JitterMs, s.JitterMs)
+		}
+		sort.Slice(cp.Streams, func(i, j int) bool { return cp.Streams[i].FirstSeen.Before(cp.Streams[j].FirstSeen) })
+		if expected > 0 {
+			cp.LossPct = float64(lost) / float64(expected) * 100
+		}
+		if c.Answered != nil {
+			end := c.LastSeen
+			if c.End != nil {
+				end = *c.End
+			}
+			cp.DurationSec = end.Sub(*c.Answered).Seconds()
+		}
+		out = append(out, cp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.After(out[j].Start) })
+	return out
+}
+
+// Reset clears the calls and the media endpoints registered with the
+// parser.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls = make(map[string]*call)
+	t.endpoints = make(map[string]*endpoint)
+	parser.ForgetMedia()
+}
@@ -1,27 +1,254 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
+	"sniffox/internal/audit"
+	"sniffox/internal/clientauth"
+	"sniffox/internal/coloring"
+	"sniffox/internal/detect"
 	"sniffox/internal/engine"
+	"sniffox/internal/geoip"
 	"sniffox/internal/handlers"
+	"sniffox/internal/hostgroup"
+	"sniffox/internal/matrix"
+	"sniffox/internal/netflow"
+	"sniffox/internal/offload"
+	"sniffox/internal/profiles"
+	"sniffox/internal/schedule"
+	"sniffox/internal/sessionstore"
+	"sniffox/internal/stream"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Exit(runBench(os.Args[2:]))
+	}
+
 	port := flag.Int("port", 8080, "HTTP server port")
+	trusted := flag.String("trusted", "", "Comma-separated MAC/IP addresses of routers or VRRP/HSRP peers excluded from MAC flapping alerts")
+	geoDB := flag.String("geoip-db", "", "Path to a GeoLite2 Country or City .mmdb database")
+	asnDB := flag.String("asn-db", "", "Path to a GeoLite2 ASN .mmdb database")
+	egressPolicy := flag.String("egress-policy", "", "JSON file with allowed/denied destination countries and ASNs")
+	groups := flag.String("groups", "", "JSON file of host groups (name, cidrs, macs) used to tag traffic")
+	subnets := flag.String("subnets", "", "Comma-separated internal subnets for the traffic matrix, as name=CIDR or CIDR")
+	seenDB := flag.String("seen-db", "", "JSON file that remembers the domains and external IPs seen across captures, for newly-observed alerts")
+	icsWriters := flag.String("ics-writers", "", "Comma-separated IPs/CIDRs of hosts allowed to write to Modbus, DNP3 and S7 devices")
+	ntpServers := flag.String("ntp-servers", "", "Comma-separated IPs/CIDRs of the time servers clients should sync against; replies from others raise alerts")
+	verifyChecksums := flag.Bool("verify-checksums", true, "Flag packets with bad IPv4/TCP checksums; disable when capturing on a host that offloads checksums to the NIC")
+	mtu := flag.Int("mtu", offload.DefaultMTU, "Link MTU; larger packets are flagged as jumbo frames or segmentation offload (0 disables)")
+	resegment := flag.Bool("resegment-offload", false, "Count TCP segments larger than the MTU as the wire-sized segments they were split into in flow and protocol statistics")
+	objectLimit := flag.Int("http-object-limit", stream.DefaultObjectLimit, "Largest HTTP response body, in bytes, kept whole for /api/streams/{id}/objects; HTTP streams buffer up to this much server data")
+	netflowCollector := flag.String("netflow", "", "host:port of a NetFlow v9 or IPFIX collector to send the flows of live captures to as they expire")
+	netflowFormat := flag.String("netflow-format", netflow.FormatV9, "Flow export format: v9 or ipfix")
+	netflowActive := flag.Duration("netflow-active", netflow.DefaultActiveTimeout, "How often long-lived flows are exported while active")
+	netflowInactive := flag.Duration("netflow-inactive", netflow.DefaultInactiveTimeout, "How long a flow must be idle to be exported as ended")
+	rulesFile := flag.String("rules", "", "Suricata-style rules file of payload signatures to raise alerts with")
+	homeNet := flag.String("home-net", "", "Comma-separated addresses and CIDRs of $HOME_NET in signature rules (default the private ranges)")
+	allowReplay := flag.Bool("allow-replay", false, "Allow /api/replay to transmit the loaded packets on a network interface")
+	colorFilters := flag.String("colorfilters", "", "Wireshark colorfilters file to import as packet coloring rules")
+	decodeAs := flag.String("decode-as", "decode-as.json", "JSON file holding the decode-as table; loaded at startup and rewritten when /api/decode-as changes it (empty disables saving)")
+	autosave := flag.Duration("autosave", 5*time.Minute, "How often live captures that are not recorded are checkpointed to the sessions directory (0 disables)")
+	sessionStore := flag.String("sessions-store", "", "Where saved sessions and finished recordings are kept: a directory, share:///mnt/path for a mounted network share, or s3://bucket/prefix[?region=..&endpoint=..] (default the sessions directory)")
+	auditLog := flag.String("audit-log", "audit.jsonl", "File the audit trail of captures, session changes, exports and stream views is appended to (empty keeps it in memory only)")
+	profilesFile := flag.String("profiles", "profiles.json", "JSON file holding the capture profiles; loaded at startup and rewritten when /api/profiles changes them (empty keeps them in memory only)")
+	schedulesFile := flag.String("schedules", "schedules.json", "JSON file holding the scheduled captures; loaded at startup and rewritten when /api/schedules changes them (empty keeps them in memory only)")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate (chain) to serve HTTPS with; needs -tls-key")
+	tlsKey := flag.String("tls-key", "", "PEM private key of -tls-cert")
+	clientCA := flag.String("client-ca", "", "PEM file of CAs whose client certificates are accepted; when set, every request must present one (needs -tls-cert)")
+	clientUsers := flag.String("client-users", "", "JSON file mapping client certificates (fingerprint, cn or email) to a user name and an admin or viewer role; without it every certificate -client-ca signed is an admin")
+	keyLogFile := flag.String("tls-keylog", os.Getenv("SSLKEYLOGFILE"), "SSLKEYLOGFILE to load TLS secrets from and watch for new ones, for decrypting followed TLS streams (default $SSLKEYLOGFILE)")
 	flag.Parse()
 
 	eng := engine.New()
+	if *trusted != "" {
+		eng.SetTrustedAddrs(strings.Split(*trusted, ","))
+	}
+	if *geoDB != "" || *asnDB != "" {
+		db, err := geoip.Open(*geoDB, *asnDB)
+		if err != nil {
+			log.Fatalf("GeoIP: %v", err)
+		}
+		eng.SetGeoIP(db)
+	}
+	if *egressPolicy != "" {
+		data, err := os.ReadFile(*egressPolicy)
+		if err != nil {
+			log.Fatalf("Egress policy: %v", err)
+		}
+		var p detect.EgressPolicy
+		if err := json.Unmarshal(data, &p); err != nil {
+			log.Fatalf("Egress policy %s: %v", *egressPolicy, err)
+		}
+		eng.SetEgressPolicy(p)
+	}
+	if *groups != "" {
+		data, err := os.ReadFile(*groups)
+		if err != nil {
+			log.Fatalf("Host groups: %v", err)
+		}
+		var g []hostgroup.Group
+		if err := json.Unmarshal(data, &g); err != nil {
+			log.Fatalf("Host groups %s: %v", *groups, err)
+		}
+		if err := eng.SetHostGroups(g); err != nil {
+			log.Fatalf("Host groups %s: %v", *groups, err)
+		}
+	}
+	if *subnets != "" {
+		if err := eng.SetSubnets(matrix.ParseSubnets(strings.Split(*subnets, ","))); err != nil {
+			log.Fatalf("Subnets: %v", err)
+		}
+	}
+	if *seenDB != "" {
+		if err := eng.LoadSeenMemory(*seenDB); err != nil {
+			log.Fatalf("Seen memory: %v", err)
+		}
+	}
+	if *icsWriters != "" {
+		eng.SetICSWriters(strings.Split(*icsWriters, ","))
+	}
+	if *ntpServers != "" {
+		eng.SetNTPServers(strings.Split(*ntpServers, ","))
+	}
+	eng.SetVerifyChecksums(*verifyChecksums)
+	eng.SetMTU(*mtu)
+	eng.SetResegmentOffload(*resegment)
+	eng.SetHTTPObjectLimit(*objectLimit)
+	if *netflowCollector != "" {
+		x, err := netflow.New(netflow.Config{
+			Collector:       *netflowCollector,
+			Format:          *netflowFormat,
+			ActiveTimeout:   *netflowActive,
+			InactiveTimeout: *netflowInactive,
+		})
+		if err != nil {
+			log.Fatalf("Flow export: %v", err)
+		}
+		eng.SetFlowExporter(x)
+		log.Printf("Exporting flows to %s as %s", *netflowCollector, x.Stats().Format)
+	}
+	eng.SetReplayAllowed(*allowReplay)
+	eng.SetAutosaveInterval(*autosave)
+	if *sessionStore != "" {
+		st, err := sessionstore.Open(*sessionStore)
+		if err != nil {
+			log.Fatalf("Session store: %v", err)
+		}
+		eng.SetSessionStore(st)
+		log.Printf("Sessions are kept in %s", st)
+	}
+	if *auditLog != "" {
+		l, err := audit.Open(*auditLog)
+		if err != nil {
+			log.Fatalf("Audit log: %v", err)
+		}
+		eng.SetAuditLog(l)
+	}
+	if *profilesFile != "" {
+		ps, err := profiles.Open(*profilesFile)
+		if err != nil {
+			log.Fatalf("Capture profiles: %v", err)
+		}
+		eng.SetProfiles(ps)
+	}
+	if *schedulesFile != "" {
+		ss, err := schedule.Open(*schedulesFile)
+		if err != nil {
+			log.Fatalf("Scheduled captures: %v", err)
+		}
+		eng.SetSchedules(ss)
+	}
+	if *keyLogFile != "" {
+		go eng.TLSKeys().Watch(*keyLogFile, 2*time.Second, nil)
+	}
+	if *homeNet != "" {
+		if err := eng.SetHomeNet(strings.Split(*homeNet, ",")); err != nil {
+			log.Fatalf("Home net: %v", err)
+		}
+	}
+	if *rulesFile != "" {
+		f, err := os.Open(*rulesFile)
+		if err != nil {
+			log.Fatalf("Signature rules: %v", err)
+		}
+		n, errs := eng.LoadRules(f)
+		f.Close()
+		for _, e := range errs {
+			log.Printf("Signature rules %s:%d: %s", *rulesFile, e.Line, e.Error)
+		}
+		log.Printf("Loaded %d signature rules from %s", n, *rulesFile)
+	}
+	if *colorFilters != "" {
+		f, err := os.Open(*colorFilters)
+		if err != nil {
+			log.Fatalf("Coloring rules: %v", err)
+		}
+		imp, err := coloring.ImportWireshark(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Coloring rules %s: %v", *colorFilters, err)
+		}
+		for _, s := range imp.Skipped {
+			log.Printf("Coloring rule %q skipped: %s", s.Name, s.Reason)
+		}
+		if err := eng.SetColoringRules(imp.Rules); err != nil {
+			log.Fatalf("Coloring rules %s: %v", *colorFilters, err)
+		}
+	}
+
+	if *decodeAs != "" {
+		if err := eng.LoadDecodeAs(*decodeAs); err != nil {
+			log.Fatalf("Decode-as table: %v", err)
+		}
+	}
 
 	mux := http.NewServeMux()
 	handlers.RegisterRoutes(mux, eng)
+	handlers.StartScheduler(eng)
 
 	addr := fmt.Sprintf(":%d", *port)
-	log.Printf("Sniffox listening on http://localhost%s", addr)
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	srv := &http.Server{Addr: addr, Handler: mux}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("-tls-cert and -tls-key go together")
+	}
+	if *clientCA != "" {
+		if *tlsCert == "" {
+			log.Fatal("-client-ca needs -tls-cert and -tls-key")
+		}
+		cfg, err := clientauth.ServerConfig(*clientCA)
+		if err != nil {
+			log.Fatalf("Client CA: %v", err)
+		}
+		var users []clientauth.User
+		if *clientUsers != "" {
+			if users, err = clientauth.LoadUsers(*clientUsers); err != nil {
+				log.Fatalf("Client users: %v", err)
+			}
+		}
+		srv.TLSConfig = cfg
+		srv.Handler = clientauth.New(users).Middleware(mux)
+		log.Printf("Client certificates required (CAs from %s)", *clientCA)
+	} else if *clientUsers != "" {
+		log.Fatal("-client-users needs -client-ca")
+	}
+
+	var err error
+	if *tlsCert != "" {
+		log.Printf("Sniffox listening on https://localhost%s", addr)
+		err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		log.Printf("Sniffox listening on http://localhost%s", addr)
+		err = srv.ListenAndServe()
+	}
+	if err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
 }
@@ -28,8 +28,10 @@ const App = (() => {
     function init() {
         els.interfaceSelect = document.getElementById('interface-select');
         els.bpfFilter = document.getElementById('bpf-filter');
+        els.resolveHosts = document.getElementById('resolve-hosts');
         els.displayFilter = document.getElementById('display-filter');
         els.filterPreset = document.getElementById('filter-preset');
+        els.profileSelect = document.getElementById('profile-select');
         els.btnStart = document.getElementById('btn-start');
         els.btnStop = document.getElementById('btn-stop');
         els.btnClear = document.getElementById('btn-clear');
@@ -40,6 +42,8 @@ const App = (() => {
         els.connectionStatus = document.getElementById('connection-status');
         els.packetCount = document.getElementById('packet-count');
         els.displayedCount = document.getElementById('displayed-count');
+        els.statusDropped = document.getElementById('status-dropped');
+        els.droppedCount = document.getElementById('dropped-count');
         els.captureInfo = document.getElementById('capture-info');
         els.welcomeState = document.getElementById('welcome-state');
         els.captureTabs = document.getElementById('capture-tabs');
@@ -54,9 +58,12 @@ const App = (() => {
         els.pcapFile.addEventListener('change', uploadPcap);
         els.displayFilter.addEventListener('input', applyDisplayFilter);
         els.filterPreset.addEventListener('change', onFilterPreset);
+        els.profileSelect.addEventListener('change', onProfileSelect);
+        loadProfiles();
         els.btnTheme.addEventListener('click', toggleTheme);
 
         PacketList.init();
+        I18n.init();
         PacketDetail.init();
         HexView.init();
         View3D.init();
@@ -250,6 +257,8 @@ const App = (() => {
             setConnectionState('connected');
             clearReconnect();
             send('get_interfaces', null);
+            // flow_update only carries changes; start from the full table
+            send('get_flows', null);
         };
 
         ws.onmessage = (evt) => {
@@ -315,7 +324,16 @@ const App = (() => {
                 setCaptureState(true, msg.payload);
                 break;
             case 'capture_stopped':
-                setCaptureState(false, null);
+                setCaptureState(false, msg.payload);
+                break;
+            case 'schedule_started':
+                showToast('Scheduled capture "' + msg.payload.name + '" started on ' + msg.payload.interface, 'info');
+                break;
+            case 'session_saved':
+                showToast('Saved session "' + msg.payload.name + '" (' + msg.payload.packets + ' packets)', 'success');
+                break;
+            case 'profile_started':
+                applyProfile(msg.payload);
                 break;
             case 'stats':
                 updateStats(msg.payload);
@@ -324,7 +342,7 @@ const App = (() => {
                 showToast(msg.payload.message, 'error');
                 break;
             case 'flow_update':
-                Flows.update(msg.payload);
+                Flows.applyDelta(msg.payload);
                 updateFlowCount();
                 break;
             case 'stream_data':
@@ -337,6 +355,9 @@ const App = (() => {
             case 'capture_stats':
                 updateStats(msg.payload);
                 break;
+            case 'alert':
+                Security.ingest(msg.payload);
+                break;
             case 'stream_event':
                 if (typeof Streams !== 'undefined' && Streams.handleStreamEvent) {
                     Streams.handleStreamEvent(msg.payload);
@@ -374,8 +395,14 @@ const App = (() => {
     function populateInterfaces(interfaces) {
         els.interfaceSelect.innerHTML = '<option value="">-- Select Interface --</option>';
         if (!interfaces) return;
+        // "any" captures every interface separately and tags each packet
+        const anyOpt = document.createElement('option');
+        anyOpt.value = 'any';
+        anyOpt.textContent = 'All interfaces';
+        els.interfaceSelect.appendChild(anyOpt);
         const allAddrs = [];
         interfaces.forEach(iface => {
+            if (iface.name === 'any') return;
             const opt = document.createElement('option');
             opt.value = iface.name;
             const addrs = iface.addresses ? ` (${iface.addresses.join(', ')})` : '';
@@ -400,22 +427,109 @@ const App = (() => {
         clearPackets();
         send('start_capture', {
             interface: iface,
-            bpfFilter: els.bpfFilter.value
+            bpfFilter: els.bpfFilter.value,
+            resolveHosts: els.resolveHosts.checked
         });
     }
 
+    // Capture profiles: named interface, filter and limit settings kept on
+    // the server. Picking one starts it; the last entry saves the current
+    // toolbar settings as a new profile.
+    function loadProfiles() {
+        fetch('/api/profiles')
+            .then(r => r.ok ? r.json() : [])
+            .then(list => {
+                els.profileSelect.innerHTML = '<option value="">Profiles</option>';
+                (list || []).forEach(p => {
+                    const opt = document.createElement('option');
+                    opt.value = p.name;
+                    opt.textContent = p.name;
+                    if (p.description) opt.title = p.description;
+                    els.profileSelect.appendChild(opt);
+                });
+                const save = document.createElement('option');
+                save.value = '__save__';
+                save.textContent = 'Save current as profile\u2026';
+                els.profileSelect.appendChild(save);
+            })
+            .catch(() => {});
+    }
+
+    function onProfileSelect() {
+        const name = els.profileSelect.value;
+        els.profileSelect.value = '';
+        if (!name) return;
+        if (name === '__save__') {
+            saveProfile();
+            return;
+        }
+        clearPackets();
+        send('start_profile', { name });
+    }
+
+    function saveProfile() {
+        const iface = els.interfaceSelect.value;
+        if (!iface) {
+            showToast('Select an interface to save in the profile', 'error');
+            return;
+        }
+        const name = prompt('Profile name:');
+        if (!name || !name.trim()) return;
+        const profile = {
+            name: name.trim(),
+            capture: {
+                interface: iface,
+                bpfFilter: els.bpfFilter.value,
+                resolveHosts: els.resolveHosts.checked
+            },
+            displayFilter: els.displayFilter.value.trim()
+        };
+        fetch('/api/profiles', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(profile)
+        })
+            .then(r => {
+                if (!r.ok) return r.text().then(t => { throw new Error(t); });
+                showToast('Saved profile ' + profile.name, 'success');
+                loadProfiles();
+            })
+            .catch(err => showToast('Saving profile failed: ' + err.message, 'error'));
+    }
+
+    // applyProfile mirrors a started profile in the toolbar
+    function applyProfile(p) {
+        const cap = p.capture || {};
+        const ifaces = cap.interface || [];
+        if (ifaces.length === 1) els.interfaceSelect.value = ifaces[0];
+        els.bpfFilter.value = cap.bpfFilter || '';
+        els.resolveHosts.checked = !!cap.resolveHosts;
+        els.displayFilter.value = p.displayFilter || '';
+        applyDisplayFilter();
+        showToast('Started profile ' + p.name, 'success');
+    }
+
     function stopCapture() {
         // Optimistic UI — update immediately for responsiveness
         setCaptureState(false, null);
         send('stop_capture', null);
     }
 
+    // Auto-stop reasons sent with capture_stopped
+    const STOP_REASONS = {
+        packets: 'packet limit reached',
+        duration: 'duration limit reached',
+        bytes: 'size limit reached',
+    };
+
     function setCaptureState(capturing, info) {
         isCapturing = capturing;
         els.btnStart.disabled = capturing;
         els.btnStop.disabled = !capturing;
         els.interfaceSelect.disabled = capturing;
+        els.profileSelect.disabled = capturing;
         els.bpfFilter.disabled = capturing;
+        els.resolveHosts.disabled = capturing;
         // Sync graph page buttons
         if (els.graphBtnStart) els.graphBtnStart.disabled = capturing;
         if (els.graphBtnStop) els.graphBtnStop.disabled = !capturing;
@@ -428,7 +542,9 @@ const App = (() => {
             els.captureInfo.textContent = 'Capturing on ' + (info.interfaceName || '');
             showToast('Capture started on ' + (info.interfaceName || ''), 'success');
         } else if (!capturing) {
-            els.captureInfo.textContent = 'Capture stopped';
+            const limit = info && STOP_REASONS[info.reason];
+            els.captureInfo.textContent = limit ? 'Capture stopped: ' + limit : 'Capture stopped';
+            if (limit) showToast('Capture stopped: ' + limit, 'info');
         }
     }
 
@@ -552,6 +668,11 @@ const App = (() => {
         if (stats.packetCount !== undefined) {
             els.packetCount.textContent = stats.packetCount;
         }
+        // Only live captures report drops; hide the counter until there are some
+        if (stats.droppedCount !== undefined) {
+            els.droppedCount.textContent = stats.droppedCount;
+            els.statusDropped.style.display = stats.droppedCount > 0 ? '' : 'none';
+        }
     }
 
     function showToast(message, type) {
@@ -583,6 +704,12 @@ const App = (() => {
                 Sessions.saveFromPalette();
             }
         });
+        const shareBtn = document.getElementById('btn-share-snapshot');
+        if (shareBtn) {
+            shareBtn.addEventListener('click', () => {
+                if (typeof Sessions !== 'undefined') Sessions.shareSnapshot();
+            });
+        }
     }
 
     // --- Resizers ---
@@ -26,7 +26,11 @@ const CommandPalette = (() => {
         { id: 'stop-capture', label: 'Stop Capture', section: 'Capture', icon: '&#9632;', action: () => document.getElementById('btn-stop')?.click() },
         { id: 'clear-packets', label: 'Clear All Packets', section: 'Capture', icon: '&#10006;', action: () => document.getElementById('btn-clear')?.click() },
         { id: 'export-pcap', label: 'Download PCAP Export', section: 'Capture', icon: '&#11015;', action: () => window.location.href = '/api/export' },
+        { id: 'export-pcapng', label: 'Download PCAPNG Export', section: 'Capture', icon: '&#11015;', action: () => window.location.href = '/api/export?format=pcapng' },
+        { id: 'export-pcap-displayed', label: 'Download Displayed Packets as PCAP', section: 'Capture', icon: '&#11015;', action: () => window.location.href = '/api/export?filter=' + encodeURIComponent(document.getElementById('display-filter')?.value || '') },
+        { id: 'export-pcap-headers', label: 'Download Headers-only PCAP', section: 'Capture', icon: '&#11015;', action: () => window.location.href = '/api/export?strip=payload' },
         { id: 'save-session', label: 'Save Current Session', section: 'Capture', icon: '&#128190;', action: () => { if (typeof Sessions !== 'undefined') Sessions.saveFromPalette(); } },
+        { id: 'share-snapshot', label: 'Share Read-only Snapshot', section: 'Capture', icon: '&#128279;', action: () => { if (typeof Sessions !== 'undefined') Sessions.shareSnapshot(); } },
 
         // Filters
         { id: 'filter-tcp', label: 'Filter: TCP only', section: 'Filters', icon: '&#128269;', action: () => setFilter('tcp') },
@@ -1,4 +1,4 @@
-// flows.js — Flow table module: receives flow_update messages, renders sortable flow table
+// flows.js — Flow table module: applies flow_update deltas, renders sortable flow table
 'use strict';
 
 const Flows = (() => {
@@ -7,6 +7,7 @@ const Flows = (() => {
     let sortKey = 'lastSeen';
     let sortAsc = false;
     let visible = false;
+    let clock = 0; // newest rateEnd: the capture second sparklines end at
 
     function init() {
         container = document.getElementById('flow-table-body');
@@ -27,8 +28,24 @@ const Flows = (() => {
     function update(flows) {
         if (!Array.isArray(flows)) return;
         flowMap.clear();
+        clock = 0;
         for (const f of flows) {
             flowMap.set(f.id, f);
+            clock = Math.max(clock, f.rateEnd || 0);
+        }
+        if (visible) render();
+    }
+
+    // applyDelta merges a flow_update: changed flows replace their old
+    // entry and evicted flows are dropped.
+    function applyDelta(delta) {
+        if (!delta) return;
+        for (const f of delta.flows || []) {
+            flowMap.set(f.id, f);
+            clock = Math.max(clock, f.rateEnd || 0);
+        }
+        for (const id of delta.removed || []) {
+            flowMap.delete(id);
         }
         if (visible) render();
     }
@@ -51,7 +68,7 @@ const Flows = (() => {
         });
 
         if (flows.length === 0) {
-            container.innerHTML = '<tr><td colspan="9" class="flow-empty">No flows detected — start a capture to see connections</td></tr>';
+            container.innerHTML = '<tr><td colspan="10" class="flow-empty">No flows detected — start a capture to see connections</td></tr>';
             return;
         }
 
@@ -62,15 +79,18 @@ const Flows = (() => {
                 : '< 1s';
             const stateClass = f.tcpState ? 'flow-state-' + f.tcpState.toLowerCase().replace(/_/g, '') : '';
 
-            html += '<tr class="flow-row" data-flow-id="' + f.id + '">' +
+            const procTitle = f.pid ? ' title="' + esc(f.processName || '?') + ' (pid ' + f.pid + ')"' : '';
+
+            html += '<tr class="flow-row" data-flow-id="' + f.id + '"' + procTitle + '>' +
                 '<td class="flow-id">' + f.id + '</td>' +
-                '<td title="' + esc(f.srcIp) + '">' + esc(f.srcIp) + portStr(f.srcPort) + '</td>' +
-                '<td title="' + esc(f.dstIp) + '">' + esc(f.dstIp) + portStr(f.dstPort) + '</td>' +
-                '<td class="proto-' + (f.protocol || '').toLowerCase() + '">' + esc(f.protocol) + '</td>' +
+                '<td title="' + esc(f.srcIp + hostTitle(f.srcHost) + geoTitle(f.srcGeo)) + '">' + esc(f.srcHost || f.srcIp) + portStr(f.srcPort) + '</td>' +
+                '<td title="' + esc(f.dstIp + hostTitle(f.dstHost) + geoTitle(f.dstGeo)) + '">' + esc(f.dstHost || f.dstIp) + portStr(f.dstPort) + '</td>' +
+                '<td class="proto-' + (f.protocol || '').toLowerCase() + '">' + esc(f.protocol) + appLabel(f) + '</td>' +
                 '<td>' + f.packetCount + '</td>' +
                 '<td>' + formatBytes(f.byteCount) + '</td>' +
+                '<td class="flow-spark">' + sparkline(f) + '</td>' +
                 '<td>' + duration + '</td>' +
-                '<td class="' + stateClass + '">' + esc(f.tcpState || '—') + '</td>' +
+                '<td class="' + stateClass + '">' + esc(f.tcpState || '—') + icmpBadge(f) + '</td>' +
                 '<td class="flow-dir">' + f.fwdPackets + ' / ' + f.revPackets + '</td>' +
                 '</tr>';
         }
@@ -104,8 +124,9 @@ const Flows = (() => {
 
     function clear() {
         flowMap.clear();
+        clock = 0;
         if (container) {
-            container.innerHTML = '<tr><td colspan="9" class="flow-empty">No flows detected — start a capture to see connections</td></tr>';
+            container.innerHTML = '<tr><td colspan="10" class="flow-empty">No flows detected — start a capture to see connections</td></tr>';
         }
     }
 
@@ -113,6 +134,48 @@ const Flows = (() => {
         return port ? ':' + port : '';
     }
 
+    function appLabel(f) {
+        if (f.appProtocol && f.info) return ' / <span class="flow-info" title="' + esc(f.info) + '">' + esc(f.appProtocol) + '</span>';
+        if (f.appProtocol) return ' / ' + esc(f.appProtocol);
+        if (!f.appGuess) return '';
+        const conf = Math.round((f.appGuessConf || 0) * 100);
+        return ' / <span class="flow-guess" title="Statistical guess, ' + conf + '% confidence">' + esc(f.appGuess) + '?</span>';
+    }
+
+    // icmpBadge flags flows that ICMP errors were sent about
+    function icmpBadge(f) {
+        if (!f.icmpErrors) return '';
+        return ' <span class="flow-icmp-errors" title="' + f.icmpErrors + ' ICMP error(s), last: ' + esc(f.lastIcmpError || '') + '">ICMP\u00d7' + f.icmpErrors + '</span>';
+    }
+
+    // sparkline draws the flow's bytes/sec over the last minute of capture
+    // time. The series ends at rateEnd; seconds from then up to the newest
+    // flow's rateEnd had no traffic.
+    function sparkline(f) {
+        if (!f.rate || !f.rate.length) return '';
+        const n = f.rate.length;
+        const shift = Math.max(0, clock - f.rateEnd);
+        if (shift >= n) return '';
+        const vals = f.rate.slice(shift).concat(new Array(shift).fill(0));
+        const peak = Math.max(...vals);
+        if (peak === 0) return '';
+        const pts = vals.map((v, i) => i + ',' + (15 - v / peak * 14).toFixed(1)).join(' ');
+        const title = formatBytes(vals[n - 1]) + '/s now, peak ' + formatBytes(peak) + '/s';
+        return '<svg class="flow-sparkline" viewBox="0 0 ' + (n - 1) + ' 16" preserveAspectRatio="none"><title>' + title + '</title>' +
+            '<polyline points="' + pts + '"/></svg>';
+    }
+
+    function hostTitle(host) {
+        return host ? ' (' + host + ')' : '';
+    }
+
+    function geoTitle(geo) {
+        if (!geo) return '';
+        const place = [geo.city, geo.countryName || geo.country].filter(Boolean).join(', ');
+        const as = geo.asn ? 'AS' + geo.asn + (geo.asOrg ? ' ' + geo.asOrg : '') : '';
+        return ' — ' + [place, as].filter(Boolean).join(' · ');
+    }
+
     function formatBytes(bytes) {
         if (bytes < 1024) return bytes + ' B';
         if (bytes < 1048576) return (bytes / 1024).toFixed(1) + ' KB';
@@ -129,5 +192,5 @@ const Flows = (() => {
         return flowMap.size;
     }
 
-    return { init, update, setVisible, setSort, clear, count };
+    return { init, update, applyDelta, setVisible, setSort, clear, count };
 })();
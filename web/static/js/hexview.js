@@ -9,6 +9,10 @@ const HexView = (() => {
     }
 
     function show(pkt) {
+        if (pkt && pkt.rawHex) {
+            showBytes(pkt.rawHex);
+            return;
+        }
         if (!pkt || !pkt.hexDump) {
             container.innerHTML = '<div class="empty-state">No hex data available</div>';
             return;
@@ -26,6 +30,47 @@ const HexView = (() => {
         }).join('\n');
     }
 
+    // showBytes lays out the packet's bytes like the server's hexDump, one
+    // span per byte in both columns so fields can be highlighted.
+    function showBytes(raw) {
+        const n = raw.length >> 1;
+        const lines = [];
+        for (let off = 0; off < n; off += 16) {
+            let hex = '';
+            let ascii = '';
+            for (let i = off; i < off + 16; i++) {
+                if (i < n) {
+                    const h = raw.substr(i * 2, 2);
+                    const b = parseInt(h, 16);
+                    const c = b >= 0x20 && b <= 0x7e ? esc(String.fromCharCode(b)) : '.';
+                    hex += `<span data-i="${i}">${h}</span> `;
+                    ascii += `<span data-i="${i}">${c}</span>`;
+                } else {
+                    hex += '   ';
+                }
+                if (i === off + 7) hex += ' ';
+            }
+            lines.push(`<span class="hex-offset">${off.toString(16).padStart(4, '0')}</span>  <span class="hex-bytes">${hex}</span> <span class="hex-ascii">|${ascii}|</span>`);
+        }
+        container.innerHTML = lines.join('\n');
+    }
+
+    // highlight marks length bytes from offset; a zero length clears it.
+    function highlight(offset, length) {
+        if (!container) return;
+        container.querySelectorAll('.hex-hl').forEach(el => el.classList.remove('hex-hl'));
+        if (!length) return;
+        let first = null;
+        container.querySelectorAll('span[data-i]').forEach(el => {
+            const i = +el.dataset.i;
+            if (i >= offset && i < offset + length) {
+                el.classList.add('hex-hl');
+                if (!first) first = el;
+            }
+        });
+        if (first) first.scrollIntoView({ block: 'nearest' });
+    }
+
     function clear() {
         if (container) {
             container.innerHTML = '<div class="empty-state">Select a packet to view hex dump</div>';
@@ -36,5 +81,5 @@ const HexView = (() => {
         return s.replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;');
     }
 
-    return { init, show, clear };
+    return { init, show, clear, highlight };
 })();
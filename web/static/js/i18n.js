@@ -0,0 +1,40 @@
+// i18n.js — Renders the Info column from its structured parts with a
+// translated string table, when one exists for the chosen language
+'use strict';
+
+const I18n = (() => {
+    const STORAGE_KEY = 'sniffox-lang';
+    // Message ID -> template; null while showing the server's English text
+    let table = null;
+
+    function init() {
+        const lang = (localStorage.getItem(STORAGE_KEY) || navigator.language || 'en')
+            .split('-')[0].toLowerCase();
+        if (lang === 'en') return;
+        Promise.all([
+            fetch('/api/info-templates').then(r => r.ok ? r.json() : null),
+            fetch('i18n/' + lang + '.json').then(r => r.ok ? r.json() : null),
+        ]).then(([english, translated]) => {
+            if (!english || !translated) return;
+            // IDs missing from the translation keep their English text
+            table = Object.assign(english, translated);
+            PacketList.refresh();
+        }).catch(() => {});
+    }
+
+    // info returns the Info text of pkt in the current language.
+    function info(pkt) {
+        if (!table || !pkt.infoParts) return pkt.info || '';
+        return pkt.infoParts.map(part => {
+            const args = part.args || {};
+            return (table[part.id] || '').replace(/\{(\w+)\}/g, (_, name) => args[name] || '');
+        }).join('');
+    }
+
+    // setLanguage picks the language used from the next page load on.
+    function setLanguage(lang) {
+        localStorage.setItem(STORAGE_KEY, lang);
+    }
+
+    return { init, info, setLanguage };
+})();
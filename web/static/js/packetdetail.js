@@ -38,8 +38,48 @@ const PacketDetail = (() => {
             bar.appendChild(streamBtn);
         }
 
+        // Original Flow button — an ICMP error about a captured flow
+        if (pkt.quotedFlowId) {
+            const flowBtn = document.createElement('button');
+            flowBtn.className = 'detail-stream-btn';
+            flowBtn.textContent = 'Original Flow';
+            flowBtn.title = 'Show the packets of the flow this ICMP error is about';
+            flowBtn.addEventListener('click', () => {
+                const filterInput = document.getElementById('display-filter');
+                if (filterInput) {
+                    filterInput.value = 'flow==' + pkt.quotedFlowId;
+                    filterInput.dispatchEvent(new Event('input'));
+                }
+            });
+            bar.appendChild(flowBtn);
+        }
+
         container.appendChild(bar);
 
+        // Expert info findings, Wireshark style
+        if (pkt.annotations && pkt.annotations.length) {
+            container.appendChild(buildLayerNode({
+                name: '[Expert Info (' + pkt.severity + '): ' + pkt.annotations.join(', ') + ']',
+                fields: pkt.annotations.map(a => ({ name: pkt.severity, value: a })),
+            }));
+        }
+
+        // Dissection cut short by a parser panic or limit
+        if (pkt.malformed) {
+            container.appendChild(buildLayerNode({
+                name: '[Malformed Packet: ' + pkt.malformed + ']',
+                fields: [{ name: 'Reason', value: pkt.malformed }],
+            }));
+        }
+
+        // Datagram rebuilt from IP fragments before decoding
+        if (pkt.reassembled) {
+            container.appendChild(buildLayerNode({
+                name: '[' + pkt.reassembled + ' IP fragments reassembled (' + pkt.length + ' bytes)]',
+                fields: [{ name: 'Fragment count', value: String(pkt.reassembled) }],
+            }));
+        }
+
         pkt.layers.forEach(layer => {
             container.appendChild(buildLayerNode(layer));
         });
@@ -66,11 +106,12 @@ const PacketDetail = (() => {
         fields.className = 'layer-fields';
         if (layer.fields) {
             layer.fields.forEach(f => {
-                fields.appendChild(buildField(f));
+                fields.appendChild(buildField(f, layer));
             });
         }
 
         header.addEventListener('click', () => {
+            select(header, layer);
             fields.classList.toggle('collapsed');
             toggle.textContent = fields.classList.contains('collapsed') ? '\u25B6' : '\u25BC';
         });
@@ -80,21 +121,34 @@ const PacketDetail = (() => {
         return node;
     }
 
-    function buildField(field) {
+    function buildField(field, layer) {
         const row = document.createElement('div');
         row.className = 'field-row';
         row.innerHTML = `<span class="field-name">${esc(field.name)}:</span> ${esc(field.value)}`;
+        // Fields without a known position highlight their whole layer
+        row.addEventListener('click', e => {
+            e.stopPropagation();
+            select(row, field.length ? field : layer);
+        });
 
         if (field.children && field.children.length > 0) {
             const children = document.createElement('div');
             children.className = 'field-children';
-            field.children.forEach(c => children.appendChild(buildField(c)));
+            field.children.forEach(c => children.appendChild(buildField(c, layer)));
             row.appendChild(children);
         }
 
         return row;
     }
 
+    // select marks el as the selected row and highlights the bytes of span
+    // (anything with offset and length) in the hex view.
+    function select(el, span) {
+        container.querySelectorAll('.detail-selected').forEach(s => s.classList.remove('detail-selected'));
+        el.classList.add('detail-selected');
+        HexView.highlight(span.offset || 0, span.length || 0);
+    }
+
     function clear() {
         if (container) {
             container.innerHTML = '<div class="empty-state"><span class="empty-state-icon">&#128269;</span>Select a packet to view details</div>';
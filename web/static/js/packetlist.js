@@ -127,18 +127,26 @@ const PacketList = (() => {
             tr.dataset.index = pktIdx;
             tr.dataset.displayIdx = i;
             tr.className = 'proto-' + pkt.protocol.toLowerCase();
+            if (pkt.severity) tr.classList.add('expert-' + pkt.severity);
             if (pktIdx === selectedIndex) tr.classList.add('selected');
+            else if (pkt.color) {
+                // Coloring rule, applied over the protocol shading
+                tr.style.background = pkt.color.bg;
+                tr.style.color = pkt.color.fg;
+                tr.title = pkt.color.rule;
+            }
             tr.style.height = ROW_HEIGHT + 'px';
             const bm = typeof Bookmarks !== 'undefined' && Bookmarks.isBookmarked(pkt.number);
             if (bm) tr.classList.add('bookmarked');
+            const info = I18n.info(pkt);
             tr.innerHTML =
                 '<td>' + (bm ? '<span class="pkt-star">&#9733;</span>' : '') + pkt.number + '</td>' +
                 '<td>' + pkt.timestamp + '</td>' +
-                '<td title="' + esc(pkt.srcAddr) + '">' + esc(pkt.srcAddr) + '</td>' +
-                '<td title="' + esc(pkt.dstAddr) + '">' + esc(pkt.dstAddr) + '</td>' +
+                addrCell(pkt.srcAddr, pkt.srcHost) +
+                addrCell(pkt.dstAddr, pkt.dstHost) +
                 '<td>' + esc(pkt.protocol) + '</td>' +
                 '<td>' + pkt.length + '</td>' +
-                '<td title="' + esc(pkt.info) + '">' + esc(pkt.info) + '</td>';
+                '<td title="' + esc(info) + '">' + esc(info) + '</td>';
             tr.addEventListener('click', () => selectPacket(pktIdx, tr, i));
             frag.appendChild(tr);
         }
@@ -199,6 +207,12 @@ const PacketList = (() => {
         selectPacket(pktIdx, tr, newDisplayIdx);
     }
 
+    // refresh redraws the visible rows, e.g. after the language changed.
+    function refresh() {
+        renderedRange = { start: 0, end: 0 };
+        renderViewport();
+    }
+
     function applyFilter(filterText) {
         filterFn = Filters.compile(filterText);
         rebuildIndices();
@@ -253,7 +267,7 @@ const PacketList = (() => {
         ctxMenu.innerHTML =
             '<div class="pkt-ctx-item" data-action="toggle-bookmark">&#9733; Bookmark Packet</div>' +
             '<div class="pkt-ctx-sep"></div>' +
-            '<div class="pkt-ctx-item" data-action="follow-stream">Follow TCP Stream</div>' +
+            '<div class="pkt-ctx-item" data-action="follow-stream">Follow Stream</div>' +
             '<div class="pkt-ctx-item" data-action="filter-flow">Filter by Flow</div>' +
             '<div class="pkt-ctx-sep"></div>' +
             '<div class="pkt-ctx-item" data-action="filter-src">Filter by Source IP</div>' +
@@ -379,10 +393,17 @@ const PacketList = (() => {
         return i > 0 ? addr.substring(0, i) : addr;
     }
 
+    // Address cell: the host name when resolution found one, the address
+    // in the tooltip
+    function addrCell(addr, host) {
+        if (!host) return '<td title="' + esc(addr) + '">' + esc(addr) + '</td>';
+        return '<td title="' + esc(addr + ' (' + host + ')') + '">' + esc(host) + '</td>';
+    }
+
     function esc(s) {
         if (!s) return '';
         return s.replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;').replace(/"/g, '&quot;');
     }
 
-    return { init, addPacket, applyFilter, clear, totalCount, displayedCount, navigateByKey };
+    return { init, addPacket, applyFilter, refresh, clear, totalCount, displayedCount, navigateByKey };
 })();
@@ -36,7 +36,7 @@ const PacketModal = (() => {
         document.getElementById('analysis-pkt-num').textContent = '#' + pkt.number;
         document.getElementById('analysis-pkt-proto').textContent = pkt.protocol;
         document.getElementById('analysis-pkt-proto').className = 'modal-proto proto-' + pkt.protocol.toLowerCase();
-        document.getElementById('analysis-pkt-info').textContent = pkt.info;
+        document.getElementById('analysis-pkt-info').textContent = I18n.info(pkt);
 
         // Render all tabs content
         renderSummary(pkt);
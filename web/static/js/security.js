@@ -398,6 +398,20 @@ const Security = (() => {
         }
     }
 
+    // Alerts raised by the backend detectors arrive fully formed
+    function ingest(alert) {
+        if (!alert) return;
+        alertCount++;
+        const entry = Object.assign({}, alert, { id: alertCount });
+        alerts.push(entry);
+        renderAlert(entry);
+        updateBadge();
+        activeAttacks.set(entry.type + ':' + entry.srcIp, {
+            type: entry.type, severity: entry.severity, title: entry.title, srcIp: entry.srcIp, lastSeen: Date.now(),
+        });
+        addAlert({ type: entry.type, severity: entry.severity, srcIp: entry.srcIp, title: entry.title, detail: entry.detail });
+    }
+
     function renderAlert(alert) {
         if (!container) return;
         // Remove empty-state placeholder
@@ -415,6 +429,7 @@ const Security = (() => {
             `<div class="alert-detail">${esc(alert.detail)}</div>` +
             `<div class="alert-actions">` +
                 `<button class="alert-filter-btn" data-ip="${esc(alert.srcIp)}">Filter IP</button>` +
+                (alert.flowId ? `<button class="alert-filter-btn alert-flow-btn">Filter flow</button>` : '') +
                 `<span class="alert-pkt">Pkt #${alert.pktNumber}</span>` +
             `</div>`;
 
@@ -426,6 +441,16 @@ const Security = (() => {
             Router.navigate('capture');
         });
 
+        const flowBtn = el.querySelector('.alert-flow-btn');
+        if (flowBtn) {
+            flowBtn.addEventListener('click', () => {
+                const filterInput = document.getElementById('display-filter');
+                filterInput.value = 'flow==' + alert.flowId;
+                filterInput.dispatchEvent(new Event('input'));
+                Router.navigate('capture');
+            });
+        }
+
         container.prepend(el);
 
         // Cap at 200 entries in DOM
@@ -937,5 +962,9 @@ const Security = (() => {
         return String(s).replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;').replace(/"/g, '&quot;');
     }
 
-    return { init, analyze, clear, addAlert };
+    function getAlerts() {
+        return alerts.slice();
+    }
+
+    return { init, analyze, clear, addAlert, getAlerts, ingest };
 })();
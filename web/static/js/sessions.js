@@ -51,6 +51,8 @@ const Sessions = (() => {
                         '<div class="session-meta-row"><span class="session-meta-label">Date</span><span class="session-meta-val">' + esc(date) + '</span></div>' +
                         '<div class="session-meta-row"><span class="session-meta-label">Packets</span><span class="session-meta-val">' + (s.packets || 0) + '</span></div>' +
                         '<div class="session-meta-row"><span class="session-meta-label">Size</span><span class="session-meta-val">' + size + '</span></div>' +
+                        (s.recording ? '<div class="session-meta-row"><span class="session-meta-label">Source</span><span class="session-meta-val">' + (s.active ? 'Recording (writing)' : 'Recording') + '</span></div>' : '') +
+                        (s.autosave ? '<div class="session-meta-row"><span class="session-meta-label">Source</span><span class="session-meta-val">' + autosaveState(s) + '</span></div>' : '') +
                     '</div>' +
                     '<button class="session-load-btn" data-id="' + esc(s.id) + '">Load Session</button>' +
                 '</div>';
@@ -134,6 +136,38 @@ const Sessions = (() => {
         if (name !== null) saveSession(name);
     }
 
+    // Create a read-only snapshot and copy its share link
+    function shareSnapshot() {
+        const name = prompt('Snapshot name:', 'Snapshot ' + new Date().toLocaleString());
+        if (name === null) return;
+        const alerts = (typeof Security !== 'undefined' && Security.getAlerts) ? Security.getAlerts() : [];
+        const body = JSON.stringify({ name, alerts });
+        fetch('/api/snapshots/create', { method: 'POST', body, headers: { 'Content-Type': 'application/json' } })
+            .then(r => {
+                if (!r.ok) return r.text().then(t => { throw new Error(t); });
+                return r.json();
+            })
+            .then(res => {
+                const url = location.origin + res.url;
+                if (navigator.clipboard) navigator.clipboard.writeText(url).catch(() => {});
+                if (typeof App !== 'undefined' && App.showToast) {
+                    App.showToast('Snapshot link copied: ' + url, 'success');
+                }
+            })
+            .catch(err => {
+                if (typeof App !== 'undefined' && App.showToast) {
+                    App.showToast('Snapshot failed: ' + err.message, 'error');
+                }
+            });
+    }
+
+    function autosaveState(s) {
+        if (s.active) return 'Autosave (capturing)';
+        const at = s.checkpoint ? ', last checkpoint ' + new Date(s.checkpoint).toLocaleString() : '';
+        if (s.interrupted) return 'Autosave, interrupted' + at;
+        return 'Autosave';
+    }
+
     function formatBytes(bytes) {
         if (bytes === 0) return '0 B';
         const k = 1024;
@@ -147,5 +181,5 @@ const Sessions = (() => {
         return String(s).replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;').replace(/"/g, '&quot;');
     }
 
-    return { init, loadList, saveSession, saveFromPalette };
+    return { init, loadList, saveSession, saveFromPalette, shareSnapshot };
 })();
@@ -0,0 +1,98 @@
+// snapshot.js — Read-only viewer for shared analysis snapshots
+'use strict';
+
+const Snapshot = (() => {
+    const MAX_ROWS = 5000;
+    let data = null;
+    let activeTab = 'packets';
+    let bodyEl = null;
+
+    function init() {
+        const theme = localStorage.getItem('sniffox-theme') || 'dark';
+        document.documentElement.setAttribute('data-theme', theme);
+
+        bodyEl = document.getElementById('snapshot-body');
+        document.querySelectorAll('.snapshot-tab').forEach(btn => {
+            btn.addEventListener('click', () => {
+                document.querySelectorAll('.snapshot-tab').forEach(b => b.classList.remove('active'));
+                btn.classList.add('active');
+                activeTab = btn.dataset.tab;
+                render();
+            });
+        });
+
+        const token = new URLSearchParams(location.search).get('token') || '';
+        fetch('/api/snapshots/view?token=' + encodeURIComponent(token))
+            .then(r => {
+                if (!r.ok) return r.text().then(t => { throw new Error(t); });
+                return r.json();
+            })
+            .then(snap => {
+                data = snap;
+                document.getElementById('snapshot-title').textContent =
+                    snap.name + ' — ' + new Date(snap.createdAt).toLocaleString();
+                render();
+            })
+            .catch(err => {
+                document.getElementById('snapshot-title').textContent = 'Snapshot unavailable';
+                bodyEl.innerHTML = '<div class="snapshot-empty">' + esc(err.message) + '</div>';
+            });
+    }
+
+    function render() {
+        if (!data) return;
+        switch (activeTab) {
+            case 'packets':
+                renderTable(['No.', 'Time', 'Source', 'Destination', 'Protocol', 'Length', 'Info'],
+                    data.packets, p => [p.number, p.timestamp, p.srcAddr, p.dstAddr, p.protocol, p.length, p.info]);
+                break;
+            case 'flows':
+                renderTable(['ID', 'Source', 'Destination', 'Protocol', 'State', 'Packets', 'Bytes'],
+                    data.flows, f => [f.id, f.srcIp + ':' + f.srcPort, f.dstIp + ':' + f.dstPort, f.protocol, f.tcpState || '', f.packetCount, f.byteCount]);
+                break;
+            case 'streams':
+                renderTable(['Stream', 'Client', 'Server', 'Client Bytes', 'Server Bytes', 'HTTP'],
+                    data.streams, s => [s.streamId, s.srcAddr + ':' + s.srcPort, s.dstAddr + ':' + s.dstPort, s.clientBytes, s.serverBytes,
+                        s.httpMethod ? s.httpMethod + ' ' + s.httpUrl + (s.httpStatus ? ' → ' + s.httpStatus : '') : '']);
+                break;
+            case 'alerts':
+                renderTable(['Severity', 'Title', 'Detail', 'Source', 'Time'],
+                    data.alerts, a => [a.severity, a.title, a.detail, a.srcIp || '', a.timestamp]);
+                break;
+            case 'notes':
+                renderTable(['Time', 'Packet', 'Flow', 'Note'],
+                    data.notes, n => [n.packetTime || n.createdAt, n.pktNumber || '', n.flowId || '', n.text]);
+                break;
+        }
+    }
+
+    function renderTable(headers, rows, mapRow) {
+        rows = rows || [];
+        if (rows.length === 0) {
+            bodyEl.innerHTML = '<div class="snapshot-empty">Nothing recorded</div>';
+            return;
+        }
+        let html = '<table class="snapshot-table"><thead><tr>';
+        for (const h of headers) html += '<th>' + esc(h) + '</th>';
+        html += '</tr></thead><tbody>';
+        for (const row of rows.slice(0, MAX_ROWS)) {
+            html += '<tr>';
+            for (const cell of mapRow(row)) html += '<td>' + esc(cell) + '</td>';
+            html += '</tr>';
+        }
+        html += '</tbody></table>';
+        if (rows.length > MAX_ROWS) {
+            html += '<div class="snapshot-empty">Showing first ' + MAX_ROWS + ' of ' + rows.length + ' rows</div>';
+        }
+        bodyEl.innerHTML = html;
+    }
+
+    function esc(s) {
+        if (s === null || s === undefined) return '';
+        return String(s).replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;').replace(/"/g, '&quot;');
+    }
+
+    return { init };
+})();
+
+document.addEventListener('DOMContentLoaded', Snapshot.init);
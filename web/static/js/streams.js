@@ -1,4 +1,4 @@
-// streams.js — TCP stream viewer: "Follow TCP Stream" dialog
+// streams.js — stream viewer: "Follow TCP/UDP Stream" dialog
 // ASCII view is capped for display safety; Hex and Raw are download-only.
 'use strict';
 
@@ -28,6 +28,17 @@ const Streams = (() => {
         if (dlHex) dlHex.addEventListener('click', downloadHex);
         if (dlRaw) dlRaw.addEventListener('click', downloadRaw);
 
+        // TLS secrets for decrypting the stream
+        const keylogBtn = document.getElementById('stream-keylog-btn');
+        const keylogInput = document.getElementById('stream-keylog-input');
+        if (keylogBtn && keylogInput) {
+            keylogBtn.addEventListener('click', () => keylogInput.click());
+            keylogInput.addEventListener('change', () => {
+                if (keylogInput.files.length) uploadKeyLog(keylogInput.files[0]);
+                keylogInput.value = '';
+            });
+        }
+
         document.addEventListener('keydown', (e) => {
             if (e.key === 'Escape' && overlay && overlay.classList.contains('stream-visible')) {
                 close();
@@ -48,6 +59,19 @@ const Streams = (() => {
         App.send('get_stream_data', { streamId: streamId });
     }
 
+    // uploadKeyLog sends an SSLKEYLOGFILE to the server and reloads the
+    // stream so it is shown decrypted.
+    function uploadKeyLog(file) {
+        fetch('/api/tls/keys', { method: 'POST', body: file })
+            .then(r => r.ok ? r.json() : r.text().then(t => { throw new Error(t); }))
+            .then(res => {
+                App.showToast('Loaded ' + res.added + ' TLS secrets', 'success');
+                const last = overlay._lastData;
+                if (last) App.send('get_stream_data', { streamId: last.streamId });
+            })
+            .catch(err => App.showToast('Key log: ' + err.message, 'error'));
+    }
+
     function handleStreamData(data) {
         if (!overlay || !overlay.classList.contains('stream-visible')) return;
         overlay._lastData = data;
@@ -56,6 +80,8 @@ const Streams = (() => {
 
     function renderData(data) {
         if (!contentEl) return;
+        const titleEl = overlay.querySelector('.stream-title');
+        if (titleEl) titleEl.textContent = 'Follow ' + (data.protocol || 'TCP') + ' Stream';
 
         let html = '';
 
@@ -85,6 +111,12 @@ const Streams = (() => {
                     html += '<div class="stream-http-header">' + esc(k) + ': ' + esc(v) + '</div>';
                 }
             }
+            if (h.dns && h.dns.length > 0) {
+                html += '<div class="stream-http-headers-title">DNS over HTTPS</div>';
+                for (const d of h.dns) {
+                    html += '<div class="stream-http-header">' + esc(d) + '</div>';
+                }
+            }
             if (h.bodyPreview) {
                 html += '<div class="stream-http-headers-title">Body Preview</div>';
                 html += '<pre class="stream-http-body">' + esc(h.bodyPreview) + '</pre>';
@@ -92,21 +124,130 @@ const Streams = (() => {
             html += '</div>';
         }
 
+        // HTTP/2 and gRPC exchanges
+        if (data.http2 && data.http2.length > 0) {
+            html += '<div class="stream-http-info">';
+            html += '<div class="stream-http-title">HTTP/2 Streams</div>';
+            for (const x of data.http2) {
+                let line = '[' + x.streamId + '] ';
+                if (x.grpcMethod) {
+                    line += '<span class="stream-http-method">gRPC</span> ' + esc(x.grpcMethod);
+                } else if (x.method) {
+                    line += '<span class="stream-http-method">' + esc(x.method) + '</span> ' + esc(x.path || '');
+                }
+                if (x.status) line += ' → <span class="stream-http-status">' + esc(x.status) + '</span>';
+                if (x.grpcStatus) line += ' grpc-status ' + esc(x.grpcStatus);
+                if (x.grpcMessage) line += ' (' + esc(x.grpcMessage) + ')';
+                if (x.reset) line += ' RST ' + esc(x.reset);
+                html += '<div class="stream-http-line">' + line + '</div>';
+                if (x.authority) {
+                    html += '<div class="stream-http-header">:authority: ' + esc(x.authority) + '</div>';
+                }
+                if (x.contentType) {
+                    html += '<div class="stream-http-header">content-type: ' + esc(x.contentType) + '</div>';
+                }
+                for (const d of (x.dns || [])) {
+                    html += '<div class="stream-http-header">DNS: ' + esc(d) + '</div>';
+                }
+                html += '<div class="stream-http-header">' + x.reqBytes + ' B sent, ' + x.respBytes + ' B received</div>';
+            }
+            html += '</div>';
+        }
+
+        // WebSocket frames after an HTTP Upgrade
+        if (data.websocket && data.websocket.length > 0) {
+            html += '<div class="stream-http-info">';
+            html += '<div class="stream-http-title">WebSocket Frames (' + data.websocket.length + ')</div>';
+            for (const f of data.websocket) {
+                let line = (f.fromClient ? '→ ' : '← ') + '<span class="stream-http-method">' + esc(f.type) + '</span>';
+                if (f.message) line += ' (' + esc(f.message) + ')';
+                if (!f.fin) line += ' [fragment]';
+                if (f.compressed) line += ' [deflate]';
+                if (f.closeCode) line += ' code ' + f.closeCode;
+                line += ' ' + formatSize(f.length);
+                if (f.truncated) line += ' [truncated]';
+                html += '<div class="stream-http-line">' + line + '</div>';
+                if (f.preview) {
+                    html += '<div class="stream-http-header">' + esc(f.preview) + '</div>';
+                }
+            }
+            html += '</div>';
+        }
+
+        // SMTP, POP3 and IMAP commands, up to a STARTTLS
+        if (data.mail) {
+            const m = data.mail;
+            html += '<div class="stream-http-info">';
+            html += '<div class="stream-http-title">' + esc(m.protocol) + ' Session</div>';
+            if (m.clientName) html += '<div class="stream-http-line">Client: ' + esc(m.clientName) + '</div>';
+            if (m.authMechanism) {
+                let line = 'Auth: ' + esc(m.authMechanism);
+                if (m.user) line += ' as ' + esc(m.user);
+                line += m.authenticated ? ' (accepted)' : ' (not accepted)';
+                html += '<div class="stream-http-line">' + line + '</div>';
+            }
+            (m.exchanges || []).forEach((x, i) => {
+                if (x.command) html += '<div class="stream-http-line">→ <span class="stream-http-method">' + esc(x.command) + '</span></div>';
+                for (const l of (x.replyLines || [])) {
+                    html += '<div class="stream-http-header">← ' + esc(l) + '</div>';
+                }
+                if (x.reply) html += '<div class="stream-http-header">← ' + esc(x.reply) + '</div>';
+                if (m.starttls && m.starttls.exchange === i) {
+                    html += '<div class="stream-http-line"><span class="stream-http-status">Upgraded to TLS</span> at client byte ' +
+                        m.starttls.clientOffset + ', server byte ' + m.starttls.serverOffset + '</div>';
+                }
+            });
+            for (const msg of (m.messages || [])) {
+                html += '<div class="stream-http-headers-title">Message (' + formatSize(msg.size) + ')</div>';
+                if (msg.from) html += '<div class="stream-http-header">Envelope from: ' + esc(msg.from) + '</div>';
+                if (msg.to) html += '<div class="stream-http-header">Envelope to: ' + esc(msg.to.join(', ')) + '</div>';
+                for (const [k, v] of Object.entries(msg.headers || {})) {
+                    html += '<div class="stream-http-header">' + esc(k) + ': ' + esc(v) + '</div>';
+                }
+            }
+            html += '</div>';
+        }
+
         // Decode base64 data and store for downloads
         lastClientBytes = data.clientData ? atob(data.clientData) : '';
         lastServerBytes = data.serverData ? atob(data.serverData) : '';
 
+        // Decrypted TLS is shown in place of the records; downloads keep
+        // the captured bytes
+        let shownClient = lastClientBytes, shownServer = lastServerBytes, tlsNote = '';
+        if (data.tls) {
+            shownClient = atob(data.decryptedClientData || '');
+            shownServer = atob(data.decryptedServerData || '');
+            tlsNote = ', decrypted';
+            let line = 'Decrypted ' + esc(data.tls.version) + ', ' + esc(data.tls.cipherSuite);
+            if (data.tls.alpn) line += ', ALPN ' + esc(data.tls.alpn);
+            html += '<div class="stream-http-info"><div class="stream-http-line">' + line + '</div></div>';
+        } else if (data.tlsError) {
+            html += '<div class="stream-http-info"><div class="stream-http-line">TLS not decrypted: ' + esc(data.tlsError) + '</div></div>';
+        }
+
+        // UDP conversations report their datagram boundaries
+        let clientMsgs = '', serverMsgs = '';
+        if (data.datagrams) {
+            const fromClient = data.datagrams.filter(d => d.fromClient).length;
+            clientMsgs = fromClient + ' datagrams, ';
+            serverMsgs = (data.datagrams.length - fromClient) + ' datagrams, ';
+        }
+
         html += '<div class="stream-data-section">';
         if (lastClientBytes.length > 0) {
             html += '<div class="stream-direction stream-client">';
-            html += '<div class="stream-direction-label">Client Data (' + formatSize(lastClientBytes.length) + ')</div>';
-            html += '<pre class="stream-data-pre stream-client-data">' + formatAsciiSafe(lastClientBytes) + '</pre>';
+            html += '<div class="stream-direction-label">Client Data (' + clientMsgs + formatSize(lastClientBytes.length) + tlsNote + ')</div>';
+            html += '<pre class="stream-data-pre stream-client-data">' + formatAsciiSafe(shownClient) + '</pre>';
             html += '</div>';
         }
         if (lastServerBytes.length > 0) {
+            // Show HTTP bodies decompressed; downloads keep the captured bytes
+            const shown = data.decodedServerData ? atob(data.decodedServerData) : shownServer;
+            const decodedNote = tlsNote + (data.decodedServerData ? ', bodies decoded' : '');
             html += '<div class="stream-direction stream-server">';
-            html += '<div class="stream-direction-label">Server Data (' + formatSize(lastServerBytes.length) + ')</div>';
-            html += '<pre class="stream-data-pre stream-server-data">' + formatAsciiSafe(lastServerBytes) + '</pre>';
+            html += '<div class="stream-direction-label">Server Data (' + serverMsgs + formatSize(lastServerBytes.length) + decodedNote + ')</div>';
+            html += '<pre class="stream-data-pre stream-server-data">' + formatAsciiSafe(shown) + '</pre>';
             html += '</div>';
         }
         if (lastClientBytes.length === 0 && lastServerBytes.length === 0) {